@@ -0,0 +1,47 @@
+package api
+
+import "context"
+
+// MFARequirement describes the multi-factor authentication a login must be
+// validated with before Vault issues a token
+type MFARequirement struct {
+	MFARequestID   string                       `json:"mfa_request_id"`
+	MFAConstraints map[string]*MFAConstraintAny `json:"mfa_constraints"`
+}
+
+// MFAConstraintAny is satisfied by any one of its methods
+type MFAConstraintAny struct {
+	Any []*MFAMethodID `json:"any"`
+}
+
+// MFAMethodID identifies an MFA method that can satisfy a constraint
+type MFAMethodID struct {
+	Type         string `json:"type"`
+	Name         string `json:"name"`
+	UsesPasscode bool   `json:"uses_passcode"`
+}
+
+// MFAValidate completes a login that returned an MFA requirement. The
+// payload maps the names of MFA methods to their credentials, such as a
+// passcode, or to an empty list for methods that do not use passcodes.
+func (c *Sys) MFAValidate(requestID string, payload map[string]interface{}) (*Secret, error) {
+	body := map[string]interface{}{
+		"mfa_request_id": requestID,
+		"mfa_payload":    payload,
+	}
+
+	r := c.c.NewRequest("PUT", "/v1/sys/mfa/validate")
+	if err := r.SetJSONBody(body); err != nil {
+		return nil, err
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+	resp, err := c.c.RawRequestWithContext(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ParseSecret(resp.Body)
+}
@@ -3,6 +3,7 @@ package audit
 import (
 	"context"
 
+	log "github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/sdk/helper/salt"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -36,6 +37,13 @@ type Backend interface {
 	Invalidate(context.Context)
 }
 
+// Closer can be implemented by audit backends that hold resources, such as
+// background goroutines, that must be released when the backend is disabled
+// or the core is sealed.
+type Closer interface {
+	Close() error
+}
+
 // BackendConfig contains configuration parameters used in the factory func to
 // instantiate audit backends
 type BackendConfig struct {
@@ -47,6 +55,9 @@ type BackendConfig struct {
 
 	// Config is the opaque user configuration provided when mounting
 	Config map[string]string
+
+	// Logger is used by backends that log outside of the request path
+	Logger log.Logger
 }
 
 // Factory is the factory function to create an audit backend.
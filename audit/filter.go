@@ -0,0 +1,328 @@
+package audit
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// Selectors that can be used in filter expressions
+const (
+	FilterSelectorType      = "type"
+	FilterSelectorNamespace = "namespace"
+	FilterSelectorMountType = "mount_type"
+	FilterSelectorMountPath = "mount_path"
+	FilterSelectorOperation = "operation"
+	FilterSelectorPath      = "path"
+	FilterSelectorError     = "error"
+)
+
+var filterSelectors = map[string]bool{
+	FilterSelectorType:      true,
+	FilterSelectorNamespace: true,
+	FilterSelectorMountType: true,
+	FilterSelectorMountPath: true,
+	FilterSelectorOperation: true,
+	FilterSelectorPath:      true,
+	FilterSelectorError:     true,
+}
+
+// Filter is a parsed filter expression that decides whether an audit device
+// logs an entry. Expressions compare selectors with values and combine the
+// comparisons with and, or, not and parentheses, for example:
+//
+//	mount_type == "transit" and not (operation == "update" or error == true)
+//
+// The supported comparisons are == and != for equality, prefix for a string
+// prefix and matches for a regular expression.
+type Filter struct {
+	root filterNode
+}
+
+// NewFilter parses a filter expression
+func NewFilter(expr string) (*Filter, error) {
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid filter: {{err}}", err)
+	}
+
+	p := &filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, errwrap.Wrapf("invalid filter: {{err}}", err)
+	}
+	if tok := p.peek(); tok.kind != filterTokenEOF {
+		return nil, fmt.Errorf("invalid filter: unexpected %q", tok.value)
+	}
+
+	return &Filter{root: root}, nil
+}
+
+// Evaluate returns whether the entry described by the given selector values
+// matches the filter. The error selector may be left unset if it is not known
+// yet, as for request entries that have not been handled; the entry then
+// matches if the filter matches it for either value of the selector, so that
+// requests whose response may be logged are logged too.
+func (f *Filter) Evaluate(fields map[string]string) bool {
+	if _, ok := fields[FilterSelectorError]; ok {
+		return f.root.eval(fields)
+	}
+
+	withError := make(map[string]string, len(fields)+1)
+	for k, v := range fields {
+		withError[k] = v
+	}
+	for _, value := range []string{"false", "true"} {
+		withError[FilterSelectorError] = value
+		if f.root.eval(withError) {
+			return true
+		}
+	}
+	return false
+}
+
+type filterNode interface {
+	eval(map[string]string) bool
+}
+
+type filterAnd struct {
+	left, right filterNode
+}
+
+func (n *filterAnd) eval(fields map[string]string) bool {
+	return n.left.eval(fields) && n.right.eval(fields)
+}
+
+type filterOr struct {
+	left, right filterNode
+}
+
+func (n *filterOr) eval(fields map[string]string) bool {
+	return n.left.eval(fields) || n.right.eval(fields)
+}
+
+type filterNot struct {
+	node filterNode
+}
+
+func (n *filterNot) eval(fields map[string]string) bool {
+	return !n.node.eval(fields)
+}
+
+type filterComparison struct {
+	selector string
+	op       string
+	value    string
+	re       *regexp.Regexp
+}
+
+func (n *filterComparison) eval(fields map[string]string) bool {
+	field := fields[n.selector]
+	switch n.op {
+	case "==":
+		return field == n.value
+	case "!=":
+		return field != n.value
+	case "prefix":
+		return strings.HasPrefix(field, n.value)
+	case "matches":
+		return n.re.MatchString(field)
+	}
+	return false
+}
+
+type filterTokenKind int
+
+const (
+	filterTokenEOF filterTokenKind = iota
+	filterTokenWord
+	filterTokenString
+	filterTokenOp
+	filterTokenLParen
+	filterTokenRParen
+)
+
+type filterToken struct {
+	kind  filterTokenKind
+	value string
+}
+
+// lexFilter splits a filter expression into tokens
+func lexFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, filterToken{kind: filterTokenLParen, value: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, filterToken{kind: filterTokenRParen, value: ")"})
+			i++
+		case c == '=' || c == '!':
+			if i+1 >= len(expr) || expr[i+1] != '=' {
+				return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenOp, value: expr[i : i+2]})
+			i += 2
+		case c == '"':
+			end := i + 1
+			for ; end < len(expr) && expr[end] != '"'; end++ {
+				if expr[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(expr) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			value, err := strconv.Unquote(expr[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at offset %d", i)
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenString, value: value})
+			i = end + 1
+		case c == '_' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)):
+			end := i
+			for end < len(expr) && (expr[end] == '_' || unicode.IsLetter(rune(expr[end])) || unicode.IsDigit(rune(expr[end]))) {
+				end++
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenWord, value: expr[i:end]})
+			i = end
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+		}
+	}
+
+	return append(tokens, filterToken{kind: filterTokenEOF}), nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != filterTokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *filterParser) peekWord(word string) bool {
+	tok := p.peek()
+	return tok.kind == filterTokenWord && tok.value == word
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterOr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekWord("and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterAnd{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (filterNode, error) {
+	if p.peekWord("not") {
+		p.next()
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &filterNot{node: node}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *filterParser) parsePrimary() (filterNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case filterTokenLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok.kind != filterTokenRParen {
+			return nil, fmt.Errorf("expected \")\"")
+		}
+		return node, nil
+	case filterTokenWord:
+		if !filterSelectors[tok.value] {
+			return nil, fmt.Errorf("unknown selector %q", tok.value)
+		}
+	case filterTokenEOF:
+		return nil, fmt.Errorf("unexpected end of expression")
+	default:
+		return nil, fmt.Errorf("expected a selector, found %q", tok.value)
+	}
+
+	n := &filterComparison{
+		selector: tok.value,
+	}
+
+	op := p.next()
+	switch {
+	case op.kind == filterTokenOp:
+	case op.kind == filterTokenWord && (op.value == "prefix" || op.value == "matches"):
+	default:
+		return nil, fmt.Errorf("expected a comparison after %q", n.selector)
+	}
+	n.op = op.value
+
+	value := p.next()
+	switch value.kind {
+	case filterTokenString:
+	case filterTokenWord:
+		// Allow bare booleans, e.g. error == true
+		if value.value != "true" && value.value != "false" {
+			return nil, fmt.Errorf("expected a quoted value, found %q", value.value)
+		}
+	default:
+		return nil, fmt.Errorf("expected a value after %q", op.value)
+	}
+	n.value = value.value
+
+	if n.op == "matches" {
+		re, err := regexp.Compile(n.value)
+		if err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("invalid regular expression %q: {{err}}", n.value), err)
+		}
+		n.re = re
+	}
+
+	return n, nil
+}
@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	fields := map[string]string{
+		FilterSelectorType:      "request",
+		FilterSelectorNamespace: "",
+		FilterSelectorMountType: "transit",
+		FilterSelectorMountPath: "transit/",
+		FilterSelectorOperation: "update",
+		FilterSelectorPath:      "transit/encrypt/my-key",
+		FilterSelectorError:     "false",
+	}
+
+	cases := []struct {
+		expr     string
+		expected bool
+	}{
+		{`mount_type == "transit"`, true},
+		{`mount_type != "transit"`, false},
+		{`path prefix "transit/encrypt/"`, true},
+		{`path prefix "sys/"`, false},
+		{`path matches "^transit/(en|de)crypt/"`, true},
+		{`error == true`, false},
+		{`error == false`, true},
+		{`namespace == ""`, true},
+		{`not mount_type == "transit"`, false},
+		{`not not mount_type == "transit"`, true},
+		{`mount_type == "transit" and operation == "read"`, false},
+		{`mount_type == "kv" or operation == "update"`, true},
+		{`not (mount_type == "transit" and operation == "update") or error == true`, false},
+		{`mount_path == "transit/" and (type == "response" or path matches "encrypt")`, true},
+		{`path prefix "auth/" or path prefix "sys/" or mount_type == "transit" and operation == "read"`, false},
+		{"path == \"transit/encrypt/my-key\"\n\tand type == \"request\"", true},
+	}
+
+	for _, tc := range cases {
+		filter, err := NewFilter(tc.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expr, err)
+		}
+		if actual := filter.Evaluate(fields); actual != tc.expected {
+			t.Fatalf("%s: expected %t, got %t", tc.expr, tc.expected, actual)
+		}
+	}
+}
+
+func TestFilter_UnknownError(t *testing.T) {
+	// The error selector is not known for requests that have not been
+	// handled yet
+	fields := map[string]string{
+		FilterSelectorType:      "request",
+		FilterSelectorMountType: "transit",
+	}
+
+	cases := []struct {
+		expr     string
+		expected bool
+	}{
+		{`error == true`, true},
+		{`error == false`, true},
+		{`error == true and error == false`, false},
+		{`mount_type != "transit" or error == true`, true},
+		{`mount_type != "transit" and error == true`, false},
+		{`type == "response" and error == true`, false},
+	}
+
+	for _, tc := range cases {
+		filter, err := NewFilter(tc.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.expr, err)
+		}
+		if actual := filter.Evaluate(fields); actual != tc.expected {
+			t.Fatalf("%s: expected %t, got %t", tc.expr, tc.expected, actual)
+		}
+	}
+	if _, ok := fields[FilterSelectorError]; ok {
+		t.Fatal("expected the fields not to be modified")
+	}
+}
+
+func TestFilter_Invalid(t *testing.T) {
+	cases := []string{
+		``,
+		`mount_type`,
+		`mount_type ==`,
+		`mount_type = "transit"`,
+		`mount_type == transit`,
+		`unknown == "transit"`,
+		`mount_type == "transit" and`,
+		`(mount_type == "transit"`,
+		`mount_type == "transit")`,
+		`mount_type == "transit`,
+		`mount_type contains "transit"`,
+		`path matches "("`,
+		`"transit" == mount_type`,
+	}
+
+	for _, expr := range cases {
+		if _, err := NewFilter(expr); err == nil {
+			t.Fatalf("%s: expected an error", expr)
+		}
+	}
+}
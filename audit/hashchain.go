@@ -0,0 +1,249 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+const (
+	// chainSequenceField and chainHMACField are the fields added to entries
+	// by a HashChain. The HMAC field is always the last field of the entry.
+	chainSequenceField = "sequence"
+	chainHMACField     = "chain_hmac"
+)
+
+var chainHMACSuffix = []byte(`,"` + chainHMACField + `":"`)
+
+// HashChain links JSON audit entries together to make the removal or
+// alteration of entries detectable. Each entry is given a sequence number and
+// an HMAC, computed with the audit salt, over the HMAC of the previous entry
+// and the entry itself, including its sequence number:
+//
+//	chain_hmac = HMAC(chain_hmac of previous entry + entry)
+//
+// The first entry of a chain has sequence number 1 and an empty previous
+// HMAC.
+type HashChain struct {
+	l        sync.Mutex
+	hashFunc func(context.Context, string) (string, error)
+	sequence uint64
+	prev     string
+}
+
+// NewHashChain returns a chain whose HMACs are computed by the given
+// function, which is expected to be the GetHash function of the backend
+func NewHashChain(hashFunc func(context.Context, string) (string, error)) *HashChain {
+	return &HashChain{
+		hashFunc: hashFunc,
+	}
+}
+
+// Resume continues the chain after the given entry, for instance the last
+// entry of an existing log file. It has no effect once entries have been
+// linked.
+func (c *HashChain) Resume(entry []byte) error {
+	_, sequence, hmac, err := ParseChainedEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if c.sequence == 0 {
+		c.sequence = sequence
+		c.prev = hmac
+	}
+	return nil
+}
+
+// Link adds the sequence number and chain HMAC to the given JSON entry, which
+// may end with a newline. Entries must be linked in the order they are
+// written, so callers must hold the lock that serializes their writes.
+func (c *HashChain) Link(ctx context.Context, entry []byte) ([]byte, error) {
+	trimmed := bytes.TrimRight(entry, "\n")
+	if len(trimmed) < 2 || trimmed[0] != '{' || trimmed[len(trimmed)-1] != '}' {
+		return nil, errors.New("hash chaining requires JSON entries")
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	sequence := c.sequence + 1
+
+	var signed bytes.Buffer
+	signed.Write(trimmed[:len(trimmed)-1])
+	if len(trimmed) > 2 {
+		signed.WriteByte(',')
+	}
+	fmt.Fprintf(&signed, `"%s":%d}`, chainSequenceField, sequence)
+
+	hmac, err := c.hashFunc(ctx, c.prev+signed.String())
+	if err != nil {
+		return nil, err
+	}
+
+	linked := make([]byte, 0, signed.Len()+len(chainHMACSuffix)+len(hmac)+3)
+	linked = append(linked, signed.Bytes()[:signed.Len()-1]...)
+	linked = append(linked, chainHMACSuffix...)
+	linked = append(linked, hmac...)
+	linked = append(linked, "\"}\n"...)
+
+	c.sequence = sequence
+	c.prev = hmac
+
+	return linked, nil
+}
+
+// ParseChainedEntry splits an entry written by a HashChain into the data its
+// chain HMAC was computed over, excluding the previous HMAC, its sequence
+// number and its chain HMAC
+func ParseChainedEntry(entry []byte) (string, uint64, string, error) {
+	entry = bytes.TrimRight(entry, "\r\n")
+
+	idx := bytes.LastIndex(entry, chainHMACSuffix)
+	if idx == -1 || !bytes.HasSuffix(entry, []byte(`"}`)) {
+		return "", 0, "", errors.New("entry is missing a chain HMAC")
+	}
+	hmac := string(entry[idx+len(chainHMACSuffix) : len(entry)-2])
+	signed := string(entry[:idx]) + "}"
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(signed), &fields); err != nil {
+		return "", 0, "", fmt.Errorf("entry is not valid JSON: %v", err)
+	}
+	rawSequence, ok := fields[chainSequenceField]
+	if !ok {
+		return "", 0, "", errors.New("entry is missing a sequence number")
+	}
+	sequence, err := strconv.ParseUint(string(rawSequence), 10, 64)
+	if err != nil {
+		return "", 0, "", errors.New("entry has an invalid sequence number")
+	}
+
+	return signed, sequence, hmac, nil
+}
+
+// HashChainEnabled returns whether the hash_chain option is enabled in the
+// configuration of a backend, checking that its entries can be chained
+func HashChainEnabled(config map[string]string) (bool, error) {
+	raw, ok := config["hash_chain"]
+	if !ok {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid hash_chain: %v", err)
+	}
+	if !enabled {
+		return false, nil
+	}
+
+	if format, ok := config["format"]; ok && format != "json" {
+		return false, errors.New("hash_chain is only supported with the json format")
+	}
+	if config["prefix"] != "" {
+		return false, errors.New("hash_chain is not supported with a prefix")
+	}
+	return true, nil
+}
+
+// ChainIssue describes a problem found while verifying a hash chain
+type ChainIssue struct {
+	// Restart is set when the chain does not continue from the entries
+	// before it, because it restarted at sequence 1 or because the log
+	// starts after the first entry. This is expected when a device was
+	// re-enabled or its log rotated, but is also what removing entries from
+	// the head of the log looks like.
+	Restart bool
+	Message string
+}
+
+// ChainVerifier checks the entries of a hash chained log in the order they
+// were written
+type ChainVerifier struct {
+	hashFunc func(string) (string, error)
+	started  bool
+	sequence uint64
+	prev     string
+}
+
+// NewChainVerifier returns a verifier that computes HMACs with the given
+// function, which must use the salt of the audit device that wrote the log
+func NewChainVerifier(hashFunc func(string) (string, error)) *ChainVerifier {
+	return &ChainVerifier{
+		hashFunc: hashFunc,
+	}
+}
+
+// Verify checks the next entry of the log, returning the issue found with it
+// if any. Errors are only returned if the HMAC of the entry could not be
+// computed.
+func (v *ChainVerifier) Verify(entry []byte) (*ChainIssue, error) {
+	data, sequence, hmac, err := ParseChainedEntry(entry)
+	if err != nil {
+		return &ChainIssue{
+			Message: fmt.Sprintf("invalid entry: %v", err),
+		}, nil
+	}
+
+	var issue *ChainIssue
+	switch {
+	case sequence == 1:
+		issue, err = v.verifyHMAC("", data, sequence, hmac)
+		if issue == nil && err == nil && v.started {
+			issue = &ChainIssue{
+				Restart: true,
+				Message: fmt.Sprintf("chain restarted after sequence %d", v.sequence),
+			}
+		}
+
+	case !v.started:
+		// The previous entry is not available, for instance if the log was
+		// rotated, so the first entry is trusted
+		issue = &ChainIssue{
+			Restart: true,
+			Message: fmt.Sprintf("chain starts at sequence %d, which can not be verified", sequence),
+		}
+
+	case sequence <= v.sequence:
+		issue = &ChainIssue{
+			Message: fmt.Sprintf("sequence %d is out of order after sequence %d", sequence, v.sequence),
+		}
+
+	case sequence > v.sequence+1:
+		issue = &ChainIssue{
+			Message: fmt.Sprintf("%d entries missing between sequence %d and %d", sequence-v.sequence-1, v.sequence, sequence),
+		}
+
+	default:
+		issue, err = v.verifyHMAC(v.prev, data, sequence, hmac)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	v.started = true
+	v.sequence = sequence
+	v.prev = hmac
+
+	return issue, nil
+}
+
+func (v *ChainVerifier) verifyHMAC(prev, data string, sequence uint64, hmac string) (*ChainIssue, error) {
+	expected, err := v.hashFunc(prev + data)
+	if err != nil {
+		return nil, err
+	}
+	if expected != hmac {
+		return &ChainIssue{
+			Message: fmt.Sprintf("entry with sequence %d has been altered", sequence),
+		}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,164 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/helper/salt"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func testHashChainLog(t *testing.T, entries ...string) (*salt.Salt, [][]byte) {
+	t.Helper()
+
+	s, err := salt.NewSalt(context.Background(), &logical.InmemStorage{}, &salt.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain := NewHashChain(func(_ context.Context, data string) (string, error) {
+		return HashString(s, data), nil
+	})
+
+	var lines [][]byte
+	for _, entry := range entries {
+		line, err := chain.Link(context.Background(), []byte(entry+"\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	return s, lines
+}
+
+func testVerifyHashChain(t *testing.T, s *salt.Salt, lines [][]byte) []*ChainIssue {
+	t.Helper()
+
+	verifier := NewChainVerifier(func(data string) (string, error) {
+		return HashString(s, data), nil
+	})
+
+	var issues []*ChainIssue
+	for _, line := range lines {
+		issue, err := verifier.Verify(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if issue != nil {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+func TestHashChain(t *testing.T) {
+	s, lines := testHashChainLog(t, `{"type":"request"}`, `{"type":"response"}`, `{}`, `{"type":"request"}`)
+
+	if !bytes.HasPrefix(lines[1], []byte(`{"type":"response","sequence":2,"chain_hmac":"hmac-sha256:`)) ||
+		!bytes.HasSuffix(lines[1], []byte("\"}\n")) {
+		t.Fatalf("bad entry: %s", lines[1])
+	}
+	if !bytes.HasPrefix(lines[2], []byte(`{"sequence":3,`)) {
+		t.Fatalf("bad entry: %s", lines[2])
+	}
+
+	if issues := testVerifyHashChain(t, s, lines); len(issues) != 0 {
+		t.Fatalf("expected no issues, got %#v", issues[0])
+	}
+
+	// Altered entries are detected
+	altered := append([][]byte{}, lines...)
+	altered[1] = bytes.Replace(lines[1], []byte("response"), []byte("request"), 1)
+	issues := testVerifyHashChain(t, s, altered)
+	if len(issues) != 1 || issues[0].Restart || !strings.Contains(issues[0].Message, "sequence 2 has been altered") {
+		t.Fatalf("bad issues: %#v", issues)
+	}
+
+	// Missing entries are detected
+	issues = testVerifyHashChain(t, s, [][]byte{lines[0], lines[3]})
+	if len(issues) != 1 || issues[0].Restart || !strings.Contains(issues[0].Message, "2 entries missing") {
+		t.Fatalf("bad issues: %#v", issues)
+	}
+
+	// Reordered entries are detected
+	issues = testVerifyHashChain(t, s, [][]byte{lines[0], lines[2], lines[1]})
+	if len(issues) != 2 || !strings.Contains(issues[1].Message, "out of order") {
+		t.Fatalf("bad issues: %#v", issues)
+	}
+
+	// Unchained entries are detected
+	issues = testVerifyHashChain(t, s, [][]byte{lines[0], []byte(`{"type":"request"}`), lines[1]})
+	if len(issues) != 1 || !strings.Contains(issues[0].Message, "invalid entry") {
+		t.Fatalf("bad issues: %#v", issues)
+	}
+
+	// Logs starting after the first entry can be verified from their first
+	// entry on
+	issues = testVerifyHashChain(t, s, lines[1:])
+	if len(issues) != 1 || !issues[0].Restart {
+		t.Fatalf("bad issues: %#v", issues)
+	}
+
+	// Entries are verified with the salt of the device
+	other, _ := testHashChainLog(t)
+	issues = testVerifyHashChain(t, other, lines)
+	if len(issues) != 4 {
+		t.Fatalf("expected every entry to fail verification, got %#v", issues)
+	}
+}
+
+func TestHashChain_Resume(t *testing.T) {
+	s, lines := testHashChainLog(t, `{"type":"request"}`, `{"type":"response"}`)
+
+	chain := NewHashChain(func(_ context.Context, data string) (string, error) {
+		return HashString(s, data), nil
+	})
+	if err := chain.Resume(lines[1]); err != nil {
+		t.Fatal(err)
+	}
+	line, err := chain.Link(context.Background(), []byte(`{"type":"request"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if issues := testVerifyHashChain(t, s, append(lines, line)); len(issues) != 0 {
+		t.Fatalf("expected no issues, got %#v", issues[0])
+	}
+
+	// A new chain restarts the sequence, which is reported as a restart
+	restarted, err := NewHashChain(func(_ context.Context, data string) (string, error) {
+		return HashString(s, data), nil
+	}).Link(context.Background(), []byte(`{"type":"request"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issues := testVerifyHashChain(t, s, append(lines, restarted))
+	if len(issues) != 1 || !issues[0].Restart || !strings.Contains(issues[0].Message, "restarted") {
+		t.Fatalf("bad issues: %#v", issues)
+	}
+}
+
+func TestHashChainEnabled(t *testing.T) {
+	cases := []struct {
+		config  map[string]string
+		enabled bool
+		err     bool
+	}{
+		{map[string]string{}, false, false},
+		{map[string]string{"hash_chain": "false", "format": "jsonx"}, false, false},
+		{map[string]string{"hash_chain": "true"}, true, false},
+		{map[string]string{"hash_chain": "true", "format": "json"}, true, false},
+		{map[string]string{"hash_chain": "true", "format": "jsonx"}, false, true},
+		{map[string]string{"hash_chain": "true", "prefix": "vault"}, false, true},
+		{map[string]string{"hash_chain": "maybe"}, false, true},
+	}
+
+	for _, tc := range cases {
+		enabled, err := HashChainEnabled(tc.config)
+		if (err != nil) != tc.err || enabled != tc.enabled {
+			t.Fatalf("%v: expected %t, %t; got %t, %v", tc.config, tc.enabled, tc.err, enabled, err)
+		}
+	}
+}
@@ -2,18 +2,25 @@ package file
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/hashicorp/errwrap"
+	log "github.com/hashicorp/go-hclog"
+	multierror "github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/sdk/helper/parseutil"
 	"github.com/hashicorp/vault/sdk/helper/salt"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -84,9 +91,73 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		}
 	}
 
+	// Check if rotation is enabled
+	var rotateBytes int64
+	if raw, ok := conf.Config["rotate_bytes"]; ok {
+		value, err := parseutil.ParseInt(raw)
+		if err != nil {
+			return nil, errwrap.Wrapf("invalid rotate_bytes: {{err}}", err)
+		}
+		if value < 0 {
+			return nil, fmt.Errorf("rotate_bytes must not be negative")
+		}
+		rotateBytes = value
+	}
+
+	var rotateDuration time.Duration
+	if raw, ok := conf.Config["rotate_duration"]; ok {
+		value, err := parseutil.ParseDurationSecond(raw)
+		if err != nil {
+			return nil, errwrap.Wrapf("invalid rotate_duration: {{err}}", err)
+		}
+		if value < 0 {
+			return nil, fmt.Errorf("rotate_duration must not be negative")
+		}
+		rotateDuration = value
+	}
+
+	var rotateMaxFiles int
+	if raw, ok := conf.Config["rotate_max_files"]; ok {
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, errwrap.Wrapf("invalid rotate_max_files: {{err}}", err)
+		}
+		if value < 0 {
+			return nil, fmt.Errorf("rotate_max_files must not be negative")
+		}
+		rotateMaxFiles = value
+	}
+
+	rotateCompress := false
+	if raw, ok := conf.Config["rotate_compress"]; ok {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errwrap.Wrapf("invalid rotate_compress: {{err}}", err)
+		}
+		rotateCompress = value
+	}
+
+	hashChain, err := audit.HashChainEnabled(conf.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	switch path {
+	case "stdout", "discard":
+		if rotateBytes > 0 || rotateDuration > 0 {
+			return nil, fmt.Errorf("rotation is only supported when logging to a file")
+		}
+	}
+
+	logger := conf.Logger
+	if logger == nil {
+		logger = log.NewNullLogger()
+	}
+
 	b := &Backend{
 		path:       path,
 		mode:       mode,
+		logger:     logger,
 		saltConfig: conf.SaltConfig,
 		saltView:   conf.SaltView,
 		salt:       new(atomic.Value),
@@ -94,6 +165,11 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 			Raw:          logRaw,
 			HMACAccessor: hmacAccessor,
 		},
+
+		rotateBytes:    rotateBytes,
+		rotateDuration: rotateDuration,
+		rotateMaxFiles: rotateMaxFiles,
+		rotateCompress: rotateCompress,
 	}
 
 	// Ensure we are working with the right type by explicitly storing a nil of
@@ -113,6 +189,10 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		}
 	}
 
+	if hashChain {
+		b.hashChain = audit.NewHashChain(b.GetHash)
+	}
+
 	switch path {
 	case "stdout", "discard":
 		// no need to test opening file if outputting to stdout or discarding
@@ -130,9 +210,10 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 
 // Backend is the audit backend for the file-based audit store.
 //
-// NOTE: This audit backend is currently very simple: it appends to a file.
-// It doesn't do anything more at the moment to assist with rotation
-// or reset the write cursor, this should be done in the future.
+// The backend appends to a file. If rotation is enabled the file is renamed
+// and reopened, while holding the file lock so that no writes are lost, once
+// it reaches a maximum size or age. Rotated files are compressed and pruned
+// in the background.
 type Backend struct {
 	path string
 
@@ -143,6 +224,30 @@ type Backend struct {
 	f        *os.File
 	mode     os.FileMode
 
+	// logger reports the errors of the background processing of rotated
+	// files
+	logger log.Logger
+
+	// size and openedAt describe the current file, and are protected by the
+	// file lock
+	size     int64
+	openedAt time.Time
+
+	rotateBytes    int64
+	rotateDuration time.Duration
+	rotateMaxFiles int
+	rotateCompress bool
+
+	// rotateLock serializes the compression and pruning of rotated files,
+	// which rotateWG tracks, so that rotations wait for the files of previous
+	// ones to be processed
+	rotateLock sync.Mutex
+	rotateWG   sync.WaitGroup
+
+	// hashChain links entries when hash chaining is enabled. Entries are
+	// linked while holding the file lock so that they are written in order.
+	hashChain *audit.HashChain
+
 	saltMutex  sync.RWMutex
 	salt       *atomic.Value
 	saltConfig *salt.Config
@@ -203,19 +308,35 @@ func (b *Backend) LogRequest(ctx context.Context, in *logical.LogInput) error {
 }
 
 func (b *Backend) log(ctx context.Context, buf *bytes.Buffer, writer io.Writer) error {
-	reader := bytes.NewReader(buf.Bytes())
-
 	b.fileLock.Lock()
 
+	entry := buf.Bytes()
+	if b.hashChain != nil {
+		var err error
+		entry, err = b.hashChain.Link(ctx, entry)
+		if err != nil {
+			b.fileLock.Unlock()
+			return err
+		}
+	}
+	reader := bytes.NewReader(entry)
+
 	if writer == nil {
 		if err := b.open(); err != nil {
 			b.fileLock.Unlock()
 			return err
 		}
+		if b.shouldRotate(int64(len(entry))) {
+			if err := b.rotate(); err != nil {
+				b.fileLock.Unlock()
+				return err
+			}
+		}
 		writer = b.f
 	}
 
-	if _, err := reader.WriteTo(writer); err == nil {
+	if n, err := reader.WriteTo(writer); err == nil {
+		b.size += n
 		b.fileLock.Unlock()
 		return nil
 	} else if b.path == "stdout" {
@@ -235,7 +356,8 @@ func (b *Backend) log(ctx context.Context, buf *bytes.Buffer, writer io.Writer)
 	}
 
 	reader.Seek(0, io.SeekStart)
-	_, err := reader.WriteTo(writer)
+	n, err := reader.WriteTo(b.f)
+	b.size += n
 	b.fileLock.Unlock()
 	return err
 }
@@ -273,6 +395,25 @@ func (b *Backend) open() error {
 		return err
 	}
 
+	info, err := b.f.Stat()
+	if err != nil {
+		return err
+	}
+	b.size = info.Size()
+	b.openedAt = time.Now()
+
+	// Continue the hash chain of an existing file
+	if b.hashChain != nil && b.size > 0 {
+		last, err := lastLine(b.path)
+		if err != nil {
+			return err
+		}
+		if len(last) > 0 {
+			// Files with unchained entries start a new chain
+			b.hashChain.Resume(last)
+		}
+	}
+
 	// Change the file mode in case the log file already existed. We special
 	// case /dev/null since we can't chmod it and bypass if the mode is zero
 	switch b.path {
@@ -318,3 +459,203 @@ func (b *Backend) Invalidate(_ context.Context) {
 	defer b.saltMutex.Unlock()
 	b.salt.Store((*salt.Salt)(nil))
 }
+
+// rotateTimeFormat is the format of the timestamp added to the name of
+// rotated files, which sorts in the order the files were rotated
+const rotateTimeFormat = "20060102T150405.000000000Z"
+
+// shouldRotate returns whether the file must be rotated before writing n
+// bytes to it. The file lock must be held before calling this.
+func (b *Backend) shouldRotate(n int64) bool {
+	if b.size == 0 {
+		return false
+	}
+	if b.rotateBytes > 0 && b.size+n > b.rotateBytes {
+		return true
+	}
+	if b.rotateDuration > 0 && time.Since(b.openedAt) >= b.rotateDuration {
+		return true
+	}
+	return false
+}
+
+// rotate renames the file and opens a new one in its place. The file lock
+// must be held before calling this.
+func (b *Backend) rotate() error {
+	b.f.Close()
+	b.f = nil
+
+	rotatedPath := b.rotatedPath(time.Now())
+	renameErr := os.Rename(b.path, rotatedPath)
+
+	// Reopen the file even if it could not be renamed, so that writes can
+	// continue and rotation is tried again on the next write
+	if err := b.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		b.logger.Error("failed to rotate audit file", "error", renameErr)
+		return nil
+	}
+
+	b.rotateWG.Add(1)
+	go b.processRotated(rotatedPath)
+
+	return nil
+}
+
+// processRotated compresses the rotated file and prunes the oldest rotated
+// files. Only one rotated file is processed at a time, so a file that is
+// still being compressed when the next rotation happens is neither
+// compressed twice nor pruned halfway through.
+func (b *Backend) processRotated(rotatedPath string) {
+	defer b.rotateWG.Done()
+
+	b.rotateLock.Lock()
+	defer b.rotateLock.Unlock()
+
+	if b.rotateCompress {
+		if err := compressFile(rotatedPath, b.mode); err != nil {
+			b.logger.Error("failed to compress rotated audit file", "path", rotatedPath, "error", err)
+		}
+	}
+	if b.rotateMaxFiles > 0 {
+		if err := b.pruneRotated(); err != nil {
+			b.logger.Error("failed to prune rotated audit files", "error", err)
+		}
+	}
+}
+
+// rotatedPath returns the path to rename the file to when it is rotated at
+// the given time
+func (b *Backend) rotatedPath(t time.Time) string {
+	dir, base := filepath.Split(b.path)
+	ext := filepath.Ext(base)
+	return filepath.Join(dir, strings.TrimSuffix(base, ext)+"-"+t.UTC().Format(rotateTimeFormat)+ext)
+}
+
+// rotatedFiles returns the paths of the rotated files, oldest first
+func (b *Backend) rotatedFiles() ([]string, error) {
+	dir, base := filepath.Split(b.path)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+
+	files, err := ioutil.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	var rotated []string
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz")
+		if !strings.HasSuffix(stamp, ext) {
+			continue
+		}
+		if _, err := time.Parse(rotateTimeFormat, strings.TrimSuffix(stamp, ext)); err != nil {
+			continue
+		}
+
+		rotated = append(rotated, filepath.Join(dir, name))
+	}
+
+	sort.Strings(rotated)
+	return rotated, nil
+}
+
+// pruneRotated removes the oldest rotated files beyond the number to keep
+func (b *Backend) pruneRotated() error {
+	rotated, err := b.rotatedFiles()
+	if err != nil {
+		return err
+	}
+
+	var retErr *multierror.Error
+	for len(rotated) > b.rotateMaxFiles {
+		if err := os.Remove(rotated[0]); err != nil {
+			retErr = multierror.Append(retErr, err)
+		}
+		rotated = rotated[1:]
+	}
+	return retErr.ErrorOrNil()
+}
+
+// compressFile replaces the file with a gzip compressed copy
+func compressFile(path string, mode os.FileMode) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmpPath := path + ".gz.tmp"
+	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if closeErr := gz.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path+".gz")
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// lastLine returns the last complete line of the file, reading it backwards
+// so that large files are not read in full
+func lastLine(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	const chunkSize = 64 * 1024
+	var line []byte
+	end := info.Size()
+	for offset := end; offset > 0; {
+		n := int64(chunkSize)
+		if offset < n {
+			n = offset
+		}
+		offset -= n
+
+		chunk := make([]byte, n)
+		if _, err := f.ReadAt(chunk, offset); err != nil {
+			return nil, err
+		}
+		line = append(chunk, line...)
+
+		// Skip the newline terminating the last line
+		trimmed := bytes.TrimRight(line, "\n")
+		if idx := bytes.LastIndexByte(trimmed, '\n'); idx != -1 {
+			return trimmed[idx+1:], nil
+		}
+		if offset == 0 {
+			return trimmed, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -1,14 +1,20 @@
 package file
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	log "github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/audit"
 	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/sdk/helper/salt"
@@ -141,3 +147,177 @@ func BenchmarkAuditFile_request(b *testing.B) {
 		}
 	})
 }
+
+func testAuditFileRotation(t *testing.T, config map[string]string, entries int) (*Backend, string) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "vault-test_audit_file-rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config["path"] = filepath.Join(dir, "audit.log")
+	be, err := Factory(context.Background(), &audit.BackendConfig{
+		SaltConfig: &salt.Config{},
+		SaltView:   &logical.InmemStorage{},
+		Config:     config,
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	b := be.(*Backend)
+
+	ctx := namespace.RootContext(nil)
+	for i := 0; i < entries; i++ {
+		if err := b.LogRequest(ctx, &logical.LogInput{
+			Request: &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      fmt.Sprintf("secret/%d", i),
+			},
+		}); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+	b.rotateWG.Wait()
+
+	return b, dir
+}
+
+// testAuditFileLines returns the number of lines in the file, decompressing
+// it if needed
+func testAuditFileLines(t *testing.T, path string) int {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gz
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(data, []byte("\n"))
+}
+
+func TestAuditFile_rotateBytes(t *testing.T) {
+	b, dir := testAuditFileRotation(t, map[string]string{
+		"rotate_bytes": "1000",
+	}, 20)
+	defer os.RemoveAll(dir)
+
+	rotated, err := b.rotatedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) == 0 {
+		t.Fatal("expected the file to be rotated")
+	}
+
+	// Every entry is kept, and no file exceeds the maximum size
+	total := testAuditFileLines(t, b.path)
+	for _, path := range append(rotated, b.path) {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 1000 {
+			t.Fatalf("%s: expected at most 1000 bytes, got %d", path, info.Size())
+		}
+	}
+	for _, path := range rotated {
+		total += testAuditFileLines(t, path)
+	}
+	if total != 20 {
+		t.Fatalf("expected 20 entries, got %d", total)
+	}
+}
+
+func TestAuditFile_rotateMaxFilesCompress(t *testing.T) {
+	b, dir := testAuditFileRotation(t, map[string]string{
+		"rotate_bytes":     "1000",
+		"rotate_max_files": "2",
+		"rotate_compress":  "true",
+	}, 40)
+	defer os.RemoveAll(dir)
+
+	rotated, err := b.rotatedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 2 {
+		t.Fatalf("expected 2 rotated files, got %v", rotated)
+	}
+	for _, path := range rotated {
+		if !strings.HasSuffix(path, ".gz") {
+			t.Fatalf("expected %s to be compressed", path)
+		}
+		if testAuditFileLines(t, path) == 0 {
+			t.Fatalf("expected %s to contain entries", path)
+		}
+	}
+}
+
+func TestAuditFile_rotateErrorsLogged(t *testing.T) {
+	b, dir := testAuditFileRotation(t, map[string]string{
+		"rotate_bytes":     "1000",
+		"rotate_max_files": "2",
+		"rotate_compress":  "true",
+	}, 1)
+	defer os.RemoveAll(dir)
+
+	logOut := new(bytes.Buffer)
+	b.logger = log.New(&log.LoggerOptions{
+		Output: logOut,
+	})
+
+	// A rotated file that can not be compressed is reported
+	b.rotateWG.Add(1)
+	b.processRotated(b.rotatedPath(time.Now()))
+
+	if expected := "failed to compress rotated audit file"; !strings.Contains(logOut.String(), expected) {
+		t.Fatalf("expected %q to contain %q", logOut.String(), expected)
+	}
+}
+
+func TestAuditFile_rotateDuration(t *testing.T) {
+	b, dir := testAuditFileRotation(t, map[string]string{
+		"rotate_duration": "50ms",
+	}, 1)
+	defer os.RemoveAll(dir)
+
+	time.Sleep(100 * time.Millisecond)
+
+	if err := b.LogRequest(namespace.RootContext(nil), &logical.LogInput{
+		Request: &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "secret/foo",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	b.rotateWG.Wait()
+
+	rotated, err := b.rotatedFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 1 {
+		t.Fatalf("expected 1 rotated file, got %v", rotated)
+	}
+	if lines := testAuditFileLines(t, b.path); lines != 1 {
+		t.Fatalf("expected 1 entry in the new file, got %d", lines)
+	}
+}
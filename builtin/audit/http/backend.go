@@ -0,0 +1,474 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	nethttp "net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
+	log "github.com/hashicorp/go-hclog"
+	rootcerts "github.com/hashicorp/go-rootcerts"
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/sdk/helper/parseutil"
+	"github.com/hashicorp/vault/sdk/helper/salt"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	defaultBatchSize     = 100
+	defaultBatchInterval = time.Second
+	defaultTimeout       = 5 * time.Second
+	defaultMinBackoff    = time.Second
+	defaultMaxBackoff    = time.Minute
+	defaultSpoolMaxSize  = 100 * 1024 * 1024
+)
+
+func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, error) {
+	if conf.SaltConfig == nil {
+		return nil, fmt.Errorf("nil salt config")
+	}
+	if conf.SaltView == nil {
+		return nil, fmt.Errorf("nil salt view")
+	}
+
+	url, ok := conf.Config["url"]
+	if !ok {
+		return nil, fmt.Errorf("url is required")
+	}
+
+	spoolPath, ok := conf.Config["spool_path"]
+	if !ok {
+		return nil, fmt.Errorf("spool_path is required")
+	}
+
+	format, ok := conf.Config["format"]
+	if !ok {
+		format = "json"
+	}
+	if format != "json" {
+		return nil, fmt.Errorf("unknown format type %q", format)
+	}
+
+	batchSize := defaultBatchSize
+	if raw, ok := conf.Config["batch_size"]; ok {
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, errwrap.Wrapf("invalid batch_size: {{err}}", err)
+		}
+		if value < 1 {
+			return nil, fmt.Errorf("batch_size must be at least 1")
+		}
+		batchSize = value
+	}
+
+	batchInterval, err := durationOption(conf.Config, "batch_interval", defaultBatchInterval)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := durationOption(conf.Config, "timeout", defaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	minBackoff, err := durationOption(conf.Config, "retry_min_backoff", defaultMinBackoff)
+	if err != nil {
+		return nil, err
+	}
+	maxBackoff, err := durationOption(conf.Config, "retry_max_backoff", defaultMaxBackoff)
+	if err != nil {
+		return nil, err
+	}
+	if maxBackoff < minBackoff {
+		return nil, fmt.Errorf("retry_max_backoff must not be less than retry_min_backoff")
+	}
+
+	spoolMaxSize := int64(defaultSpoolMaxSize)
+	if raw, ok := conf.Config["spool_max_size"]; ok {
+		value, err := parseutil.ParseInt(raw)
+		if err != nil {
+			return nil, errwrap.Wrapf("invalid spool_max_size: {{err}}", err)
+		}
+		if value < 1 {
+			return nil, fmt.Errorf("spool_max_size must be at least 1")
+		}
+		spoolMaxSize = value
+	}
+
+	tlsConfig, err := tlsConfig(conf.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if hashing of accessor is disabled
+	hmacAccessor := true
+	if hmacAccessorRaw, ok := conf.Config["hmac_accessor"]; ok {
+		value, err := strconv.ParseBool(hmacAccessorRaw)
+		if err != nil {
+			return nil, err
+		}
+		hmacAccessor = value
+	}
+
+	// Check if raw logging is enabled
+	logRaw := false
+	if raw, ok := conf.Config["log_raw"]; ok {
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, err
+		}
+		logRaw = b
+	}
+
+	hashChain, err := audit.HashChainEnabled(conf.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	spool, err := newSpool(spoolPath, spoolMaxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := conf.Logger
+	if logger == nil {
+		logger = log.NewNullLogger()
+	}
+
+	transport := cleanhttp.DefaultPooledTransport()
+	transport.TLSClientConfig = tlsConfig
+
+	b := &Backend{
+		saltConfig: conf.SaltConfig,
+		saltView:   conf.SaltView,
+		formatConfig: audit.FormatterConfig{
+			Raw:          logRaw,
+			HMACAccessor: hmacAccessor,
+		},
+
+		url: url,
+		client: &nethttp.Client{
+			Transport: transport,
+			Timeout:   timeout,
+		},
+		batchSize:     batchSize,
+		batchInterval: batchInterval,
+		minBackoff:    minBackoff,
+		maxBackoff:    maxBackoff,
+		spool:         spool,
+		logger:        logger,
+		doneCh:        make(chan struct{}),
+	}
+
+	b.formatter.AuditFormatWriter = &audit.JSONFormatWriter{
+		SaltFunc: b.Salt,
+	}
+
+	if hashChain {
+		b.hashChain = audit.NewHashChain(b.GetHash)
+	}
+
+	var runCtx context.Context
+	runCtx, b.cancelFunc = context.WithCancel(context.Background())
+	go b.run(runCtx)
+
+	return b, nil
+}
+
+// durationOption parses the duration option with the given name, returning
+// the default if it is not set
+func durationOption(config map[string]string, name string, def time.Duration) (time.Duration, error) {
+	raw, ok := config[name]
+	if !ok {
+		return def, nil
+	}
+
+	value, err := parseutil.ParseDurationSecond(raw)
+	if err != nil {
+		return 0, errwrap.Wrapf(fmt.Sprintf("invalid %s: {{err}}", name), err)
+	}
+	if value <= 0 {
+		return 0, fmt.Errorf("%s must be positive", name)
+	}
+	return value, nil
+}
+
+// tlsConfig builds the TLS configuration used to connect to the endpoint
+func tlsConfig(config map[string]string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: config["tls_server_name"],
+	}
+
+	if config["tls_ca_cert"] != "" {
+		if err := rootcerts.ConfigureTLS(tlsConfig, &rootcerts.Config{
+			CAFile: config["tls_ca_cert"],
+		}); err != nil {
+			return nil, errwrap.Wrapf("failed to load tls_ca_cert: {{err}}", err)
+		}
+	}
+
+	certFile, keyFile := config["tls_client_cert"], config["tls_client_key"]
+	switch {
+	case certFile != "" && keyFile != "":
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to load client certificate: {{err}}", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	case certFile != "" || keyFile != "":
+		return nil, fmt.Errorf("tls_client_cert and tls_client_key must be set together")
+	}
+
+	if raw, ok := config["tls_skip_verify"]; ok {
+		skipVerify, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errwrap.Wrapf("invalid tls_skip_verify: {{err}}", err)
+		}
+		tlsConfig.InsecureSkipVerify = skipVerify
+	}
+
+	return tlsConfig, nil
+}
+
+// Backend is the audit backend for the http audit transport. Entries are
+// written to an on-disk spool and sent to the endpoint in batches by a
+// background goroutine, so requests only fail when the spool cannot accept
+// them.
+type Backend struct {
+	formatter    audit.AuditFormatter
+	formatConfig audit.FormatterConfig
+
+	url           string
+	client        *nethttp.Client
+	batchSize     int
+	batchInterval time.Duration
+	minBackoff    time.Duration
+	maxBackoff    time.Duration
+
+	spool  *spool
+	logger log.Logger
+
+	// chainLock orders spooling when entries are hash chained
+	chainLock sync.Mutex
+	hashChain *audit.HashChain
+
+	cancelFunc context.CancelFunc
+	doneCh     chan struct{}
+	closeOnce  sync.Once
+
+	saltMutex  sync.RWMutex
+	salt       *salt.Salt
+	saltConfig *salt.Config
+	saltView   logical.Storage
+}
+
+var _ audit.Backend = (*Backend)(nil)
+var _ audit.Closer = (*Backend)(nil)
+
+func (b *Backend) GetHash(ctx context.Context, data string) (string, error) {
+	salt, err := b.Salt(ctx)
+	if err != nil {
+		return "", err
+	}
+	return audit.HashString(salt, data), nil
+}
+
+func (b *Backend) LogRequest(ctx context.Context, in *logical.LogInput) error {
+	var buf bytes.Buffer
+	if err := b.formatter.FormatRequest(ctx, &buf, b.formatConfig, in); err != nil {
+		return err
+	}
+
+	return b.log(ctx, buf.Bytes())
+}
+
+func (b *Backend) LogResponse(ctx context.Context, in *logical.LogInput) error {
+	var buf bytes.Buffer
+	if err := b.formatter.FormatResponse(ctx, &buf, b.formatConfig, in); err != nil {
+		return err
+	}
+
+	return b.log(ctx, buf.Bytes())
+}
+
+// log spools the entry, sealing the batch once it is full
+func (b *Backend) log(ctx context.Context, entry []byte) error {
+	if b.hashChain != nil {
+		b.chainLock.Lock()
+		defer b.chainLock.Unlock()
+
+		var err error
+		entry, err = b.hashChain.Link(ctx, entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	entries, err := b.spool.append(entry)
+	if err != nil {
+		return err
+	}
+
+	if entries >= b.batchSize {
+		return b.spool.seal()
+	}
+	return nil
+}
+
+// run sends sealed batches until the backend is closed, sealing the pending
+// batch every batch interval
+func (b *Backend) run(ctx context.Context) {
+	defer close(b.doneCh)
+
+	ticker := time.NewTicker(b.batchInterval)
+	defer ticker.Stop()
+
+	for {
+		for seg := b.spool.next(); seg != nil; seg = b.spool.next() {
+			if !b.deliver(ctx, seg) {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := b.spool.seal(); err != nil {
+				b.logger.Error("failed to seal audit batch", "error", err)
+			}
+		case <-b.spool.sealedCh:
+		}
+	}
+}
+
+// deliver sends the segment, retrying with exponential backoff until it
+// succeeds, and removes it from the spool. It returns false if the backend
+// was closed before the segment could be delivered.
+func (b *Backend) deliver(ctx context.Context, seg *segment) bool {
+	backoff := b.minBackoff
+	for {
+		err := b.send(ctx, seg)
+		if err == nil {
+			if err := b.spool.remove(seg); err != nil {
+				b.logger.Error("failed to remove delivered audit batch", "error", err)
+			}
+			return true
+		}
+
+		b.logger.Error("failed to send audit batch", "url", b.url, "error", err, "retry_in", backoff)
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > b.maxBackoff {
+			backoff = b.maxBackoff
+		}
+	}
+}
+
+// send posts the entries of the segment to the endpoint as a JSON array
+func (b *Backend) send(ctx context.Context, seg *segment) error {
+	data, err := ioutil.ReadFile(seg.path)
+	if err != nil {
+		return errwrap.Wrapf("failed to read spool segment: {{err}}", err)
+	}
+
+	var body bytes.Buffer
+	body.WriteByte('[')
+	var count int
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		// Skip entries truncated by a crash rather than rejecting the batch
+		if !json.Valid(line) {
+			b.logger.Error("dropping malformed audit entry from spool", "segment", seg.path)
+			continue
+		}
+		if count > 0 {
+			body.WriteByte(',')
+		}
+		body.Write(line)
+		count++
+	}
+	body.WriteByte(']')
+
+	if count == 0 {
+		return nil
+	}
+
+	req, err := nethttp.NewRequest("POST", b.url, &body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Close stops sending batches. Entries that have not been delivered remain
+// in the spool and are sent when the backend is next created.
+func (b *Backend) Close() error {
+	var err error
+	b.closeOnce.Do(func() {
+		b.cancelFunc()
+		<-b.doneCh
+		err = b.spool.close()
+	})
+	return err
+}
+
+func (b *Backend) Reload(_ context.Context) error {
+	return nil
+}
+
+func (b *Backend) Salt(ctx context.Context) (*salt.Salt, error) {
+	b.saltMutex.RLock()
+	if b.salt != nil {
+		defer b.saltMutex.RUnlock()
+		return b.salt, nil
+	}
+	b.saltMutex.RUnlock()
+	b.saltMutex.Lock()
+	defer b.saltMutex.Unlock()
+	if b.salt != nil {
+		return b.salt, nil
+	}
+	salt, err := salt.NewSalt(ctx, b.saltView, b.saltConfig)
+	if err != nil {
+		return nil, err
+	}
+	b.salt = salt
+	return salt, nil
+}
+
+func (b *Backend) Invalidate(_ context.Context) {
+	b.saltMutex.Lock()
+	defer b.saltMutex.Unlock()
+	b.salt = nil
+}
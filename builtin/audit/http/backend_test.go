@@ -0,0 +1,332 @@
+package http
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	nethttp "net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/helper/salt"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// testReceiver records the batches posted to it, failing the first
+// failures requests
+type testReceiver struct {
+	sync.Mutex
+	failures int
+	attempts int
+	batches  [][]map[string]interface{}
+}
+
+func (r *testReceiver) ServeHTTP(w nethttp.ResponseWriter, req *nethttp.Request) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.attempts++
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(nethttp.StatusServiceUnavailable)
+		return
+	}
+
+	var batch []map[string]interface{}
+	if err := json.NewDecoder(req.Body).Decode(&batch); err != nil {
+		w.WriteHeader(nethttp.StatusBadRequest)
+		return
+	}
+	r.batches = append(r.batches, batch)
+}
+
+func (r *testReceiver) waitForBatches(t *testing.T, n int) [][]map[string]interface{} {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		r.Lock()
+		if len(r.batches) >= n {
+			batches := r.batches
+			r.Unlock()
+			return batches
+		}
+		r.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d batches", n)
+	return nil
+}
+
+func testBackend(t *testing.T, config map[string]string) *Backend {
+	t.Helper()
+
+	b, err := Factory(context.Background(), &audit.BackendConfig{
+		SaltConfig: &salt.Config{},
+		SaltView:   &logical.InmemStorage{},
+		Config:     config,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.(*Backend)
+}
+
+func testLogRequest(t *testing.T, b *Backend, path string) error {
+	t.Helper()
+
+	return b.LogRequest(namespace.RootContext(nil), &logical.LogInput{
+		Request: &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      path,
+		},
+	})
+}
+
+func TestAuditHTTP_Batches(t *testing.T) {
+	receiver := &testReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	spoolPath, err := ioutil.TempDir("", "vault-test_audit_http-batches")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(spoolPath)
+
+	config := map[string]string{
+		"url":            server.URL,
+		"spool_path":     spoolPath,
+		"batch_size":     "2",
+		"batch_interval": "1h",
+	}
+	b := testBackend(t, config)
+
+	for _, path := range []string{"secret/a", "secret/b", "secret/c"} {
+		if err := testLogRequest(t, b, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	batches := receiver.waitForBatches(t, 1)
+	if len(batches[0]) != 2 {
+		t.Fatalf("expected a batch of 2 entries, got %d", len(batches[0]))
+	}
+	request := batches[0][1]["request"].(map[string]interface{})
+	if request["path"] != "secret/b" {
+		t.Fatalf("bad entry: %#v", batches[0][1])
+	}
+
+	// The partial batch is kept in the spool and sent once the backend is
+	// recreated
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	config["batch_interval"] = "10ms"
+	b = testBackend(t, config)
+	defer b.Close()
+
+	batches = receiver.waitForBatches(t, 2)
+	if len(batches[1]) != 1 {
+		t.Fatalf("expected a batch of 1 entry, got %d", len(batches[1]))
+	}
+	request = batches[1][0]["request"].(map[string]interface{})
+	if request["path"] != "secret/c" {
+		t.Fatalf("bad entry: %#v", batches[1][0])
+	}
+
+	// Delivered batches are removed from the spool
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		files, err := ioutil.ReadDir(spoolPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected an empty spool, found %d segments", len(files))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAuditHTTP_Retry(t *testing.T) {
+	receiver := &testReceiver{
+		failures: 2,
+	}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	spoolPath, err := ioutil.TempDir("", "vault-test_audit_http-retry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(spoolPath)
+
+	b := testBackend(t, map[string]string{
+		"url":               server.URL,
+		"spool_path":        spoolPath,
+		"batch_size":        "1",
+		"retry_min_backoff": "10ms",
+		"retry_max_backoff": "20ms",
+	})
+	defer b.Close()
+
+	if err := testLogRequest(t, b, "secret/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	receiver.waitForBatches(t, 1)
+
+	receiver.Lock()
+	defer receiver.Unlock()
+	if receiver.attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", receiver.attempts)
+	}
+}
+
+func TestAuditHTTP_SpoolFull(t *testing.T) {
+	receiver := &testReceiver{
+		failures: 1000,
+	}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	spoolPath, err := ioutil.TempDir("", "vault-test_audit_http-spool_full")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(spoolPath)
+
+	b := testBackend(t, map[string]string{
+		"url":            server.URL,
+		"spool_path":     spoolPath,
+		"spool_max_size": "1024",
+	})
+	defer b.Close()
+
+	// Once the spool is full the backend fails, so that requests are blocked
+	// if no other audit device succeeds
+	for i := 0; ; i++ {
+		err := testLogRequest(t, b, "secret/a")
+		if err == errSpoolFull {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i > 100 {
+			t.Fatal("expected the spool to fill up")
+		}
+	}
+}
+
+func TestAuditHTTP_ClientCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-test_audit_http-client_cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Generate a self-signed client certificate and trust it on the server
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "vault-audit"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	receiver := &testReceiver{}
+	server := httptest.NewUnstartedServer(receiver)
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	if err := ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	b := testBackend(t, map[string]string{
+		"url":             server.URL,
+		"spool_path":      filepath.Join(dir, "spool"),
+		"batch_size":      "1",
+		"tls_ca_cert":     caFile,
+		"tls_client_cert": certFile,
+		"tls_client_key":  keyFile,
+	})
+	defer b.Close()
+
+	if err := testLogRequest(t, b, "secret/a"); err != nil {
+		t.Fatal(err)
+	}
+
+	receiver.waitForBatches(t, 1)
+
+	// A client certificate is required in pairs with its key
+	_, err = Factory(context.Background(), &audit.BackendConfig{
+		SaltConfig: &salt.Config{},
+		SaltView:   &logical.InmemStorage{},
+		Config: map[string]string{
+			"url":             server.URL,
+			"spool_path":      filepath.Join(dir, "spool"),
+			"tls_client_cert": certFile,
+		},
+	})
+	if err == nil {
+		t.Fatal("expected an error with a client certificate but no key")
+	}
+}
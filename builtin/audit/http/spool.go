@@ -0,0 +1,207 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/errwrap"
+)
+
+const segmentExt = ".batch"
+
+var errSpoolFull = errors.New("audit spool is full")
+
+// segment is a file of newline delimited audit entries that is sent as a
+// single batch
+type segment struct {
+	seq     uint64
+	path    string
+	size    int64
+	entries int
+}
+
+// spool is a bounded, on-disk queue of audit entries. Entries are appended
+// to the open tail segment, which is sealed once it holds a full batch or
+// the batch interval elapses. Sealed segments are sent oldest first and
+// removed once they have been delivered.
+type spool struct {
+	l sync.Mutex
+
+	dir     string
+	maxSize int64
+	size    int64
+	nextSeq uint64
+
+	sealed   []*segment
+	tail     *segment
+	tailFile *os.File
+
+	// sealedCh is signaled whenever a segment is sealed
+	sealedCh chan struct{}
+}
+
+// newSpool opens the spool in the given directory, creating it if needed.
+// Segments left over from a previous run are sealed so that they are sent
+// before any new entries.
+func newSpool(dir string, maxSize int64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errwrap.Wrapf("failed to create spool directory: {{err}}", err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to read spool directory: {{err}}", err)
+	}
+
+	s := &spool{
+		dir:      dir,
+		maxSize:  maxSize,
+		nextSeq:  1,
+		sealedCh: make(chan struct{}, 1),
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		seg := &segment{
+			seq:  seq,
+			path: filepath.Join(dir, name),
+			size: file.Size(),
+		}
+		if seg.size == 0 {
+			os.Remove(seg.path)
+			continue
+		}
+
+		s.sealed = append(s.sealed, seg)
+		s.size += seg.size
+		if seq >= s.nextSeq {
+			s.nextSeq = seq + 1
+		}
+	}
+
+	sort.Slice(s.sealed, func(i, j int) bool {
+		return s.sealed[i].seq < s.sealed[j].seq
+	})
+
+	return s, nil
+}
+
+// append adds the entry to the tail segment, returning the number of entries
+// in the tail segment. Entries must be a single line ending in a newline.
+func (s *spool) append(entry []byte) (int, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.size+int64(len(entry)) > s.maxSize {
+		return 0, errSpoolFull
+	}
+
+	if s.tailFile == nil {
+		seg := &segment{
+			seq: s.nextSeq,
+		}
+		seg.path = filepath.Join(s.dir, fmt.Sprintf("%020d%s", seg.seq, segmentExt))
+
+		f, err := os.OpenFile(seg.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return 0, errwrap.Wrapf("failed to create spool segment: {{err}}", err)
+		}
+
+		s.nextSeq++
+		s.tail = seg
+		s.tailFile = f
+	}
+
+	if _, err := s.tailFile.Write(entry); err != nil {
+		// Drop any partial write so that the segment stays well formed
+		s.tailFile.Truncate(s.tail.size)
+		return 0, errwrap.Wrapf("failed to write to spool segment: {{err}}", err)
+	}
+
+	s.tail.size += int64(len(entry))
+	s.tail.entries++
+	s.size += int64(len(entry))
+
+	return s.tail.entries, nil
+}
+
+// seal closes the tail segment, if it has any entries, queueing it to be
+// sent
+func (s *spool) seal() error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	return s.sealLocked()
+}
+
+func (s *spool) sealLocked() error {
+	if s.tailFile == nil {
+		return nil
+	}
+
+	err := s.tailFile.Close()
+	s.sealed = append(s.sealed, s.tail)
+	s.tail = nil
+	s.tailFile = nil
+
+	select {
+	case s.sealedCh <- struct{}{}:
+	default:
+	}
+
+	return err
+}
+
+// next returns the oldest sealed segment, or nil if there are none
+func (s *spool) next() *segment {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if len(s.sealed) == 0 {
+		return nil
+	}
+	return s.sealed[0]
+}
+
+// remove deletes a segment returned by next once it has been delivered
+func (s *spool) remove(seg *segment) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if len(s.sealed) == 0 || s.sealed[0] != seg {
+		return fmt.Errorf("segment %d is not the oldest sealed segment", seg.seq)
+	}
+
+	if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+		return errwrap.Wrapf("failed to remove spool segment: {{err}}", err)
+	}
+
+	s.sealed = s.sealed[1:]
+	s.size -= seg.size
+
+	return nil
+}
+
+// close seals the tail segment so that it is sent when the spool is next
+// opened
+func (s *spool) close() error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	return s.sealLocked()
+}
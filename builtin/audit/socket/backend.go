@@ -73,6 +73,11 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		logRaw = b
 	}
 
+	hashChain, err := audit.HashChainEnabled(conf.Config)
+	if err != nil {
+		return nil, err
+	}
+
 	b := &Backend{
 		saltConfig: conf.SaltConfig,
 		saltView:   conf.SaltView,
@@ -99,6 +104,10 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		}
 	}
 
+	if hashChain {
+		b.hashChain = audit.NewHashChain(b.GetHash)
+	}
+
 	return b, nil
 }
 
@@ -113,6 +122,8 @@ type Backend struct {
 	address       string
 	socketType    string
 
+	hashChain *audit.HashChain
+
 	sync.Mutex
 
 	saltMutex  sync.RWMutex
@@ -137,21 +148,7 @@ func (b *Backend) LogRequest(ctx context.Context, in *logical.LogInput) error {
 		return err
 	}
 
-	b.Lock()
-	defer b.Unlock()
-
-	err := b.write(ctx, buf.Bytes())
-	if err != nil {
-		rErr := b.reconnect(ctx)
-		if rErr != nil {
-			err = multierror.Append(err, rErr)
-		} else {
-			// Try once more after reconnecting
-			err = b.write(ctx, buf.Bytes())
-		}
-	}
-
-	return err
+	return b.log(ctx, buf.Bytes())
 }
 
 func (b *Backend) LogResponse(ctx context.Context, in *logical.LogInput) error {
@@ -160,17 +157,29 @@ func (b *Backend) LogResponse(ctx context.Context, in *logical.LogInput) error {
 		return err
 	}
 
+	return b.log(ctx, buf.Bytes())
+}
+
+func (b *Backend) log(ctx context.Context, entry []byte) error {
 	b.Lock()
 	defer b.Unlock()
 
-	err := b.write(ctx, buf.Bytes())
+	if b.hashChain != nil {
+		var err error
+		entry, err = b.hashChain.Link(ctx, entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := b.write(ctx, entry)
 	if err != nil {
 		rErr := b.reconnect(ctx)
 		if rErr != nil {
 			err = multierror.Append(err, rErr)
 		} else {
 			// Try once more after reconnecting
-			err = b.write(ctx, buf.Bytes())
+			err = b.write(ctx, entry)
 		}
 	}
 
@@ -63,6 +63,11 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		logRaw = b
 	}
 
+	hashChain, err := audit.HashChainEnabled(conf.Config)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the logger
 	logger, err := gsyslog.NewLogger(gsyslog.LOG_INFO, facility, tag)
 	if err != nil {
@@ -92,6 +97,10 @@ func Factory(ctx context.Context, conf *audit.BackendConfig) (audit.Backend, err
 		}
 	}
 
+	if hashChain {
+		b.hashChain = audit.NewHashChain(b.GetHash)
+	}
+
 	return b, nil
 }
 
@@ -102,6 +111,10 @@ type Backend struct {
 	formatter    audit.AuditFormatter
 	formatConfig audit.FormatterConfig
 
+	// writeLock orders writes when entries are hash chained
+	writeLock sync.Mutex
+	hashChain *audit.HashChain
+
 	saltMutex  sync.RWMutex
 	salt       *salt.Salt
 	saltConfig *salt.Config
@@ -124,9 +137,7 @@ func (b *Backend) LogRequest(ctx context.Context, in *logical.LogInput) error {
 		return err
 	}
 
-	// Write out to syslog
-	_, err := b.logger.Write(buf.Bytes())
-	return err
+	return b.write(ctx, buf.Bytes())
 }
 
 func (b *Backend) LogResponse(ctx context.Context, in *logical.LogInput) error {
@@ -135,8 +146,23 @@ func (b *Backend) LogResponse(ctx context.Context, in *logical.LogInput) error {
 		return err
 	}
 
+	return b.write(ctx, buf.Bytes())
+}
+
+func (b *Backend) write(ctx context.Context, entry []byte) error {
+	if b.hashChain != nil {
+		b.writeLock.Lock()
+		defer b.writeLock.Unlock()
+
+		var err error
+		entry, err = b.hashChain.Link(ctx, entry)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Write out to syslog
-	_, err := b.logger.Write(buf.Bytes())
+	_, err := b.logger.Write(entry)
 	return err
 }
 
@@ -4,9 +4,11 @@ import (
 	"context"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
+	cache "github.com/patrickmn/go-cache"
 )
 
 func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
@@ -33,12 +35,15 @@ func Backend() *backend {
 			pathCerts(&b),
 			pathCRLs(&b),
 		},
-		AuthRenew:   b.pathLoginRenew,
-		Invalidate:  b.invalidate,
-		BackendType: logical.TypeCredential,
+		AuthRenew:    b.pathLoginRenew,
+		Invalidate:   b.invalidate,
+		PeriodicFunc: b.periodicFunc,
+		BackendType:  logical.TypeCredential,
 	}
 
 	b.crlUpdateMutex = &sync.RWMutex{}
+	b.cdpCRLs = make(map[string]*cdpCRL)
+	b.ocspCache = cache.New(0, time.Minute)
 
 	return &b
 }
@@ -49,6 +54,29 @@ type backend struct {
 
 	crls           map[string]CRLInfo
 	crlUpdateMutex *sync.RWMutex
+
+	// cdpCRLs holds the CRLs fetched from the distribution points of client
+	// certificate chains, keyed by URL
+	cdpCRLs     map[string]*cdpCRL
+	cdpCRLMutex sync.Mutex
+
+	// ocspCache holds the OCSP status of client certificates until their
+	// responses are due to be updated
+	ocspCache *cache.Cache
+}
+
+func (b *backend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	config, err := b.Config(ctx, req.Storage)
+	if err != nil {
+		return err
+	}
+
+	if err := b.refreshURLCRLs(ctx, req.Storage, config.CRLRefreshInterval); err != nil {
+		return err
+	}
+	b.refreshCDPCRLs(ctx, config.CRLRefreshInterval)
+
+	return nil
 }
 
 func (b *backend) invalidate(_ context.Context, key string) {
@@ -69,4 +97,8 @@ Trusted certificates are configured using the "certs/" endpoint
 by a user with root access. A certificate authority can be trusted,
 which permits all keys signed by it. Alternatively, self-signed
 certificates can be trusted avoiding the need for a CA.
+
+Client certificates are checked against the CRLs configured using the
+"crls/" endpoint, which may be fetched from a URL, and optionally against
+the CRLs of their distribution points and their OCSP responders.
 `
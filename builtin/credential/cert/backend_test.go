@@ -8,8 +8,10 @@ import (
 	"encoding/pem"
 	mathrand "math/rand"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"path/filepath"
+	"sync"
 
 	"github.com/go-test/deep"
 	"github.com/hashicorp/go-sockaddr"
@@ -44,6 +46,7 @@ import (
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/hashicorp/vault/vault"
 	"github.com/mitchellh/mapstructure"
+	"golang.org/x/crypto/ocsp"
 )
 
 const (
@@ -2008,3 +2011,372 @@ func TestBackend_CertUpgrade(t *testing.T) {
 		t.Fatal(diff)
 	}
 }
+
+// testRevocationSetup generates a CA and a client certificate issued by it
+// for a template modified by setup, which is given the URL of the server
+// handling requests with handler, and registers the CA as certs/web. It
+// returns the backend, the connection state, the CA certificate and key, and
+// a function cleaning up the server and generated files.
+func testRevocationSetup(t *testing.T, handler http.Handler, setup func(template *x509.Certificate, serverURL string)) (*backend, logical.Storage, tls.ConnectionState, *x509.Certificate, *ecdsa.PrivateKey, func()) {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName: "example.com",
+		},
+		DNSNames:    []string{"example.com"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth,
+		},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageKeyAgreement,
+		SerialNumber: big.NewInt(mathrand.Int63()),
+		NotBefore:    time.Now().Add(-30 * time.Second),
+		NotAfter:     time.Now().Add(262980 * time.Hour),
+	}
+	setup(template, server.URL)
+
+	tempDir, connState, err := generateTestCertAndConnState(t, template)
+	cleanup := func() {
+		server.Close()
+		os.RemoveAll(tempDir)
+	}
+	var ok bool
+	defer func() {
+		if !ok {
+			cleanup()
+		}
+	}()
+	if err != nil {
+		t.Fatalf("error testing connection state: %v", err)
+	}
+
+	caPEM, err := ioutil.ReadFile(filepath.Join(tempDir, "ca_cert.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	caKeyPEM, err := ioutil.ReadFile(filepath.Join(tempDir, "ca_key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(caKeyPEM)
+	caKey, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := &logical.InmemStorage{}
+	config := logical.TestBackendConfig()
+	config.StorageView = storage
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "certs/web",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"certificate": string(caPEM),
+			"policies":    "foo",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	ok = true
+	return b.(*backend), storage, connState, parsePEM(caPEM)[0], caKey, cleanup
+}
+
+func testRevocationLogin(t *testing.T, b logical.Backend, storage logical.Storage, connState tls.ConnectionState, expectSuccess bool) {
+	t.Helper()
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "login",
+		Storage:   storage,
+		Connection: &logical.Connection{
+			ConnState: &connState,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch {
+	case expectSuccess && (resp == nil || resp.IsError() || resp.Auth == nil):
+		t.Fatalf("expected login to succeed, got: %#v", resp)
+	case !expectSuccess && (resp == nil || !resp.IsError()):
+		t.Fatalf("expected login to fail, got: %#v", resp)
+	}
+}
+
+func testUpdateEntry(t *testing.T, b logical.Backend, storage logical.Storage, path string, data map[string]interface{}) *logical.Response {
+	t.Helper()
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      path,
+		Storage:   storage,
+		Data:      data,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	return resp
+}
+
+func TestBackend_OCSP(t *testing.T) {
+	var lock sync.Mutex
+	var caCert *x509.Certificate
+	var caKey *ecdsa.PrivateKey
+	status := ocsp.Good
+	available := true
+	queries := 0
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		queries++
+
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ocspReq, err := ocsp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		template := ocsp.Response{
+			Status:       status,
+			SerialNumber: ocspReq.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+		}
+		if status == ocsp.Revoked {
+			template.RevokedAt = time.Now().Add(-time.Minute)
+		}
+		resp, err := ocsp.CreateResponse(caCert, caCert, template, caKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(resp)
+	})
+
+	b, storage, connState, ca, key, cleanup := testRevocationSetup(t, handler, func(template *x509.Certificate, serverURL string) {
+		template.OCSPServer = []string{serverURL}
+	})
+	defer cleanup()
+	lock.Lock()
+	caCert, caKey = ca, key
+	lock.Unlock()
+
+	testUpdateEntry(t, b, storage, "certs/web", map[string]interface{}{
+		"ocsp_enabled": true,
+	})
+	testRevocationLogin(t, b, storage, connState, true)
+
+	// The status is cached until the next update of the response
+	lock.Lock()
+	status = ocsp.Revoked
+	lock.Unlock()
+	testRevocationLogin(t, b, storage, connState, true)
+	if queries != 1 {
+		t.Fatalf("expected 1 OCSP query, got %d", queries)
+	}
+
+	b.ocspCache.Flush()
+	testRevocationLogin(t, b, storage, connState, false)
+
+	// Logins fail closed when the responder is unavailable, unless the entry
+	// fails open
+	b.ocspCache.Flush()
+	lock.Lock()
+	available = false
+	lock.Unlock()
+	testRevocationLogin(t, b, storage, connState, false)
+
+	testUpdateEntry(t, b, storage, "certs/web", map[string]interface{}{
+		"ocsp_fail_open": true,
+	})
+	testRevocationLogin(t, b, storage, connState, true)
+
+	// Responders of the entry override those of the certificate
+	testUpdateEntry(t, b, storage, "certs/web", map[string]interface{}{
+		"ocsp_fail_open":        false,
+		"ocsp_servers_override": "http://127.0.0.1:0/ocsp",
+	})
+	lock.Lock()
+	available = true
+	queries = 0
+	lock.Unlock()
+	testRevocationLogin(t, b, storage, connState, false)
+	if queries != 0 {
+		t.Fatalf("expected no query to the responder of the certificate, got %d", queries)
+	}
+
+	// Disabling OCSP allows the login again
+	testUpdateEntry(t, b, storage, "certs/web", map[string]interface{}{
+		"ocsp_enabled": false,
+	})
+	testRevocationLogin(t, b, storage, connState, true)
+}
+
+func TestBackend_CRLDistributionPoints(t *testing.T) {
+	var lock sync.Mutex
+	var caCert *x509.Certificate
+	var caKey *ecdsa.PrivateKey
+	var revoked []pkix.RevokedCertificate
+	forged := false
+
+	// forgedCert and forgedKey sign CRLs not issued by the trusted CA
+	forgedKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "forged"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCRLSign | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	forgedDER, err := x509.CreateCertificate(rand.Reader, forgedTemplate, forgedTemplate, forgedKey.Public(), forgedKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedCert, err := x509.ParseCertificate(forgedDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		signer, signerKey := caCert, caKey
+		if forged {
+			signer, signerKey = forgedCert, forgedKey
+		}
+		crl, err := signer.CreateCRL(rand.Reader, signerKey, revoked, time.Now(), time.Now().Add(time.Hour))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(crl)
+	})
+
+	var crlURL string
+	b, storage, connState, ca, key, cleanup := testRevocationSetup(t, handler, func(template *x509.Certificate, serverURL string) {
+		crlURL = serverURL + "/crl"
+		template.CRLDistributionPoints = []string{crlURL}
+	})
+	defer cleanup()
+	lock.Lock()
+	caCert, caKey = ca, key
+	lock.Unlock()
+
+	testUpdateEntry(t, b, storage, "config", map[string]interface{}{
+		"enable_crl_distribution_points": true,
+	})
+	testRevocationLogin(t, b, storage, connState, true)
+
+	// Revoke the client certificate; the CRL is cached until it is refreshed
+	lock.Lock()
+	revoked = []pkix.RevokedCertificate{
+		{
+			SerialNumber:   connState.PeerCertificates[0].SerialNumber,
+			RevocationTime: time.Now(),
+		},
+	}
+	lock.Unlock()
+	testRevocationLogin(t, b, storage, connState, true)
+
+	b.cdpCRLMutex.Lock()
+	b.cdpCRLs[crlURL].fetchedAt = time.Time{}
+	b.cdpCRLMutex.Unlock()
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	testRevocationLogin(t, b, storage, connState, false)
+
+	// CRLs can also be configured with a URL without enabling distribution
+	// points
+	testUpdateEntry(t, b, storage, "config", map[string]interface{}{
+		"enable_crl_distribution_points": false,
+	})
+	testRevocationLogin(t, b, storage, connState, true)
+
+	// CRLs fetched from a URL must be signed by a trusted CA
+	lock.Lock()
+	forged = true
+	lock.Unlock()
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "crls/fetched",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"url": crlURL,
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for a forged CRL, got: err:%v resp:%#v", err, resp)
+	}
+	lock.Lock()
+	forged = false
+	lock.Unlock()
+
+	testUpdateEntry(t, b, storage, "crls/fetched", map[string]interface{}{
+		"url": crlURL,
+	})
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "crls/fetched",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if cdp, ok := resp.Data["cdp"].(map[string]interface{}); !ok || cdp["url"] != crlURL {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	testRevocationLogin(t, b, storage, connState, false)
+
+	// CRLs configured with a URL are refreshed periodically, and forged
+	// CRLs do not replace the previous serials
+	lock.Lock()
+	revoked = nil
+	forged = true
+	lock.Unlock()
+	crlInfo := b.crls["fetched"]
+	crlInfo.CDP.FetchedAt = time.Time{}
+	b.crls["fetched"] = crlInfo
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	testRevocationLogin(t, b, storage, connState, false)
+
+	lock.Lock()
+	forged = false
+	lock.Unlock()
+	if err := b.periodicFunc(context.Background(), &logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	testRevocationLogin(t, b, storage, connState, true)
+}
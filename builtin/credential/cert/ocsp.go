@@ -0,0 +1,131 @@
+package cert
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
+	multierror "github.com/hashicorp/go-multierror"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// ocspQueryTimeout bounds the time taken to query each OCSP responder
+	ocspQueryTimeout = 10 * time.Second
+
+	// ocspMaxResponseSize bounds the size of OCSP responses
+	ocspMaxResponseSize = 1024 * 1024
+
+	// ocspDefaultCacheTTL is how long OCSP statuses are cached when their
+	// response has no next update time
+	ocspDefaultCacheTTL = 5 * time.Minute
+)
+
+// ocspCacheKey identifies the certificate by its issuer's public key and its
+// serial number
+func ocspCacheKey(cert, issuer *x509.Certificate) string {
+	issuerHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(issuerHash[:]) + ":" + cert.SerialNumber.String()
+}
+
+// checkOCSP returns whether the certificate has been revoked according to
+// the OCSP responders of the entry, or of the certificate's AIA extension.
+// Responders are tried in turn until one of them knows the status of the
+// certificate. An error is returned if none of them does.
+func (b *backend) checkOCSP(ctx context.Context, entry *CertEntry, cert, issuer *x509.Certificate) (bool, error) {
+	key := ocspCacheKey(cert, issuer)
+	if status, ok := b.ocspCache.Get(key); ok {
+		return status.(int) == ocsp.Revoked, nil
+	}
+
+	servers := entry.OCSPServersOverride
+	if len(servers) == 0 {
+		servers = cert.OCSPServer
+	}
+	if len(servers) == 0 {
+		return false, errors.New("no OCSP responder is configured or found in the certificate")
+	}
+
+	ocspReq, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return false, errwrap.Wrapf("error creating OCSP request: {{err}}", err)
+	}
+
+	var errs *multierror.Error
+	for _, server := range servers {
+		resp, err := queryOCSP(ctx, server, ocspReq, cert, issuer)
+		if err != nil {
+			errs = multierror.Append(errs, errwrap.Wrapf(fmt.Sprintf("error querying OCSP responder %q: {{err}}", server), err))
+			continue
+		}
+		if resp.Status == ocsp.Unknown {
+			errs = multierror.Append(errs, fmt.Errorf("OCSP responder %q does not know the status of the certificate", server))
+			continue
+		}
+
+		ttl := ocspDefaultCacheTTL
+		if !resp.NextUpdate.IsZero() {
+			ttl = time.Until(resp.NextUpdate)
+		}
+		if ttl > 0 {
+			b.ocspCache.Set(key, resp.Status, ttl)
+		}
+
+		return resp.Status == ocsp.Revoked, nil
+	}
+
+	return false, errs.ErrorOrNil()
+}
+
+// queryOCSP sends the request to the responder and returns its response,
+// whose signature is checked against the issuer
+func queryOCSP(ctx context.Context, server string, ocspReq []byte, cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	if !isHTTPURL(server) {
+		return nil, errors.New("only http and https responders are supported")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ocspQueryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodPost, server, bytes.NewReader(ocspReq))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("Accept", "application/ocsp-response")
+
+	httpResp, err := cleanhttp.DefaultClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", httpResp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(httpResp.Body, ocspMaxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := ocsp.ParseResponseForCert(body, cert, issuer)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.NextUpdate.IsZero() && time.Now().After(resp.NextUpdate) {
+		return nil, errors.New("OCSP response is stale")
+	}
+
+	return resp, nil
+}
@@ -86,6 +86,23 @@ formatted as "oid:value". Expects the extension value to be some type of ASN1 en
 All values much match. Supports globbing on "value".`,
 			},
 
+			"ocsp_enabled": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: `Whether to check the status of client certificates with OCSP.`,
+			},
+
+			"ocsp_servers_override": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `A comma-separated list of OCSP responder URLs to
+query instead of the responders of the client certificate's AIA extension.`,
+			},
+
+			"ocsp_fail_open": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `If set, logins are allowed when the OCSP status of
+the client certificate cannot be determined. By default they are denied.`,
+			},
+
 			"display_name": &framework.FieldSchema{
 				Type: framework.TypeString,
 				Description: `The display name to use for clients using this
@@ -211,6 +228,9 @@ func (b *backend) pathCertRead(ctx context.Context, req *logical.Request, d *fra
 		"allowed_uri_sans":             cert.AllowedURISANs,
 		"allowed_organizational_units": cert.AllowedOrganizationalUnits,
 		"required_extensions":          cert.RequiredExtensions,
+		"ocsp_enabled":                 cert.OCSPEnabled,
+		"ocsp_servers_override":        cert.OCSPServersOverride,
+		"ocsp_fail_open":               cert.OCSPFailOpen,
 	}
 	cert.PopulateTokenData(data)
 
@@ -277,6 +297,15 @@ func (b *backend) pathCertWrite(ctx context.Context, req *logical.Request, d *fr
 	if requiredExtensionsRaw, ok := d.GetOk("required_extensions"); ok {
 		cert.RequiredExtensions = requiredExtensionsRaw.([]string)
 	}
+	if ocspEnabledRaw, ok := d.GetOk("ocsp_enabled"); ok {
+		cert.OCSPEnabled = ocspEnabledRaw.(bool)
+	}
+	if ocspServersOverrideRaw, ok := d.GetOk("ocsp_servers_override"); ok {
+		cert.OCSPServersOverride = ocspServersOverrideRaw.([]string)
+	}
+	if ocspFailOpenRaw, ok := d.GetOk("ocsp_fail_open"); ok {
+		cert.OCSPFailOpen = ocspFailOpenRaw.(bool)
+	}
 
 	// Get tokenutil fields
 	if err := cert.ParseTokenFields(req, d); err != nil {
@@ -345,6 +374,12 @@ func (b *backend) pathCertWrite(ctx context.Context, req *logical.Request, d *fr
 		return logical.ErrorResponse("failed to parse certificate"), nil
 	}
 
+	for _, server := range cert.OCSPServersOverride {
+		if !isHTTPURL(server) {
+			return logical.ErrorResponse(fmt.Sprintf("invalid OCSP responder URL %q: only http and https URLs are supported", server)), nil
+		}
+	}
+
 	// If the certificate is not a CA cert, then ensure that x509.ExtKeyUsageClientAuth is set
 	if !parsed[0].IsCA && parsed[0].ExtKeyUsage != nil {
 		var clientAuth bool
@@ -393,6 +428,9 @@ type CertEntry struct {
 	AllowedOrganizationalUnits []string
 	RequiredExtensions         []string
 	BoundCIDRs                 []*sockaddr.SockAddrMarshaler
+	OCSPEnabled                bool
+	OCSPServersOverride        []string
+	OCSPFailOpen               bool
 }
 
 const pathCertHelpSyn = `
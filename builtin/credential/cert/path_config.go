@@ -2,12 +2,17 @@ package cert
 
 import (
 	"context"
+	"time"
 
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
+// defaultCRLRefreshInterval is how often CRLs fetched from URLs are
+// refreshed unless configured otherwise
+const defaultCRLRefreshInterval = time.Hour
+
 func pathConfig(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: "config",
@@ -17,20 +22,45 @@ func pathConfig(b *backend) *framework.Path {
 				Default:     false,
 				Description: `If set, during renewal, skips the matching of presented client identity with the client identity used during login. Defaults to false.`,
 			},
+			"enable_crl_distribution_points": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Default:     false,
+				Description: `If set, the CRLs of the distribution points of client certificate chains are fetched and checked during authentication. Logins are denied if a CRL cannot be fetched. Defaults to false.`,
+			},
+			"crl_refresh_interval": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Default:     int(defaultCRLRefreshInterval.Seconds()),
+				Description: `How often CRLs fetched from distribution points or configured with a URL are refreshed. CRLs are also refreshed once they reach their next update time. Defaults to 1 hour.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.UpdateOperation: b.pathConfigWrite,
+			logical.ReadOperation:   b.pathConfigRead,
 		},
 	}
 }
 
 func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	disableBinding := data.Get("disable_binding").(bool)
+	config, err := b.Config(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
 
-	entry, err := logical.StorageEntryJSON("config", config{
-		DisableBinding: disableBinding,
-	})
+	if disableBindingRaw, ok := data.GetOk("disable_binding"); ok {
+		config.DisableBinding = disableBindingRaw.(bool)
+	}
+	if enableCDPRaw, ok := data.GetOk("enable_crl_distribution_points"); ok {
+		config.EnableCRLDistributionPoints = enableCDPRaw.(bool)
+	}
+	if refreshIntervalRaw, ok := data.GetOk("crl_refresh_interval"); ok {
+		config.CRLRefreshInterval = time.Duration(refreshIntervalRaw.(int)) * time.Second
+	}
+	if config.CRLRefreshInterval <= 0 {
+		return logical.ErrorResponse("crl_refresh_interval must be greater than zero"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
 	if err != nil {
 		return nil, err
 	}
@@ -41,6 +71,21 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, dat
 	return nil, nil
 }
 
+func (b *backend) pathConfigRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"disable_binding":                config.DisableBinding,
+			"enable_crl_distribution_points": config.EnableCRLDistributionPoints,
+			"crl_refresh_interval":           int64(config.CRLRefreshInterval.Seconds()),
+		},
+	}, nil
+}
+
 // Config returns the configuration for this backend.
 func (b *backend) Config(ctx context.Context, s logical.Storage) (*config, error) {
 	entry, err := s.Get(ctx, "config")
@@ -55,9 +100,14 @@ func (b *backend) Config(ctx context.Context, s logical.Storage) (*config, error
 			return nil, errwrap.Wrapf("error reading configuration: {{err}}", err)
 		}
 	}
+	if result.CRLRefreshInterval == 0 {
+		result.CRLRefreshInterval = defaultCRLRefreshInterval
+	}
 	return &result, nil
 }
 
 type config struct {
-	DisableBinding bool `json:"disable_binding"`
+	DisableBinding              bool          `json:"disable_binding"`
+	EnableCRLDistributionPoints bool          `json:"enable_crl_distribution_points"`
+	CRLRefreshInterval          time.Duration `json:"crl_refresh_interval"`
 }
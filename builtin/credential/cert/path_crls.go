@@ -3,12 +3,20 @@ package cert
 import (
 	"context"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math/big"
+	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/fatih/structs"
 	"github.com/hashicorp/errwrap"
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/certutil"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -30,6 +38,13 @@ May be DER or PEM encoded. Note: the expiration time
 is ignored; if the CRL is no longer valid, delete it
 using the same name as specified here.`,
 			},
+
+			"url": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The URL to fetch the CRL from, instead of giving
+the CRL itself. The CRL is refreshed periodically,
+and must be signed by a trusted CA certificate.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -82,6 +97,242 @@ func (b *backend) populateCRLs(ctx context.Context, storage logical.Storage) err
 	return nil
 }
 
+// crlInfoFromList returns the revoked serials of the CRL
+func crlInfoFromList(certList *pkix.CertificateList) CRLInfo {
+	crlInfo := CRLInfo{
+		Serials: map[string]RevokedSerialInfo{},
+	}
+	for _, revokedCert := range certList.TBSCertList.RevokedCertificates {
+		crlInfo.Serials[revokedCert.SerialNumber.String()] = RevokedSerialInfo{}
+	}
+	return crlInfo
+}
+
+// fetchCRL downloads and parses the CRL at the URL
+func fetchCRL(ctx context.Context, crlURL string) (*pkix.CertificateList, error) {
+	ctx, cancel := context.WithTimeout(ctx, crlFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, crlURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := cleanhttp.DefaultClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, crlMaxSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCRL(body)
+}
+
+// fetchURLCRL fetches the CRL configured with the URL and checks that it was
+// signed by one of the trusted CA certificates, so that a CRL served over
+// plain http cannot be replaced to un-revoke certificates
+func (b *backend) fetchURLCRL(ctx context.Context, storage logical.Storage, crlURL string) (*pkix.CertificateList, error) {
+	certList, err := fetchCRL(ctx, crlURL)
+	if err != nil {
+		return nil, err
+	}
+
+	_, trusted, _ := b.loadTrustedCerts(ctx, storage, "")
+	for _, parsed := range trusted {
+		for _, cert := range parsed.Certificates {
+			if cert.CheckCRLSignature(certList) == nil {
+				return certList, nil
+			}
+		}
+	}
+	return nil, errors.New("CRL is not signed by any trusted CA certificate")
+}
+
+// isHTTPURL returns whether the URL is an http or https URL, the only kinds
+// of URLs CRLs and OCSP responses are fetched from
+func isHTTPURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// crlDue returns whether a CRL fetched at the given time should be fetched
+// again
+func crlDue(fetchedAt, nextUpdate time.Time, refreshInterval time.Duration) bool {
+	now := time.Now()
+	return now.After(fetchedAt.Add(refreshInterval)) ||
+		(!nextUpdate.IsZero() && now.After(nextUpdate))
+}
+
+// refreshURLCRLs fetches again the CRLs configured with a URL that are due
+// to be refreshed. CRLs that cannot be fetched keep their previous serials.
+func (b *backend) refreshURLCRLs(ctx context.Context, storage logical.Storage, refreshInterval time.Duration) error {
+	if err := b.populateCRLs(ctx, storage); err != nil {
+		return err
+	}
+
+	due := map[string]string{}
+	b.crlUpdateMutex.RLock()
+	for name, crl := range b.crls {
+		if crl.CDP != nil && crlDue(crl.CDP.FetchedAt, crl.CDP.ValidUntil, refreshInterval) {
+			due[name] = crl.CDP.URL
+		}
+	}
+	b.crlUpdateMutex.RUnlock()
+
+	for name, crlURL := range due {
+		certList, err := b.fetchURLCRL(ctx, storage, crlURL)
+		if err != nil {
+			b.Logger().Warn("failed to refresh CRL", "name", name, "url", crlURL, "error", err)
+			continue
+		}
+
+		if err := b.storeURLCRL(ctx, storage, name, crlURL, certList); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// storeURLCRL stores a CRL fetched from the URL
+func (b *backend) storeURLCRL(ctx context.Context, storage logical.Storage, name, crlURL string, certList *pkix.CertificateList) error {
+	b.crlUpdateMutex.Lock()
+	defer b.crlUpdateMutex.Unlock()
+
+	crlInfo := crlInfoFromList(certList)
+	crlInfo.CDP = &CDPInfo{
+		URL:        crlURL,
+		FetchedAt:  time.Now(),
+		ValidUntil: certList.TBSCertList.NextUpdate,
+	}
+
+	entry, err := logical.StorageEntryJSON("crls/"+name, crlInfo)
+	if err != nil {
+		return err
+	}
+	if err := storage.Put(ctx, entry); err != nil {
+		return err
+	}
+
+	if b.crls != nil {
+		b.crls[name] = crlInfo
+	}
+
+	return nil
+}
+
+// cdpCRL is a CRL fetched from the distribution point of a certificate,
+// whose signature has been checked against the certificate's issuer
+type cdpCRL struct {
+	issuer     *x509.Certificate
+	serials    map[string]RevokedSerialInfo
+	fetchedAt  time.Time
+	nextUpdate time.Time
+}
+
+// fetchCDPCRL fetches the CRL at the URL and checks that it was signed by
+// the issuer
+func fetchCDPCRL(ctx context.Context, crlURL string, issuer *x509.Certificate) (*cdpCRL, error) {
+	certList, err := fetchCRL(ctx, crlURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := issuer.CheckCRLSignature(certList); err != nil {
+		return nil, errwrap.Wrapf("invalid CRL signature: {{err}}", err)
+	}
+
+	return &cdpCRL{
+		issuer:     issuer,
+		serials:    crlInfoFromList(certList).Serials,
+		fetchedAt:  time.Now(),
+		nextUpdate: certList.TBSCertList.NextUpdate,
+	}, nil
+}
+
+// cdpCRL returns the CRL of the distribution point, fetching it if it is
+// not cached or is due to be refreshed. A cached CRL is still used if it
+// cannot be refreshed, until its next update time has passed.
+func (b *backend) cdpCRL(ctx context.Context, crlURL string, issuer *x509.Certificate, refreshInterval time.Duration) (*cdpCRL, error) {
+	b.cdpCRLMutex.Lock()
+	cached := b.cdpCRLs[crlURL]
+	b.cdpCRLMutex.Unlock()
+
+	if cached != nil && cached.issuer.Equal(issuer) && !crlDue(cached.fetchedAt, cached.nextUpdate, refreshInterval) {
+		return cached, nil
+	}
+
+	crl, err := fetchCDPCRL(ctx, crlURL, issuer)
+	if err != nil {
+		if cached != nil && cached.issuer.Equal(issuer) && (cached.nextUpdate.IsZero() || time.Now().Before(cached.nextUpdate)) {
+			b.Logger().Warn("failed to refresh CRL of distribution point, using cached CRL", "url", crlURL, "error", err)
+			return cached, nil
+		}
+		return nil, errwrap.Wrapf(fmt.Sprintf("error fetching CRL from %q: {{err}}", crlURL), err)
+	}
+
+	b.cdpCRLMutex.Lock()
+	b.cdpCRLs[crlURL] = crl
+	b.cdpCRLMutex.Unlock()
+
+	return crl, nil
+}
+
+// refreshCDPCRLs fetches again the cached CRLs of distribution points that
+// are due to be refreshed, so that logins do not have to wait for them
+func (b *backend) refreshCDPCRLs(ctx context.Context, refreshInterval time.Duration) {
+	b.cdpCRLMutex.Lock()
+	due := map[string]*cdpCRL{}
+	for crlURL, crl := range b.cdpCRLs {
+		if crlDue(crl.fetchedAt, crl.nextUpdate, refreshInterval) {
+			due[crlURL] = crl
+		}
+	}
+	b.cdpCRLMutex.Unlock()
+
+	for crlURL, cached := range due {
+		crl, err := fetchCDPCRL(ctx, crlURL, cached.issuer)
+		if err != nil {
+			b.Logger().Warn("failed to refresh CRL of distribution point", "url", crlURL, "error", err)
+			continue
+		}
+
+		b.cdpCRLMutex.Lock()
+		b.cdpCRLs[crlURL] = crl
+		b.cdpCRLMutex.Unlock()
+	}
+}
+
+// checkForChainInCDPCRLs checks each certificate of the chain that has an
+// issuer against the CRLs of its distribution points. It returns an error
+// if a CRL cannot be fetched.
+func (b *backend) checkForChainInCDPCRLs(ctx context.Context, chain []*x509.Certificate, refreshInterval time.Duration) (bool, error) {
+	for i := 0; i+1 < len(chain); i++ {
+		cert, issuer := chain[i], chain[i+1]
+		for _, crlURL := range cert.CRLDistributionPoints {
+			if !isHTTPURL(crlURL) {
+				continue
+			}
+
+			crl, err := b.cdpCRL(ctx, crlURL, issuer, refreshInterval)
+			if err != nil {
+				return false, err
+			}
+			if _, ok := crl.serials[cert.SerialNumber.String()]; ok {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
 func (b *backend) findSerialInCRLs(serial *big.Int) map[string]RevokedSerialInfo {
 	b.crlUpdateMutex.RLock()
 	defer b.crlUpdateMutex.RUnlock()
@@ -190,6 +441,27 @@ func (b *backend) pathCRLWrite(ctx context.Context, req *logical.Request, d *fra
 		return logical.ErrorResponse(`"name" parameter cannot be empty`), nil
 	}
 	crl := d.Get("crl").(string)
+	crlURL := d.Get("url").(string)
+
+	if crlURL != "" {
+		if crl != "" {
+			return logical.ErrorResponse(`only one of "crl" and "url" can be given`), nil
+		}
+		if !isHTTPURL(crlURL) {
+			return logical.ErrorResponse(fmt.Sprintf("invalid CRL URL %q: only http and https URLs are supported", crlURL)), nil
+		}
+
+		certList, err := b.fetchURLCRL(ctx, req.Storage, crlURL)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("failed to fetch CRL from %q: %v", crlURL, err)), nil
+		}
+
+		if err := b.populateCRLs(ctx, req.Storage); err != nil {
+			return nil, err
+		}
+
+		return nil, b.storeURLCRL(ctx, req.Storage, name, crlURL, certList)
+	}
 
 	certList, err := x509.ParseCRL([]byte(crl))
 	if err != nil {
@@ -206,12 +478,7 @@ func (b *backend) pathCRLWrite(ctx context.Context, req *logical.Request, d *fra
 	b.crlUpdateMutex.Lock()
 	defer b.crlUpdateMutex.Unlock()
 
-	crlInfo := CRLInfo{
-		Serials: map[string]RevokedSerialInfo{},
-	}
-	for _, revokedCert := range certList.TBSCertList.RevokedCertificates {
-		crlInfo.Serials[revokedCert.SerialNumber.String()] = RevokedSerialInfo{}
-	}
+	crlInfo := crlInfoFromList(certList)
 
 	entry, err := logical.StorageEntryJSON("crls/"+name, crlInfo)
 	if err != nil {
@@ -227,12 +494,28 @@ func (b *backend) pathCRLWrite(ctx context.Context, req *logical.Request, d *fra
 }
 
 type CRLInfo struct {
+	CDP     *CDPInfo                     `json:"cdp" structs:"cdp,omitempty" mapstructure:"cdp"`
 	Serials map[string]RevokedSerialInfo `json:"serials" structs:"serials" mapstructure:"serials"`
 }
 
+// CDPInfo describes where a CRL configured with a URL is fetched from
+type CDPInfo struct {
+	URL        string    `json:"url" structs:"url" mapstructure:"url"`
+	FetchedAt  time.Time `json:"fetched_at" structs:"fetched_at,omitnested" mapstructure:"fetched_at"`
+	ValidUntil time.Time `json:"valid_until" structs:"valid_until,omitnested" mapstructure:"valid_until"`
+}
+
 type RevokedSerialInfo struct {
 }
 
+const (
+	// crlFetchTimeout bounds the time taken to fetch a CRL
+	crlFetchTimeout = 30 * time.Second
+
+	// crlMaxSize bounds the size of fetched CRLs
+	crlMaxSize = 64 * 1024 * 1024
+)
+
 const pathCRLsHelpSyn = `
 Manage Certificate Revocation Lists checked during authentication.
 `
@@ -249,4 +532,8 @@ in which none of the serials are revoked by any CRL -- allows authentication.
 This allows authentication to succeed when interim parts of one chain have been
 revoked; for instance, if a certificate is signed by two intermediate CAs due to
 one of them expiring.
+
+Instead of giving the CRL itself, a URL to fetch it from may be given. Such
+CRLs are fetched again periodically, according to the crl_refresh_interval
+of the backend configuration and their next update time.
 `
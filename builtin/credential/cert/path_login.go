@@ -188,6 +188,11 @@ func (b *backend) verifyCredentials(ctx context.Context, req *logical.Request, d
 		certName = d.Get("name").(string)
 	}
 
+	config, err := b.Config(ctx, req.Storage)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	// Load the trusted certificates
 	roots, trusted, trustedNonCAs := b.loadTrustedCerts(ctx, req.Storage, certName)
 
@@ -207,6 +212,13 @@ func (b *backend) verifyCredentials(ctx context.Context, req *logical.Request, d
 			if tCert.SerialNumber.Cmp(clientCert.SerialNumber) == 0 &&
 				bytes.Equal(tCert.AuthorityKeyId, clientCert.AuthorityKeyId) &&
 				b.matchesConstraints(clientCert, trustedNonCA.Certificates, trustedNonCA) {
+				chain := []*x509.Certificate{clientCert}
+				if issuer := presentedIssuer(clientCert, connState.PeerCertificates[1:]); issuer != nil {
+					chain = append(chain, issuer)
+				}
+				if !b.checkRevocation(ctx, config, trustedNonCA.Entry, chain) {
+					return nil, logical.ErrorResponse(errRevokedResponse), nil
+				}
 				return trustedNonCA, nil, nil
 			}
 		}
@@ -220,6 +232,7 @@ func (b *backend) verifyCredentials(ctx context.Context, req *logical.Request, d
 
 	// Search for a ParsedCert that intersects with the validated chains and any additional constraints
 	matches := make([]*ParsedCert, 0)
+	matchedChains := make([][]*x509.Certificate, 0)
 	for _, trust := range trusted { // For each ParsedCert in the config
 		for _, tCert := range trust.Certificates { // For each certificate in the entry
 			for _, chain := range trustedChains { // For each root chain that we matched
@@ -228,6 +241,7 @@ func (b *backend) verifyCredentials(ctx context.Context, req *logical.Request, d
 						b.matchesConstraints(clientCert, chain, trust) { // validate client cert + matched chain against the config
 						// Add the match to the list
 						matches = append(matches, trust)
+						matchedChains = append(matchedChains, chain)
 					}
 				}
 			}
@@ -239,8 +253,70 @@ func (b *backend) verifyCredentials(ctx context.Context, req *logical.Request, d
 		return nil, logical.ErrorResponse("no chain matching all constraints could be found for this login certificate"), nil
 	}
 
-	// Return the first matching entry (for backwards compatibility, we continue to just pick one if multiple match)
-	return matches[0], nil, nil
+	// Return the first matching entry whose chain has not been revoked (for
+	// backwards compatibility, we continue to just pick one if multiple match)
+	for i, match := range matches {
+		if b.checkRevocation(ctx, config, match.Entry, matchedChains[i]) {
+			return match, nil, nil
+		}
+	}
+
+	return nil, logical.ErrorResponse(errRevokedResponse), nil
+}
+
+// errRevokedResponse is returned when the chains of a client certificate
+// are revoked according to CRL distribution points or OCSP
+const errRevokedResponse = "client certificate has been revoked or its revocation status could not be determined"
+
+// checkRevocation checks the chain, which starts with the client
+// certificate, against the CRLs of its distribution points if enabled in the
+// configuration, and checks the client certificate with OCSP if enabled in
+// the entry. It returns false if the chain has been revoked, or if its
+// status could not be determined and the entry does not fail open.
+func (b *backend) checkRevocation(ctx context.Context, config *config, entry *CertEntry, chain []*x509.Certificate) bool {
+	if config.EnableCRLDistributionPoints {
+		revoked, err := b.checkForChainInCDPCRLs(ctx, chain, config.CRLRefreshInterval)
+		if err != nil {
+			b.Logger().Error("failed to check client certificate chain against CRL distribution points", "error", err)
+			return false
+		}
+		if revoked {
+			return false
+		}
+	}
+
+	if !entry.OCSPEnabled {
+		return true
+	}
+
+	var revoked bool
+	var err error
+	if len(chain) < 2 {
+		err = errors.New("the issuer of the client certificate is unknown")
+	} else {
+		revoked, err = b.checkOCSP(ctx, entry, chain[0], chain[1])
+	}
+	if err != nil {
+		if entry.OCSPFailOpen {
+			b.Logger().Warn("failed to check OCSP status of client certificate, allowing login", "cert_name", entry.Name, "error", err)
+			return true
+		}
+		b.Logger().Error("failed to check OCSP status of client certificate", "cert_name", entry.Name, "error", err)
+		return false
+	}
+
+	return !revoked
+}
+
+// presentedIssuer returns the certificate among those presented by the
+// client that issued the certificate, if any
+func presentedIssuer(cert *x509.Certificate, presented []*x509.Certificate) *x509.Certificate {
+	for _, candidate := range presented {
+		if cert.CheckSignatureFrom(candidate) == nil {
+			return candidate
+		}
+	}
+	return nil
 }
 
 func (b *backend) matchesConstraints(clientCert *x509.Certificate, trustedChain []*x509.Certificate, config *ParsedCert) bool {
@@ -30,6 +30,7 @@ func Backend() *backend {
 		},
 
 		Paths: append([]*framework.Path{
+			pathConfig(&b),
 			pathUsers(&b),
 			pathUsersList(&b),
 			pathUserPolicies(&b),
@@ -57,4 +58,7 @@ are supported.
 The username/password combination is configured using the "users/"
 endpoints by a user with root access. Authentication is then done
 by supplying the two fields for "login".
+
+The "config" endpoint sets a password policy that passwords must
+satisfy when users are created or their passwords are updated.
 `
@@ -2,7 +2,9 @@ package userpass
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"testing"
 	"time"
@@ -13,6 +15,7 @@ import (
 	sockaddr "github.com/hashicorp/go-sockaddr"
 	logicaltest "github.com/hashicorp/vault/helper/testhelpers/logical"
 	"github.com/hashicorp/vault/sdk/helper/policyutil"
+	"github.com/hashicorp/vault/sdk/helper/random"
 	"github.com/hashicorp/vault/sdk/helper/tokenutil"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/mitchellh/mapstructure"
@@ -250,6 +253,113 @@ func TestBackend_policiesUpdate(t *testing.T) {
 
 }
 
+func TestBackend_passwordPolicy(t *testing.T) {
+	policy, err := random.ParsePolicy(`
+length = 10
+
+rule "charset" {
+  charset = "abcdefghijklmnopqrstuvwxyz"
+}
+
+rule "charset" {
+  charset = "0123456789"
+  min-chars = 2
+}
+
+rule "dictionary" {
+  words = ["vault"]
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Factory(context.Background(), &logical.BackendConfig{
+		Logger: nil,
+		System: &logical.StaticSystemView{
+			DefaultLeaseTTLVal: testSysTTL,
+			MaxLeaseTTLVal:     testSysMaxTTL,
+			PasswordPolicies: map[string]logical.PasswordPolicy{
+				"strict":        policy,
+				"validate-only": validateOnlyPolicy{policy},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unable to create backend: %s", err)
+	}
+
+	logicaltest.Test(t, logicaltest.TestCase{
+		CredentialBackend: b,
+		Steps: []logicaltest.TestStep{
+			// Passwords are not validated until a policy is configured
+			testAccStepUser(t, "web", "password", "foo"),
+			testAccStepConfig(t, "missing", true),
+			testAccStepConfig(t, "validate-only", false),
+			testAccStepConfig(t, "strict", false),
+			testAccStepReadConfig(t, "strict"),
+			testAccStepLogin(t, "web", "password", []string{"default", "foo"}),
+			testAccStepUserInvalidPassword(t, "users/web", "password"),
+			testAccStepUserInvalidPassword(t, "users/web/password", "passwordab1"),
+			testAccStepUserInvalidPassword(t, "users/web/password", "myvault123"),
+			testAccStepUserInvalidPassword(t, "users/web/password", "short12"),
+			testUpdatePassword(t, "web", "correcthorse42"),
+			testAccStepLogin(t, "web", "correcthorse42", []string{"default", "foo"}),
+		},
+	})
+}
+
+// validateOnlyPolicy is a password policy that cannot generate passwords
+type validateOnlyPolicy struct {
+	logical.PasswordPolicy
+}
+
+func (validateOnlyPolicy) Generate(context.Context, io.Reader) (string, error) {
+	return "", errors.New("cannot generate passwords")
+}
+
+func testAccStepConfig(t *testing.T, passwordPolicy string, expectError bool) logicaltest.TestStep {
+	return logicaltest.TestStep{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Data: map[string]interface{}{
+			"password_policy": passwordPolicy,
+		},
+		ErrorOk: expectError,
+		Check: func(resp *logical.Response) error {
+			if expectError && (resp == nil || !resp.IsError()) {
+				return fmt.Errorf("expected an error setting password policy %q", passwordPolicy)
+			}
+			return nil
+		},
+	}
+}
+
+func testAccStepReadConfig(t *testing.T, passwordPolicy string) logicaltest.TestStep {
+	return logicaltest.TestStep{
+		Operation: logical.ReadOperation,
+		Path:      "config",
+		Check: func(resp *logical.Response) error {
+			if resp.Data["password_policy"] != passwordPolicy {
+				return fmt.Errorf("bad: %#v", resp.Data)
+			}
+			return nil
+		},
+	}
+}
+
+func testAccStepUserInvalidPassword(t *testing.T, path, password string) logicaltest.TestStep {
+	return logicaltest.TestStep{
+		Operation: logical.UpdateOperation,
+		Path:      path,
+		Data: map[string]interface{}{
+			"password": password,
+		},
+		ErrorOk: true,
+		Check:   logicaltest.TestCheckError(),
+	}
+}
+
 func testUpdatePassword(t *testing.T, user, password string) logicaltest.TestStep {
 	return logicaltest.TestStep{
 		Operation: logical.UpdateOperation,
@@ -0,0 +1,102 @@
+package userpass
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config$",
+		Fields: map[string]*framework.FieldSchema{
+			"password_policy": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The name of the password policy that the passwords of users must satisfy. If unset, any password is accepted.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+func (b *backend) pathConfigRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"password_policy": config.PasswordPolicy,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if passwordPolicyRaw, ok := d.GetOk("password_policy"); ok {
+		config.PasswordPolicy = passwordPolicyRaw.(string)
+	}
+
+	// An empty password is only used to check that the policy exists, so
+	// errors of the policy rejecting it are ignored
+	if config.PasswordPolicy != "" {
+		err := b.System().ValidatePasswordWithPolicy(ctx, config.PasswordPolicy, "")
+		if err != nil && strings.Contains(err.Error(), "not found") {
+			return logical.ErrorResponse(fmt.Sprintf("invalid password_policy: %s", err)), logical.ErrInvalidRequest
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, req.Storage.Put(ctx, entry)
+}
+
+// config returns the configuration of the backend, which is empty if it was
+// never written
+func (b *backend) config(ctx context.Context, s logical.Storage) (*userpassConfig, error) {
+	entry, err := s.Get(ctx, "config")
+	if err != nil {
+		return nil, err
+	}
+
+	var result userpassConfig
+	if entry != nil {
+		if err := entry.DecodeJSON(&result); err != nil {
+			return nil, err
+		}
+	}
+	return &result, nil
+}
+
+type userpassConfig struct {
+	PasswordPolicy string `json:"password_policy"`
+}
+
+const pathConfigHelpSyn = `
+Configure the userpass auth method.
+`
+
+const pathConfigHelpDesc = `
+This endpoint allows setting the password policy that the passwords of
+users must satisfy when they are created or updated. Password policies are
+managed at "sys/policies/password". Existing passwords are not affected
+by changes to the policy.
+`
@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -24,11 +25,14 @@ import (
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/consts"
 	"github.com/hashicorp/vault/sdk/helper/pluginutil"
+	"github.com/hashicorp/vault/sdk/helper/random"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/hashicorp/vault/vault"
 	"github.com/lib/pq"
 	"github.com/mitchellh/mapstructure"
 	"github.com/ory/dockertest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var (
@@ -1367,6 +1371,317 @@ func TestBackend_RotateRootCredentials(t *testing.T) {
 	}
 }
 
+func TestBackend_PasswordPolicy(t *testing.T) {
+	cluster, sys := getCluster(t)
+	defer cluster.Cleanup()
+
+	policy := `
+length = 24
+
+rule "charset" {
+  charset = "abcdefghijklmnopqrstuvwxyz"
+  min-chars = 2
+}
+
+rule "charset" {
+  charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+  min-chars = 2
+}
+
+rule "charset" {
+  charset = "0123456789"
+  min-chars = 2
+}
+`
+	generator, err := random.ParsePolicy(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cluster.Cores[0].Client.Logical().Write("sys/policies/password/db", map[string]interface{}{
+		"policy": policy,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	config.System = sys
+
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Cleanup(context.Background())
+
+	cleanup, connURL := preparePostgresTestContainer(t, config.StorageView, b)
+	defer cleanup()
+
+	createTestPGUser(t, connURL, dbUser, dbUserDefaultPassword, testRoleStaticCreate)
+
+	// Configure a connection
+	data := map[string]interface{}{
+		"connection_url": connURL,
+		"plugin_name":    "postgresql-database-plugin",
+		"allowed_roles":  []string{"*"},
+	}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/plugin-test",
+		Storage:   config.StorageView,
+		Data:      data,
+	}
+	resp, err := b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// Roles cannot use password policies that do not exist
+	data = map[string]interface{}{
+		"db_name":             "plugin-test",
+		"creation_statements": testRole,
+		"password_policy":     "missing",
+	}
+	req = &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roles/plugin-role-test",
+		Storage:   config.StorageView,
+		Data:      data,
+	}
+	resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected an error for a missing password policy, got: %#v", resp)
+	}
+
+	// Passwords from the policy are set with the rotation statements, so
+	// roles without them cannot use a policy
+	data["password_policy"] = "db"
+	resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected an error for a role without rotation statements, got: %#v", resp)
+	}
+
+	// Create a dynamic role using the policy
+	data["rotation_statements"] = testRoleStaticUpdate
+	resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	req = &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "roles/plugin-role-test",
+		Storage:   config.StorageView,
+	}
+	resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	if resp.Data["password_policy"] != "db" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/plugin-role-test",
+		Storage:   config.StorageView,
+	}
+	credsResp, err := b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil || (credsResp != nil && credsResp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, credsResp)
+	}
+	if err := generator.Validate(credsResp.Data["password"].(string)); err != nil {
+		t.Fatalf("dynamic password does not satisfy the policy: %v", err)
+	}
+	if !testCredsExist(t, credsResp, connURL) {
+		t.Fatalf("Creds should exist")
+	}
+	verifyPgConn(t, credsResp.Data["username"].(string), credsResp.Data["password"].(string), connURL)
+
+	// Create a static role using the policy
+	data = map[string]interface{}{
+		"db_name":             "plugin-test",
+		"rotation_statements": testRoleStaticUpdate,
+		"username":            dbUser,
+		"rotation_period":     "5400s",
+		"password_policy":     "db",
+	}
+	req = &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "static-roles/plugin-static-role-test",
+		Storage:   config.StorageView,
+		Data:      data,
+	}
+	resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	req = &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "static-creds/plugin-static-role-test",
+		Storage:   config.StorageView,
+	}
+	resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	password := resp.Data["password"].(string)
+	if err := generator.Validate(password); err != nil {
+		t.Fatalf("static password does not satisfy the policy: %v", err)
+	}
+	verifyPgConn(t, dbUser, password, connURL)
+}
+
+// mockPolicyDatabase is a database plugin that records the users it creates,
+// sets the credentials of and revokes
+type mockPolicyDatabase struct {
+	dbplugin.Database
+
+	setErr error
+
+	created map[string]string
+	set     map[string]string
+	revoked []string
+}
+
+func (m *mockPolicyDatabase) CreateUser(_ context.Context, _ dbplugin.Statements, usernameConfig dbplugin.UsernameConfig, _ time.Time) (string, string, error) {
+	username := fmt.Sprintf("v-%s-%d", usernameConfig.RoleName, len(m.created))
+	password := "plugin-password"
+	m.created[username] = password
+	return username, password, nil
+}
+
+func (m *mockPolicyDatabase) SetCredentials(_ context.Context, _ dbplugin.Statements, staticConfig dbplugin.StaticUserConfig) (string, string, error) {
+	if m.setErr != nil {
+		return "", "", m.setErr
+	}
+	m.set[staticConfig.Username] = staticConfig.Password
+	return staticConfig.Username, staticConfig.Password, nil
+}
+
+func (m *mockPolicyDatabase) RevokeUser(_ context.Context, _ dbplugin.Statements, username string) error {
+	m.revoked = append(m.revoked, username)
+	return nil
+}
+
+func (m *mockPolicyDatabase) Close() error {
+	return nil
+}
+
+func TestBackend_PasswordPolicy_MockPlugin(t *testing.T) {
+	policy, err := random.ParsePolicy(`length = 20 rule "charset" { charset = "abcdefghijklmnopqrstuvwxyz0123456789" }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	config.System = &logical.StaticSystemView{
+		DefaultLeaseTTLVal: time.Hour,
+		MaxLeaseTTLVal:     time.Hour,
+		PasswordPolicies: map[string]logical.PasswordPolicy{
+			"db": policy,
+		},
+	}
+
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Cleanup(context.Background())
+
+	entry, err := logical.StorageEntryJSON("config/mock", &DatabaseConfig{
+		PluginName:   "mock-database-plugin",
+		AllowedRoles: []string{"*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.StorageView.Put(context.Background(), entry); err != nil {
+		t.Fatal(err)
+	}
+
+	mock := &mockPolicyDatabase{
+		created: make(map[string]string),
+		set:     make(map[string]string),
+	}
+	b.(*databaseBackend).connections["mock"] = &dbPluginInstance{
+		Database: mock,
+		name:     "mock",
+		id:       "mock",
+	}
+
+	req := &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roles/mock-role",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"db_name":             "mock",
+			"creation_statements": testRole,
+			"rotation_statements": testRoleStaticUpdate,
+			"password_policy":     "db",
+		},
+	}
+	resp, err := b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	credsReq := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/mock-role",
+		Storage:   config.StorageView,
+	}
+	resp, err = b.HandleRequest(namespace.RootContext(nil), credsReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	// The password generated by the plugin is replaced with the one from the
+	// policy before it is returned
+	username := resp.Data["username"].(string)
+	password := resp.Data["password"].(string)
+	if _, ok := mock.created[username]; !ok {
+		t.Fatalf("user %q was not created by the plugin", username)
+	}
+	if mock.set[username] != password {
+		t.Fatalf("expected the password %q to be set on %q, got: %#v", password, username, mock.set)
+	}
+	if password == mock.created[username] {
+		t.Fatal("the password generated by the plugin was returned")
+	}
+	if err := policy.Validate(password); err != nil {
+		t.Fatalf("dynamic password does not satisfy the policy: %v", err)
+	}
+	if len(mock.revoked) != 0 {
+		t.Fatalf("expected no revoked users, got: %v", mock.revoked)
+	}
+
+	// Users are revoked if the password from the policy cannot be set
+	mock.setErr = errors.New("set credentials failed")
+	_, err = b.HandleRequest(namespace.RootContext(nil), credsReq)
+	if err == nil || !strings.Contains(err.Error(), "set credentials failed") {
+		t.Fatalf("expected an error setting the password, got: %v", err)
+	}
+	if len(mock.created) != 2 || len(mock.revoked) != 1 {
+		t.Fatalf("expected the second user to be revoked, got created: %v revoked: %v", mock.created, mock.revoked)
+	}
+	if _, ok := mock.created[mock.revoked[0]]; !ok || mock.set[mock.revoked[0]] != "" {
+		t.Fatalf("unexpected revoked user %q", mock.revoked[0])
+	}
+
+	// Plugins that cannot set credentials are reported as such
+	mock.setErr = status.Error(codes.Unimplemented, "unimplemented")
+	_, err = b.HandleRequest(namespace.RootContext(nil), credsReq)
+	if err == nil || !strings.Contains(err.Error(), "does not support setting credentials") {
+		t.Fatalf("expected an error for a plugin that cannot set credentials, got: %v", err)
+	}
+	if len(mock.revoked) != 2 {
+		t.Fatalf("expected the third user to be revoked, got: %v", mock.revoked)
+	}
+}
+
 func testCredsExist(t *testing.T, resp *logical.Response, connURL string) bool {
 	t.Helper()
 	var d struct {
@@ -2,13 +2,18 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/sdk/database/dbplugin"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/strutil"
 	"github.com/hashicorp/vault/sdk/logical"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func pathCredsCreate(b *databaseBackend) []*framework.Path {
@@ -95,6 +100,16 @@ func (b *databaseBackend) pathCredsCreateRead() framework.OperationFunc {
 			RoleName:    name,
 		}
 
+		// Generate the password before creating the user so that a failure
+		// to do so does not leave a user behind
+		var policyPassword string
+		if role.PasswordPolicy != "" {
+			policyPassword, err = b.generatePassword(ctx, db, role)
+			if err != nil {
+				return nil, err
+			}
+		}
+
 		// Create the user
 		username, password, err := db.CreateUser(ctx, role.Statements, usernameConfig, expiration)
 		if err != nil {
@@ -102,6 +117,29 @@ func (b *databaseBackend) pathCredsCreateRead() framework.OperationFunc {
 			return nil, err
 		}
 
+		// Plugins generate the passwords of the users they create, so the
+		// password from the policy replaces it. The password generated by the
+		// plugin is never returned, and the user is revoked if it cannot be
+		// replaced.
+		if policyPassword != "" {
+			_, password, err = db.SetCredentials(ctx, role.Statements, dbplugin.StaticUserConfig{
+				Username: username,
+				Password: policyPassword,
+			})
+			if err != nil {
+				b.CloseIfShutdown(db, err)
+				if status.Code(err) == codes.Unimplemented {
+					err = errors.New("the database plugin does not support setting credentials")
+				}
+				var merr error
+				merr = multierror.Append(merr, errwrap.Wrapf("error setting the password from the password policy: {{err}}", err))
+				if revokeErr := db.RevokeUser(ctx, role.Statements, username); revokeErr != nil {
+					merr = multierror.Append(merr, errwrap.Wrapf(fmt.Sprintf("error revoking user %q: {{err}}", username), revokeErr))
+				}
+				return nil, merr
+			}
+		}
+
 		resp := b.Secret(SecretCredsType).Response(map[string]interface{}{
 			"username": username,
 			"password": password,
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/sdk/database/dbplugin"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/locksutil"
@@ -87,6 +88,12 @@ func fieldsForType(roleType string) map[string]*framework.FieldSchema {
 			Type:        framework.TypeString,
 			Description: "Name of the database this role acts on.",
 		},
+		"password_policy": {
+			Type: framework.TypeString,
+			Description: `Name of the password policy used to generate the
+	passwords of the role. If unset, passwords are generated by the database
+	plugin. Requires the plugin to support setting credentials.`,
+		},
 	}
 
 	// Get the fields that are specific to the type of role, and add them to the
@@ -144,6 +151,13 @@ func dynamicFields() map[string]*framework.FieldSchema {
 	type will support this functionality. See the plugin's API page for
 	more information on support and formatting for this parameter.`,
 		},
+		"rotation_statements": {
+			Type: framework.TypeStringSlice,
+			Description: `Specifies the database statements to be executed
+	to set the passwords generated from "password_policy" on created users.
+	Required with "password_policy". See the plugin's API page for more
+	information on support and formatting for this parameter.`,
+		},
 	}
 	return fields
 }
@@ -230,6 +244,7 @@ func (b *databaseBackend) pathStaticRoleRead(ctx context.Context, req *logical.R
 	data := map[string]interface{}{
 		"db_name":             role.DBName,
 		"rotation_statements": role.Statements.Rotation,
+		"password_policy":     role.PasswordPolicy,
 	}
 
 	// guard against nil StaticAccount; shouldn't happen but we'll be safe
@@ -266,8 +281,10 @@ func (b *databaseBackend) pathRoleRead(ctx context.Context, req *logical.Request
 		"revocation_statements": role.Statements.Revocation,
 		"rollback_statements":   role.Statements.Rollback,
 		"renew_statements":      role.Statements.Renewal,
+		"rotation_statements":   role.Statements.Rotation,
 		"default_ttl":           role.DefaultTTL.Seconds(),
 		"max_ttl":               role.MaxTTL.Seconds(),
+		"password_policy":       role.PasswordPolicy,
 	}
 	if len(role.Statements.Creation) == 0 {
 		data["creation_statements"] = []string{}
@@ -281,6 +298,9 @@ func (b *databaseBackend) pathRoleRead(ctx context.Context, req *logical.Request
 	if len(role.Statements.Renewal) == 0 {
 		data["renew_statements"] = []string{}
 	}
+	if len(role.Statements.Rotation) == 0 {
+		data["rotation_statements"] = []string{}
+	}
 
 	return &logical.Response{
 		Data: data,
@@ -334,6 +354,13 @@ func (b *databaseBackend) pathRoleCreateUpdate(ctx context.Context, req *logical
 		if role.DBName == "" {
 			return logical.ErrorResponse("database name is required"), nil
 		}
+
+		if passwordPolicyRaw, ok := data.GetOk("password_policy"); ok {
+			role.PasswordPolicy = passwordPolicyRaw.(string)
+		}
+		if err := b.checkPasswordPolicy(ctx, role.PasswordPolicy); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
 	}
 
 	// Statements
@@ -362,6 +389,12 @@ func (b *databaseBackend) pathRoleCreateUpdate(ctx context.Context, req *logical
 			role.Statements.Renewal = data.Get("renew_statements").([]string)
 		}
 
+		if rotationStmtsRaw, ok := data.GetOk("rotation_statements"); ok {
+			role.Statements.Rotation = rotationStmtsRaw.([]string)
+		} else if createOperation {
+			role.Statements.Rotation = data.Get("rotation_statements").([]string)
+		}
+
 		// Do not persist deprecated statements that are populated on role read
 		role.Statements.CreationStatements = ""
 		role.Statements.RevocationStatements = ""
@@ -371,6 +404,13 @@ func (b *databaseBackend) pathRoleCreateUpdate(ctx context.Context, req *logical
 
 	role.Statements.Revocation = strutil.RemoveEmpty(role.Statements.Revocation)
 
+	// Plugins generate the passwords of the users they create, so passwords
+	// from the policy are set on the users afterwards with the rotation
+	// statements
+	if role.PasswordPolicy != "" && len(role.Statements.Rotation) == 0 {
+		return logical.ErrorResponse("rotation_statements are required to set the passwords generated from password_policy"), nil
+	}
+
 	// TTLs
 	{
 		if defaultTTLRaw, ok := data.GetOk("default_ttl"); ok {
@@ -445,6 +485,13 @@ func (b *databaseBackend) pathStaticRoleCreateUpdate(ctx context.Context, req *l
 		return logical.ErrorResponse("database name is a required field"), nil
 	}
 
+	if passwordPolicyRaw, ok := data.GetOk("password_policy"); ok {
+		role.PasswordPolicy = passwordPolicyRaw.(string)
+	}
+	if err := b.checkPasswordPolicy(ctx, role.PasswordPolicy); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
 	username := data.Get("username").(string)
 	if username == "" && createRole {
 		return logical.ErrorResponse("username is a required field to create a static account"), nil
@@ -527,6 +574,38 @@ type roleEntry struct {
 	DefaultTTL    time.Duration       `json:"default_ttl"`
 	MaxTTL        time.Duration       `json:"max_ttl"`
 	StaticAccount *staticAccount      `json:"static_account" mapstructure:"static_account"`
+
+	// PasswordPolicy is the name of the password policy used to generate
+	// passwords, instead of the database plugin
+	PasswordPolicy string `json:"password_policy" mapstructure:"password_policy"`
+}
+
+// checkPasswordPolicy returns an error if a password cannot be generated
+// from the named password policy, such as when it does not exist or when the
+// backend runs as an external plugin, whose system view cannot generate
+// passwords from policies
+func (b *databaseBackend) checkPasswordPolicy(ctx context.Context, policyName string) error {
+	if policyName == "" {
+		return nil
+	}
+	if _, err := b.System().GeneratePasswordFromPolicy(ctx, policyName); err != nil {
+		return fmt.Errorf("invalid password_policy: %s", err)
+	}
+	return nil
+}
+
+// generatePassword returns a password generated from the password policy of
+// the role, or by the database plugin if the role has none
+func (b *databaseBackend) generatePassword(ctx context.Context, db *dbPluginInstance, role *roleEntry) (string, error) {
+	if role.PasswordPolicy == "" {
+		return db.GenerateCredentials(ctx)
+	}
+
+	password, err := b.System().GeneratePasswordFromPolicy(ctx, role.PasswordPolicy)
+	if err != nil {
+		return "", errwrap.Wrapf(fmt.Sprintf("error generating password from password policy %q: {{err}}", role.PasswordPolicy), err)
+	}
+	return password, nil
 }
 
 type staticAccount struct {
@@ -3,11 +3,13 @@ package database
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-test/deep"
 	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/helper/random"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
@@ -509,6 +511,69 @@ func TestBackend_StaticRole_Role_name_check(t *testing.T) {
 	}
 }
 
+func TestBackend_Role_PasswordPolicy(t *testing.T) {
+	policy, err := random.ParsePolicy(`length = 20 rule "charset" { charset = "abcdefghijklmnopqrstuvwxyz0123456789" }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	config.System = &logical.StaticSystemView{
+		PasswordPolicies: map[string]logical.PasswordPolicy{
+			"db": policy,
+		},
+	}
+
+	b, err := Factory(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Cleanup(context.Background())
+
+	data := map[string]interface{}{
+		"db_name":             "plugin-test",
+		"creation_statements": testRole,
+		"password_policy":     "db",
+	}
+	req := &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roles/plugin-role-test",
+		Storage:   config.StorageView,
+		Data:      data,
+	}
+
+	// Dynamic roles need rotation statements to set the passwords generated
+	// from the policy
+	resp, err := b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for a role without rotation statements, got: resp: %#v\nerr: %v", resp, err)
+	}
+
+	data["rotation_statements"] = testRoleStaticUpdate
+	resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+
+	req = &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "roles/plugin-role-test",
+		Storage:   config.StorageView,
+	}
+	resp, err = b.HandleRequest(namespace.RootContext(nil), req)
+	if err != nil || resp == nil {
+		t.Fatalf("err:%s resp:%#v\n", err, resp)
+	}
+	expected := []string{strings.TrimSpace(testRoleStaticUpdate)}
+	if diff := deep.Equal(resp.Data["rotation_statements"], expected); diff != nil {
+		t.Fatal(diff)
+	}
+	if resp.Data["password_policy"] != "db" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
 const testRoleStaticCreate = `
 CREATE ROLE "{{name}}" WITH
   LOGIN
@@ -289,8 +289,8 @@ type setStaticAccountOutput struct {
 // - loads an existing WAL entry if WALID input is given, otherwise creates a
 // new WAL entry
 // - gets a database connection
-// - accepts an input password, otherwise generates a new one via gRPC to the
-// database plugin
+// - accepts an input password, otherwise generates a new one from the role's
+// password policy or via gRPC to the database plugin
 // - sets new password for the static account
 // - uses WAL for ensuring passwords are not lost if storage to Vault fails
 //
@@ -330,7 +330,7 @@ func (b *databaseBackend) setStaticAccount(ctx context.Context, s logical.Storag
 	newPassword := input.Password
 	if newPassword == "" {
 		// Generate a new password
-		newPassword, err = db.GenerateCredentials(ctx)
+		newPassword, err = b.generatePassword(ctx, db, input.Role)
 		if err != nil {
 			return output, err
 		}
@@ -0,0 +1,565 @@
+package pki
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+const (
+	// acmeNonceLifetime is how long a nonce handed out to a client can be
+	// used for
+	acmeNonceLifetime = 15 * time.Minute
+
+	// acmeOrderLifetime is how long an order and its authorizations can be
+	// completed for
+	acmeOrderLifetime = 24 * time.Hour
+
+	// acmeValidationTimeout bounds the validation of a challenge
+	acmeValidationTimeout = 10 * time.Second
+
+	// acmeMaxRedirects bounds the redirects followed when fetching an http-01
+	// challenge
+	acmeMaxRedirects = 10
+
+	acmeErrorPrefix = "urn:ietf:params:acme:error:"
+)
+
+// Statuses of ACME resources, as defined in RFC 8555 section 7.1.6
+const (
+	acmeStatusPending     = "pending"
+	acmeStatusReady       = "ready"
+	acmeStatusValid       = "valid"
+	acmeStatusInvalid     = "invalid"
+	acmeStatusDeactivated = "deactivated"
+	acmeStatusExpired     = "expired"
+)
+
+const (
+	acmeChallengeHTTP01 = "http-01"
+	acmeChallengeDNS01  = "dns-01"
+)
+
+// acmeSignatureAlgorithms are the JWS algorithms accepted for signing
+// requests
+var acmeSignatureAlgorithms = map[string]bool{
+	string(jose.RS256): true,
+	string(jose.ES256): true,
+	string(jose.ES384): true,
+	string(jose.ES512): true,
+	string(jose.EdDSA): true,
+}
+
+// acmeError is an ACME problem document, as defined in RFC 8555 section 6.7
+type acmeError struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail,omitempty"`
+	Status int    `json:"status,omitempty"`
+}
+
+func (e *acmeError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Detail)
+}
+
+func newACMEError(errType string, status int, format string, args ...interface{}) *acmeError {
+	return &acmeError{
+		Type:   acmeErrorPrefix + errType,
+		Detail: fmt.Sprintf(format, args...),
+		Status: status,
+	}
+}
+
+type acmeIdentifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type acmeAccount struct {
+	ID         string           `json:"id"`
+	Key        *jose.JSONWebKey `json:"key"`
+	Thumbprint string           `json:"thumbprint"`
+	Status     string           `json:"status"`
+	Contact    []string         `json:"contact"`
+	CreatedAt  time.Time        `json:"created_at"`
+}
+
+type acmeOrder struct {
+	ID               string           `json:"id"`
+	Status           string           `json:"status"`
+	Expires          time.Time        `json:"expires"`
+	Identifiers      []acmeIdentifier `json:"identifiers"`
+	AuthorizationIDs []string         `json:"authorization_ids"`
+
+	// Directory is the role in the path of the directory the order was
+	// placed through, empty for the default directory
+	Directory string `json:"directory"`
+
+	CertificateSerial  string    `json:"certificate_serial,omitempty"`
+	CertificateChain   string    `json:"certificate_chain,omitempty"`
+	CertificateExpires time.Time `json:"certificate_expires,omitempty"`
+}
+
+type acmeAuthorization struct {
+	ID         string           `json:"id"`
+	Identifier acmeIdentifier   `json:"identifier"`
+	Wildcard   bool             `json:"wildcard"`
+	Status     string           `json:"status"`
+	Expires    time.Time        `json:"expires"`
+	Challenges []*acmeChallenge `json:"challenges"`
+}
+
+type acmeChallenge struct {
+	Type      string     `json:"type"`
+	Token     string     `json:"token"`
+	Status    string     `json:"status"`
+	Validated time.Time  `json:"validated,omitempty"`
+	Error     *acmeError `json:"error,omitempty"`
+}
+
+func acmeAccountPath(accountID string) string {
+	return "acme/accounts/" + accountID
+}
+
+func acmeAccountKeyPath(thumbprint string) string {
+	return "acme/account-keys/" + thumbprint
+}
+
+func acmeOrderPath(accountID, orderID string) string {
+	return acmeAccountPath(accountID) + "/orders/" + orderID
+}
+
+func acmeAuthorizationPath(accountID, authzID string) string {
+	return acmeAccountPath(accountID) + "/authorizations/" + authzID
+}
+
+func fetchACMEEntry(ctx context.Context, s logical.Storage, key string, out interface{}) (bool, error) {
+	entry, err := s.Get(ctx, key)
+	if err != nil {
+		return false, errwrap.Wrapf(fmt.Sprintf("error fetching %q: {{err}}", key), err)
+	}
+	if entry == nil {
+		return false, nil
+	}
+	if err := entry.DecodeJSON(out); err != nil {
+		return false, errwrap.Wrapf(fmt.Sprintf("error decoding %q: {{err}}", key), err)
+	}
+	return true, nil
+}
+
+func writeACMEEntry(ctx context.Context, s logical.Storage, key string, value interface{}) error {
+	entry, err := logical.StorageEntryJSON(key, value)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+func fetchACMEAccount(ctx context.Context, s logical.Storage, accountID string) (*acmeAccount, error) {
+	var account acmeAccount
+	if ok, err := fetchACMEEntry(ctx, s, acmeAccountPath(accountID), &account); !ok {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func fetchACMEOrder(ctx context.Context, s logical.Storage, accountID, orderID string) (*acmeOrder, error) {
+	var order acmeOrder
+	if ok, err := fetchACMEEntry(ctx, s, acmeOrderPath(accountID, orderID), &order); !ok {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func fetchACMEAuthorization(ctx context.Context, s logical.Storage, accountID, authzID string) (*acmeAuthorization, error) {
+	var authz acmeAuthorization
+	if ok, err := fetchACMEEntry(ctx, s, acmeAuthorizationPath(accountID, authzID), &authz); !ok {
+		return nil, err
+	}
+	return &authz, nil
+}
+
+// acmeRandomToken returns a random string suitable for nonces and challenge
+// tokens
+func acmeRandomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func (b *backend) acmeNewNonce() (string, error) {
+	nonce, err := acmeRandomToken()
+	if err != nil {
+		return "", err
+	}
+	b.acmeNonces.SetDefault(nonce, struct{}{})
+	return nonce, nil
+}
+
+// acmeConsumeNonce returns whether the nonce was handed out and not used yet,
+// and marks it as used
+func (b *backend) acmeConsumeNonce(nonce string) bool {
+	b.acmeNonceLock.Lock()
+	defer b.acmeNonceLock.Unlock()
+
+	if _, ok := b.acmeNonces.Get(nonce); !ok {
+		return false
+	}
+	b.acmeNonces.Delete(nonce)
+	return true
+}
+
+// acmeContext describes the directory an ACME request was sent to
+type acmeContext struct {
+	// directory is the role in the path of the directory, empty for the
+	// default directory
+	directory string
+	role      *roleEntry
+
+	// baseURL is the URL of the mount, and directoryURL the URL that the
+	// resources of the directory are under
+	baseURL      string
+	directoryURL string
+}
+
+func (c *acmeContext) url(path string) string {
+	return c.directoryURL + "/" + path
+}
+
+func (b *backend) acmeContext(ctx context.Context, req *logical.Request, data *framework.FieldData) (*acmeContext, error) {
+	config, err := b.ACME(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil || !config.Enabled {
+		return nil, newACMEError("unauthorized", http.StatusForbidden, "the ACME server is not enabled")
+	}
+
+	directory := data.Get("role").(string)
+	roleName := directory
+	switch {
+	case directory == "":
+		roleName = config.DefaultRole
+		if roleName == "" {
+			return nil, newACMEError("unauthorized", http.StatusForbidden, "no default role is set for the ACME server")
+		}
+	case !strutil.StrListContains(config.AllowedRoles, "*") && !strutil.StrListContains(config.AllowedRoles, directory):
+		return nil, newACMEError("unauthorized", http.StatusForbidden, "role %q is not allowed for the ACME server", directory)
+	}
+
+	role, err := b.getRole(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, newACMEError("unauthorized", http.StatusForbidden, "unknown role: %s", roleName)
+	}
+
+	acmeCtx := &acmeContext{
+		directory:    directory,
+		role:         role,
+		baseURL:      config.BaseURL,
+		directoryURL: config.BaseURL + "/acme",
+	}
+	if directory != "" {
+		acmeCtx.directoryURL += "/roles/" + directory
+	}
+	return acmeCtx, nil
+}
+
+// acmeOperation is the handler of an ACME request
+type acmeOperation func(context.Context, *logical.Request, *framework.FieldData, *acmeContext) (*logical.Response, error)
+
+// acmeWrap turns an ACME handler into an operation, rendering errors as
+// problem documents and adding the headers all ACME responses carry
+func (b *backend) acmeWrap(op acmeOperation) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		// Nonces are only known to the node that handed them out, so all
+		// ACME requests are answered by the active node
+		if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby) {
+			return nil, logical.ErrPerfStandbyPleaseForward
+		}
+
+		acmeCtx, err := b.acmeContext(ctx, req, data)
+		var resp *logical.Response
+		if err == nil {
+			resp, err = op(ctx, req, data, acmeCtx)
+		}
+		if err != nil {
+			resp, err = b.acmeErrorResponse(err)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		nonce, err := b.acmeNewNonce()
+		if err != nil {
+			return nil, err
+		}
+		if resp.Headers == nil {
+			resp.Headers = map[string][]string{}
+		}
+		resp.Headers["Replay-Nonce"] = []string{nonce}
+		if acmeCtx != nil {
+			resp.Headers["Link"] = append(resp.Headers["Link"], fmt.Sprintf(`<%s>;rel="index"`, acmeCtx.url("directory")))
+		}
+		return resp, nil
+	}
+}
+
+func (b *backend) acmeErrorResponse(err error) (*logical.Response, error) {
+	var problem *acmeError
+	switch err.(type) {
+	case *acmeError:
+		problem = err.(*acmeError)
+	case errutil.UserError:
+		problem = newACMEError("malformed", http.StatusBadRequest, err.Error())
+	default:
+		b.Logger().Error("error handling ACME request", "error", err)
+		problem = newACMEError("serverInternal", http.StatusInternalServerError, err.Error())
+	}
+
+	body, err := json.Marshal(problem)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/problem+json",
+			logical.HTTPRawBody:     body,
+			logical.HTTPStatusCode:  problem.Status,
+		},
+	}, nil
+}
+
+// acmeResponse renders an ACME resource
+func acmeResponse(status int, body interface{}) (*logical.Response, error) {
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/json",
+			logical.HTTPRawBody:     bodyBytes,
+			logical.HTTPStatusCode:  status,
+		},
+		Headers: map[string][]string{},
+	}, nil
+}
+
+// acmeRequest is the verified content of a JWS signed ACME request
+type acmeRequest struct {
+	payload []byte
+
+	// account is set for requests signed with the key of an account, and
+	// jwk for requests signed with the key embedded in the request
+	account *acmeAccount
+	jwk     *jose.JSONWebKey
+}
+
+type acmeKeyMode int
+
+const (
+	acmeKeyAccount acmeKeyMode = iota
+	acmeKeyEmbedded
+	acmeKeyAny
+)
+
+// acmeVerifyRequest checks the signature, nonce and URL of a JWS signed ACME
+// request, as described in RFC 8555 section 6.2
+func (b *backend) acmeVerifyRequest(ctx context.Context, req *logical.Request, data *framework.FieldData, acmeCtx *acmeContext, mode acmeKeyMode) (*acmeRequest, error) {
+	if data.Get("protected").(string) == "" || data.Get("signature").(string) == "" {
+		return nil, newACMEError("malformed", http.StatusBadRequest, "the request must be a JWS")
+	}
+	raw, err := json.Marshal(map[string]string{
+		"protected": data.Get("protected").(string),
+		"payload":   data.Get("payload").(string),
+		"signature": data.Get("signature").(string),
+	})
+	if err != nil {
+		return nil, err
+	}
+	jws, err := jose.ParseSigned(string(raw))
+	if err != nil {
+		return nil, newACMEError("malformed", http.StatusBadRequest, "the request is not a valid JWS: %s", err)
+	}
+	if len(jws.Signatures) != 1 {
+		return nil, newACMEError("malformed", http.StatusBadRequest, "the request must have exactly one signature")
+	}
+	header := jws.Signatures[0].Protected
+
+	if !acmeSignatureAlgorithms[header.Algorithm] {
+		return nil, newACMEError("badSignatureAlgorithm", http.StatusBadRequest, "unsupported signature algorithm %q", header.Algorithm)
+	}
+	if !b.acmeConsumeNonce(header.Nonce) {
+		return nil, newACMEError("badNonce", http.StatusBadRequest, "invalid or reused nonce")
+	}
+	if requestURL, _ := header.ExtraHeaders["url"].(string); requestURL != acmeCtx.baseURL+"/"+req.Path {
+		return nil, newACMEError("unauthorized", http.StatusUnauthorized, "the url header does not match the request")
+	}
+
+	acmeReq := &acmeRequest{}
+	var key *jose.JSONWebKey
+	switch {
+	case header.JSONWebKey != nil && header.KeyID != "":
+		return nil, newACMEError("malformed", http.StatusBadRequest, "the request cannot have both the jwk and kid headers")
+
+	case header.JSONWebKey != nil:
+		if mode == acmeKeyAccount {
+			return nil, newACMEError("malformed", http.StatusBadRequest, "the request must be signed with the key of an account")
+		}
+		if !header.JSONWebKey.Valid() || !header.JSONWebKey.IsPublic() {
+			return nil, newACMEError("badPublicKey", http.StatusBadRequest, "the jwk header is not a valid public key")
+		}
+		key = header.JSONWebKey
+		acmeReq.jwk = header.JSONWebKey
+
+	case header.KeyID != "":
+		if mode == acmeKeyEmbedded {
+			return nil, newACMEError("malformed", http.StatusBadRequest, "the request must be signed with the key in the jwk header")
+		}
+		idx := strings.LastIndex(header.KeyID, "/account/")
+		if !strings.HasPrefix(header.KeyID, acmeCtx.baseURL+"/acme/") || idx == -1 {
+			return nil, newACMEError("accountDoesNotExist", http.StatusBadRequest, "unknown account %q", header.KeyID)
+		}
+		// Account IDs are UUIDs; anything else, such as the URL of an order
+		// of the account, must not be loaded as an account
+		accountID := header.KeyID[idx+len("/account/"):]
+		if _, err := uuid.ParseUUID(accountID); err != nil || strings.Contains(accountID, "/") {
+			return nil, newACMEError("accountDoesNotExist", http.StatusBadRequest, "unknown account %q", header.KeyID)
+		}
+		account, err := fetchACMEAccount(ctx, req.Storage, accountID)
+		if err != nil {
+			return nil, err
+		}
+		if account == nil || account.Key == nil {
+			return nil, newACMEError("accountDoesNotExist", http.StatusBadRequest, "unknown account %q", header.KeyID)
+		}
+		if account.Status != acmeStatusValid {
+			return nil, newACMEError("unauthorized", http.StatusUnauthorized, "the account is %s", account.Status)
+		}
+		key = account.Key
+		acmeReq.account = account
+
+	default:
+		return nil, newACMEError("malformed", http.StatusBadRequest, "the request must have either the jwk or kid header")
+	}
+
+	acmeReq.payload, err = jws.Verify(key)
+	if err != nil {
+		return nil, newACMEError("malformed", http.StatusBadRequest, "invalid signature: %s", err)
+	}
+	return acmeReq, nil
+}
+
+// decodePayload decodes the JSON payload of the request, unless the request
+// is a POST-as-GET request, in which case it returns false
+func (r *acmeRequest) decodePayload(out interface{}) (bool, error) {
+	if len(r.payload) == 0 {
+		return false, nil
+	}
+	if err := json.Unmarshal(r.payload, out); err != nil {
+		return false, newACMEError("malformed", http.StatusBadRequest, "the payload could not be decoded: %s", err)
+	}
+	return true, nil
+}
+
+// acmeKeyAuthorization returns the key authorization of a challenge, as
+// defined in RFC 8555 section 8.1
+func acmeKeyAuthorization(account *acmeAccount, chal *acmeChallenge) string {
+	return chal.Token + "." + account.Thumbprint
+}
+
+func acmeThumbprint(key *jose.JSONWebKey) (string, error) {
+	thumbprint, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(thumbprint), nil
+}
+
+// acmeCheckRedirect only lets the validation of http-01 challenges follow
+// redirects to the HTTP and HTTPS ports, as allowed by RFC 8555 section 8.3,
+// so that clients cannot make Vault reach arbitrary services
+func acmeCheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= acmeMaxRedirects {
+		return fmt.Errorf("stopped after %d redirects", acmeMaxRedirects)
+	}
+	switch {
+	case req.URL.Scheme == "http" && (req.URL.Port() == "" || req.URL.Port() == "80"):
+	case req.URL.Scheme == "https" && (req.URL.Port() == "" || req.URL.Port() == "443"):
+	default:
+		return fmt.Errorf("redirect to %s://%s is not allowed", req.URL.Scheme, req.URL.Host)
+	}
+	return nil
+}
+
+// acmeValidateChallenge checks that the client controls the domain through
+// the given challenge, as described in RFC 8555 section 8
+func (b *backend) acmeValidateChallenge(ctx context.Context, domain string, chal *acmeChallenge, keyAuth string) *acmeError {
+	ctx, cancel := context.WithTimeout(ctx, acmeValidationTimeout)
+	defer cancel()
+
+	switch chal.Type {
+	case acmeChallengeHTTP01:
+		challengeURL := fmt.Sprintf("http://%s/.well-known/acme-challenge/%s", domain, chal.Token)
+		httpReq, err := http.NewRequest(http.MethodGet, challengeURL, nil)
+		if err != nil {
+			return newACMEError("malformed", http.StatusBadRequest, "invalid challenge URL: %s", err)
+		}
+		resp, err := b.acmeHTTPClient.Do(httpReq.WithContext(ctx))
+		if err != nil {
+			return newACMEError("connection", http.StatusBadRequest, "error fetching %s: %s", challengeURL, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return newACMEError("unauthorized", http.StatusForbidden, "fetching %s returned status %d", challengeURL, resp.StatusCode)
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		if err != nil {
+			return newACMEError("connection", http.StatusBadRequest, "error reading %s: %s", challengeURL, err)
+		}
+		if strings.TrimSpace(string(body)) != keyAuth {
+			return newACMEError("incorrectResponse", http.StatusForbidden, "the key authorization at %s does not match", challengeURL)
+		}
+		return nil
+
+	case acmeChallengeDNS01:
+		name := "_acme-challenge." + domain
+		records, err := b.acmeLookupTXT(ctx, name)
+		if err != nil {
+			return newACMEError("dns", http.StatusBadRequest, "error looking up the TXT records of %s: %s", name, err)
+		}
+		digest := sha256.Sum256([]byte(keyAuth))
+		expected := base64.RawURLEncoding.EncodeToString(digest[:])
+		for _, record := range records {
+			if record == expected {
+				return nil
+			}
+		}
+		return newACMEError("incorrectResponse", http.StatusForbidden, "no TXT record of %s matches the key authorization", name)
+
+	default:
+		return newACMEError("malformed", http.StatusBadRequest, "unsupported challenge type %q", chal.Type)
+	}
+}
@@ -2,12 +2,16 @@ package pki
 
 import (
 	"context"
+	"net"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
 
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
+	cache "github.com/patrickmn/go-cache"
 )
 
 // Factory creates a new backend implementing the logical.Backend interface
@@ -33,12 +37,23 @@ func Backend(conf *logical.BackendConfig) *backend {
 				"ca",
 				"crl/pem",
 				"crl",
+				"crl/delta/pem",
+				"crl/delta",
+				"ocsp",
+				"ocsp/*",
+				"issuer/*",
+				"acme/*",
 			},
 
 			LocalStorage: []string{
 				"revoked/",
 				"crl",
+				"crls/",
+				"crl-state",
+				"delta-crls/",
+				"delta-wal/",
 				"certs/",
+				"acme/",
 			},
 
 			Root: []string{
@@ -48,45 +63,69 @@ func Backend(conf *logical.BackendConfig) *backend {
 
 			SealWrapStorage: []string{
 				"config/ca_bundle",
+				"config/pending_key",
+				"config/ocsp",
+				"issuers/",
 			},
 		},
 
-		Paths: []*framework.Path{
-			pathListRoles(&b),
-			pathRoles(&b),
-			pathGenerateRoot(&b),
-			pathSignIntermediate(&b),
-			pathSignSelfIssued(&b),
-			pathDeleteRoot(&b),
-			pathGenerateIntermediate(&b),
-			pathSetSignedIntermediate(&b),
-			pathConfigCA(&b),
-			pathConfigCRL(&b),
-			pathConfigURLs(&b),
-			pathSignVerbatim(&b),
-			pathSign(&b),
-			pathIssue(&b),
-			pathRotateCRL(&b),
-			pathFetchCA(&b),
-			pathFetchCAChain(&b),
-			pathFetchCRL(&b),
-			pathFetchCRLViaCertPath(&b),
-			pathFetchValid(&b),
-			pathFetchListCerts(&b),
-			pathRevoke(&b),
-			pathTidy(&b),
-		},
+		Paths: framework.PathAppend(
+			[]*framework.Path{
+				pathListRoles(&b),
+				pathRoles(&b),
+				pathGenerateRoot(&b),
+				pathRotateRoot(&b),
+				pathSignIntermediate(&b),
+				pathSignSelfIssued(&b),
+				pathDeleteRoot(&b),
+				pathGenerateIntermediate(&b),
+				pathSetSignedIntermediate(&b),
+				pathCrossSignIntermediate(&b),
+				pathConfigCA(&b),
+				pathConfigCRL(&b),
+				pathConfigURLs(&b),
+				pathConfigOCSP(&b),
+				pathConfigACME(&b),
+				pathConfigIssuers(&b),
+				pathListIssuers(&b),
+				pathIssuers(&b),
+				pathSignVerbatim(&b),
+				pathSign(&b),
+				pathIssue(&b),
+				pathRotateCRL(&b),
+				pathFetchCA(&b),
+				pathFetchCAChain(&b),
+				pathFetchCRL(&b),
+				pathFetchCRLViaCertPath(&b),
+				pathFetchValid(&b),
+				pathFetchListCerts(&b),
+				pathFetchIssuer(&b),
+				pathOCSP(&b),
+				pathOCSPGet(&b),
+				pathRevoke(&b),
+				pathTidy(&b),
+			},
+			pathsACME(&b),
+		),
 
 		Secrets: []*framework.Secret{
 			secretCerts(&b),
 		},
 
-		BackendType: logical.TypeLogical,
+		InitializeFunc: b.initialize,
+		PeriodicFunc:   b.periodicFunc,
+		Invalidate:     b.invalidate,
+		BackendType:    logical.TypeLogical,
 	}
 
 	b.crlLifetime = time.Hour * 72
 	b.tidyCASGuard = new(uint32)
 	b.storage = conf.StorageView
+	b.ocspCache = cache.New(0, time.Minute)
+	b.acmeNonces = cache.New(acmeNonceLifetime, time.Minute)
+	b.acmeHTTPClient = cleanhttp.DefaultClient()
+	b.acmeHTTPClient.CheckRedirect = acmeCheckRedirect
+	b.acmeLookupTXT = net.DefaultResolver.LookupTXT
 
 	return &b
 }
@@ -98,11 +137,38 @@ type backend struct {
 	crlLifetime       time.Duration
 	revokeStorageLock sync.RWMutex
 	tidyCASGuard      *uint32
+
+	// ocspCache holds signed OCSP responses; it is flushed whenever the
+	// issuers, the OCSP configuration or the revocation status of a
+	// certificate change
+	ocspCache *cache.Cache
+
+	// acmeNonces holds the nonces handed out to ACME clients until they
+	// are used or expire
+	acmeNonces      *cache.Cache
+	acmeNonceLock   sync.Mutex
+	acmeAccountLock sync.Mutex
+
+	// acmeHTTPClient and acmeLookupTXT are used to validate ACME challenges
+	acmeHTTPClient *http.Client
+	acmeLookupTXT  func(context.Context, string) ([]string, error)
+}
+
+func (b *backend) invalidate(_ context.Context, key string) {
+	switch {
+	case key == "config/ca_bundle", key == "config/ocsp", key == "config/issuers",
+		strings.HasPrefix(key, "issuers/"), strings.HasPrefix(key, "revoked/"):
+		b.ocspCache.Flush()
+	}
 }
 
 const backendHelp = `
 The PKI backend dynamically generates X509 server and client certificates.
 
 After mounting this backend, configure the CA using the "pem_bundle" endpoint within
-the "config/" path.
+the "config/" path. A mount can hold several CAs, called issuers, which roles
+select between; the default issuer is set at "config/issuers".
+
+Certificates can also be ordered by ACME clients once the ACME server is
+enabled at "config/acme".
 `
@@ -402,8 +402,11 @@ func runSteps(t *testing.T, rootB, intB *backend, client *api.Client, rootName,
 			if err != nil {
 				t.Fatal(err)
 			}
-			if resp != nil {
-				t.Fatal("expected nil response")
+			if resp == nil || resp.Data["issuer_id"] == nil {
+				t.Fatal("expected the ID of the new issuer")
+			}
+			if len(resp.Warnings) != 0 {
+				t.Fatalf("expected the new issuer to be the default: %v", resp.Warnings)
 			}
 		}
 
@@ -62,23 +62,31 @@ func getFormat(data *framework.FieldData) string {
 	return format
 }
 
-// Fetches the CA info. Unlike other certificates, the CA info is stored
-// in the backend as a CertBundle, because we are storing its private key
+// Fetches the CA info of the default issuer. Unlike other certificates, the
+// CA info is stored in the backend as a CertBundle, because we are storing
+// its private key
 func fetchCAInfo(ctx context.Context, req *logical.Request) (*certutil.CAInfoBundle, error) {
-	bundleEntry, err := req.Storage.Get(ctx, "config/ca_bundle")
+	return fetchCAInfoByIssuer(ctx, req, defaultIssuerRef)
+}
+
+// Fetches the CA info of the issuer referred to by "default", an issuer ID
+// or an issuer name
+func fetchCAInfoByIssuer(ctx context.Context, req *logical.Request, issuerRef string) (*certutil.CAInfoBundle, error) {
+	issuer, err := resolveIssuerRef(ctx, req.Storage, issuerRef)
 	if err != nil {
 		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch local CA certificate/key: %v", err)}
 	}
-	if bundleEntry == nil {
-		return nil, errutil.UserError{Err: "backend must be configured with a CA certificate/key"}
+	if issuer == nil {
+		if issuerRef == "" || issuerRef == defaultIssuerRef {
+			return nil, errutil.UserError{Err: "backend must be configured with a CA certificate/key"}
+		}
+		return nil, errutil.UserError{Err: fmt.Sprintf("issuer %q not found", issuerRef)}
 	}
-
-	var bundle certutil.CertBundle
-	if err := bundleEntry.DecodeJSON(&bundle); err != nil {
-		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to decode local CA certificate/key: %v", err)}
+	if issuer.Bundle == nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("issuer %s has no CA certificate/key", issuer.ID)}
 	}
 
-	parsedBundle, err := bundle.ToParsedCertBundle()
+	parsedBundle, err := issuer.Bundle.ToParsedCertBundle()
 	if err != nil {
 		return nil, errutil.InternalError{Err: err.Error()}
 	}
@@ -95,9 +103,10 @@ func fetchCAInfo(ctx context.Context, req *logical.Request) (*certutil.CAInfoBun
 	}
 	if entries == nil {
 		entries = &certutil.URLEntries{
-			IssuingCertificates:   []string{},
-			CRLDistributionPoints: []string{},
-			OCSPServers:           []string{},
+			IssuingCertificates:        []string{},
+			CRLDistributionPoints:      []string{},
+			OCSPServers:                []string{},
+			DeltaCRLDistributionPoints: []string{},
 		}
 	}
 	caInfo.URLs = entries
@@ -463,9 +472,10 @@ func generateCert(ctx context.Context,
 			}
 			if entries == nil {
 				entries = &certutil.URLEntries{
-					IssuingCertificates:   []string{},
-					CRLDistributionPoints: []string{},
-					OCSPServers:           []string{},
+					IssuingCertificates:        []string{},
+					CRLDistributionPoints:      []string{},
+					OCSPServers:                []string{},
+					DeltaCRLDistributionPoints: []string{},
 				}
 			}
 			data.Params.URLs = entries
@@ -622,6 +632,22 @@ func signCert(b *backend,
 // from the various endpoints and generates a CreationParameters with the
 // parameters that can be used to issue or sign
 func generateCreationBundle(b *backend, data *inputBundle, caSign *certutil.CAInfoBundle, csr *x509.CertificateRequest) (*certutil.CreationBundle, error) {
+	// Populate the identity templates of the role before checking the
+	// request against it
+	var customExtensions []pkix.Extension
+	if data.role.AllowedDomainsTemplate || data.role.SubjectTemplate || len(data.role.CustomExtensions) > 0 {
+		role, extensions, err := populateRoleTemplates(b, data.req, data.role)
+		if err != nil {
+			return nil, err
+		}
+		data = &inputBundle{
+			role:    role,
+			req:     data.req,
+			apiData: data.apiData,
+		}
+		customExtensions = extensions
+	}
+
 	// Read in names -- CN, DNS and email addresses
 	var cn string
 	var ridSerialNumber string
@@ -920,6 +946,7 @@ func generateCreationBundle(b *backend, data *inputBundle, caSign *certutil.CAIn
 			PolicyIdentifiers:             data.role.PolicyIdentifiers,
 			BasicConstraintsValidForNonCA: data.role.BasicConstraintsValidForNonCA,
 			NotBeforeDuration:             data.role.NotBeforeDuration,
+			CustomExtensions:              customExtensions,
 		},
 		SigningBundle: caSign,
 		CSR:           csr,
@@ -1,8 +1,12 @@
 package pki
 
 import (
+	"context"
 	"crypto/x509"
+	"encoding/asn1"
+	"math/big"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/api"
 	vaulthttp "github.com/hashicorp/vault/http"
@@ -122,3 +126,239 @@ func TestBackend_CRL_EnableDisable(t *testing.T) {
 	toggle(false)
 	test(6)
 }
+
+// parseCRLNumbers parses a CRL fetched from the given path, returning its CRL
+// number, the number of the complete CRL it is a delta of if any, and its
+// revoked serials
+func parseCRLNumbers(t *testing.T, b *backend, s logical.Storage, path string, ca *x509.Certificate) (int64, int64, map[string]bool) {
+	t.Helper()
+	resp := issuersRequest(t, b, s, logical.ReadOperation, path, nil)
+	crl, err := x509.ParseCRL(resp.Data[logical.HTTPRawBody].([]byte))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ca.CheckCRLSignature(crl); err != nil {
+		t.Fatal(err)
+	}
+
+	var number, deltaBase int64
+	for _, ext := range crl.TBSCertList.Extensions {
+		var value *big.Int
+		switch {
+		case ext.Id.Equal(oidExtensionCRLNumber):
+			if _, err := asn1.Unmarshal(ext.Value, &value); err != nil {
+				t.Fatal(err)
+			}
+			number = value.Int64()
+		case ext.Id.Equal(oidExtensionDeltaCRLIndicator):
+			if !ext.Critical {
+				t.Fatal("expected the delta CRL indicator to be critical")
+			}
+			if _, err := asn1.Unmarshal(ext.Value, &value); err != nil {
+				t.Fatal(err)
+			}
+			deltaBase = value.Int64()
+		}
+	}
+	if number == 0 {
+		t.Fatalf("no CRL number in CRL at %s", path)
+	}
+
+	serials := map[string]bool{}
+	for _, revoked := range crl.TBSCertList.RevokedCertificates {
+		serials[revoked.SerialNumber.String()] = true
+	}
+	return number, deltaBase, serials
+}
+
+func TestBackend_CRL_DeltaAutoRebuild(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	ctx := context.Background()
+
+	resp := issuersRequest(t, b, storage, logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "myvault.com",
+		"key_type":    "ec",
+		"key_bits":    256,
+		"ttl":         "48h",
+	})
+	ca := parsePEMCert(t, resp.Data["certificate"].(string))
+
+	issuersRequest(t, b, storage, logical.UpdateOperation, "roles/test", map[string]interface{}{
+		"allowed_domains":  "foobar.com",
+		"allow_subdomains": true,
+		"ttl":              "1h",
+	})
+	issuersRequest(t, b, storage, logical.UpdateOperation, "config/urls", map[string]interface{}{
+		"crl_distribution_points":       "http://127.0.0.1:8200/v1/pki/crl",
+		"delta_crl_distribution_points": "http://127.0.0.1:8200/v1/pki/crl/delta",
+	})
+
+	// Delta CRLs require automatic rebuilding, which must happen before the
+	// CRL expires
+	issuersRequestError(t, b, storage, logical.UpdateOperation, "config/crl", map[string]interface{}{
+		"enable_delta": true,
+	})
+	issuersRequestError(t, b, storage, logical.UpdateOperation, "config/crl", map[string]interface{}{
+		"auto_rebuild":              true,
+		"auto_rebuild_grace_period": "72h",
+	})
+	issuersRequest(t, b, storage, logical.UpdateOperation, "config/crl", map[string]interface{}{
+		"auto_rebuild": true,
+		"enable_delta": true,
+	})
+	resp = issuersRequest(t, b, storage, logical.ReadOperation, "config/crl", nil)
+	if resp.Data["auto_rebuild_grace_period"] != "12h" || resp.Data["delta_rebuild_interval"] != "15m" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	var serials []string
+	for i := 0; i < 3; i++ {
+		resp = issuersRequest(t, b, storage, logical.UpdateOperation, "issue/test", map[string]interface{}{
+			"common_name": "test.foobar.com",
+		})
+		serials = append(serials, resp.Data["serial_number"].(string))
+	}
+
+	// Issued certificates point to the delta CRLs
+	cert := parsePEMCert(t, resp.Data["certificate"].(string))
+	found := false
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 46}) {
+			found = true
+			var points []struct {
+				DistributionPoint struct {
+					FullName []asn1.RawValue `asn1:"optional,tag:0"`
+				} `asn1:"optional,tag:0"`
+			}
+			if _, err := asn1.Unmarshal(ext.Value, &points); err != nil {
+				t.Fatal(err)
+			}
+			if len(points) != 1 || string(points[0].DistributionPoint.FullName[0].Bytes) != "http://127.0.0.1:8200/v1/pki/crl/delta" {
+				t.Fatalf("bad freshest CRL extension: %#v", points)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("no freshest CRL extension in issued certificate")
+	}
+
+	baseNumber, deltaBase, revoked := parseCRLNumbers(t, b, storage, "crl", ca)
+	if deltaBase != 0 || len(revoked) != 0 {
+		t.Fatalf("bad complete CRL: %d %v", deltaBase, revoked)
+	}
+	number, deltaBase, revoked := parseCRLNumbers(t, b, storage, "crl/delta", ca)
+	if number != baseNumber+1 || deltaBase != baseNumber || len(revoked) != 0 {
+		t.Fatalf("bad delta CRL: %d %d %v", number, deltaBase, revoked)
+	}
+
+	// Revocations wait for the next rebuild
+	issuersRequest(t, b, storage, logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": serials[0],
+	})
+	revokedSerial := parsePEMCert(t, issuersRequest(t, b, storage, logical.ReadOperation, "cert/"+serials[0], nil).Data["certificate"].(string)).SerialNumber.String()
+	if _, _, revoked = parseCRLNumbers(t, b, storage, "crl/delta", ca); len(revoked) != 0 {
+		t.Fatalf("delta CRL rebuilt before its interval: %v", revoked)
+	}
+
+	periodic := func() {
+		t.Helper()
+		if err := b.periodicFunc(ctx, &logical.Request{Storage: storage}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	updateState := func(update func(*crlState)) {
+		t.Helper()
+		state, err := fetchCRLState(ctx, storage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		update(state)
+		if err := writeCRLState(ctx, storage, state); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	periodic()
+	if _, _, revoked = parseCRLNumbers(t, b, storage, "crl/delta", ca); len(revoked) != 0 {
+		t.Fatalf("delta CRL rebuilt before its interval: %v", revoked)
+	}
+
+	updateState(func(state *crlState) {
+		state.LastDeltaRebuild = time.Now().Add(-time.Hour)
+	})
+	periodic()
+	number, deltaBase, revoked = parseCRLNumbers(t, b, storage, "crl/delta", ca)
+	if number != baseNumber+2 || deltaBase != baseNumber || len(revoked) != 1 || !revoked[revokedSerial] {
+		t.Fatalf("bad delta CRL: %d %d %v", number, deltaBase, revoked)
+	}
+	if _, _, revoked = parseCRLNumbers(t, b, storage, "crl", ca); len(revoked) != 0 {
+		t.Fatalf("complete CRL rebuilt before its grace period: %v", revoked)
+	}
+
+	// Without new revocations, the delta CRL is not rebuilt
+	updateState(func(state *crlState) {
+		state.LastDeltaRebuild = time.Now().Add(-time.Hour)
+	})
+	periodic()
+	if number, _, _ = parseCRLNumbers(t, b, storage, "crl/delta", ca); number != baseNumber+2 {
+		t.Fatalf("delta CRL rebuilt without revocations: %d", number)
+	}
+
+	// Within the grace period, the complete CRL is rebuilt, followed by an
+	// empty delta CRL
+	updateState(func(state *crlState) {
+		state.NextUpdate = time.Now().Add(time.Hour)
+	})
+	periodic()
+	newBaseNumber, _, revoked := parseCRLNumbers(t, b, storage, "crl", ca)
+	if newBaseNumber != baseNumber+3 || len(revoked) != 1 || !revoked[revokedSerial] {
+		t.Fatalf("bad complete CRL: %d %v", newBaseNumber, revoked)
+	}
+	number, deltaBase, revoked = parseCRLNumbers(t, b, storage, "issuer/default/crl/delta", ca)
+	if number != newBaseNumber+1 || deltaBase != newBaseNumber || len(revoked) != 0 {
+		t.Fatalf("bad delta CRL: %d %d %v", number, deltaBase, revoked)
+	}
+
+	// Rotating includes pending revocations right away
+	issuersRequest(t, b, storage, logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": serials[1],
+	})
+	issuersRequest(t, b, storage, logical.ReadOperation, "crl/rotate", nil)
+	if _, _, revoked = parseCRLNumbers(t, b, storage, "crl", ca); len(revoked) != 2 {
+		t.Fatalf("bad complete CRL: %v", revoked)
+	}
+	if keys, err := storage.List(ctx, "delta-wal/"); err != nil || len(keys) != 0 {
+		t.Fatalf("revocations left after rebuild: %v %v", keys, err)
+	}
+
+	resp = issuersRequest(t, b, storage, logical.ReadOperation, "cert/delta-crl", nil)
+	if _, err := x509.ParseCRL([]byte(resp.Data["certificate"].(string))); err != nil {
+		t.Fatal(err)
+	}
+
+	// Disabling delta CRLs removes them, and revocations rebuild the CRL
+	// again once automatic rebuilding is disabled
+	issuersRequest(t, b, storage, logical.UpdateOperation, "config/crl", map[string]interface{}{
+		"auto_rebuild": false,
+		"enable_delta": false,
+	})
+	resp = issuersRequest(t, b, storage, logical.ReadOperation, "crl/delta", nil)
+	if resp.Data[logical.HTTPStatusCode] != 204 {
+		t.Fatalf("expected no delta CRL, got %#v", resp.Data)
+	}
+	issuersRequest(t, b, storage, logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": serials[2],
+	})
+	crl, err := x509.ParseCRL(issuersRequest(t, b, storage, logical.ReadOperation, "crl", nil).Data[logical.HTTPRawBody].([]byte))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crl.TBSCertList.RevokedCertificates) != 3 {
+		t.Fatalf("bad complete CRL: %#v", crl.TBSCertList.RevokedCertificates)
+	}
+	for _, ext := range crl.TBSCertList.Extensions {
+		if ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 46}) {
+			t.Fatal("complete CRL points to delta CRLs that are disabled")
+		}
+	}
+}
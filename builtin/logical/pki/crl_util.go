@@ -2,16 +2,22 @@ package pki
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
-	"errors"
+	"encoding/asn1"
 	"fmt"
+	"math/big"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/consts"
 	"github.com/hashicorp/vault/sdk/helper/errutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -33,20 +39,25 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 		return nil, nil
 	}
 
-	signingBundle, caErr := fetchCAInfo(ctx, req)
-	switch caErr.(type) {
-	case errutil.UserError:
-		return logical.ErrorResponse(fmt.Sprintf("could not fetch the CA certificate: %s", caErr)), nil
-	case errutil.InternalError:
-		return nil, fmt.Errorf("error fetching CA certificate: %s", caErr)
+	issuers, err := fetchIssuers(ctx, req.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching CA certificates: %s", err)
 	}
-	if signingBundle == nil {
-		return nil, errors.New("CA info not found")
+	if len(issuers) == 0 {
+		return logical.ErrorResponse("could not fetch the CA certificate: backend must be configured with a CA certificate/key"), nil
 	}
 	colonSerial := strings.Replace(strings.ToLower(serial), "-", ":", -1)
-	if colonSerial == certutil.GetHexFormatted(signingBundle.Certificate.SerialNumber.Bytes(), ":") {
-		return logical.ErrorResponse("adding CA to CRL is not allowed"), nil
+	for _, issuer := range issuers {
+		if issuer.Bundle != nil && colonSerial == strings.ToLower(issuer.Bundle.SerialNumber) {
+			return logical.ErrorResponse("adding CA to CRL is not allowed"), nil
+		}
+	}
+
+	crlInfo, err := b.CRL(ctx, req.Storage)
+	if err != nil {
+		return nil, errwrap.Wrapf("error fetching CRL config information: {{err}}", err)
 	}
+	autoRebuild := crlInfo != nil && crlInfo.AutoRebuild
 
 	alreadyRevoked := false
 	var revInfo revocationInfo
@@ -117,15 +128,28 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 		if err != nil {
 			return nil, fmt.Errorf("error saving revoked certificate to new location")
 		}
+		b.ocspCache.Flush()
 
+		// When the CRL is rebuilt automatically, the revocation is recorded
+		// for the next delta CRL instead
+		if autoRebuild {
+			err = req.Storage.Put(ctx, &logical.StorageEntry{
+				Key: "delta-wal/" + normalizeSerial(serial),
+			})
+			if err != nil {
+				return nil, errwrap.Wrapf("error saving revocation for the delta CRL: {{err}}", err)
+			}
+		}
 	}
 
-	crlErr := buildCRL(ctx, b, req, false)
-	switch crlErr.(type) {
-	case errutil.UserError:
-		return logical.ErrorResponse(fmt.Sprintf("Error during CRL building: %s", crlErr)), nil
-	case errutil.InternalError:
-		return nil, errwrap.Wrapf("error encountered during CRL building: {{err}}", crlErr)
+	if !autoRebuild {
+		crlErr := buildCRL(ctx, b, req, false)
+		switch crlErr.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(fmt.Sprintf("Error during CRL building: %s", crlErr)), nil
+		case errutil.InternalError:
+			return nil, errwrap.Wrapf("error encountered during CRL building: {{err}}", crlErr)
+		}
 	}
 
 	resp := &logical.Response{
@@ -139,8 +163,58 @@ func revokeCert(ctx context.Context, b *backend, req *logical.Request, serial st
 	return resp, nil
 }
 
+// crlState holds the local state of CRL building
+type crlState struct {
+	// CRLNumbers holds the number of the last CRL, complete or delta, of
+	// each issuer
+	CRLNumbers map[string]int64 `json:"crl_numbers"`
+
+	// BaseCRLNumbers holds the number of the last complete CRL of each
+	// issuer, which its delta CRLs refer to
+	BaseCRLNumbers map[string]int64 `json:"base_crl_numbers"`
+
+	// NextUpdate is when the complete CRLs expire
+	NextUpdate time.Time `json:"next_update"`
+
+	// LastDeltaRebuild is when the delta CRLs were last built, and
+	// DeltaSerials how many revocations they hold
+	LastDeltaRebuild time.Time `json:"last_delta_rebuild"`
+	DeltaSerials     int       `json:"delta_serials"`
+}
+
+func fetchCRLState(ctx context.Context, s logical.Storage) (*crlState, error) {
+	entry, err := s.Get(ctx, "crl-state")
+	if err != nil {
+		return nil, err
+	}
+
+	state := &crlState{}
+	if entry != nil {
+		if err := entry.DecodeJSON(state); err != nil {
+			return nil, err
+		}
+	}
+	if state.CRLNumbers == nil {
+		state.CRLNumbers = map[string]int64{}
+	}
+	if state.BaseCRLNumbers == nil {
+		state.BaseCRLNumbers = map[string]int64{}
+	}
+
+	return state, nil
+}
+
+func writeCRLState(ctx context.Context, s logical.Storage, state *crlState) error {
+	entry, err := logical.StorageEntryJSON("crl-state", state)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
 // Builds a CRL by going through the list of revoked certificates and building
-// a new CRL with the stored revocation times and serial numbers.
+// a new CRL with the stored revocation times and serial numbers. Delta CRLs
+// are rebuilt along with it, as they refer to the new CRL.
 func buildCRL(ctx context.Context, b *backend, req *logical.Request, forceNew bool) error {
 	crlInfo, err := b.CRL(ctx, req.Storage)
 	if err != nil {
@@ -148,10 +222,7 @@ func buildCRL(ctx context.Context, b *backend, req *logical.Request, forceNew bo
 	}
 
 	crlLifetime := b.crlLifetime
-	var revokedCerts []pkix.RevokedCertificate
-	var revInfo revocationInfo
-	var revokedSerials []string
-
+	disabled := false
 	if crlInfo != nil {
 		if crlInfo.Expiry != "" {
 			crlDur, err := time.ParseDuration(crlInfo.Expiry)
@@ -165,38 +236,266 @@ func buildCRL(ctx context.Context, b *backend, req *logical.Request, forceNew bo
 			if !forceNew {
 				return nil
 			}
-			goto WRITE
+			disabled = true
 		}
 	}
 
-	revokedSerials, err = req.Storage.List(ctx, "revoked/")
+	// The revocations recorded for delta CRLs are listed before the revoked
+	// certificates, so that all of them are part of the new CRL
+	walSerials, err := req.Storage.List(ctx, "delta-wal/")
 	if err != nil {
-		return errutil.InternalError{Err: fmt.Sprintf("error fetching list of revoked certs: %s", err)}
+		return errutil.InternalError{Err: fmt.Sprintf("error fetching list of revocations for the delta CRL: %s", err)}
 	}
 
-	for _, serial := range revokedSerials {
-		revokedEntry, err := req.Storage.Get(ctx, "revoked/"+serial)
+	var revokedCerts []revokedCertificate
+	if !disabled {
+		revokedSerials, err := req.Storage.List(ctx, "revoked/")
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error fetching list of revoked certs: %s", err)}
+		}
+
+		revokedCerts, err = fetchRevokedCertificates(ctx, req.Storage, revokedSerials)
 		if err != nil {
-			return errutil.InternalError{Err: fmt.Sprintf("unable to fetch revoked cert with serial %s: %s", serial, err)}
+			return err
+		}
+	}
+
+	// Each issuer signs a CRL of the certificates it issued
+	issuers, err := fetchIssuers(ctx, req.Storage)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error fetching CA certificates: %s", err)}
+	}
+	if len(issuers) == 0 {
+		return errutil.UserError{Err: "could not fetch the CA certificate: backend must be configured with a CA certificate/key"}
+	}
+
+	state, err := fetchCRLState(ctx, req.Storage)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error fetching CRL state: %s", err)}
+	}
+
+	enableDelta := !disabled && crlInfo != nil && crlInfo.EnableDelta
+	var extraExtensions []pkix.Extension
+	if enableDelta {
+		urls, err := getURLs(ctx, req)
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("unable to fetch URL information: %s", err)}
+		}
+		if urls != nil && len(urls.DeltaCRLDistributionPoints) > 0 {
+			ext, err := certutil.DeltaCRLDistributionPointsExtension(urls.DeltaCRLDistributionPoints)
+			if err != nil {
+				return errutil.InternalError{Err: fmt.Sprintf("error marshaling delta CRL distribution points: %s", err)}
+			}
+			extraExtensions = append(extraExtensions, ext)
+		}
+	}
+
+	now := time.Now()
+	nextUpdate := now.Add(crlLifetime)
+	crlNumbers := map[string]int64{}
+	for _, issuer := range issuers {
+		signingBundle, caErr := fetchCAInfoByIssuer(ctx, req, issuer.ID)
+		switch caErr.(type) {
+		case errutil.UserError:
+			return errutil.UserError{Err: fmt.Sprintf("could not fetch the CA certificate: %s", caErr)}
+		case errutil.InternalError:
+			return errutil.InternalError{Err: fmt.Sprintf("error fetching CA certificate: %s", caErr)}
+		}
+
+		crlNumber := state.CRLNumbers[issuer.ID] + 1
+		crlBytes, err := createCRL(signingBundle, issuerRevokedCertificates(revokedCerts, signingBundle.Certificate), crlNumber, 0, now, nextUpdate, extraExtensions)
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error creating new CRL: %s", err)}
+		}
+
+		err = req.Storage.Put(ctx, &logical.StorageEntry{
+			Key:   "crls/" + issuer.ID,
+			Value: crlBytes,
+		})
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error storing CRL: %s", err)}
+		}
+		crlNumbers[issuer.ID] = crlNumber
+	}
+
+	// Issuers that no longer exist are dropped from the state
+	state.CRLNumbers = crlNumbers
+	state.BaseCRLNumbers = map[string]int64{}
+	for id, crlNumber := range crlNumbers {
+		state.BaseCRLNumbers[id] = crlNumber
+	}
+	state.NextUpdate = nextUpdate
+	if err := writeCRLState(ctx, req.Storage, state); err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error storing CRL state: %s", err)}
+	}
+
+	for _, serial := range walSerials {
+		if err := req.Storage.Delete(ctx, "delta-wal/"+serial); err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error removing revocation for the delta CRL: %s", err)}
+		}
+	}
+
+	if enableDelta {
+		return buildDeltaCRL(ctx, b, req, issuers, state, true)
+	}
+
+	// Delta CRLs referring to earlier CRLs must not be served
+	for _, issuer := range issuers {
+		if err := req.Storage.Delete(ctx, "delta-crls/"+issuer.ID); err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error removing delta CRL: %s", err)}
+		}
+	}
+
+	return nil
+}
+
+// buildDeltaCRL builds a delta CRL for each issuer, holding the certificates
+// revoked since its last complete CRL. Unless forced, delta CRLs are only
+// rebuilt if certificates were revoked since they were last built.
+func buildDeltaCRL(ctx context.Context, b *backend, req *logical.Request, issuers []*issuerEntry, state *crlState, force bool) error {
+	walSerials, err := req.Storage.List(ctx, "delta-wal/")
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error fetching list of revocations for the delta CRL: %s", err)}
+	}
+	if !force && len(walSerials) == state.DeltaSerials {
+		return nil
+	}
+
+	revokedCerts, err := fetchRevokedCertificates(ctx, req.Storage, walSerials)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, issuer := range issuers {
+		baseCRLNumber, ok := state.BaseCRLNumbers[issuer.ID]
+		if !ok {
+			// The issuer was added after the last complete CRL
+			continue
+		}
+
+		signingBundle, caErr := fetchCAInfoByIssuer(ctx, req, issuer.ID)
+		switch caErr.(type) {
+		case errutil.UserError:
+			return errutil.UserError{Err: fmt.Sprintf("could not fetch the CA certificate: %s", caErr)}
+		case errutil.InternalError:
+			return errutil.InternalError{Err: fmt.Sprintf("error fetching CA certificate: %s", caErr)}
+		}
+
+		// Delta CRLs share the numbering of complete CRLs, and expire with
+		// the complete CRL they refer to
+		crlNumber := state.CRLNumbers[issuer.ID] + 1
+		crlBytes, err := createCRL(signingBundle, issuerRevokedCertificates(revokedCerts, signingBundle.Certificate), crlNumber, baseCRLNumber, now, state.NextUpdate, nil)
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error creating new delta CRL: %s", err)}
+		}
+
+		err = req.Storage.Put(ctx, &logical.StorageEntry{
+			Key:   "delta-crls/" + issuer.ID,
+			Value: crlBytes,
+		})
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error storing delta CRL: %s", err)}
+		}
+		state.CRLNumbers[issuer.ID] = crlNumber
+	}
+
+	state.LastDeltaRebuild = now
+	state.DeltaSerials = len(walSerials)
+	if err := writeCRLState(ctx, req.Storage, state); err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error storing CRL state: %s", err)}
+	}
+
+	return nil
+}
+
+// periodicFunc rebuilds the CRLs of mounts that have automatic rebuilding
+// enabled: complete CRLs when they are within the grace period of their
+// expiry, and delta CRLs at the delta rebuild interval
+func (b *backend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	// CRLs are local to each cluster, so performance secondaries rebuild
+	// their own
+	if b.System().ReplicationState().HasState(consts.ReplicationDRSecondary | consts.ReplicationPerformanceStandby) {
+		return nil
+	}
+
+	crlInfo, err := b.CRL(ctx, req.Storage)
+	if err != nil {
+		return errwrap.Wrapf("error fetching CRL config information: {{err}}", err)
+	}
+	if crlInfo == nil || !crlInfo.AutoRebuild || crlInfo.Disable {
+		return nil
+	}
+
+	b.revokeStorageLock.Lock()
+	defer b.revokeStorageLock.Unlock()
+
+	state, err := fetchCRLState(ctx, req.Storage)
+	if err != nil {
+		return errwrap.Wrapf("error fetching CRL state: {{err}}", err)
+	}
+
+	now := time.Now()
+	gracePeriod, err := time.ParseDuration(crlInfo.AutoRebuildGracePeriod)
+	if err != nil {
+		return errwrap.Wrapf("error parsing auto_rebuild_grace_period: {{err}}", err)
+	}
+	if !now.Before(state.NextUpdate.Add(-gracePeriod)) {
+		err := buildCRL(ctx, b, req, false)
+		if _, ok := err.(errutil.UserError); ok {
+			// There is no CA yet
+			return nil
+		}
+		return err
+	}
+
+	if !crlInfo.EnableDelta {
+		return nil
+	}
+	deltaInterval, err := time.ParseDuration(crlInfo.DeltaRebuildInterval)
+	if err != nil {
+		return errwrap.Wrapf("error parsing delta_rebuild_interval: {{err}}", err)
+	}
+	if now.Before(state.LastDeltaRebuild.Add(deltaInterval)) {
+		return nil
+	}
+
+	issuers, err := fetchIssuers(ctx, req.Storage)
+	if err != nil {
+		return errwrap.Wrapf("error fetching CA certificates: {{err}}", err)
+	}
+	return buildDeltaCRL(ctx, b, req, issuers, state, false)
+}
+
+// fetchRevokedCertificates returns the certificates revoked with the given
+// serials along with their CRL entries
+func fetchRevokedCertificates(ctx context.Context, s logical.Storage, serials []string) ([]revokedCertificate, error) {
+	var revokedCerts []revokedCertificate
+	var revInfo revocationInfo
+
+	for _, serial := range serials {
+		revokedEntry, err := s.Get(ctx, "revoked/"+serial)
+		if err != nil {
+			return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch revoked cert with serial %s: %s", serial, err)}
 		}
 		if revokedEntry == nil {
-			return errutil.InternalError{Err: fmt.Sprintf("revoked certificate entry for serial %s is nil", serial)}
+			return nil, errutil.InternalError{Err: fmt.Sprintf("revoked certificate entry for serial %s is nil", serial)}
 		}
 		if revokedEntry.Value == nil || len(revokedEntry.Value) == 0 {
 			// TODO: In this case, remove it and continue? How likely is this to
 			// happen? Alternately, could skip it entirely, or could implement a
 			// delete function so that there is a way to remove these
-			return errutil.InternalError{Err: fmt.Sprintf("found revoked serial but actual certificate is empty")}
+			return nil, errutil.InternalError{Err: fmt.Sprintf("found revoked serial but actual certificate is empty")}
 		}
 
 		err = revokedEntry.DecodeJSON(&revInfo)
 		if err != nil {
-			return errutil.InternalError{Err: fmt.Sprintf("error decoding revocation entry for serial %s: %s", serial, err)}
+			return nil, errutil.InternalError{Err: fmt.Sprintf("error decoding revocation entry for serial %s: %s", serial, err)}
 		}
 
 		revokedCert, err := x509.ParseCertificate(revInfo.CertificateBytes)
 		if err != nil {
-			return errutil.InternalError{Err: fmt.Sprintf("unable to parse stored revoked certificate with serial %s: %s", serial, err)}
+			return nil, errutil.InternalError{Err: fmt.Sprintf("unable to parse stored revoked certificate with serial %s: %s", serial, err)}
 		}
 
 		// NOTE: We have to change this to UTC time because the CRL standard
@@ -209,30 +508,153 @@ func buildCRL(ctx context.Context, b *backend, req *logical.Request, forceNew bo
 		} else {
 			newRevCert.RevocationTime = time.Unix(revInfo.RevocationTime, 0).UTC()
 		}
-		revokedCerts = append(revokedCerts, newRevCert)
+		revokedCerts = append(revokedCerts, revokedCertificate{
+			cert:    revokedCert,
+			revoked: newRevCert,
+		})
 	}
 
-WRITE:
-	signingBundle, caErr := fetchCAInfo(ctx, req)
-	switch caErr.(type) {
-	case errutil.UserError:
-		return errutil.UserError{Err: fmt.Sprintf("could not fetch the CA certificate: %s", caErr)}
-	case errutil.InternalError:
-		return errutil.InternalError{Err: fmt.Sprintf("error fetching CA certificate: %s", caErr)}
+	return revokedCerts, nil
+}
+
+// revokedCertificate is a revoked certificate along with its CRL entry
+type revokedCertificate struct {
+	cert    *x509.Certificate
+	revoked pkix.RevokedCertificate
+}
+
+// issuerRevokedCertificates returns the CRL entries of the revoked
+// certificates issued by the given CA
+func issuerRevokedCertificates(revokedCerts []revokedCertificate, ca *x509.Certificate) []pkix.RevokedCertificate {
+	var issuerRevokedCerts []pkix.RevokedCertificate
+	for _, revoked := range revokedCerts {
+		if issuedBy(revoked.cert, ca) {
+			issuerRevokedCerts = append(issuerRevokedCerts, revoked.revoked)
+		}
 	}
+	return issuerRevokedCerts
+}
+
+var (
+	oidExtensionAuthorityKeyId    = asn1.ObjectIdentifier{2, 5, 29, 35}
+	oidExtensionCRLNumber         = asn1.ObjectIdentifier{2, 5, 29, 20}
+	oidExtensionDeltaCRLIndicator = asn1.ObjectIdentifier{2, 5, 29, 27}
+
+	oidSignatureSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSignatureECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidSignatureECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidSignatureECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+)
 
-	crlBytes, err := signingBundle.Certificate.CreateCRL(rand.Reader, signingBundle.PrivateKey, revokedCerts, time.Now(), time.Now().Add(crlLifetime))
+type authorityKeyId struct {
+	Id []byte `asn1:"optional,tag:0"`
+}
+
+// tbsCertificateList and certificateList mirror their pkix counterparts, but
+// keep the issuer as encoded in the CA certificate
+type tbsCertificateList struct {
+	Version             int `asn1:"optional,default:0"`
+	Signature           pkix.AlgorithmIdentifier
+	Issuer              asn1.RawValue
+	ThisUpdate          time.Time
+	NextUpdate          time.Time                 `asn1:"optional"`
+	RevokedCertificates []pkix.RevokedCertificate `asn1:"optional"`
+	Extensions          []pkix.Extension          `asn1:"tag:0,optional,explicit"`
+}
+
+type certificateList struct {
+	TBSCertList        asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+// createCRL signs a CRL numbered with the CRL number extension, which
+// x509.Certificate.CreateCRL does not support. A non-zero deltaBase makes it
+// a delta CRL of the complete CRL with that number.
+func createCRL(signingBundle *certutil.CAInfoBundle, revokedCerts []pkix.RevokedCertificate, number, deltaBase int64, now, nextUpdate time.Time, extraExtensions []pkix.Extension) ([]byte, error) {
+	sigAlgo, hashFunc, err := crlSignatureAlgorithm(signingBundle.PrivateKey)
 	if err != nil {
-		return errutil.InternalError{Err: fmt.Sprintf("error creating new CRL: %s", err)}
+		return nil, err
 	}
 
-	err = req.Storage.Put(ctx, &logical.StorageEntry{
-		Key:   "crl",
-		Value: crlBytes,
-	})
+	var extensions []pkix.Extension
+	if len(signingBundle.Certificate.SubjectKeyId) > 0 {
+		value, err := asn1.Marshal(authorityKeyId{Id: signingBundle.Certificate.SubjectKeyId})
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, pkix.Extension{Id: oidExtensionAuthorityKeyId, Value: value})
+	}
+
+	value, err := asn1.Marshal(big.NewInt(number))
 	if err != nil {
-		return errutil.InternalError{Err: fmt.Sprintf("error storing CRL: %s", err)}
+		return nil, err
 	}
+	extensions = append(extensions, pkix.Extension{Id: oidExtensionCRLNumber, Value: value})
 
-	return nil
+	if deltaBase != 0 {
+		value, err := asn1.Marshal(big.NewInt(deltaBase))
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, pkix.Extension{Id: oidExtensionDeltaCRLIndicator, Critical: true, Value: value})
+	}
+	extensions = append(extensions, extraExtensions...)
+
+	// Force revocation times to UTC per RFC 5280
+	revokedCertsUTC := make([]pkix.RevokedCertificate, len(revokedCerts))
+	for i, revoked := range revokedCerts {
+		revoked.RevocationTime = revoked.RevocationTime.UTC()
+		revokedCertsUTC[i] = revoked
+	}
+
+	tbsCertList := tbsCertificateList{
+		Version:             1,
+		Signature:           sigAlgo,
+		Issuer:              asn1.RawValue{FullBytes: signingBundle.Certificate.RawSubject},
+		ThisUpdate:          now.UTC(),
+		NextUpdate:          nextUpdate.UTC(),
+		RevokedCertificates: revokedCertsUTC,
+		Extensions:          extensions,
+	}
+	tbsCertListContents, err := asn1.Marshal(tbsCertList)
+	if err != nil {
+		return nil, err
+	}
+
+	h := hashFunc.New()
+	h.Write(tbsCertListContents)
+	signature, err := signingBundle.PrivateKey.Sign(rand.Reader, h.Sum(nil), hashFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(certificateList{
+		TBSCertList:        asn1.RawValue{FullBytes: tbsCertListContents},
+		SignatureAlgorithm: sigAlgo,
+		SignatureValue:     asn1.BitString{Bytes: signature, BitLength: len(signature) * 8},
+	})
+}
+
+// crlSignatureAlgorithm returns the algorithm CRLs are signed with, the same
+// that x509.Certificate.CreateCRL picks for the key
+func crlSignatureAlgorithm(key crypto.Signer) (pkix.AlgorithmIdentifier, crypto.Hash, error) {
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{
+			Algorithm:  oidSignatureSHA256WithRSA,
+			Parameters: asn1.NullRawValue,
+		}, crypto.SHA256, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P384():
+			return pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA384}, crypto.SHA384, nil
+		case elliptic.P521():
+			return pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA512}, crypto.SHA512, nil
+		default:
+			return pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA256}, crypto.SHA256, nil
+		}
+	default:
+		return pkix.AlgorithmIdentifier{}, 0, fmt.Errorf("unsupported CA key type %T", pub)
+	}
 }
@@ -286,3 +286,29 @@ func addCAIssueFields(fields map[string]*framework.FieldSchema) map[string]*fram
 
 	return fields
 }
+
+// addIssuerNameField adds the name field of endpoints creating an issuer
+func addIssuerNameField(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["issuer_name"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `Optional name of the new issuer, unique within
+the mount. Issuers can always be referred to by
+their ID.`,
+	}
+
+	return fields
+}
+
+// addIssuerRefField adds the field selecting the issuer of endpoints
+// signing certificates
+func addIssuerRefField(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["issuer_ref"] = &framework.FieldSchema{
+		Type:    framework.TypeString,
+		Default: defaultIssuerRef,
+		Description: `Reference to the issuer signing the certificate:
+"default", an issuer ID or an issuer name.
+Defaults to the default issuer of the mount.`,
+	}
+
+	return fields
+}
@@ -0,0 +1,400 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// defaultIssuerRef refers to the default issuer of the mount wherever an
+// issuer can be selected
+const defaultIssuerRef = "default"
+
+// issuerEntry is a CA certificate and private key able to issue
+// certificates. A mount can hold several of them, e.g. while rotating or
+// cross-signing its CA.
+type issuerEntry struct {
+	ID     string               `json:"id"`
+	Name   string               `json:"name"`
+	Bundle *certutil.CertBundle `json:"bundle"`
+}
+
+// issuersConfig holds the mount-wide issuer settings
+type issuersConfig struct {
+	DefaultIssuerID string `json:"default"`
+}
+
+func fetchIssuersConfig(ctx context.Context, s logical.Storage) (*issuersConfig, error) {
+	entry, err := s.Get(ctx, "config/issuers")
+	if err != nil {
+		return nil, err
+	}
+
+	var result issuersConfig
+	if entry == nil {
+		return &result, nil
+	}
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func writeIssuersConfig(ctx context.Context, s logical.Storage, config *issuersConfig) error {
+	entry, err := logical.StorageEntryJSON("config/issuers", config)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+func fetchIssuer(ctx context.Context, s logical.Storage, id string) (*issuerEntry, error) {
+	entry, err := s.Get(ctx, "issuers/"+id)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result issuerEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func writeIssuer(ctx context.Context, s logical.Storage, issuer *issuerEntry) error {
+	entry, err := logical.StorageEntryJSON("issuers/"+issuer.ID, issuer)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, entry)
+}
+
+// fetchIssuers returns all issuers of the mount
+func fetchIssuers(ctx context.Context, s logical.Storage) ([]*issuerEntry, error) {
+	ids, err := s.List(ctx, "issuers/")
+	if err != nil {
+		return nil, err
+	}
+
+	var issuers []*issuerEntry
+	for _, id := range ids {
+		issuer, err := fetchIssuer(ctx, s, id)
+		if err != nil {
+			return nil, err
+		}
+		if issuer != nil {
+			issuers = append(issuers, issuer)
+		}
+	}
+
+	return issuers, nil
+}
+
+// resolveIssuerRef returns the issuer referred to by "default", an issuer ID
+// or an issuer name, or nil if there is no such issuer
+func resolveIssuerRef(ctx context.Context, s logical.Storage, ref string) (*issuerEntry, error) {
+	if ref == "" || ref == defaultIssuerRef {
+		config, err := fetchIssuersConfig(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		if config.DefaultIssuerID == "" {
+			return nil, nil
+		}
+		return fetchIssuer(ctx, s, config.DefaultIssuerID)
+	}
+
+	issuer, err := fetchIssuer(ctx, s, ref)
+	if err != nil || issuer != nil {
+		return issuer, err
+	}
+
+	issuers, err := fetchIssuers(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	for _, issuer := range issuers {
+		if issuer.Name == ref {
+			return issuer, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// validateIssuerName checks that a name can be given to the issuer with the
+// given ID
+func validateIssuerName(ctx context.Context, s logical.Storage, name, id string) error {
+	if name == "" {
+		return nil
+	}
+	if name == defaultIssuerRef {
+		return errutil.UserError{Err: fmt.Sprintf("%q is reserved and cannot be used as an issuer name", defaultIssuerRef)}
+	}
+	if _, err := uuid.ParseUUID(name); err == nil {
+		return errutil.UserError{Err: "issuer names cannot be UUIDs"}
+	}
+
+	issuers, err := fetchIssuers(ctx, s)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error fetching issuers: %v", err)}
+	}
+	for _, issuer := range issuers {
+		if issuer.Name == name && issuer.ID != id {
+			return errutil.UserError{Err: fmt.Sprintf("issuer name %q is already in use", name)}
+		}
+	}
+
+	return nil
+}
+
+// importIssuer stores the given CA certificate and key as an issuer, along
+// with its certificate so that it can be fetched by serial number. The
+// issuer becomes the default if the mount has none. If the certificate is
+// already held by an issuer, that issuer is returned instead.
+func importIssuer(ctx context.Context, s logical.Storage, parsedBundle *certutil.ParsedCertBundle, name string) (*issuerEntry, bool, error) {
+	issuers, err := fetchIssuers(ctx, s)
+	if err != nil {
+		return nil, false, errutil.InternalError{Err: fmt.Sprintf("error fetching issuers: %v", err)}
+	}
+	for _, issuer := range issuers {
+		existing, err := issuer.Bundle.ToParsedCertBundle()
+		if err != nil {
+			return nil, false, errutil.InternalError{Err: fmt.Sprintf("error parsing issuer %s: %v", issuer.ID, err)}
+		}
+		if bytes.Equal(existing.CertificateBytes, parsedBundle.CertificateBytes) {
+			return issuer, true, nil
+		}
+	}
+
+	if err := validateIssuerName(ctx, s, name, ""); err != nil {
+		return nil, false, err
+	}
+
+	cb, err := parsedBundle.ToCertBundle()
+	if err != nil {
+		return nil, false, errutil.InternalError{Err: fmt.Sprintf("error converting raw values into cert bundle: %v", err)}
+	}
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, false, errutil.InternalError{Err: fmt.Sprintf("error generating issuer ID: %v", err)}
+	}
+
+	issuer := &issuerEntry{
+		ID:     id,
+		Name:   name,
+		Bundle: cb,
+	}
+	if err := writeIssuer(ctx, s, issuer); err != nil {
+		return nil, false, errutil.InternalError{Err: fmt.Sprintf("error storing issuer: %v", err)}
+	}
+
+	// Also store the certificate by serial number, so it can be fetched
+	err = s.Put(ctx, &logical.StorageEntry{
+		Key:   "certs/" + normalizeSerial(cb.SerialNumber),
+		Value: parsedBundle.CertificateBytes,
+	})
+	if err != nil {
+		return nil, false, errutil.InternalError{Err: fmt.Sprintf("unable to store certificate locally: %v", err)}
+	}
+
+	config, err := fetchIssuersConfig(ctx, s)
+	if err != nil {
+		return nil, false, errutil.InternalError{Err: fmt.Sprintf("error fetching issuers configuration: %v", err)}
+	}
+	if config.DefaultIssuerID == "" {
+		config.DefaultIssuerID = issuer.ID
+		if err := writeIssuersConfig(ctx, s, config); err != nil {
+			return nil, false, errutil.InternalError{Err: fmt.Sprintf("error storing issuers configuration: %v", err)}
+		}
+	}
+
+	return issuer, false, nil
+}
+
+// addIssuerResponseData adds the ID and name of a newly set issuer to a
+// response, warning if the issuer is not the default
+func addIssuerResponseData(ctx context.Context, s logical.Storage, resp *logical.Response, issuer *issuerEntry) (*logical.Response, error) {
+	if resp == nil {
+		resp = &logical.Response{}
+	}
+	if resp.Data == nil {
+		resp.Data = map[string]interface{}{}
+	}
+	resp.Data["issuer_id"] = issuer.ID
+	resp.Data["issuer_name"] = issuer.Name
+
+	config, err := fetchIssuersConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	if config.DefaultIssuerID != issuer.ID {
+		resp.AddWarning(fmt.Sprintf("The issuer %s is not the default issuer of this mount; update config/issuers to make it the default.", issuer.ID))
+	}
+
+	return resp, nil
+}
+
+// publicKeysEqual compares two public keys through their DER encoding
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	aBytes, err := x509.MarshalPKIXPublicKey(a)
+	if err != nil {
+		return false
+	}
+	bBytes, err := x509.MarshalPKIXPublicKey(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aBytes, bBytes)
+}
+
+// issuedBy checks whether a certificate was issued by the given CA, based on
+// its issuer name and authority key identifier
+func issuedBy(cert, ca *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, ca.RawSubject) {
+		return false
+	}
+	if len(cert.AuthorityKeyId) > 0 && len(ca.SubjectKeyId) > 0 {
+		return bytes.Equal(cert.AuthorityKeyId, ca.SubjectKeyId)
+	}
+	return true
+}
+
+// initialize migrates the single CA bundle stored by earlier versions to an
+// issuer
+func (b *backend) initialize(ctx context.Context, req *logical.InitializationRequest) error {
+	// on standbys and DR secondaries we do not want to run any kind of upgrade logic
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby | consts.ReplicationDRSecondary) {
+		return nil
+	}
+
+	// Migrate only if we are either a local mount, or not a replicated
+	// performance secondary
+	if !b.System().LocalMount() && b.System().ReplicationState().HasState(consts.ReplicationPerformanceSecondary) {
+		return nil
+	}
+
+	migrated, err := migrateLegacyCABundle(ctx, b, req.Storage)
+	if err != nil {
+		b.Logger().Error("error migrating the CA bundle to an issuer", "error", err)
+		return err
+	}
+	if migrated {
+		b.Logger().Info("migrated the CA bundle to an issuer")
+	}
+
+	return nil
+}
+
+// migrateLegacyCABundle moves the bundle stored at config/ca_bundle to an
+// issuer, or to the pending key if it only holds the key of an intermediate
+// CA awaiting its certificate
+func migrateLegacyCABundle(ctx context.Context, b *backend, s logical.Storage) (bool, error) {
+	entry, err := s.Get(ctx, "config/ca_bundle")
+	if err != nil {
+		return false, err
+	}
+	if entry == nil {
+		return false, nil
+	}
+
+	var cb certutil.CertBundle
+	if err := entry.DecodeJSON(&cb); err != nil {
+		return false, errwrap.Wrapf("error decoding CA bundle: {{err}}", err)
+	}
+
+	if strings.TrimSpace(cb.Certificate) == "" {
+		entry.Key = "config/pending_key"
+		if err := s.Put(ctx, entry); err != nil {
+			return false, err
+		}
+	} else {
+		parsedBundle, err := cb.ToParsedCertBundle()
+		if err != nil {
+			return false, errwrap.Wrapf("error parsing CA bundle: {{err}}", err)
+		}
+		if _, _, err := importIssuer(ctx, s, parsedBundle, ""); err != nil {
+			return false, err
+		}
+	}
+
+	if err := s.Delete(ctx, "config/ca_bundle"); err != nil {
+		return false, err
+	}
+	if err := s.Delete(ctx, "ca"); err != nil {
+		return false, err
+	}
+	b.ocspCache.Flush()
+
+	if err := buildCRL(ctx, b, &logical.Request{Storage: s}, true); err != nil {
+		if _, ok := err.(errutil.UserError); !ok {
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// fetchIssuerCertOrCRL returns the DER encoded certificate ("ca"), CRL ("crl")
+// or delta CRL ("delta-crl") of an issuer, or nil if there is no such issuer
+func fetchIssuerCertOrCRL(ctx context.Context, req *logical.Request, issuerRef, which string) (*logical.StorageEntry, error) {
+	issuer, err := resolveIssuerRef(ctx, req.Storage, issuerRef)
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("error fetching issuer %s: %v", issuerRef, err)}
+	}
+	if issuer == nil || issuer.Bundle == nil {
+		return nil, nil
+	}
+
+	if which == "ca" {
+		parsedBundle, err := issuer.Bundle.ToParsedCertBundle()
+		if err != nil {
+			return nil, errutil.InternalError{Err: fmt.Sprintf("error parsing issuer %s: %v", issuer.ID, err)}
+		}
+		return &logical.StorageEntry{
+			Key:   "issuers/" + issuer.ID,
+			Value: parsedBundle.CertificateBytes,
+		}, nil
+	}
+
+	if which == "delta-crl" {
+		deltaEntry, err := req.Storage.Get(ctx, "delta-crls/"+issuer.ID)
+		if err != nil {
+			return nil, errutil.InternalError{Err: fmt.Sprintf("error fetching delta CRL of issuer %s: %v", issuer.ID, err)}
+		}
+		return deltaEntry, nil
+	}
+
+	crlEntry, err := req.Storage.Get(ctx, "crls/"+issuer.ID)
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("error fetching CRL of issuer %s: %v", issuer.ID, err)}
+	}
+	if crlEntry == nil && (issuerRef == "" || issuerRef == defaultIssuerRef) {
+		// The CRL may not have been rebuilt since the CA bundle was migrated
+		// to an issuer, e.g. on performance secondaries
+		crlEntry, err = req.Storage.Get(ctx, "crl")
+		if err != nil {
+			return nil, errutil.InternalError{Err: fmt.Sprintf("error fetching CRL: %v", err)}
+		}
+	}
+	if crlEntry != nil && len(crlEntry.Value) == 0 {
+		return nil, nil
+	}
+
+	return crlEntry, nil
+}
@@ -0,0 +1,800 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// acmePathPrefix matches both the default directory at acme/ and the
+// directories of roles at acme/roles/<role>/
+var acmePathPrefix = "acme/(roles/" + framework.GenericNameRegex("role") + "/)?"
+
+func pathsACME(b *backend) []*framework.Path {
+	return []*framework.Path{
+		buildPathACME(b, "directory", logical.ReadOperation, b.pathACMEDirectory, pathACMEDirectoryHelpSyn),
+		buildPathACME(b, "new-nonce", logical.ReadOperation, b.pathACMENewNonce, pathACMENewNonceHelpSyn),
+		buildPathACME(b, "new-account", logical.UpdateOperation, b.pathACMENewAccount, pathACMENewAccountHelpSyn),
+		buildPathACME(b, "account/"+framework.GenericNameRegex("account_id"), logical.UpdateOperation, b.pathACMEAccount, pathACMEAccountHelpSyn),
+		buildPathACME(b, "account/"+framework.GenericNameRegex("account_id")+"/orders", logical.UpdateOperation, b.pathACMEAccountOrders, pathACMEAccountOrdersHelpSyn),
+		buildPathACME(b, "new-order", logical.UpdateOperation, b.pathACMENewOrder, pathACMENewOrderHelpSyn),
+		buildPathACME(b, "order/"+framework.GenericNameRegex("order_id"), logical.UpdateOperation, b.pathACMEOrder, pathACMEOrderHelpSyn),
+		buildPathACME(b, "order/"+framework.GenericNameRegex("order_id")+"/finalize", logical.UpdateOperation, b.pathACMEFinalize, pathACMEFinalizeHelpSyn),
+		buildPathACME(b, "order/"+framework.GenericNameRegex("order_id")+"/cert", logical.UpdateOperation, b.pathACMECertificate, pathACMECertificateHelpSyn),
+		buildPathACME(b, "authorization/"+framework.GenericNameRegex("authorization_id"), logical.UpdateOperation, b.pathACMEAuthorization, pathACMEAuthorizationHelpSyn),
+		buildPathACME(b, "challenge/"+framework.GenericNameRegex("authorization_id")+"/(?P<challenge_type>http-01|dns-01)", logical.UpdateOperation, b.pathACMEChallenge, pathACMEChallengeHelpSyn),
+		buildPathACME(b, "revoke-cert", logical.UpdateOperation, b.pathACMERevokeCert, pathACMERevokeCertHelpSyn),
+	}
+}
+
+func buildPathACME(b *backend, pattern string, op logical.Operation, callback acmeOperation, helpSyn string) *framework.Path {
+	return &framework.Path{
+		Pattern: acmePathPrefix + pattern,
+		Fields: map[string]*framework.FieldSchema{
+			"role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `The role of the directory; the default role if empty`,
+			},
+			"account_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `The ID of the account`,
+			},
+			"order_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `The ID of the order`,
+			},
+			"authorization_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `The ID of the authorization`,
+			},
+			"challenge_type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `The type of the challenge`,
+			},
+			"protected": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `The protected header of the JWS`,
+			},
+			"payload": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `The payload of the JWS`,
+			},
+			"signature": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `The signature of the JWS`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			op: b.acmeWrap(callback),
+		},
+
+		HelpSynopsis:    helpSyn,
+		HelpDescription: pathACMEHelpDesc,
+	}
+}
+
+func (b *backend) pathACMEDirectory(ctx context.Context, req *logical.Request, data *framework.FieldData, acmeCtx *acmeContext) (*logical.Response, error) {
+	return acmeResponse(http.StatusOK, map[string]interface{}{
+		"newNonce":   acmeCtx.url("new-nonce"),
+		"newAccount": acmeCtx.url("new-account"),
+		"newOrder":   acmeCtx.url("new-order"),
+		"revokeCert": acmeCtx.url("revoke-cert"),
+		"meta": map[string]interface{}{
+			"externalAccountRequired": false,
+		},
+	})
+}
+
+func (b *backend) pathACMENewNonce(ctx context.Context, req *logical.Request, data *framework.FieldData, acmeCtx *acmeContext) (*logical.Response, error) {
+	// The nonce itself is added to every ACME response
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode: http.StatusNoContent,
+		},
+	}, nil
+}
+
+func acmeAccountResponse(acmeCtx *acmeContext, account *acmeAccount, status int) (*logical.Response, error) {
+	resp, err := acmeResponse(status, map[string]interface{}{
+		"status":  account.Status,
+		"contact": account.Contact,
+		"orders":  acmeCtx.url("account/" + account.ID + "/orders"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.Headers["Location"] = []string{acmeCtx.url("account/" + account.ID)}
+	return resp, nil
+}
+
+func validateACMEContact(contact []string) error {
+	for _, c := range contact {
+		if !strings.HasPrefix(c, "mailto:") {
+			return newACMEError("unsupportedContact", http.StatusBadRequest, "unsupported contact %q: only mailto contacts are supported", c)
+		}
+	}
+	return nil
+}
+
+func (b *backend) pathACMENewAccount(ctx context.Context, req *logical.Request, data *framework.FieldData, acmeCtx *acmeContext) (*logical.Response, error) {
+	acmeReq, err := b.acmeVerifyRequest(ctx, req, data, acmeCtx, acmeKeyEmbedded)
+	if err != nil {
+		return nil, err
+	}
+	var payload struct {
+		Contact            []string `json:"contact"`
+		OnlyReturnExisting bool     `json:"onlyReturnExisting"`
+	}
+	if _, err := acmeReq.decodePayload(&payload); err != nil {
+		return nil, err
+	}
+
+	thumbprint, err := acmeThumbprint(acmeReq.jwk)
+	if err != nil {
+		return nil, newACMEError("badPublicKey", http.StatusBadRequest, "error computing the thumbprint of the key: %s", err)
+	}
+
+	b.acmeAccountLock.Lock()
+	defer b.acmeAccountLock.Unlock()
+
+	var accountID string
+	if _, err := fetchACMEEntry(ctx, req.Storage, acmeAccountKeyPath(thumbprint), &accountID); err != nil {
+		return nil, err
+	}
+	if accountID != "" {
+		account, err := fetchACMEAccount(ctx, req.Storage, accountID)
+		if err != nil {
+			return nil, err
+		}
+		if account != nil {
+			return acmeAccountResponse(acmeCtx, account, http.StatusOK)
+		}
+	}
+	if payload.OnlyReturnExisting {
+		return nil, newACMEError("accountDoesNotExist", http.StatusBadRequest, "no account exists for this key")
+	}
+	if err := validateACMEContact(payload.Contact); err != nil {
+		return nil, err
+	}
+
+	accountID, err = uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	account := &acmeAccount{
+		ID:         accountID,
+		Key:        acmeReq.jwk,
+		Thumbprint: thumbprint,
+		Status:     acmeStatusValid,
+		Contact:    payload.Contact,
+		CreatedAt:  time.Now(),
+	}
+	if err := writeACMEEntry(ctx, req.Storage, acmeAccountPath(accountID), account); err != nil {
+		return nil, err
+	}
+	if err := writeACMEEntry(ctx, req.Storage, acmeAccountKeyPath(thumbprint), accountID); err != nil {
+		return nil, err
+	}
+
+	return acmeAccountResponse(acmeCtx, account, http.StatusCreated)
+}
+
+func (b *backend) pathACMEAccount(ctx context.Context, req *logical.Request, data *framework.FieldData, acmeCtx *acmeContext) (*logical.Response, error) {
+	acmeReq, err := b.acmeVerifyRequest(ctx, req, data, acmeCtx, acmeKeyAccount)
+	if err != nil {
+		return nil, err
+	}
+	account := acmeReq.account
+	if account.ID != data.Get("account_id").(string) {
+		return nil, newACMEError("unauthorized", http.StatusUnauthorized, "the request is not signed by the key of the account")
+	}
+
+	var payload struct {
+		Contact []string `json:"contact"`
+		Status  string   `json:"status"`
+	}
+	update, err := acmeReq.decodePayload(&payload)
+	if err != nil {
+		return nil, err
+	}
+	if update {
+		if payload.Contact != nil {
+			if err := validateACMEContact(payload.Contact); err != nil {
+				return nil, err
+			}
+			account.Contact = payload.Contact
+		}
+		switch payload.Status {
+		case "":
+		case acmeStatusDeactivated:
+			account.Status = acmeStatusDeactivated
+		default:
+			return nil, newACMEError("malformed", http.StatusBadRequest, "the status of an account can only be set to %q", acmeStatusDeactivated)
+		}
+		if err := writeACMEEntry(ctx, req.Storage, acmeAccountPath(account.ID), account); err != nil {
+			return nil, err
+		}
+	}
+
+	return acmeAccountResponse(acmeCtx, account, http.StatusOK)
+}
+
+func (b *backend) pathACMEAccountOrders(ctx context.Context, req *logical.Request, data *framework.FieldData, acmeCtx *acmeContext) (*logical.Response, error) {
+	acmeReq, err := b.acmeVerifyRequest(ctx, req, data, acmeCtx, acmeKeyAccount)
+	if err != nil {
+		return nil, err
+	}
+	if acmeReq.account.ID != data.Get("account_id").(string) {
+		return nil, newACMEError("unauthorized", http.StatusUnauthorized, "the request is not signed by the key of the account")
+	}
+
+	orderIDs, err := req.Storage.List(ctx, acmeAccountPath(acmeReq.account.ID)+"/orders/")
+	if err != nil {
+		return nil, err
+	}
+	orders := []string{}
+	for _, orderID := range orderIDs {
+		order, err := fetchACMEOrder(ctx, req.Storage, acmeReq.account.ID, orderID)
+		if err != nil {
+			return nil, err
+		}
+		if order == nil || order.Directory != acmeCtx.directory {
+			continue
+		}
+		orders = append(orders, acmeCtx.url("order/"+orderID))
+	}
+
+	return acmeResponse(http.StatusOK, map[string]interface{}{
+		"orders": orders,
+	})
+}
+
+func (b *backend) pathACMENewOrder(ctx context.Context, req *logical.Request, data *framework.FieldData, acmeCtx *acmeContext) (*logical.Response, error) {
+	acmeReq, err := b.acmeVerifyRequest(ctx, req, data, acmeCtx, acmeKeyAccount)
+	if err != nil {
+		return nil, err
+	}
+	var payload struct {
+		Identifiers []acmeIdentifier `json:"identifiers"`
+		NotBefore   string           `json:"notBefore"`
+		NotAfter    string           `json:"notAfter"`
+	}
+	if ok, err := acmeReq.decodePayload(&payload); err != nil {
+		return nil, err
+	} else if !ok || len(payload.Identifiers) == 0 {
+		return nil, newACMEError("malformed", http.StatusBadRequest, "the order must have at least one identifier")
+	}
+	if payload.NotBefore != "" || payload.NotAfter != "" {
+		return nil, newACMEError("malformed", http.StatusBadRequest, "notBefore and notAfter are not supported; the validity of certificates is set by the role")
+	}
+
+	var names []string
+	for _, identifier := range payload.Identifiers {
+		if identifier.Type != "dns" {
+			return nil, newACMEError("unsupportedIdentifier", http.StatusBadRequest, "unsupported identifier type %q", identifier.Type)
+		}
+		name := strings.ToLower(strings.TrimSpace(identifier.Value))
+		if name == "" || strings.Contains(name, "@") || strings.Contains(strings.TrimPrefix(name, "*."), "*") {
+			return nil, newACMEError("rejectedIdentifier", http.StatusBadRequest, "invalid DNS identifier %q", identifier.Value)
+		}
+		if !strutil.StrListContains(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if badName := validateNames(&inputBundle{role: acmeCtx.role, req: req}, names); badName != "" {
+		return nil, newACMEError("rejectedIdentifier", http.StatusBadRequest, "name %q not allowed by this role", badName)
+	}
+
+	orderID, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	order := &acmeOrder{
+		ID:        orderID,
+		Status:    acmeStatusPending,
+		Expires:   time.Now().Add(acmeOrderLifetime).UTC().Truncate(time.Second),
+		Directory: acmeCtx.directory,
+	}
+	for _, name := range names {
+		authz := &acmeAuthorization{
+			Identifier: acmeIdentifier{
+				Type:  "dns",
+				Value: strings.TrimPrefix(name, "*."),
+			},
+			Wildcard: strings.HasPrefix(name, "*."),
+			Status:   acmeStatusPending,
+			Expires:  order.Expires,
+		}
+		authz.ID, err = uuid.GenerateUUID()
+		if err != nil {
+			return nil, err
+		}
+
+		// Control of a wildcard domain can only be proven through DNS
+		challengeTypes := []string{acmeChallengeHTTP01, acmeChallengeDNS01}
+		if authz.Wildcard {
+			challengeTypes = []string{acmeChallengeDNS01}
+		}
+		for _, challengeType := range challengeTypes {
+			token, err := acmeRandomToken()
+			if err != nil {
+				return nil, err
+			}
+			authz.Challenges = append(authz.Challenges, &acmeChallenge{
+				Type:   challengeType,
+				Token:  token,
+				Status: acmeStatusPending,
+			})
+		}
+
+		if err := writeACMEEntry(ctx, req.Storage, acmeAuthorizationPath(acmeReq.account.ID, authz.ID), authz); err != nil {
+			return nil, err
+		}
+		order.Identifiers = append(order.Identifiers, acmeIdentifier{Type: "dns", Value: name})
+		order.AuthorizationIDs = append(order.AuthorizationIDs, authz.ID)
+	}
+	if err := writeACMEEntry(ctx, req.Storage, acmeOrderPath(acmeReq.account.ID, orderID), order); err != nil {
+		return nil, err
+	}
+
+	return acmeOrderResponse(acmeCtx, order, http.StatusCreated)
+}
+
+func acmeOrderResponse(acmeCtx *acmeContext, order *acmeOrder, status int) (*logical.Response, error) {
+	authorizations := make([]string, 0, len(order.AuthorizationIDs))
+	for _, authzID := range order.AuthorizationIDs {
+		authorizations = append(authorizations, acmeCtx.url("authorization/"+authzID))
+	}
+	body := map[string]interface{}{
+		"status":         order.Status,
+		"expires":        order.Expires.Format(time.RFC3339),
+		"identifiers":    order.Identifiers,
+		"authorizations": authorizations,
+		"finalize":       acmeCtx.url("order/" + order.ID + "/finalize"),
+	}
+	if order.Status == acmeStatusValid {
+		body["certificate"] = acmeCtx.url("order/" + order.ID + "/cert")
+	}
+
+	resp, err := acmeResponse(status, body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Headers["Location"] = []string{acmeCtx.url("order/" + order.ID)}
+	return resp, nil
+}
+
+// acmeFetchOrder returns the order of the account named in the request,
+// with its status brought up to date with its authorizations
+func (b *backend) acmeFetchOrder(ctx context.Context, req *logical.Request, data *framework.FieldData, acmeCtx *acmeContext, account *acmeAccount) (*acmeOrder, error) {
+	order, err := fetchACMEOrder(ctx, req.Storage, account.ID, data.Get("order_id").(string))
+	if err != nil {
+		return nil, err
+	}
+	if order == nil || order.Directory != acmeCtx.directory {
+		return nil, newACMEError("malformed", http.StatusNotFound, "unknown order")
+	}
+	if order.Status != acmeStatusPending {
+		return order, nil
+	}
+
+	status := acmeStatusReady
+	for _, authzID := range order.AuthorizationIDs {
+		authz, err := fetchACMEAuthorization(ctx, req.Storage, account.ID, authzID)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case authz == nil || (authz.Status != acmeStatusPending && authz.Status != acmeStatusValid):
+			status = acmeStatusInvalid
+		case authz.Status == acmeStatusPending && status == acmeStatusReady:
+			status = acmeStatusPending
+		}
+	}
+	if time.Now().After(order.Expires) {
+		status = acmeStatusInvalid
+	}
+	if status != order.Status {
+		order.Status = status
+		if err := writeACMEEntry(ctx, req.Storage, acmeOrderPath(account.ID, order.ID), order); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+func (b *backend) pathACMEOrder(ctx context.Context, req *logical.Request, data *framework.FieldData, acmeCtx *acmeContext) (*logical.Response, error) {
+	acmeReq, err := b.acmeVerifyRequest(ctx, req, data, acmeCtx, acmeKeyAccount)
+	if err != nil {
+		return nil, err
+	}
+	order, err := b.acmeFetchOrder(ctx, req, data, acmeCtx, acmeReq.account)
+	if err != nil {
+		return nil, err
+	}
+	return acmeOrderResponse(acmeCtx, order, http.StatusOK)
+}
+
+func (b *backend) pathACMEFinalize(ctx context.Context, req *logical.Request, data *framework.FieldData, acmeCtx *acmeContext) (*logical.Response, error) {
+	acmeReq, err := b.acmeVerifyRequest(ctx, req, data, acmeCtx, acmeKeyAccount)
+	if err != nil {
+		return nil, err
+	}
+	order, err := b.acmeFetchOrder(ctx, req, data, acmeCtx, acmeReq.account)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != acmeStatusReady {
+		return nil, newACMEError("orderNotReady", http.StatusForbidden, "the order is %s", order.Status)
+	}
+
+	var payload struct {
+		CSR string `json:"csr"`
+	}
+	if _, err := acmeReq.decodePayload(&payload); err != nil {
+		return nil, err
+	}
+	csrBytes, err := base64.RawURLEncoding.DecodeString(payload.CSR)
+	if err != nil {
+		return nil, newACMEError("badCSR", http.StatusBadRequest, "the CSR could not be decoded: %s", err)
+	}
+	csr, err := x509.ParseCertificateRequest(csrBytes)
+	if err != nil {
+		return nil, newACMEError("badCSR", http.StatusBadRequest, "the CSR could not be parsed: %s", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, newACMEError("badCSR", http.StatusBadRequest, "invalid CSR signature: %s", err)
+	}
+	if len(csr.IPAddresses) != 0 || len(csr.EmailAddresses) != 0 || len(csr.URIs) != 0 {
+		return nil, newACMEError("badCSR", http.StatusBadRequest, "the CSR can only request DNS names")
+	}
+
+	// The CSR must request exactly the identifiers of the order
+	var names []string
+	for _, name := range append([]string{csr.Subject.CommonName}, csr.DNSNames...) {
+		name = strings.ToLower(name)
+		if name != "" && !strutil.StrListContains(names, name) {
+			names = append(names, name)
+		}
+	}
+	var orderNames []string
+	for _, identifier := range order.Identifiers {
+		orderNames = append(orderNames, identifier.Value)
+	}
+	if !strutil.EquivalentSlices(names, orderNames) {
+		return nil, newACMEError("badCSR", http.StatusBadRequest, "the CSR does not request the identifiers of the order")
+	}
+
+	commonName := strings.ToLower(csr.Subject.CommonName)
+	if commonName == "" {
+		commonName = orderNames[0]
+	}
+	var altNames []string
+	for _, name := range orderNames {
+		if name != commonName {
+			altNames = append(altNames, name)
+		}
+	}
+	role := *acmeCtx.role
+	role.UseCSRCommonName = false
+	role.UseCSRSANs = false
+	input := &inputBundle{
+		req:  req,
+		role: &role,
+		apiData: &framework.FieldData{
+			Raw: map[string]interface{}{
+				"csr":         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrBytes})),
+				"common_name": commonName,
+				"alt_names":   strings.Join(altNames, ","),
+			},
+			Schema: pathSign(b).Fields,
+		},
+	}
+
+	signingBundle, err := fetchCAInfoByIssuer(ctx, req, role.IssuerRef)
+	if err != nil {
+		return nil, errwrap.Wrapf("error fetching the CA certificate: {{err}}", err)
+	}
+	parsedBundle, err := signCert(b, input, signingBundle, false, false)
+	if err != nil {
+		if _, ok := err.(errutil.UserError); ok {
+			return nil, newACMEError("badCSR", http.StatusBadRequest, err.Error())
+		}
+		return nil, err
+	}
+	cb, err := parsedBundle.ToCertBundle()
+	if err != nil {
+		return nil, errwrap.Wrapf("error converting raw cert bundle to cert bundle: {{err}}", err)
+	}
+
+	if !role.NoStore {
+		err = req.Storage.Put(ctx, &logical.StorageEntry{
+			Key:   "certs/" + normalizeSerial(cb.SerialNumber),
+			Value: parsedBundle.CertificateBytes,
+		})
+		if err != nil {
+			return nil, errwrap.Wrapf("unable to store certificate locally: {{err}}", err)
+		}
+	}
+
+	order.Status = acmeStatusValid
+	order.CertificateSerial = cb.SerialNumber
+	order.CertificateChain = strings.Join(append([]string{cb.Certificate}, cb.CAChain...), "\n")
+	order.CertificateExpires = parsedBundle.Certificate.NotAfter
+	if err := writeACMEEntry(ctx, req.Storage, acmeOrderPath(acmeReq.account.ID, order.ID), order); err != nil {
+		return nil, err
+	}
+
+	return acmeOrderResponse(acmeCtx, order, http.StatusOK)
+}
+
+func (b *backend) pathACMECertificate(ctx context.Context, req *logical.Request, data *framework.FieldData, acmeCtx *acmeContext) (*logical.Response, error) {
+	acmeReq, err := b.acmeVerifyRequest(ctx, req, data, acmeCtx, acmeKeyAccount)
+	if err != nil {
+		return nil, err
+	}
+	order, err := b.acmeFetchOrder(ctx, req, data, acmeCtx, acmeReq.account)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != acmeStatusValid {
+		return nil, newACMEError("malformed", http.StatusNotFound, "the order has no certificate")
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/pem-certificate-chain",
+			logical.HTTPRawBody:     []byte(order.CertificateChain + "\n"),
+			logical.HTTPStatusCode:  http.StatusOK,
+		},
+	}, nil
+}
+
+func acmeChallengeBody(acmeCtx *acmeContext, authz *acmeAuthorization, chal *acmeChallenge) map[string]interface{} {
+	body := map[string]interface{}{
+		"type":   chal.Type,
+		"url":    acmeCtx.url("challenge/" + authz.ID + "/" + chal.Type),
+		"token":  chal.Token,
+		"status": chal.Status,
+	}
+	if chal.Status == acmeStatusValid {
+		body["validated"] = chal.Validated.Format(time.RFC3339)
+	}
+	if chal.Error != nil {
+		body["error"] = chal.Error
+	}
+	return body
+}
+
+// acmeFetchAuthorization returns the authorization of the account named in
+// the request, expiring it if it is past its expiration
+func (b *backend) acmeFetchAuthorization(ctx context.Context, req *logical.Request, data *framework.FieldData, account *acmeAccount) (*acmeAuthorization, error) {
+	authz, err := fetchACMEAuthorization(ctx, req.Storage, account.ID, data.Get("authorization_id").(string))
+	if err != nil {
+		return nil, err
+	}
+	if authz == nil {
+		return nil, newACMEError("malformed", http.StatusNotFound, "unknown authorization")
+	}
+	if (authz.Status == acmeStatusPending || authz.Status == acmeStatusValid) && time.Now().After(authz.Expires) {
+		authz.Status = acmeStatusExpired
+		if err := writeACMEEntry(ctx, req.Storage, acmeAuthorizationPath(account.ID, authz.ID), authz); err != nil {
+			return nil, err
+		}
+	}
+	return authz, nil
+}
+
+func (b *backend) pathACMEAuthorization(ctx context.Context, req *logical.Request, data *framework.FieldData, acmeCtx *acmeContext) (*logical.Response, error) {
+	acmeReq, err := b.acmeVerifyRequest(ctx, req, data, acmeCtx, acmeKeyAccount)
+	if err != nil {
+		return nil, err
+	}
+	authz, err := b.acmeFetchAuthorization(ctx, req, data, acmeReq.account)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload struct {
+		Status string `json:"status"`
+	}
+	update, err := acmeReq.decodePayload(&payload)
+	if err != nil {
+		return nil, err
+	}
+	if update {
+		if payload.Status != acmeStatusDeactivated {
+			return nil, newACMEError("malformed", http.StatusBadRequest, "the status of an authorization can only be set to %q", acmeStatusDeactivated)
+		}
+		if authz.Status != acmeStatusPending && authz.Status != acmeStatusValid {
+			return nil, newACMEError("malformed", http.StatusBadRequest, "the authorization is %s", authz.Status)
+		}
+		authz.Status = acmeStatusDeactivated
+		if err := writeACMEEntry(ctx, req.Storage, acmeAuthorizationPath(acmeReq.account.ID, authz.ID), authz); err != nil {
+			return nil, err
+		}
+	}
+
+	challenges := make([]map[string]interface{}, 0, len(authz.Challenges))
+	for _, chal := range authz.Challenges {
+		challenges = append(challenges, acmeChallengeBody(acmeCtx, authz, chal))
+	}
+	body := map[string]interface{}{
+		"identifier": authz.Identifier,
+		"status":     authz.Status,
+		"expires":    authz.Expires.Format(time.RFC3339),
+		"challenges": challenges,
+	}
+	if authz.Wildcard {
+		body["wildcard"] = true
+	}
+	return acmeResponse(http.StatusOK, body)
+}
+
+func (b *backend) pathACMEChallenge(ctx context.Context, req *logical.Request, data *framework.FieldData, acmeCtx *acmeContext) (*logical.Response, error) {
+	acmeReq, err := b.acmeVerifyRequest(ctx, req, data, acmeCtx, acmeKeyAccount)
+	if err != nil {
+		return nil, err
+	}
+	authz, err := b.acmeFetchAuthorization(ctx, req, data, acmeReq.account)
+	if err != nil {
+		return nil, err
+	}
+	var chal *acmeChallenge
+	for _, c := range authz.Challenges {
+		if c.Type == data.Get("challenge_type").(string) {
+			chal = c
+		}
+	}
+	if chal == nil {
+		return nil, newACMEError("malformed", http.StatusNotFound, "unknown challenge")
+	}
+
+	// Any payload, usually an empty object, asks for the challenge to be
+	// validated; it is validated before responding
+	if len(acmeReq.payload) != 0 && authz.Status == acmeStatusPending && chal.Status == acmeStatusPending {
+		keyAuth := acmeKeyAuthorization(acmeReq.account, chal)
+		if problem := b.acmeValidateChallenge(ctx, authz.Identifier.Value, chal, keyAuth); problem != nil {
+			chal.Status = acmeStatusInvalid
+			chal.Error = problem
+			authz.Status = acmeStatusInvalid
+		} else {
+			chal.Status = acmeStatusValid
+			chal.Validated = time.Now().UTC()
+			authz.Status = acmeStatusValid
+		}
+		if err := writeACMEEntry(ctx, req.Storage, acmeAuthorizationPath(acmeReq.account.ID, authz.ID), authz); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := acmeResponse(http.StatusOK, acmeChallengeBody(acmeCtx, authz, chal))
+	if err != nil {
+		return nil, err
+	}
+	resp.Headers["Link"] = []string{fmt.Sprintf(`<%s>;rel="up"`, acmeCtx.url("authorization/"+authz.ID))}
+	return resp, nil
+}
+
+func (b *backend) pathACMERevokeCert(ctx context.Context, req *logical.Request, data *framework.FieldData, acmeCtx *acmeContext) (*logical.Response, error) {
+	acmeReq, err := b.acmeVerifyRequest(ctx, req, data, acmeCtx, acmeKeyAny)
+	if err != nil {
+		return nil, err
+	}
+	var payload struct {
+		Certificate string `json:"certificate"`
+		Reason      int    `json:"reason"`
+	}
+	if _, err := acmeReq.decodePayload(&payload); err != nil {
+		return nil, err
+	}
+	if payload.Reason != 0 {
+		return nil, newACMEError("badRevocationReason", http.StatusBadRequest, "only the unspecified revocation reason is supported")
+	}
+	certBytes, err := base64.RawURLEncoding.DecodeString(payload.Certificate)
+	if err != nil {
+		return nil, newACMEError("malformed", http.StatusBadRequest, "the certificate could not be decoded: %s", err)
+	}
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return nil, newACMEError("malformed", http.StatusBadRequest, "the certificate could not be parsed: %s", err)
+	}
+	serial := certutil.GetHexFormatted(cert.SerialNumber.Bytes(), ":")
+
+	// Only the exact certificate issued under this serial can be revoked, so
+	// that a certificate forged with the serial of another cannot be used to
+	// revoke it
+	certEntry, err := fetchCertBySerial(ctx, req, "certs/", serial)
+	if err != nil {
+		return nil, err
+	}
+	if certEntry == nil || !bytes.Equal(certEntry.Value, certBytes) {
+		return nil, newACMEError("unauthorized", http.StatusForbidden, "the certificate was not issued by this server")
+	}
+
+	// Certificates can be revoked by the account that ordered them, or by
+	// proving possession of their key
+	authorized := false
+	if acmeReq.account != nil {
+		orderIDs, err := req.Storage.List(ctx, acmeAccountPath(acmeReq.account.ID)+"/orders/")
+		if err != nil {
+			return nil, err
+		}
+		for _, orderID := range orderIDs {
+			order, err := fetchACMEOrder(ctx, req.Storage, acmeReq.account.ID, orderID)
+			if err != nil {
+				return nil, err
+			}
+			if order != nil && order.CertificateSerial == serial {
+				authorized = true
+				break
+			}
+		}
+	} else {
+		authorized = publicKeysEqual(acmeReq.jwk.Key, cert.PublicKey)
+	}
+	if !authorized {
+		return nil, newACMEError("unauthorized", http.StatusForbidden, "the request is not authorized to revoke this certificate")
+	}
+
+	b.revokeStorageLock.Lock()
+	defer b.revokeStorageLock.Unlock()
+
+	resp, err := revokeCert(ctx, b, req, serial, false)
+	if err != nil {
+		return nil, err
+	}
+	if resp != nil && resp.IsError() {
+		return nil, newACMEError("malformed", http.StatusBadRequest, resp.Error().Error())
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/json",
+			logical.HTTPStatusCode:  http.StatusOK,
+		},
+	}, nil
+}
+
+const (
+	pathACMEDirectoryHelpSyn     = `Fetch the ACME directory.`
+	pathACMENewNonceHelpSyn      = `Fetch a fresh ACME nonce.`
+	pathACMENewAccountHelpSyn    = `Create or look up an ACME account.`
+	pathACMEAccountHelpSyn       = `Fetch, update or deactivate an ACME account.`
+	pathACMEAccountOrdersHelpSyn = `List the orders of an ACME account.`
+	pathACMENewOrderHelpSyn      = `Order a certificate through ACME.`
+	pathACMEOrderHelpSyn         = `Fetch an ACME order.`
+	pathACMEFinalizeHelpSyn      = `Finalize an ACME order with a CSR.`
+	pathACMECertificateHelpSyn   = `Download the certificate of an ACME order.`
+	pathACMEAuthorizationHelpSyn = `Fetch or deactivate an ACME authorization.`
+	pathACMEChallengeHelpSyn     = `Fetch or respond to an ACME challenge.`
+	pathACMERevokeCertHelpSyn    = `Revoke a certificate through ACME.`
+)
+
+const pathACMEHelpDesc = `
+These endpoints implement an ACME (RFC 8555) server, enabled at "config/acme".
+ACME clients order certificates by proving control of the requested domains
+through http-01 or dns-01 challenges, and authenticate with the keys of their
+ACME accounts rather than with Vault tokens.
+
+The directory at "acme/directory" issues certificates under the policy of the
+configured default role, and the directories at "acme/roles/<role>/directory"
+under the policy of the role in their path.
+`
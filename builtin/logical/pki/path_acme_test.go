@@ -0,0 +1,469 @@
+package pki
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+const acmeTestBaseURL = "https://vault.example.com/v1/pki"
+
+// acmeTestClient is a minimal ACME client sending requests to the backend
+type acmeTestClient struct {
+	t     *testing.T
+	b     *backend
+	s     logical.Storage
+	key   *ecdsa.PrivateKey
+	kid   string
+	nonce string
+}
+
+func newACMETestClient(t *testing.T, b *backend, s logical.Storage) *acmeTestClient {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &acmeTestClient{t: t, b: b, s: s, key: key}
+}
+
+func (c *acmeTestClient) handle(op logical.Operation, url string, data map[string]interface{}) (int, map[string]interface{}, *logical.Response) {
+	c.t.Helper()
+	if !strings.HasPrefix(url, acmeTestBaseURL+"/") {
+		c.t.Fatalf("unexpected URL %q", url)
+	}
+	resp, err := c.b.HandleRequest(context.Background(), &logical.Request{
+		Operation: op,
+		Path:      strings.TrimPrefix(url, acmeTestBaseURL+"/"),
+		Storage:   c.s,
+		Data:      data,
+	})
+	if err != nil {
+		c.t.Fatalf("%s: %v", url, err)
+	}
+	if nonces := resp.Headers["Replay-Nonce"]; len(nonces) == 1 {
+		c.nonce = nonces[0]
+	} else {
+		c.t.Fatalf("%s: expected a nonce: %#v", url, resp.Headers)
+	}
+
+	var body map[string]interface{}
+	if raw, ok := resp.Data[logical.HTTPRawBody].([]byte); ok && len(raw) > 0 && resp.Data[logical.HTTPContentType] != "application/pem-certificate-chain" {
+		if err := json.Unmarshal(raw, &body); err != nil {
+			c.t.Fatalf("%s: %v", url, err)
+		}
+	}
+	return resp.Data[logical.HTTPStatusCode].(int), body, resp
+}
+
+// post sends a JWS signed request; a nil payload sends a POST-as-GET request
+func (c *acmeTestClient) post(url string, payload interface{}) (int, map[string]interface{}, *logical.Response) {
+	c.t.Helper()
+	return c.postWithKey(url, payload, c.key, c.kid == "")
+}
+
+func (c *acmeTestClient) postWithKey(url string, payload interface{}, key crypto.Signer, embedKey bool) (int, map[string]interface{}, *logical.Response) {
+	c.t.Helper()
+	if c.nonce == "" {
+		c.handle(logical.ReadOperation, acmeTestBaseURL+"/acme/new-nonce", nil)
+	}
+
+	opts := &jose.SignerOptions{
+		EmbedJWK: embedKey,
+		ExtraHeaders: map[jose.HeaderKey]interface{}{
+			"nonce": c.nonce,
+			"url":   url,
+		},
+	}
+	if !embedKey {
+		opts.ExtraHeaders["kid"] = c.kid
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, opts)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	var payloadBytes []byte
+	if payload != nil {
+		if payloadBytes, err = json.Marshal(payload); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	jws, err := signer.Sign(payloadBytes)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(jws.FullSerialize()), &data); err != nil {
+		c.t.Fatal(err)
+	}
+	return c.handle(logical.UpdateOperation, url, data)
+}
+
+func (c *acmeTestClient) keyAuthorization(token string) string {
+	thumbprint, err := (&jose.JSONWebKey{Key: c.key.Public()}).Thumbprint(crypto.SHA256)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return token + "." + base64.RawURLEncoding.EncodeToString(thumbprint)
+}
+
+func expectACMEError(t *testing.T, status int, body map[string]interface{}, expectedStatus int, errType string) {
+	t.Helper()
+	if status != expectedStatus || body["type"] != acmeErrorPrefix+errType {
+		t.Fatalf("expected %d %s, got %d: %#v", expectedStatus, errType, status, body)
+	}
+}
+
+func acmeTestCSR(t *testing.T, commonName string, dnsNames ...string) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: commonName},
+		DNSNames: dnsNames,
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(csr)
+}
+
+func TestPki_ACME(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	// Challenges are answered by a test HTTP server and an in-memory DNS
+	var lock sync.Mutex
+	httpTokens := map[string]string{}
+	txtRecords := map[string][]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		keyAuth, ok := httpTokens[r.Host+r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, keyAuth)
+	}))
+	defer server.Close()
+	b.acmeHTTPClient.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial(network, server.Listener.Addr().String())
+		},
+	}
+	b.acmeLookupTXT = func(ctx context.Context, name string) ([]string, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		return txtRecords[name], nil
+	}
+
+	resp := issuersRequest(t, b, storage, logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "myvault.com",
+		"key_type":    "ec",
+		"key_bits":    256,
+		"ttl":         "48h",
+	})
+	caCert := parsePEMCert(t, resp.Data["certificate"].(string))
+	issuersRequest(t, b, storage, logical.UpdateOperation, "roles/example", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"key_type":         "ec",
+		"key_bits":         256,
+		"ttl":              "1h",
+	})
+
+	client := newACMETestClient(t, b, storage)
+
+	// The ACME server must be enabled
+	status, body, _ := client.handle(logical.ReadOperation, acmeTestBaseURL+"/acme/directory", nil)
+	expectACMEError(t, status, body, http.StatusForbidden, "unauthorized")
+	issuersRequestError(t, b, storage, logical.UpdateOperation, "config/acme", map[string]interface{}{
+		"enabled": true,
+	})
+	issuersRequest(t, b, storage, logical.UpdateOperation, "config/acme", map[string]interface{}{
+		"enabled":      true,
+		"base_url":     acmeTestBaseURL + "/",
+		"default_role": "example",
+	})
+	resp = issuersRequest(t, b, storage, logical.ReadOperation, "config/acme", nil)
+	if resp.Data["base_url"] != acmeTestBaseURL {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	status, body, _ = client.handle(logical.ReadOperation, acmeTestBaseURL+"/acme/directory", nil)
+	if status != http.StatusOK || body["newOrder"] != acmeTestBaseURL+"/acme/new-order" {
+		t.Fatalf("bad directory: %d %#v", status, body)
+	}
+	status, body, _ = client.handle(logical.ReadOperation, acmeTestBaseURL+"/acme/roles/example/directory", nil)
+	expectACMEError(t, status, body, http.StatusForbidden, "unauthorized")
+
+	// Accounts are looked up by key
+	status, body, resp = client.post(acmeTestBaseURL+"/acme/new-account", map[string]interface{}{
+		"contact":              []string{"mailto:admin@example.com"},
+		"termsOfServiceAgreed": true,
+	})
+	if status != http.StatusCreated || body["status"] != acmeStatusValid {
+		t.Fatalf("bad account: %d %#v", status, body)
+	}
+	client.kid = resp.Headers["Location"][0]
+	status, _, resp = client.postWithKey(acmeTestBaseURL+"/acme/new-account", map[string]interface{}{
+		"onlyReturnExisting": true,
+	}, client.key, true)
+	if status != http.StatusOK || resp.Headers["Location"][0] != client.kid {
+		t.Fatalf("expected the existing account: %d %#v", status, resp.Headers)
+	}
+
+	// Nonces cannot be reused, and the url header must match the request
+	nonce := client.nonce
+	client.post(client.kid, nil)
+	client.nonce = nonce
+	status, body, _ = client.post(client.kid, nil)
+	expectACMEError(t, status, body, http.StatusBadRequest, "badNonce")
+	status, body, _ = client.post(client.kid, nil)
+	if status != http.StatusOK || body["status"] != acmeStatusValid {
+		t.Fatalf("bad account: %d %#v", status, body)
+	}
+	status, body, _ = client.handle(logical.UpdateOperation, acmeTestBaseURL+"/acme/new-order", nil)
+	expectACMEError(t, status, body, http.StatusBadRequest, "malformed")
+
+	// Orders are checked against the role
+	status, body, _ = client.post(acmeTestBaseURL+"/acme/new-order", map[string]interface{}{
+		"identifiers": []map[string]string{{"type": "dns", "value": "www.other.com"}},
+	})
+	expectACMEError(t, status, body, http.StatusBadRequest, "rejectedIdentifier")
+
+	status, body, resp = client.post(acmeTestBaseURL+"/acme/new-order", map[string]interface{}{
+		"identifiers": []map[string]string{
+			{"type": "dns", "value": "www.example.com"},
+			{"type": "dns", "value": "*.example.com"},
+		},
+	})
+	if status != http.StatusCreated || body["status"] != acmeStatusPending {
+		t.Fatalf("bad order: %d %#v", status, body)
+	}
+	orderURL := resp.Headers["Location"][0]
+	finalizeURL := body["finalize"].(string)
+
+	for _, authzURL := range body["authorizations"].([]interface{}) {
+		_, authz, _ := client.post(authzURL.(string), nil)
+		domain := authz["identifier"].(map[string]interface{})["value"].(string)
+		challenges := map[string]map[string]interface{}{}
+		for _, chal := range authz["challenges"].([]interface{}) {
+			challenges[chal.(map[string]interface{})["type"].(string)] = chal.(map[string]interface{})
+		}
+
+		var chal map[string]interface{}
+		keyAuth := client.keyAuthorization("")
+		if authz["wildcard"] == true {
+			if domain != "example.com" || len(challenges) != 1 {
+				t.Fatalf("bad wildcard authorization: %#v", authz)
+			}
+			chal = challenges[acmeChallengeDNS01]
+			keyAuth = client.keyAuthorization(chal["token"].(string))
+			digest := sha256.Sum256([]byte(keyAuth))
+			lock.Lock()
+			txtRecords["_acme-challenge."+domain] = []string{base64.RawURLEncoding.EncodeToString(digest[:])}
+			lock.Unlock()
+		} else {
+			chal = challenges[acmeChallengeHTTP01]
+			keyAuth = client.keyAuthorization(chal["token"].(string))
+			lock.Lock()
+			httpTokens[domain+"/.well-known/acme-challenge/"+chal["token"].(string)] = keyAuth
+			lock.Unlock()
+		}
+
+		status, body, resp = client.post(chal["url"].(string), map[string]interface{}{})
+		if status != http.StatusOK || body["status"] != acmeStatusValid {
+			t.Fatalf("bad challenge: %d %#v", status, body)
+		}
+		if resp.Headers["Link"][0] != fmt.Sprintf(`<%s>;rel="up"`, authzURL) {
+			t.Fatalf("bad link: %#v", resp.Headers)
+		}
+		_, authz, _ = client.post(authzURL.(string), nil)
+		if authz["status"] != acmeStatusValid {
+			t.Fatalf("bad authorization: %#v", authz)
+		}
+	}
+
+	status, body, _ = client.post(orderURL, nil)
+	if status != http.StatusOK || body["status"] != acmeStatusReady {
+		t.Fatalf("bad order: %d %#v", status, body)
+	}
+
+	// The CSR must request the identifiers of the order
+	status, body, _ = client.post(finalizeURL, map[string]interface{}{
+		"csr": acmeTestCSR(t, "", "www.example.com"),
+	})
+	expectACMEError(t, status, body, http.StatusBadRequest, "badCSR")
+	status, body, _ = client.post(finalizeURL, map[string]interface{}{
+		"csr": acmeTestCSR(t, "", "*.example.com", "www.example.com"),
+	})
+	if status != http.StatusOK || body["status"] != acmeStatusValid {
+		t.Fatalf("bad order: %d %#v", status, body)
+	}
+
+	status, _, resp = client.post(body["certificate"].(string), nil)
+	if status != http.StatusOK {
+		t.Fatalf("bad status: %d", status)
+	}
+	block, rest := pem.Decode(resp.Data[logical.HTTPRawBody].([]byte))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.CheckSignatureFrom(caCert); err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != "*.example.com" || len(cert.DNSNames) != 2 {
+		t.Fatalf("bad certificate names: %v %v", cert.Subject.CommonName, cert.DNSNames)
+	}
+	if block, _ := pem.Decode(rest); block != nil {
+		t.Fatal("expected the root CA to be left out of the chain")
+	}
+
+	// Failed challenges invalidate the order
+	status, body, resp = client.post(acmeTestBaseURL+"/acme/new-order", map[string]interface{}{
+		"identifiers": []map[string]string{{"type": "dns", "value": "bad.example.com"}},
+	})
+	badOrderURL := resp.Headers["Location"][0]
+	_, authz, _ := client.post(body["authorizations"].([]interface{})[0].(string), nil)
+	for _, chal := range authz["challenges"].([]interface{}) {
+		if chal.(map[string]interface{})["type"] != acmeChallengeHTTP01 {
+			continue
+		}
+		token := chal.(map[string]interface{})["token"].(string)
+		lock.Lock()
+		httpTokens["bad.example.com/.well-known/acme-challenge/"+token] = "wrong"
+		lock.Unlock()
+		status, body, _ = client.post(chal.(map[string]interface{})["url"].(string), map[string]interface{}{})
+		if body["status"] != acmeStatusInvalid || body["error"].(map[string]interface{})["type"] != acmeErrorPrefix+"incorrectResponse" {
+			t.Fatalf("bad challenge: %d %#v", status, body)
+		}
+	}
+	_, body, _ = client.post(badOrderURL, nil)
+	if body["status"] != acmeStatusInvalid {
+		t.Fatalf("bad order: %#v", body)
+	}
+	status, body, _ = client.post(badOrderURL+"/finalize", map[string]interface{}{
+		"csr": acmeTestCSR(t, "bad.example.com"),
+	})
+	expectACMEError(t, status, body, http.StatusForbidden, "orderNotReady")
+
+	// Orders of other accounts cannot be fetched
+	other := newACMETestClient(t, b, storage)
+	_, _, resp = other.post(acmeTestBaseURL+"/acme/new-account", map[string]interface{}{})
+	other.kid = resp.Headers["Location"][0]
+	status, body, _ = other.post(orderURL, nil)
+	expectACMEError(t, status, body, http.StatusNotFound, "malformed")
+
+	// Key IDs must be the URL of an account, not of one of its orders
+	forgedKid := &acmeTestClient{t: t, b: b, s: storage, key: client.key}
+	forgedKid.kid = client.kid + "/orders/" + orderURL[strings.LastIndex(orderURL, "/")+1:]
+	status, body, _ = forgedKid.post(client.kid, nil)
+	expectACMEError(t, status, body, http.StatusBadRequest, "accountDoesNotExist")
+
+	// Certificates forged with the serial of an issued certificate cannot be
+	// used to revoke it
+	forgedTemplate := &x509.Certificate{
+		SerialNumber: cert.SerialNumber,
+		Subject:      pkix.Name{CommonName: "*.example.com"},
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+	}
+	forgedBytes, err := x509.CreateCertificate(rand.Reader, forgedTemplate, forgedTemplate, other.key.Public(), other.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, body, _ = other.postWithKey(acmeTestBaseURL+"/acme/revoke-cert", map[string]interface{}{
+		"certificate": base64.RawURLEncoding.EncodeToString(forgedBytes),
+	}, other.key, true)
+	expectACMEError(t, status, body, http.StatusForbidden, "unauthorized")
+
+	// Certificates can be revoked by the account that ordered them
+	revokeData := map[string]interface{}{
+		"certificate": base64.RawURLEncoding.EncodeToString(cert.Raw),
+	}
+	status, body, _ = other.post(acmeTestBaseURL+"/acme/revoke-cert", revokeData)
+	expectACMEError(t, status, body, http.StatusForbidden, "unauthorized")
+	status, body, _ = client.post(acmeTestBaseURL+"/acme/revoke-cert", revokeData)
+	if status != http.StatusOK {
+		t.Fatalf("bad revocation: %d %#v", status, body)
+	}
+	if serials := fetchCRLSerials(t, b, storage, "crl"); !serials[cert.SerialNumber.String()] {
+		t.Fatalf("expected the certificate on the CRL: %v", serials)
+	}
+
+	// Roles have their own directories once allowed
+	issuersRequest(t, b, storage, logical.UpdateOperation, "config/acme", map[string]interface{}{
+		"allowed_roles": "example",
+	})
+	status, body, _ = client.handle(logical.ReadOperation, acmeTestBaseURL+"/acme/roles/example/directory", nil)
+	if status != http.StatusOK || body["newOrder"] != acmeTestBaseURL+"/acme/roles/example/new-order" {
+		t.Fatalf("bad directory: %d %#v", status, body)
+	}
+	status, body, _ = client.post(acmeTestBaseURL+"/acme/roles/example/account/"+client.kid[strings.LastIndex(client.kid, "/")+1:], nil)
+	if status != http.StatusOK {
+		t.Fatalf("bad account: %d %#v", status, body)
+	}
+	status, body, _ = client.post(acmeTestBaseURL+"/acme/roles/example/order/"+orderURL[strings.LastIndex(orderURL, "/")+1:], nil)
+	expectACMEError(t, status, body, http.StatusNotFound, "malformed")
+}
+
+func TestPki_ACMEHTTP01Redirects(t *testing.T) {
+	b, _ := createBackendWithStorage(t)
+
+	const keyAuth = "token.thumbprint"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Host {
+		case "allowed.example.com":
+			http.Redirect(w, r, "http://target.example.com:80"+r.URL.Path, http.StatusFound)
+		case "port.example.com":
+			http.Redirect(w, r, "http://target.example.com:8200"+r.URL.Path, http.StatusFound)
+		case "scheme.example.com":
+			http.Redirect(w, r, "ftp://target.example.com"+r.URL.Path, http.StatusFound)
+		case "loop.example.com":
+			http.Redirect(w, r, "http://loop.example.com"+r.URL.Path, http.StatusFound)
+		case "target.example.com:80", "target.example.com:8200":
+			fmt.Fprint(w, keyAuth)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	b.acmeHTTPClient.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial(network, server.Listener.Addr().String())
+		},
+	}
+
+	chal := &acmeChallenge{Type: acmeChallengeHTTP01, Token: "token"}
+	if acmeErr := b.acmeValidateChallenge(context.Background(), "allowed.example.com", chal, keyAuth); acmeErr != nil {
+		t.Fatalf("expected the redirect to be followed, got: %v", acmeErr)
+	}
+
+	// Redirects can only lead to the HTTP and HTTPS ports
+	for _, domain := range []string{"port.example.com", "scheme.example.com", "loop.example.com"} {
+		acmeErr := b.acmeValidateChallenge(context.Background(), domain, chal, keyAuth)
+		if acmeErr == nil || acmeErr.Type != acmeErrorPrefix+"connection" {
+			t.Fatalf("expected a connection error for %s, got: %v", domain, acmeErr)
+		}
+	}
+}
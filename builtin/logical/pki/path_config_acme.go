@@ -0,0 +1,188 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// acmeConfig holds the configuration of the ACME server
+type acmeConfig struct {
+	Enabled bool `json:"enabled"`
+
+	// BaseURL is the URL of the mount as reached by ACME clients, which ACME
+	// resources are addressed under
+	BaseURL string `json:"base_url"`
+
+	// DefaultRole is the role of the directory at acme/directory
+	DefaultRole string `json:"default_role"`
+
+	// AllowedRoles are the roles with a directory at
+	// acme/roles/<role>/directory
+	AllowedRoles []string `json:"allowed_roles"`
+}
+
+func pathConfigACME(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/acme",
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: `If set to true, enables the ACME server.`,
+			},
+			"base_url": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The URL of this mount as reached by ACME
+clients, such as "https://vault.example.com:8200/v1/pki".
+Required to enable the ACME server.`,
+			},
+			"default_role": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The role whose policy applies to
+certificates ordered through the "acme/directory"
+directory. If empty, that directory is disabled.`,
+			},
+			"allowed_roles": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `The roles that can be used through the
+"acme/roles/<role>/directory" directories. If set
+to "*", all roles can be used.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathACMEConfigRead,
+			logical.UpdateOperation: b.pathACMEConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigACMEHelpSyn,
+		HelpDescription: pathConfigACMEHelpDesc,
+	}
+}
+
+func (b *backend) ACME(ctx context.Context, s logical.Storage) (*acmeConfig, error) {
+	entry, err := s.Get(ctx, "config/acme")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result acmeConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathACMEConfigRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.ACME(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":       config.Enabled,
+			"base_url":      config.BaseURL,
+			"default_role":  config.DefaultRole,
+			"allowed_roles": config.AllowedRoles,
+		},
+	}, nil
+}
+
+func (b *backend) pathACMEConfigWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.ACME(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &acmeConfig{
+			AllowedRoles: []string{},
+		}
+	}
+
+	if enabledRaw, ok := d.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+
+	if baseURLRaw, ok := d.GetOk("base_url"); ok {
+		baseURL := strings.TrimSuffix(baseURLRaw.(string), "/")
+		if baseURL != "" {
+			parsed, err := url.Parse(baseURL)
+			if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+				return logical.ErrorResponse(fmt.Sprintf("invalid base_url %q: must be an http or https URL", baseURL)), nil
+			}
+		}
+		config.BaseURL = baseURL
+	}
+
+	if defaultRoleRaw, ok := d.GetOk("default_role"); ok {
+		config.DefaultRole = defaultRoleRaw.(string)
+	}
+
+	if allowedRolesRaw, ok := d.GetOk("allowed_roles"); ok {
+		config.AllowedRoles = allowedRolesRaw.([]string)
+	}
+
+	if config.Enabled && config.BaseURL == "" {
+		return logical.ErrorResponse("base_url must be set to enable the ACME server"), nil
+	}
+
+	var warnings []string
+	for _, roleName := range append([]string{config.DefaultRole}, config.AllowedRoles...) {
+		if roleName == "" || roleName == "*" {
+			continue
+		}
+		role, err := b.getRole(ctx, req.Storage, roleName)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			warnings = append(warnings, fmt.Sprintf("role %q does not exist", roleName))
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("config/acme", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	if len(warnings) == 0 {
+		return nil, nil
+	}
+	resp := &logical.Response{}
+	for _, warning := range warnings {
+		resp.AddWarning(warning)
+	}
+	return resp, nil
+}
+
+const pathConfigACMEHelpSyn = `
+Configure the ACME server.
+`
+
+const pathConfigACMEHelpDesc = `
+This endpoint enables the ACME (RFC 8555) server of the mount, which lets
+ACME clients order certificates by proving control of the requested domains
+through http-01 or dns-01 challenges, without a Vault token.
+
+Certificates are issued under the policy of a role: the "default_role" for the
+directory at "acme/directory", or the role named in the path of the directories
+at "acme/roles/<role>/directory" for the roles listed in "allowed_roles".
+
+ACME clients rely on the Replay-Nonce, Location and Link response headers,
+which must be allowed by tuning the mount's "allowed_response_headers".
+`
@@ -3,7 +3,6 @@ package pki
 import (
 	"context"
 
-	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/certutil"
 	"github.com/hashicorp/vault/sdk/helper/errutil"
@@ -11,7 +10,7 @@ import (
 )
 
 func pathConfigCA(b *backend) *framework.Path {
-	return &framework.Path{
+	ret := &framework.Path{
 		Pattern: "config/ca",
 		Fields: map[string]*framework.FieldSchema{
 			"pem_bundle": &framework.FieldSchema{
@@ -28,6 +27,10 @@ secret key and certificate.`,
 		HelpSynopsis:    pathConfigCAHelpSyn,
 		HelpDescription: pathConfigCAHelpDesc,
 	}
+
+	ret.Fields = addIssuerNameField(ret.Fields)
+
+	return ret
 }
 
 func (b *backend) pathCAWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
@@ -60,32 +63,25 @@ func (b *backend) pathCAWrite(ctx context.Context, req *logical.Request, data *f
 		return logical.ErrorResponse("the given certificate is not marked for CA use and cannot be used with this backend"), nil
 	}
 
-	cb, err := parsedBundle.ToCertBundle()
-	if err != nil {
-		return nil, errwrap.Wrapf("error converting raw values into cert bundle: {{err}}", err)
-	}
-
-	entry, err := logical.StorageEntryJSON("config/ca_bundle", cb)
-	if err != nil {
-		return nil, err
-	}
-	err = req.Storage.Put(ctx, entry)
+	issuer, existing, err := importIssuer(ctx, req.Storage, parsedBundle, data.Get("issuer_name").(string))
 	if err != nil {
-		return nil, err
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
 	}
+	b.ocspCache.Flush()
 
-	// For ease of later use, also store just the certificate at a known
-	// location, plus a fresh CRL
-	entry.Key = "ca"
-	entry.Value = parsedBundle.CertificateBytes
-	err = req.Storage.Put(ctx, entry)
-	if err != nil {
-		return nil, err
+	// Build a fresh CRL for the new issuer
+	if !existing {
+		if err := buildCRL(ctx, b, req, true); err != nil {
+			return nil, err
+		}
 	}
 
-	err = buildCRL(ctx, b, req, true)
-
-	return nil, err
+	return addIssuerResponseData(ctx, req.Storage, nil, issuer)
 }
 
 const pathConfigCAHelpSyn = `
@@ -93,9 +89,10 @@ Set the CA certificate and private key used for generated credentials.
 `
 
 const pathConfigCAHelpDesc = `
-This sets the CA information used for credentials generated by this
-by this mount. This must be a PEM-format, concatenated unencrypted
-secret key and certificate.
+This imports CA information used for credentials generated by this
+by this mount as a new issuer. This must be a PEM-format, concatenated
+unencrypted secret key and certificate. The issuer becomes the default
+issuer if the mount has none.
 
 For security reasons, the secret key cannot be retrieved later.
 `
@@ -11,10 +11,25 @@ import (
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
+const (
+	defaultAutoRebuildGracePeriod = "12h"
+	defaultDeltaRebuildInterval   = "15m"
+)
+
 // CRLConfig holds basic CRL configuration information
 type crlConfig struct {
 	Expiry  string `json:"expiry" mapstructure:"expiry"`
 	Disable bool   `json:"disable"`
+
+	// AutoRebuild rebuilds the CRL periodically, when it is about to expire,
+	// instead of on every revocation
+	AutoRebuild            bool   `json:"auto_rebuild"`
+	AutoRebuildGracePeriod string `json:"auto_rebuild_grace_period"`
+
+	// EnableDelta builds delta CRLs of the certificates revoked since the
+	// last complete CRL; it requires AutoRebuild
+	EnableDelta          bool   `json:"enable_delta"`
+	DeltaRebuildInterval string `json:"delta_rebuild_interval"`
 }
 
 func pathConfigCRL(b *backend) *framework.Path {
@@ -31,6 +46,28 @@ valid; defaults to 72 hours`,
 				Type:        framework.TypeBool,
 				Description: `If set to true, disables generating the CRL entirely.`,
 			},
+			"auto_rebuild": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `If set to true, the CRL is rebuilt periodically
+when it is about to expire, instead of on every revocation.`,
+			},
+			"auto_rebuild_grace_period": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The time before the expiry of the CRL at which
+it is rebuilt when auto_rebuild is set; defaults to 12 hours`,
+				Default: defaultAutoRebuildGracePeriod,
+			},
+			"enable_delta": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `If set to true, delta CRLs of the certificates
+revoked since the last complete CRL are built. Requires auto_rebuild.`,
+			},
+			"delta_rebuild_interval": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The interval at which delta CRLs are rebuilt
+when certificates have been revoked; defaults to 15 minutes`,
+				Default: defaultDeltaRebuildInterval,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -57,6 +94,13 @@ func (b *backend) CRL(ctx context.Context, s logical.Storage) (*crlConfig, error
 		return nil, err
 	}
 
+	if result.AutoRebuildGracePeriod == "" {
+		result.AutoRebuildGracePeriod = defaultAutoRebuildGracePeriod
+	}
+	if result.DeltaRebuildInterval == "" {
+		result.DeltaRebuildInterval = defaultDeltaRebuildInterval
+	}
+
 	return &result, nil
 }
 
@@ -71,8 +115,12 @@ func (b *backend) pathCRLRead(ctx context.Context, req *logical.Request, data *f
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"expiry":  config.Expiry,
-			"disable": config.Disable,
+			"expiry":                    config.Expiry,
+			"disable":                   config.Disable,
+			"auto_rebuild":              config.AutoRebuild,
+			"auto_rebuild_grace_period": config.AutoRebuildGracePeriod,
+			"enable_delta":              config.EnableDelta,
+			"delta_rebuild_interval":    config.DeltaRebuildInterval,
 		},
 	}, nil
 }
@@ -83,7 +131,10 @@ func (b *backend) pathCRLWrite(ctx context.Context, req *logical.Request, d *fra
 		return nil, err
 	}
 	if config == nil {
-		config = &crlConfig{}
+		config = &crlConfig{
+			AutoRebuildGracePeriod: defaultAutoRebuildGracePeriod,
+			DeltaRebuildInterval:   defaultDeltaRebuildInterval,
+		}
 	}
 
 	if expiryRaw, ok := d.GetOk("expiry"); ok {
@@ -95,12 +146,56 @@ func (b *backend) pathCRLWrite(ctx context.Context, req *logical.Request, d *fra
 		config.Expiry = expiry
 	}
 
-	var oldDisable bool
+	oldDisable := config.Disable
 	if disableRaw, ok := d.GetOk("disable"); ok {
-		oldDisable = config.Disable
 		config.Disable = disableRaw.(bool)
 	}
 
+	oldAutoRebuild := config.AutoRebuild
+	if autoRebuildRaw, ok := d.GetOk("auto_rebuild"); ok {
+		config.AutoRebuild = autoRebuildRaw.(bool)
+	}
+
+	if gracePeriodRaw, ok := d.GetOk("auto_rebuild_grace_period"); ok {
+		gracePeriod := gracePeriodRaw.(string)
+		if _, err := time.ParseDuration(gracePeriod); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("given auto_rebuild_grace_period could not be decoded: %s", err)), nil
+		}
+		config.AutoRebuildGracePeriod = gracePeriod
+	}
+
+	oldEnableDelta := config.EnableDelta
+	if enableDeltaRaw, ok := d.GetOk("enable_delta"); ok {
+		config.EnableDelta = enableDeltaRaw.(bool)
+	}
+
+	if deltaIntervalRaw, ok := d.GetOk("delta_rebuild_interval"); ok {
+		deltaInterval := deltaIntervalRaw.(string)
+		dur, err := time.ParseDuration(deltaInterval)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("given delta_rebuild_interval could not be decoded: %s", err)), nil
+		}
+		if dur <= 0 {
+			return logical.ErrorResponse("delta_rebuild_interval must be positive"), nil
+		}
+		config.DeltaRebuildInterval = deltaInterval
+	}
+
+	if config.EnableDelta && !config.AutoRebuild {
+		return logical.ErrorResponse("enable_delta requires auto_rebuild to be set"), nil
+	}
+
+	if config.AutoRebuild {
+		expiry := b.crlLifetime
+		if config.Expiry != "" {
+			expiry, _ = time.ParseDuration(config.Expiry)
+		}
+		gracePeriod, _ := time.ParseDuration(config.AutoRebuildGracePeriod)
+		if gracePeriod >= expiry {
+			return logical.ErrorResponse(fmt.Sprintf("auto_rebuild_grace_period (%s) must be shorter than the CRL expiry (%s)", gracePeriod, expiry)), nil
+		}
+	}
+
 	entry, err := logical.StorageEntryJSON("config/crl", config)
 	if err != nil {
 		return nil, err
@@ -110,8 +205,12 @@ func (b *backend) pathCRLWrite(ctx context.Context, req *logical.Request, d *fra
 		return nil, err
 	}
 
-	if oldDisable != config.Disable {
-		// It wasn't disabled but now it is, rotate
+	if oldDisable != config.Disable || oldAutoRebuild != config.AutoRebuild || oldEnableDelta != config.EnableDelta {
+		// The CRL was enabled or disabled, or revocations may be pending
+		// for the next automatic rebuild, so rotate
+		b.revokeStorageLock.Lock()
+		defer b.revokeStorageLock.Unlock()
+
 		crlErr := buildCRL(ctx, b, req, true)
 		switch crlErr.(type) {
 		case errutil.UserError:
@@ -125,9 +224,16 @@ func (b *backend) pathCRLWrite(ctx context.Context, req *logical.Request, d *fra
 }
 
 const pathConfigCRLHelpSyn = `
-Configure the CRL expiration.
+Configure the CRL expiration and rebuilding.
 `
 
 const pathConfigCRLHelpDesc = `
 This endpoint allows configuration of the CRL lifetime.
+
+By default, the CRL is rebuilt on every revocation, which becomes slow with
+many revoked certificates. With "auto_rebuild" set, revocations are only
+recorded, and the CRL is rebuilt when it is within the grace period of its
+expiry, or on "crl/rotate". With "enable_delta" also set, delta CRLs of the
+certificates revoked since the last complete CRL are rebuilt at the delta
+rebuild interval and served at "crl/delta".
 `
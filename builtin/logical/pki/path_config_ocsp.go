@@ -0,0 +1,212 @@
+package pki
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// defaultOCSPExpiry is the default validity of OCSP responses
+const defaultOCSPExpiry = "12h"
+
+// ocspConfig holds the configuration of the OCSP responder
+type ocspConfig struct {
+	Disable bool   `json:"disable"`
+	Expiry  string `json:"expiry"`
+
+	// ResponderBundle is the certificate and key of a delegated responder
+	// that signs responses in place of the CA
+	ResponderBundle *certutil.CertBundle `json:"responder_bundle,omitempty"`
+}
+
+func pathConfigOCSP(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/ocsp",
+		Fields: map[string]*framework.FieldSchema{
+			"disable": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: `If set to true, disables the OCSP responder.`,
+			},
+			"expiry": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The amount of time OCSP responses are valid
+for, after which clients must refresh them; defaults
+to 12 hours. Responses are cached for half this
+time. If set to zero, responses do not indicate
+when newer information will be available and are
+not cached.`,
+				Default: defaultOCSPExpiry,
+			},
+			"pem_bundle": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `PEM-format, concatenated unencrypted secret key
+and certificate of a delegated OCSP responder. The
+certificate must be issued by the CA and have the
+OCSP signing extended key usage. If set to an empty
+string, responses are signed by the CA.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathOCSPConfigRead,
+			logical.UpdateOperation: b.pathOCSPConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigOCSPHelpSyn,
+		HelpDescription: pathConfigOCSPHelpDesc,
+	}
+}
+
+func (b *backend) OCSP(ctx context.Context, s logical.Storage) (*ocspConfig, error) {
+	entry, err := s.Get(ctx, "config/ocsp")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result ocspConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathOCSPConfigRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.OCSP(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"disable": config.Disable,
+			"expiry":  config.Expiry,
+		},
+	}
+	if config.ResponderBundle != nil {
+		resp.Data["responder_certificate"] = config.ResponderBundle.Certificate
+	}
+	return resp, nil
+}
+
+func (b *backend) pathOCSPConfigWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.OCSP(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &ocspConfig{
+			Expiry: defaultOCSPExpiry,
+		}
+	}
+
+	if expiryRaw, ok := d.GetOk("expiry"); ok {
+		expiry := expiryRaw.(string)
+		if _, err := time.ParseDuration(expiry); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("given expiry could not be decoded: %s", err)), nil
+		}
+		config.Expiry = expiry
+	}
+
+	if disableRaw, ok := d.GetOk("disable"); ok {
+		config.Disable = disableRaw.(bool)
+	}
+
+	if pemBundleRaw, ok := d.GetOk("pem_bundle"); ok {
+		pemBundle := pemBundleRaw.(string)
+		if pemBundle == "" {
+			config.ResponderBundle = nil
+		} else {
+			parsedBundle, err := certutil.ParsePEMBundle(pemBundle)
+			if err != nil {
+				switch err.(type) {
+				case errutil.InternalError:
+					return nil, err
+				default:
+					return logical.ErrorResponse(err.Error()), nil
+				}
+			}
+			if parsedBundle.PrivateKey == nil ||
+				parsedBundle.PrivateKeyType == certutil.UnknownPrivateKey {
+				return logical.ErrorResponse("private key not found in the PEM bundle"), nil
+			}
+			if parsedBundle.Certificate == nil {
+				return logical.ErrorResponse("no certificate found in the PEM bundle"), nil
+			}
+			if err := parsedBundle.Verify(); err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+
+			caInfo, err := fetchCAInfo(ctx, req)
+			switch err.(type) {
+			case errutil.UserError:
+				return logical.ErrorResponse(err.Error()), nil
+			case errutil.InternalError:
+				return nil, err
+			}
+			if err := validateOCSPResponder(parsedBundle.Certificate, caInfo.Certificate); err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+
+			config.ResponderBundle, err = parsedBundle.ToCertBundle()
+			if err != nil {
+				return nil, errwrap.Wrapf("error converting raw values into cert bundle: {{err}}", err)
+			}
+			// Only the responder's own certificate is included in responses
+			config.ResponderBundle.CAChain = nil
+			config.ResponderBundle.IssuingCA = ""
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("config/ocsp", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	b.ocspCache.Flush()
+
+	return nil, nil
+}
+
+// validateOCSPResponder checks that the certificate of a delegated responder
+// is authorized by the CA to sign OCSP responses, see RFC 6960 section 4.2.2.2
+func validateOCSPResponder(responder, ca *x509.Certificate) error {
+	if err := responder.CheckSignatureFrom(ca); err != nil {
+		return errwrap.Wrapf("responder certificate was not issued by the CA: {{err}}", err)
+	}
+
+	for _, usage := range responder.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageOCSPSigning {
+			return nil
+		}
+	}
+	return fmt.Errorf("responder certificate does not have the OCSP signing extended key usage")
+}
+
+const pathConfigOCSPHelpSyn = `
+Configure the OCSP responder.
+`
+
+const pathConfigOCSPHelpDesc = `
+This endpoint allows configuration of the OCSP responder: whether it is
+enabled, the validity of its responses, and an optional delegated responder
+certificate and key used to sign responses in place of the CA. The delegated
+responder must be issued by the default issuer, and only signs responses for
+the certificates of that issuer.
+`
@@ -32,6 +32,12 @@ for the CRL distribution points attribute`,
 				Description: `Comma-separated list of URLs to be used
 for the OCSP servers attribute`,
 			},
+
+			"delta_crl_distribution_points": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma-separated list of URLs to be used
+for the freshest CRL attribute, pointing to delta CRLs`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -111,9 +117,10 @@ func (b *backend) pathWriteURL(ctx context.Context, req *logical.Request, data *
 	}
 	if entries == nil {
 		entries = &certutil.URLEntries{
-			IssuingCertificates:   []string{},
-			CRLDistributionPoints: []string{},
-			OCSPServers:           []string{},
+			IssuingCertificates:        []string{},
+			CRLDistributionPoints:      []string{},
+			OCSPServers:                []string{},
+			DeltaCRLDistributionPoints: []string{},
 		}
 	}
 
@@ -138,17 +145,26 @@ func (b *backend) pathWriteURL(ctx context.Context, req *logical.Request, data *
 				"invalid URL found in OCSP servers: %s", badURL)), nil
 		}
 	}
+	if urlsInt, ok := data.GetOk("delta_crl_distribution_points"); ok {
+		entries.DeltaCRLDistributionPoints = urlsInt.([]string)
+		if badURL := validateURLs(entries.DeltaCRLDistributionPoints); badURL != "" {
+			return logical.ErrorResponse(fmt.Sprintf(
+				"invalid URL found in delta CRL distribution points: %s", badURL)), nil
+		}
+	}
 
 	return nil, writeURLs(ctx, req, entries)
 }
 
 const pathConfigURLsHelpSyn = `
-Set the URLs for the issuing CA, CRL distribution points, and OCSP servers.
+Set the URLs for the issuing CA, CRL and delta CRL distribution points, and
+OCSP servers.
 `
 
 const pathConfigURLsHelpDesc = `
-This path allows you to set the issuing CA, CRL distribution points, and
-OCSP server URLs that will be encoded into issued certificates. If these
+This path allows you to set the issuing CA, CRL distribution points, delta
+CRL distribution points, and OCSP server URLs that will be encoded into issued
+certificates. If these
 values are not set, no such information will be encoded in the issued
 certificates. To delete URLs, simply re-set the appropriate value with an
 empty string.
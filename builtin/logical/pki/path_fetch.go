@@ -42,7 +42,7 @@ func pathFetchCAChain(b *backend) *framework.Path {
 // Returns the CRL in raw format
 func pathFetchCRL(b *backend) *framework.Path {
 	return &framework.Path{
-		Pattern: `crl(/pem)?`,
+		Pattern: `crl(/delta)?(/pem)?`,
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.ReadOperation: b.pathFetchRead,
@@ -78,7 +78,7 @@ hyphen-separated octal`,
 // This returns the CRL in a non-raw format
 func pathFetchCRLViaCertPath(b *backend) *framework.Path {
 	return &framework.Path{
-		Pattern: `cert/crl`,
+		Pattern: `cert/(delta-)?crl`,
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.ReadOperation: b.pathFetchRead,
@@ -114,6 +114,7 @@ func (b *backend) pathFetchCertList(ctx context.Context, req *logical.Request, d
 
 func (b *backend) pathFetchRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (response *logical.Response, retErr error) {
 	var serial, pemType, contentType string
+	issuerRef := defaultIssuerRef
 	var certEntry, revokedEntry *logical.StorageEntry
 	var funcErr error
 	var certificate []byte
@@ -145,9 +146,40 @@ func (b *backend) pathFetchRead(ctx context.Context, req *logical.Request, data
 		if req.Path == "crl/pem" {
 			pemType = "X509 CRL"
 		}
+	case req.Path == "crl/delta" || req.Path == "crl/delta/pem":
+		serial = "delta-crl"
+		contentType = "application/pkix-crl"
+		if req.Path == "crl/delta/pem" {
+			pemType = "X509 CRL"
+		}
 	case req.Path == "cert/crl":
 		serial = "crl"
 		pemType = "X509 CRL"
+	case req.Path == "cert/delta-crl":
+		serial = "delta-crl"
+		pemType = "X509 CRL"
+	case strings.HasPrefix(req.Path, "issuer/"):
+		issuerRef = data.Get("issuer_ref").(string)
+		switch strings.TrimPrefix(req.Path, "issuer/"+issuerRef+"/") {
+		case "crl", "crl/pem":
+			serial = "crl"
+			contentType = "application/pkix-crl"
+			if req.Path == "issuer/"+issuerRef+"/crl/pem" {
+				pemType = "X509 CRL"
+			}
+		case "crl/delta", "crl/delta/pem":
+			serial = "delta-crl"
+			contentType = "application/pkix-crl"
+			if req.Path == "issuer/"+issuerRef+"/crl/delta/pem" {
+				pemType = "X509 CRL"
+			}
+		default:
+			serial = "ca"
+			contentType = "application/pkix-cert"
+			if req.Path == "issuer/"+issuerRef+"/pem" {
+				pemType = "CERTIFICATE"
+			}
+		}
 	default:
 		serial = data.Get("serial").(string)
 		pemType = "CERTIFICATE"
@@ -158,7 +190,7 @@ func (b *backend) pathFetchRead(ctx context.Context, req *logical.Request, data
 	}
 
 	if serial == "ca_chain" {
-		caInfo, err := fetchCAInfo(ctx, req)
+		caInfo, err := fetchCAInfoByIssuer(ctx, req, issuerRef)
 		switch err.(type) {
 		case errutil.UserError:
 			response = logical.ErrorResponse(err.Error())
@@ -181,7 +213,11 @@ func (b *backend) pathFetchRead(ctx context.Context, req *logical.Request, data
 		goto reply
 	}
 
-	certEntry, funcErr = fetchCertBySerial(ctx, req, req.Path, serial)
+	if serial == "ca" || serial == "crl" || serial == "delta-crl" {
+		certEntry, funcErr = fetchIssuerCertOrCRL(ctx, req, issuerRef, serial)
+	} else {
+		certEntry, funcErr = fetchCertBySerial(ctx, req, req.Path, serial)
+	}
 	if funcErr != nil {
 		switch funcErr.(type) {
 		case errutil.UserError:
@@ -272,5 +308,12 @@ This allows certificates to be fetched. If using the fetch/ prefix any non-revok
 
 Using "ca" or "crl" as the value fetches the appropriate information in DER encoding. Add "/pem" to either to get PEM encoding.
 
+Using "crl/delta" fetches the delta CRL, if delta CRLs are enabled in "config/crl". Add "/pem" to get PEM encoding.
+
 Using "ca_chain" as the value fetches the certificate authority trust chain in PEM encoding.
+
+These refer to the default issuer; the certificate and CRL of any issuer can be fetched at
+"issuer/<issuer_ref>/pem", "issuer/<issuer_ref>/der", "issuer/<issuer_ref>/crl",
+"issuer/<issuer_ref>/crl/pem", "issuer/<issuer_ref>/crl/delta" and
+"issuer/<issuer_ref>/crl/delta/pem".
 `
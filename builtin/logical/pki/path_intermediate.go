@@ -2,8 +2,12 @@ package pki
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/pem"
 	"fmt"
+	"strings"
 
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/sdk/framework"
@@ -47,7 +51,8 @@ func pathSetSignedIntermediate(b *backend) *framework.Path {
 				Description: `PEM-format certificate. This must be a CA
 certificate with a public key matching the
 previously-generated key from the generation
-endpoint.`,
+endpoint, or the key of an existing issuer
+when cross-signing.`,
 			},
 		},
 
@@ -59,6 +64,35 @@ endpoint.`,
 		HelpDescription: pathSetSignedIntermediateHelpDesc,
 	}
 
+	ret.Fields = addIssuerNameField(ret.Fields)
+
+	return ret
+}
+
+func pathCrossSignIntermediate(b *backend) *framework.Path {
+	ret := &framework.Path{
+		Pattern: "intermediate/cross-sign",
+
+		Fields: map[string]*framework.FieldSchema{
+			"format": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "pem",
+				Description: `Format for the returned CSR. Can be "pem"
+or "der". Defaults to "pem".`,
+				AllowedValues: []interface{}{"pem", "der"},
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathCrossSignIntermediate,
+		},
+
+		HelpSynopsis:    pathCrossSignIntermediateHelpSyn,
+		HelpDescription: pathCrossSignIntermediateHelpDesc,
+	}
+
+	ret.Fields = addIssuerRefField(ret.Fields)
+
 	return ret
 }
 
@@ -130,7 +164,9 @@ func (b *backend) pathGenerateIntermediate(ctx context.Context, req *logical.Req
 	cb.PrivateKey = csrb.PrivateKey
 	cb.PrivateKeyType = csrb.PrivateKeyType
 
-	entry, err := logical.StorageEntryJSON("config/ca_bundle", cb)
+	// The key is kept aside until its certificate is set, leaving the
+	// current issuers in place
+	entry, err := logical.StorageEntryJSON("config/pending_key", cb)
 	if err != nil {
 		return nil, err
 	}
@@ -163,78 +199,136 @@ func (b *backend) pathSetSignedIntermediate(ctx context.Context, req *logical.Re
 		return logical.ErrorResponse("supplied certificate could not be successfully parsed"), nil
 	}
 
+	if !inputBundle.Certificate.IsCA {
+		return logical.ErrorResponse("the given certificate is not marked for CA use and cannot be used with this backend"), nil
+	}
+
+	// The certificate is either for the pending key, or for the key of an
+	// existing issuer that was cross-signed
+	pendingKey := true
 	cb := &certutil.CertBundle{}
-	entry, err := req.Storage.Get(ctx, "config/ca_bundle")
+	entry, err := req.Storage.Get(ctx, "config/pending_key")
 	if err != nil {
 		return nil, err
 	}
-	if entry == nil {
-		return logical.ErrorResponse("could not find any existing entry with a private key"), nil
+	if entry != nil {
+		if err := entry.DecodeJSON(cb); err != nil {
+			return nil, err
+		}
 	}
-
-	err = entry.DecodeJSON(cb)
-	if err != nil {
-		return nil, err
+	if len(cb.PrivateKey) == 0 || cb.PrivateKeyType == "" {
+		cb = nil
 	}
 
-	if len(cb.PrivateKey) == 0 || cb.PrivateKeyType == "" {
-		return logical.ErrorResponse("could not find an existing private key"), nil
+	var parsedCB *certutil.ParsedCertBundle
+	if cb != nil {
+		parsedCB, err = cb.ToParsedCertBundle()
+		if err != nil {
+			return nil, err
+		}
+		if parsedCB.PrivateKey == nil {
+			return nil, fmt.Errorf("saved key could not be parsed successfully")
+		}
 	}
+	if parsedCB == nil || !publicKeysEqual(parsedCB.PrivateKey.Public(), inputBundle.Certificate.PublicKey) {
+		pendingKey = false
+		parsedCB = nil
 
-	parsedCB, err := cb.ToParsedCertBundle()
-	if err != nil {
-		return nil, err
+		issuers, err := fetchIssuers(ctx, req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		for _, issuer := range issuers {
+			issuerCB, err := issuer.Bundle.ToParsedCertBundle()
+			if err != nil {
+				return nil, errwrap.Wrapf(fmt.Sprintf("error parsing issuer %s: {{err}}", issuer.ID), err)
+			}
+			if issuerCB.PrivateKey != nil && publicKeysEqual(issuerCB.PrivateKey.Public(), inputBundle.Certificate.PublicKey) {
+				parsedCB = issuerCB
+				break
+			}
+		}
 	}
-	if parsedCB.PrivateKey == nil {
-		return nil, fmt.Errorf("saved key could not be parsed successfully")
+	if parsedCB == nil {
+		if cb == nil {
+			return logical.ErrorResponse("could not find an existing private key"), nil
+		}
+		return logical.ErrorResponse("the public key of the certificate does not match the generated private key or the key of any issuer"), nil
 	}
 
 	inputBundle.PrivateKey = parsedCB.PrivateKey
 	inputBundle.PrivateKeyType = parsedCB.PrivateKeyType
 	inputBundle.PrivateKeyBytes = parsedCB.PrivateKeyBytes
 
-	if !inputBundle.Certificate.IsCA {
-		return logical.ErrorResponse("the given certificate is not marked for CA use and cannot be used with this backend"), nil
-	}
-
 	if err := inputBundle.Verify(); err != nil {
 		return nil, errwrap.Wrapf("verification of parsed bundle failed: {{err}}", err)
 	}
 
-	cb, err = inputBundle.ToCertBundle()
+	issuer, existing, err := importIssuer(ctx, req.Storage, inputBundle, data.Get("issuer_name").(string))
 	if err != nil {
-		return nil, errwrap.Wrapf("error converting raw values into cert bundle: {{err}}", err)
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
 	}
+	b.ocspCache.Flush()
 
-	entry, err = logical.StorageEntryJSON("config/ca_bundle", cb)
-	if err != nil {
-		return nil, err
+	if pendingKey {
+		if err := req.Storage.Delete(ctx, "config/pending_key"); err != nil {
+			return nil, err
+		}
 	}
-	err = req.Storage.Put(ctx, entry)
-	if err != nil {
-		return nil, err
+
+	// Build a fresh CRL for the new issuer
+	if !existing {
+		if err := buildCRL(ctx, b, req, true); err != nil {
+			return nil, err
+		}
 	}
 
-	entry.Key = "certs/" + normalizeSerial(cb.SerialNumber)
-	entry.Value = inputBundle.CertificateBytes
-	err = req.Storage.Put(ctx, entry)
-	if err != nil {
+	return addIssuerResponseData(ctx, req.Storage, nil, issuer)
+}
+
+// pathCrossSignIntermediate creates a CSR for the key and subject of an
+// existing issuer, so that another CA can cross-sign it. The resulting
+// certificate is imported through set-signed as a new issuer sharing the key.
+func (b *backend) pathCrossSignIntermediate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	format := data.Get("format").(string)
+	if format != "pem" && format != "der" {
+		return logical.ErrorResponse(`the "format" parameter must be "pem" or "der"`), nil
+	}
+
+	caInfo, err := fetchCAInfoByIssuer(ctx, req, data.Get("issuer_ref").(string))
+	switch err.(type) {
+	case errutil.UserError:
+		return logical.ErrorResponse(err.Error()), nil
+	case errutil.InternalError:
 		return nil, err
 	}
 
-	// For ease of later use, also store just the certificate at a known
-	// location
-	entry.Key = "ca"
-	entry.Value = inputBundle.CertificateBytes
-	err = req.Storage.Put(ctx, entry)
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		RawSubject: caInfo.Certificate.RawSubject,
+	}, caInfo.PrivateKey)
 	if err != nil {
-		return nil, err
+		return nil, errwrap.Wrapf("error creating CSR: {{err}}", err)
 	}
 
-	// Build a fresh CRL
-	err = buildCRL(ctx, b, req, true)
+	resp := &logical.Response{
+		Data: map[string]interface{}{},
+	}
+	switch format {
+	case "pem":
+		resp.Data["csr"] = strings.TrimSpace(string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE REQUEST",
+			Bytes: csr,
+		})))
+	case "der":
+		resp.Data["csr"] = base64.StdEncoding.EncodeToString(csr)
+	}
 
-	return nil, err
+	return resp, nil
 }
 
 const pathGenerateIntermediateHelpSyn = `
@@ -252,3 +346,11 @@ Provide the signed intermediate CA cert.
 const pathSetSignedIntermediateHelpDesc = `
 See the API documentation for more information.
 `
+
+const pathCrossSignIntermediateHelpSyn = `
+Generate a CSR for the key of an existing issuer, to be cross-signed.
+`
+
+const pathCrossSignIntermediateHelpDesc = `
+See the API documentation for more information.
+`
@@ -100,6 +100,12 @@ this value to an empty list.`,
 		Description: `A comma-separated string or list of extended key usage oids.`,
 	}
 
+	ret.Fields = addIssuerRefField(ret.Fields)
+	ret.Fields["issuer_ref"].Description = `Reference to the issuer signing the certificate:
+"default", an issuer ID or an issuer name.
+Defaults to the issuer of the role if one is
+given, otherwise to the default issuer.`
+
 	return ret
 }
 
@@ -167,6 +173,7 @@ func (b *backend) pathSignVerbatim(ctx context.Context, req *logical.Request, da
 		KeyUsage:             data.Get("key_usage").([]string),
 		ExtKeyUsage:          data.Get("ext_key_usage").([]string),
 		ExtKeyUsageOIDs:      data.Get("ext_key_usage_oids").([]string),
+		IssuerRef:            defaultIssuerRef,
 	}
 
 	*entry.GenerateLease = false
@@ -182,6 +189,10 @@ func (b *backend) pathSignVerbatim(ctx context.Context, req *logical.Request, da
 			*entry.GenerateLease = *role.GenerateLease
 		}
 		entry.NoStore = role.NoStore
+		entry.IssuerRef = role.IssuerRef
+	}
+	if issuerRef, ok := data.GetOk("issuer_ref"); ok {
+		entry.IssuerRef = issuerRef.(string)
 	}
 
 	return b.pathIssueSignCert(ctx, req, data, entry, true, true)
@@ -195,7 +206,7 @@ func (b *backend) pathIssueSignCert(ctx context.Context, req *logical.Request, d
 	}
 
 	var caErr error
-	signingBundle, caErr := fetchCAInfo(ctx, req)
+	signingBundle, caErr := fetchCAInfoByIssuer(ctx, req, role.IssuerRef)
 	switch caErr.(type) {
 	case errutil.UserError:
 		return nil, errutil.UserError{Err: fmt.Sprintf(
@@ -0,0 +1,285 @@
+package pki
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathListIssuers(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuers/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathIssuerList,
+		},
+
+		HelpSynopsis:    pathListIssuersHelpSyn,
+		HelpDescription: pathListIssuersHelpDesc,
+	}
+}
+
+func pathIssuers(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuers/" + framework.GenericNameRegex("issuer_ref"),
+		Fields: map[string]*framework.FieldSchema{
+			"issuer_ref": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Reference to the issuer: "default", an issuer
+ID or an issuer name.`,
+			},
+			"issuer_name": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Name of the issuer, unique within the mount.
+If set to an empty string, the name is removed.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathIssuerRead,
+			logical.UpdateOperation: b.pathIssuerWrite,
+			logical.DeleteOperation: b.pathIssuerDelete,
+		},
+
+		HelpSynopsis:    pathIssuersHelpSyn,
+		HelpDescription: pathIssuersHelpDesc,
+	}
+}
+
+func pathConfigIssuers(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/issuers",
+		Fields: map[string]*framework.FieldSchema{
+			"default": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Reference to the issuer used when no issuer is
+selected, by ID or name.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigIssuersRead,
+			logical.UpdateOperation: b.pathConfigIssuersWrite,
+		},
+
+		HelpSynopsis:    pathConfigIssuersHelpSyn,
+		HelpDescription: pathConfigIssuersHelpDesc,
+	}
+}
+
+// Returns the certificate or CRL of an issuer in raw format
+func pathFetchIssuer(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuer/" + framework.GenericNameRegex("issuer_ref") + "/(pem|der|crl|crl/pem|crl/delta|crl/delta/pem)",
+		Fields: map[string]*framework.FieldSchema{
+			"issuer_ref": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Reference to the issuer: "default", an issuer
+ID or an issuer name.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathFetchRead,
+		},
+
+		HelpSynopsis:    pathFetchHelpSyn,
+		HelpDescription: pathFetchHelpDesc,
+	}
+}
+
+func (b *backend) pathIssuerList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuers, err := fetchIssuers(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	config, err := fetchIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	keyInfo := map[string]interface{}{}
+	for _, issuer := range issuers {
+		keys = append(keys, issuer.ID)
+		keyInfo[issuer.ID] = map[string]interface{}{
+			"issuer_name": issuer.Name,
+			"is_default":  issuer.ID == config.DefaultIssuerID,
+		}
+	}
+
+	return logical.ListResponseWithInfo(keys, keyInfo), nil
+}
+
+func (b *backend) pathIssuerRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuer, err := resolveIssuerRef(ctx, req.Storage, data.Get("issuer_ref").(string))
+	if err != nil {
+		return nil, err
+	}
+	if issuer == nil {
+		return nil, nil
+	}
+	config, err := fetchIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	parsedBundle, err := issuer.Bundle.ToParsedCertBundle()
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("error parsing issuer %s: %v", issuer.ID, err)}
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"issuer_id":     issuer.ID,
+			"issuer_name":   issuer.Name,
+			"is_default":    issuer.ID == config.DefaultIssuerID,
+			"certificate":   issuer.Bundle.Certificate,
+			"serial_number": issuer.Bundle.SerialNumber,
+			"expiration":    parsedBundle.Certificate.NotAfter.Unix(),
+		},
+	}
+	if len(issuer.Bundle.CAChain) > 0 {
+		resp.Data["ca_chain"] = issuer.Bundle.CAChain
+	}
+
+	return resp, nil
+}
+
+func (b *backend) pathIssuerWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuer, err := resolveIssuerRef(ctx, req.Storage, data.Get("issuer_ref").(string))
+	if err != nil {
+		return nil, err
+	}
+	if issuer == nil {
+		return logical.ErrorResponse(fmt.Sprintf("issuer %q not found", data.Get("issuer_ref").(string))), nil
+	}
+
+	if nameRaw, ok := data.GetOk("issuer_name"); ok {
+		name := nameRaw.(string)
+		err := validateIssuerName(ctx, req.Storage, name, issuer.ID)
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		case errutil.InternalError:
+			return nil, err
+		}
+		issuer.Name = name
+	}
+
+	if err := writeIssuer(ctx, req.Storage, issuer); err != nil {
+		return nil, err
+	}
+
+	return b.pathIssuerRead(ctx, req, &framework.FieldData{
+		Raw: map[string]interface{}{
+			"issuer_ref": issuer.ID,
+		},
+		Schema: data.Schema,
+	})
+}
+
+func (b *backend) pathIssuerDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuer, err := resolveIssuerRef(ctx, req.Storage, data.Get("issuer_ref").(string))
+	if err != nil {
+		return nil, err
+	}
+	if issuer == nil {
+		return nil, nil
+	}
+
+	config, err := fetchIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config.DefaultIssuerID == issuer.ID {
+		return logical.ErrorResponse("the default issuer cannot be deleted; set another default issuer first, or delete the root to remove all issuers"), nil
+	}
+
+	if err := req.Storage.Delete(ctx, "issuers/"+issuer.ID); err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Delete(ctx, "crls/"+issuer.ID); err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Delete(ctx, "delta-crls/"+issuer.ID); err != nil {
+		return nil, err
+	}
+	b.ocspCache.Flush()
+
+	return nil, nil
+}
+
+func (b *backend) pathConfigIssuersRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := fetchIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"default": config.DefaultIssuerID,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigIssuersWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ref := data.Get("default").(string)
+	if ref == "" || ref == defaultIssuerRef {
+		return logical.ErrorResponse("an issuer ID or name must be provided in the \"default\" parameter"), nil
+	}
+
+	issuer, err := resolveIssuerRef(ctx, req.Storage, ref)
+	if err != nil {
+		return nil, err
+	}
+	if issuer == nil {
+		return logical.ErrorResponse(fmt.Sprintf("issuer %q not found", ref)), nil
+	}
+
+	config, err := fetchIssuersConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	config.DefaultIssuerID = issuer.ID
+	if err := writeIssuersConfig(ctx, req.Storage, config); err != nil {
+		return nil, err
+	}
+	b.ocspCache.Flush()
+
+	return b.pathConfigIssuersRead(ctx, req, data)
+}
+
+const pathListIssuersHelpSyn = `
+List the issuers of this mount.
+`
+
+const pathListIssuersHelpDesc = `
+This endpoint lists the IDs of the issuers of this mount, along with their
+names and whether they are the default issuer.
+`
+
+const pathIssuersHelpSyn = `
+Manage an issuer of this mount.
+`
+
+const pathIssuersHelpDesc = `
+An issuer is a CA certificate and private key able to issue certificates.
+Issuers are created by generating or rotating a root, importing a CA bundle,
+or setting the signed certificate of an intermediate, and can be referred to
+by ID, by name, or as "default" for the default issuer. This endpoint reads an
+issuer, updates its name, or deletes it. The default issuer cannot be deleted.
+`
+
+const pathConfigIssuersHelpSyn = `
+Configure the default issuer of this mount.
+`
+
+const pathConfigIssuersHelpDesc = `
+The default issuer is used by roles and endpoints that do not select an
+issuer, and is the CA served at the "ca", "ca_chain" and "crl" endpoints.
+Switching the default issuer allows rotating the CA without changing paths.
+`
@@ -0,0 +1,325 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func issuersRequest(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	t.Helper()
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: op,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: %s %s: err: %v resp: %#v", op, path, err, resp)
+	}
+	return resp
+}
+
+func issuersRequestError(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) {
+	t.Helper()
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: op,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected error: %s %s: resp: %#v", op, path, resp)
+	}
+}
+
+func fetchCRLSerials(t *testing.T, b *backend, s logical.Storage, path string) map[string]bool {
+	t.Helper()
+	resp := issuersRequest(t, b, s, logical.ReadOperation, path, nil)
+	crl, err := x509.ParseCRL(resp.Data[logical.HTTPRawBody].([]byte))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serials := map[string]bool{}
+	for _, revoked := range crl.TBSCertList.RevokedCertificates {
+		serials[revoked.SerialNumber.String()] = true
+	}
+	return serials
+}
+
+func TestPki_Issuers(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	rootData := map[string]interface{}{
+		"common_name": "myvault.com",
+		"key_type":    "ec",
+		"key_bits":    256,
+		"ttl":         "48h",
+		"issuer_name": "root-a",
+	}
+	resp := issuersRequest(t, b, storage, logical.UpdateOperation, "root/generate/internal", rootData)
+	idA := resp.Data["issuer_id"].(string)
+	certA := parsePEMCert(t, resp.Data["certificate"].(string))
+	if len(resp.Warnings) != 0 {
+		t.Fatalf("expected the first root to be the default: %v", resp.Warnings)
+	}
+
+	// Generating over an existing root is refused, but rotating is not
+	resp = issuersRequest(t, b, storage, logical.UpdateOperation, "root/generate/internal", rootData)
+	if len(resp.Warnings) == 0 || resp.Data != nil {
+		t.Fatalf("expected refusal, got %#v", resp)
+	}
+	issuersRequestError(t, b, storage, logical.UpdateOperation, "root/rotate/internal", rootData)
+	rootData["issuer_name"] = "root-b"
+	resp = issuersRequest(t, b, storage, logical.UpdateOperation, "root/rotate/internal", rootData)
+	idB := resp.Data["issuer_id"].(string)
+	serialB := resp.Data["serial_number"].(string)
+	certB := parsePEMCert(t, resp.Data["certificate"].(string))
+	if len(resp.Warnings) == 0 {
+		t.Fatal("expected a warning that the rotated root is not the default")
+	}
+
+	resp = issuersRequest(t, b, storage, logical.ListOperation, "issuers/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 2 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	keyInfo := resp.Data["key_info"].(map[string]interface{})
+	if !keyInfo[idA].(map[string]interface{})["is_default"].(bool) || keyInfo[idB].(map[string]interface{})["is_default"].(bool) {
+		t.Fatalf("bad default issuer: %#v", keyInfo)
+	}
+
+	resp = issuersRequest(t, b, storage, logical.ReadOperation, "issuers/root-b", nil)
+	if resp.Data["issuer_id"] != idB || resp.Data["is_default"].(bool) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	issuersRequestError(t, b, storage, logical.UpdateOperation, "issuers/root-b", map[string]interface{}{
+		"issuer_name": "root-a",
+	})
+	issuersRequestError(t, b, storage, logical.UpdateOperation, "issuers/root-b", map[string]interface{}{
+		"issuer_name": "default",
+	})
+
+	// Roles select their issuer
+	issuersRequest(t, b, storage, logical.UpdateOperation, "roles/a", map[string]interface{}{
+		"allowed_domains":  "myvault.com",
+		"allow_subdomains": true,
+		"key_type":         "ec",
+		"key_bits":         256,
+	})
+	issuersRequest(t, b, storage, logical.UpdateOperation, "roles/b", map[string]interface{}{
+		"allowed_domains":  "myvault.com",
+		"allow_subdomains": true,
+		"key_type":         "ec",
+		"key_bits":         256,
+		"issuer_ref":       "root-b",
+	})
+	issuersRequestError(t, b, storage, logical.UpdateOperation, "roles/c", map[string]interface{}{
+		"allowed_domains": "myvault.com",
+		"issuer_ref":      "missing",
+	})
+	resp = issuersRequest(t, b, storage, logical.ReadOperation, "roles/a", nil)
+	if resp.Data["issuer_ref"] != "default" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp = issuersRequest(t, b, storage, logical.UpdateOperation, "issue/a", map[string]interface{}{
+		"common_name": "a.myvault.com",
+	})
+	certFromA := parsePEMCert(t, resp.Data["certificate"].(string))
+	if err := certFromA.CheckSignatureFrom(certA); err != nil {
+		t.Fatalf("expected certificate issued by the default issuer: %v", err)
+	}
+	resp = issuersRequest(t, b, storage, logical.UpdateOperation, "issue/b", map[string]interface{}{
+		"common_name": "b.myvault.com",
+	})
+	certFromB := parsePEMCert(t, resp.Data["certificate"].(string))
+	if err := certFromB.CheckSignatureFrom(certB); err != nil {
+		t.Fatalf("expected certificate issued by the role's issuer: %v", err)
+	}
+
+	// Each issuer has its own CRL
+	issuersRequest(t, b, storage, logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": resp.Data["serial_number"],
+	})
+	if serials := fetchCRLSerials(t, b, storage, "issuer/root-b/crl"); !serials[certFromB.SerialNumber.String()] {
+		t.Fatalf("expected revoked certificate on the CRL of its issuer: %v", serials)
+	}
+	if serials := fetchCRLSerials(t, b, storage, "issuer/"+idA+"/crl"); len(serials) != 0 {
+		t.Fatalf("expected empty CRL for the other issuer: %v", serials)
+	}
+	if serials := fetchCRLSerials(t, b, storage, "crl"); len(serials) != 0 {
+		t.Fatalf("expected empty CRL for the default issuer: %v", serials)
+	}
+	issuersRequestError(t, b, storage, logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": serialB,
+	})
+
+	// Switching the default issuer changes the CA served at the fixed paths
+	resp = issuersRequest(t, b, storage, logical.UpdateOperation, "config/issuers", map[string]interface{}{
+		"default": "root-b",
+	})
+	if resp.Data["default"] != idB {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = issuersRequest(t, b, storage, logical.ReadOperation, "ca", nil)
+	if !bytes.Equal(certB.Raw, resp.Data[logical.HTTPRawBody].([]byte)) {
+		t.Fatal("expected the new default issuer at the ca path")
+	}
+	if serials := fetchCRLSerials(t, b, storage, "crl"); !serials[certFromB.SerialNumber.String()] {
+		t.Fatalf("expected the CRL of the new default issuer: %v", serials)
+	}
+	resp = issuersRequest(t, b, storage, logical.ReadOperation, "issuer/root-a/pem", nil)
+	if !certA.Equal(parsePEMCert(t, string(resp.Data[logical.HTTPRawBody].([]byte)))) {
+		t.Fatal("expected the certificate of the named issuer")
+	}
+	resp = issuersRequest(t, b, storage, logical.UpdateOperation, "issue/a", map[string]interface{}{
+		"common_name": "a.myvault.com",
+	})
+	if err := parsePEMCert(t, resp.Data["certificate"].(string)).CheckSignatureFrom(certB); err != nil {
+		t.Fatalf("expected certificate issued by the new default issuer: %v", err)
+	}
+
+	// The default issuer cannot be deleted, others can
+	issuersRequestError(t, b, storage, logical.DeleteOperation, "issuers/root-b", nil)
+	issuersRequest(t, b, storage, logical.DeleteOperation, "issuers/root-a", nil)
+	resp = issuersRequest(t, b, storage, logical.ListOperation, "issuers/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != idB {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Deleting the root removes all issuers
+	issuersRequest(t, b, storage, logical.DeleteOperation, "root", nil)
+	resp = issuersRequest(t, b, storage, logical.ListOperation, "issuers/", nil)
+	if len(resp.Data) != 0 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestPki_IssuersCrossSign(t *testing.T) {
+	rootB, rootStorage := createBackendWithStorage(t)
+	intB, intStorage := createBackendWithStorage(t)
+
+	issuersRequest(t, rootB, rootStorage, logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "root.myvault.com",
+		"key_type":    "ec",
+		"key_bits":    256,
+	})
+	resp := issuersRequest(t, rootB, rootStorage, logical.UpdateOperation, "root/rotate/internal", map[string]interface{}{
+		"common_name": "new-root.myvault.com",
+		"key_type":    "ec",
+		"key_bits":    256,
+		"issuer_name": "new-root",
+	})
+	newRoot := parsePEMCert(t, resp.Data["certificate"].(string))
+
+	resp = issuersRequest(t, intB, intStorage, logical.UpdateOperation, "intermediate/generate/internal", map[string]interface{}{
+		"common_name": "int.myvault.com",
+		"key_type":    "ec",
+		"key_bits":    256,
+	})
+	resp = issuersRequest(t, rootB, rootStorage, logical.UpdateOperation, "root/sign-intermediate", map[string]interface{}{
+		"csr":    resp.Data["csr"],
+		"format": "pem_bundle",
+	})
+	resp = issuersRequest(t, intB, intStorage, logical.UpdateOperation, "intermediate/set-signed", map[string]interface{}{
+		"certificate": resp.Data["certificate"],
+		"issuer_name": "int",
+	})
+	intID := resp.Data["issuer_id"].(string)
+	if len(resp.Warnings) != 0 {
+		t.Fatalf("expected the intermediate to be the default: %v", resp.Warnings)
+	}
+	if entry, err := intStorage.Get(context.Background(), "config/pending_key"); err != nil || entry != nil {
+		t.Fatalf("expected the pending key to be removed: %v", err)
+	}
+
+	// Have the intermediate key cross-signed by the new root
+	resp = issuersRequest(t, intB, intStorage, logical.UpdateOperation, "intermediate/cross-sign", map[string]interface{}{
+		"issuer_ref": "int",
+	})
+	resp = issuersRequest(t, rootB, rootStorage, logical.UpdateOperation, "root/sign-intermediate", map[string]interface{}{
+		"csr":        resp.Data["csr"],
+		"format":     "pem_bundle",
+		"issuer_ref": "new-root",
+	})
+	crossSigned := parsePEMCert(t, resp.Data["certificate"].(string))
+	if err := crossSigned.CheckSignatureFrom(newRoot); err != nil {
+		t.Fatalf("expected the intermediate signed by the selected issuer: %v", err)
+	}
+	if crossSigned.Subject.CommonName != "int.myvault.com" {
+		t.Fatalf("bad subject: %v", crossSigned.Subject)
+	}
+
+	resp = issuersRequest(t, intB, intStorage, logical.UpdateOperation, "intermediate/set-signed", map[string]interface{}{
+		"certificate": resp.Data["certificate"],
+		"issuer_name": "int-cross",
+	})
+	if resp.Data["issuer_id"] == intID || len(resp.Warnings) == 0 {
+		t.Fatalf("expected a new issuer that is not the default: %#v", resp)
+	}
+
+	// Both issuers share the key, so they issue interchangeable certificates
+	resp = issuersRequest(t, intB, intStorage, logical.ReadOperation, "issuers/int-cross", nil)
+	if !strings.Contains(resp.Data["certificate"].(string), "CERTIFICATE") {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = issuersRequest(t, intB, intStorage, logical.ListOperation, "issuers/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 2 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestPki_IssuersMigration(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	resp := issuersRequest(t, b, storage, logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "myvault.com",
+		"key_type":    "ec",
+		"key_bits":    256,
+	})
+	caCert := parsePEMCert(t, resp.Data["certificate"].(string))
+	issuer, err := resolveIssuerRef(context.Background(), storage, defaultIssuerRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Store the CA bundle as earlier versions did
+	b, storage = createBackendWithStorage(t)
+	entry, err := logical.StorageEntryJSON("config/ca_bundle", issuer.Bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Put(context.Background(), entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.initialize(context.Background(), &logical.InitializationRequest{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+
+	if entry, err := storage.Get(context.Background(), "config/ca_bundle"); err != nil || entry != nil {
+		t.Fatalf("expected the CA bundle to be removed: %v", err)
+	}
+	caInfo, err := fetchCAInfo(context.Background(), &logical.Request{Storage: storage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !caInfo.Certificate.Equal(caCert) {
+		t.Fatal("expected the CA to be migrated to the default issuer")
+	}
+	if serials := fetchCRLSerials(t, b, storage, "crl"); len(serials) != 0 {
+		t.Fatalf("bad: %v", serials)
+	}
+
+	// Migrating again is a no-op
+	if err := b.initialize(context.Background(), &logical.InitializationRequest{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	resp = issuersRequest(t, b, storage, logical.ListOperation, "issuers/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
@@ -0,0 +1,255 @@
+package pki
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/crypto/ocsp"
+)
+
+const ocspResponseContentType = "application/ocsp-response"
+
+// Answers OCSP requests sent with POST, whose DER encoded body is passed to
+// the backend base64 encoded
+func pathOCSP(b *backend) *framework.Path {
+	return buildPathOCSP(b, `ocsp`)
+}
+
+// Answers OCSP requests sent with GET, which carry the base64 encoded request
+// in the path
+func pathOCSPGet(b *backend) *framework.Path {
+	return buildPathOCSP(b, `ocsp/(?P<request>.+)`)
+}
+
+func buildPathOCSP(b *backend, pattern string) *framework.Path {
+	return &framework.Path{
+		Pattern: pattern,
+		Fields: map[string]*framework.FieldSchema{
+			"request": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Base64 encoded DER OCSP request`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathOCSPRead,
+			logical.UpdateOperation: b.pathOCSPRead,
+		},
+
+		HelpSynopsis:    pathOCSPHelpSyn,
+		HelpDescription: pathOCSPHelpDesc,
+	}
+}
+
+func (b *backend) pathOCSPRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// OCSP errors are reported through the status of the OCSP response, so
+	// the response is always successful at the HTTP level
+	respond := func(body []byte) (*logical.Response, error) {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				logical.HTTPContentType: ocspResponseContentType,
+				logical.HTTPRawBody:     body,
+				logical.HTTPStatusCode:  200,
+			},
+		}, nil
+	}
+
+	der, err := base64.StdEncoding.DecodeString(data.Get("request").(string))
+	if err != nil || len(der) == 0 {
+		return respond(ocsp.MalformedRequestErrorResponse)
+	}
+	ocspReq, err := ocsp.ParseRequest(der)
+	if err != nil {
+		return respond(ocsp.MalformedRequestErrorResponse)
+	}
+
+	body, err := b.ocspResponse(ctx, req, ocspReq)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			b.Logger().Debug("refusing OCSP request", "error", err)
+			return respond(ocsp.UnauthorizedErrorResponse)
+		default:
+			b.Logger().Error("failed to answer OCSP request", "error", err)
+			return respond(ocsp.InternalErrorErrorResponse)
+		}
+	}
+	return respond(body)
+}
+
+// ocspResponse returns the signed OCSP response for a parsed request, from
+// the cache if possible. User errors are reported to the client as
+// unauthorized and internal errors as such.
+func (b *backend) ocspResponse(ctx context.Context, req *logical.Request, ocspReq *ocsp.Request) ([]byte, error) {
+	config, err := b.OCSP(ctx, req.Storage)
+	if err != nil {
+		return nil, errwrap.Wrapf("error fetching OCSP configuration: {{err}}", err)
+	}
+	if config == nil {
+		config = &ocspConfig{
+			Expiry: defaultOCSPExpiry,
+		}
+	}
+	if config.Disable {
+		return nil, errutil.UserError{Err: "the OCSP responder is disabled"}
+	}
+	expiry, err := time.ParseDuration(config.Expiry)
+	if err != nil {
+		return nil, errwrap.Wrapf(fmt.Sprintf("error parsing OCSP expiry of %s: {{err}}", config.Expiry), err)
+	}
+
+	if !ocspReq.HashAlgorithm.Available() {
+		return nil, errutil.UserError{Err: "unsupported issuer hash algorithm"}
+	}
+	serial := certutil.GetHexFormatted(ocspReq.SerialNumber.Bytes(), ":")
+	cacheKey := fmt.Sprintf("%d/%x/%x/%s", ocspReq.HashAlgorithm, ocspReq.IssuerNameHash, ocspReq.IssuerKeyHash, serial)
+	if cached, ok := b.ocspCache.Get(cacheKey); ok {
+		return cached.([]byte), nil
+	}
+
+	caInfo, err := ocspRequestIssuer(ctx, req, ocspReq)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	template := ocsp.Response{
+		SerialNumber: ocspReq.SerialNumber,
+		ThisUpdate:   now,
+		IssuerHash:   ocspReq.HashAlgorithm,
+	}
+	if expiry > 0 {
+		template.NextUpdate = now.Add(expiry)
+	}
+
+	revEntry, err := fetchCertBySerial(ctx, req, "revoked/", serial)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case revEntry != nil:
+		var revInfo revocationInfo
+		if err := revEntry.DecodeJSON(&revInfo); err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("error decoding revocation entry for serial %s: {{err}}", serial), err)
+		}
+		template.Status = ocsp.Revoked
+		template.RevocationReason = ocsp.Unspecified
+		if !revInfo.RevocationTimeUTC.IsZero() {
+			template.RevokedAt = revInfo.RevocationTimeUTC
+		} else {
+			template.RevokedAt = time.Unix(revInfo.RevocationTime, 0).UTC()
+		}
+	default:
+		certEntry, err := fetchCertBySerial(ctx, req, "certs/", serial)
+		if err != nil {
+			return nil, err
+		}
+		if certEntry != nil {
+			template.Status = ocsp.Good
+		} else {
+			template.Status = ocsp.Unknown
+		}
+	}
+
+	// Sign with the delegated responder if one is configured and still
+	// authorized by the CA, otherwise with the CA itself
+	var responderCert *x509.Certificate
+	var signer crypto.Signer = caInfo.PrivateKey
+	if config.ResponderBundle != nil {
+		responder, err := config.ResponderBundle.ToParsedCertBundle()
+		if err != nil {
+			return nil, errwrap.Wrapf("error parsing OCSP responder bundle: {{err}}", err)
+		}
+		switch {
+		case validateOCSPResponder(responder.Certificate, caInfo.Certificate) != nil:
+			b.Logger().Debug("OCSP responder certificate was not issued by the issuer of the certificate, signing with the issuer")
+		case now.After(responder.Certificate.NotAfter):
+			b.Logger().Warn("OCSP responder certificate has expired, signing with the CA")
+		default:
+			responderCert = responder.Certificate
+			signer = responder.PrivateKey
+			template.Certificate = responder.Certificate
+		}
+	}
+	if responderCert == nil {
+		responderCert = caInfo.Certificate
+	}
+
+	body, err := ocsp.CreateResponse(caInfo.Certificate, responderCert, template, signer)
+	if err != nil {
+		return nil, errwrap.Wrapf("error creating OCSP response: {{err}}", err)
+	}
+
+	// Responses are cached for half their validity so that clients caching
+	// them until their next update are not served stale responses for long
+	if expiry > 0 {
+		b.ocspCache.Set(cacheKey, body, expiry/2)
+	}
+
+	return body, nil
+}
+
+// ocspRequestIssuer returns the CA info of the issuer of the certificate
+// whose status is requested
+func ocspRequestIssuer(ctx context.Context, req *logical.Request, ocspReq *ocsp.Request) (*certutil.CAInfoBundle, error) {
+	issuers, err := fetchIssuers(ctx, req.Storage)
+	if err != nil {
+		return nil, errwrap.Wrapf("error fetching issuers: {{err}}", err)
+	}
+	for _, issuer := range issuers {
+		caInfo, err := fetchCAInfoByIssuer(ctx, req, issuer.ID)
+		if err != nil {
+			return nil, err
+		}
+		if ocspRequestMatchesIssuer(ocspReq, caInfo.Certificate) {
+			return caInfo, nil
+		}
+	}
+	return nil, errutil.UserError{Err: "certificate was not issued by this CA"}
+}
+
+// ocspRequestMatchesIssuer checks that the issuer name and key hashes of a
+// request are those of the CA, see RFC 6960 section 4.1.1
+func ocspRequestMatchesIssuer(ocspReq *ocsp.Request, ca *x509.Certificate) bool {
+	var spki struct {
+		Algorithm asn1.RawValue
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(ca.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return false
+	}
+
+	h := ocspReq.HashAlgorithm.New()
+	h.Write(ca.RawSubject)
+	nameHash := h.Sum(nil)
+
+	h.Reset()
+	h.Write(spki.PublicKey.RightAlign())
+	keyHash := h.Sum(nil)
+
+	return bytes.Equal(nameHash, ocspReq.IssuerNameHash) && bytes.Equal(keyHash, ocspReq.IssuerKeyHash)
+}
+
+const pathOCSPHelpSyn = `
+Query the revocation status of a certificate with OCSP.
+`
+
+const pathOCSPHelpDesc = `
+This endpoint is an OCSP responder as described in RFC 6960. OCSP requests can
+be sent DER encoded in the body of a POST request with a content type of
+"application/ocsp-request", or base64 encoded in the path of a GET request.
+Responses are signed by the issuer of the certificate, or by the delegated
+responder set in "config/ocsp" if it was issued by the same CA, and are cached
+for half their validity.
+`
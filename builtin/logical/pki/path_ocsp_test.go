@@ -0,0 +1,244 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestBackend_OCSP(t *testing.T) {
+	coreConfig := &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"pki": Factory,
+		},
+	}
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	client := cluster.Cores[0].Client
+	err := client.Sys().Mount("pki", &api.MountInput{
+		Type: "pki",
+		Config: api.MountConfigInput{
+			DefaultLeaseTTL: "16h",
+			MaxLeaseTTL:     "60h",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Logical().Write("pki/root/generate/internal", map[string]interface{}{
+		"ttl":         "40h",
+		"common_name": "myvault.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert := parsePEMCert(t, resp.Data["certificate"].(string))
+
+	_, err = client.Logical().Write("pki/roles/test", map[string]interface{}{
+		"allow_bare_domains": true,
+		"allow_subdomains":   true,
+		"allowed_domains":    "foobar.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = client.Logical().Write("pki/issue/test", map[string]interface{}{
+		"common_name": "test.foobar.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial := resp.Data["serial_number"].(string)
+	cert := parsePEMCert(t, resp.Data["certificate"].(string))
+
+	// The responder is unauthenticated
+	client.ClearToken()
+	defer client.SetToken(cluster.RootToken)
+
+	post := func(cert *x509.Certificate, hash crypto.Hash) *ocsp.Response {
+		t.Helper()
+		ocspReq, err := ocsp.CreateRequest(cert, caCert, &ocsp.RequestOptions{Hash: hash})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := client.NewRequest("POST", "/v1/pki/ocsp")
+		req.Headers = http.Header{"Content-Type": []string{"application/ocsp-request"}}
+		req.BodyBytes = ocspReq
+		return doOCSPRequest(t, client, req, caCert)
+	}
+	get := func(cert *x509.Certificate) *ocsp.Response {
+		t.Helper()
+		ocspReq, err := ocsp.CreateRequest(cert, caCert, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := client.NewRequest("GET", "/v1/pki/ocsp")
+		// Set the path directly since building the request would clean any
+		// "//" in the base64 encoded request
+		req.URL.Path = "/v1/pki/ocsp/" + base64.StdEncoding.EncodeToString(ocspReq)
+		return doOCSPRequest(t, client, req, caCert)
+	}
+
+	for _, ocspResp := range []*ocsp.Response{post(cert, crypto.SHA1), post(cert, crypto.SHA256), get(cert)} {
+		if ocspResp.Status != ocsp.Good {
+			t.Fatalf("expected good status, got %d", ocspResp.Status)
+		}
+		if ocspResp.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+			t.Fatalf("bad serial number %v", ocspResp.SerialNumber)
+		}
+		if ocspResp.NextUpdate.IsZero() {
+			t.Fatal("expected next update to be set")
+		}
+	}
+
+	// Unknown certificates
+	unknown := *cert
+	unknown.SerialNumber = new(big.Int).Add(cert.SerialNumber, big.NewInt(1))
+	if ocspResp := post(&unknown, crypto.SHA1); ocspResp.Status != ocsp.Unknown {
+		t.Fatalf("expected unknown status, got %d", ocspResp.Status)
+	}
+
+	// Revocation is reflected immediately despite the cached response
+	client.SetToken(cluster.RootToken)
+	if _, err := client.Logical().Write("pki/revoke", map[string]interface{}{
+		"serial_number": serial,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	client.ClearToken()
+	ocspResp := post(cert, crypto.SHA1)
+	if ocspResp.Status != ocsp.Revoked {
+		t.Fatalf("expected revoked status, got %d", ocspResp.Status)
+	}
+	if ocspResp.RevokedAt.IsZero() {
+		t.Fatal("expected revocation time to be set")
+	}
+
+	// Delegate signing to a responder issued by the CA
+	client.SetToken(cluster.RootToken)
+	if _, err := client.Logical().Write("pki/roles/ocsp", map[string]interface{}{
+		"allowed_domains":    "foobar.com",
+		"allow_bare_domains": true,
+		"server_flag":        false,
+		"client_flag":        false,
+		"ext_key_usage":      "OCSPSigning",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = client.Logical().Write("pki/issue/ocsp", map[string]interface{}{
+		"common_name": "foobar.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	responderCert := resp.Data["certificate"].(string)
+	if _, err := client.Logical().Write("pki/config/ocsp", map[string]interface{}{
+		"pem_bundle": resp.Data["private_key"].(string) + "\n" + responderCert,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = client.Logical().Read("pki/config/ocsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["responder_certificate"] != responderCert {
+		t.Fatalf("bad responder certificate: %#v", resp.Data)
+	}
+	client.ClearToken()
+	ocspResp = post(cert, crypto.SHA1)
+	if ocspResp.Status != ocsp.Revoked {
+		t.Fatalf("expected revoked status, got %d", ocspResp.Status)
+	}
+	if ocspResp.Certificate == nil || !ocspResp.Certificate.Equal(parsePEMCert(t, responderCert)) {
+		t.Fatal("expected the response to be signed by the delegated responder")
+	}
+
+	// Certificates without the OCSP signing usage are rejected as responders
+	client.SetToken(cluster.RootToken)
+	resp, err = client.Logical().Write("pki/issue/test", map[string]interface{}{
+		"common_name": "test.foobar.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Logical().Write("pki/config/ocsp", map[string]interface{}{
+		"pem_bundle": resp.Data["private_key"].(string) + "\n" + resp.Data["certificate"].(string),
+	}); err == nil {
+		t.Fatal("expected error configuring a responder without the OCSP signing usage")
+	}
+
+	// A disabled responder refuses requests
+	if _, err := client.Logical().Write("pki/config/ocsp", map[string]interface{}{
+		"disable": true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	client.ClearToken()
+	ocspReq, err := ocsp.CreateRequest(cert, caCert, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := client.NewRequest("POST", "/v1/pki/ocsp")
+	req.Headers = http.Header{"Content-Type": []string{"application/ocsp-request"}}
+	req.BodyBytes = ocspReq
+	body := rawOCSPResponse(t, client, req)
+	if _, err := ocsp.ParseResponse(body, caCert); err == nil || !strings.Contains(err.Error(), "unauthorized") {
+		t.Fatalf("expected unauthorized response, got %v", err)
+	}
+}
+
+func parsePEMCert(t *testing.T, certPEM string) *x509.Certificate {
+	t.Helper()
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		t.Fatalf("failed to decode certificate %q", certPEM)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func rawOCSPResponse(t *testing.T, client *api.Client, req *api.Request) []byte {
+	t.Helper()
+	resp, err := client.RawRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/ocsp-response" {
+		t.Fatalf("bad content type %q", ct)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func doOCSPRequest(t *testing.T, client *api.Client, req *api.Request, caCert *x509.Certificate) *ocsp.Response {
+	t.Helper()
+	ocspResp, err := ocsp.ParseResponse(rawOCSPResponse(t, client, req), caCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ocspResp
+}
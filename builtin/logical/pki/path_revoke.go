@@ -66,8 +66,8 @@ func (b *backend) pathRevokeWrite(ctx context.Context, req *logical.Request, dat
 }
 
 func (b *backend) pathRotateCRLRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	b.revokeStorageLock.RLock()
-	defer b.revokeStorageLock.RUnlock()
+	b.revokeStorageLock.Lock()
+	defer b.revokeStorageLock.Unlock()
 
 	crlErr := buildCRL(ctx, b, req, false)
 	switch crlErr.(type) {
@@ -97,5 +97,5 @@ Force a rebuild of the CRL.
 `
 
 const pathRotateCRLHelpDesc = `
-Force a rebuild of the CRL. This can be used to remove expired certificates from it if no certificates have been revoked. A root token is required.
+Force a rebuild of the CRL. This can be used to remove expired certificates from it if no certificates have been revoked, or to include the certificates revoked since the last rebuild when the CRL is rebuilt automatically. Delta CRLs are rebuilt along with it. A root token is required.
 `
@@ -80,6 +80,15 @@ information. This parameter accepts a comma-separated
 string or list of domains.`,
 			},
 
+			"allowed_domains_template": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `If set, Allowed domains can be specified using
+identity templates such as "{{identity.entity.metadata.domain}}".
+Templates that cannot be populated from the entity of the requester
+are ignored.`,
+				Default: false,
+			},
+
 			"allow_bare_domains": &framework.FieldSchema{
 				Type: framework.TypeBool,
 				Description: `If set, clients can request certificates
@@ -312,6 +321,30 @@ this value in certificates issued by this role.`,
 this value in certificates issued by this role.`,
 			},
 
+			"subject_template": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `If set, the OU, Organization, Country, Locality,
+Province, Street Address and Postal Code of the role can be
+specified using identity templates such as
+"{{identity.entity.metadata.team}}". Requests fail if a
+template cannot be populated from the entity of the requester.`,
+			},
+
+			"custom_extensions": &framework.FieldSchema{
+				Type: framework.TypeStringSlice,
+				Description: `A list of extensions to add to certificates
+issued by this role, in the format <oid>;<type>:<value>. Valid
+types are "utf8", "ia5", "printable", "int", "bool", "oid" and
+"der" for a base64 encoded DER value. Values can contain
+identity templates such as "{{identity.entity.name}}".`,
+			},
+
+			"critical_custom_extensions": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `The OIDs of the custom extensions to mark
+as critical.`,
+			},
+
 			"generate_lease": &framework.FieldSchema{
 				Type: framework.TypeBool,
 				Description: `
@@ -365,6 +398,15 @@ for "generate_lease".`,
 					Value: 30,
 				},
 			},
+
+			"issuer_ref": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: defaultIssuerRef,
+				Description: `Reference to the issuer of certificates issued
+and signed against this role: "default", an
+issuer ID or an issuer name. Defaults to the
+default issuer of the mount.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -447,6 +489,11 @@ func (b *backend) getRole(ctx context.Context, s logical.Storage, n string) (*ro
 		modified = true
 	}
 
+	// Roles predating issuers use the default issuer; this needs no upgrade
+	if result.IssuerRef == "" {
+		result.IssuerRef = defaultIssuerRef
+	}
+
 	// Upgrade generate_lease in role
 	if result.GenerateLease == nil {
 		// All the new roles will have GenerateLease always set to a value. A
@@ -573,6 +620,11 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 		PolicyIdentifiers:             data.Get("policy_identifiers").([]string),
 		BasicConstraintsValidForNonCA: data.Get("basic_constraints_valid_for_non_ca").(bool),
 		NotBeforeDuration:             time.Duration(data.Get("not_before_duration").(int)) * time.Second,
+		IssuerRef:                     data.Get("issuer_ref").(string),
+		AllowedDomainsTemplate:        data.Get("allowed_domains_template").(bool),
+		SubjectTemplate:               data.Get("subject_template").(bool),
+		CustomExtensions:              data.Get("custom_extensions").([]string),
+		CriticalCustomExtensions:      data.Get("critical_custom_extensions").([]string),
 	}
 
 	otherSANs := data.Get("allowed_other_sans").([]string)
@@ -623,6 +675,20 @@ func (b *backend) pathRoleCreate(ctx context.Context, req *logical.Request, data
 		}
 	}
 
+	if err := validateRoleTemplates(entry); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if entry.IssuerRef != defaultIssuerRef {
+		issuer, err := resolveIssuerRef(ctx, req.Storage, entry.IssuerRef)
+		if err != nil {
+			return nil, err
+		}
+		if issuer == nil {
+			return logical.ErrorResponse(fmt.Sprintf("issuer %q not found", entry.IssuerRef)), nil
+		}
+	}
+
 	// Store it
 	jsonEntry, err := logical.StorageEntryJSON("role/"+name, entry)
 	if err != nil {
@@ -764,6 +830,11 @@ type roleEntry struct {
 	ExtKeyUsageOIDs               []string      `json:"ext_key_usage_oids" mapstructure:"ext_key_usage_oids"`
 	BasicConstraintsValidForNonCA bool          `json:"basic_constraints_valid_for_non_ca" mapstructure:"basic_constraints_valid_for_non_ca"`
 	NotBeforeDuration             time.Duration `json:"not_before_duration" mapstructure:"not_before_duration"`
+	IssuerRef                     string        `json:"issuer_ref" mapstructure:"issuer_ref"`
+	AllowedDomainsTemplate        bool          `json:"allowed_domains_template" mapstructure:"allowed_domains_template"`
+	SubjectTemplate               bool          `json:"subject_template" mapstructure:"subject_template"`
+	CustomExtensions              []string      `json:"custom_extensions" mapstructure:"custom_extensions"`
+	CriticalCustomExtensions      []string      `json:"critical_custom_extensions" mapstructure:"critical_custom_extensions"`
 
 	// Used internally for signing intermediates
 	AllowExpirationPastCA bool
@@ -808,6 +879,11 @@ func (r *roleEntry) ToResponseData() map[string]interface{} {
 		"policy_identifiers":                 r.PolicyIdentifiers,
 		"basic_constraints_valid_for_non_ca": r.BasicConstraintsValidForNonCA,
 		"not_before_duration":                int64(r.NotBeforeDuration.Seconds()),
+		"issuer_ref":                         r.IssuerRef,
+		"allowed_domains_template":           r.AllowedDomainsTemplate,
+		"subject_template":                   r.SubjectTemplate,
+		"custom_extensions":                  r.CustomExtensions,
+		"critical_custom_extensions":         r.CriticalCustomExtensions,
 	}
 	if r.MaxPathLength != nil {
 		responseData["max_path_length"] = r.MaxPathLength
@@ -818,6 +894,19 @@ func (r *roleEntry) ToResponseData() map[string]interface{} {
 	return responseData
 }
 
+// subjectAttributes returns the subject attributes of the role by field name
+func (r *roleEntry) subjectAttributes() map[string]*[]string {
+	return map[string]*[]string{
+		"ou":             &r.OU,
+		"organization":   &r.Organization,
+		"country":        &r.Country,
+		"locality":       &r.Locality,
+		"province":       &r.Province,
+		"street_address": &r.StreetAddress,
+		"postal_code":    &r.PostalCode,
+	}
+}
+
 const pathListRolesHelpSyn = `List the existing roles in this backend`
 
 const pathListRolesHelpDesc = `Roles will be listed by the role name.`
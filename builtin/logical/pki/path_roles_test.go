@@ -1,7 +1,12 @@
 package pki
 
 import (
+	"bytes"
 	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
 	"testing"
 	"time"
 
@@ -739,3 +744,178 @@ func TestPki_CertsLease(t *testing.T) {
 		t.Fatalf("expected a response that contains a secret")
 	}
 }
+
+func TestPki_RoleTemplating(t *testing.T) {
+	var resp *logical.Response
+	var err error
+
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	config.System = &logical.StaticSystemView{
+		DefaultLeaseTTLVal: time.Hour * 24,
+		MaxLeaseTTLVal:     time.Hour * 24 * 32,
+		EntityVal: &logical.Entity{
+			ID:   "entity-id",
+			Name: "alice",
+			Metadata: map[string]string{
+				"team": "payments",
+			},
+		},
+	}
+	b := Backend(config)
+	if err := b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	storage := config.StorageView
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "root/generate/internal",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"common_name": "example.com",
+			"ttl":         "5h",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	// Invalid templates and extensions are rejected
+	for _, roleData := range []map[string]interface{}{
+		{
+			"allowed_domains":          "{{identity.entity.name.example.com",
+			"allowed_domains_template": true,
+		},
+		{
+			"ou":               "{{identity.entity.name",
+			"subject_template": true,
+		},
+		{
+			"custom_extensions": "2.5.29.19;DER:MAMBAf8=",
+		},
+		{
+			"custom_extensions": "1.2.3.4;FLOAT:1.5",
+		},
+		{
+			"custom_extensions": "1.2.3.4;INT:one",
+		},
+		{
+			"custom_extensions":          "1.2.3.4;UTF8:foo",
+			"critical_custom_extensions": "1.2.3.5",
+		},
+	} {
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/invalid",
+			Storage:   storage,
+			Data:      roleData,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("expected an error for role data %v, got: %#v", roleData, resp)
+		}
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/templated",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"allowed_domains":            "{{identity.entity.metadata.team}}.example.com,{{identity.entity.metadata.missing}}.example.com",
+			"allowed_domains_template":   true,
+			"allow_subdomains":           true,
+			"ou":                         "{{identity.entity.name}}",
+			"subject_template":           true,
+			"custom_extensions":          []string{"1.2.3.4;UTF8:{{identity.entity.metadata.team}}", "1.2.3.5;INT:42"},
+			"critical_custom_extensions": "1.2.3.4",
+			"ttl":                        "1h",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	issue := func(cn string) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "issue/templated",
+			Storage:   storage,
+			EntityID:  "entity-id",
+			Data: map[string]interface{}{
+				"common_name": cn,
+			},
+		})
+	}
+
+	resp, err = issue("foo.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error issuing a certificate outside of the templated domain, got: %#v", resp)
+	}
+
+	resp, err = issue("foo.payments.example.com")
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v resp: %#v", err, resp)
+	}
+
+	block, _ := pem.Decode([]byte(resp.Data["certificate"].(string)))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cert.Subject.OrganizationalUnit) != 1 || cert.Subject.OrganizationalUnit[0] != "alice" {
+		t.Fatalf("expected the OU to be populated from the entity, got: %v", cert.Subject.OrganizationalUnit)
+	}
+
+	expected := map[string]pkix.Extension{}
+	for _, ext := range []struct {
+		oid      asn1.ObjectIdentifier
+		critical bool
+		value    interface{}
+		params   string
+	}{
+		{asn1.ObjectIdentifier{1, 2, 3, 4}, true, "payments", "utf8"},
+		{asn1.ObjectIdentifier{1, 2, 3, 5}, false, 42, ""},
+	} {
+		der, err := asn1.MarshalWithParams(ext.value, ext.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected[ext.oid.String()] = pkix.Extension{Id: ext.oid, Critical: ext.critical, Value: der}
+	}
+	for _, ext := range cert.Extensions {
+		want, ok := expected[ext.Id.String()]
+		if !ok {
+			continue
+		}
+		if ext.Critical != want.Critical || !bytes.Equal(ext.Value, want.Value) {
+			t.Fatalf("bad extension %s: expected %#v, got %#v", ext.Id, want, ext)
+		}
+		delete(expected, ext.Id.String())
+	}
+	if len(expected) != 0 {
+		t.Fatalf("missing extensions: %v", expected)
+	}
+
+	// Requests without an entity cannot populate the subject template
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "issue/templated",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"common_name": "foo.payments.example.com",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error issuing a certificate without an entity, got: %#v", resp)
+	}
+}
@@ -34,6 +34,27 @@ func pathGenerateRoot(b *backend) *framework.Path {
 	ret.Fields = addCACommonFields(map[string]*framework.FieldSchema{})
 	ret.Fields = addCAKeyGenerationFields(ret.Fields)
 	ret.Fields = addCAIssueFields(ret.Fields)
+	ret.Fields = addIssuerNameField(ret.Fields)
+
+	return ret
+}
+
+func pathRotateRoot(b *backend) *framework.Path {
+	ret := &framework.Path{
+		Pattern: "root/rotate/" + framework.GenericNameRegex("exported"),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathCARotateRoot,
+		},
+
+		HelpSynopsis:    pathRotateRootHelpSyn,
+		HelpDescription: pathRotateRootHelpDesc,
+	}
+
+	ret.Fields = addCACommonFields(map[string]*framework.FieldSchema{})
+	ret.Fields = addCAKeyGenerationFields(ret.Fields)
+	ret.Fields = addCAIssueFields(ret.Fields)
+	ret.Fields = addIssuerNameField(ret.Fields)
 
 	return ret
 }
@@ -67,6 +88,7 @@ func pathSignIntermediate(b *backend) *framework.Path {
 
 	ret.Fields = addCACommonFields(map[string]*framework.FieldSchema{})
 	ret.Fields = addCAIssueFields(ret.Fields)
+	ret.Fields = addIssuerRefField(ret.Fields)
 
 	ret.Fields["csr"] = &framework.FieldSchema{
 		Type:        framework.TypeString,
@@ -110,26 +132,68 @@ func pathSignSelfIssued(b *backend) *framework.Path {
 		HelpDescription: pathSignSelfIssuedHelpDesc,
 	}
 
+	ret.Fields = addIssuerRefField(ret.Fields)
+
 	return ret
 }
 
 func (b *backend) pathCADeleteRoot(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return nil, req.Storage.Delete(ctx, "config/ca_bundle")
+	ids, err := req.Storage.List(ctx, "issuers/")
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if err := req.Storage.Delete(ctx, "issuers/"+id); err != nil {
+			return nil, err
+		}
+		if err := req.Storage.Delete(ctx, "crls/"+id); err != nil {
+			return nil, err
+		}
+		if err := req.Storage.Delete(ctx, "delta-crls/"+id); err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range []string{"config/issuers", "config/pending_key", "config/ca_bundle"} {
+		if err := req.Storage.Delete(ctx, key); err != nil {
+			return nil, err
+		}
+	}
+	b.ocspCache.Flush()
+	return nil, nil
 }
 
 func (b *backend) pathCAGenerateRoot(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	var err error
-
-	entry, err := req.Storage.Get(ctx, "config/ca_bundle")
+	issuers, err := req.Storage.List(ctx, "issuers/")
 	if err != nil {
 		return nil, err
 	}
-	if entry != nil {
+	if len(issuers) > 0 {
 		resp := &logical.Response{}
-		resp.AddWarning(fmt.Sprintf("Refusing to generate a root certificate over an existing root certificate. If you really want to destroy the original root certificate, please issue a delete against %sroot.", req.MountPoint))
+		resp.AddWarning(fmt.Sprintf("Refusing to generate a root certificate over an existing root certificate. If you really want to destroy the original root certificate, please issue a delete against %sroot. To add another root certificate, use %sroot/rotate.", req.MountPoint, req.MountPoint))
 		return resp, nil
 	}
 
+	return b.generateRoot(ctx, req, data)
+}
+
+// pathCARotateRoot generates a new root alongside the existing issuers,
+// which becomes the default once set in config/issuers
+func (b *backend) pathCARotateRoot(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.generateRoot(ctx, req, data)
+}
+
+func (b *backend) generateRoot(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	var err error
+
+	issuerName := data.Get("issuer_name").(string)
+	err = validateIssuerName(ctx, req.Storage, issuerName, "")
+	switch err.(type) {
+	case errutil.UserError:
+		return logical.ErrorResponse(err.Error()), nil
+	case errutil.InternalError:
+		return nil, err
+	}
+
 	exported, format, role, errorResp := b.getGenerationParams(data)
 	if errorResp != nil {
 		return errorResp, nil
@@ -204,37 +268,20 @@ func (b *backend) pathCAGenerateRoot(ctx context.Context, req *logical.Request,
 		}
 	}
 
-	// Store it as the CA bundle
-	entry, err = logical.StorageEntryJSON("config/ca_bundle", cb)
-	if err != nil {
-		return nil, err
-	}
-	err = req.Storage.Put(ctx, entry)
+	// Store it as an issuer
+	issuer, _, err := importIssuer(ctx, req.Storage, parsedBundle, issuerName)
 	if err != nil {
 		return nil, err
 	}
+	b.ocspCache.Flush()
 
-	// Also store it as just the certificate identified by serial number, so it
-	// can be revoked
-	err = req.Storage.Put(ctx, &logical.StorageEntry{
-		Key:   "certs/" + normalizeSerial(cb.SerialNumber),
-		Value: parsedBundle.CertificateBytes,
-	})
-	if err != nil {
-		return nil, errwrap.Wrapf("unable to store certificate locally: {{err}}", err)
-	}
-
-	// For ease of later use, also store just the certificate at a known
-	// location
-	entry.Key = "ca"
-	entry.Value = parsedBundle.CertificateBytes
-	err = req.Storage.Put(ctx, entry)
+	// Build a fresh CRL
+	err = buildCRL(ctx, b, req, true)
 	if err != nil {
 		return nil, err
 	}
 
-	// Build a fresh CRL
-	err = buildCRL(ctx, b, req, true)
+	resp, err = addIssuerResponseData(ctx, req.Storage, resp, issuer)
 	if err != nil {
 		return nil, err
 	}
@@ -280,7 +327,7 @@ func (b *backend) pathCASignIntermediate(ctx context.Context, req *logical.Reque
 	}
 
 	var caErr error
-	signingBundle, caErr := fetchCAInfo(ctx, req)
+	signingBundle, caErr := fetchCAInfoByIssuer(ctx, req, data.Get("issuer_ref").(string))
 	switch caErr.(type) {
 	case errutil.UserError:
 		return nil, errutil.UserError{Err: fmt.Sprintf(
@@ -406,7 +453,7 @@ func (b *backend) pathCASignSelfIssued(ctx context.Context, req *logical.Request
 	}
 
 	var caErr error
-	signingBundle, caErr := fetchCAInfo(ctx, req)
+	signingBundle, caErr := fetchCAInfoByIssuer(ctx, req, data.Get("issuer_ref").(string))
 	switch caErr.(type) {
 	case errutil.UserError:
 		return nil, errutil.UserError{Err: fmt.Sprintf(
@@ -428,6 +475,9 @@ func (b *backend) pathCASignSelfIssued(ctx context.Context, req *logical.Request
 	cert.IssuingCertificateURL = urls.IssuingCertificates
 	cert.CRLDistributionPoints = urls.CRLDistributionPoints
 	cert.OCSPServer = urls.OCSPServers
+	if err := certutil.AddDeltaCRLDistributionPoints(urls, cert); err != nil {
+		return nil, errwrap.Wrapf("error marshaling delta CRL distribution points: {{err}}", err)
+	}
 
 	newCert, err := x509.CreateCertificate(rand.Reader, cert, signingBundle.Certificate, cert.PublicKey, signingBundle.PrivateKey)
 	if err != nil {
@@ -457,8 +507,16 @@ const pathGenerateRootHelpDesc = `
 See the API documentation for more information.
 `
 
+const pathRotateRootHelpSyn = `
+Generate a new root CA certificate and private key alongside the existing issuers.
+`
+
+const pathRotateRootHelpDesc = `
+See the API documentation for more information.
+`
+
 const pathDeleteRootHelpSyn = `
-Deletes the root CA key to allow a new one to be generated.
+Deletes all issuers and their CA keys to allow a new root to be generated.
 `
 
 const pathDeleteRootHelpDesc = `
@@ -5,6 +5,7 @@ import (
 	"crypto/x509"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -36,6 +37,13 @@ and expired certificates, removing them both from the CRL and from storage. The
 CRL will be rotated if this causes any values to be removed.`,
 			},
 
+			"tidy_acme": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Set to true to remove ACME orders and
+authorizations that expired, and the orders of
+expired certificates.`,
+			},
+
 			"safety_buffer": &framework.FieldSchema{
 				Type: framework.TypeDurationSecond,
 				Description: `The amount of extra time that must have passed
@@ -65,6 +73,7 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 	tidyCertStore := d.Get("tidy_cert_store").(bool)
 	tidyRevokedCerts := d.Get("tidy_revoked_certs").(bool)
 	tidyRevocationList := d.Get("tidy_revocation_list").(bool)
+	tidyACME := d.Get("tidy_acme").(bool)
 
 	if safetyBuffer < 1 {
 		return logical.ErrorResponse("safety_buffer must be greater than zero"), nil
@@ -193,6 +202,12 @@ func (b *backend) pathTidyWrite(ctx context.Context, req *logical.Request, d *fr
 				}
 			}
 
+			if tidyACME {
+				if err := tidyACMEStorage(ctx, req.Storage, bufferDuration); err != nil {
+					return err
+				}
+			}
+
 			return nil
 		}
 
@@ -217,8 +232,9 @@ This endpoint allows expired certificates and/or revocation information to be
 removed from the backend, freeing up storage and shortening CRLs.
 
 For safety, this function is a noop if called without parameters; cleanup from
-normal certificate storage must be enabled with 'tidy_cert_store' and cleanup
-from revocation information must be enabled with 'tidy_revocation_list'.
+normal certificate storage must be enabled with 'tidy_cert_store', cleanup
+from revocation information must be enabled with 'tidy_revocation_list' and
+cleanup of ACME orders and authorizations must be enabled with 'tidy_acme'.
 
 The 'safety_buffer' parameter is useful to ensure that clock skew amongst your
 hosts cannot lead to a certificate being removed from the CRL while it is still
@@ -233,3 +249,63 @@ certificate storage or in revocation information will then be checked. If the
 current time, minus the value of 'safety_buffer', is greater than the
 expiration, it will be removed.
 `
+
+// tidyACMEStorage removes the ACME orders and authorizations that expired,
+// and the orders whose certificate expired, more than bufferDuration ago
+func tidyACMEStorage(ctx context.Context, s logical.Storage, bufferDuration time.Duration) error {
+	accountIDs, err := s.List(ctx, "acme/accounts/")
+	if err != nil {
+		return errwrap.Wrapf("error listing ACME accounts: {{err}}", err)
+	}
+	cutoff := time.Now().Add(-bufferDuration)
+
+	for _, accountID := range accountIDs {
+		if strings.HasSuffix(accountID, "/") {
+			continue
+		}
+
+		orderIDs, err := s.List(ctx, acmeAccountPath(accountID)+"/orders/")
+		if err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("error listing orders of ACME account %q: {{err}}", accountID), err)
+		}
+		for _, orderID := range orderIDs {
+			order, err := fetchACMEOrder(ctx, s, accountID, orderID)
+			if err != nil {
+				return err
+			}
+			if order == nil {
+				continue
+			}
+			expires := order.Expires
+			if order.Status == acmeStatusValid {
+				expires = order.CertificateExpires
+			}
+			if expires.Before(cutoff) {
+				if err := s.Delete(ctx, acmeOrderPath(accountID, orderID)); err != nil {
+					return errwrap.Wrapf(fmt.Sprintf("error deleting ACME order %q: {{err}}", orderID), err)
+				}
+			}
+		}
+
+		authzIDs, err := s.List(ctx, acmeAccountPath(accountID)+"/authorizations/")
+		if err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("error listing authorizations of ACME account %q: {{err}}", accountID), err)
+		}
+		for _, authzID := range authzIDs {
+			authz, err := fetchACMEAuthorization(ctx, s, accountID, authzID)
+			if err != nil {
+				return err
+			}
+			if authz == nil {
+				continue
+			}
+			if authz.Expires.Before(cutoff) {
+				if err := s.Delete(ctx, acmeAuthorizationPath(accountID, authzID)); err != nil {
+					return errwrap.Wrapf(fmt.Sprintf("error deleting ACME authorization %q: {{err}}", authzID), err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,273 @@
+package pki
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/identity"
+	"github.com/hashicorp/vault/sdk/helper/certutil"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// customExtension is an extension set by a role, parsed from the
+// <oid>;<type>:<value> format
+type customExtension struct {
+	oid       asn1.ObjectIdentifier
+	critical  bool
+	valueType string
+	value     string
+}
+
+// parseCustomExtensions parses the custom extensions of a role, checking that
+// they do not override the extensions managed by the secrets engine
+func parseCustomExtensions(extensions, critical []string) ([]customExtension, error) {
+	criticalOIDs := make(map[string]bool, len(critical))
+	for _, oid := range critical {
+		criticalOIDs[oid] = true
+	}
+
+	var result []customExtension
+	seen := map[string]bool{}
+	for _, ext := range extensions {
+		splitExt := strings.SplitN(ext, ";", 2)
+		if len(splitExt) != 2 {
+			return nil, fmt.Errorf("expected a semicolon in custom extension %q", ext)
+		}
+		splitType := strings.SplitN(splitExt[1], ":", 2)
+		if len(splitType) != 2 {
+			return nil, fmt.Errorf("expected a colon in custom extension %q", ext)
+		}
+
+		oid, err := certutil.StringToOid(splitExt[0])
+		if err != nil {
+			return nil, fmt.Errorf("%q could not be parsed as a valid oid in custom extension %q", splitExt[0], ext)
+		}
+		// Extensions under id-ce (2.5.29) and the authority information
+		// access extension are built from the role and the CA
+		if (len(oid) > 3 && oid[0] == 2 && oid[1] == 5 && oid[2] == 29) ||
+			oid.Equal(asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 1}) {
+			return nil, fmt.Errorf("extension %s is managed by the secrets engine and cannot be set as a custom extension", splitExt[0])
+		}
+		if seen[splitExt[0]] {
+			return nil, fmt.Errorf("extension %s is set more than once", splitExt[0])
+		}
+		seen[splitExt[0]] = true
+
+		valueType := strings.ToLower(splitType[0])
+		if valueType == "utf-8" {
+			valueType = "utf8"
+		}
+		switch valueType {
+		case "utf8", "ia5", "printable", "int", "bool", "oid", "der":
+		default:
+			return nil, fmt.Errorf("unsupported type %q in custom extension %q", splitType[0], ext)
+		}
+
+		result = append(result, customExtension{
+			oid:       oid,
+			critical:  criticalOIDs[splitExt[0]],
+			valueType: valueType,
+			value:     splitType[1],
+		})
+	}
+
+	for _, oid := range critical {
+		if !seen[oid] {
+			return nil, fmt.Errorf("critical extension %s is not a custom extension", oid)
+		}
+	}
+
+	return result, nil
+}
+
+// encodeCustomExtensionValue returns the DER encoding of an extension value
+// of the given type
+func encodeCustomExtensionValue(valueType, value string) ([]byte, error) {
+	switch valueType {
+	case "utf8", "ia5", "printable":
+		return asn1.MarshalWithParams(value, valueType)
+	case "int":
+		i, ok := new(big.Int).SetString(value, 10)
+		if !ok {
+			return nil, fmt.Errorf("%q is not an integer", value)
+		}
+		return asn1.Marshal(i)
+	case "bool":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, err
+		}
+		return asn1.Marshal(b)
+	case "oid":
+		oid, err := certutil.StringToOid(value)
+		if err != nil {
+			return nil, err
+		}
+		return asn1.Marshal(oid)
+	case "der":
+		der, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, errwrap.Wrapf("value is not base64 encoded: {{err}}", err)
+		}
+		var raw asn1.RawValue
+		rest, err := asn1.Unmarshal(der, &raw)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) > 0 {
+			return nil, fmt.Errorf("trailing data after the DER value")
+		}
+		return der, nil
+	}
+
+	return nil, fmt.Errorf("unsupported type %q", valueType)
+}
+
+// validateRoleTemplates checks the identity templates of a role, and the
+// encoding of the custom extensions values that are not templated
+func validateRoleTemplates(role *roleEntry) error {
+	checkTemplate := func(field, tpl string) (bool, error) {
+		templated, _, err := identity.PopulateString(identity.PopulateStringInput{
+			Mode:              identity.ACLTemplating,
+			String:            tpl,
+			ValidityCheckOnly: true,
+		})
+		if err != nil {
+			return false, errwrap.Wrapf(fmt.Sprintf("invalid template %q in %s: {{err}}", tpl, field), err)
+		}
+		return templated, nil
+	}
+
+	if role.AllowedDomainsTemplate {
+		for _, domain := range role.AllowedDomains {
+			if _, err := checkTemplate("allowed_domains", domain); err != nil {
+				return err
+			}
+		}
+	}
+
+	if role.SubjectTemplate {
+		for field, values := range role.subjectAttributes() {
+			for _, value := range *values {
+				if _, err := checkTemplate(field, value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	extensions, err := parseCustomExtensions(role.CustomExtensions, role.CriticalCustomExtensions)
+	if err != nil {
+		return err
+	}
+	for _, ext := range extensions {
+		templated, err := checkTemplate("custom_extensions", ext.value)
+		if err != nil {
+			return err
+		}
+		if templated {
+			continue
+		}
+		if _, err := encodeCustomExtensionValue(ext.valueType, ext.value); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("invalid value for custom extension %s: {{err}}", ext.oid), err)
+		}
+	}
+
+	return nil
+}
+
+// populateRoleTemplates returns a copy of the role with its identity
+// templates populated from the entity of the requester, along with its custom
+// extensions. Templated allowed domains that cannot be populated are left out,
+// while templated subject attributes and extensions that cannot be populated
+// fail the request.
+func populateRoleTemplates(b *backend, req *logical.Request, role *roleEntry) (*roleEntry, []pkix.Extension, error) {
+	var entity *identity.Entity
+	if req.EntityID != "" {
+		logicalEntity, err := b.System().EntityInfo(req.EntityID)
+		if err != nil {
+			return nil, nil, errutil.InternalError{Err: fmt.Sprintf("error fetching entity: %v", err)}
+		}
+		if logicalEntity != nil {
+			entity = &identity.Entity{
+				ID:       logicalEntity.ID,
+				Name:     logicalEntity.Name,
+				Metadata: logicalEntity.Metadata,
+			}
+			for _, alias := range logicalEntity.Aliases {
+				entity.Aliases = append(entity.Aliases, &identity.Alias{
+					MountType:     alias.MountType,
+					MountAccessor: alias.MountAccessor,
+					Name:          alias.Name,
+					Metadata:      alias.Metadata,
+				})
+			}
+		}
+	}
+
+	populate := func(tpl string) (string, error) {
+		_, result, err := identity.PopulateString(identity.PopulateStringInput{
+			Mode:   identity.ACLTemplating,
+			String: tpl,
+			Entity: entity,
+		})
+		return result, err
+	}
+
+	populated := *role
+
+	if role.AllowedDomainsTemplate {
+		populated.AllowedDomains = nil
+		for _, domain := range role.AllowedDomains {
+			result, err := populate(domain)
+			if err != nil {
+				continue
+			}
+			populated.AllowedDomains = append(populated.AllowedDomains, result)
+		}
+	}
+
+	if role.SubjectTemplate {
+		for field, values := range populated.subjectAttributes() {
+			var results []string
+			for _, value := range *values {
+				result, err := populate(value)
+				if err != nil {
+					return nil, nil, errutil.UserError{Err: fmt.Sprintf("unable to populate template %q in %s: %s", value, field, err)}
+				}
+				results = append(results, result)
+			}
+			*values = results
+		}
+	}
+
+	parsedExtensions, err := parseCustomExtensions(role.CustomExtensions, role.CriticalCustomExtensions)
+	if err != nil {
+		return nil, nil, errutil.InternalError{Err: fmt.Sprintf("error parsing custom extensions of role: %v", err)}
+	}
+	var extensions []pkix.Extension
+	for _, ext := range parsedExtensions {
+		value, err := populate(ext.value)
+		if err != nil {
+			return nil, nil, errutil.UserError{Err: fmt.Sprintf("unable to populate template %q in custom extension %s: %s", ext.value, ext.oid, err)}
+		}
+		der, err := encodeCustomExtensionValue(ext.valueType, value)
+		if err != nil {
+			return nil, nil, errutil.UserError{Err: fmt.Sprintf("invalid value for custom extension %s: %s", ext.oid, err)}
+		}
+		extensions = append(extensions, pkix.Extension{
+			Id:       ext.oid,
+			Critical: ext.critical,
+			Value:    der,
+		})
+	}
+
+	return &populated, extensions, nil
+}
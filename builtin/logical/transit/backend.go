@@ -2,14 +2,32 @@ package transit
 
 import (
 	"context"
+	"crypto/rsa"
+	"fmt"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
 	"github.com/hashicorp/vault/sdk/helper/keysutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
+const (
+	// minAutoRotatePeriod is the shortest period after which keys can be
+	// automatically rotated
+	minAutoRotatePeriod = time.Hour
+
+	// autoRotateCheckInterval is the interval at which keys are checked for
+	// automatic rotation. It bounds how late a key is rotated, so it is a
+	// fraction of the minimum period.
+	autoRotateCheckInterval = 10 * time.Minute
+)
+
 func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
 
 	b, err := Backend(ctx, conf)
@@ -29,6 +47,7 @@ func Backend(ctx context.Context, conf *logical.BackendConfig) (*backend, error)
 			SealWrapStorage: []string{
 				"archive/",
 				"policy/",
+				"import/",
 			},
 		},
 
@@ -37,6 +56,7 @@ func Backend(ctx context.Context, conf *logical.BackendConfig) (*backend, error)
 			// as the handler is greedy
 			b.pathConfig(),
 			b.pathRotate(),
+			b.pathCSR(),
 			b.pathRewrap(),
 			b.pathKeys(),
 			b.pathListKeys(),
@@ -53,11 +73,17 @@ func Backend(ctx context.Context, conf *logical.BackendConfig) (*backend, error)
 			b.pathRestore(),
 			b.pathTrim(),
 			b.pathCacheConfig(),
+			b.pathWrappingKey(),
+			b.pathImport(),
+			b.pathImportVersion(),
+			b.pathEncode(),
+			b.pathDecode(),
 		},
 
-		Secrets:     []*framework.Secret{},
-		Invalidate:  b.invalidate,
-		BackendType: logical.TypeLogical,
+		Secrets:      []*framework.Secret{},
+		Invalidate:   b.invalidate,
+		BackendType:  logical.TypeLogical,
+		PeriodicFunc: b.periodicFunc,
 	}
 
 	// determine cacheSize to use. Defaults to 0 which means unlimited
@@ -83,6 +109,16 @@ func Backend(ctx context.Context, conf *logical.BackendConfig) (*backend, error)
 type backend struct {
 	*framework.Backend
 	lm *keysutil.LockManager
+
+	// wrappingKey caches the key used to wrap imported keys, which is
+	// generated the first time it is needed
+	wrappingKey     *rsa.PrivateKey
+	wrappingKeyLock sync.Mutex
+
+	// checkAutoRotateAfter is the time after which keys are next checked
+	// for automatic rotation
+	checkAutoRotateAfter time.Time
+	autoRotateLock       sync.Mutex
 }
 
 func GetCacheSizeFromStorage(ctx context.Context, s logical.Storage) (int, error) {
@@ -109,5 +145,90 @@ func (b *backend) invalidate(_ context.Context, key string) {
 	case strings.HasPrefix(key, "policy/"):
 		name := strings.TrimPrefix(key, "policy/")
 		b.lm.InvalidatePolicy(name)
+	case key == wrappingKeyStoragePath:
+		b.wrappingKeyLock.Lock()
+		b.wrappingKey = nil
+		b.wrappingKeyLock.Unlock()
+	}
+}
+
+// periodicFunc rotates the keys whose automatic rotation period has elapsed
+// since their latest version was created. Since the creation time of each
+// version is persisted with the key and only the node that can write to the
+// key rotates it, each key is rotated once per period across the cluster.
+func (b *backend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	// Keys of replicated mounts are rotated by the primary
+	replicationState := b.System().ReplicationState()
+	if replicationState.HasState(consts.ReplicationDRSecondary | consts.ReplicationPerformanceStandby) {
+		return nil
+	}
+	if !b.System().LocalMount() && replicationState.HasState(consts.ReplicationPerformanceSecondary) {
+		return nil
+	}
+
+	b.autoRotateLock.Lock()
+	defer b.autoRotateLock.Unlock()
+
+	// Checking every key requires reading all of them, so only do so once per
+	// check interval rather than on every periodic call
+	now := time.Now()
+	if now.Before(b.checkAutoRotateAfter) {
+		return nil
+	}
+	b.checkAutoRotateAfter = now.Add(autoRotateCheckInterval)
+
+	return b.autoRotateKeys(ctx, req.Storage)
+}
+
+// autoRotateKeys rotates every key that is due for automatic rotation
+func (b *backend) autoRotateKeys(ctx context.Context, s logical.Storage) error {
+	names, err := s.List(ctx, "policy/")
+	if err != nil {
+		return errwrap.Wrapf("failed to list keys: {{err}}", err)
 	}
+
+	var errs *multierror.Error
+	for _, name := range names {
+		if err := b.rotateIfRequired(ctx, s, name); err != nil {
+			errs = multierror.Append(errs, errwrap.Wrapf(fmt.Sprintf("failed to rotate key %q: {{err}}", name), err))
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// rotateIfRequired rotates the named key if its automatic rotation period has
+// elapsed since its latest version was created
+func (b *backend) rotateIfRequired(ctx context.Context, s logical.Storage, name string) error {
+	p, _, err := b.lm.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: s,
+		Name:    name,
+	})
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return nil
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(true)
+	}
+	defer p.Unlock()
+
+	if p.AutoRotatePeriod <= 0 {
+		return nil
+	}
+	if p.Imported && !p.AllowImportedKeyRotation {
+		return nil
+	}
+
+	latest, ok := p.Keys[strconv.Itoa(p.LatestVersion)]
+	if !ok {
+		return fmt.Errorf("latest version %d of the key not found", p.LatestVersion)
+	}
+	if time.Since(latest.CreationTime) < p.AutoRotatePeriod {
+		return nil
+	}
+
+	b.Logger().Debug("automatically rotating key", "name", name, "version", p.LatestVersion)
+	return p.Rotate(ctx, s)
 }
@@ -5,7 +5,9 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
@@ -283,3 +285,144 @@ func TestTransit_ConfigSettings(t *testing.T) {
 	testHMAC(3, true)
 	testHMAC(2, false)
 }
+
+func TestTransit_AutoRotate(t *testing.T) {
+	b, storage := createBackendWithSysView(t)
+	ctx := context.Background()
+
+	// Periods shorter than the minimum period are rejected
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test",
+		Data: map[string]interface{}{
+			"auto_rotate_period": "30m",
+		},
+	})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("expected error for a period shorter than an hour")
+	}
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test",
+		Data: map[string]interface{}{
+			"auto_rotate_period": "24h",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v, resp: %#v", err, resp)
+	}
+
+	readKey := func() *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Storage:   storage,
+			Operation: logical.ReadOperation,
+			Path:      "keys/test",
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: err: %v, resp: %#v", err, resp)
+		}
+		return resp
+	}
+	if period := readKey().Data["auto_rotate_period"].(int64); period != 86400 {
+		t.Fatalf("expected an auto rotate period of 86400, got %d", period)
+	}
+
+	// Writing the key again cannot change its period, which is only done
+	// through the config endpoint
+	for _, data := range []map[string]interface{}{
+		nil,
+		{"auto_rotate_period": "24h"},
+	} {
+		resp, err = b.HandleRequest(ctx, &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "keys/test",
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: err: %v, resp: %#v", err, resp)
+		}
+	}
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test",
+		Data: map[string]interface{}{
+			"auto_rotate_period": "48h",
+		},
+	})
+	if err == nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error changing the period of an existing key, got: err: %v, resp: %#v", err, resp)
+	}
+	if period := readKey().Data["auto_rotate_period"].(int64); period != 86400 {
+		t.Fatalf("expected an auto rotate period of 86400, got %d", period)
+	}
+
+	runPeriodic := func() {
+		t.Helper()
+		b.checkAutoRotateAfter = time.Time{}
+		if err := b.periodicFunc(ctx, &logical.Request{Storage: storage}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The key was just created, so it is not due for rotation
+	runPeriodic()
+	if latest := readKey().Data["latest_version"].(int); latest != 1 {
+		t.Fatalf("expected latest version 1, got %d", latest)
+	}
+
+	// Backdate the latest version past the rotation period
+	p, _, err := b.lm.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: storage,
+		Name:    "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := p.Keys["1"]
+	entry.CreationTime = time.Now().Add(-25 * time.Hour)
+	p.Keys["1"] = entry
+	if err := p.Persist(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+
+	runPeriodic()
+	if latest := readKey().Data["latest_version"].(int); latest != 2 {
+		t.Fatalf("expected latest version 2, got %d", latest)
+	}
+
+	// The new version is not due for rotation
+	runPeriodic()
+	if latest := readKey().Data["latest_version"].(int); latest != 2 {
+		t.Fatalf("expected latest version 2, got %d", latest)
+	}
+
+	// Disabling automatic rotation stops the key from being rotated
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/test/config",
+		Data: map[string]interface{}{
+			"auto_rotate_period": 0,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: err: %v, resp: %#v", err, resp)
+	}
+	entry = p.Keys["2"]
+	entry.CreationTime = time.Now().Add(-25 * time.Hour)
+	p.Keys["2"] = entry
+	if err := p.Persist(ctx, storage); err != nil {
+		t.Fatal(err)
+	}
+
+	runPeriodic()
+	if latest := readKey().Data["latest_version"].(int); latest != 2 {
+		t.Fatalf("expected latest version 2, got %d", latest)
+	}
+}
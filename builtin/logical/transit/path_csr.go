@@ -0,0 +1,171 @@
+package transit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func (b *backend) pathCSR() *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/csr",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+
+			"version": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `The version of the key whose public key is
+certified. Defaults to the latest version.`,
+			},
+
+			"csr": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `A PEM-encoded certificate signing request used
+as a template. Its subject and extensions are
+copied to the new request, which is signed by
+the key instead.`,
+			},
+
+			"common_name": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The common name of the subject of the request.
+Overrides that of the template.`,
+			},
+
+			"alt_names": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `DNS subject alternative names of the request.
+Overrides those of the template.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathCSRWrite,
+		},
+
+		HelpSynopsis:    pathCSRHelpSyn,
+		HelpDescription: pathCSRHelpDesc,
+	}
+}
+
+func (b *backend) pathCSRWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	template := &x509.CertificateRequest{}
+	if csrPEM := d.Get("csr").(string); csrPEM != "" {
+		block, _ := pem.Decode([]byte(csrPEM))
+		if block == nil || block.Type != "CERTIFICATE REQUEST" {
+			return logical.ErrorResponse("csr must be a PEM-encoded certificate request"), logical.ErrInvalidRequest
+		}
+		parsed, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("failed to parse csr: %v", err)), logical.ErrInvalidRequest
+		}
+
+		// Only the subject and extensions are taken from the template;
+		// the public key and signature are those of the transit key
+		template.Subject = parsed.Subject
+		template.RawSubject = parsed.RawSubject
+		template.ExtraExtensions = parsed.Extensions
+	}
+	if commonName := d.Get("common_name").(string); commonName != "" {
+		template.Subject.CommonName = commonName
+		template.RawSubject = nil
+	}
+	if altNames := d.Get("alt_names").([]string); len(altNames) > 0 {
+		template.DNSNames = altNames
+		template.ExtraExtensions = withoutExtension(template.ExtraExtensions, oidExtensionSubjectAltName)
+	}
+
+	p, _, err := b.lm.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+	defer p.Unlock()
+
+	if !p.Type.SigningSupported() {
+		return logical.ErrorResponse(fmt.Sprintf("key type %v does not support signing", p.Type)), logical.ErrInvalidRequest
+	}
+	if p.Derived {
+		return logical.ErrorResponse("certificate requests are not supported for derived keys"), logical.ErrInvalidRequest
+	}
+
+	version := d.Get("version").(int)
+	if version == 0 {
+		version = p.LatestVersion
+	}
+	if version < p.MinDecryptionVersion {
+		return logical.ErrorResponse("version is below minimum decryption version"), logical.ErrInvalidRequest
+	}
+	key, ok := p.Keys[strconv.Itoa(version)]
+	if !ok {
+		return logical.ErrorResponse("version does not exist or cannot be found"), logical.ErrInvalidRequest
+	}
+
+	signer, err := keyEntryToSigner(p, &key)
+	if err != nil {
+		return nil, err
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, template, signer)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("failed to create certificate request: %v", err)), logical.ErrInvalidRequest
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":    p.Name,
+			"type":    p.Type.String(),
+			"version": version,
+			"csr":     strings.TrimSpace(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))),
+		},
+	}, nil
+}
+
+// oidExtensionSubjectAltName is the identifier of the subject alternative
+// name extension, see RFC 5280 section 4.2.1.6
+var oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+// withoutExtension returns the extensions other than the one with the given
+// identifier
+func withoutExtension(extensions []pkix.Extension, oid asn1.ObjectIdentifier) []pkix.Extension {
+	var ret []pkix.Extension
+	for _, ext := range extensions {
+		if !ext.Id.Equal(oid) {
+			ret = append(ret, ext)
+		}
+	}
+	return ret
+}
+
+const pathCSRHelpSyn = `Create a certificate signing request signed by a named key`
+
+const pathCSRHelpDesc = `
+This path creates a PKCS #10 certificate signing request for the public key
+of the named asymmetric key, signed by the key, so that an external CA can
+issue a certificate for it. The subject and extensions of the request can be
+given by a template request, and the common name and DNS alternative names can
+be set directly.
+`
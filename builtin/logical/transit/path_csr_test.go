@@ -0,0 +1,129 @@
+package transit
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestTransit_CSR(t *testing.T) {
+	b, storage := createBackendWithSysView(t)
+
+	doReq := func(req *logical.Request) *logical.Response {
+		t.Helper()
+		req.Storage = storage
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v, resp: %#v", err, resp)
+		}
+		return resp
+	}
+	parseCSR := func(resp *logical.Response) *x509.CertificateRequest {
+		t.Helper()
+		block, _ := pem.Decode([]byte(resp.Data["csr"].(string)))
+		if block == nil || block.Type != "CERTIFICATE REQUEST" {
+			t.Fatalf("bad csr: %#v", resp.Data)
+		}
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := csr.CheckSignature(); err != nil {
+			t.Fatal(err)
+		}
+		return csr
+	}
+
+	for _, keyType := range []string{"ecdsa-p256", "rsa-2048", "ed25519"} {
+		doReq(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "keys/" + keyType,
+			Data: map[string]interface{}{
+				"type": keyType,
+			},
+		})
+
+		csr := parseCSR(doReq(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "keys/" + keyType + "/csr",
+			Data: map[string]interface{}{
+				"common_name": "example.com",
+				"alt_names":   "example.com,www.example.com",
+			},
+		}))
+		if csr.Subject.CommonName != "example.com" {
+			t.Fatalf("%s: bad common name %q", keyType, csr.Subject.CommonName)
+		}
+		if !reflect.DeepEqual(csr.DNSNames, []string{"example.com", "www.example.com"}) {
+			t.Fatalf("%s: bad alt names %v", keyType, csr.DNSNames)
+		}
+
+		// The request certifies the public key of the transit key
+		export := doReq(&logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "export/public-key/" + keyType + "/latest",
+		})
+		block, _ := pem.Decode([]byte(export.Data["keys"].(map[string]string)["1"]))
+		pubDER, err := x509.MarshalPKIXPublicKey(csr.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(block.Bytes, pubDER) {
+			t.Fatalf("%s: csr public key does not match the key", keyType)
+		}
+	}
+
+	// The subject and extensions of a template are kept, but its key is not
+	templateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templateDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{
+			CommonName:   "template.example.com",
+			Organization: []string{"Example"},
+		},
+		DNSNames: []string{"template.example.com"},
+	}, templateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr := parseCSR(doReq(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "keys/ecdsa-p256/csr",
+		Data: map[string]interface{}{
+			"csr": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: templateDER})),
+		},
+	}))
+	if csr.Subject.CommonName != "template.example.com" || !reflect.DeepEqual(csr.Subject.Organization, []string{"Example"}) {
+		t.Fatalf("bad subject %v", csr.Subject)
+	}
+	if !reflect.DeepEqual(csr.DNSNames, []string{"template.example.com"}) {
+		t.Fatalf("bad alt names %v", csr.DNSNames)
+	}
+	if reflect.DeepEqual(csr.PublicKey, templateKey.Public()) {
+		t.Fatal("expected the public key of the transit key, got that of the template")
+	}
+
+	// Symmetric keys can not sign requests
+	doReq(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "keys/aes",
+	})
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/aes/csr",
+	})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("expected error for a symmetric key")
+	}
+}
@@ -37,6 +37,13 @@ ciphertext; "wrapped" will return the ciphertext only.`,
 				Description: "Nonce for when convergent encryption v1 is used (only in Vault 0.6.1)",
 			},
 
+			"associated_data": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Base64 encoded associated data to authenticate
+along with the encrypted data key. The same associated
+data must be provided to decrypt the data key.`,
+			},
+
 			"bits": &framework.FieldSchema{
 				Type: framework.TypeInt,
 				Description: `Number of bits for the key; currently 128, 256,
@@ -98,6 +105,16 @@ func (b *backend) pathDatakeyWrite(ctx context.Context, req *logical.Request, d
 		}
 	}
 
+	// Decode the associated data if any
+	associatedDataRaw := d.Get("associated_data").(string)
+	var associatedData []byte
+	if len(associatedDataRaw) != 0 {
+		associatedData, err = base64.StdEncoding.DecodeString(associatedDataRaw)
+		if err != nil {
+			return logical.ErrorResponse("failed to base64-decode associated data"), logical.ErrInvalidRequest
+		}
+	}
+
 	// Get the policy
 	p, _, err := b.lm.GetPolicy(ctx, keysutil.PolicyRequest{
 		Storage: req.Storage,
@@ -130,7 +147,7 @@ func (b *backend) pathDatakeyWrite(ctx context.Context, req *logical.Request, d
 		return nil, err
 	}
 
-	ciphertext, err := p.Encrypt(ver, context, nonce, base64.StdEncoding.EncodeToString(newKey))
+	ciphertext, err := p.EncryptWithAssociatedData(ver, context, nonce, base64.StdEncoding.EncodeToString(newKey), associatedData)
 	if err != nil {
 		switch err.(type) {
 		case errutil.UserError:
@@ -546,3 +546,170 @@ func TestTransit_BatchEncryptionCase12(t *testing.T) {
 		t.Fatalf("expected an error")
 	}
 }
+
+func TestTransit_AssociatedData(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   s,
+			Data:      data,
+		})
+	}
+
+	plaintext := "dGhlIHF1aWNrIGJyb3duIGZveA==" // "the quick brown fox"
+	rowA := "cm93LWE="                          // "row-a"
+	rowB := "cm93LWI="                          // "row-b"
+
+	for _, keyType := range []string{"aes128-gcm96", "aes256-gcm96", "chacha20-poly1305"} {
+		for _, convergent := range []bool{false, true} {
+			name := keyType
+			keyData := map[string]interface{}{
+				"type": keyType,
+			}
+			if convergent {
+				name += "-convergent"
+				keyData["derived"] = true
+				keyData["convergent_encryption"] = true
+			}
+			if resp, err := doReq("keys/"+name, keyData); err != nil || (resp != nil && resp.IsError()) {
+				t.Fatalf("err:%v resp:%#v", err, resp)
+			}
+
+			encData := map[string]interface{}{
+				"plaintext":       plaintext,
+				"associated_data": rowA,
+			}
+			if convergent {
+				encData["context"] = rowA
+			}
+			resp, err := doReq("encrypt/"+name, encData)
+			if err != nil || (resp != nil && resp.IsError()) {
+				t.Fatalf("%s: err:%v resp:%#v", name, err, resp)
+			}
+			ciphertext := resp.Data["ciphertext"].(string)
+
+			// Convergent ciphertext must differ from that of the same
+			// plaintext with other associated data
+			if convergent {
+				encData["associated_data"] = rowB
+				resp, err := doReq("encrypt/"+name, encData)
+				if err != nil || (resp != nil && resp.IsError()) {
+					t.Fatalf("%s: err:%v resp:%#v", name, err, resp)
+				}
+				if resp.Data["ciphertext"].(string) == ciphertext {
+					t.Fatalf("%s: expected different ciphertext for different associated data", name)
+				}
+			}
+
+			decData := map[string]interface{}{
+				"ciphertext":      ciphertext,
+				"associated_data": rowA,
+			}
+			if convergent {
+				decData["context"] = rowA
+			}
+			resp, err = doReq("decrypt/"+name, decData)
+			if err != nil || (resp != nil && resp.IsError()) {
+				t.Fatalf("%s: err:%v resp:%#v", name, err, resp)
+			}
+			if resp.Data["plaintext"] != plaintext {
+				t.Fatalf("%s: bad plaintext: %v", name, resp.Data["plaintext"])
+			}
+
+			// Decryption fails with other or missing associated data
+			for _, ad := range []string{rowB, ""} {
+				decData["associated_data"] = ad
+				resp, err = doReq("decrypt/"+name, decData)
+				if err == nil && (resp == nil || !resp.IsError()) {
+					t.Fatalf("%s: expected decryption with associated data %q to fail", name, ad)
+				}
+			}
+
+			// Rewrapping preserves the associated data
+			if resp, err := doReq("keys/"+name+"/rotate", nil); err != nil || (resp != nil && resp.IsError()) {
+				t.Fatalf("err:%v resp:%#v", err, resp)
+			}
+			decData["associated_data"] = rowA
+			resp, err = doReq("rewrap/"+name, decData)
+			if err != nil || (resp != nil && resp.IsError()) {
+				t.Fatalf("%s: err:%v resp:%#v", name, err, resp)
+			}
+			decData["ciphertext"] = resp.Data["ciphertext"]
+			resp, err = doReq("decrypt/"+name, decData)
+			if err != nil || (resp != nil && resp.IsError()) {
+				t.Fatalf("%s: err:%v resp:%#v", name, err, resp)
+			}
+			if resp.Data["plaintext"] != plaintext {
+				t.Fatalf("%s: bad plaintext: %v", name, resp.Data["plaintext"])
+			}
+		}
+	}
+
+	// Batch items are bound to their own associated data, so swapping
+	// ciphertext between them is detected
+	resp, err := doReq("encrypt/aes256-gcm96", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"plaintext": plaintext, "associated_data": rowA},
+			map[string]interface{}{"plaintext": plaintext, "associated_data": rowB},
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	batchResults := resp.Data["batch_results"].([]BatchResponseItem)
+
+	resp, err = doReq("decrypt/aes256-gcm96", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"ciphertext": batchResults[0].Ciphertext, "associated_data": rowA},
+			map[string]interface{}{"ciphertext": batchResults[0].Ciphertext, "associated_data": rowB},
+			map[string]interface{}{"ciphertext": batchResults[1].Ciphertext, "associated_data": rowB},
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	decResults := resp.Data["batch_results"].([]BatchResponseItem)
+	if decResults[0].Plaintext != plaintext || decResults[0].Error != "" {
+		t.Fatalf("bad: %#v", decResults[0])
+	}
+	if decResults[1].Error == "" {
+		t.Fatalf("expected swapped ciphertext to fail decryption: %#v", decResults[1])
+	}
+	if decResults[2].Plaintext != plaintext || decResults[2].Error != "" {
+		t.Fatalf("bad: %#v", decResults[2])
+	}
+
+	// Data keys can be bound to associated data
+	resp, err = doReq("datakey/plaintext/aes256-gcm96", map[string]interface{}{
+		"associated_data": rowA,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	dataKey := resp.Data["plaintext"]
+	resp, err = doReq("decrypt/aes256-gcm96", map[string]interface{}{
+		"ciphertext":      resp.Data["ciphertext"],
+		"associated_data": rowA,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["plaintext"] != dataKey {
+		t.Fatalf("bad data key: %v", resp.Data["plaintext"])
+	}
+
+	// Key types without AEAD reject associated data
+	if resp, err := doReq("keys/rsa", map[string]interface{}{"type": "rsa-2048"}); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	resp, err = doReq("encrypt/rsa", map[string]interface{}{
+		"plaintext":       plaintext,
+		"associated_data": rowA,
+	})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatal("expected associated data to be rejected for RSA keys")
+	}
+}
@@ -2,6 +2,7 @@ package transit
 
 import (
 	"context"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rsa"
@@ -13,6 +14,9 @@ import (
 	"strconv"
 	"strings"
 
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/helper/keysutil"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -22,6 +26,7 @@ const (
 	exportTypeEncryptionKey = "encryption-key"
 	exportTypeSigningKey    = "signing-key"
 	exportTypeHMACKey       = "hmac-key"
+	exportTypePublicKey     = "public-key"
 )
 
 func (b *backend) pathExportKeys() *framework.Path {
@@ -30,7 +35,7 @@ func (b *backend) pathExportKeys() *framework.Path {
 		Fields: map[string]*framework.FieldSchema{
 			"type": &framework.FieldSchema{
 				Type:        framework.TypeString,
-				Description: "Type of key to export (encryption-key, signing-key, hmac-key)",
+				Description: "Type of key to export (encryption-key, signing-key, hmac-key, public-key)",
 			},
 			"name": &framework.FieldSchema{
 				Type:        framework.TypeString,
@@ -60,6 +65,7 @@ func (b *backend) pathPolicyExportRead(ctx context.Context, req *logical.Request
 	case exportTypeEncryptionKey:
 	case exportTypeSigningKey:
 	case exportTypeHMACKey:
+	case exportTypePublicKey:
 	default:
 		return logical.ErrorResponse(fmt.Sprintf("invalid export type: %s", exportType)), logical.ErrInvalidRequest
 	}
@@ -79,7 +85,9 @@ func (b *backend) pathPolicyExportRead(ctx context.Context, req *logical.Request
 	}
 	defer p.Unlock()
 
-	if !p.Exportable {
+	// Public keys can be exported regardless of whether the key is
+	// exportable
+	if !p.Exportable && exportType != exportTypePublicKey {
 		return logical.ErrorResponse("key is not exportable"), nil
 	}
 
@@ -92,6 +100,13 @@ func (b *backend) pathPolicyExportRead(ctx context.Context, req *logical.Request
 		if !p.Type.SigningSupported() {
 			return logical.ErrorResponse("signing not supported for the key"), logical.ErrInvalidRequest
 		}
+	case exportTypePublicKey:
+		if !p.Type.SigningSupported() {
+			return logical.ErrorResponse("public key export not supported for the key"), logical.ErrInvalidRequest
+		}
+		if p.Derived {
+			return logical.ErrorResponse("public key export not supported for derived keys"), logical.ErrInvalidRequest
+		}
 	}
 
 	retKeys := map[string]string{}
@@ -186,11 +201,62 @@ func getExportKey(policy *keysutil.Policy, key *keysutil.KeyEntry, exportType st
 		case keysutil.KeyType_RSA2048, keysutil.KeyType_RSA4096:
 			return encodeRSAPrivateKey(key.RSAKey), nil
 		}
+
+	case exportTypePublicKey:
+		signer, err := keyEntryToSigner(policy, key)
+		if err != nil {
+			return "", err
+		}
+		derBytes, err := x509.MarshalPKIXPublicKey(signer.Public())
+		if err != nil {
+			return "", errwrap.Wrapf("error marshaling public key: {{err}}", err)
+		}
+		block := pem.Block{
+			Type:  "PUBLIC KEY",
+			Bytes: derBytes,
+		}
+		return strings.TrimSpace(string(pem.EncodeToMemory(&block))), nil
 	}
 
 	return "", fmt.Errorf("unknown key type %v", policy.Type)
 }
 
+// keyEntryToSigner returns the private key of the key entry of an asymmetric
+// key as a crypto.Signer
+func keyEntryToSigner(policy *keysutil.Policy, key *keysutil.KeyEntry) (crypto.Signer, error) {
+	switch policy.Type {
+	case keysutil.KeyType_ECDSA_P256, keysutil.KeyType_ECDSA_P384, keysutil.KeyType_ECDSA_P521:
+		var curve elliptic.Curve
+		switch policy.Type {
+		case keysutil.KeyType_ECDSA_P384:
+			curve = elliptic.P384()
+		case keysutil.KeyType_ECDSA_P521:
+			curve = elliptic.P521()
+		default:
+			curve = elliptic.P256()
+		}
+		return &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: curve,
+				X:     key.EC_X,
+				Y:     key.EC_Y,
+			},
+			D: key.EC_D,
+		}, nil
+
+	case keysutil.KeyType_ED25519:
+		if policy.Derived {
+			return nil, errors.New("derived keys are not supported")
+		}
+		return ed25519.PrivateKey(key.Key), nil
+
+	case keysutil.KeyType_RSA2048, keysutil.KeyType_RSA4096:
+		return key.RSAKey, nil
+	}
+
+	return nil, fmt.Errorf("key type %v is not an asymmetric key type", policy.Type)
+}
+
 func encodeRSAPrivateKey(key *rsa.PrivateKey) string {
 	// When encoding PKCS1, the PEM header should be `RSA PRIVATE KEY`. When Go
 	// has PKCS8 encoding support, we may want to change this.
@@ -235,5 +301,6 @@ const pathExportHelpSyn = `Export named encryption or signing key`
 
 const pathExportHelpDesc = `
 This path is used to export the named keys that are configured as
-exportable.
+exportable. The public keys of asymmetric keys can be exported with the
+"public-key" type regardless of whether the key is exportable.
 `
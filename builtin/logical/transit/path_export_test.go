@@ -2,11 +2,19 @@ package transit
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
 	"fmt"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 
+	"golang.org/x/crypto/ed25519"
+
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
@@ -374,3 +382,94 @@ func TestTransit_Export_EncryptionKey_DoesNotExportHMACKey(t *testing.T) {
 		t.Fatal("Encryption key data matched hmac key data")
 	}
 }
+
+func TestTransit_Export_PublicKey(t *testing.T) {
+	b, storage := createBackendWithSysView(t)
+
+	for _, keyType := range []string{"ecdsa-p256", "ecdsa-p384", "ecdsa-p521", "ed25519", "rsa-2048"} {
+		// Public keys are exported even if the key is not exportable
+		req := &logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "keys/" + keyType,
+			Data: map[string]interface{}{
+				"type": keyType,
+			},
+		}
+		if _, err := b.HandleRequest(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+
+		req = &logical.Request{
+			Storage:   storage,
+			Operation: logical.ReadOperation,
+			Path:      "export/public-key/" + keyType + "/latest",
+		}
+		rsp, err := b.HandleRequest(context.Background(), req)
+		if err != nil || rsp == nil || rsp.IsError() {
+			t.Fatalf("%s: err: %v, resp: %#v", keyType, err, rsp)
+		}
+
+		keys := rsp.Data["keys"].(map[string]string)
+		block, _ := pem.Decode([]byte(keys["1"]))
+		if block == nil || block.Type != "PUBLIC KEY" {
+			t.Fatalf("%s: bad public key %q", keyType, keys["1"])
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			t.Fatalf("%s: %v", keyType, err)
+		}
+
+		switch keyType {
+		case "ed25519":
+			// Verify a signature made by transit with the exported key
+			input := base64.StdEncoding.EncodeToString([]byte("the quick brown fox"))
+			req = &logical.Request{
+				Storage:   storage,
+				Operation: logical.UpdateOperation,
+				Path:      "sign/" + keyType,
+				Data: map[string]interface{}{
+					"input": input,
+				},
+			}
+			rsp, err := b.HandleRequest(context.Background(), req)
+			if err != nil || rsp == nil || rsp.IsError() {
+				t.Fatalf("%s: err: %v, resp: %#v", keyType, err, rsp)
+			}
+			sig, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(rsp.Data["signature"].(string), "vault:v1:"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ed25519.Verify(pub.(ed25519.PublicKey), []byte("the quick brown fox"), sig) {
+				t.Fatal("failed to verify signature with the exported public key")
+			}
+		case "rsa-2048":
+			if _, ok := pub.(*rsa.PublicKey); !ok {
+				t.Fatalf("%s: unexpected public key type %T", keyType, pub)
+			}
+		default:
+			if _, ok := pub.(*ecdsa.PublicKey); !ok {
+				t.Fatalf("%s: unexpected public key type %T", keyType, pub)
+			}
+		}
+	}
+
+	// Symmetric keys have no public key
+	req := &logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/aes",
+	}
+	if _, err := b.HandleRequest(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	req = &logical.Request{
+		Storage:   storage,
+		Operation: logical.ReadOperation,
+		Path:      "export/public-key/aes",
+	}
+	rsp, err := b.HandleRequest(context.Background(), req)
+	if err == nil && (rsp == nil || !rsp.IsError()) {
+		t.Fatal("expected error exporting the public key of a symmetric key")
+	}
+}
@@ -0,0 +1,255 @@
+package transit
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/mitchellh/mapstructure"
+)
+
+// fpeBatchRequestItem represents a request item for batch format preserving
+// encryption
+type fpeBatchRequestItem struct {
+	// Value to encode or decode
+	Value string `json:"value" structs:"value" mapstructure:"value"`
+
+	// Context for key derivation. This is required for derived keys.
+	Context string `json:"context" structs:"context" mapstructure:"context"`
+
+	// Tweak is the base64 encoded FF3-1 tweak
+	Tweak string `json:"tweak" structs:"tweak" mapstructure:"tweak"`
+
+	// The key version to be used
+	KeyVersion int `json:"key_version" structs:"key_version" mapstructure:"key_version"`
+
+	decodedContext []byte
+	decodedTweak   []byte
+}
+
+// fpeBatchResponseItem represents a response item for batch format
+// preserving encryption
+type fpeBatchResponseItem struct {
+	// Value is the encoded or decoded value of the corresponding batch
+	// request item
+	Value string `json:"value,omitempty" structs:"value" mapstructure:"value"`
+
+	// KeyVersion is the version of the key that was used
+	KeyVersion int `json:"key_version,omitempty" structs:"key_version" mapstructure:"key_version"`
+
+	// Error, if set represents a failure encountered while processing the
+	// corresponding batch request item
+	Error string `json:"error,omitempty" structs:"error" mapstructure:"error"`
+}
+
+func fpeFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"name": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Name of the key",
+		},
+
+		"value": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The value to process",
+		},
+
+		"context": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Base64 encoded context for key derivation. Required if key derivation is enabled",
+		},
+
+		"tweak": &framework.FieldSchema{
+			Type: framework.TypeString,
+			Description: `Base64 encoded 7-byte tweak. Values encoded with
+different tweaks are unrelated, and the same tweak
+must be provided to decode a value. Defaults to a
+tweak of zeros.`,
+		},
+
+		"key_version": &framework.FieldSchema{
+			Type: framework.TypeInt,
+			Description: `The version of the key to use. Since encoded values
+do not record the version of the key, values must
+be decoded with the version they were encoded with,
+so this is required to decode. Defaults to the
+latest version when encoding.`,
+		},
+	}
+}
+
+func (b *backend) pathEncode() *framework.Path {
+	return &framework.Path{
+		Pattern: "encode/" + framework.GenericNameRegex("name"),
+		Fields:  fpeFields(),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathEncodeWrite,
+		},
+
+		HelpSynopsis:    pathEncodeHelpSyn,
+		HelpDescription: pathEncodeHelpDesc,
+	}
+}
+
+func (b *backend) pathDecode() *framework.Path {
+	return &framework.Path{
+		Pattern: "decode/" + framework.GenericNameRegex("name"),
+		Fields:  fpeFields(),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathDecodeWrite,
+		},
+
+		HelpSynopsis:    pathDecodeHelpSyn,
+		HelpDescription: pathDecodeHelpDesc,
+	}
+}
+
+func (b *backend) pathEncodeWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return b.pathFPEWrite(ctx, req, d, true)
+}
+
+func (b *backend) pathDecodeWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return b.pathFPEWrite(ctx, req, d, false)
+}
+
+// pathFPEWrite encodes or decodes the values of the request
+func (b *backend) pathFPEWrite(ctx context.Context, req *logical.Request, d *framework.FieldData, encode bool) (*logical.Response, error) {
+	batchInputRaw := d.Raw["batch_input"]
+	var batchInputItems []fpeBatchRequestItem
+	if batchInputRaw != nil {
+		if err := mapstructure.Decode(batchInputRaw, &batchInputItems); err != nil {
+			return nil, errwrap.Wrapf("failed to parse batch input: {{err}}", err)
+		}
+
+		if len(batchInputItems) == 0 {
+			return logical.ErrorResponse("missing batch input to process"), logical.ErrInvalidRequest
+		}
+	} else {
+		value, ok := d.GetOk("value")
+		if !ok {
+			return logical.ErrorResponse("missing value to process"), logical.ErrInvalidRequest
+		}
+
+		batchInputItems = []fpeBatchRequestItem{
+			{
+				Value:      value.(string),
+				Context:    d.Get("context").(string),
+				Tweak:      d.Get("tweak").(string),
+				KeyVersion: d.Get("key_version").(int),
+			},
+		}
+	}
+
+	batchResponseItems := make([]fpeBatchResponseItem, len(batchInputItems))
+	for i, item := range batchInputItems {
+		var err error
+		if len(item.Context) != 0 {
+			batchInputItems[i].decodedContext, err = base64.StdEncoding.DecodeString(item.Context)
+			if err != nil {
+				batchResponseItems[i].Error = "failed to base64-decode context"
+				continue
+			}
+		}
+		if len(item.Tweak) != 0 {
+			batchInputItems[i].decodedTweak, err = base64.StdEncoding.DecodeString(item.Tweak)
+			if err != nil {
+				batchResponseItems[i].Error = "failed to base64-decode tweak"
+				continue
+			}
+		}
+	}
+
+	p, _, err := b.lm.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    d.Get("name").(string),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("encryption key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+	defer p.Unlock()
+
+	for i, item := range batchInputItems {
+		if batchResponseItems[i].Error != "" {
+			continue
+		}
+
+		// Decoding with a version other than the one used to encode returns
+		// a wrong value rather than an error, so the version is not guessed
+		ver := item.KeyVersion
+		if ver == 0 {
+			if !encode {
+				batchResponseItems[i].Error = "key_version is required to decode a value"
+				continue
+			}
+			ver = p.LatestVersion
+		}
+
+		var value string
+		if encode {
+			value, err = p.EncodeFPE(ver, item.decodedContext, item.decodedTweak, item.Value)
+		} else {
+			value, err = p.DecodeFPE(ver, item.decodedContext, item.decodedTweak, item.Value)
+		}
+		if err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				batchResponseItems[i].Error = err.Error()
+				continue
+			default:
+				return nil, err
+			}
+		}
+
+		batchResponseItems[i].Value = value
+		batchResponseItems[i].KeyVersion = ver
+	}
+
+	if batchInputRaw != nil {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"batch_results": batchResponseItems,
+			},
+		}, nil
+	}
+
+	if batchResponseItems[0].Error != "" {
+		return logical.ErrorResponse(batchResponseItems[0].Error), logical.ErrInvalidRequest
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"value":       batchResponseItems[0].Value,
+			"key_version": batchResponseItems[0].KeyVersion,
+		},
+	}, nil
+}
+
+const pathEncodeHelpSyn = `Encode a value with format preserving encryption`
+
+const pathEncodeHelpDesc = `
+This path uses the named "ff3-1" key to encrypt a value, or a batch of values,
+with FF3-1 format preserving encryption. The encoded value has the same length
+and format as the original value, and is deterministic for a given key
+version, context and tweak. Since the encoded value does not record the
+version of the key, the version is returned alongside it.
+`
+
+const pathDecodeHelpSyn = `Decode a value encoded with format preserving encryption`
+
+const pathDecodeHelpDesc = `
+This path uses the named "ff3-1" key to decrypt a value, or a batch of values,
+encoded by the "encode" endpoint. The same key version, context and tweak used
+to encode the value must be provided, and the key version is required.
+`
@@ -0,0 +1,156 @@
+package transit
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestTransit_FPE(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	doReq := func(path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   s,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		return resp
+	}
+	doErrReq := func(path string, data map[string]interface{}) {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   s,
+			Data:      data,
+		})
+		if err == nil && (resp == nil || !resp.IsError()) {
+			t.Fatalf("expected error; resp:%#v", resp)
+		}
+	}
+
+	// Alphabets and templates are only supported by ff3-1 keys
+	doErrReq("keys/aes", map[string]interface{}{
+		"alphabet": "numeric",
+	})
+	doErrReq("keys/bad", map[string]interface{}{
+		"type":     "ff3-1",
+		"alphabet": "aab",
+	})
+
+	doReq("keys/cards", map[string]interface{}{
+		"type":     "ff3-1",
+		"template": `(\d{4})-(\d{4})-(\d{4})-(\d{4})`,
+	})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "keys/cards",
+		Storage:   s,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["type"] != "ff3-1" || resp.Data["alphabet"] != "numeric" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// FPE keys can not be used for regular encryption
+	doErrReq("encrypt/cards", map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString([]byte("foo")),
+	})
+
+	card := "4111-1111-1111-1111"
+	tweak := base64.StdEncoding.EncodeToString([]byte("tweak07"))
+
+	resp = doReq("encode/cards", map[string]interface{}{
+		"value": card,
+		"tweak": tweak,
+	})
+	encoded := resp.Data["value"].(string)
+	if len(encoded) != len(card) || encoded == card || resp.Data["key_version"].(int) != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Encoding is deterministic
+	resp = doReq("encode/cards", map[string]interface{}{
+		"value": card,
+		"tweak": tweak,
+	})
+	if resp.Data["value"].(string) != encoded {
+		t.Fatalf("expected %q, got %q", encoded, resp.Data["value"])
+	}
+
+	// After rotation, values are decoded with the version they were encoded
+	// with
+	doReq("keys/cards/rotate", nil)
+	resp = doReq("encode/cards", map[string]interface{}{
+		"value": card,
+		"tweak": tweak,
+	})
+	if resp.Data["value"].(string) == encoded || resp.Data["key_version"].(int) != 2 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp = doReq("decode/cards", map[string]interface{}{
+		"value":       encoded,
+		"tweak":       tweak,
+		"key_version": 1,
+	})
+	if resp.Data["value"].(string) != card {
+		t.Fatalf("expected %q, got %q", card, resp.Data["value"])
+	}
+
+	// The version is required to decode, since it would otherwise default
+	// to the latest version and silently return a wrong value
+	doErrReq("decode/cards", map[string]interface{}{
+		"value": encoded,
+		"tweak": tweak,
+	})
+
+	doErrReq("encode/cards", map[string]interface{}{
+		"value": "4111111111111111",
+	})
+	doErrReq("encode/cards", map[string]interface{}{
+		"value": card,
+		"tweak": base64.StdEncoding.EncodeToString([]byte("short")),
+	})
+
+	// Derived keys bind values to the context
+	doReq("keys/ids", map[string]interface{}{
+		"type":     "ff3-1",
+		"alphabet": "alphanumeric-upper",
+		"derived":  true,
+	})
+	resp = doReq("encode/ids", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"value": "AB12CD34", "context": "dGVuYW50LWE="},
+			map[string]interface{}{"value": "AB12CD34", "context": "dGVuYW50LWI="},
+			map[string]interface{}{"value": "ab12cd34", "context": "dGVuYW50LWI="},
+		},
+	})
+	results := resp.Data["batch_results"].([]fpeBatchResponseItem)
+	if results[0].Error != "" || results[1].Error != "" || results[0].Value == results[1].Value {
+		t.Fatalf("bad: %#v", results)
+	}
+	if results[2].Error == "" {
+		t.Fatalf("expected error for characters outside of the alphabet: %#v", results[2])
+	}
+
+	resp = doReq("decode/ids", map[string]interface{}{
+		"value":       results[1].Value,
+		"context":     "dGVuYW50LWI=",
+		"key_version": results[1].KeyVersion,
+	})
+	if resp.Data["value"].(string) != "AB12CD34" {
+		t.Fatalf("expected %q, got %q", "AB12CD34", resp.Data["value"])
+	}
+}
@@ -0,0 +1,337 @@
+package transit
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func (b *backend) pathImport() *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/import",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The name of the key",
+			},
+
+			"type": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "aes256-gcm96",
+				Description: `
+The type of key being imported. Currently, "aes128-gcm96" (symmetric), "aes256-gcm96" (symmetric), "chacha20-poly1305"
+(symmetric), "ecdsa-p256" (asymmetric), "ecdsa-p384" (asymmetric), "ecdsa-p521" (asymmetric), "ed25519" (asymmetric),
+"rsa-2048" (asymmetric), "rsa-4096" (asymmetric) are supported. Defaults to "aes256-gcm96".
+`,
+			},
+
+			"ciphertext": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The base64-encoded ciphertext of the key material
+to import: the ephemeral AES-256 key encrypted
+with the wrapping key using RSA-OAEP, followed by
+the key material wrapped with the ephemeral key
+using AES key wrap with padding (RFC 5649).
+Symmetric keys are wrapped as raw bytes and
+asymmetric keys as PKCS #8 DER private keys.`,
+			},
+
+			"hash_function": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "SHA256",
+				Description: `The hash function used by RSA-OAEP to encrypt the
+ephemeral key. One of "SHA1", "SHA224", "SHA256",
+"SHA384" or "SHA512". Defaults to "SHA256".`,
+			},
+
+			"allow_rotation": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Whether the key may be rotated, in which case the
+new versions are generated by Vault.`,
+			},
+
+			"derived": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Enables key derivation mode. This
+allows for per-transaction unique
+keys for encryption operations.`,
+			},
+
+			"exportable": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Enables keys to be exportable.
+This allows for all the valid keys
+in the key ring to be exported.`,
+			},
+
+			"allow_plaintext_backup": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Enables taking a backup of the named
+key in plaintext format. Once set,
+this cannot be disabled.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathImportWrite,
+		},
+
+		HelpSynopsis:    pathImportHelpSyn,
+		HelpDescription: pathImportHelpDesc,
+	}
+}
+
+func (b *backend) pathImportVersion() *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/import_version",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The name of the key",
+			},
+
+			"ciphertext": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The base64-encoded ciphertext of the key material
+to import, wrapped as for the "import" endpoint.`,
+			},
+
+			"hash_function": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "SHA256",
+				Description: `The hash function used by RSA-OAEP to encrypt the
+ephemeral key. One of "SHA1", "SHA224", "SHA256",
+"SHA384" or "SHA512". Defaults to "SHA256".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathImportVersionWrite,
+		},
+
+		HelpSynopsis:    pathImportVersionHelpSyn,
+		HelpDescription: pathImportVersionHelpDesc,
+	}
+}
+
+func (b *backend) pathImportWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	keyType := d.Get("type").(string)
+
+	polReq := keysutil.PolicyRequest{
+		Storage:                  req.Storage,
+		Name:                     name,
+		Derived:                  d.Get("derived").(bool),
+		Exportable:               d.Get("exportable").(bool),
+		AllowPlaintextBackup:     d.Get("allow_plaintext_backup").(bool),
+		AllowImportedKeyRotation: d.Get("allow_rotation").(bool),
+	}
+
+	var ok bool
+	polReq.KeyType, ok = parseKeyType(keyType)
+	if !ok {
+		return logical.ErrorResponse(fmt.Sprintf("unknown key type %v", keyType)), logical.ErrInvalidRequest
+	}
+
+	key, resp, err := b.unwrapImportedKey(ctx, req, d)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	if err := b.lm.ImportPolicy(ctx, polReq, key); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathImportVersionWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	p, _, err := b.lm.GetPolicy(ctx, keysutil.PolicyRequest{
+		Storage: req.Storage,
+		Name:    name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("key not found"), logical.ErrInvalidRequest
+	}
+	if !b.System().CachingDisabled() {
+		p.Lock(true)
+	}
+	defer p.Unlock()
+
+	if !p.Imported {
+		return logical.ErrorResponse("key %q was not imported, new versions can only be imported into imported keys", name), logical.ErrInvalidRequest
+	}
+
+	key, resp, err := b.unwrapImportedKey(ctx, req, d)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	if err := p.Import(ctx, req.Storage, key); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	return nil, nil
+}
+
+// unwrapImportedKey decrypts the key material given in the ciphertext field
+// with the wrapping key
+func (b *backend) unwrapImportedKey(ctx context.Context, req *logical.Request, d *framework.FieldData) ([]byte, *logical.Response, error) {
+	ciphertextB64 := d.Get("ciphertext").(string)
+	if ciphertextB64 == "" {
+		return nil, logical.ErrorResponse("'ciphertext' must be supplied"), logical.ErrInvalidRequest
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextB64)
+	if err != nil {
+		return nil, logical.ErrorResponse("failed to base64-decode ciphertext"), logical.ErrInvalidRequest
+	}
+
+	hashFn, err := parseHashFunction(d.Get("hash_function").(string))
+	if err != nil {
+		return nil, logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	wrappingKey, err := b.getWrappingKey(ctx, req.Storage)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The ephemeral key is encrypted to the size of the wrapping key's
+	// modulus, and the wrapped key material follows it
+	keySize := wrappingKey.Size()
+	if len(ciphertext) <= keySize {
+		return nil, logical.ErrorResponse("ciphertext is too short"), logical.ErrInvalidRequest
+	}
+
+	ephemeralKey, err := rsa.DecryptOAEP(hashFn, rand.Reader, wrappingKey, ciphertext[:keySize], nil)
+	if err != nil {
+		return nil, logical.ErrorResponse("failed to decrypt the ephemeral key"), logical.ErrInvalidRequest
+	}
+	if len(ephemeralKey) != 32 {
+		return nil, logical.ErrorResponse("the ephemeral key must be an AES-256 key"), logical.ErrInvalidRequest
+	}
+
+	key, err := unwrapKeyWithPadding(ephemeralKey, ciphertext[keySize:])
+	if err != nil {
+		return nil, logical.ErrorResponse(fmt.Sprintf("failed to unwrap the key material: %v", err)), logical.ErrInvalidRequest
+	}
+
+	return key, nil, nil
+}
+
+func parseHashFunction(name string) (hash.Hash, error) {
+	var h crypto.Hash
+	switch strings.ToUpper(name) {
+	case "SHA1":
+		h = crypto.SHA1
+	case "SHA224":
+		h = crypto.SHA224
+	case "SHA256":
+		h = crypto.SHA256
+	case "SHA384":
+		h = crypto.SHA384
+	case "SHA512":
+		h = crypto.SHA512
+	default:
+		return nil, fmt.Errorf("unsupported hash function %q", name)
+	}
+	return h.New(), nil
+}
+
+// kwpIV is the alternative initial value of AES key wrap with padding
+var kwpIV = []byte{0xa6, 0x59, 0x59, 0xa6}
+
+// unwrapKeyWithPadding implements the unwrapping operation of AES key wrap
+// with padding, as defined by RFC 5649
+func unwrapKeyWithPadding(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 16 || len(wrapped)%8 != 0 {
+		return nil, errors.New("invalid wrapped key length")
+	}
+
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(wrapped)/8 - 1
+	a := make([]byte, 8)
+	r := make([]byte, n*8)
+
+	if n == 1 {
+		// A single block is encrypted directly, see section 4.2
+		buf := make([]byte, 16)
+		block.Decrypt(buf, wrapped)
+		copy(a, buf[:8])
+		copy(r, buf[8:])
+	} else {
+		copy(a, wrapped[:8])
+		copy(r, wrapped[8:])
+
+		buf := make([]byte, 16)
+		for j := 5; j >= 0; j-- {
+			for i := n; i >= 1; i-- {
+				t := uint64(n*j + i)
+				binary.BigEndian.PutUint64(buf[:8], binary.BigEndian.Uint64(a)^t)
+				copy(buf[8:], r[(i-1)*8:i*8])
+				block.Decrypt(buf, buf)
+				copy(a, buf[:8])
+				copy(r[(i-1)*8:i*8], buf[8:])
+			}
+		}
+	}
+
+	// Check the integrity of the unwrapped key, see section 3
+	if subtle.ConstantTimeCompare(a[:4], kwpIV) != 1 {
+		return nil, errors.New("integrity check failed")
+	}
+	length := int(binary.BigEndian.Uint32(a[4:]))
+	if length <= 8*(n-1) || length > 8*n {
+		return nil, errors.New("integrity check failed")
+	}
+	for _, c := range r[length:] {
+		if c != 0 {
+			return nil, errors.New("integrity check failed")
+		}
+	}
+
+	return r[:length], nil
+}
+
+const pathImportHelpSyn = `Import an externally generated key`
+
+const pathImportHelpDesc = `
+This path is used to import an externally generated key as a new named key.
+The key material must be wrapped using the key returned by the "wrapping_key"
+endpoint. Ciphertext and signatures produced by the key outside of Vault are
+only usable with transit if they are in transit's format.
+
+Imported keys can not be rotated unless "allow_rotation" is set, in which case
+the new versions are generated by Vault. New versions of imported material can
+be added with the "import_version" endpoint.
+`
+
+const pathImportVersionHelpSyn = `Import a new version of an imported key`
+
+const pathImportVersionHelpDesc = `
+This path is used to import externally generated key material as the latest
+version of a key that was itself imported. The key material must be wrapped as
+for the "import" endpoint, and must be of the same type as the key.
+`
@@ -0,0 +1,408 @@
+package transit
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// wrapKeyWithPadding implements the wrapping operation of AES key wrap with
+// padding, as defined by RFC 5649
+func wrapKeyWithPadding(t *testing.T, kek, key []byte) []byte {
+	t.Helper()
+
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := make([]byte, 8)
+	copy(a, kwpIV)
+	binary.BigEndian.PutUint32(a[4:], uint32(len(key)))
+
+	r := make([]byte, (len(key)+7)/8*8)
+	copy(r, key)
+	n := len(r) / 8
+
+	if n == 1 {
+		out := make([]byte, 16)
+		block.Encrypt(out, append(a, r...))
+		return out
+	}
+
+	buf := make([]byte, 16)
+	for j := 0; j <= 5; j++ {
+		for i := 1; i <= n; i++ {
+			copy(buf[:8], a)
+			copy(buf[8:], r[(i-1)*8:i*8])
+			block.Encrypt(buf, buf)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(buf[:8])^uint64(n*j+i))
+			copy(r[(i-1)*8:i*8], buf[8:])
+		}
+	}
+	return append(a, r...)
+}
+
+// wrapForImport wraps the key material with the wrapping key of the backend
+func wrapForImport(t *testing.T, b *backend, s logical.Storage, key []byte) string {
+	t.Helper()
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "wrapping_key",
+		Operation: logical.ReadOperation,
+		Storage:   s,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+
+	block, _ := pem.Decode([]byte(resp.Data["public_key"].(string)))
+	if block == nil {
+		t.Fatal("failed to decode wrapping key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrappingKey := pub.(*rsa.PublicKey)
+	if wrappingKey.N.BitLen() != 4096 {
+		t.Fatalf("expected a 4096 bit wrapping key, got %d bits", wrappingKey.N.BitLen())
+	}
+
+	ephemeralKey := make([]byte, 32)
+	if _, err := rand.Read(ephemeralKey); err != nil {
+		t.Fatal(err)
+	}
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, wrappingKey, ephemeralKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrapped := wrapKeyWithPadding(t, ephemeralKey, key)
+	return base64.StdEncoding.EncodeToString(append(encryptedKey, wrapped...))
+}
+
+func TestTransit_KeyWrapWithPadding(t *testing.T) {
+	// Test vectors from section 6 of RFC 5649
+	kek, _ := hex.DecodeString("5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8")
+	cases := []struct {
+		key     string
+		wrapped string
+	}{
+		{
+			key:     "c37b7e6492584340bed12207808941155068f738",
+			wrapped: "138bdeaa9b8fa7fc61f97742e72248ee5ae6ae5360d1ae6a5f54f373fa543b6a",
+		},
+		{
+			key:     "466f7250617369",
+			wrapped: "afbeb0f07dfbf5419200f2ccb50bb24f",
+		},
+	}
+
+	for _, tc := range cases {
+		key, _ := hex.DecodeString(tc.key)
+		wrapped, _ := hex.DecodeString(tc.wrapped)
+
+		if actual := wrapKeyWithPadding(t, kek, key); !bytes.Equal(actual, wrapped) {
+			t.Fatalf("bad wrapped key for %s: %x", tc.key, actual)
+		}
+
+		unwrapped, err := unwrapKeyWithPadding(kek, wrapped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(unwrapped, key) {
+			t.Fatalf("bad unwrapped key for %s: %x", tc.key, unwrapped)
+		}
+
+		wrapped[len(wrapped)-1] ^= 1
+		if _, err := unwrapKeyWithPadding(kek, wrapped); err == nil {
+			t.Fatalf("expected an error unwrapping an altered key for %s", tc.key)
+		}
+	}
+}
+
+func TestTransit_Import_AES(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "keys/imported/import",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+		Data: map[string]interface{}{
+			"ciphertext": wrapForImport(t, b, s, key),
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+
+	// Data encrypted by transit can be decrypted with the imported key
+	plaintext := []byte("the quick brown fox")
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "encrypt/imported",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+		Data: map[string]interface{}{
+			"plaintext": base64.StdEncoding.EncodeToString(plaintext),
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+	ciphertext := resp.Data["ciphertext"].(string)
+	if !strings.HasPrefix(ciphertext, "vault:v1:") {
+		t.Fatalf("bad ciphertext: %s", ciphertext)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, "vault:v1:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("bad plaintext: %q", decrypted)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "keys/imported",
+		Operation: logical.ReadOperation,
+		Storage:   s,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+	if !resp.Data["imported_key"].(bool) || resp.Data["imported_key_allow_rotation"].(bool) {
+		t.Fatalf("bad key: %#v", resp.Data)
+	}
+
+	// Importing over an existing key fails
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "keys/imported/import",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+		Data: map[string]interface{}{
+			"ciphertext": wrapForImport(t, b, s, key),
+		},
+	})
+	if err == nil {
+		t.Fatal("expected an error importing an existing key")
+	}
+
+	// Imported keys can not be rotated by default
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "keys/imported/rotate",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+	})
+	if err == nil {
+		t.Fatal("expected an error rotating an imported key")
+	}
+
+	// New versions can be imported instead
+	newKey := make([]byte, 32)
+	if _, err := rand.Read(newKey); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "keys/imported/import_version",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+		Data: map[string]interface{}{
+			"ciphertext": wrapForImport(t, b, s, newKey),
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+
+	// Data encrypted with the first version remains decryptable
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "decrypt/imported",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+		Data: map[string]interface{}{
+			"ciphertext": ciphertext,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("resp: %#v\nerr: %v", resp, err)
+	}
+	if resp.Data["plaintext"].(string) != base64.StdEncoding.EncodeToString(plaintext) {
+		t.Fatalf("bad plaintext: %#v", resp.Data)
+	}
+
+	// Keys of the wrong size are rejected
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "keys/short/import",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+		Data: map[string]interface{}{
+			"ciphertext": wrapForImport(t, b, s, key[:16]),
+		},
+	})
+	if err == nil {
+		t.Fatal("expected an error importing a key of the wrong size")
+	}
+}
+
+func TestTransit_Import_Asymmetric(t *testing.T) {
+	b, s := createBackendWithStorage(t)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaDER, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed, err := asn1.Marshal(edKey.Seed())
+	if err != nil {
+		t.Fatal(err)
+	}
+	edDER, err := asn1.Marshal(struct {
+		Version    int
+		Algo       pkix.AlgorithmIdentifier
+		PrivateKey []byte
+	}{
+		Algo:       pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 101, 112}},
+		PrivateKey: seed,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := []byte("the quick brown fox")
+	digest := sha256.Sum256(input)
+
+	cases := []struct {
+		keyType string
+		der     []byte
+		verify  func([]byte) bool
+	}{
+		{"rsa-2048", rsaDER, func(sig []byte) bool {
+			return rsa.VerifyPSS(&rsaKey.PublicKey, crypto.SHA256, digest[:], sig, nil) == nil
+		}},
+		{"ecdsa-p384", ecDER, func(sig []byte) bool {
+			var parsed struct{ R, S *big.Int }
+			if _, err := asn1.Unmarshal(sig, &parsed); err != nil {
+				return false
+			}
+			return ecdsa.Verify(&ecKey.PublicKey, digest[:], parsed.R, parsed.S)
+		}},
+		{"ed25519", edDER, func(sig []byte) bool {
+			return ed25519.Verify(edPub, input, sig)
+		}},
+	}
+
+	for _, tc := range cases {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "keys/" + tc.keyType + "/import",
+			Operation: logical.UpdateOperation,
+			Storage:   s,
+			Data: map[string]interface{}{
+				"type":           tc.keyType,
+				"ciphertext":     wrapForImport(t, b, s, tc.der),
+				"allow_rotation": true,
+			},
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s: resp: %#v\nerr: %v", tc.keyType, resp, err)
+		}
+
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "sign/" + tc.keyType,
+			Operation: logical.UpdateOperation,
+			Storage:   s,
+			Data: map[string]interface{}{
+				"input": base64.StdEncoding.EncodeToString(input),
+			},
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s: resp: %#v\nerr: %v", tc.keyType, resp, err)
+		}
+		sig, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(resp.Data["signature"].(string), "vault:v1:"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tc.verify(sig) {
+			t.Fatalf("%s: signature does not verify with the imported key", tc.keyType)
+		}
+
+		// Rotation is allowed, with Vault generating the new version
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Path:      "keys/" + tc.keyType + "/rotate",
+			Operation: logical.UpdateOperation,
+			Storage:   s,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("%s: resp: %#v\nerr: %v", tc.keyType, resp, err)
+		}
+	}
+
+	// Key material must match the key type
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Path:      "keys/mismatch/import",
+		Operation: logical.UpdateOperation,
+		Storage:   s,
+		Data: map[string]interface{}{
+			"type":       "ecdsa-p256",
+			"ciphertext": wrapForImport(t, b, s, ecDER),
+		},
+	})
+	if err == nil {
+		t.Fatalf("expected an error importing a key of the wrong type, got %#v", resp)
+	}
+}
@@ -47,10 +47,28 @@ func (b *backend) pathKeys() *framework.Path {
 				Description: `
 The type of key to create. Currently, "aes128-gcm96" (symmetric), "aes256-gcm96" (symmetric), "ecdsa-p256"
 (asymmetric), "ecdsa-p384" (asymmetric), "ecdsa-p521" (asymmetric), "ed25519" (asymmetric), "rsa-2048" (asymmetric), "rsa-4096"
-(asymmetric) are supported.  Defaults to "aes256-gcm96".
+(asymmetric), "ff3-1" (format preserving) are supported.  Defaults to "aes256-gcm96".
 `,
 			},
 
+			"alphabet": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The characters of the values encoded by an
+"ff3-1" key, either one of "numeric",
+"alphanumeric-lower", "alphanumeric-upper" and
+"alphanumeric", or the characters themselves.
+Defaults to "numeric".`,
+			},
+
+			"template": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `A regular expression that values encoded by an
+"ff3-1" key must match. Only the characters
+matched by its capture groups are encoded, the
+others are left as is. If not set, every
+character of the value is encoded.`,
+			},
+
 			"derived": &framework.FieldSchema{
 				Type: framework.TypeBool,
 				Description: `Enables key derivation mode. This
@@ -88,6 +106,14 @@ key in plaintext format. Once set,
 this cannot be disabled.`,
 			},
 
+			"auto_rotate_period": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `Amount of time the key should live
+before being automatically rotated. A
+value of 0 (the default) disables
+automatic rotation for the key.`,
+			},
+
 			"context": &framework.FieldSchema{
 				Type: framework.TypeString,
 				Description: `Base64 encoded context for key derivation.
@@ -124,11 +150,16 @@ func (b *backend) pathPolicyWrite(ctx context.Context, req *logical.Request, d *
 	keyType := d.Get("type").(string)
 	exportable := d.Get("exportable").(bool)
 	allowPlaintextBackup := d.Get("allow_plaintext_backup").(bool)
+	autoRotatePeriod := time.Duration(d.Get("auto_rotate_period").(int)) * time.Second
 
 	if !derived && convergent {
 		return logical.ErrorResponse("convergent encryption requires derivation to be enabled"), nil
 	}
 
+	if err := validateAutoRotatePeriod(autoRotatePeriod); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
 	polReq := keysutil.PolicyRequest{
 		Upsert:               true,
 		Storage:              req.Storage,
@@ -137,27 +168,13 @@ func (b *backend) pathPolicyWrite(ctx context.Context, req *logical.Request, d *
 		Convergent:           convergent,
 		Exportable:           exportable,
 		AllowPlaintextBackup: allowPlaintextBackup,
+		AutoRotatePeriod:     autoRotatePeriod,
+		FPEAlphabet:          d.Get("alphabet").(string),
+		FPETemplate:          d.Get("template").(string),
 	}
-	switch keyType {
-	case "aes128-gcm96":
-		polReq.KeyType = keysutil.KeyType_AES128_GCM96
-	case "aes256-gcm96":
-		polReq.KeyType = keysutil.KeyType_AES256_GCM96
-	case "chacha20-poly1305":
-		polReq.KeyType = keysutil.KeyType_ChaCha20_Poly1305
-	case "ecdsa-p256":
-		polReq.KeyType = keysutil.KeyType_ECDSA_P256
-	case "ecdsa-p384":
-		polReq.KeyType = keysutil.KeyType_ECDSA_P384
-	case "ecdsa-p521":
-		polReq.KeyType = keysutil.KeyType_ECDSA_P521
-	case "ed25519":
-		polReq.KeyType = keysutil.KeyType_ED25519
-	case "rsa-2048":
-		polReq.KeyType = keysutil.KeyType_RSA2048
-	case "rsa-4096":
-		polReq.KeyType = keysutil.KeyType_RSA4096
-	default:
+	var ok bool
+	polReq.KeyType, ok = parseKeyType(keyType)
+	if !ok {
 		return logical.ErrorResponse(fmt.Sprintf("unknown key type %v", keyType)), logical.ErrInvalidRequest
 	}
 
@@ -168,8 +185,16 @@ func (b *backend) pathPolicyWrite(ctx context.Context, req *logical.Request, d *
 	if p == nil {
 		return nil, fmt.Errorf("error generating key: returned policy was nil")
 	}
-	if b.System().CachingDisabled() {
-		p.Unlock()
+	if !b.System().CachingDisabled() {
+		p.Lock(false)
+	}
+	existingAutoRotatePeriod := p.AutoRotatePeriod
+	p.Unlock()
+
+	// The other parameters of an existing key are ignored, but silently
+	// keeping a different rotation period would leave the key unrotated
+	if _, ok := d.GetOk("auto_rotate_period"); ok && !upserted && autoRotatePeriod != existingAutoRotatePeriod {
+		return logical.ErrorResponse(fmt.Sprintf("key %q already exists with a different auto_rotate_period; update it through the config endpoint", name)), logical.ErrInvalidRequest
 	}
 
 	resp := &logical.Response{}
@@ -180,6 +205,38 @@ func (b *backend) pathPolicyWrite(ctx context.Context, req *logical.Request, d *
 	return nil, nil
 }
 
+// parseKeyType returns the key type with the given name, as accepted by the
+// type parameter of the keys endpoints
+func parseKeyType(keyType string) (keysutil.KeyType, bool) {
+	var kt keysutil.KeyType
+	switch keyType {
+	case "aes128-gcm96":
+		kt = keysutil.KeyType_AES128_GCM96
+	case "aes256-gcm96":
+		kt = keysutil.KeyType_AES256_GCM96
+	case "chacha20-poly1305":
+		kt = keysutil.KeyType_ChaCha20_Poly1305
+	case "ecdsa-p256":
+		kt = keysutil.KeyType_ECDSA_P256
+	case "ecdsa-p384":
+		kt = keysutil.KeyType_ECDSA_P384
+	case "ecdsa-p521":
+		kt = keysutil.KeyType_ECDSA_P521
+	case "ed25519":
+		kt = keysutil.KeyType_ED25519
+	case "rsa-2048":
+		kt = keysutil.KeyType_RSA2048
+	case "rsa-4096":
+		kt = keysutil.KeyType_RSA4096
+	case "ff3-1":
+		kt = keysutil.KeyType_FF3_1
+	default:
+		return 0, false
+	}
+
+	return kt, true
+}
+
 // Built-in helper type for returning asymmetric keys
 type asymKey struct {
 	Name         string    `json:"name" structs:"name" mapstructure:"name"`
@@ -218,6 +275,8 @@ func (b *backend) pathPolicyRead(ctx context.Context, req *logical.Request, d *f
 			"latest_version":         p.LatestVersion,
 			"exportable":             p.Exportable,
 			"allow_plaintext_backup": p.AllowPlaintextBackup,
+			"imported_key":           p.Imported,
+			"auto_rotate_period":     int64(p.AutoRotatePeriod.Seconds()),
 			"supports_encryption":    p.Type.EncryptionSupported(),
 			"supports_decryption":    p.Type.DecryptionSupported(),
 			"supports_signing":       p.Type.SigningSupported(),
@@ -231,6 +290,13 @@ func (b *backend) pathPolicyRead(ctx context.Context, req *logical.Request, d *f
 			"version": p.BackupInfo.Version,
 		}
 	}
+	if p.Imported {
+		resp.Data["imported_key_allow_rotation"] = p.AllowImportedKeyRotation
+	}
+	if p.Type.FPESupported() {
+		resp.Data["alphabet"] = p.FPEAlphabet
+		resp.Data["template"] = p.FPETemplate
+	}
 	if p.RestoreInfo != nil {
 		resp.Data["restore_info"] = map[string]interface{}{
 			"time":    p.RestoreInfo.Time,
@@ -262,7 +328,7 @@ func (b *backend) pathPolicyRead(ctx context.Context, req *logical.Request, d *f
 	}
 
 	switch p.Type {
-	case keysutil.KeyType_AES128_GCM96, keysutil.KeyType_AES256_GCM96, keysutil.KeyType_ChaCha20_Poly1305:
+	case keysutil.KeyType_AES128_GCM96, keysutil.KeyType_AES256_GCM96, keysutil.KeyType_ChaCha20_Poly1305, keysutil.KeyType_FF3_1:
 		retKeys := map[string]int64{}
 		for k, v := range p.Keys {
 			retKeys[k] = v.DeprecatedCreationTime
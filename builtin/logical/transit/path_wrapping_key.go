@@ -0,0 +1,102 @@
+package transit
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/keysutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	wrappingKeyName = "wrapping-key"
+
+	// wrappingKeyStoragePath is where the keysutil policy holding the
+	// wrapping key is persisted, outside of the policy/ prefix so that it is
+	// not listed or usable as a regular key
+	wrappingKeyStoragePath = "import/policy/" + wrappingKeyName
+)
+
+func (b *backend) pathWrappingKey() *framework.Path {
+	return &framework.Path{
+		Pattern: "wrapping_key",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathWrappingKeyRead,
+		},
+
+		HelpSynopsis:    pathWrappingKeyHelpSyn,
+		HelpDescription: pathWrappingKeyHelpDesc,
+	}
+}
+
+func (b *backend) pathWrappingKeyRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key, err := b.getWrappingKey(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	derBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, errwrap.Wrapf("error marshaling wrapping key: {{err}}", err)
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: derBytes,
+	})
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"public_key": string(pemBytes),
+		},
+	}, nil
+}
+
+// getWrappingKey returns the RSA key used to wrap imported keys, generating
+// it if it does not exist yet
+func (b *backend) getWrappingKey(ctx context.Context, storage logical.Storage) (*rsa.PrivateKey, error) {
+	b.wrappingKeyLock.Lock()
+	defer b.wrappingKeyLock.Unlock()
+
+	if b.wrappingKey != nil {
+		return b.wrappingKey, nil
+	}
+
+	p, err := keysutil.LoadPolicy(ctx, storage, wrappingKeyStoragePath)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		p = keysutil.NewPolicy(keysutil.PolicyConfig{
+			Name:          wrappingKeyName,
+			Type:          keysutil.KeyType_RSA4096,
+			StoragePrefix: "import/",
+		})
+		if err := p.Rotate(ctx, storage); err != nil {
+			return nil, errwrap.Wrapf("error generating wrapping key: {{err}}", err)
+		}
+	}
+
+	entry, ok := p.Keys[strconv.Itoa(p.LatestVersion)]
+	if !ok || entry.RSAKey == nil {
+		return nil, fmt.Errorf("wrapping key not found")
+	}
+
+	b.wrappingKey = entry.RSAKey
+	return b.wrappingKey, nil
+}
+
+const pathWrappingKeyHelpSyn = `Returns the public key to use for wrapping imported keys`
+
+const pathWrappingKeyHelpDesc = `
+This path is used to retrieve the RSA-4096 wrapping key for wrapping keys
+being imported into transit. The key material to import must be wrapped with
+an ephemeral AES-256 key using AES key wrap with padding (RFC 5649), and the
+ephemeral key must be encrypted with the wrapping key using RSA-OAEP.
+`
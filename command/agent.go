@@ -5,6 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
@@ -28,10 +29,14 @@ import (
 	"github.com/hashicorp/vault/command/agent/auth/jwt"
 	"github.com/hashicorp/vault/command/agent/auth/kubernetes"
 	"github.com/hashicorp/vault/command/agent/cache"
+	"github.com/hashicorp/vault/command/agent/cache/cacheboltdb"
+	"github.com/hashicorp/vault/command/agent/cache/cachememdb"
 	"github.com/hashicorp/vault/command/agent/config"
 	"github.com/hashicorp/vault/command/agent/sink"
 	"github.com/hashicorp/vault/command/agent/sink/file"
 	"github.com/hashicorp/vault/command/agent/sink/inmem"
+	"github.com/hashicorp/vault/command/agent/sshhost"
+	"github.com/hashicorp/vault/command/agent/template"
 	gatedwriter "github.com/hashicorp/vault/helper/gated-writer"
 	"github.com/hashicorp/vault/sdk/helper/consts"
 	"github.com/hashicorp/vault/sdk/helper/logging"
@@ -74,7 +79,8 @@ func (c *AgentCommand) Help() string {
 Usage: vault agent [options]
 
   This command starts a Vault agent that can perform automatic authentication
-  in certain environments.
+  in certain environments, render secrets into files using templates and keep
+  SSH host keys signed.
 
   Start an agent with a configuration file:
 
@@ -375,6 +381,11 @@ func (c *AgentCommand) Run(args []string) int {
 	default:
 	}
 
+	// Token restored from the persistent cache, used by auto-auth in place of
+	// authenticating as long as it is still valid
+	var restoredToken string
+	var leaseCache *cache.LeaseCache
+
 	// Parse agent listener configurations
 	if config.Cache != nil && len(config.Listeners) != 0 {
 		cacheLogger := c.logger.Named("cache")
@@ -389,19 +400,69 @@ func (c *AgentCommand) Run(args []string) int {
 			return 1
 		}
 
+		// Open the persistent cache, if configured
+		var ps *cacheboltdb.BoltStorage
+		if config.Cache.Persist != nil {
+			keyMaterial, err := ioutil.ReadFile(config.Cache.Persist.KeyFile)
+			if err != nil {
+				c.UI.Error(fmt.Sprintf("Error reading persistent cache key file: %v", err))
+				return 1
+			}
+			ps, err = cacheboltdb.NewBoltStorage(&cacheboltdb.BoltStorageConfig{
+				Path:        config.Cache.Persist.Path,
+				KeyMaterial: keyMaterial,
+				Logger:      cacheLogger.Named("cacheboltdb"),
+			})
+			if err != nil {
+				c.UI.Error(fmt.Sprintf("Error opening persistent cache: %v", err))
+				return 1
+			}
+			defer ps.Close()
+		}
+
 		// Create the lease cache proxier and set its underlying proxier to
 		// the API proxier.
-		leaseCache, err := cache.NewLeaseCache(&cache.LeaseCacheConfig{
+		leaseCache, err = cache.NewLeaseCache(&cache.LeaseCacheConfig{
 			Client:      client,
 			BaseContext: ctx,
 			Proxier:     apiProxy,
 			Logger:      cacheLogger.Named("leasecache"),
+			Storage:     ps,
 		})
 		if err != nil {
 			c.UI.Error(fmt.Sprintf("Error creating lease cache: %v", err))
 			return 1
 		}
 
+		// Restore the previous contents of the cache
+		if ps != nil {
+			if err := leaseCache.Restore(ctx); err != nil {
+				if config.Cache.Persist.ExitOnErr {
+					c.UI.Error(fmt.Sprintf("Error restoring persistent cache: %v", err))
+					return 1
+				}
+				cacheLogger.Error("error restoring persistent cache, starting with an empty cache", "error", err)
+				if err := ps.Clear(); err != nil {
+					c.UI.Error(fmt.Sprintf("Error clearing persistent cache: %v", err))
+					return 1
+				}
+			} else {
+				tokenBytes, err := ps.GetAutoAuthToken()
+				if err != nil {
+					c.UI.Error(fmt.Sprintf("Error reading auto-auth token from persistent cache: %v", err))
+					return 1
+				}
+				if tokenBytes != nil {
+					index, err := cachememdb.Deserialize(tokenBytes)
+					if err != nil {
+						c.UI.Error(fmt.Sprintf("Error reading auto-auth token from persistent cache: %v", err))
+						return 1
+					}
+					restoredToken = index.Token
+				}
+			}
+		}
+
 		var inmemSink sink.Sink
 		if config.Cache.UseAutoAuthToken {
 			cacheLogger.Debug("auto-auth token is allowed to be used; configuring inmem sink")
@@ -468,14 +529,19 @@ func (c *AgentCommand) Run(args []string) int {
 		defer c.cleanupGuard.Do(listenerCloseFunc)
 	}
 
-	var ssDoneCh, ahDoneCh chan struct{}
-	// Start auto-auth and sink servers
+	var ssDoneCh, ahDoneCh, tsDoneCh, shDoneCh chan struct{}
+	// Start auto-auth, sink, template and ssh host certificate servers
 	if method != nil {
+		enableTemplateTokenCh := len(config.Templates) > 0
+		enableSSHHostCertTokenCh := len(config.SSHHostCerts) > 0
 		ah := auth.NewAuthHandler(&auth.AuthHandlerConfig{
 			Logger:                       c.logger.Named("auth.handler"),
 			Client:                       c.client,
 			WrapTTL:                      config.AutoAuth.Method.WrapTTL,
 			EnableReauthOnNewCredentials: config.AutoAuth.EnableReauthOnNewCredentials,
+			EnableTemplateTokenCh:        enableTemplateTokenCh,
+			EnableSSHHostCertTokenCh:     enableSSHHostCertTokenCh,
+			Token:                        restoredToken,
 		})
 		ahDoneCh = ah.DoneCh
 
@@ -486,6 +552,38 @@ func (c *AgentCommand) Run(args []string) int {
 		})
 		ssDoneCh = ss.DoneCh
 
+		if enableTemplateTokenCh {
+			ts, err := template.NewServer(&template.ServerConfig{
+				Logger:        c.logger.Named("template.server"),
+				Client:        client,
+				Templates:     config.Templates,
+				ExitAfterAuth: config.ExitAfterAuth,
+			})
+			if err != nil {
+				c.UI.Error(errwrap.Wrapf("Error creating template server: {{err}}", err).Error())
+				return 1
+			}
+			tsDoneCh = ts.DoneCh
+
+			go ts.Run(ctx, ah.TemplateTokenCh)
+		}
+
+		if enableSSHHostCertTokenCh {
+			sh, err := sshhost.NewServer(&sshhost.ServerConfig{
+				Logger:        c.logger.Named("sshhost.server"),
+				Client:        client,
+				Certs:         config.SSHHostCerts,
+				ExitAfterAuth: config.ExitAfterAuth,
+			})
+			if err != nil {
+				c.UI.Error(errwrap.Wrapf("Error creating ssh host certificate server: {{err}}", err).Error())
+				return 1
+			}
+			shDoneCh = sh.DoneCh
+
+			go sh.Run(ctx, ah.SSHHostCertTokenCh)
+		}
+
 		go ah.Run(ctx, method)
 		go ss.Run(ctx, ah.OutputCh, sinks)
 	}
@@ -518,19 +616,43 @@ func (c *AgentCommand) Run(args []string) int {
 		}
 	}()
 
+	// shutdown stops the agent, keeping the persisted cache around so that
+	// it can be restored on the next start
+	shutdown := func() {
+		if leaseCache != nil {
+			leaseCache.SetShuttingDown(true)
+		}
+		cancelFunc()
+	}
+
 	select {
 	case <-ssDoneCh:
 		// This will happen if we exit-on-auth
 		c.logger.Info("sinks finished, exiting")
+		if tsDoneCh != nil {
+			<-tsDoneCh
+			c.logger.Info("templates finished, exiting")
+		}
+		if shDoneCh != nil {
+			<-shDoneCh
+			c.logger.Info("ssh host certificates finished, exiting")
+		}
+		shutdown()
 	case <-c.ShutdownCh:
 		c.UI.Output("==> Vault agent shutdown triggered")
-		cancelFunc()
+		shutdown()
 		if ahDoneCh != nil {
 			<-ahDoneCh
 		}
 		if ssDoneCh != nil {
 			<-ssDoneCh
 		}
+		if tsDoneCh != nil {
+			<-tsDoneCh
+		}
+		if shDoneCh != nil {
+			<-shDoneCh
+		}
 	}
 
 	return 0
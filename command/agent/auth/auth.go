@@ -30,11 +30,16 @@ type AuthConfig struct {
 type AuthHandler struct {
 	DoneCh                       chan struct{}
 	OutputCh                     chan string
+	TemplateTokenCh              chan string
+	SSHHostCertTokenCh           chan string
 	logger                       hclog.Logger
 	client                       *api.Client
 	random                       *rand.Rand
 	wrapTTL                      time.Duration
 	enableReauthOnNewCredentials bool
+	enableTemplateTokenCh        bool
+	enableSSHHostCertTokenCh     bool
+	token                        string
 }
 
 type AuthHandlerConfig struct {
@@ -42,6 +47,12 @@ type AuthHandlerConfig struct {
 	Client                       *api.Client
 	WrapTTL                      time.Duration
 	EnableReauthOnNewCredentials bool
+	EnableTemplateTokenCh        bool
+	EnableSSHHostCertTokenCh     bool
+
+	// Token is an optional token, such as one restored from the persistent
+	// cache, to use instead of authenticating as long as it is still valid
+	Token string
 }
 
 func NewAuthHandler(conf *AuthHandlerConfig) *AuthHandler {
@@ -50,11 +61,16 @@ func NewAuthHandler(conf *AuthHandlerConfig) *AuthHandler {
 		// This is buffered so that if we try to output after the sink server
 		// has been shut down, during agent shutdown, we won't block
 		OutputCh:                     make(chan string, 1),
+		TemplateTokenCh:              make(chan string, 1),
+		SSHHostCertTokenCh:           make(chan string, 1),
 		logger:                       conf.Logger,
 		client:                       conf.Client,
 		random:                       rand.New(rand.NewSource(int64(time.Now().Nanosecond()))),
 		wrapTTL:                      conf.WrapTTL,
 		enableReauthOnNewCredentials: conf.EnableReauthOnNewCredentials,
+		enableTemplateTokenCh:        conf.EnableTemplateTokenCh,
+		enableSSHHostCertTokenCh:     conf.EnableSSHHostCertTokenCh,
+		token:                        conf.Token,
 	}
 
 	return ah
@@ -76,6 +92,8 @@ func (ah *AuthHandler) Run(ctx context.Context, am AuthMethod) {
 	defer func() {
 		am.Shutdown()
 		close(ah.OutputCh)
+		close(ah.TemplateTokenCh)
+		close(ah.SSHHostCertTokenCh)
 		close(ah.DoneCh)
 		ah.logger.Info("auth handler stopped")
 	}()
@@ -113,34 +131,46 @@ func (ah *AuthHandler) Run(ctx context.Context, am AuthMethod) {
 		// Create a fresh backoff value
 		backoff := 2*time.Second + time.Duration(ah.random.Int63()%int64(time.Second*2)-int64(time.Second))
 
-		ah.logger.Info("authenticating")
-		path, data, err := am.Authenticate(ctx, ah.client)
-		if err != nil {
-			ah.logger.Error("error getting path or data from method", "error", err, "backoff", backoff.Seconds())
-			backoffOrQuit(ctx, backoff)
-			continue
+		var secret *api.Secret
+		var err error
+
+		// Use the provided token, if any, the first time around as long as it
+		// is still valid
+		if ah.token != "" && ah.wrapTTL == 0 {
+			secret = ah.lookupToken(ah.token)
+			ah.token = ""
 		}
 
-		clientToUse := ah.client
-		if ah.wrapTTL > 0 {
-			wrapClient, err := ah.client.Clone()
+		if secret == nil {
+			ah.logger.Info("authenticating")
+			path, data, err := am.Authenticate(ctx, ah.client)
 			if err != nil {
-				ah.logger.Error("error creating client for wrapped call", "error", err, "backoff", backoff.Seconds())
+				ah.logger.Error("error getting path or data from method", "error", err, "backoff", backoff.Seconds())
 				backoffOrQuit(ctx, backoff)
 				continue
 			}
-			wrapClient.SetWrappingLookupFunc(func(string, string) string {
-				return ah.wrapTTL.String()
-			})
-			clientToUse = wrapClient
-		}
 
-		secret, err := clientToUse.Logical().Write(path, data)
-		// Check errors/sanity
-		if err != nil {
-			ah.logger.Error("error authenticating", "error", err, "backoff", backoff.Seconds())
-			backoffOrQuit(ctx, backoff)
-			continue
+			clientToUse := ah.client
+			if ah.wrapTTL > 0 {
+				wrapClient, err := ah.client.Clone()
+				if err != nil {
+					ah.logger.Error("error creating client for wrapped call", "error", err, "backoff", backoff.Seconds())
+					backoffOrQuit(ctx, backoff)
+					continue
+				}
+				wrapClient.SetWrappingLookupFunc(func(string, string) string {
+					return ah.wrapTTL.String()
+				})
+				clientToUse = wrapClient
+			}
+
+			secret, err = clientToUse.Logical().Write(path, data)
+			// Check errors/sanity
+			if err != nil {
+				ah.logger.Error("error authenticating", "error", err, "backoff", backoff.Seconds())
+				backoffOrQuit(ctx, backoff)
+				continue
+			}
 		}
 
 		switch {
@@ -189,6 +219,12 @@ func (ah *AuthHandler) Run(ctx context.Context, am AuthMethod) {
 			}
 			ah.logger.Info("authentication successful, sending token to sinks")
 			ah.OutputCh <- secret.Auth.ClientToken
+			if ah.enableTemplateTokenCh {
+				ah.TemplateTokenCh <- secret.Auth.ClientToken
+			}
+			if ah.enableSSHHostCertTokenCh {
+				ah.SSHHostCertTokenCh <- secret.Auth.ClientToken
+			}
 
 			am.CredSuccess()
 		}
@@ -235,3 +271,50 @@ func (ah *AuthHandler) Run(ctx context.Context, am AuthMethod) {
 		}
 	}
 }
+
+// lookupToken looks up the given token and, if it is still valid, returns a
+// secret describing it that can be handed to the sinks and the renewer. It
+// returns nil if the token cannot be used.
+func (ah *AuthHandler) lookupToken(token string) *api.Secret {
+	client, err := ah.client.Clone()
+	if err != nil {
+		ah.logger.Error("error creating client for token lookup", "error", err)
+		return nil
+	}
+	client.SetToken(token)
+
+	lookup, err := client.Auth().Token().LookupSelf()
+	if err != nil {
+		ah.logger.Info("provided token is no longer valid, re-authenticating", "error", err)
+		return nil
+	}
+	if lookup == nil || lookup.Data == nil {
+		return nil
+	}
+
+	accessor, err := lookup.TokenAccessor()
+	if err != nil {
+		ah.logger.Error("error parsing token accessor", "error", err)
+		return nil
+	}
+	ttl, err := lookup.TokenTTL()
+	if err != nil {
+		ah.logger.Error("error parsing token TTL", "error", err)
+		return nil
+	}
+	renewable, err := lookup.TokenIsRenewable()
+	if err != nil {
+		ah.logger.Error("error parsing token renewability", "error", err)
+		return nil
+	}
+
+	ah.logger.Info("using provided token")
+	return &api.Secret{
+		Auth: &api.SecretAuth{
+			ClientToken:   token,
+			Accessor:      accessor,
+			LeaseDuration: int(ttl.Seconds()),
+			Renewable:     renewable,
+		},
+	}
+}
@@ -0,0 +1,310 @@
+package cacheboltdb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	hclog "github.com/hashicorp/go-hclog"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// DatabaseFileName is the name of the cache database file within the
+	// configured directory
+	DatabaseFileName = "vault-agent-cache.db"
+
+	// TokenType is the bucket holding cached token responses
+	TokenType = "token"
+
+	// LeaseType is the bucket holding cached leased secret responses
+	LeaseType = "lease"
+
+	// AutoAuthTokenType is the bucket holding the auto-auth token. It holds at
+	// most one entry.
+	AutoAuthTokenType = "auto-auth-token"
+
+	metaBucketName = "meta"
+	saltKey        = "salt"
+	canaryKey      = "canary"
+	autoAuthKey    = "auto-auth-token"
+
+	// keyInfo is the HKDF info used when deriving the encryption key
+	keyInfo = "vault-agent-cache"
+
+	canaryValue = "vault-agent-cache-canary"
+)
+
+var (
+	// ErrKeyMismatch is returned when the configured key material does not
+	// match the key that the existing cache was encrypted with.
+	ErrKeyMismatch = errors.New("cache encryption key does not match the existing cache")
+
+	dataBuckets = []string{TokenType, LeaseType, AutoAuthTokenType}
+)
+
+// BoltStorageConfig is the configuration for NewBoltStorage
+type BoltStorageConfig struct {
+	// Path is the directory in which the cache database file is kept
+	Path string
+
+	// KeyMaterial is the secret from which the encryption key is derived. It
+	// must be the same across restarts for the cache to be restored.
+	KeyMaterial []byte
+
+	Logger hclog.Logger
+}
+
+// BoltStorage is a persistent cache for the agent's LeaseCache. Every entry is
+// encrypted with AES-GCM using a key derived at startup from the configured
+// key material and a random salt stored alongside the cache.
+type BoltStorage struct {
+	db     *bolt.DB
+	aead   cipher.AEAD
+	logger hclog.Logger
+}
+
+// NewBoltStorage opens, or creates, the cache database and derives its
+// encryption key.
+func NewBoltStorage(config *BoltStorageConfig) (*BoltStorage, error) {
+	if config == nil {
+		return nil, errors.New("nil configuration provided")
+	}
+	if config.Path == "" {
+		return nil, errors.New("path must be provided")
+	}
+	if len(config.KeyMaterial) == 0 {
+		return nil, errors.New("key material must be provided")
+	}
+	if config.Logger == nil {
+		return nil, errors.New("nil logger provided")
+	}
+
+	if err := os.MkdirAll(config.Path, 0700); err != nil {
+		return nil, errwrap.Wrapf("failed to create cache directory: {{err}}", err)
+	}
+
+	dbPath := filepath.Join(config.Path, DatabaseFileName)
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, errwrap.Wrapf(fmt.Sprintf("failed to open cache database %q: {{err}}", dbPath), err)
+	}
+
+	var salt []byte
+	err = db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists([]byte(metaBucketName))
+		if err != nil {
+			return err
+		}
+		for _, name := range dataBuckets {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+
+		salt = copyBytes(meta.Get([]byte(saltKey)))
+		if salt == nil {
+			salt = make([]byte, 32)
+			if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+				return err
+			}
+			return meta.Put([]byte(saltKey), salt)
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, errwrap.Wrapf("failed to initialize cache database: {{err}}", err)
+	}
+
+	aead, err := deriveAEAD(config.KeyMaterial, salt)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	b := &BoltStorage{
+		db:     db,
+		aead:   aead,
+		logger: config.Logger,
+	}
+
+	if err := b.checkCanary(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// deriveAEAD derives a 256-bit AES-GCM key from the key material and salt
+func deriveAEAD(keyMaterial, salt []byte) (cipher.AEAD, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, keyMaterial, salt, []byte(keyInfo)), key); err != nil {
+		return nil, errwrap.Wrapf("failed to derive cache encryption key: {{err}}", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// checkCanary verifies that the derived key can decrypt the canary value
+// written when the cache was created, writing it if this is a new cache.
+func (b *BoltStorage) checkCanary() error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket([]byte(metaBucketName))
+		ciphertext := meta.Get([]byte(canaryKey))
+		if ciphertext == nil {
+			ciphertext, err := b.encrypt([]byte(canaryValue), []byte(canaryKey))
+			if err != nil {
+				return err
+			}
+			return meta.Put([]byte(canaryKey), ciphertext)
+		}
+
+		plaintext, err := b.decrypt(ciphertext, []byte(canaryKey))
+		if err != nil || string(plaintext) != canaryValue {
+			return ErrKeyMismatch
+		}
+		return nil
+	})
+}
+
+// Set encrypts and stores the given serialized index under id in the bucket
+// for indexType. Storing an auto-auth token replaces any previous one.
+func (b *BoltStorage) Set(id string, plaintext []byte, indexType string) error {
+	if !validType(indexType) {
+		return fmt.Errorf("invalid index type %q", indexType)
+	}
+
+	key := id
+	if indexType == AutoAuthTokenType {
+		key = autoAuthKey
+	}
+
+	ciphertext, err := b.encrypt(plaintext, []byte(indexType+key))
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(indexType)).Put([]byte(key), ciphertext)
+	})
+}
+
+// Delete removes the index with the given id from every bucket
+func (b *BoltStorage) Delete(id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{TokenType, LeaseType} {
+			if err := tx.Bucket([]byte(name)).Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetByType returns the decrypted contents of every index of the given type
+func (b *BoltStorage) GetByType(indexType string) ([][]byte, error) {
+	if !validType(indexType) {
+		return nil, fmt.Errorf("invalid index type %q", indexType)
+	}
+
+	var values [][]byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(indexType)).ForEach(func(k, v []byte) error {
+			plaintext, err := b.decrypt(v, append([]byte(indexType), k...))
+			if err != nil {
+				return errwrap.Wrapf(fmt.Sprintf("failed to decrypt %s entry: {{err}}", indexType), err)
+			}
+			values = append(values, plaintext)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// GetAutoAuthToken returns the stored auto-auth token index, or nil if there
+// is none.
+func (b *BoltStorage) GetAutoAuthToken() ([]byte, error) {
+	values, err := b.GetByType(AutoAuthTokenType)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return values[0], nil
+}
+
+// Clear removes every cached entry while keeping the salt, so the same key
+// material continues to work.
+func (b *BoltStorage) Clear() error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range dataBuckets {
+			if err := tx.DeleteBucket([]byte(name)); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Close closes the underlying database
+func (b *BoltStorage) Close() error {
+	return b.db.Close()
+}
+
+func (b *BoltStorage) encrypt(plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return b.aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func (b *BoltStorage) decrypt(ciphertext, aad []byte) ([]byte, error) {
+	nonceSize := b.aead.NonceSize()
+	if len(ciphertext) < nonceSize {
+		return nil, errors.New("ciphertext too short")
+	}
+	return b.aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], aad)
+}
+
+func validType(indexType string) bool {
+	switch indexType {
+	case TokenType, LeaseType, AutoAuthTokenType:
+		return true
+	}
+	return false
+}
+
+// copyBytes copies a value read from bolt, which is only valid for the life
+// of the transaction.
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
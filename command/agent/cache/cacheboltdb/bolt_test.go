@@ -0,0 +1,128 @@
+package cacheboltdb
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/go-test/deep"
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/helper/logging"
+)
+
+func getTestStorage(t *testing.T, path string, keyMaterial []byte) *BoltStorage {
+	t.Helper()
+
+	b, err := NewBoltStorage(&BoltStorageConfig{
+		Path:        path,
+		KeyMaterial: keyMaterial,
+		Logger:      logging.NewVaultLogger(hclog.Trace),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestBoltStorage_SetGetDelete(t *testing.T) {
+	path, err := ioutil.TempDir("", "bolt-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	b := getTestStorage(t, path, []byte("key material"))
+	defer b.Close()
+
+	if err := b.Set("id1", []byte("token one"), TokenType); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Set("id2", []byte("lease one"), LeaseType); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Set("id3", []byte("auto-auth one"), AutoAuthTokenType); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Set("id4", []byte("auto-auth two"), AutoAuthTokenType); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Set("id5", []byte("bad"), "bad-type"); err == nil {
+		t.Fatal("expected error for invalid type")
+	}
+
+	tokens, err := b.GetByType(TokenType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(tokens, [][]byte{[]byte("token one")}); diff != nil {
+		t.Fatal(diff)
+	}
+
+	// Only the latest auto-auth token is kept
+	autoAuth, err := b.GetAutoAuthToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(autoAuth) != "auto-auth two" {
+		t.Fatalf("bad auto-auth token: %q", autoAuth)
+	}
+
+	if err := b.Delete("id2"); err != nil {
+		t.Fatal(err)
+	}
+	leases, err := b.GetByType(LeaseType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases) != 0 {
+		t.Fatalf("expected no leases, got %d", len(leases))
+	}
+
+	if err := b.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err = b.GetByType(TokenType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 0 {
+		t.Fatalf("expected no tokens after clear, got %d", len(tokens))
+	}
+}
+
+func TestBoltStorage_Reopen(t *testing.T) {
+	path, err := ioutil.TempDir("", "bolt-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+
+	b := getTestStorage(t, path, []byte("key material"))
+	if err := b.Set("id1", []byte("token one"), TokenType); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The wrong key material must be rejected
+	_, err = NewBoltStorage(&BoltStorageConfig{
+		Path:        path,
+		KeyMaterial: []byte("other key material"),
+		Logger:      logging.NewVaultLogger(hclog.Trace),
+	})
+	if err != ErrKeyMismatch {
+		t.Fatalf("expected key mismatch error, got %v", err)
+	}
+
+	b = getTestStorage(t, path, []byte("key material"))
+	defer b.Close()
+
+	tokens, err := b.GetByType(TokenType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(tokens, [][]byte{[]byte("token one")}); diff != nil {
+		t.Fatal(diff)
+	}
+}
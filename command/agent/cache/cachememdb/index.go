@@ -1,6 +1,11 @@
 package cachememdb
 
-import "context"
+import (
+	"context"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/helper/jsonutil"
+)
 
 // Index holds the response to be cached along with multiple other values that
 // serve as pointers to refer back to this index.
@@ -47,7 +52,41 @@ type Index struct {
 	// RenewCtxInfo holds the context and the corresponding cancel func for the
 	// goroutine that manages the renewal of the secret belonging to the
 	// response in this index.
-	RenewCtxInfo *ContextInfo
+	RenewCtxInfo *ContextInfo `json:"-"`
+
+	// Type is the type of the index when it is persisted to storage, e.g.
+	// token or lease.
+	Type string
+
+	// RequestMethod is the HTTP method of the request that resulted in the
+	// response held by this index. It is used to rebuild the request when the
+	// index is restored from persistent storage.
+	RequestMethod string
+
+	// RequestToken is the token used in the request that resulted in the
+	// response held by this index. It is used to renew the secret when the
+	// index is restored from persistent storage.
+	RequestToken string
+
+	// RequestHeader is the header of the request that resulted in the response
+	// held by this index. It is used to renew the secret when the index is
+	// restored from persistent storage.
+	RequestHeader http.Header
+}
+
+// Serialize returns the JSON encoding of the index, omitting the renewal
+// context which cannot outlive the process.
+func (i *Index) Serialize() ([]byte, error) {
+	return jsonutil.EncodeJSON(i)
+}
+
+// Deserialize decodes an index previously encoded with Serialize.
+func Deserialize(indexBytes []byte) (*Index, error) {
+	index := new(Index)
+	if err := jsonutil.DecodeJSON(indexBytes, index); err != nil {
+		return nil, err
+	}
+	return index, nil
 }
 
 type IndexName uint32
@@ -0,0 +1,45 @@
+package cachememdb
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestIndex_Serialize(t *testing.T) {
+	index := &Index{
+		ID:            "test_id",
+		Namespace:     "test_ns/",
+		RequestPath:   "/v1/request/path",
+		Token:         "test_token",
+		TokenAccessor: "test_accessor",
+		Lease:         "test_lease",
+		LeaseToken:    "test_lease_token",
+		Response:      []byte("hello world"),
+		Type:          "lease",
+		RequestMethod: "GET",
+		RequestToken:  "test_token",
+		RequestHeader: http.Header{
+			"X-Vault-Namespace": []string{"test_ns/"},
+		},
+		RenewCtxInfo: NewContextInfo(context.Background()),
+	}
+
+	indexBytes, err := index.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deserialized, err := Deserialize(indexBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The renewal context is not serialized
+	index.RenewCtxInfo = nil
+	if diff := deep.Equal(index, deserialized); diff != nil {
+		t.Fatal(diff)
+	}
+}
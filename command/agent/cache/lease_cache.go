@@ -13,12 +13,15 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/errwrap"
 	hclog "github.com/hashicorp/go-hclog"
+	multierror "github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/api"
 	"github.com/hashicorp/vault/command/agent/agentint"
+	"github.com/hashicorp/vault/command/agent/cache/cacheboltdb"
 	cachememdb "github.com/hashicorp/vault/command/agent/cache/cachememdb"
 	"github.com/hashicorp/vault/helper/namespace"
 	nshelper "github.com/hashicorp/vault/helper/namespace"
@@ -79,6 +82,14 @@ type LeaseCache struct {
 	// idLocks is used during cache lookup to ensure that identical requests made
 	// in parallel won't trigger multiple renewal goroutines.
 	idLocks []*locksutil.LockEntry
+
+	// ps is the persistent storage for the cache. It is nil if persistence
+	// is not configured.
+	ps *cacheboltdb.BoltStorage
+
+	// shuttingDown is used to determine if cache needs to be evicted or not
+	// when the context is cancelled
+	shuttingDown int32
 }
 
 // LeaseCacheConfig is the configuration for initializing a new
@@ -88,6 +99,7 @@ type LeaseCacheConfig struct {
 	BaseContext context.Context
 	Proxier     Proxier
 	Logger      hclog.Logger
+	Storage     *cacheboltdb.BoltStorage
 }
 
 // NewLeaseCache creates a new instance of a LeaseCache.
@@ -120,9 +132,25 @@ func NewLeaseCache(conf *LeaseCacheConfig) (*LeaseCache, error) {
 		baseCtxInfo: baseCtxInfo,
 		l:           &sync.RWMutex{},
 		idLocks:     locksutil.CreateLocks(),
+		ps:          conf.Storage,
 	}, nil
 }
 
+// SetShuttingDown is a setter for the shuttingDown field. While shutting
+// down, entries evicted from the in-memory cache are kept in persistent
+// storage so that they can be restored on the next start.
+func (c *LeaseCache) SetShuttingDown(in bool) {
+	if in {
+		atomic.StoreInt32(&c.shuttingDown, 1)
+		return
+	}
+	atomic.StoreInt32(&c.shuttingDown, 0)
+}
+
+func (c *LeaseCache) isShuttingDown() bool {
+	return atomic.LoadInt32(&c.shuttingDown) == 1
+}
+
 // checkCacheForRequest checks the cache for a particular request based on its
 // computed ID. It returns a non-nil *SendResponse  if an entry is found.
 func (c *LeaseCache) checkCacheForRequest(id string) (*SendResponse, error) {
@@ -231,9 +259,12 @@ func (c *LeaseCache) Send(ctx context.Context, req *SendRequest) (*SendResponse,
 
 	// Build the index to cache based on the response received
 	index := &cachememdb.Index{
-		ID:          id,
-		Namespace:   namespace,
-		RequestPath: req.Request.URL.Path,
+		ID:            id,
+		Namespace:     namespace,
+		RequestPath:   req.Request.URL.Path,
+		RequestMethod: req.Request.Method,
+		RequestToken:  req.Token,
+		RequestHeader: req.Request.Header,
 	}
 
 	secret, err := api.ParseSecret(bytes.NewReader(resp.ResponseBody))
@@ -290,6 +321,7 @@ func (c *LeaseCache) Send(ctx context.Context, req *SendRequest) (*SendResponse,
 
 		index.Lease = secret.LeaseID
 		index.LeaseToken = req.Token
+		index.Type = cacheboltdb.LeaseType
 
 	case secret.Auth != nil:
 		c.logger.Debug("processing auth response", "method", req.Request.Method, "path", req.Request.URL.Path)
@@ -312,12 +344,13 @@ func (c *LeaseCache) Send(ctx context.Context, req *SendRequest) (*SendResponse,
 			c.logger.Debug("setting parent context", "method", req.Request.Method, "path", req.Request.URL.Path)
 			parentCtx = entry.RenewCtxInfo.Ctx
 
-			entry.TokenParent = req.Token
+			index.TokenParent = req.Token
 		}
 
 		renewCtxInfo = c.createCtxInfo(parentCtx)
 		index.Token = secret.Auth.ClientToken
 		index.TokenAccessor = secret.Auth.Accessor
+		index.Type = cacheboltdb.TokenType
 
 	default:
 		// We shouldn't be hitting this, but will err on the side of caution and
@@ -361,6 +394,12 @@ func (c *LeaseCache) Send(ctx context.Context, req *SendRequest) (*SendResponse,
 		return nil, err
 	}
 
+	// Persist the index to storage
+	if err := c.persistIndex(index); err != nil {
+		c.logger.Error("failed to persist the proxied response", "error", err)
+		return nil, err
+	}
+
 	// Start renewing the secret in the response
 	go c.startRenewing(renewCtx, index, req, secret)
 
@@ -385,6 +424,14 @@ func (c *LeaseCache) startRenewing(ctx context.Context, index *cachememdb.Index,
 			c.logger.Error("failed to evict index", "id", id, "error", err)
 			return
 		}
+
+		// Keep the persisted index around when shutting down so that it can
+		// be restored on the next start.
+		if c.ps != nil && !c.isShuttingDown() {
+			if err := c.ps.Delete(id); err != nil {
+				c.logger.Error("failed to delete index from persistent storage", "id", id, "error", err)
+			}
+		}
 	}()
 
 	client, err := c.client.Clone()
@@ -604,6 +651,13 @@ func (c *LeaseCache) handleCacheClear(ctx context.Context, in *cacheClearInput)
 			return err
 		}
 
+		// Reset the persistent storage
+		if c.ps != nil {
+			if err := c.ps.Clear(); err != nil {
+				return err
+			}
+		}
+
 	default:
 		return errInvalidType
 	}
@@ -734,6 +788,10 @@ func (c *LeaseCache) handleRevocationRequest(ctx context.Context, req *SendReque
 				c.logger.Error("failed to persist index", "error", err)
 				return false, err
 			}
+			if err := c.persistIndex(index); err != nil {
+				c.logger.Error("failed to persist index", "error", err)
+				return false, err
+			}
 		}
 
 	case path == vaultPathLeaseRevoke:
@@ -868,8 +926,12 @@ func (c *LeaseCache) RegisterAutoAuthToken(token string) error {
 		return err
 	}
 
-	// If the index is found, defer its cancelFunc
+	// If the index is found, the token was either already registered or was
+	// restored from persistent storage
 	if oldIndex != nil {
+		if oldIndex.Type == cacheboltdb.AutoAuthTokenType {
+			return nil
+		}
 		defer oldIndex.RenewCtxInfo.CancelFunc()
 	}
 
@@ -894,6 +956,7 @@ func (c *LeaseCache) RegisterAutoAuthToken(token string) error {
 		Token:       token,
 		Namespace:   namespace,
 		RequestPath: requestPath,
+		Type:        cacheboltdb.AutoAuthTokenType,
 	}
 
 	// Derive a context off of the lease cache's base context
@@ -913,6 +976,206 @@ func (c *LeaseCache) RegisterAutoAuthToken(token string) error {
 		return err
 	}
 
+	if err := c.persistIndex(index); err != nil {
+		c.logger.Error("failed to persist the auto-auth token", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// persistIndex writes the index to persistent storage, if configured
+func (c *LeaseCache) persistIndex(index *cachememdb.Index) error {
+	if c.ps == nil {
+		return nil
+	}
+
+	indexBytes, err := index.Serialize()
+	if err != nil {
+		return errwrap.Wrapf("failed to serialize index: {{err}}", err)
+	}
+
+	return c.ps.Set(index.ID, indexBytes, index.Type)
+}
+
+// Restore loads the cached indexes from persistent storage into the in-memory
+// cache and restarts the renewal of their secrets. Tokens are restored before
+// the leases that belong to them, and parent tokens before their children,
+// so that renewal contexts are derived in the same way as when the responses
+// were first cached.
+func (c *LeaseCache) Restore(ctx context.Context) error {
+	if c.ps == nil {
+		return errors.New("no persistent storage configured")
+	}
+
+	var errs *multierror.Error
+
+	// Restore the auto-auth token first, since the other tokens are likely
+	// children of it
+	autoAuthBytes, err := c.ps.GetAutoAuthToken()
+	if err != nil {
+		return err
+	}
+	if autoAuthBytes != nil {
+		index, err := cachememdb.Deserialize(autoAuthBytes)
+		if err != nil {
+			return errwrap.Wrapf("failed to deserialize auto-auth token: {{err}}", err)
+		}
+		ctxInfo := c.createCtxInfo(nil)
+		index.RenewCtxInfo = &cachememdb.ContextInfo{
+			Ctx:        context.WithValue(ctxInfo.Ctx, contextIndexID, index.ID),
+			CancelFunc: ctxInfo.CancelFunc,
+			DoneCh:     ctxInfo.DoneCh,
+		}
+		if err := c.db.Set(index); err != nil {
+			return errwrap.Wrapf("failed to restore auto-auth token: {{err}}", err)
+		}
+	}
+
+	tokens, err := c.restoreIndexes(cacheboltdb.TokenType)
+	if err != nil {
+		return err
+	}
+	if err := c.restoreTokens(ctx, tokens); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	leases, err := c.restoreIndexes(cacheboltdb.LeaseType)
+	if err != nil {
+		return err
+	}
+	for _, index := range leases {
+		if err := c.restoreLease(ctx, index); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// restoreIndexes reads and deserializes all the persisted indexes of the
+// given type
+func (c *LeaseCache) restoreIndexes(indexType string) ([]*cachememdb.Index, error) {
+	values, err := c.ps.GetByType(indexType)
+	if err != nil {
+		return nil, errwrap.Wrapf(fmt.Sprintf("failed to read %s indexes from persistent storage: {{err}}", indexType), err)
+	}
+
+	indexes := make([]*cachememdb.Index, 0, len(values))
+	for _, value := range values {
+		index, err := cachememdb.Deserialize(value)
+		if err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("failed to deserialize %s index: {{err}}", indexType), err)
+		}
+		indexes = append(indexes, index)
+	}
+
+	return indexes, nil
+}
+
+// restoreTokens restores token indexes such that a parent is always restored
+// before its children
+func (c *LeaseCache) restoreTokens(ctx context.Context, indexes []*cachememdb.Index) error {
+	var errs *multierror.Error
+
+	pending := indexes
+	for len(pending) > 0 {
+		var next []*cachememdb.Index
+		for _, index := range pending {
+			var parentCtx context.Context
+			if index.TokenParent != "" {
+				parent, err := c.db.Get(cachememdb.IndexNameToken, index.TokenParent)
+				if err != nil {
+					return err
+				}
+				if parent == nil {
+					// The parent may not have been restored yet
+					next = append(next, index)
+					continue
+				}
+				parentCtx = parent.RenewCtxInfo.Ctx
+			}
+
+			if err := c.restoreIndex(ctx, index, c.createCtxInfo(parentCtx)); err != nil {
+				errs = multierror.Append(errs, err)
+			}
+		}
+
+		// If no progress was made, the remaining tokens belong to parents
+		// that are no longer cached and cannot be restored
+		if len(next) == len(pending) {
+			for _, index := range next {
+				c.logger.Debug("dropping persisted token whose parent is not cached", "id", index.ID, "path", index.RequestPath)
+				if err := c.ps.Delete(index.ID); err != nil {
+					errs = multierror.Append(errs, err)
+				}
+			}
+			break
+		}
+		pending = next
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// restoreLease restores a lease index under the context of the token that
+// created it
+func (c *LeaseCache) restoreLease(ctx context.Context, index *cachememdb.Index) error {
+	entry, err := c.db.Get(cachememdb.IndexNameToken, index.LeaseToken)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		c.logger.Debug("dropping persisted lease whose token is not cached", "id", index.ID, "path", index.RequestPath)
+		return c.ps.Delete(index.ID)
+	}
+
+	return c.restoreIndex(ctx, index, cachememdb.NewContextInfo(entry.RenewCtxInfo.Ctx))
+}
+
+// restoreIndex rebuilds the request and secret held by the index, stores it
+// in the in-memory cache and starts renewing it
+func (c *LeaseCache) restoreIndex(ctx context.Context, index *cachememdb.Index, renewCtxInfo *cachememdb.ContextInfo) error {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(index.Response)), nil)
+	if err != nil {
+		return errwrap.Wrapf(fmt.Sprintf("failed to deserialize response for %q: {{err}}", index.RequestPath), err)
+	}
+	secret, err := api.ParseSecret(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return errwrap.Wrapf(fmt.Sprintf("failed to parse secret for %q: {{err}}", index.RequestPath), err)
+	}
+	if secret == nil {
+		return fmt.Errorf("no secret found in the response for %q", index.RequestPath)
+	}
+
+	httpReq, err := http.NewRequest(index.RequestMethod, index.RequestPath, nil)
+	if err != nil {
+		return err
+	}
+	httpReq = httpReq.WithContext(ctx)
+	if index.RequestHeader != nil {
+		httpReq.Header = index.RequestHeader
+	}
+	req := &SendRequest{
+		Token:   index.RequestToken,
+		Request: httpReq,
+	}
+
+	renewCtx := context.WithValue(renewCtxInfo.Ctx, contextIndexID, index.ID)
+	index.RenewCtxInfo = &cachememdb.ContextInfo{
+		Ctx:        renewCtx,
+		CancelFunc: renewCtxInfo.CancelFunc,
+		DoneCh:     renewCtxInfo.DoneCh,
+	}
+
+	c.logger.Debug("restoring index from persistent storage", "method", index.RequestMethod, "path", index.RequestPath)
+	if err := c.db.Set(index); err != nil {
+		return err
+	}
+
+	go c.startRenewing(renewCtx, index, req, secret)
+
 	return nil
 }
 
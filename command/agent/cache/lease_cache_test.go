@@ -3,13 +3,16 @@ package cache
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/hashicorp/vault/command/agent/cache/cacheboltdb"
 	"github.com/hashicorp/vault/command/agent/cache/cachememdb"
 
 	"github.com/go-test/deep"
@@ -509,3 +512,140 @@ func TestCache_DeriveNamespaceAndRevocationPath(t *testing.T) {
 		})
 	}
 }
+
+func TestLeaseCache_PersistAndRestore(t *testing.T) {
+	// Renewal requests block until the test is done so that the cached
+	// entries are not evicted by failed renewals
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	config := api.DefaultConfig()
+	config.Address = ts.URL
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "agent-cache-persist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger := logging.NewVaultLogger(hclog.Trace)
+	ps, err := cacheboltdb.NewBoltStorage(&cacheboltdb.BoltStorageConfig{
+		Path:        dir,
+		KeyMaterial: []byte("key material"),
+		Logger:      logger.Named("cacheboltdb"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.Close()
+
+	responses := []*SendResponse{
+		newTestSendResponse(http.StatusCreated, `{"auth": {"client_token": "testtoken", "renewable": true}}`),
+		newTestSendResponse(http.StatusOK, `{"lease_id": "foo", "renewable": true, "data": {"value": "foo"}}`),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lc, err := NewLeaseCache(&LeaseCacheConfig{
+		Client:      client,
+		BaseContext: ctx,
+		Proxier:     newMockProxier(responses),
+		Logger:      logger.Named("cache.leasecache"),
+		Storage:     ps,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lc.RegisterAutoAuthToken("autoauthtoken"); err != nil {
+		t.Fatal(err)
+	}
+
+	urlPath := "http://example.com/v1/sample/api"
+	newRequests := func() []*SendRequest {
+		return []*SendRequest{
+			&SendRequest{
+				Token:   "autoauthtoken",
+				Request: httptest.NewRequest("GET", urlPath, strings.NewReader(`{"value": "input"}`)),
+			},
+			&SendRequest{
+				Token:   "testtoken",
+				Request: httptest.NewRequest("GET", urlPath, strings.NewReader(`{"value": "input"}`)),
+			},
+		}
+	}
+	for _, req := range newRequests() {
+		if _, err := lc.Send(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Shut down the cache without removing the persisted entries
+	lc.SetShuttingDown(true)
+	cancel()
+
+	restoredCache, err := NewLeaseCache(&LeaseCacheConfig{
+		Client:      client,
+		BaseContext: context.Background(),
+		Proxier:     newMockProxier(nil),
+		Logger:      logger.Named("cache.leasecache"),
+		Storage:     ps,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restoredCache.Restore(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"autoauthtoken", "testtoken"} {
+		index, err := restoredCache.db.Get(cachememdb.IndexNameToken, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if index == nil {
+			t.Fatalf("expected token %q to be restored", name)
+		}
+	}
+	index, err := restoredCache.db.Get(cachememdb.IndexNameLease, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index == nil {
+		t.Fatal("expected lease to be restored")
+	}
+	if index.LeaseToken != "testtoken" {
+		t.Fatalf("bad lease token: %q", index.LeaseToken)
+	}
+
+	// The restored cache has nothing to proxy to, so the responses must be
+	// served from the cache
+	for _, req := range newRequests() {
+		resp, err := restoredCache.Send(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !resp.CacheMeta.Hit {
+			t.Fatal("expected a cached response")
+		}
+	}
+
+	// Re-registering the restored auto-auth token keeps its children
+	if err := restoredCache.RegisterAutoAuthToken("autoauthtoken"); err != nil {
+		t.Fatal(err)
+	}
+	index, err = restoredCache.db.Get(cachememdb.IndexNameToken, "testtoken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index == nil || index.RenewCtxInfo.Ctx.Err() != nil {
+		t.Fatal("expected child token to remain cached")
+	}
+}
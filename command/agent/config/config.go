@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,12 +19,14 @@ import (
 
 // Config is the configuration for the vault server.
 type Config struct {
-	AutoAuth      *AutoAuth   `hcl:"auto_auth"`
-	ExitAfterAuth bool        `hcl:"exit_after_auth"`
-	PidFile       string      `hcl:"pid_file"`
-	Listeners     []*Listener `hcl:"listeners"`
-	Cache         *Cache      `hcl:"cache"`
-	Vault         *Vault      `hcl:"vault"`
+	AutoAuth      *AutoAuth      `hcl:"auto_auth"`
+	ExitAfterAuth bool           `hcl:"exit_after_auth"`
+	PidFile       string         `hcl:"pid_file"`
+	Listeners     []*Listener    `hcl:"listeners"`
+	Cache         *Cache         `hcl:"cache"`
+	Vault         *Vault         `hcl:"vault"`
+	Templates     []*Template    `hcl:"templates"`
+	SSHHostCerts  []*SSHHostCert `hcl:"ssh_host_certs"`
 }
 
 type Vault struct {
@@ -37,7 +40,15 @@ type Vault struct {
 }
 
 type Cache struct {
-	UseAutoAuthToken bool `hcl:"use_auto_auth_token"`
+	UseAutoAuthToken bool     `hcl:"use_auto_auth_token"`
+	Persist          *Persist `hcl:"-"`
+}
+
+// Persist contains the configuration for persisting the cache to disk
+type Persist struct {
+	Path      string `hcl:"path"`
+	KeyFile   string `hcl:"key_file"`
+	ExitOnErr bool   `hcl:"exit_on_err"`
 }
 
 type Listener struct {
@@ -74,6 +85,38 @@ type Sink struct {
 	Config     map[string]interface{}
 }
 
+// Template is the configuration for a single template that the agent renders
+// to disk using secrets read with the auto-auth token.
+type Template struct {
+	Source            string        `hcl:"source"`
+	Contents          string        `hcl:"contents"`
+	Destination       string        `hcl:"destination"`
+	Command           string        `hcl:"command"`
+	CommandTimeoutRaw interface{}   `hcl:"command_timeout"`
+	CommandTimeout    time.Duration `hcl:"-"`
+	PermsRaw          interface{}   `hcl:"perms"`
+	Perms             os.FileMode   `hcl:"-"`
+	LeftDelim         string        `hcl:"left_delimiter"`
+	RightDelim        string        `hcl:"right_delimiter"`
+	ErrorOnMissingKey bool          `hcl:"error_on_missing_key"`
+}
+
+// SSHHostCert is the configuration for a single SSH host key that the agent
+// has signed by the SSH secrets engine with the auto-auth token, re-signing it
+// before the certificate expires.
+type SSHHostCert struct {
+	MountPath         string        `hcl:"mount_path"`
+	Role              string        `hcl:"role"`
+	PublicKeyPath     string        `hcl:"public_key_path"`
+	CertPath          string        `hcl:"cert_path"`
+	ValidPrincipals   string        `hcl:"valid_principals"`
+	TTLRaw            interface{}   `hcl:"ttl"`
+	TTL               time.Duration `hcl:"-"`
+	Command           string        `hcl:"command"`
+	CommandTimeoutRaw interface{}   `hcl:"command_timeout"`
+	CommandTimeout    time.Duration `hcl:"-"`
+}
+
 // LoadConfig loads the configuration at the given path, regardless if
 // its a file or directory.
 func LoadConfig(path string) (*Config, error) {
@@ -138,9 +181,33 @@ func LoadConfig(path string) (*Config, error) {
 		}
 	}
 
+	err = parseTemplates(&result, list)
+	if err != nil {
+		return nil, errwrap.Wrapf("error parsing 'template': {{err}}", err)
+	}
+
+	if len(result.Templates) > 0 && result.AutoAuth == nil {
+		return nil, fmt.Errorf("template stanzas require auto_auth to be configured")
+	}
+
+	err = parseSSHHostCerts(&result, list)
+	if err != nil {
+		return nil, errwrap.Wrapf("error parsing 'ssh_host_cert': {{err}}", err)
+	}
+
+	if len(result.SSHHostCerts) > 0 && result.AutoAuth == nil {
+		return nil, fmt.Errorf("ssh_host_cert stanzas require auto_auth to be configured")
+	}
+
 	if result.AutoAuth != nil {
-		if len(result.AutoAuth.Sinks) == 0 && (result.Cache == nil || !result.Cache.UseAutoAuthToken) {
-			return nil, fmt.Errorf("auto_auth requires at least one sink or cache.use_auto_auth_token=true ")
+		if len(result.AutoAuth.Sinks) == 0 && len(result.Templates) == 0 && len(result.SSHHostCerts) == 0 && (result.Cache == nil || !result.Cache.UseAutoAuthToken) {
+			return nil, fmt.Errorf("auto_auth requires at least one sink, template, ssh_host_cert or cache.use_auto_auth_token=true ")
+		}
+		if len(result.Templates) > 0 && result.AutoAuth.Method.WrapTTL > 0 {
+			return nil, fmt.Errorf("template stanzas cannot be used when auto_auth uses wrapping")
+		}
+		if len(result.SSHHostCerts) > 0 && result.AutoAuth.Method.WrapTTL > 0 {
+			return nil, fmt.Errorf("ssh_host_cert stanzas cannot be used when auto_auth uses wrapping")
 		}
 	}
 
@@ -205,6 +272,46 @@ func parseCache(result *Config, list *ast.ObjectList) error {
 	}
 
 	result.Cache = &c
+
+	subs, ok := item.Val.(*ast.ObjectType)
+	if !ok {
+		return fmt.Errorf("could not parse %q as an object", name)
+	}
+
+	if err := parsePersist(result, subs.List); err != nil {
+		return errwrap.Wrapf("error parsing 'persist': {{err}}", err)
+	}
+
+	return nil
+}
+
+func parsePersist(result *Config, list *ast.ObjectList) error {
+	name := "persist"
+
+	persistList := list.Filter(name)
+	if len(persistList.Items) == 0 {
+		return nil
+	}
+
+	if len(persistList.Items) > 1 {
+		return fmt.Errorf("only one %q block is allowed", name)
+	}
+
+	item := persistList.Items[0]
+
+	var p Persist
+	if err := hcl.DecodeObject(&p, item.Val); err != nil {
+		return err
+	}
+
+	if p.Path == "" {
+		return errors.New("persist path must be specified")
+	}
+	if p.KeyFile == "" {
+		return errors.New("persist key_file must be specified")
+	}
+
+	result.Cache.Persist = &p
 	return nil
 }
 
@@ -408,3 +515,139 @@ func parseSinks(result *Config, list *ast.ObjectList) error {
 	result.AutoAuth.Sinks = ts
 	return nil
 }
+
+func parseTemplates(result *Config, list *ast.ObjectList) error {
+	name := "template"
+
+	templateList := list.Filter(name)
+	if len(templateList.Items) < 1 {
+		return nil
+	}
+
+	var templates []*Template
+	for _, item := range templateList.Items {
+		var t Template
+		if err := hcl.DecodeObject(&t, item.Val); err != nil {
+			return err
+		}
+
+		switch {
+		case t.Destination == "":
+			return errors.New("template destination must be specified")
+		case t.Source == "" && t.Contents == "":
+			return multierror.Prefix(errors.New("one of 'source' or 'contents' must be specified"), fmt.Sprintf("template.%s", t.Destination))
+		case t.Source != "" && t.Contents != "":
+			return multierror.Prefix(errors.New("'source' and 'contents' are mutually exclusive"), fmt.Sprintf("template.%s", t.Destination))
+		}
+
+		if t.CommandTimeoutRaw != nil {
+			var err error
+			if t.CommandTimeout, err = parseutil.ParseDurationSecond(t.CommandTimeoutRaw); err != nil {
+				return multierror.Prefix(err, fmt.Sprintf("template.%s", t.Destination))
+			}
+			t.CommandTimeoutRaw = nil
+		}
+
+		t.Perms = 0644
+		if t.PermsRaw != nil {
+			perms, err := parseTemplatePerms(t.PermsRaw)
+			if err != nil {
+				return multierror.Prefix(err, fmt.Sprintf("template.%s", t.Destination))
+			}
+			t.Perms = perms
+			t.PermsRaw = nil
+		}
+
+		templates = append(templates, &t)
+	}
+
+	result.Templates = templates
+	return nil
+}
+
+// parseTemplatePerms parses the file mode of a template. HCL already decodes
+// unquoted octal literals such as 0640 into integers, so only strings are
+// parsed as octal.
+func parseTemplatePerms(raw interface{}) (os.FileMode, error) {
+	var perms uint64
+	switch v := raw.(type) {
+	case int:
+		if v < 0 {
+			return 0, fmt.Errorf("invalid value for 'perms': %v", raw)
+		}
+		perms = uint64(v)
+	case string:
+		var err error
+		if perms, err = strconv.ParseUint(v, 8, 32); err != nil {
+			return 0, fmt.Errorf("invalid value for 'perms': %q", v)
+		}
+	default:
+		return 0, fmt.Errorf("invalid value for 'perms': %v", raw)
+	}
+
+	if perms > uint64(os.ModePerm) {
+		return 0, fmt.Errorf("invalid value for 'perms': %#o is not a valid file mode", perms)
+	}
+	return os.FileMode(perms), nil
+}
+
+func parseSSHHostCerts(result *Config, list *ast.ObjectList) error {
+	name := "ssh_host_cert"
+
+	certList := list.Filter(name)
+	if len(certList.Items) < 1 {
+		return nil
+	}
+
+	var certs []*SSHHostCert
+	for _, item := range certList.Items {
+		var c SSHHostCert
+		if err := hcl.DecodeObject(&c, item.Val); err != nil {
+			return err
+		}
+
+		switch {
+		case c.PublicKeyPath == "":
+			return errors.New("ssh_host_cert public_key_path must be specified")
+		case c.Role == "":
+			return multierror.Prefix(errors.New("'role' must be specified"), fmt.Sprintf("ssh_host_cert.%s", c.PublicKeyPath))
+		}
+
+		// Default to the mount path of the SSH secrets engine
+		if c.MountPath == "" {
+			c.MountPath = "ssh"
+		}
+		// Standardize on no trailing slash
+		c.MountPath = strings.TrimSuffix(c.MountPath, "/")
+
+		// Write the certificate next to the key, where sshd expects it by
+		// default
+		if c.CertPath == "" {
+			c.CertPath = strings.TrimSuffix(c.PublicKeyPath, ".pub") + "-cert.pub"
+		}
+		if c.CertPath == c.PublicKeyPath {
+			return multierror.Prefix(errors.New("'cert_path' must differ from 'public_key_path'"), fmt.Sprintf("ssh_host_cert.%s", c.PublicKeyPath))
+		}
+
+		if c.TTLRaw != nil {
+			var err error
+			if c.TTL, err = parseutil.ParseDurationSecond(c.TTLRaw); err != nil {
+				return multierror.Prefix(err, fmt.Sprintf("ssh_host_cert.%s", c.PublicKeyPath))
+			}
+			c.TTLRaw = nil
+		}
+
+		if c.CommandTimeoutRaw != nil {
+			var err error
+			if c.CommandTimeout, err = parseutil.ParseDurationSecond(c.CommandTimeoutRaw); err != nil {
+				return multierror.Prefix(err, fmt.Sprintf("ssh_host_cert.%s", c.PublicKeyPath))
+			}
+			c.CommandTimeoutRaw = nil
+		}
+
+		certs = append(certs, &c)
+	}
+
+	result.SSHHostCerts = certs
+	return nil
+}
@@ -37,6 +37,11 @@ func TestLoadConfigFile_AgentCache(t *testing.T) {
 		},
 		Cache: &Cache{
 			UseAutoAuthToken: true,
+			Persist: &Persist{
+				Path:      "/vault/agent-cache",
+				KeyFile:   "/vault/agent-cache.key",
+				ExitOnErr: true,
+			},
 		},
 		Listeners: []*Listener{
 			&Listener{
@@ -222,6 +227,13 @@ func TestLoadConfigFile_Bad_AgentCache_NoListeners(t *testing.T) {
 	}
 }
 
+func TestLoadConfigFile_Bad_AgentCache_PersistNoKeyFile(t *testing.T) {
+	_, err := LoadConfig("./test-fixtures/bad-config-cache-persist-no-key_file.hcl")
+	if err == nil {
+		t.Fatal("LoadConfig should return an error when cache.persist has no key_file")
+	}
+}
+
 func TestLoadConfigFile_Bad_AutoAuth_Wrapped_Multiple_Sinks(t *testing.T) {
 	_, err := LoadConfig("./test-fixtures/bad-config-auto_auth-wrapped-multiple-sinks")
 	if err == nil {
@@ -278,3 +290,121 @@ func TestLoadConfigFile_AgentCache_AutoAuth_NoSink(t *testing.T) {
 		t.Fatal(diff)
 	}
 }
+
+func TestLoadConfigFile_Template(t *testing.T) {
+	config, err := LoadConfig("./test-fixtures/config-template.hcl")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &Config{
+		AutoAuth: &AutoAuth{
+			Method: &Method{
+				Type:      "aws",
+				MountPath: "auth/aws",
+				Config: map[string]interface{}{
+					"role": "foobar",
+				},
+			},
+		},
+		Templates: []*Template{
+			&Template{
+				Source:         "/path/to/template.ctmpl",
+				Destination:    "/path/to/render.txt",
+				Command:        "systemctl reload app",
+				CommandTimeout: time.Minute,
+				Perms:          0600,
+			},
+			&Template{
+				Contents:          `{{ with secret "secret/foo" }}{{ .Data.password }}{{ end }}`,
+				Destination:       "/path/to/password.txt",
+				Perms:             0640,
+				LeftDelim:         "[[",
+				RightDelim:        "]]",
+				ErrorOnMissingKey: true,
+			},
+		},
+		PidFile: "./pidfile",
+	}
+
+	if diff := deep.Equal(config, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func TestLoadConfigFile_Bad_Template_NoAutoAuth(t *testing.T) {
+	_, err := LoadConfig("./test-fixtures/bad-config-template-no-auto_auth.hcl")
+	if err == nil {
+		t.Fatal("LoadConfig should return an error when template section present and no auto_auth present")
+	}
+}
+
+func TestLoadConfigFile_Bad_Template_SourceAndContents(t *testing.T) {
+	_, err := LoadConfig("./test-fixtures/bad-config-template-source-and-contents.hcl")
+	if err == nil {
+		t.Fatal("LoadConfig should return an error when both source and contents are set on a template")
+	}
+}
+
+func TestLoadConfigFile_Bad_Template_Perms(t *testing.T) {
+	_, err := LoadConfig("./test-fixtures/bad-config-template-perms.hcl")
+	if err == nil {
+		t.Fatal("LoadConfig should return an error when perms is not a valid file mode")
+	}
+}
+
+func TestLoadConfigFile_SSHHostCert(t *testing.T) {
+	config, err := LoadConfig("./test-fixtures/config-ssh-host-cert.hcl")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &Config{
+		AutoAuth: &AutoAuth{
+			Method: &Method{
+				Type:      "aws",
+				MountPath: "auth/aws",
+				Config: map[string]interface{}{
+					"role": "foobar",
+				},
+			},
+		},
+		SSHHostCerts: []*SSHHostCert{
+			&SSHHostCert{
+				MountPath:       "ssh-host-signer",
+				Role:            "hosts",
+				PublicKeyPath:   "/etc/ssh/ssh_host_rsa_key.pub",
+				CertPath:        "/etc/ssh/ssh_host_rsa_key-cert.pub",
+				ValidPrincipals: "host.example.com",
+				TTL:             720 * time.Hour,
+				Command:         "systemctl reload sshd",
+				CommandTimeout:  time.Minute,
+			},
+			&SSHHostCert{
+				MountPath:     "ssh",
+				Role:          "hosts",
+				PublicKeyPath: "/etc/ssh/ssh_host_ed25519_key.pub",
+				CertPath:      "/etc/ssh/certs/ssh_host_ed25519_key-cert.pub",
+			},
+		},
+		PidFile: "./pidfile",
+	}
+
+	if diff := deep.Equal(config, expected); diff != nil {
+		t.Fatal(diff)
+	}
+}
+
+func TestLoadConfigFile_Bad_SSHHostCert_NoAutoAuth(t *testing.T) {
+	_, err := LoadConfig("./test-fixtures/bad-config-ssh-host-cert-no-auto_auth.hcl")
+	if err == nil {
+		t.Fatal("LoadConfig should return an error when ssh_host_cert section present and no auto_auth present")
+	}
+}
+
+func TestLoadConfigFile_Bad_SSHHostCert_NoRole(t *testing.T) {
+	_, err := LoadConfig("./test-fixtures/bad-config-ssh-host-cert-no-role.hcl")
+	if err == nil {
+		t.Fatal("LoadConfig should return an error when an ssh_host_cert has no role")
+	}
+}
@@ -0,0 +1,6 @@
+pid_file = "./pidfile"
+
+ssh_host_cert {
+	role = "hosts"
+	public_key_path = "/etc/ssh/ssh_host_rsa_key.pub"
+}
@@ -0,0 +1,14 @@
+pid_file = "./pidfile"
+
+auto_auth {
+	method {
+		type = "aws"
+		config = {
+			role = "foobar"
+		}
+	}
+}
+
+ssh_host_cert {
+	public_key_path = "/etc/ssh/ssh_host_rsa_key.pub"
+}
@@ -0,0 +1,6 @@
+pid_file = "./pidfile"
+
+template {
+	source = "/path/to/template.ctmpl"
+	destination = "/path/to/render.txt"
+}
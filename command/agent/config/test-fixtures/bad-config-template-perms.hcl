@@ -0,0 +1,16 @@
+pid_file = "./pidfile"
+
+auto_auth {
+	method {
+		type = "aws"
+		config = {
+			role = "foobar"
+		}
+	}
+}
+
+template {
+	source = "/path/to/template.ctmpl"
+	destination = "/path/to/render.txt"
+	perms = "0999"
+}
@@ -21,6 +21,11 @@ auto_auth {
 
 cache {
 	use_auto_auth_token = true
+	persist {
+		path = "/vault/agent-cache"
+		key_file = "/vault/agent-cache.key"
+		exit_on_err = true
+	}
 }
 
 listener "unix" {
@@ -0,0 +1,26 @@
+pid_file = "./pidfile"
+
+auto_auth {
+	method {
+		type = "aws"
+		config = {
+			role = "foobar"
+		}
+	}
+}
+
+ssh_host_cert {
+	mount_path = "ssh-host-signer/"
+	role = "hosts"
+	public_key_path = "/etc/ssh/ssh_host_rsa_key.pub"
+	valid_principals = "host.example.com"
+	ttl = "720h"
+	command = "systemctl reload sshd"
+	command_timeout = "1m"
+}
+
+ssh_host_cert {
+	role = "hosts"
+	public_key_path = "/etc/ssh/ssh_host_ed25519_key.pub"
+	cert_path = "/etc/ssh/certs/ssh_host_ed25519_key-cert.pub"
+}
@@ -0,0 +1,27 @@
+pid_file = "./pidfile"
+
+auto_auth {
+	method {
+		type = "aws"
+		config = {
+			role = "foobar"
+		}
+	}
+}
+
+template {
+	source = "/path/to/template.ctmpl"
+	destination = "/path/to/render.txt"
+	perms = "0600"
+	command = "systemctl reload app"
+	command_timeout = "1m"
+}
+
+template {
+	contents = "{{ with secret \"secret/foo\" }}{{ .Data.password }}{{ end }}"
+	destination = "/path/to/password.txt"
+	perms = 0640
+	left_delimiter = "[["
+	right_delimiter = "]]"
+	error_on_missing_key = true
+}
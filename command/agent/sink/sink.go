@@ -133,6 +133,12 @@ func (ss *SinkServer) Run(ctx context.Context, incoming chan string, sinks []*Si
 					atomic.AddInt32(ss.remaining, 1)
 					sinkCh <- sinkToken{s, token}
 				}
+
+				// With no sinks configured, such as when only templates
+				// consume the token, there is nothing left to wait for.
+				if len(sinks) == 0 && ss.exitAfterAuth {
+					return
+				}
 			}
 
 		case st := <-sinkCh:
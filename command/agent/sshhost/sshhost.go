@@ -0,0 +1,321 @@
+// Package sshhost is responsible for keeping SSH host keys signed by the SSH
+// secrets engine with the agent's auto-auth token. Certificates are written
+// next to the host keys and signed again before they expire, and an optional
+// command, such as one reloading sshd, may be executed after each signing.
+package sshhost
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/config"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// DefaultCommandTimeout is how long a certificate's command may run
+	// before it is killed.
+	DefaultCommandTimeout = 30 * time.Second
+)
+
+// ServerConfig is the configuration for the SSH host certificate server
+type ServerConfig struct {
+	Logger        hclog.Logger
+	Client        *api.Client
+	Certs         []*config.SSHHostCert
+	ExitAfterAuth bool
+}
+
+// Server is responsible for signing host keys whenever a new token arrives
+// from the auth handler, and for signing them again before their
+// certificates expire.
+type Server struct {
+	DoneCh        chan struct{}
+	logger        hclog.Logger
+	client        *api.Client
+	random        *rand.Rand
+	exitAfterAuth bool
+	certs         []*config.SSHHostCert
+}
+
+// NewServer returns an SSH host certificate server.
+func NewServer(conf *ServerConfig) (*Server, error) {
+	if conf == nil {
+		return nil, errors.New("nil configuration provided")
+	}
+	if conf.Client == nil {
+		return nil, errors.New("nil client provided")
+	}
+	if conf.Logger == nil {
+		return nil, errors.New("nil logger provided")
+	}
+
+	return &Server{
+		DoneCh:        make(chan struct{}),
+		logger:        conf.Logger,
+		client:        conf.Client,
+		random:        rand.New(rand.NewSource(int64(time.Now().Nanosecond()))),
+		exitAfterAuth: conf.ExitAfterAuth,
+		certs:         conf.Certs,
+	}, nil
+}
+
+// Run executes the server's run loop, which waits for tokens from the auth
+// handler and signs every host key whose certificate is missing, was issued
+// for another key or is due for renewal. Host keys are signed again once two
+// thirds of the validity of their certificate have elapsed.
+func (ss *Server) Run(ctx context.Context, incoming chan string) {
+	if incoming == nil {
+		panic("incoming channel is nil")
+	}
+
+	ss.logger.Info("starting ssh host certificate server")
+	defer func() {
+		ss.logger.Info("ssh host certificate server stopped")
+		close(ss.DoneCh)
+	}()
+
+	var client *api.Client
+	var latestToken string
+	var nextCh <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case token, ok := <-incoming:
+			if !ok {
+				return
+			}
+			if token == "" || token == latestToken {
+				continue
+			}
+			latestToken = token
+
+			clone, err := ss.client.Clone()
+			if err != nil {
+				ss.logger.Error("error creating client for ssh host certificates", "error", err)
+				continue
+			}
+			clone.SetToken(token)
+			client = clone
+
+		case <-nextCh:
+		}
+
+		if client == nil {
+			continue
+		}
+
+		next, err := ss.signAll(ctx, client)
+		if err != nil {
+			backoff := 2*time.Second + time.Duration(ss.random.Int63()%int64(time.Second*2)-int64(time.Second))
+			ss.logger.Error("error signing ssh host keys, retrying", "error", err, "backoff", backoff.String())
+			nextCh = time.After(backoff)
+			continue
+		}
+
+		nextCh = nil
+		if !next.IsZero() {
+			ss.logger.Debug("scheduled ssh host key signing", "at", next.String())
+			nextCh = time.After(time.Until(next))
+		}
+
+		if ss.exitAfterAuth {
+			return
+		}
+	}
+}
+
+// signAll signs every host key that needs it, stopping at the first failure,
+// and returns when the next certificate is due for renewal. A zero time means
+// that no certificate expires.
+func (ss *Server) signAll(ctx context.Context, client *api.Client) (time.Time, error) {
+	var next time.Time
+	for _, hc := range ss.certs {
+		renewAt, err := ss.sign(ctx, client, hc)
+		if err != nil {
+			return time.Time{}, errwrap.Wrapf(fmt.Sprintf("error signing %q: {{err}}", hc.PublicKeyPath), err)
+		}
+		if !renewAt.IsZero() && (next.IsZero() || renewAt.Before(next)) {
+			next = renewAt
+		}
+	}
+	return next, nil
+}
+
+// sign has the host key signed and writes the certificate to its
+// destination, running the command if a new certificate was written. An
+// existing certificate for the current host key is kept until it is due for
+// renewal, so that restarting the agent does not sign the key again.
+func (ss *Server) sign(ctx context.Context, client *api.Client, hc *config.SSHHostCert) (time.Time, error) {
+	publicKeyBytes, err := ioutil.ReadFile(hc.PublicKeyPath)
+	if err != nil {
+		return time.Time{}, errwrap.Wrapf("error reading public key: {{err}}", err)
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(publicKeyBytes)
+	if err != nil {
+		return time.Time{}, errwrap.Wrapf("error parsing public key: {{err}}", err)
+	}
+
+	existing, err := readCertificate(hc.CertPath)
+	if err != nil {
+		ss.logger.Warn("ignoring unreadable ssh host certificate", "path", hc.CertPath, "error", err)
+	}
+	if existing != nil && existing.CertType == ssh.HostCert && bytes.Equal(existing.Key.Marshal(), publicKey.Marshal()) {
+		renewAt := renewalTime(existing)
+		if renewAt.IsZero() || time.Now().Before(renewAt) {
+			return renewAt, nil
+		}
+	}
+
+	data := map[string]interface{}{
+		"public_key": strings.TrimSpace(string(publicKeyBytes)),
+		"cert_type":  "host",
+	}
+	if hc.ValidPrincipals != "" {
+		data["valid_principals"] = hc.ValidPrincipals
+	}
+	if hc.TTL > 0 {
+		data["ttl"] = hc.TTL.String()
+	}
+
+	secret, err := client.Logical().Write(hc.MountPath+"/sign/"+hc.Role, data)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if secret == nil || secret.Data == nil {
+		return time.Time{}, errors.New("missing signed key")
+	}
+	signedKey, ok := secret.Data["signed_key"].(string)
+	if !ok || signedKey == "" {
+		return time.Time{}, errors.New("signed key is empty")
+	}
+
+	cert, err := parseCertificate([]byte(signedKey))
+	if err != nil {
+		return time.Time{}, errwrap.Wrapf("error parsing signed key: {{err}}", err)
+	}
+
+	if !strings.HasSuffix(signedKey, "\n") {
+		signedKey += "\n"
+	}
+	if err := writeAtomic(hc.CertPath, []byte(signedKey), 0644); err != nil {
+		return time.Time{}, err
+	}
+	ss.logger.Info("signed ssh host key", "public_key_path", hc.PublicKeyPath, "cert_path", hc.CertPath, "serial", cert.Serial)
+
+	if hc.Command != "" {
+		if err := ss.runCommand(ctx, hc); err != nil {
+			// A failing command does not cause the key to be signed again;
+			// the certificate on disk is already up to date.
+			ss.logger.Error("error running ssh host certificate command", "cert_path", hc.CertPath, "error", err)
+		}
+	}
+
+	return renewalTime(cert), nil
+}
+
+// readCertificate returns the certificate at path, or nil if there is none
+func readCertificate(path string) (*ssh.Certificate, error) {
+	certBytes, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	return parseCertificate(certBytes)
+}
+
+func parseCertificate(certBytes []byte) (*ssh.Certificate, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey(certBytes)
+	if err != nil {
+		return nil, err
+	}
+	cert, ok := key.(*ssh.Certificate)
+	if !ok {
+		return nil, errors.New("not an ssh certificate")
+	}
+	return cert, nil
+}
+
+// renewalTime returns when two thirds of the validity of the certificate
+// have elapsed, or a zero time if the certificate never expires
+func renewalTime(cert *ssh.Certificate) time.Time {
+	if cert.ValidBefore == ssh.CertTimeInfinity {
+		return time.Time{}
+	}
+	validAfter := time.Unix(int64(cert.ValidAfter), 0)
+	validBefore := time.Unix(int64(cert.ValidBefore), 0)
+	return validAfter.Add(validBefore.Sub(validAfter) * 2 / 3)
+}
+
+// runCommand executes the certificate's command through the system shell
+func (ss *Server) runCommand(ctx context.Context, hc *config.SSHHostCert) error {
+	timeout := hc.CommandTimeout
+	if timeout == 0 {
+		timeout = DefaultCommandTimeout
+	}
+	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(cmdCtx, "cmd", "/C", hc.Command)
+	} else {
+		cmd = exec.CommandContext(cmdCtx, "/bin/sh", "-c", hc.Command)
+	}
+
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		ss.logger.Debug("ssh host certificate command output", "cert_path", hc.CertPath, "output", string(out))
+	}
+	return err
+}
+
+// writeAtomic writes contents to a temporary file next to path and renames it
+// into place so that sshd never reads a partially written certificate.
+func writeAtomic(path string, contents []byte, perms os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errwrap.Wrapf("error creating certificate directory: {{err}}", err)
+	}
+
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return errwrap.Wrapf("error creating temporary file: {{err}}", err)
+	}
+	tmpPath := f.Name()
+
+	_, err = f.Write(contents)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, perms)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return errwrap.Wrapf("error writing certificate: {{err}}", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,259 @@
+package sshhost
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/config"
+	"github.com/hashicorp/vault/sdk/helper/logging"
+	"golang.org/x/crypto/ssh"
+)
+
+// testSigner mimics the sign endpoint of the SSH secrets engine
+type testSigner struct {
+	sync.Mutex
+	signer   ssh.Signer
+	requests []map[string]interface{}
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSigner{signer: signer}
+}
+
+func (ts *testSigner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/ssh/sign/hosts" || r.Header.Get("X-Vault-Token") != "token" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	var data map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ts.Lock()
+	ts.requests = append(ts.requests, data)
+	ts.Unlock()
+
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(data["public_key"].(string)))
+	if err != nil || data["cert_type"] != "host" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ttl, err := time.ParseDuration(data["ttl"].(string))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	cert := &ssh.Certificate{
+		Key:             publicKey,
+		Serial:          uint64(len(ts.requests)),
+		CertType:        ssh.HostCert,
+		ValidPrincipals: strings.Split(data["valid_principals"].(string), ","),
+		ValidAfter:      uint64(now.Unix()),
+		ValidBefore:     uint64(now.Add(ttl).Unix()),
+	}
+	if err := cert.SignCert(rand.Reader, ts.signer); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data": map[string]interface{}{
+			"signed_key": strings.TrimSpace(string(ssh.MarshalAuthorizedKey(cert))),
+		},
+	})
+}
+
+func (ts *testSigner) requestCount() int {
+	ts.Lock()
+	defer ts.Unlock()
+	return len(ts.requests)
+}
+
+func testServer(t *testing.T, signer *testSigner, certs []*config.SSHHostCert, exitAfterAuth bool) (*Server, func()) {
+	t.Helper()
+
+	httpServer := httptest.NewServer(signer)
+
+	clientConfig := api.DefaultConfig()
+	clientConfig.Address = httpServer.URL
+	client, err := api.NewClient(clientConfig)
+	if err != nil {
+		httpServer.Close()
+		t.Fatal(err)
+	}
+
+	ss, err := NewServer(&ServerConfig{
+		Logger:        logging.NewVaultLogger(hclog.Trace),
+		Client:        client,
+		Certs:         certs,
+		ExitAfterAuth: exitAfterAuth,
+	})
+	if err != nil {
+		httpServer.Close()
+		t.Fatal(err)
+	}
+	return ss, httpServer.Close
+}
+
+func writeHostKey(t *testing.T, path string) ssh.PublicKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, ssh.MarshalAuthorizedKey(publicKey), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return publicKey
+}
+
+func TestServer_Sign(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent-sshhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	publicKeyPath := filepath.Join(dir, "ssh_host_ecdsa_key.pub")
+	publicKey := writeHostKey(t, publicKeyPath)
+
+	hc := &config.SSHHostCert{
+		MountPath:       "ssh",
+		Role:            "hosts",
+		PublicKeyPath:   publicKeyPath,
+		CertPath:        filepath.Join(dir, "ssh_host_ecdsa_key-cert.pub"),
+		ValidPrincipals: "host.example.com",
+		TTL:             time.Hour,
+		Command:         "touch " + filepath.Join(dir, "command-ran"),
+	}
+
+	run := func(signer *testSigner) {
+		ss, closer := testServer(t, signer, []*config.SSHHostCert{hc}, true)
+		defer closer()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		incoming := make(chan string, 1)
+		incoming <- "token"
+		go ss.Run(ctx, incoming)
+
+		select {
+		case <-ss.DoneCh:
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for host keys to be signed")
+		}
+	}
+
+	signer := newTestSigner(t)
+	run(signer)
+	if signer.requestCount() != 1 {
+		t.Fatalf("expected 1 signing request, got %d", signer.requestCount())
+	}
+	if principals := signer.requests[0]["valid_principals"]; principals != "host.example.com" {
+		t.Fatalf("bad valid_principals: %v", principals)
+	}
+
+	cert, err := readCertificate(hc.CertPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert == nil || cert.CertType != ssh.HostCert || string(cert.Key.Marshal()) != string(publicKey.Marshal()) {
+		t.Fatalf("bad certificate: %#v", cert)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "command-ran")); err != nil {
+		t.Fatalf("expected command to have run: %v", err)
+	}
+
+	// A valid certificate for the current host key is kept
+	run(signer)
+	if signer.requestCount() != 1 {
+		t.Fatalf("expected the existing certificate to be kept, got %d signing requests", signer.requestCount())
+	}
+
+	// A new host key is signed again
+	writeHostKey(t, publicKeyPath)
+	run(signer)
+	if signer.requestCount() != 2 {
+		t.Fatalf("expected the new host key to be signed, got %d signing requests", signer.requestCount())
+	}
+}
+
+func TestServer_Renew(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent-sshhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	publicKeyPath := filepath.Join(dir, "ssh_host_ecdsa_key.pub")
+	writeHostKey(t, publicKeyPath)
+
+	signer := newTestSigner(t)
+	ss, closer := testServer(t, signer, []*config.SSHHostCert{
+		&config.SSHHostCert{
+			MountPath:       "ssh",
+			Role:            "hosts",
+			PublicKeyPath:   publicKeyPath,
+			CertPath:        filepath.Join(dir, "ssh_host_ecdsa_key-cert.pub"),
+			ValidPrincipals: "host.example.com",
+			TTL:             3 * time.Second,
+		},
+	}, false)
+	defer closer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	incoming := make(chan string, 1)
+	incoming <- "token"
+	go ss.Run(ctx, incoming)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for signer.requestCount() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the host key to be signed again before expiry, got %d signing requests", signer.requestCount())
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-ss.DoneCh:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the server to stop")
+	}
+}
@@ -0,0 +1,95 @@
+package template
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// funcMap returns the functions available to templates in addition to the
+// text/template builtins.
+func (ts *Server) funcMap() template.FuncMap {
+	return template.FuncMap{
+		"secret": ts.secretFunc,
+
+		"env":          os.Getenv,
+		"base64Encode": base64Encode,
+		"base64Decode": base64Decode,
+		"toJSON":       toJSON,
+		"toJSONPretty": toJSONPretty,
+		"join":         join,
+		"split":        split,
+		"trimSpace":    strings.TrimSpace,
+		"toLower":      strings.ToLower,
+		"toUpper":      strings.ToUpper,
+	}
+}
+
+// secretFunc reads the secret at path, or writes to it when key=value
+// arguments are given. Results are cached until the secret is rotated.
+func (ts *Server) secretFunc(path string, args ...string) (*api.Secret, error) {
+	if ts.cache == nil {
+		return nil, errors.New("no token available to fetch secrets")
+	}
+	return ts.cache.get(path, args)
+}
+
+func base64Encode(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+func base64Decode(s string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func toJSONPretty(v interface{}) (string, error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// join is strings.Join with the arguments reversed so that it can be used in
+// pipelines, e.g. {{ .Data.list | join "," }}. Lists decoded from JSON are
+// []interface{}, so both forms are accepted.
+func join(sep string, v interface{}) (string, error) {
+	switch list := v.(type) {
+	case []string:
+		return strings.Join(list, sep), nil
+	case []interface{}:
+		strs := make([]string, 0, len(list))
+		for _, item := range list {
+			s, ok := item.(string)
+			if !ok {
+				return "", errors.New("join requires a list of strings")
+			}
+			strs = append(strs, s)
+		}
+		return strings.Join(strs, sep), nil
+	default:
+		return "", errors.New("join requires a list of strings")
+	}
+}
+
+// split is strings.Split with the arguments reversed for use in pipelines
+func split(sep, s string) []string {
+	return strings.Split(s, sep)
+}
@@ -0,0 +1,202 @@
+package template
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+)
+
+type secretCacheConfig struct {
+	Logger                     hclog.Logger
+	Client                     *api.Client
+	TriggerCh                  chan struct{}
+	StaticSecretRenderInterval time.Duration
+}
+
+// secretCache holds the secrets fetched while rendering templates so that
+// re-rendering one template does not re-issue dynamic credentials used by the
+// others. Each entry is watched in the background: leased secrets are renewed
+// until they can no longer be, other secrets are refreshed on an interval.
+// Once a secret needs to be fetched again its entry is marked stale and a
+// re-render is triggered.
+type secretCache struct {
+	l sync.Mutex
+
+	ctx                        context.Context
+	cancel                     context.CancelFunc
+	logger                     hclog.Logger
+	client                     *api.Client
+	triggerCh                  chan struct{}
+	staticSecretRenderInterval time.Duration
+	entries                    map[string]*secretEntry
+}
+
+type secretEntry struct {
+	secret *api.Secret
+	stale  bool
+}
+
+func newSecretCache(ctx context.Context, conf *secretCacheConfig) *secretCache {
+	ctx, cancel := context.WithCancel(ctx)
+	return &secretCache{
+		ctx:                        ctx,
+		cancel:                     cancel,
+		logger:                     conf.Logger,
+		client:                     conf.Client,
+		triggerCh:                  conf.TriggerCh,
+		staticSecretRenderInterval: conf.StaticSecretRenderInterval,
+		entries:                    make(map[string]*secretEntry),
+	}
+}
+
+// stop halts all background renewals and refreshes
+func (c *secretCache) stop() {
+	c.cancel()
+}
+
+// get returns the secret at path. If args are given they are treated as
+// key=value pairs and the secret is written rather than read, which is how
+// dynamic secrets such as PKI certificates are requested.
+func (c *secretCache) get(path string, args []string) (*api.Secret, error) {
+	key := strings.Join(append([]string{path}, args...), "\x00")
+
+	c.l.Lock()
+	entry, ok := c.entries[key]
+	fresh := ok && !entry.stale
+	c.l.Unlock()
+	if fresh {
+		return entry.secret, nil
+	}
+
+	var secret *api.Secret
+	var err error
+	if len(args) == 0 {
+		secret, err = c.client.Logical().Read(path)
+	} else {
+		data := make(map[string]interface{}, len(args))
+		for _, arg := range args {
+			parts := strings.SplitN(arg, "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid argument %q for %q, expected key=value", arg, path)
+			}
+			data[parts[0]] = parts[1]
+		}
+		secret, err = c.client.Logical().Write(path, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("no secret exists at %q", path)
+	}
+
+	entry = &secretEntry{
+		secret: secret,
+	}
+	c.l.Lock()
+	c.entries[key] = entry
+	c.l.Unlock()
+
+	go c.watch(path, entry)
+
+	return secret, nil
+}
+
+// watch waits until the entry's secret must be fetched again, marks it stale
+// and triggers a re-render.
+func (c *secretCache) watch(path string, entry *secretEntry) {
+	secret := entry.secret
+
+	if secret.Renewable && secret.LeaseID != "" {
+		c.renew(path, secret)
+	} else {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(c.refreshInterval(secret)):
+		}
+	}
+
+	select {
+	case <-c.ctx.Done():
+		return
+	default:
+	}
+
+	c.l.Lock()
+	entry.stale = true
+	c.l.Unlock()
+
+	select {
+	case c.triggerCh <- struct{}{}:
+	default:
+	}
+}
+
+// renew keeps a leased secret alive until renewal stops, either because the
+// lease reached its max TTL or renewal failed.
+func (c *secretCache) renew(path string, secret *api.Secret) {
+	renewer, err := c.client.NewRenewer(&api.RenewerInput{
+		Secret: secret,
+	})
+	if err != nil {
+		c.logger.Error("error creating renewer, falling back to re-reading on lease expiry", "path", path, "error", err)
+		select {
+		case <-c.ctx.Done():
+		case <-time.After(c.refreshInterval(secret)):
+		}
+		return
+	}
+	go renewer.Renew()
+	defer renewer.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case err := <-renewer.DoneCh():
+			if err != nil {
+				c.logger.Error("error renewing secret", "path", path, "error", err)
+			}
+			c.logger.Debug("secret can no longer be renewed, fetching a new one", "path", path)
+			return
+		case <-renewer.RenewCh():
+			c.logger.Debug("renewed secret", "path", path)
+		}
+	}
+}
+
+// refreshInterval returns how long a secret that is not being renewed may be
+// used before it is fetched again.
+func (c *secretCache) refreshInterval(secret *api.Secret) time.Duration {
+	// Secrets without a lease ID, such as KV entries, report a lease duration
+	// that is only a hint and is far too long to wait on for changes.
+	if secret.LeaseID != "" && secret.LeaseDuration > 0 {
+		return time.Duration(secret.LeaseDuration) * time.Second * 2 / 3
+	}
+
+	// Certificates issued by the PKI backend carry no lease by default but
+	// report their expiration, so rotate them before they expire.
+	if secret.Data != nil {
+		var expiration int64
+		switch exp := secret.Data["expiration"].(type) {
+		case json.Number:
+			expiration, _ = exp.Int64()
+		case float64:
+			expiration = int64(exp)
+		case int64:
+			expiration = exp
+		}
+		if remaining := time.Until(time.Unix(expiration, 0)) * 2 / 3; expiration > 0 && remaining > 0 {
+			return remaining
+		}
+	}
+
+	return c.staticSecretRenderInterval
+}
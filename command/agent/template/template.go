@@ -0,0 +1,299 @@
+// Package template is responsible for rendering user supplied templates to
+// disk using secrets read from Vault with the agent's auto-auth token.
+// Templates are re-rendered whenever a secret they reference is rotated, and
+// an optional command may be executed after each render.
+package template
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"text/template"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/config"
+)
+
+const (
+	// DefaultStaticSecretRenderInterval is how often secrets that carry no
+	// lease, such as KV entries, are re-read to detect changes.
+	DefaultStaticSecretRenderInterval = 5 * time.Minute
+
+	// DefaultCommandTimeout is how long a template's command may run before
+	// it is killed.
+	DefaultCommandTimeout = 30 * time.Second
+)
+
+// ServerConfig is the configuration for the template server
+type ServerConfig struct {
+	Logger        hclog.Logger
+	Client        *api.Client
+	Templates     []*config.Template
+	ExitAfterAuth bool
+
+	// StaticSecretRenderInterval overrides DefaultStaticSecretRenderInterval
+	// when non-zero.
+	StaticSecretRenderInterval time.Duration
+}
+
+// Server is responsible for rendering templates whenever a new token arrives
+// from the auth handler or a secret referenced by a template changes.
+type Server struct {
+	DoneCh                     chan struct{}
+	logger                     hclog.Logger
+	client                     *api.Client
+	random                     *rand.Rand
+	exitAfterAuth              bool
+	staticSecretRenderInterval time.Duration
+	templates                  []*renderTemplate
+
+	// cache holds the secrets fetched with the current token. It is only
+	// accessed from the Run goroutine.
+	cache *secretCache
+}
+
+// renderTemplate is a parsed template along with its configuration
+type renderTemplate struct {
+	config *config.Template
+	tmpl   *template.Template
+}
+
+// NewServer returns a template server with all of its templates parsed.
+func NewServer(conf *ServerConfig) (*Server, error) {
+	if conf == nil {
+		return nil, errors.New("nil configuration provided")
+	}
+	if conf.Client == nil {
+		return nil, errors.New("nil client provided")
+	}
+	if conf.Logger == nil {
+		return nil, errors.New("nil logger provided")
+	}
+
+	ts := &Server{
+		DoneCh:                     make(chan struct{}),
+		logger:                     conf.Logger,
+		client:                     conf.Client,
+		random:                     rand.New(rand.NewSource(int64(time.Now().Nanosecond()))),
+		exitAfterAuth:              conf.ExitAfterAuth,
+		staticSecretRenderInterval: conf.StaticSecretRenderInterval,
+	}
+	if ts.staticSecretRenderInterval == 0 {
+		ts.staticSecretRenderInterval = DefaultStaticSecretRenderInterval
+	}
+
+	for _, tc := range conf.Templates {
+		contents := tc.Contents
+		if tc.Source != "" {
+			b, err := ioutil.ReadFile(tc.Source)
+			if err != nil {
+				return nil, errwrap.Wrapf(fmt.Sprintf("error reading template source %q: {{err}}", tc.Source), err)
+			}
+			contents = string(b)
+		}
+
+		tmpl := template.New(tc.Destination).Delims(tc.LeftDelim, tc.RightDelim).Funcs(ts.funcMap())
+		if tc.ErrorOnMissingKey {
+			tmpl = tmpl.Option("missingkey=error")
+		}
+		tmpl, err := tmpl.Parse(contents)
+		if err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("error parsing template for %q: {{err}}", tc.Destination), err)
+		}
+
+		ts.templates = append(ts.templates, &renderTemplate{
+			config: tc,
+			tmpl:   tmpl,
+		})
+	}
+
+	return ts, nil
+}
+
+// Run executes the server's run loop, which waits for tokens from the auth
+// handler and renders every template with the latest one. Templates are
+// rendered again whenever a secret they reference is rotated.
+func (ts *Server) Run(ctx context.Context, incoming chan string) {
+	if incoming == nil {
+		panic("incoming channel is nil")
+	}
+
+	ts.logger.Info("starting template server")
+	defer func() {
+		if ts.cache != nil {
+			ts.cache.stop()
+		}
+		ts.logger.Info("template server stopped")
+		close(ts.DoneCh)
+	}()
+
+	triggerCh := make(chan struct{}, 1)
+	var latestToken string
+	var retryCh <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case token, ok := <-incoming:
+			if !ok {
+				return
+			}
+			if token == "" || token == latestToken {
+				continue
+			}
+			latestToken = token
+
+			client, err := ts.client.Clone()
+			if err != nil {
+				ts.logger.Error("error creating client for template rendering", "error", err)
+				continue
+			}
+			client.SetToken(token)
+
+			if ts.cache != nil {
+				ts.cache.stop()
+			}
+			ts.cache = newSecretCache(ctx, &secretCacheConfig{
+				Logger:                     ts.logger.Named("secrets"),
+				Client:                     client,
+				TriggerCh:                  triggerCh,
+				StaticSecretRenderInterval: ts.staticSecretRenderInterval,
+			})
+
+		case <-triggerCh:
+			ts.logger.Debug("secret changed, re-rendering templates")
+
+		case <-retryCh:
+		}
+
+		if ts.cache == nil {
+			continue
+		}
+
+		if err := ts.renderAll(ctx); err != nil {
+			backoff := 2*time.Second + time.Duration(ts.random.Int63()%int64(time.Second*2)-int64(time.Second))
+			ts.logger.Error("error rendering templates, retrying", "error", err, "backoff", backoff.String())
+			retryCh = time.After(backoff)
+			continue
+		}
+		retryCh = nil
+
+		if ts.exitAfterAuth {
+			return
+		}
+	}
+}
+
+// renderAll renders every template, stopping at the first failure so that
+// partially fetched secrets are retried as a whole.
+func (ts *Server) renderAll(ctx context.Context) error {
+	for _, rt := range ts.templates {
+		if err := ts.render(ctx, rt); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("error rendering %q: {{err}}", rt.config.Destination), err)
+		}
+	}
+	return nil
+}
+
+// render executes a single template and writes the result to its
+// destination, running the template's command if the contents changed.
+func (ts *Server) render(ctx context.Context, rt *renderTemplate) error {
+	var buf bytes.Buffer
+	if err := rt.tmpl.Execute(&buf, nil); err != nil {
+		return err
+	}
+
+	existing, err := ioutil.ReadFile(rt.config.Destination)
+	switch {
+	case err == nil && bytes.Equal(existing, buf.Bytes()):
+		return nil
+	case err != nil && !os.IsNotExist(err):
+		return errwrap.Wrapf("error reading existing destination: {{err}}", err)
+	}
+
+	if err := writeAtomic(rt.config.Destination, buf.Bytes(), rt.config.Perms); err != nil {
+		return err
+	}
+	ts.logger.Info("rendered template", "destination", rt.config.Destination)
+
+	if rt.config.Command != "" {
+		if err := ts.runCommand(ctx, rt.config); err != nil {
+			// A failing command does not cause a re-render; the contents on
+			// disk are already up to date.
+			ts.logger.Error("error running template command", "destination", rt.config.Destination, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// runCommand executes the template's command through the system shell
+func (ts *Server) runCommand(ctx context.Context, tc *config.Template) error {
+	timeout := tc.CommandTimeout
+	if timeout == 0 {
+		timeout = DefaultCommandTimeout
+	}
+	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(cmdCtx, "cmd", "/C", tc.Command)
+	} else {
+		cmd = exec.CommandContext(cmdCtx, "/bin/sh", "-c", tc.Command)
+	}
+
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		ts.logger.Debug("template command output", "destination", tc.Destination, "output", string(out))
+	}
+	return err
+}
+
+// writeAtomic writes contents to a temporary file next to path and renames it
+// into place so readers never see a partially written file.
+func writeAtomic(path string, contents []byte, perms os.FileMode) error {
+	if perms == 0 {
+		perms = 0644
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errwrap.Wrapf("error creating destination directory: {{err}}", err)
+	}
+
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return errwrap.Wrapf("error creating temporary file: {{err}}", err)
+	}
+	tmpPath := f.Name()
+
+	_, err = f.Write(contents)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, perms)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return errwrap.Wrapf("error writing destination: {{err}}", err)
+	}
+
+	return nil
+}
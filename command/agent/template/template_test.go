@@ -0,0 +1,242 @@
+package template
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/command/agent/config"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/sdk/helper/logging"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault"
+)
+
+func testClusterWithKV(t *testing.T) (*vault.TestCluster, *api.Client) {
+	t.Helper()
+
+	coreConfig := &vault.CoreConfig{
+		DisableMlock: true,
+		DisableCache: true,
+		Logger:       hclog.NewNullLogger(),
+		LogicalBackends: map[string]logical.Factory{
+			"kv":        vault.PassthroughBackendFactory,
+			"leased-kv": vault.LeasedPassthroughBackendFactory,
+		},
+	}
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	vault.TestWaitActive(t, cluster.Cores[0].Core)
+
+	client := cluster.Cores[0].Client
+	if err := client.Sys().Mount("kv", &api.MountInput{
+		Type: "kv",
+	}); err != nil {
+		cluster.Cleanup()
+		t.Fatal(err)
+	}
+	// Cap leases so that renewal stops quickly and a new secret is fetched
+	if err := client.Sys().Mount("leased", &api.MountInput{
+		Type: "leased-kv",
+		Config: api.MountConfigInput{
+			MaxLeaseTTL: "4s",
+		},
+	}); err != nil {
+		cluster.Cleanup()
+		t.Fatal(err)
+	}
+
+	return cluster, client
+}
+
+func waitForContents(t *testing.T, path, expected string) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	var actual []byte
+	for time.Now().Before(deadline) {
+		actual, _ = ioutil.ReadFile(path)
+		if string(actual) == expected {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("bad contents for %q: expected %q, got %q", path, expected, string(actual))
+}
+
+func TestServer_NewServer_BadTemplate(t *testing.T) {
+	client, err := api.NewClient(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewServer(&ServerConfig{
+		Logger: logging.NewVaultLogger(hclog.Trace),
+		Client: client,
+		Templates: []*config.Template{
+			&config.Template{
+				Contents:    `{{ with secret "kv/foo" }}`,
+				Destination: "/tmp/does-not-matter",
+			},
+		},
+	})
+	if err == nil {
+		t.Fatal("expected error parsing an unterminated template")
+	}
+}
+
+func TestServer_Render(t *testing.T) {
+	cluster, client := testClusterWithKV(t)
+	defer cluster.Cleanup()
+
+	if _, err := client.Logical().Write("kv/foo", map[string]interface{}{
+		"password": "bar",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "agent-template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source.tmpl")
+	if err := ioutil.WriteFile(source, []byte(`[[ with secret "kv/foo" ]][[ .Data.password | toUpper ]][[ end ]]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	templates := []*config.Template{
+		&config.Template{
+			Contents:    `password={{ with secret "kv/foo" }}{{ .Data.password }}{{ end }}`,
+			Destination: filepath.Join(dir, "contents.txt"),
+			Command:     "touch " + filepath.Join(dir, "command-ran"),
+			Perms:       0600,
+		},
+		&config.Template{
+			Source:      source,
+			Destination: filepath.Join(dir, "nested", "source.txt"),
+			LeftDelim:   "[[",
+			RightDelim:  "]]",
+			Perms:       0644,
+		},
+	}
+
+	ts, err := NewServer(&ServerConfig{
+		Logger:        logging.NewVaultLogger(hclog.Trace),
+		Client:        client,
+		Templates:     templates,
+		ExitAfterAuth: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	incoming := make(chan string, 1)
+	incoming <- client.Token()
+	go ts.Run(ctx, incoming)
+
+	select {
+	case <-ts.DoneCh:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for templates to render")
+	}
+
+	waitForContents(t, filepath.Join(dir, "contents.txt"), "password=bar")
+	waitForContents(t, filepath.Join(dir, "nested", "source.txt"), "BAR")
+
+	fi, err := os.Stat(filepath.Join(dir, "contents.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("bad perms: %v", fi.Mode().Perm())
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "command-ran")); err != nil {
+		t.Fatalf("expected command to have run: %v", err)
+	}
+}
+
+func TestServer_Rerender(t *testing.T) {
+	cluster, client := testClusterWithKV(t)
+	defer cluster.Cleanup()
+
+	if _, err := client.Logical().Write("kv/static", map[string]interface{}{
+		"value": "one",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Logical().Write("leased/foo", map[string]interface{}{
+		"value": "one",
+		"ttl":   "2s",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "agent-template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	staticDest := filepath.Join(dir, "static.txt")
+	leasedDest := filepath.Join(dir, "leased.txt")
+
+	ts, err := NewServer(&ServerConfig{
+		Logger: logging.NewVaultLogger(hclog.Trace),
+		Client: client,
+		Templates: []*config.Template{
+			&config.Template{
+				Contents:    `{{ with secret "kv/static" }}{{ .Data.value }}{{ end }}`,
+				Destination: staticDest,
+			},
+			&config.Template{
+				Contents:    `{{ with secret "leased/foo" }}{{ .Data.value }}{{ end }}`,
+				Destination: leasedDest,
+			},
+		},
+		StaticSecretRenderInterval: time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		<-ts.DoneCh
+	}()
+
+	incoming := make(chan string, 1)
+	incoming <- client.Token()
+	go ts.Run(ctx, incoming)
+
+	waitForContents(t, staticDest, "one")
+	waitForContents(t, leasedDest, "one")
+
+	if _, err := client.Logical().Write("kv/static", map[string]interface{}{
+		"value": "two",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Logical().Write("leased/foo", map[string]interface{}{
+		"value": "two",
+		"ttl":   "2s",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForContents(t, staticDest, "two")
+	waitForContents(t, leasedDest, "two")
+}
@@ -1,15 +1,21 @@
 package command
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	hclog "github.com/hashicorp/go-hclog"
 	vaultjwt "github.com/hashicorp/vault-plugin-auth-jwt"
 	"github.com/hashicorp/vault/api"
 	"github.com/hashicorp/vault/command/agent"
+	"github.com/hashicorp/vault/command/agent/cache"
+	"github.com/hashicorp/vault/command/agent/cache/cacheboltdb"
 	vaulthttp "github.com/hashicorp/vault/http"
 	"github.com/hashicorp/vault/sdk/helper/logging"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -370,3 +376,184 @@ auto_auth {
 		t.Fatal("sink 1/2 values don't match")
 	}
 }
+
+func TestExitAfterAuth_PersistentCache(t *testing.T) {
+	logger := logging.NewVaultLogger(hclog.Trace)
+	coreConfig := &vault.CoreConfig{
+		Logger: logger,
+		CredentialBackends: map[string]logical.Factory{
+			"jwt": vaultjwt.Factory,
+		},
+	}
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	vault.TestWaitActive(t, cluster.Cores[0].Core)
+	client := cluster.Cores[0].Client
+
+	// Setup Vault
+	err := client.Sys().EnableAuthWithOptions("jwt", &api.EnableAuthOptions{
+		Type: "jwt",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Logical().Write("auth/jwt/config", map[string]interface{}{
+		"bound_issuer":           "https://team-vault.auth0.com/",
+		"jwt_validation_pubkeys": agent.TestECDSAPubKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Logical().Write("auth/jwt/role/test", map[string]interface{}{
+		"role_type":       "jwt",
+		"bound_subject":   "r3qXcK2bix9eFECzsU3Sbmh0K16fatW6@clients",
+		"bound_audiences": "https://vault.plugin.auth.jwt.test",
+		"user_claim":      "https://vault/user",
+		"groups_claim":    "https://vault/groups",
+		"policies":        "test",
+		"period":          "3s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "agent-exit-after-auth-persist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "auth.jwt")
+	sink := filepath.Join(dir, "sink")
+	socket := filepath.Join(dir, "agent.socket")
+	cacheDir := filepath.Join(dir, "cache")
+	keyFile := filepath.Join(dir, "cache.key")
+	conf := filepath.Join(dir, "agent.hcl")
+
+	jwtToken, _ := agent.GetTestJWT(t)
+	if err := ioutil.WriteFile(in, []byte(jwtToken), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(cacheDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	keyMaterial := []byte("key material")
+	if err := ioutil.WriteFile(keyFile, keyMaterial, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cache a token in the persistent cache, as a previous run of the agent
+	// would have
+	ps, err := cacheboltdb.NewBoltStorage(&cacheboltdb.BoltStorageConfig{
+		Path:        cacheDir,
+		KeyMaterial: keyMaterial,
+		Logger:      logger.Named("cacheboltdb"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiProxy, err := cache.NewAPIProxy(&cache.APIProxyConfig{
+		Client: client,
+		Logger: logger.Named("apiproxy"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	leaseCache, err := cache.NewLeaseCache(&cache.LeaseCacheConfig{
+		Client:      client,
+		BaseContext: ctx,
+		Proxier:     apiProxy,
+		Logger:      logger.Named("leasecache"),
+		Storage:     ps,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqBody := `{"policies": ["default"], "ttl": "1h"}`
+	_, err = leaseCache.Send(ctx, &cache.SendRequest{
+		Token:       client.Token(),
+		Request:     httptest.NewRequest("POST", "/v1/auth/token/create-orphan", strings.NewReader(reqBody)),
+		RequestBody: []byte(reqBody),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaseCache.SetShuttingDown(true)
+	cancel()
+	ps.Close()
+
+	config := `
+exit_after_auth = true
+
+auto_auth {
+        method {
+                type = "jwt"
+                config = {
+                        role = "test"
+                        path = "%s"
+                }
+        }
+
+        sink {
+                type = "file"
+                config = {
+                        path = "%s"
+                }
+        }
+}
+
+cache {
+	persist {
+		path = "%s"
+		key_file = "%s"
+		exit_on_err = true
+	}
+}
+
+listener "unix" {
+	address = "%s"
+	tls_disable = true
+}
+`
+
+	config = fmt.Sprintf(config, in, sink, cacheDir, keyFile, socket)
+	if err := ioutil.WriteFile(conf, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ui, cmd := testAgentCommand(t, logger)
+	cmd.client = client
+
+	code := cmd.Run([]string{"-config", conf})
+	if code != 0 {
+		t.Errorf("expected %d to be %d", code, 0)
+		t.Logf("output from agent:\n%s", ui.OutputWriter.String())
+		t.Logf("error from agent:\n%s", ui.ErrorWriter.String())
+	}
+
+	// The restored token must still be persisted after exiting
+	ps, err = cacheboltdb.NewBoltStorage(&cacheboltdb.BoltStorageConfig{
+		Path:        cacheDir,
+		KeyMaterial: keyMaterial,
+		Logger:      logger.Named("cacheboltdb"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.Close()
+
+	tokens, err := ps.GetByType(cacheboltdb.TokenType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 {
+		t.Fatalf("expected the cached token to be kept, got %d tokens", len(tokens))
+	}
+}
@@ -0,0 +1,193 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/vault/audit"
+	"github.com/mitchellh/cli"
+	"github.com/posener/complete"
+)
+
+var _ cli.Command = (*AuditVerifyCommand)(nil)
+var _ cli.CommandAutocomplete = (*AuditVerifyCommand)(nil)
+
+type AuditVerifyCommand struct {
+	*BaseCommand
+
+	flagAllowRestart bool
+}
+
+func (c *AuditVerifyCommand) Synopsis() string {
+	return "Verifies the hash chain of an audit log"
+}
+
+func (c *AuditVerifyCommand) Help() string {
+	helpText := `
+Usage: vault audit verify [options] PATH FILE...
+
+  Verifies the integrity of a log written by an audit device with hash
+  chaining enabled. Each entry of the log is checked against the entry before
+  it, and missing, reordered or altered entries are reported.
+
+  The first argument is the PATH of the audit device that wrote the log, whose
+  salt is used to verify entries. The remaining arguments are log files, which
+  may be compressed with gzip, given from oldest to newest.
+
+  Verify the log written by the audit device enabled at "file/":
+
+      $ vault audit verify file/ /var/log/vault_audit.log
+
+  Verify a log across rotated files:
+
+      $ vault audit verify file/ /var/log/vault_audit-*.log.gz /var/log/vault_audit.log
+
+  Verify only the current file of a rotated log, whose first entry continues
+  a chain that can not be checked:
+
+      $ vault audit verify -allow-restart file/ /var/log/vault_audit.log
+
+  Each entry is verified using the "sys/audit-hash" endpoint.
+
+` + c.Flags().Help()
+
+	return strings.TrimSpace(helpText)
+}
+
+func (c *AuditVerifyCommand) Flags() *FlagSets {
+	set := c.flagSet(FlagSetHTTP)
+
+	f := set.NewFlagSet("Command Options")
+
+	f.BoolVar(&BoolVar{
+		Name:    "allow-restart",
+		Target:  &c.flagAllowRestart,
+		Default: false,
+		EnvVar:  "",
+		Usage: "Allow the chain to restart at sequence 1, as it does when the " +
+			"audit device is re-enabled, and the log to start after the first " +
+			"entry, as it does when only part of a rotated log is verified. " +
+			"These are reported as warnings instead of problems, since they " +
+			"are also what removing entries from the head of the log looks like.",
+	})
+
+	return set
+}
+
+func (c *AuditVerifyCommand) AutocompleteArgs() complete.Predictor {
+	return c.PredictVaultAudits()
+}
+
+func (c *AuditVerifyCommand) AutocompleteFlags() complete.Flags {
+	return c.Flags().Completions()
+}
+
+func (c *AuditVerifyCommand) Run(args []string) int {
+	f := c.Flags()
+
+	if err := f.Parse(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	args = f.Args()
+	if len(args) < 2 {
+		c.UI.Error(fmt.Sprintf("Not enough arguments (expected at least 2, got %d)", len(args)))
+		return 1
+	}
+
+	path := ensureTrailingSlash(sanitizePath(args[0]))
+
+	client, err := c.Client()
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 2
+	}
+
+	verifier := audit.NewChainVerifier(func(data string) (string, error) {
+		return client.Sys().AuditHash(path, data)
+	})
+
+	var entries, problems int
+	for _, file := range args[1:] {
+		n, p, err := c.verifyFile(verifier, file)
+		entries += n
+		problems += p
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error verifying %s: %s", file, err))
+			return 2
+		}
+	}
+
+	if problems > 0 {
+		c.UI.Error(fmt.Sprintf("Found %d problem(s) in %d entries", problems, entries))
+		return 2
+	}
+
+	c.UI.Output(fmt.Sprintf("Success! Verified %d entries", entries))
+	return 0
+}
+
+// verifyFile verifies the entries of the file, returning the number of
+// entries and problems found
+func (c *AuditVerifyCommand) verifyFile(verifier *audit.ChainVerifier, file string) (int, int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	// Only verify the entries written so far, since the requests made to
+	// verify entries are themselves audited and may be appended to the file
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var r io.Reader = io.LimitReader(f, info.Size())
+	if strings.HasSuffix(file, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return 0, 0, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var entries, problems int
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		entry, err := reader.ReadBytes('\n')
+		if err == io.EOF && !bytes.HasSuffix(entry, []byte("\n")) {
+			// Skip an entry that was still being written
+			entry = nil
+		}
+		if len(entry) > 0 {
+			entries++
+
+			issue, verifyErr := verifier.Verify(entry)
+			if verifyErr != nil {
+				return entries, problems, verifyErr
+			}
+			switch {
+			case issue == nil:
+			case issue.Restart && c.flagAllowRestart:
+				c.UI.Warn(fmt.Sprintf("%s:%d: %s", file, line, issue.Message))
+			default:
+				c.UI.Error(fmt.Sprintf("%s:%d: %s", file, line, issue.Message))
+				problems++
+			}
+		}
+		if err == io.EOF {
+			return entries, problems, nil
+		}
+		if err != nil {
+			return entries, problems, err
+		}
+	}
+}
@@ -1,12 +1,15 @@
 package command
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/sdk/helper/password"
 	"github.com/posener/complete"
 )
 
@@ -73,6 +76,13 @@ Usage: vault login [options] [AUTH K=V...]
     - The -no-store flag is used, in which case this command will output the
       details of the wrapping token.
 
+  If the login requires multi-factor authentication, this command prompts for
+  the passcode of the first MFA method of each login enforcement, or waits for
+  push methods to be approved. The credentials may instead be given with the
+  -mfa flag as "METHOD:PASSCODE", or just "METHOD" for push methods:
+
+      $ vault login -method=userpass -mfa=my_totp:123456 username=my-username
+
 ` + c.Flags().Help()
 
 	return strings.TrimSpace(helpText)
@@ -228,6 +238,15 @@ func (c *LoginCommand) Run(args []string) int {
 		return 2
 	}
 
+	// Logins requiring MFA return an MFA requirement instead of a token
+	if secret != nil && secret.Auth != nil && secret.Auth.MFARequirement != nil {
+		secret, err = c.validateMFA(client, secret.Auth.MFARequirement, stdin)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error validating MFA: %s", err))
+			return 2
+		}
+	}
+
 	// Unset any previous token wrapping functionality. If the original request
 	// was for a wrapped token, we don't want future requests to be wrapped.
 	client.SetWrappingLookupFunc(func(string, string) string { return "" })
@@ -327,6 +346,73 @@ func (c *LoginCommand) Run(args []string) int {
 	return OutputSecret(c.UI, secret)
 }
 
+// validateMFA completes a login requiring MFA. The credentials given with
+// -mfa are used if there are any; otherwise the first method of each
+// constraint is used, prompting for passcodes.
+func (c *LoginCommand) validateMFA(client *api.Client, requirement *api.MFARequirement, stdin io.Reader) (*api.Secret, error) {
+	payload := make(map[string]interface{})
+	for _, cred := range c.flagMFA {
+		parts := strings.SplitN(cred, ":", 2)
+		creds, _ := payload[parts[0]].([]string)
+		if len(parts) == 2 {
+			creds = append(creds, parts[1])
+		}
+		payload[parts[0]] = creds
+	}
+
+	if len(payload) == 0 {
+		names := make([]string, 0, len(requirement.MFAConstraints))
+		for name := range requirement.MFAConstraints {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			constraint := requirement.MFAConstraints[name]
+			if constraint == nil || len(constraint.Any) == 0 {
+				return nil, fmt.Errorf("login enforcement %q has no MFA methods", name)
+			}
+			method := constraint.Any[0]
+
+			if !method.UsesPasscode {
+				c.UI.Warn(fmt.Sprintf("Waiting for approval of MFA method %q...", method.Name))
+				payload[method.Name] = []string{}
+				continue
+			}
+
+			passcode, err := c.readPasscode(method, stdin)
+			if err != nil {
+				return nil, err
+			}
+			payload[method.Name] = []string{passcode}
+		}
+	}
+
+	return client.Sys().MFAValidate(requirement.MFARequestID, payload)
+}
+
+// readPasscode prompts for the passcode of the MFA method
+func (c *LoginCommand) readPasscode(method *api.MFAMethodID, stdin io.Reader) (string, error) {
+	fmt.Fprintf(os.Stderr, "Passcode for MFA method %q (%s) (will be hidden): ", method.Name, method.Type)
+
+	var passcode string
+	var err error
+	if c.testStdin != nil {
+		passcode, err = bufio.NewReader(stdin).ReadString('\n')
+		if err == io.EOF {
+			err = nil
+		}
+	} else {
+		passcode, err = password.Read(os.Stdin)
+	}
+	fmt.Fprintf(os.Stderr, "\n")
+	if err != nil {
+		return "", fmt.Errorf("error reading passcode: %s", err)
+	}
+
+	return strings.TrimSpace(passcode), nil
+}
+
 // extractToken extracts the token from the given secret, automatically
 // unwrapping responses and handling error conditions if unwrap is true. The
 // result also returns whether it was a wrapped response that was not unwrapped.
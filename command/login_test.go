@@ -1,10 +1,13 @@
 package command
 
 import (
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/mitchellh/cli"
+	totplib "github.com/pquerna/otp/totp"
 
 	"github.com/hashicorp/vault/api"
 	credToken "github.com/hashicorp/vault/builtin/credential/token"
@@ -423,6 +426,105 @@ func TestLoginCommand_Run(t *testing.T) {
 		}
 	})
 
+	t.Run("mfa", func(t *testing.T) {
+		t.Parallel()
+
+		client, closer := testVaultServer(t)
+		defer closer()
+
+		if err := client.Sys().EnableAuth("userpass", "userpass", ""); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Logical().Write("auth/userpass/users/test", map[string]interface{}{
+			"password": "test",
+			"policies": "default",
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Log in once to create the entity, and generate its TOTP secret
+		secret, err := client.Logical().Write("auth/userpass/login/test", map[string]interface{}{
+			"password": "test",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Logical().Write("identity/mfa/method/totp/my_totp", map[string]interface{}{
+			"issuer": "Vault",
+		}); err != nil {
+			t.Fatal(err)
+		}
+		secret, err = client.Logical().Write("identity/mfa/method/totp/my_totp/admin-generate", map[string]interface{}{
+			"entity_id": secret.Auth.EntityID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := url.Parse(secret.Data["url"].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		totpSecret := u.Query().Get("secret")
+
+		auths, err := client.Sys().ListAuth()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Logical().Write("identity/mfa/login-enforcement/userpass", map[string]interface{}{
+			"mfa_method_names":      "my_totp",
+			"auth_method_accessors": auths["userpass/"].Accessor,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		login := func(stdin string, args ...string) (int, string) {
+			ui, cmd := testLoginCommand(t)
+			cmd.client = client
+			if stdin != "" {
+				cmd.testStdin = strings.NewReader(stdin)
+			}
+
+			code := cmd.Run(append(args, "-method", "userpass", "username=test", "password=test"))
+			return code, ui.OutputWriter.String() + ui.ErrorWriter.String()
+		}
+
+		// Wrong passcodes given with -mfa fail the login
+		code, combined := login("", "-mfa", "my_totp:000000")
+		if exp := 2; code != exp {
+			t.Errorf("expected %d to be %d", code, exp)
+		}
+		if expected := "Error validating MFA"; !strings.Contains(combined, expected) {
+			t.Errorf("expected %q to contain %q", combined, expected)
+		}
+
+		passcode, err := totplib.GenerateCode(totpSecret, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, combined = login("", "-mfa", "my_totp:"+passcode)
+		if exp := 0; code != exp {
+			t.Errorf("expected %d to be %d: %s", code, exp, combined)
+		}
+		if expected := "Success! You are now authenticated."; !strings.Contains(combined, expected) {
+			t.Errorf("expected %q to contain %q", combined, expected)
+		}
+
+		// Without -mfa, the passcode is prompted for. Passcodes cannot be
+		// reused, so use the one of the next period, which is allowed by the
+		// default skew.
+		passcode, err = totplib.GenerateCode(totpSecret, time.Now().Add(30*time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, combined = login(passcode + "\n")
+		if exp := 0; code != exp {
+			t.Errorf("expected %d to be %d: %s", code, exp, combined)
+		}
+		if expected := "Success! You are now authenticated."; !strings.Contains(combined, expected) {
+			t.Errorf("expected %q to contain %q", combined, expected)
+		}
+	})
+
 	t.Run("communication_failure", func(t *testing.T) {
 		t.Parallel()
 
@@ -694,6 +694,9 @@ func (c *ServerCommand) Run(args []string) int {
 		DisableKeyEncodingChecks:  config.DisablePrintableCheck,
 		MetricsHelper:             metricsHelper,
 	}
+	if config.Telemetry != nil {
+		coreConfig.UsageGaugePeriod = config.Telemetry.UsageGaugePeriod
+	}
 	if c.flagDev {
 		coreConfig.DevToken = c.flagDevRootTokenID
 		if c.flagDevLeasedKV {
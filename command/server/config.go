@@ -249,6 +249,13 @@ type Telemetry struct {
 	StackdriverLocation string `hcl:"stackdriver_location"`
 	// StackdriverNamespace is the namespace identifier, such as a cluster name.
 	StackdriverNamespace string `hcl:"stackdriver_namespace"`
+
+	// UsageGaugePeriod is the interval at which inventory gauges, such as
+	// the number of tokens and leases, are collected. A negative value,
+	// configured as "none", disables their collection.
+	// Default: 10m
+	UsageGaugePeriod    time.Duration `hcl:"-"`
+	UsageGaugePeriodRaw interface{}   `hcl:"usage_gauge_period"`
 }
 
 func (s *Telemetry) GoString() string {
@@ -903,5 +910,19 @@ func parseTelemetry(result *Config, list *ast.ObjectList) error {
 		result.Telemetry.PrometheusRetentionTime = prometheusDefaultRetentionTime
 	}
 
+	if raw := result.Telemetry.UsageGaugePeriodRaw; raw != nil {
+		if raw == "none" {
+			result.Telemetry.UsageGaugePeriod = -1
+		} else {
+			var err error
+			if result.Telemetry.UsageGaugePeriod, err = parseutil.ParseDurationSecond(raw); err != nil {
+				return err
+			}
+			if result.Telemetry.UsageGaugePeriod <= 0 {
+				return fmt.Errorf("telemetry: usage_gauge_period must be positive or \"none\"")
+			}
+		}
+	}
+
 	return nil
 }
@@ -123,6 +123,8 @@ func TestLoadConfigFile_topLevel(t *testing.T) {
 			DogStatsDTags:              []string{"tag_1:val_1", "tag_2:val_2"},
 			PrometheusRetentionTime:    30 * time.Second,
 			PrometheusRetentionTimeRaw: "30s",
+			UsageGaugePeriod:           5 * time.Minute,
+			UsageGaugePeriodRaw:        "5m",
 		},
 
 		DisableCache:    true,
@@ -400,3 +402,32 @@ listener "tcp" {
 	}
 
 }
+
+func TestParseTelemetry_usageGaugePeriod(t *testing.T) {
+	cases := map[string]time.Duration{
+		`usage_gauge_period = "1h"`:   time.Hour,
+		`usage_gauge_period = 30`:     30 * time.Second,
+		`usage_gauge_period = "none"`: -1,
+		``:                            0,
+	}
+
+	for input, expected := range cases {
+		obj, _ := hcl.Parse("telemetry {\n" + input + "\n}")
+
+		var config Config
+		list, _ := obj.Node.(*ast.ObjectList)
+		if err := parseTelemetry(&config, list.Filter("telemetry")); err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		if config.Telemetry.UsageGaugePeriod != expected {
+			t.Fatalf("%s: expected %s, got %s", input, expected, config.Telemetry.UsageGaugePeriod)
+		}
+	}
+
+	obj, _ := hcl.Parse("telemetry {\nusage_gauge_period = \"0s\"\n}")
+	var config Config
+	list, _ := obj.Node.(*ast.ObjectList)
+	if err := parseTelemetry(&config, list.Filter("telemetry")); err == nil {
+		t.Fatal("expected an error with a zero usage_gauge_period")
+	}
+}
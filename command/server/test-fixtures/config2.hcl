@@ -27,6 +27,7 @@ telemetry {
     dogstatsd_addr = "127.0.0.1:7254"
     dogstatsd_tags = ["tag_1:val_1", "tag_2:val_2"]
     prometheus_retention_time = "30s"
+    usage_gauge_period = "5m"
 }
 
 max_lease_ttl = "10h"
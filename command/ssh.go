@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"os/user"
+	"path/filepath"
 	"strings"
 	"syscall"
 
@@ -40,6 +41,7 @@ type SSHCommand struct {
 	flagPrivateKeyPath    string
 	flagHostKeyMountPoint string
 	flagHostKeyHostnames  string
+	flagTrustHostKeyCA    bool
 	flagValidPrincipals   string
 }
 
@@ -74,6 +76,16 @@ Usage: vault ssh [options] username@ip [ssh options]
           -host-key-hostnames=example.com \
           user@example.com
 
+  SSH using CA mode, trusting the host key CA in the user's known_hosts file:
+
+      $ vault ssh \
+          -mode=ca \
+          -role=my-role \
+          -host-key-mount-point=host-signer \
+          -host-key-hostnames=*.example.com \
+          -trust-host-key-ca \
+          user@example.com
+
   For the full list of options and arguments, please see the documentation.
 
 ` + c.Flags().Help()
@@ -194,6 +206,19 @@ func (c *SSHCommand) Flags() *FlagSets {
 			"list of values.",
 	})
 
+	f.BoolVar(&BoolVar{
+		Name:       "trust-host-key-ca",
+		Target:     &c.flagTrustHostKeyCA,
+		Default:    false,
+		EnvVar:     "VAULT_SSH_TRUST_HOST_KEY_CA",
+		Completion: complete.PredictNothing,
+		Usage: "Add the CA at -host-key-mount-point to the user's " +
+			"\"known_hosts\" file for the hostnames of -host-key-hostnames, " +
+			"instead of generating a temporary \"known_hosts\" file, so that the " +
+			"CA stays trusted for later connections. The file is the one given " +
+			"by -user-known-hosts-file, or \"~/.ssh/known_hosts\" by default.",
+	})
+
 	f.StringVar(&StringVar{
 		Name:       "valid-principals",
 		Target:     &c.flagValidPrincipals,
@@ -443,14 +468,29 @@ func (c *SSHCommand) handleTypeCA(username, ip, port string, sshArgs []string) i
 			return 2
 		}
 
-		// Write the known_hosts file
-		name := fmt.Sprintf("vault_ssh_ca_known_hosts_%s_%s", username, ip)
-		data := fmt.Sprintf("@cert-authority %s %s", c.flagHostKeyHostnames, publicKey)
-		knownHosts, err, closer := c.writeTemporaryFile(name, []byte(data), 0644)
-		defer closer()
-		if err != nil {
-			c.UI.Error(fmt.Sprintf("failed to write host public key: %s", err))
-			return 1
+		data := fmt.Sprintf("@cert-authority %s %s", c.flagHostKeyHostnames, strings.TrimSpace(publicKey))
+
+		var knownHosts string
+		if c.flagTrustHostKeyCA {
+			// Add the CA to the user's known_hosts file
+			knownHosts = userKnownHostsFile
+			if knownHosts == "" {
+				knownHosts = expandPath("~/.ssh/known_hosts")
+			}
+			if err := addKnownHostsEntry(knownHosts, data); err != nil {
+				c.UI.Error(fmt.Sprintf("failed to trust host public key: %s", err))
+				return 1
+			}
+		} else {
+			// Write the known_hosts file
+			name := fmt.Sprintf("vault_ssh_ca_known_hosts_%s_%s", username, ip)
+			var closer func() error
+			knownHosts, err, closer = c.writeTemporaryFile(name, []byte(data), 0644)
+			defer closer()
+			if err != nil {
+				c.UI.Error(fmt.Sprintf("failed to write host public key: %s", err))
+				return 1
+			}
 		}
 
 		// Update the variables
@@ -740,6 +780,39 @@ func (c *SSHCommand) writeTemporaryKey(name string, data []byte) (string, error,
 	return c.writeTemporaryFile(name, data, 0600)
 }
 
+// addKnownHostsEntry appends the entry to the known_hosts file at path, unless
+// the file already contains it.
+func addKnownHostsEntry(path, entry string) error {
+	existing, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "reading known hosts file")
+	}
+	for _, line := range strings.Split(string(existing), "\n") {
+		if strings.TrimSpace(line) == entry {
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.Wrap(err, "creating known hosts directory")
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "opening known hosts file")
+	}
+	if len(existing) > 0 && !strings.HasSuffix(string(existing), "\n") {
+		entry = "\n" + entry
+	}
+	_, err = f.WriteString(entry + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "writing known hosts file")
+	}
+	return nil
+}
+
 // If user did not provide the role with which SSH connection has
 // to be established and if there is only one role associated with
 // the IP, it is used by default.
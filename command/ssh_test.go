@@ -1,6 +1,9 @@
 package command
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/mitchellh/cli"
@@ -215,3 +218,36 @@ func TestIsSingleSSHArg(t *testing.T) {
 		})
 	}
 }
+
+func TestAddKnownHostsEntry(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "vault-ssh-known-hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, ".ssh", "known_hosts")
+	entry := "@cert-authority *.example.com ssh-rsa AAAA"
+
+	if err := addKnownHostsEntry(path, entry); err != nil {
+		t.Fatal(err)
+	}
+	// Adding the entry again does not duplicate it
+	if err := addKnownHostsEntry(path, entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := addKnownHostsEntry(path, "other.example.com ssh-rsa BBBB"); err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := entry + "\nother.example.com ssh-rsa BBBB\n"
+	if string(contents) != expected {
+		t.Fatalf("bad known_hosts: expected %q, got %q", expected, string(contents))
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/expfmt"
@@ -29,6 +30,15 @@ func NewMetricsHelper(inMem *metrics.InmemSink, enablePrometheus bool) *MetricsH
 	return &MetricsHelper{inMem, enablePrometheus}
 }
 
+// NamespaceLabel returns the label identifying the given namespace in
+// metrics, using "root" for the root namespace
+func NamespaceLabel(ns *namespace.Namespace) metrics.Label {
+	if ns == nil || ns.ID == namespace.RootNamespaceID {
+		return metrics.Label{Name: "namespace", Value: "root"}
+	}
+	return metrics.Label{Name: "namespace", Value: strings.Trim(ns.Path, "/")}
+}
+
 func FormatFromRequest(req *logical.Request) string {
 	acceptHeaders := req.Headers["Accept"]
 	if len(acceptHeaders) > 0 {
@@ -5,6 +5,7 @@ package duo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
 
@@ -70,15 +71,27 @@ type duoAuthRequest struct {
 func duoHandler(duoConfig *DuoConfig, duoAuthClient AuthClient, request *duoAuthRequest) (
 	*logical.Response, error) {
 
-	duoUser := fmt.Sprintf(duoConfig.UsernameFormat, request.username)
+	err := Authenticate(duoConfig, duoAuthClient, request.username, request.method, request.passcode, request.ipAddr)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return request.successResp, nil
+}
+
+// Authenticate verifies a user with Duo, either with the given passcode or
+// by sending the user a push, phone call or SMS depending on method. A nil
+// error means the user is allowed.
+func Authenticate(duoConfig *DuoConfig, duoAuthClient AuthClient, username, method, passcode, ipAddr string) error {
+	duoUser := fmt.Sprintf(duoConfig.UsernameFormat, username)
 
 	preauth, err := duoAuthClient.Preauth(
 		authapi.PreauthUsername(duoUser),
-		authapi.PreauthIpAddr(request.ipAddr),
+		authapi.PreauthIpAddr(ipAddr),
 	)
 
 	if err != nil || preauth == nil {
-		return logical.ErrorResponse("Could not call Duo preauth"), nil
+		return errors.New("Could not call Duo preauth")
 	}
 
 	if preauth.StatResult.Stat != "OK" {
@@ -89,45 +102,45 @@ func duoHandler(duoConfig *DuoConfig, duoAuthClient AuthClient, request *duoAuth
 		if preauth.StatResult.Message_Detail != nil {
 			errorMsg = errorMsg + " (" + *preauth.StatResult.Message_Detail + ")"
 		}
-		return logical.ErrorResponse(errorMsg), nil
+		return errors.New(errorMsg)
 	}
 
 	switch preauth.Response.Result {
 	case "allow":
-		return request.successResp, err
+		return nil
 	case "deny":
-		return logical.ErrorResponse(preauth.Response.Status_Msg), nil
+		return errors.New(preauth.Response.Status_Msg)
 	case "enroll":
-		return logical.ErrorResponse(fmt.Sprintf("%s (%s)",
+		return fmt.Errorf("%s (%s)",
 			preauth.Response.Status_Msg,
-			preauth.Response.Enroll_Portal_Url)), nil
+			preauth.Response.Enroll_Portal_Url)
 	case "auth":
 		break
 	default:
-		return logical.ErrorResponse(fmt.Sprintf("Invalid Duo preauth response: %s",
-			preauth.Response.Result)), nil
+		return fmt.Errorf("Invalid Duo preauth response: %s",
+			preauth.Response.Result)
 	}
 
 	options := []func(*url.Values){authapi.AuthUsername(duoUser)}
-	if request.method == "" {
-		request.method = "auto"
+	if method == "" {
+		method = "auto"
 	}
-	if request.method == "auto" || request.method == "push" {
+	if method == "auto" || method == "push" {
 		if duoConfig.PushInfo != "" {
 			options = append(options, authapi.AuthPushinfo(duoConfig.PushInfo))
 		}
 	}
-	if request.passcode != "" {
-		request.method = "passcode"
-		options = append(options, authapi.AuthPasscode(request.passcode))
+	if passcode != "" {
+		method = "passcode"
+		options = append(options, authapi.AuthPasscode(passcode))
 	} else {
 		options = append(options, authapi.AuthDevice("auto"))
 	}
 
-	result, err := duoAuthClient.Auth(request.method, options...)
+	result, err := duoAuthClient.Auth(method, options...)
 
 	if err != nil || result == nil {
-		return logical.ErrorResponse("Could not call Duo auth"), nil
+		return errors.New("Could not call Duo auth")
 	}
 
 	if result.StatResult.Stat != "OK" {
@@ -138,12 +151,12 @@ func duoHandler(duoConfig *DuoConfig, duoAuthClient AuthClient, request *duoAuth
 		if result.StatResult.Message_Detail != nil {
 			errorMsg = errorMsg + " (" + *result.StatResult.Message_Detail + ")"
 		}
-		return logical.ErrorResponse(errorMsg), nil
+		return errors.New(errorMsg)
 	}
 
 	if result.Response.Result != "allow" {
-		return logical.ErrorResponse(result.Response.Status_Msg), nil
+		return errors.New(result.Response.Status_Msg)
 	}
 
-	return request.successResp, nil
+	return nil
 }
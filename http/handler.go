@@ -3,16 +3,21 @@ package http
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
+	"mime"
 	"net"
 	"net/http"
 	"net/textproto"
 	"net/url"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -28,6 +33,7 @@ import (
 	"github.com/hashicorp/vault/sdk/helper/pathmanager"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/hashicorp/vault/vault"
+	"github.com/hashicorp/vault/vault/quotas"
 )
 
 const (
@@ -71,6 +77,14 @@ var (
 	perfStandbyAlwaysForwardPaths = pathmanager.New()
 	alwaysRedirectPaths           = pathmanager.New()
 
+	// rateLimitQuotaExemptPaths are never subject to rate limit quotas so
+	// that operators can always check on, unseal and reconfigure Vault
+	rateLimitQuotaExemptPaths = pathmanager.New()
+
+	// formRequestPathRe matches the token endpoints of identity OIDC
+	// providers, the only paths whose bodies may be form encoded
+	formRequestPathRe = regexp.MustCompile(`^identity/oidc/provider/[^/]+/token$`)
+
 	injectDataIntoTopRoutes = []string{
 		"/v1/sys/audit",
 		"/v1/sys/audit/",
@@ -101,6 +115,14 @@ func init() {
 		"sys/storage/raft/snapshot",
 		"sys/storage/raft/snapshot-force",
 	})
+	rateLimitQuotaExemptPaths.AddPaths([]string{
+		"sys/health",
+		"sys/init",
+		"sys/leader",
+		"sys/seal-status",
+		"sys/unseal",
+		"sys/quotas/*",
+	})
 }
 
 // Handler returns an http.Handler for the API. This can be used on
@@ -154,9 +176,13 @@ func Handler(props *vault.HandlerProperties) http.Handler {
 
 	additionalRoutes(mux, core)
 
+	// Dispatch OCSP GET requests before the muxer can redirect them
+	ocspWrappedHandler := wrapOCSPGetHandler(core, mux, handleRequestForwarding(core, handleLogical(core)))
+
 	// Wrap the handler in another handler to trigger all help paths.
-	helpWrappedHandler := wrapHelpHandler(mux, core)
-	corsWrappedHandler := wrapCORSHandler(helpWrappedHandler, core)
+	helpWrappedHandler := wrapHelpHandler(ocspWrappedHandler, core)
+	quotaWrappedHandler := rateLimitQuotaWrapping(helpWrappedHandler, core)
+	corsWrappedHandler := wrapCORSHandler(quotaWrappedHandler, core)
 
 	genericWrappedHandler := genericWrapping(core, corsWrappedHandler, props)
 
@@ -170,6 +196,41 @@ func Handler(props *vault.HandlerProperties) http.Handler {
 	return printablePathCheckHandler
 }
 
+// wrapOCSPGetHandler dispatches OCSP GET requests, which carry a base64
+// encoded OCSP request in their path, directly to the logical handler. The
+// base64 alphabet includes "/", and the muxer would otherwise redirect
+// requests containing "//" to the cleaned path, corrupting the OCSP request.
+func wrapOCSPGetHandler(core *vault.Core, mux http.Handler, logicalHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isOCSPGetRequest(core, r) {
+			logicalHandler.ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// isOCSPGetRequest returns whether the request is a GET request to the
+// ocsp/<request> route of a mounted pki backend. All other requests are left
+// to the muxer.
+func isOCSPGetRequest(core *vault.Core, r *http.Request) bool {
+	if r.Method != "GET" || !strings.HasPrefix(r.URL.Path, "/v1/") {
+		return false
+	}
+	ns, err := namespace.FromContext(r.Context())
+	if err != nil {
+		return false
+	}
+
+	path := ns.TrimmedPath(r.URL.Path[len("/v1/"):])
+	idx := strings.Index(path, "/ocsp/")
+	if idx == -1 {
+		return false
+	}
+	mountPath, mountType := core.MatchingMountType(r.Context(), path)
+	return mountType == "pki" && mountPath == path[:idx+1]
+}
+
 // wrapGenericHandler wraps the handler with an extra layer of handler where
 // tasks that should be commonly handled for all the requests and/or responses
 // are performed.
@@ -217,6 +278,59 @@ func wrapGenericHandler(core *vault.Core, h http.Handler, maxRequestSize int64,
 	})
 }
 
+// rateLimitQuotaWrapping rejects API requests that exceed the rate limit quota
+// applicable to them with a 429, indicating when to retry in the Retry-After
+// header.
+func rateLimitQuotaWrapping(h http.Handler, core *vault.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/") {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		path := strings.TrimPrefix(r.URL.Path, "/v1/")
+		if rateLimitQuotaExemptPaths.HasPath(path) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		ns, err := namespace.FromContext(r.Context())
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		clientAddress, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			clientAddress = r.RemoteAddr
+		}
+
+		resp, err := core.ApplyRateLimitQuota(&quotas.Request{
+			Path:          path,
+			NamespacePath: ns.Path,
+			MountPath:     strings.TrimPrefix(core.MatchingMount(r.Context(), path), ns.Path),
+			ClientAddress: clientAddress,
+		})
+		if err != nil {
+			core.Logger().Error("failed to apply rate limit quota", "path", path, "error", err)
+			respondError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		if !resp.Allowed {
+			retryAfter := int64(math.Ceil(resp.RetryAfter.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+			respondError(w, http.StatusTooManyRequests, errwrap.Wrapf(fmt.Sprintf("request path %q: {{err}}", path), quotas.ErrRateLimitQuotaExceeded))
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
 func WrapForwardedForHandler(h http.Handler, authorizedAddrs []*sockaddr.SockAddrMarshaler, rejectNotPresent, rejectNonAuthz bool, hopSkips int) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		headers, headersOK := r.Header[textproto.CanonicalMIMEHeaderKey("X-Forwarded-For")]
@@ -489,19 +603,9 @@ func parseQuery(values url.Values) map[string]interface{} {
 }
 
 func parseRequest(core *vault.Core, r *http.Request, w http.ResponseWriter, out interface{}) (io.ReadCloser, error) {
-	// Limit the maximum number of bytes to MaxRequestSize to protect
-	// against an indefinite amount of data being read.
-	reader := r.Body
-	ctx := r.Context()
-	maxRequestSize := ctx.Value("max_request_size")
-	if maxRequestSize != nil {
-		max, ok := maxRequestSize.(int64)
-		if !ok {
-			return nil, errors.New("could not parse max_request_size from request context")
-		}
-		if max > 0 {
-			reader = http.MaxBytesReader(w, r.Body, max)
-		}
+	reader, err := limitRequestBody(r, w)
+	if err != nil {
+		return nil, err
 	}
 	var origBody io.ReadWriter
 	if core.PerfStandby() {
@@ -510,7 +614,7 @@ func parseRequest(core *vault.Core, r *http.Request, w http.ResponseWriter, out
 		origBody = new(bytes.Buffer)
 		reader = ioutil.NopCloser(io.TeeReader(reader, origBody))
 	}
-	err := jsonutil.DecodeJSONFromReader(reader, out)
+	err = jsonutil.DecodeJSONFromReader(reader, out)
 	if err != nil && err != io.EOF {
 		return nil, errwrap.Wrapf("failed to parse JSON input: {{err}}", err)
 	}
@@ -520,6 +624,107 @@ func parseRequest(core *vault.Core, r *http.Request, w http.ResponseWriter, out
 	return nil, err
 }
 
+// isOCSPPostRequest returns whether the request carries a DER encoded OCSP
+// request for the ocsp route of a mounted pki backend. Other paths only
+// accept JSON bodies, whatever their content type.
+func isOCSPPostRequest(core *vault.Core, r *http.Request, path string) bool {
+	if r.Header.Get("Content-Type") != "application/ocsp-request" {
+		return false
+	}
+	mountPath, mountType := core.MatchingMountType(r.Context(), path)
+	return mountType == "pki" && path == mountPath+"ocsp"
+}
+
+// parseOCSPRequest reads the DER encoded body of an OCSP request, which OCSP
+// clients send in place of JSON, and returns it base64 encoded as the
+// "request" field of the request data.
+func parseOCSPRequest(core *vault.Core, r *http.Request, w http.ResponseWriter) (io.ReadCloser, map[string]interface{}, error) {
+	reader, err := limitRequestBody(r, w)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, nil, errwrap.Wrapf("failed to read OCSP request: {{err}}", err)
+	}
+
+	var origBody io.ReadCloser
+	if core.PerfStandby() {
+		origBody = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	return origBody, map[string]interface{}{
+		"request": base64.StdEncoding.EncodeToString(body),
+	}, nil
+}
+
+// isFormRequest returns whether the request body is form encoded, as sent by
+// OAuth 2.0 clients to the token endpoints of identity OIDC providers. Other
+// paths never accept form bodies, so that HTML forms posted from other origins
+// cannot reach them without a CORS preflight.
+func isFormRequest(path string, r *http.Request) bool {
+	if !formRequestPathRe.MatchString(path) {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/x-www-form-urlencoded"
+}
+
+// parseFormRequest reads a form encoded body and returns its fields as the
+// request data. Tools such as curl label bodies with the form content type
+// by default, so a body that looks like a JSON object is decoded as JSON.
+func parseFormRequest(core *vault.Core, r *http.Request, w http.ResponseWriter) (io.ReadCloser, map[string]interface{}, error) {
+	reader, err := limitRequestBody(r, w)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, nil, errwrap.Wrapf("failed to read request body: {{err}}", err)
+	}
+
+	var origBody io.ReadCloser
+	if core.PerfStandby() {
+		origBody = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return origBody, nil, nil
+	}
+
+	var data map[string]interface{}
+	if trimmed[0] == '{' {
+		if err := jsonutil.DecodeJSON(trimmed, &data); err != nil {
+			return nil, nil, errwrap.Wrapf("failed to parse JSON input: {{err}}", err)
+		}
+		return origBody, data, nil
+	}
+
+	values, err := url.ParseQuery(string(trimmed))
+	if err != nil {
+		return nil, nil, errwrap.Wrapf("failed to parse form input: {{err}}", err)
+	}
+	return origBody, parseQuery(values), nil
+}
+
+// limitRequestBody limits the maximum number of bytes read from the request
+// body to MaxRequestSize to protect against an indefinite amount of data
+// being read.
+func limitRequestBody(r *http.Request, w http.ResponseWriter) (io.ReadCloser, error) {
+	reader := r.Body
+	maxRequestSize := r.Context().Value("max_request_size")
+	if maxRequestSize != nil {
+		max, ok := maxRequestSize.(int64)
+		if !ok {
+			return nil, errors.New("could not parse max_request_size from request context")
+		}
+		if max > 0 {
+			reader = http.MaxBytesReader(w, r.Body, max)
+		}
+	}
+	return reader, nil
+}
+
 // handleRequestForwarding determines whether to forward a request or not,
 // falling back on the older behavior of redirecting the client
 func handleRequestForwarding(core *vault.Core, handler http.Handler) http.Handler {
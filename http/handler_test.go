@@ -14,6 +14,7 @@ import (
 	"github.com/go-test/deep"
 
 	cleanhttp "github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/builtin/logical/pki"
 	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/sdk/helper/consts"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -221,6 +222,60 @@ func TestHandler_CacheControlNoStore(t *testing.T) {
 	}
 }
 
+func TestHandler_OCSPGetNotRedirected(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealedWithConfig(t, &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"pki": pki.Factory,
+		},
+	})
+	resp, err := core.HandleRequest(namespace.RootContext(nil), &logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "sys/mounts/pki",
+		ClientToken: token,
+		Data: map[string]interface{}{
+			"type": "pki",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	var served string
+	logicalHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = r.URL.Path
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/v1/", logicalHandler)
+	handler := wrapOCSPGetHandler(core, mux, logicalHandler)
+
+	// Base64 encoded OCSP requests may contain "//"
+	for _, path := range []string{"/v1/pki/ocsp/MFYw//VDBSME8=", "/v1/pki/ocsp/MFYw%2F%2FVDBSME8%3D"} {
+		served = ""
+		req := httptest.NewRequest("GET", path, nil)
+		req = req.WithContext(namespace.RootContext(nil))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected the request to be served, got status %d", path, w.Code)
+		}
+		if served != "/v1/pki/ocsp/MFYw//VDBSME8=" {
+			t.Fatalf("%s: bad path %q", path, served)
+		}
+	}
+
+	// Other requests are still cleaned by the muxer, including those to
+	// ocsp/ paths of other backends
+	for _, path := range []string{"/v1/secret//foo", "/v1/secret/ocsp/MFYw//VDBSME8=", "/v1/pki/foo/ocsp/MFYw//VDBSME8="} {
+		req := httptest.NewRequest("GET", path, nil)
+		req = req.WithContext(namespace.RootContext(nil))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusMovedPermanently {
+			t.Fatalf("%s: expected redirect, got status %d", path, w.Code)
+		}
+	}
+}
+
 func TestHandler_Accepted(t *testing.T) {
 	core, _, token := vault.TestCoreUnsealed(t)
 	ln, addr := TestServer(t, core)
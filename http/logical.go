@@ -36,7 +36,7 @@ func buildLogicalRequest(core *vault.Core, w http.ResponseWriter, r *http.Reques
 	case "DELETE":
 		op = logical.DeleteOperation
 		data = parseQuery(r.URL.Query())
-	case "GET":
+	case "GET", "HEAD":
 		op = logical.ReadOperation
 		queryVals := r.URL.Query()
 		var list bool
@@ -77,6 +77,16 @@ func buildLogicalRequest(core *vault.Core, w http.ResponseWriter, r *http.Reques
 			if path == "sys/storage/raft/snapshot" || path == "sys/storage/raft/snapshot-force" {
 				passHTTPReq = true
 				origBody = r.Body
+			} else if isOCSPPostRequest(core, r, path) {
+				origBody, data, err = parseOCSPRequest(core, r, w)
+				if err != nil {
+					return nil, nil, http.StatusBadRequest, err
+				}
+			} else if isFormRequest(path, r) {
+				origBody, data, err = parseFormRequest(core, r, w)
+				if err != nil {
+					return nil, nil, http.StatusBadRequest, err
+				}
 			} else {
 				origBody, err = parseRequest(core, r, w, &data)
 				if err == io.EOF {
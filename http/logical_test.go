@@ -18,6 +18,7 @@ import (
 	log "github.com/hashicorp/go-hclog"
 
 	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/builtin/logical/pki"
 	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/sdk/helper/consts"
 	"github.com/hashicorp/vault/sdk/helper/logging"
@@ -319,6 +320,102 @@ func TestLogical_ListSuffix(t *testing.T) {
 	}
 }
 
+func TestLogical_FormRequest(t *testing.T) {
+	core, _, rootToken := vault.TestCoreUnsealed(t)
+
+	for body, expected := range map[string]map[string]interface{}{
+		"grant_type=authorization_code&code=abc&scope=openid+email": {
+			"grant_type": "authorization_code",
+			"code":       "abc",
+			"scope":      "openid email",
+		},
+		// curl labels JSON bodies with the form content type by default
+		`{"foo": "bar"}`: {
+			"foo": "bar",
+		},
+	} {
+		req, _ := http.NewRequest("POST", "http://127.0.0.1:8200/v1/identity/oidc/provider/test/token", strings.NewReader(body))
+		req = req.WithContext(namespace.RootContext(nil))
+		req.Header.Add(consts.AuthHeaderName, rootToken)
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+		lreq, _, status, err := buildLogicalRequest(core, nil, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != 0 {
+			t.Fatalf("got status %d", status)
+		}
+		if !reflect.DeepEqual(lreq.Data, expected) {
+			t.Fatalf("bad data for %q: %#v", body, lreq.Data)
+		}
+	}
+
+	// Other paths only accept JSON bodies, whatever their content type
+	req, _ := http.NewRequest("POST", "http://127.0.0.1:8200/v1/secret/foo", strings.NewReader("foo=bar"))
+	req = req.WithContext(namespace.RootContext(nil))
+	req.Header.Add(consts.AuthHeaderName, rootToken)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	_, _, status, err := buildLogicalRequest(core, nil, req)
+	if err == nil || status != http.StatusBadRequest {
+		t.Fatalf("expected a bad request for a form body, got status %d: %v", status, err)
+	}
+
+	req, _ = http.NewRequest("POST", "http://127.0.0.1:8200/v1/secret/foo", strings.NewReader(`{"foo": "bar"}`))
+	req = req.WithContext(namespace.RootContext(nil))
+	req.Header.Add(consts.AuthHeaderName, rootToken)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	lreq, _, status, err := buildLogicalRequest(core, nil, req)
+	if err != nil || status != 0 {
+		t.Fatalf("got status %d: %v", status, err)
+	}
+	if !reflect.DeepEqual(lreq.Data, map[string]interface{}{"foo": "bar"}) {
+		t.Fatalf("bad data: %#v", lreq.Data)
+	}
+}
+
+func TestLogical_OCSPRequest(t *testing.T) {
+	core, _, rootToken := vault.TestCoreUnsealedWithConfig(t, &vault.CoreConfig{
+		LogicalBackends: map[string]logical.Factory{
+			"pki": pki.Factory,
+		},
+	})
+	resp, err := core.HandleRequest(namespace.RootContext(nil), &logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "sys/mounts/pki",
+		ClientToken: rootToken,
+		Data: map[string]interface{}{
+			"type": "pki",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	body := []byte{0x30, 0x03, 0x02, 0x01, 0x01}
+	req, _ := http.NewRequest("POST", "http://127.0.0.1:8200/v1/pki/ocsp", bytes.NewReader(body))
+	req = req.WithContext(namespace.RootContext(nil))
+	req.Header.Add("Content-Type", "application/ocsp-request")
+	lreq, _, status, err := buildLogicalRequest(core, nil, req)
+	if err != nil || status != 0 {
+		t.Fatalf("got status %d: %v", status, err)
+	}
+	if !reflect.DeepEqual(lreq.Data, map[string]interface{}{"request": "MAMCAQE="}) {
+		t.Fatalf("bad data: %#v", lreq.Data)
+	}
+
+	// Other paths only accept JSON bodies, whatever their content type
+	for _, path := range []string{"secret/foo", "secret/ocsp", "pki/foo/ocsp"} {
+		req, _ := http.NewRequest("POST", "http://127.0.0.1:8200/v1/"+path, bytes.NewReader(body))
+		req = req.WithContext(namespace.RootContext(nil))
+		req.Header.Add(consts.AuthHeaderName, rootToken)
+		req.Header.Add("Content-Type", "application/ocsp-request")
+		_, _, status, err := buildLogicalRequest(core, nil, req)
+		if err == nil || status != http.StatusBadRequest {
+			t.Fatalf("%s: expected a bad request for an OCSP body, got status %d: %v", path, status, err)
+		}
+	}
+}
+
 func TestLogical_RespondWithStatusCode(t *testing.T) {
 	resp := &logical.Response{
 		Data: map[string]interface{}{
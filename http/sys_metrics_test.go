@@ -48,3 +48,68 @@ func TestSysMetricsUnauthenticated(t *testing.T) {
 	resp = testHttpGet(t, token, addr+"/v1/sys/metrics")
 	testResponseStatus(t, resp, 200)
 }
+
+func TestSysMetrics_UsageGauges(t *testing.T) {
+	inm := metrics.NewInmemSink(10*time.Second, time.Minute)
+	metricsConf := metrics.DefaultConfig("vault")
+	metricsConf.EnableHostname = false
+	metricsConf.EnableRuntimeMetrics = false
+	if _, err := metrics.NewGlobal(metricsConf, inm); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &vault.CoreConfig{
+		BuiltinRegistry:  vault.NewMockBuiltinRegistry(),
+		MetricsHelper:    metricsutil.NewMetricsHelper(inm, false),
+		UsageGaugePeriod: 100 * time.Millisecond,
+	}
+	core, _, token := vault.TestCoreUnsealedWithConfig(t, conf)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPut(t, token, addr+"/v1/secret/foo", map[string]interface{}{
+		"value": "bar",
+		"ttl":   "1h",
+	})
+	testResponseStatus(t, resp, 204)
+	resp = testHttpGet(t, token, addr+"/v1/secret/foo")
+	testResponseStatus(t, resp, 200)
+	resp = testHttpPut(t, token, addr+"/v1/auth/token/create", map[string]interface{}{})
+	testResponseStatus(t, resp, 200)
+
+	gauge := func(hash string) (float32, bool) {
+		var value float32
+		var found bool
+		for _, interval := range inm.Data() {
+			interval.RLock()
+			if g, ok := interval.Gauges[hash]; ok {
+				value, found = g.Value, true
+			}
+			interval.RUnlock()
+		}
+		return value, found
+	}
+
+	expected := map[string]float32{
+		"vault.core.unsealed":                                                        1,
+		"vault.token.count;namespace=root":                                           2,
+		"vault.identity.entity.count;namespace=root":                                 0,
+		"vault.policy.count;namespace=root":                                          1,
+		"vault.expire.leases.count;namespace=root;mount_point=secret/;mount_type=kv": 1,
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for hash, value := range expected {
+		for {
+			actual, ok := gauge(hash)
+			if ok && actual == value {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected gauge %s to be %v, got %v (set: %t)", hash, value, actual, ok)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+}
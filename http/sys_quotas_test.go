@@ -0,0 +1,152 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestSysQuotas_RateLimit(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPut(t, token, addr+"/v1/secret/foo", map[string]interface{}{
+		"value": "bar",
+	})
+	testResponseStatus(t, resp, 204)
+
+	// A quota on a mount that does not exist is rejected
+	resp = testHttpPut(t, token, addr+"/v1/sys/quotas/rate-limit/bad", map[string]interface{}{
+		"path": "nonexistent/",
+		"rate": 1,
+	})
+	testResponseStatus(t, resp, 400)
+
+	resp = testHttpPut(t, token, addr+"/v1/sys/quotas/rate-limit/secret", map[string]interface{}{
+		"path":     "secret",
+		"rate":     2,
+		"interval": "1h",
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/quotas/rate-limit/secret")
+	testResponseStatus(t, resp, 200)
+	var actual map[string]interface{}
+	testResponseBody(t, resp, &actual)
+	data := actual["data"].(map[string]interface{})
+	if data["path"] != "secret/" || data["rate"] != json.Number("2") || data["burst"] != json.Number("2") {
+		t.Fatalf("bad quota: %#v", data)
+	}
+
+	// Only one quota may apply to a given path
+	resp = testHttpPut(t, token, addr+"/v1/sys/quotas/rate-limit/duplicate", map[string]interface{}{
+		"path": "secret/",
+		"rate": 10,
+	})
+	testResponseStatus(t, resp, 400)
+
+	for i := 0; i < 2; i++ {
+		resp = testHttpGet(t, token, addr+"/v1/secret/foo")
+		testResponseStatus(t, resp, 200)
+	}
+
+	resp = testHttpGet(t, token, addr+"/v1/secret/foo")
+	testResponseStatus(t, resp, http.StatusTooManyRequests)
+	retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retryAfter <= 0 || retryAfter > 3600 {
+		t.Fatalf("bad Retry-After: %d", retryAfter)
+	}
+
+	// Requests to other mounts are not limited
+	for i := 0; i < 3; i++ {
+		resp = testHttpGet(t, token, addr+"/v1/auth/token/lookup-self")
+		testResponseStatus(t, resp, 200)
+	}
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/quotas/rate-limit?list=true")
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &actual)
+	keys := actual["data"].(map[string]interface{})["keys"].([]interface{})
+	if len(keys) != 1 || keys[0] != "secret" {
+		t.Fatalf("bad keys: %#v", keys)
+	}
+
+	resp = testHttpDelete(t, token, addr+"/v1/sys/quotas/rate-limit/secret")
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpGet(t, token, addr+"/v1/secret/foo")
+	testResponseStatus(t, resp, 200)
+}
+
+func TestSysQuotas_LeaseCount(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPut(t, token, addr+"/v1/secret/foo", map[string]interface{}{
+		"value": "bar",
+		"ttl":   "1h",
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpPut(t, token, addr+"/v1/sys/quotas/lease-count/secret", map[string]interface{}{
+		"path":       "secret/",
+		"max_leases": 2,
+	})
+	testResponseStatus(t, resp, 204)
+
+	var actual map[string]interface{}
+	for i := 0; i < 2; i++ {
+		resp = testHttpGet(t, token, addr+"/v1/secret/foo")
+		testResponseStatus(t, resp, 200)
+		testResponseBody(t, resp, &actual)
+		if actual["lease_id"] == "" {
+			t.Fatal("expected a lease")
+		}
+	}
+
+	resp = testHttpGet(t, token, addr+"/v1/secret/foo")
+	testResponseStatus(t, resp, 400)
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/leases/count")
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &actual)
+	data := actual["data"].(map[string]interface{})
+	if data["lease_count"] != json.Number("2") {
+		t.Fatalf("bad lease count: %#v", data)
+	}
+	if counts := data["counts"].(map[string]interface{}); counts["secret/"] != json.Number("2") {
+		t.Fatalf("bad counts: %#v", counts)
+	}
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/quotas/lease-count/secret")
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &actual)
+	data = actual["data"].(map[string]interface{})
+	if data["max_leases"] != json.Number("2") || data["lease_count"] != json.Number("2") {
+		t.Fatalf("bad quota: %#v", data)
+	}
+
+	// Revoking a lease makes room for another
+	resp = testHttpPut(t, token, addr+"/v1/sys/leases/revoke-prefix/secret/foo", nil)
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/leases/count?prefix=secret/")
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &actual)
+	if data := actual["data"].(map[string]interface{}); data["lease_count"] != json.Number("0") {
+		t.Fatalf("bad lease count: %#v", data)
+	}
+
+	resp = testHttpGet(t, token, addr+"/v1/secret/foo")
+	testResponseStatus(t, resp, 200)
+}
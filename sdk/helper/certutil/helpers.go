@@ -329,6 +329,72 @@ func AddExtKeyUsageOids(data *CreationBundle, certTemplate *x509.Certificate) {
 	}
 }
 
+// AddCustomExtensions adds the custom extensions to the certificate
+func AddCustomExtensions(data *CreationBundle, certTemplate *x509.Certificate) {
+	for _, ext := range data.Params.CustomExtensions {
+		for i, existing := range certTemplate.ExtraExtensions {
+			if existing.Id.Equal(ext.Id) {
+				certTemplate.ExtraExtensions = append(certTemplate.ExtraExtensions[:i], certTemplate.ExtraExtensions[i+1:]...)
+				break
+			}
+		}
+		certTemplate.ExtraExtensions = append(certTemplate.ExtraExtensions, ext)
+	}
+}
+
+var oidExtensionFreshestCRL = asn1.ObjectIdentifier{2, 5, 29, 46}
+
+// distributionPoint is a DistributionPoint of RFC 5280, section 4.2.1.13,
+// which only holds a full name
+type distributionPoint struct {
+	DistributionPoint distributionPointName `asn1:"optional,tag:0"`
+}
+
+type distributionPointName struct {
+	FullName []asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// DeltaCRLDistributionPointsExtension returns the freshest CRL extension of
+// RFC 5280, section 4.2.1.15, which points to where delta CRLs can be fetched
+func DeltaCRLDistributionPointsExtension(urls []string) (pkix.Extension, error) {
+	var points []distributionPoint
+	for _, url := range urls {
+		points = append(points, distributionPoint{
+			DistributionPoint: distributionPointName{
+				FullName: []asn1.RawValue{
+					{Tag: 6, Class: asn1.ClassContextSpecific, Bytes: []byte(url)},
+				},
+			},
+		})
+	}
+
+	value, err := asn1.Marshal(points)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+
+	return pkix.Extension{
+		Id:    oidExtensionFreshestCRL,
+		Value: value,
+	}, nil
+}
+
+// AddDeltaCRLDistributionPoints adds the configured delta CRL URLs to the
+// certificate
+func AddDeltaCRLDistributionPoints(urls *URLEntries, certTemplate *x509.Certificate) error {
+	if urls == nil || len(urls.DeltaCRLDistributionPoints) == 0 {
+		return nil
+	}
+
+	ext, err := DeltaCRLDistributionPointsExtension(urls.DeltaCRLDistributionPoints)
+	if err != nil {
+		return err
+	}
+	certTemplate.ExtraExtensions = append(certTemplate.ExtraExtensions, ext)
+
+	return nil
+}
+
 func HandleOtherCSRSANs(in *x509.CertificateRequest, sans map[string][]string) error {
 	certTemplate := &x509.Certificate{
 		DNSNames:       in.DNSNames,
@@ -544,9 +610,14 @@ func CreateCertificate(data *CreationBundle) (*ParsedCertBundle, error) {
 
 	AddExtKeyUsageOids(data, certTemplate)
 
+	AddCustomExtensions(data, certTemplate)
+
 	certTemplate.IssuingCertificateURL = data.Params.URLs.IssuingCertificates
 	certTemplate.CRLDistributionPoints = data.Params.URLs.CRLDistributionPoints
 	certTemplate.OCSPServer = data.Params.URLs.OCSPServers
+	if err := AddDeltaCRLDistributionPoints(data.Params.URLs, certTemplate); err != nil {
+		return nil, errutil.InternalError{Err: errwrap.Wrapf("error marshaling delta CRL distribution points: {{err}}", err).Error()}
+	}
 
 	var certBytes []byte
 	if data.SigningBundle != nil {
@@ -759,11 +830,16 @@ func SignCertificate(data *CreationBundle) (*ParsedCertBundle, error) {
 
 	AddExtKeyUsageOids(data, certTemplate)
 
+	AddCustomExtensions(data, certTemplate)
+
 	var certBytes []byte
 
 	certTemplate.IssuingCertificateURL = data.Params.URLs.IssuingCertificates
 	certTemplate.CRLDistributionPoints = data.Params.URLs.CRLDistributionPoints
 	certTemplate.OCSPServer = data.SigningBundle.URLs.OCSPServers
+	if err := AddDeltaCRLDistributionPoints(data.Params.URLs, certTemplate); err != nil {
+		return nil, errutil.InternalError{Err: errwrap.Wrapf("error marshaling delta CRL distribution points: {{err}}", err).Error()}
+	}
 
 	if data.Params.IsCA {
 		certTemplate.BasicConstraintsValid = true
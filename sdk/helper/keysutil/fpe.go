@@ -0,0 +1,426 @@
+package keysutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/hashicorp/vault/sdk/helper/errutil"
+)
+
+const (
+	// FF3TweakSize is the size in bytes of the tweak of FF3-1
+	FF3TweakSize = 7
+
+	// ff3Rounds is the number of Feistel rounds of FF3-1
+	ff3Rounds = 8
+
+	// ff3MinDomainSize is the minimum number of possible values of an input,
+	// see NIST SP 800-38G Rev. 1 section 5.2
+	ff3MinDomainSize = 1000000
+
+	// maxFPEAlphabetSize is the maximum radix supported by FF3-1
+	maxFPEAlphabetSize = 1 << 16
+
+	// DefaultFPEAlphabet is the alphabet of format preserving encryption keys
+	// created without one
+	DefaultFPEAlphabet = "numeric"
+)
+
+// fpeAlphabets are the named alphabets that format preserving encryption
+// keys can be created with
+var fpeAlphabets = map[string]string{
+	"numeric":            "0123456789",
+	"alphanumeric-lower": "0123456789abcdefghijklmnopqrstuvwxyz",
+	"alphanumeric-upper": "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"alphanumeric":       "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+}
+
+// ParseFPEAlphabet returns the characters of the given alphabet, which is
+// either the name of a built-in alphabet or the characters themselves
+func ParseFPEAlphabet(alphabet string) (string, error) {
+	if alphabet == "" {
+		alphabet = DefaultFPEAlphabet
+	}
+	if chars, ok := fpeAlphabets[alphabet]; ok {
+		return chars, nil
+	}
+
+	if !utf8.ValidString(alphabet) {
+		return "", errors.New("alphabet is not valid UTF-8")
+	}
+	seen := make(map[rune]bool)
+	for _, r := range alphabet {
+		if seen[r] {
+			return "", fmt.Errorf("alphabet contains the character %q more than once", r)
+		}
+		seen[r] = true
+	}
+	if len(seen) < 2 || len(seen) > maxFPEAlphabetSize {
+		return "", fmt.Errorf("alphabet must contain between 2 and %d characters", maxFPEAlphabetSize)
+	}
+	return alphabet, nil
+}
+
+// compileFPETemplate compiles the template of a format preserving encryption
+// key. The template is a regular expression that values must match in full,
+// and whose capture groups select the characters that are encrypted.
+func compileFPETemplate(template string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile("^(?:" + template + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %v", err)
+	}
+	if re.NumSubexp() == 0 {
+		return nil, errors.New("template must contain at least one capture group")
+	}
+	return re, nil
+}
+
+// fpeFormat maps the values of a format preserving encryption key to and
+// from the numeral strings encrypted by FF3-1
+type fpeFormat struct {
+	alphabet []rune
+	indexes  map[rune]int
+	template *regexp.Regexp
+}
+
+func newFPEFormat(alphabet, template string) (*fpeFormat, error) {
+	f := &fpeFormat{
+		alphabet: []rune(alphabet),
+		indexes:  make(map[rune]int, len(alphabet)),
+	}
+	for i, r := range f.alphabet {
+		f.indexes[r] = i
+	}
+
+	if template != "" {
+		var err error
+		f.template, err = compileFPETemplate(template)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// numerals returns the numeral string of the characters of the value to be
+// encrypted, along with the rune offsets of these characters in the value
+func (f *fpeFormat) numerals(value string) ([]int, []int, error) {
+	runes := []rune(value)
+
+	var positions []int
+	if f.template == nil {
+		positions = make([]int, len(runes))
+		for i := range runes {
+			positions[i] = i
+		}
+	} else {
+		match := f.template.FindStringSubmatchIndex(value)
+		if match == nil {
+			return nil, nil, errors.New("value does not match the template of the key")
+		}
+
+		// Convert the byte offsets of the capture groups to rune offsets
+		runeOffsets := make(map[int]int, len(runes)+1)
+		offset := 0
+		for i := range value {
+			runeOffsets[i] = offset
+			offset++
+		}
+		runeOffsets[len(value)] = offset
+
+		end := -1
+		for g := 2; g < len(match); g += 2 {
+			start, stop := match[g], match[g+1]
+			if start < 0 {
+				continue
+			}
+			if start < end {
+				return nil, nil, errors.New("template capture groups must not be nested")
+			}
+			for i := runeOffsets[start]; i < runeOffsets[stop]; i++ {
+				positions = append(positions, i)
+			}
+			end = stop
+		}
+	}
+
+	numerals := make([]int, len(positions))
+	for i, pos := range positions {
+		n, ok := f.indexes[runes[pos]]
+		if !ok {
+			return nil, nil, fmt.Errorf("value contains the character %q, which is not in the alphabet of the key", runes[pos])
+		}
+		numerals[i] = n
+	}
+	return numerals, positions, nil
+}
+
+// format returns the value with the characters at the given positions
+// replaced by the characters of the numeral string
+func (f *fpeFormat) format(value string, numerals, positions []int) string {
+	runes := []rune(value)
+	for i, pos := range positions {
+		runes[pos] = f.alphabet[numerals[i]]
+	}
+	return string(runes)
+}
+
+// ff3Cipher implements the FF3-1 format preserving encryption mode defined in
+// NIST SP 800-38G Rev. 1
+type ff3Cipher struct {
+	block  cipher.Block
+	radix  *big.Int
+	minLen int
+	maxLen int
+}
+
+func newFF3Cipher(key []byte, radix int) (*ff3Cipher, error) {
+	if radix < 2 || radix > maxFPEAlphabetSize {
+		return nil, fmt.Errorf("unsupported radix %d", radix)
+	}
+
+	// FF3 uses the key with its bytes reversed
+	block, err := aes.NewCipher(reverseBytes(key))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &ff3Cipher{
+		block: block,
+		radix: big.NewInt(int64(radix)),
+	}
+
+	// The domain must contain at least a million values, and each half of
+	// the input must fit in the 96 bits of the round function input
+	domain := big.NewInt(1)
+	for domain.Cmp(big.NewInt(ff3MinDomainSize)) < 0 {
+		domain.Mul(domain, c.radix)
+		c.minLen++
+	}
+	if c.minLen < 2 {
+		c.minLen = 2
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), 96)
+	half := 0
+	for domain.SetInt64(1); domain.Mul(domain, c.radix).Cmp(limit) <= 0; {
+		half++
+	}
+	c.maxLen = 2 * half
+
+	return c, nil
+}
+
+// Encrypt encrypts the numeral string with the 56-bit tweak
+func (c *ff3Cipher) Encrypt(tweak []byte, x []int) ([]int, error) {
+	return c.crypt(tweak, x, true)
+}
+
+// Decrypt decrypts the numeral string with the 56-bit tweak
+func (c *ff3Cipher) Decrypt(tweak []byte, x []int) ([]int, error) {
+	return c.crypt(tweak, x, false)
+}
+
+func (c *ff3Cipher) crypt(tweak []byte, x []int, encrypt bool) ([]int, error) {
+	if len(tweak) != FF3TweakSize {
+		return nil, fmt.Errorf("tweak must be %d bytes long", FF3TweakSize)
+	}
+	if len(x) < c.minLen || len(x) > c.maxLen {
+		return nil, fmt.Errorf("value must contain between %d and %d characters to encrypt", c.minLen, c.maxLen)
+	}
+
+	// Split the 56-bit tweak into the two 32-bit halves used by FF3
+	tL := []byte{tweak[0], tweak[1], tweak[2], tweak[3] & 0xf0}
+	tR := []byte{tweak[4], tweak[5], tweak[6], tweak[3] << 4}
+
+	return c.feistel(tL, tR, x, encrypt), nil
+}
+
+// feistel runs the Feistel network of FF3 with the given tweak halves
+func (c *ff3Cipher) feistel(tL, tR []byte, x []int, encrypt bool) []int {
+	n := len(x)
+	u := (n + 1) / 2
+	v := n - u
+
+	a := append([]int(nil), x[:u]...)
+	b := append([]int(nil), x[u:]...)
+
+	modU := new(big.Int).Exp(c.radix, big.NewInt(int64(u)), nil)
+	modV := new(big.Int).Exp(c.radix, big.NewInt(int64(v)), nil)
+
+	p := make([]byte, aes.BlockSize)
+	for r := 0; r < ff3Rounds; r++ {
+		i := r
+		if !encrypt {
+			i = ff3Rounds - 1 - r
+		}
+
+		m, mod, w := u, modU, tR
+		if i%2 == 1 {
+			m, mod, w = v, modV, tL
+		}
+
+		// When decrypting, the roles of the halves are swapped
+		src, dst := b, a
+		if !encrypt {
+			src, dst = a, b
+		}
+
+		for j := range p {
+			p[j] = 0
+		}
+		copy(p, w)
+		p[3] ^= byte(i)
+		num := c.numRev(src).Bytes()
+		copy(p[len(p)-len(num):], num)
+
+		s := reverseBytes(p)
+		c.block.Encrypt(s, s)
+		y := new(big.Int).SetBytes(reverseBytes(s))
+
+		z := c.numRev(dst)
+		if encrypt {
+			z.Add(z, y)
+		} else {
+			z.Sub(z, y)
+		}
+		z.Mod(z, mod)
+		out := c.strRev(z, m)
+
+		if encrypt {
+			a, b = b, out
+		} else {
+			b, a = a, out
+		}
+	}
+
+	return append(a, b...)
+}
+
+// numRev returns NUM_radix(REV(x)), the number whose digits in the radix are
+// the numerals of x from least to most significant
+func (c *ff3Cipher) numRev(x []int) *big.Int {
+	n := new(big.Int)
+	for i := len(x) - 1; i >= 0; i-- {
+		n.Mul(n, c.radix)
+		n.Add(n, big.NewInt(int64(x[i])))
+	}
+	return n
+}
+
+// strRev returns REV(STR^m_radix(n)), the m digits of n in the radix from
+// least to most significant
+func (c *ff3Cipher) strRev(n *big.Int, m int) []int {
+	out := make([]int, m)
+	n = new(big.Int).Set(n)
+	digit := new(big.Int)
+	for i := 0; i < m; i++ {
+		n.DivMod(n, c.radix, digit)
+		out[i] = int(digit.Int64())
+	}
+	return out
+}
+
+func reverseBytes(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[len(b)-1-i] = b[i]
+	}
+	return out
+}
+
+// EncodeFPE encrypts the value with FF3-1 using the given key version, so
+// that the result has the same length and format as the value. Only the
+// characters selected by the template of the key are encrypted.
+func (p *Policy) EncodeFPE(ver int, context, tweak []byte, value string) (string, error) {
+	if !p.Type.FPESupported() {
+		return "", errutil.UserError{Err: fmt.Sprintf("format preserving encryption not supported for key type %v", p.Type)}
+	}
+
+	switch {
+	case ver == 0:
+		ver = p.LatestVersion
+	case ver < 0:
+		return "", errutil.UserError{Err: "requested version for encryption is negative"}
+	case ver > p.LatestVersion:
+		return "", errutil.UserError{Err: "requested version for encryption is higher than the latest key version"}
+	case ver < p.MinEncryptionVersion:
+		return "", errutil.UserError{Err: "requested version for encryption is less than the minimum encryption key version"}
+	}
+
+	return p.cryptFPE(ver, context, tweak, value, true)
+}
+
+// DecodeFPE decrypts a value encoded by EncodeFPE with the given key version
+func (p *Policy) DecodeFPE(ver int, context, tweak []byte, value string) (string, error) {
+	if !p.Type.FPESupported() {
+		return "", errutil.UserError{Err: fmt.Sprintf("format preserving encryption not supported for key type %v", p.Type)}
+	}
+
+	switch {
+	case ver == 0:
+		ver = p.LatestVersion
+	case ver < 0:
+		return "", errutil.UserError{Err: "requested version for decryption is negative"}
+	case ver > p.LatestVersion:
+		return "", errutil.UserError{Err: "requested version for decryption is higher than the latest key version"}
+	case p.MinDecryptionVersion > 0 && ver < p.MinDecryptionVersion:
+		return "", errutil.UserError{Err: ErrTooOld}
+	}
+
+	return p.cryptFPE(ver, context, tweak, value, false)
+}
+
+func (p *Policy) cryptFPE(ver int, context, tweak []byte, value string, encrypt bool) (string, error) {
+	if _, ok := p.Keys[strconv.Itoa(ver)]; !ok {
+		return "", errutil.UserError{Err: "invalid key version"}
+	}
+
+	if len(tweak) == 0 {
+		tweak = make([]byte, FF3TweakSize)
+	}
+	if len(tweak) != FF3TweakSize {
+		return "", errutil.UserError{Err: fmt.Sprintf("tweak must be %d bytes long", FF3TweakSize)}
+	}
+
+	alphabet, err := ParseFPEAlphabet(p.FPEAlphabet)
+	if err != nil {
+		return "", errutil.InternalError{Err: err.Error()}
+	}
+	format, err := newFPEFormat(alphabet, p.FPETemplate)
+	if err != nil {
+		return "", errutil.InternalError{Err: err.Error()}
+	}
+
+	key, err := p.DeriveKey(context, ver, 32)
+	if err != nil {
+		return "", err
+	}
+
+	ff3, err := newFF3Cipher(key, len(format.alphabet))
+	if err != nil {
+		return "", errutil.InternalError{Err: err.Error()}
+	}
+
+	numerals, positions, err := format.numerals(value)
+	if err != nil {
+		return "", errutil.UserError{Err: err.Error()}
+	}
+
+	if encrypt {
+		numerals, err = ff3.Encrypt(tweak, numerals)
+	} else {
+		numerals, err = ff3.Decrypt(tweak, numerals)
+	}
+	if err != nil {
+		return "", errutil.UserError{Err: err.Error()}
+	}
+
+	return format.format(value, numerals, positions), nil
+}
@@ -0,0 +1,171 @@
+package keysutil
+
+import (
+	"context"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func numeralsFromString(t *testing.T, s string) []int {
+	t.Helper()
+	out := make([]int, len(s))
+	for i, c := range s {
+		if c < '0' || c > '9' {
+			t.Fatalf("invalid numeral %q", c)
+		}
+		out[i] = int(c - '0')
+	}
+	return out
+}
+
+// TestFF3_Vectors checks the Feistel network shared by FF3 and FF3-1 against
+// the FF3 samples published by NIST, which use a 64-bit tweak split in two
+// 32-bit halves
+func TestFF3_Vectors(t *testing.T) {
+	tests := []struct {
+		key        string
+		tweak      string
+		plaintext  string
+		ciphertext string
+	}{
+		{
+			key:        "EF4359D8D580AA4F7F036D6F04FC6A94",
+			tweak:      "D8E7920AFA330A73",
+			plaintext:  "890121234567890000",
+			ciphertext: "750918814058654607",
+		},
+		{
+			key:        "EF4359D8D580AA4F7F036D6F04FC6A94",
+			tweak:      "9A768A92F60E12D8",
+			plaintext:  "890121234567890000",
+			ciphertext: "018989839189395384",
+		},
+		{
+			key:        "EF4359D8D580AA4F7F036D6F04FC6A94",
+			tweak:      "D8E7920AFA330A73",
+			plaintext:  "89012123456789000000789000000",
+			ciphertext: "48598367162252569629397416226",
+		},
+	}
+
+	for i, test := range tests {
+		key, err := hex.DecodeString(test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tweak, err := hex.DecodeString(test.tweak)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := newFF3Cipher(key, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		plaintext := numeralsFromString(t, test.plaintext)
+		ciphertext := numeralsFromString(t, test.ciphertext)
+
+		out := c.feistel(tweak[:4], tweak[4:], plaintext, true)
+		if !reflect.DeepEqual(out, ciphertext) {
+			t.Fatalf("%d: bad ciphertext: expected %v, got %v", i, ciphertext, out)
+		}
+		out = c.feistel(tweak[:4], tweak[4:], ciphertext, false)
+		if !reflect.DeepEqual(out, plaintext) {
+			t.Fatalf("%d: bad plaintext: expected %v, got %v", i, plaintext, out)
+		}
+	}
+}
+
+func TestFF3_1_Limits(t *testing.T) {
+	key := make([]byte, 32)
+	tweak := make([]byte, FF3TweakSize)
+
+	c, err := newFF3Cipher(key, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.minLen != 6 || c.maxLen != 56 {
+		t.Fatalf("bad limits for radix 10: min %d, max %d", c.minLen, c.maxLen)
+	}
+
+	if _, err := c.Encrypt(tweak, make([]int, 5)); err == nil {
+		t.Fatal("expected error for a value shorter than the minimum length")
+	}
+	if _, err := c.Encrypt(tweak, make([]int, 57)); err == nil {
+		t.Fatal("expected error for a value longer than the maximum length")
+	}
+	if _, err := c.Encrypt(tweak[:6], make([]int, 10)); err == nil {
+		t.Fatal("expected error for a short tweak")
+	}
+}
+
+func TestPolicy_FPE(t *testing.T) {
+	p := &Policy{
+		Name:        "test",
+		Type:        KeyType_FF3_1,
+		FPEAlphabet: DefaultFPEAlphabet,
+		FPETemplate: `(\d{4})-(\d{4})-(\d{4})-(\d{4})`,
+		Keys:        keyEntryMap{},
+	}
+	if err := p.Rotate(context.Background(), &logical.InmemStorage{}); err != nil {
+		t.Fatal(err)
+	}
+
+	value := "4111-1111-1111-1111"
+	tweak := []byte("tweak07")
+
+	encoded, err := p.EncodeFPE(0, nil, tweak, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(encoded) != len(value) || encoded == value {
+		t.Fatalf("bad encoded value %q", encoded)
+	}
+	for _, i := range []int{4, 9, 14} {
+		if encoded[i] != '-' {
+			t.Fatalf("expected the format of the value to be preserved, got %q", encoded)
+		}
+	}
+
+	decoded, err := p.DecodeFPE(0, nil, tweak, encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != value {
+		t.Fatalf("expected %q, got %q", value, decoded)
+	}
+
+	// A different tweak yields a different value
+	other, err := p.EncodeFPE(0, nil, []byte("tweak08"), value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == encoded {
+		t.Fatal("expected different tweaks to yield different values")
+	}
+
+	if _, err := p.EncodeFPE(0, nil, tweak, "4111111111111111"); err == nil {
+		t.Fatal("expected error for a value not matching the template")
+	}
+
+	// Without a template every character is encrypted
+	p.FPETemplate = ""
+	p.FPEAlphabet = "alphanumeric-lower"
+	encoded, err = p.EncodeFPE(0, nil, nil, "vault123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err = p.DecodeFPE(0, nil, nil, encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != "vault123" {
+		t.Fatalf("expected %q, got %q", "vault123", decoded)
+	}
+	if _, err := p.EncodeFPE(0, nil, nil, "Vault123"); err == nil {
+		t.Fatal("expected error for a character outside of the alphabet")
+	}
+}
@@ -51,6 +51,16 @@ type PolicyRequest struct {
 
 	// Whether to allow plaintext backup
 	AllowPlaintextBackup bool
+
+	// Whether to allow rotation of an imported key
+	AllowImportedKeyRotation bool
+
+	// The period after which the key is automatically rotated
+	AutoRotatePeriod time.Duration
+
+	// The alphabet and template of a format preserving encryption key
+	FPEAlphabet string
+	FPETemplate string
 }
 
 type LockManager struct {
@@ -204,6 +214,68 @@ func (lm *LockManager) RestorePolicy(ctx context.Context, storage logical.Storag
 	return nil
 }
 
+// ImportPolicy acquires an exclusive lock on the policy name and creates a
+// policy whose first version is the given key material. See Policy.Import for
+// the supported formats of the key.
+func (lm *LockManager) ImportPolicy(ctx context.Context, req PolicyRequest, key []byte) error {
+	if err := validatePolicyRequest(req); err != nil {
+		return err
+	}
+
+	// Grab the exclusive lock as we'll be modifying disk
+	lock := locksutil.LockForKey(lm.keyLocks, req.Name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if lm.useCache {
+		if _, ok := lm.cache.Load(req.Name); ok {
+			return fmt.Errorf("key %q already exists", req.Name)
+		}
+	}
+
+	existing, err := lm.getPolicyFromStorage(ctx, req.Storage, req.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("key %q already exists", req.Name)
+	}
+
+	p := &Policy{
+		l:                        new(sync.RWMutex),
+		Name:                     req.Name,
+		Type:                     req.KeyType,
+		Derived:                  req.Derived,
+		Exportable:               req.Exportable,
+		AllowPlaintextBackup:     req.AllowPlaintextBackup,
+		Imported:                 true,
+		AllowImportedKeyRotation: req.AllowImportedKeyRotation,
+		AutoRotatePeriod:         req.AutoRotatePeriod,
+		FPEAlphabet:              req.FPEAlphabet,
+		FPETemplate:              req.FPETemplate,
+	}
+	if p.Type.FPESupported() && p.FPEAlphabet == "" {
+		p.FPEAlphabet = DefaultFPEAlphabet
+	}
+
+	if req.Derived {
+		p.KDF = Kdf_hkdf_sha256
+		if req.Convergent {
+			p.ConvergentEncryption = true
+			p.ConvergentVersion = -1
+		}
+	}
+
+	if err := p.Import(ctx, req.Storage, key); err != nil {
+		return err
+	}
+
+	if lm.useCache {
+		lm.cache.Store(req.Name, p)
+	}
+	return nil
+}
+
 func (lm *LockManager) BackupPolicy(ctx context.Context, storage logical.Storage, name string) (string, error) {
 	var p *Policy
 	var err error
@@ -326,34 +398,9 @@ func (lm *LockManager) GetPolicy(ctx context.Context, req PolicyRequest) (retP *
 		// to the user to let them know that their request can't be satisfied
 		// because we don't know if the parameters match.
 
-		switch req.KeyType {
-		case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
-			if req.Convergent && !req.Derived {
-				cleanup()
-				return nil, false, fmt.Errorf("convergent encryption requires derivation to be enabled")
-			}
-
-		case KeyType_ECDSA_P256, KeyType_ECDSA_P384, KeyType_ECDSA_P521:
-			if req.Derived || req.Convergent {
-				cleanup()
-				return nil, false, fmt.Errorf("key derivation and convergent encryption not supported for keys of type %v", req.KeyType)
-			}
-
-		case KeyType_ED25519:
-			if req.Convergent {
-				cleanup()
-				return nil, false, fmt.Errorf("convergent encryption not supported for keys of type %v", req.KeyType)
-			}
-
-		case KeyType_RSA2048, KeyType_RSA4096:
-			if req.Derived || req.Convergent {
-				cleanup()
-				return nil, false, fmt.Errorf("key derivation and convergent encryption not supported for keys of type %v", req.KeyType)
-			}
-
-		default:
+		if err := validatePolicyRequest(req); err != nil {
 			cleanup()
-			return nil, false, fmt.Errorf("unsupported key type %v", req.KeyType)
+			return nil, false, err
 		}
 
 		p = &Policy{
@@ -363,6 +410,12 @@ func (lm *LockManager) GetPolicy(ctx context.Context, req PolicyRequest) (retP *
 			Derived:              req.Derived,
 			Exportable:           req.Exportable,
 			AllowPlaintextBackup: req.AllowPlaintextBackup,
+			AutoRotatePeriod:     req.AutoRotatePeriod,
+			FPEAlphabet:          req.FPEAlphabet,
+			FPETemplate:          req.FPETemplate,
+		}
+		if p.Type.FPESupported() && p.FPEAlphabet == "" {
+			p.FPEAlphabet = DefaultFPEAlphabet
 		}
 
 		if req.Derived {
@@ -476,3 +529,51 @@ func (lm *LockManager) DeletePolicy(ctx context.Context, storage logical.Storage
 func (lm *LockManager) getPolicyFromStorage(ctx context.Context, storage logical.Storage, name string) (*Policy, error) {
 	return LoadPolicy(ctx, storage, "policy/"+name)
 }
+
+// validatePolicyRequest checks that the options of a new policy are supported
+// by its key type
+func validatePolicyRequest(req PolicyRequest) error {
+	if !req.KeyType.FPESupported() && (req.FPEAlphabet != "" || req.FPETemplate != "") {
+		return fmt.Errorf("alphabet and template are only supported for format preserving encryption keys")
+	}
+
+	switch req.KeyType {
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
+		if req.Convergent && !req.Derived {
+			return fmt.Errorf("convergent encryption requires derivation to be enabled")
+		}
+
+	case KeyType_ECDSA_P256, KeyType_ECDSA_P384, KeyType_ECDSA_P521:
+		if req.Derived || req.Convergent {
+			return fmt.Errorf("key derivation and convergent encryption not supported for keys of type %v", req.KeyType)
+		}
+
+	case KeyType_ED25519:
+		if req.Convergent {
+			return fmt.Errorf("convergent encryption not supported for keys of type %v", req.KeyType)
+		}
+
+	case KeyType_RSA2048, KeyType_RSA4096:
+		if req.Derived || req.Convergent {
+			return fmt.Errorf("key derivation and convergent encryption not supported for keys of type %v", req.KeyType)
+		}
+
+	case KeyType_FF3_1:
+		if req.Convergent {
+			return fmt.Errorf("convergent encryption not supported for keys of type %v", req.KeyType)
+		}
+		if _, err := ParseFPEAlphabet(req.FPEAlphabet); err != nil {
+			return err
+		}
+		if req.FPETemplate != "" {
+			if _, err := compileFPETemplate(req.FPETemplate); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("unsupported key type %v", req.KeyType)
+	}
+
+	return nil
+}
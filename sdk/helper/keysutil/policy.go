@@ -13,12 +13,15 @@ import (
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"math/big"
 	"path"
@@ -58,6 +61,7 @@ const (
 	KeyType_ECDSA_P384
 	KeyType_ECDSA_P521
 	KeyType_AES128_GCM96
+	KeyType_FF3_1
 )
 
 const (
@@ -106,6 +110,10 @@ func (kt KeyType) DecryptionSupported() bool {
 	return false
 }
 
+func (kt KeyType) FPESupported() bool {
+	return kt == KeyType_FF3_1
+}
+
 func (kt KeyType) SigningSupported() bool {
 	switch kt {
 	case KeyType_ECDSA_P256, KeyType_ECDSA_P384, KeyType_ECDSA_P521, KeyType_ED25519, KeyType_RSA2048, KeyType_RSA4096:
@@ -124,7 +132,7 @@ func (kt KeyType) HashSignatureInput() bool {
 
 func (kt KeyType) DerivationSupported() bool {
 	switch kt {
-	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305, KeyType_ED25519:
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305, KeyType_ED25519, KeyType_FF3_1:
 		return true
 	}
 	return false
@@ -150,6 +158,8 @@ func (kt KeyType) String() string {
 		return "rsa-2048"
 	case KeyType_RSA4096:
 		return "rsa-4096"
+	case KeyType_FF3_1:
+		return "ff3-1"
 	}
 
 	return "[unknown]"
@@ -371,6 +381,27 @@ type Policy struct {
 	// policy object.
 	StoragePrefix string `json:"storage_prefix"`
 
+	// Imported indicates whether the key material was imported rather than
+	// generated by Vault
+	Imported bool `json:"imported"`
+
+	// AllowImportedKeyRotation allows an imported key to be rotated, in
+	// which case the new versions are generated by Vault
+	AllowImportedKeyRotation bool `json:"allow_imported_key_rotation"`
+
+	// AutoRotatePeriod is the period after which the key is automatically
+	// rotated. A value of zero disables automatic rotation.
+	AutoRotatePeriod time.Duration `json:"auto_rotate_period"`
+
+	// FPEAlphabet is the characters of the values encrypted by a format
+	// preserving encryption key
+	FPEAlphabet string `json:"fpe_alphabet"`
+
+	// FPETemplate is the regular expression whose capture groups select the
+	// characters of the values encrypted by a format preserving encryption
+	// key. If empty, every character of the value is encrypted.
+	FPETemplate string `json:"fpe_template"`
+
 	// versionPrefixCache stores caches of version prefix strings and the split
 	// version template.
 	versionPrefixCache sync.Map
@@ -732,7 +763,7 @@ func (p *Policy) DeriveKey(context []byte, ver, numBytes int) ([]byte, error) {
 		}
 
 		switch p.Type {
-		case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
+		case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305, KeyType_FF3_1:
 			n, err := derBytes.ReadFrom(limReader)
 			if err != nil {
 				return nil, errutil.InternalError{Err: fmt.Sprintf("error reading returned derived bytes: %v", err)}
@@ -779,6 +810,13 @@ func (p *Policy) convergentVersion(ver int) int {
 }
 
 func (p *Policy) Encrypt(ver int, context, nonce []byte, value string) (string, error) {
+	return p.EncryptWithAssociatedData(ver, context, nonce, value, nil)
+}
+
+// EncryptWithAssociatedData encrypts the value like Encrypt, additionally
+// authenticating the given associated data with AEAD key types. The same
+// associated data must be given to decrypt the ciphertext.
+func (p *Policy) EncryptWithAssociatedData(ver int, context, nonce []byte, value string, associatedData []byte) (string, error) {
 	if !p.Type.EncryptionSupported() {
 		return "", errutil.UserError{Err: fmt.Sprintf("message encryption not supported for key type %v", p.Type)}
 	}
@@ -876,8 +914,25 @@ func (p *Policy) Encrypt(ver int, context, nonce []byte, value string) (string,
 				if len(hmacKey) == 0 {
 					return "", errutil.InternalError{Err: fmt.Sprintf("invalid hmac key length of zero")}
 				}
-				nonceHmac := hmac.New(sha256.New, hmacKey)
-				nonceHmac.Write(plaintext)
+				var nonceHmac hash.Hash
+				if len(associatedData) == 0 {
+					nonceHmac = hmac.New(sha256.New, hmacKey)
+					nonceHmac.Write(plaintext)
+				} else {
+					// The associated data is bound into the nonce so that
+					// the same plaintext encrypted with different associated
+					// data never reuses a nonce. A separate HMAC key keeps
+					// these nonces distinct from those derived without
+					// associated data.
+					adKeyHmac := hmac.New(sha256.New, hmacKey)
+					adKeyHmac.Write([]byte("associated_data"))
+					nonceHmac = hmac.New(sha256.New, adKeyHmac.Sum(nil))
+					var plaintextLen [8]byte
+					binary.BigEndian.PutUint64(plaintextLen[:], uint64(len(plaintext)))
+					nonceHmac.Write(plaintextLen[:])
+					nonceHmac.Write(plaintext)
+					nonceHmac.Write(associatedData)
+				}
 				nonceSum := nonceHmac.Sum(nil)
 				nonce = nonceSum[:aead.NonceSize()]
 			default:
@@ -892,7 +947,7 @@ func (p *Policy) Encrypt(ver int, context, nonce []byte, value string) (string,
 		}
 
 		// Encrypt and tag with AEAD
-		ciphertext = aead.Seal(nil, nonce, plaintext, nil)
+		ciphertext = aead.Seal(nil, nonce, plaintext, associatedData)
 
 		// Place the encrypted data after the nonce
 		if !p.ConvergentEncryption || p.convergentVersion(ver) > 1 {
@@ -900,6 +955,9 @@ func (p *Policy) Encrypt(ver int, context, nonce []byte, value string) (string,
 		}
 
 	case KeyType_RSA2048, KeyType_RSA4096:
+		if len(associatedData) != 0 {
+			return "", errutil.UserError{Err: fmt.Sprintf("associated data is not supported for key type %v", p.Type)}
+		}
 		key := p.Keys[strconv.Itoa(ver)].RSAKey
 		ciphertext, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, &key.PublicKey, plaintext, nil)
 		if err != nil {
@@ -920,6 +978,12 @@ func (p *Policy) Encrypt(ver int, context, nonce []byte, value string) (string,
 }
 
 func (p *Policy) Decrypt(context, nonce []byte, value string) (string, error) {
+	return p.DecryptWithAssociatedData(context, nonce, value, nil)
+}
+
+// DecryptWithAssociatedData decrypts the value like Decrypt, verifying that
+// the ciphertext was produced with the given associated data
+func (p *Policy) DecryptWithAssociatedData(context, nonce []byte, value string, associatedData []byte) (string, error) {
 	if !p.Type.DecryptionSupported() {
 		return "", errutil.UserError{Err: fmt.Sprintf("message decryption not supported for key type %v", p.Type)}
 	}
@@ -1028,12 +1092,15 @@ func (p *Policy) Decrypt(context, nonce []byte, value string) (string, error) {
 		}
 
 		// Verify and Decrypt
-		plain, err = aead.Open(nil, nonce, ciphertext, nil)
+		plain, err = aead.Open(nil, nonce, ciphertext, associatedData)
 		if err != nil {
 			return "", errutil.UserError{Err: "invalid ciphertext: unable to decrypt"}
 		}
 
 	case KeyType_RSA2048, KeyType_RSA4096:
+		if len(associatedData) != 0 {
+			return "", errutil.UserError{Err: fmt.Sprintf("associated data is not supported for key type %v", p.Type)}
+		}
 		key := p.Keys[strconv.Itoa(ver)].RSAKey
 		plain, err = rsa.DecryptOAEP(sha256.New(), rand.Reader, key, decoded, nil)
 		if err != nil {
@@ -1412,7 +1479,7 @@ func (p *Policy) Rotate(ctx context.Context, storage logical.Storage) (retErr er
 	entry.HMACKey = hmacKey
 
 	switch p.Type {
-	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305:
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305, KeyType_FF3_1:
 		// Default to 256 bit key
 		numBytes := 32
 		if p.Type == KeyType_AES128_GCM96 {
@@ -1494,6 +1561,173 @@ func (p *Policy) Rotate(ctx context.Context, storage logical.Storage) (retErr er
 	return p.Persist(ctx, storage)
 }
 
+// Import adds the given key material to the policy as its latest version.
+// Symmetric keys are given as raw bytes and asymmetric keys as PKCS #8 DER
+// encoded private keys.
+func (p *Policy) Import(ctx context.Context, storage logical.Storage, key []byte) (retErr error) {
+	priorLatestVersion := p.LatestVersion
+	priorMinDecryptionVersion := p.MinDecryptionVersion
+	var priorKeys keyEntryMap
+
+	if p.Keys != nil {
+		priorKeys = keyEntryMap{}
+		for k, v := range p.Keys {
+			priorKeys[k] = v
+		}
+	}
+
+	defer func() {
+		if retErr != nil {
+			p.LatestVersion = priorLatestVersion
+			p.MinDecryptionVersion = priorMinDecryptionVersion
+			p.Keys = priorKeys
+		}
+	}()
+
+	now := time.Now()
+	entry := KeyEntry{
+		CreationTime:           now,
+		DeprecatedCreationTime: now.Unix(),
+	}
+
+	hmacKey, err := uuid.GenerateRandomBytes(32)
+	if err != nil {
+		return err
+	}
+	entry.HMACKey = hmacKey
+
+	if err := p.parseImportedKey(&entry, key); err != nil {
+		return err
+	}
+
+	if p.ConvergentEncryption {
+		if p.ConvergentVersion == -1 || p.ConvergentVersion > 1 {
+			entry.ConvergentVersion = currentConvergentVersion
+		}
+	}
+
+	if p.Keys == nil {
+		p.Keys = keyEntryMap{}
+	}
+	p.LatestVersion += 1
+	p.Keys[strconv.Itoa(p.LatestVersion)] = entry
+
+	if p.MinDecryptionVersion == 0 {
+		p.MinDecryptionVersion = 1
+	}
+
+	return p.Persist(ctx, storage)
+}
+
+// oidEd25519 is the algorithm identifier of Ed25519 keys, see RFC 8410
+var oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+// pkcs8 is the PKCS #8 PrivateKeyInfo structure, see RFC 5208
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// parseImportedKey fills the key material of the entry from the imported key,
+// checking that it matches the type of the policy
+func (p *Policy) parseImportedKey(entry *KeyEntry, key []byte) error {
+	switch p.Type {
+	case KeyType_AES128_GCM96, KeyType_AES256_GCM96, KeyType_ChaCha20_Poly1305, KeyType_FF3_1:
+		numBytes := 32
+		if p.Type == KeyType_AES128_GCM96 {
+			numBytes = 16
+		}
+		if len(key) != numBytes {
+			return fmt.Errorf("invalid key size %d bytes for key type %s, expected %d bytes", len(key), p.Type, numBytes)
+		}
+		entry.Key = append([]byte(nil), key...)
+		return nil
+
+	case KeyType_ED25519:
+		// Ed25519 keys are parsed directly, since the x509 package does not
+		// support them on every supported version of Go
+		var info pkcs8
+		if rest, err := asn1.Unmarshal(key, &info); err != nil || len(rest) > 0 {
+			return errors.New("failed to parse PKCS #8 private key")
+		}
+		if !info.Algo.Algorithm.Equal(oidEd25519) {
+			return fmt.Errorf("private key is not an ed25519 key")
+		}
+		var seed []byte
+		if rest, err := asn1.Unmarshal(info.PrivateKey, &seed); err != nil || len(rest) > 0 {
+			return errors.New("failed to parse ed25519 private key")
+		}
+		if len(seed) != ed25519.SeedSize {
+			return fmt.Errorf("invalid ed25519 private key size %d bytes", len(seed))
+		}
+		privKey := ed25519.NewKeyFromSeed(seed)
+		entry.Key = privKey
+		entry.FormattedPublicKey = base64.StdEncoding.EncodeToString(privKey.Public().(ed25519.PublicKey))
+		return nil
+	}
+
+	parsedKey, err := x509.ParsePKCS8PrivateKey(key)
+	if err != nil {
+		return errwrap.Wrapf("failed to parse PKCS #8 private key: {{err}}", err)
+	}
+
+	switch p.Type {
+	case KeyType_ECDSA_P256, KeyType_ECDSA_P384, KeyType_ECDSA_P521:
+		privKey, ok := parsedKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return fmt.Errorf("private key is not an ecdsa key")
+		}
+		var curve elliptic.Curve
+		switch p.Type {
+		case KeyType_ECDSA_P384:
+			curve = elliptic.P384()
+		case KeyType_ECDSA_P521:
+			curve = elliptic.P521()
+		default:
+			curve = elliptic.P256()
+		}
+		if privKey.Curve != curve {
+			return fmt.Errorf("invalid curve %s for key type %s", privKey.Curve.Params().Name, p.Type)
+		}
+
+		entry.EC_D = privKey.D
+		entry.EC_X = privKey.X
+		entry.EC_Y = privKey.Y
+		derBytes, err := x509.MarshalPKIXPublicKey(privKey.Public())
+		if err != nil {
+			return errwrap.Wrapf("error marshaling public key: {{err}}", err)
+		}
+		pemBytes := pem.EncodeToMemory(&pem.Block{
+			Type:  "PUBLIC KEY",
+			Bytes: derBytes,
+		})
+		if len(pemBytes) == 0 {
+			return fmt.Errorf("error PEM-encoding public key")
+		}
+		entry.FormattedPublicKey = string(pemBytes)
+
+	case KeyType_RSA2048, KeyType_RSA4096:
+		privKey, ok := parsedKey.(*rsa.PrivateKey)
+		if !ok {
+			return fmt.Errorf("private key is not an rsa key")
+		}
+		bitSize := 2048
+		if p.Type == KeyType_RSA4096 {
+			bitSize = 4096
+		}
+		if privKey.N.BitLen() != bitSize {
+			return fmt.Errorf("invalid key size %d bits for key type %s", privKey.N.BitLen(), p.Type)
+		}
+		entry.RSAKey = privKey
+
+	default:
+		return fmt.Errorf("importing keys of type %s is not supported", p.Type)
+	}
+
+	return nil
+}
+
 func (p *Policy) MigrateKeyToKeysMap() {
 	now := time.Now()
 	p.Keys = keyEntryMap{
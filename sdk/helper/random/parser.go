@@ -0,0 +1,103 @@
+package random
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/errwrap"
+	multierror "github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/vault/sdk/helper/hclutil"
+)
+
+// ParsePolicy parses an HCL policy into a string generator. Policies set the
+// length of the strings and any number of rules:
+//
+//	length = 20
+//
+//	rule "charset" {
+//	  charset = "abcdefghijklmnopqrstuvwxyz"
+//	  min-chars = 1
+//	}
+//
+//	rule "dictionary" {
+//	  words = ["password", "vault"]
+//	}
+func ParsePolicy(raw string) (*StringGenerator, error) {
+	root, err := hcl.Parse(raw)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to parse policy: {{err}}", err)
+	}
+
+	list, ok := root.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, errors.New("failed to parse policy: does not contain a root object")
+	}
+
+	valid := []string{
+		"length",
+		"rule",
+	}
+	if err := hclutil.CheckHCLKeys(list, valid); err != nil {
+		return nil, errwrap.Wrapf("failed to parse policy: {{err}}", err)
+	}
+
+	var length int
+	if o := list.Filter("length"); len(o.Items) > 0 {
+		if len(o.Items) > 1 {
+			return nil, errors.New("failed to parse policy: length is set more than once")
+		}
+		if err := hcl.DecodeObject(&length, o.Items[0].Val); err != nil {
+			return nil, errwrap.Wrapf("failed to parse policy length: {{err}}", err)
+		}
+	}
+
+	var rules Rules
+	if o := list.Filter("rule"); len(o.Items) > 0 {
+		if rules, err = parseRules(o); err != nil {
+			return nil, multierror.Prefix(err, "failed to parse policy rules:")
+		}
+	}
+
+	return NewStringGenerator(length, rules)
+}
+
+func parseRules(list *ast.ObjectList) (Rules, error) {
+	var rules Rules
+	for _, item := range list.Items {
+		if len(item.Keys) == 0 {
+			return nil, fmt.Errorf("rule on line %d is missing its type", item.Val.Pos().Line)
+		}
+		ruleType := item.Keys[0].Token.Value().(string)
+
+		var valid []string
+		var rule interface {
+			Rule
+			init() error
+		}
+		switch ruleType {
+		case "charset":
+			valid = []string{"charset", "min-chars"}
+			rule = &CharsetRule{}
+		case "dictionary":
+			valid = []string{"words"}
+			rule = &DictionaryRule{}
+		default:
+			return nil, fmt.Errorf("unknown rule type %q", ruleType)
+		}
+
+		if err := hclutil.CheckHCLKeys(item.Val, valid); err != nil {
+			return nil, multierror.Prefix(err, fmt.Sprintf("rule %q:", ruleType))
+		}
+		if err := hcl.DecodeObject(rule, item.Val); err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("rule %q: {{err}}", ruleType), err)
+		}
+		if err := rule.init(); err != nil {
+			return nil, errwrap.Wrapf(fmt.Sprintf("rule %q: {{err}}", ruleType), err)
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
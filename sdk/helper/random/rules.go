@@ -0,0 +1,162 @@
+package random
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rule is a constraint that generated and validated strings must satisfy
+type Rule interface {
+	// Check returns an error if the value does not satisfy the rule
+	Check(value []rune) error
+
+	// Type returns the name of the rule as used in policies
+	Type() string
+}
+
+// Rules is a set of rules, all of which must be satisfied
+type Rules []Rule
+
+// Check returns the error of the first rule the value does not satisfy
+func (r Rules) Check(value []rune) error {
+	for _, rule := range r {
+		if err := rule.Check(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CharsetRule requires a minimum number of characters from a charset. The
+// characters of all charset rules of a policy make up the characters that
+// generated strings are drawn from.
+type CharsetRule struct {
+	Charset  string `hcl:"charset"`
+	MinChars int    `hcl:"min-chars"`
+
+	charset []rune
+}
+
+// NewCharsetRule returns a charset rule with the given charset and minimum
+// number of characters from it
+func NewCharsetRule(charset string, minChars int) (*CharsetRule, error) {
+	r := &CharsetRule{
+		Charset:  charset,
+		MinChars: minChars,
+	}
+	if err := r.init(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *CharsetRule) init() error {
+	if !utf8.ValidString(r.Charset) {
+		return errors.New("charset must be valid UTF-8")
+	}
+	r.charset = dedupeRunes([]rune(r.Charset))
+	if len(r.charset) == 0 {
+		return errors.New("charset must not be empty")
+	}
+	if r.MinChars < 0 {
+		return errors.New("min-chars must not be negative")
+	}
+	return nil
+}
+
+// Type returns the name of the rule as used in policies
+func (r *CharsetRule) Type() string {
+	return "charset"
+}
+
+// Check returns an error if the value has fewer than the minimum number of
+// characters from the charset
+func (r *CharsetRule) Check(value []rune) error {
+	if r.MinChars == 0 {
+		return nil
+	}
+
+	count := 0
+	for _, c := range value {
+		if containsRune(r.charset, c) {
+			count++
+			if count >= r.MinChars {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("must contain at least %d of the characters %q", r.MinChars, string(r.charset))
+}
+
+// DictionaryRule rejects values containing any of its words, ignoring case
+type DictionaryRule struct {
+	Words []string `hcl:"words"`
+
+	words []string
+}
+
+// NewDictionaryRule returns a dictionary rule rejecting the given words
+func NewDictionaryRule(words []string) (*DictionaryRule, error) {
+	r := &DictionaryRule{
+		Words: words,
+	}
+	if err := r.init(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *DictionaryRule) init() error {
+	if len(r.Words) == 0 {
+		return errors.New("words must not be empty")
+	}
+	r.words = make([]string, 0, len(r.Words))
+	for _, word := range r.Words {
+		if word == "" {
+			return errors.New("words must not contain empty words")
+		}
+		r.words = append(r.words, strings.ToLower(word))
+	}
+	return nil
+}
+
+// Type returns the name of the rule as used in policies
+func (r *DictionaryRule) Type() string {
+	return "dictionary"
+}
+
+// Check returns an error if the value contains any of the words of the rule
+func (r *DictionaryRule) Check(value []rune) error {
+	lower := strings.ToLower(string(value))
+	for _, word := range r.words {
+		if strings.Contains(lower, word) {
+			return errors.New("must not contain dictionary words")
+		}
+	}
+	return nil
+}
+
+func containsRune(runes []rune, r rune) bool {
+	for _, c := range runes {
+		if c == r {
+			return true
+		}
+	}
+	return false
+}
+
+// dedupeRunes returns the runes without duplicates, preserving their order
+func dedupeRunes(runes []rune) []rune {
+	seen := make(map[rune]struct{}, len(runes))
+	result := make([]rune, 0, len(runes))
+	for _, r := range runes {
+		if _, ok := seen[r]; ok {
+			continue
+		}
+		seen[r] = struct{}{}
+		result = append(result, r)
+	}
+	return result
+}
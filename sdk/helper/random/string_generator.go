@@ -0,0 +1,109 @@
+// Package random generates and validates strings, such as passwords, against
+// policies made of a length and a set of rules.
+package random
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+const (
+	// MaxLength is the maximum length of strings generated by a policy
+	MaxLength = 1024
+
+	// maxGenerateAttempts bounds the number of strings generated before
+	// giving up on one satisfying all of the rules of a policy
+	maxGenerateAttempts = 1000
+)
+
+// StringGenerator generates strings of a fixed length from the characters of
+// its charset rules until one satisfies all of its rules. Strings provided
+// elsewhere, such as user passwords, are validated against the same rules
+// with the length as a minimum.
+type StringGenerator struct {
+	// Length of the generated strings, and minimum length of validated ones
+	Length int
+
+	// Rules the strings must satisfy
+	Rules Rules
+
+	// charset is the union of the characters of the charset rules
+	charset []rune
+}
+
+// NewStringGenerator returns a generator of strings of the given length
+// satisfying the rules. At least one charset rule is required.
+func NewStringGenerator(length int, rules Rules) (*StringGenerator, error) {
+	if length <= 0 {
+		return nil, errors.New("length must be greater than zero")
+	}
+	if length > MaxLength {
+		return nil, fmt.Errorf("length must not be greater than %d", MaxLength)
+	}
+
+	var charset []rune
+	minChars := 0
+	for _, rule := range rules {
+		if r, ok := rule.(*CharsetRule); ok {
+			charset = append(charset, r.charset...)
+			minChars += r.MinChars
+		}
+	}
+	if len(charset) == 0 {
+		return nil, errors.New("at least one charset rule is required")
+	}
+	if minChars > length {
+		return nil, fmt.Errorf("the min-chars of the charset rules add up to %d, more than the length of %d", minChars, length)
+	}
+
+	return &StringGenerator{
+		Length:  length,
+		Rules:   rules,
+		charset: dedupeRunes(charset),
+	}, nil
+}
+
+// Generate returns a random string satisfying all of the rules. Randomness is
+// read from rng, or from crypto/rand if it is nil.
+func (g *StringGenerator) Generate(ctx context.Context, rng io.Reader) (string, error) {
+	if rng == nil {
+		rng = rand.Reader
+	}
+
+	value := make([]rune, g.Length)
+	charsetLen := big.NewInt(int64(len(g.charset)))
+	for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		for i := range value {
+			n, err := rand.Int(rng, charsetLen)
+			if err != nil {
+				return "", err
+			}
+			value[i] = g.charset[n.Int64()]
+		}
+
+		if g.Rules.Check(value) == nil {
+			return string(value), nil
+		}
+	}
+
+	return "", fmt.Errorf("unable to generate a string satisfying the rules after %d attempts", maxGenerateAttempts)
+}
+
+// Validate returns an error if the value is shorter than the length of the
+// generator or does not satisfy all of its rules. Characters outside of the
+// charset rules are allowed.
+func (g *StringGenerator) Validate(value string) error {
+	runes := []rune(value)
+	if len(runes) < g.Length {
+		return fmt.Errorf("must be at least %d characters long", g.Length)
+	}
+	return g.Rules.Check(runes)
+}
@@ -0,0 +1,159 @@
+package random
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	gen, err := ParsePolicy(`
+length = 16
+
+rule "charset" {
+  charset = "abcdefghijklmnopqrstuvwxyz"
+  min-chars = 1
+}
+
+rule "charset" {
+  charset = "0123456789"
+  min-chars = 2
+}
+
+rule "dictionary" {
+  words = ["Vault"]
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gen.Length != 16 {
+		t.Fatalf("bad: length: %d", gen.Length)
+	}
+	if len(gen.Rules) != 3 {
+		t.Fatalf("bad: rules: %#v", gen.Rules)
+	}
+	if len(gen.charset) != 36 {
+		t.Fatalf("bad: charset: %q", string(gen.charset))
+	}
+
+	invalid := map[string]string{
+		"no length":           `rule "charset" { charset = "abc" }`,
+		"no charset rule":     `length = 8`,
+		"too long":            `length = 4096 rule "charset" { charset = "abc" }`,
+		"unknown key":         `length = 8 foo = "bar" rule "charset" { charset = "abc" }`,
+		"unknown rule":        `length = 8 rule "foo" { charset = "abc" }`,
+		"unknown rule key":    `length = 8 rule "charset" { charset = "abc" foo = 1 }`,
+		"empty charset":       `length = 8 rule "charset" { charset = "" }`,
+		"negative min-chars":  `length = 8 rule "charset" { charset = "abc" min-chars = -1 }`,
+		"min-chars exceeded":  `length = 2 rule "charset" { charset = "abc" min-chars = 3 }`,
+		"empty dictionary":    `length = 8 rule "charset" { charset = "abc" } rule "dictionary" { words = [] }`,
+		"missing rule type":   `length = 8 rule { charset = "abc" }`,
+		"invalid hcl":         `length = `,
+		"length set twice":    `length = 8 length = 9 rule "charset" { charset = "abc" }`,
+		"non-integer length":  `length = "foo" rule "charset" { charset = "abc" }`,
+		"non-string charset":  `length = 8 rule "charset" { charset = ["abc"] }`,
+		"non-list dictionary": `length = 8 rule "charset" { charset = "abc" } rule "dictionary" { words = "foo" }`,
+	}
+	for name, raw := range invalid {
+		if _, err := ParsePolicy(raw); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestStringGenerator_Generate(t *testing.T) {
+	lower, err := NewCharsetRule("abc", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digits, err := NewCharsetRule("01", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dictionary, err := NewDictionaryRule([]string{"AAA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, err := NewStringGenerator(10, Rules{lower, digits, dictionary})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		value, err := gen.Generate(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(value) != 10 {
+			t.Fatalf("bad: length: %q", value)
+		}
+		if strings.Trim(value, "abc01") != "" {
+			t.Fatalf("bad: characters: %q", value)
+		}
+		if err := gen.Validate(value); err != nil {
+			t.Fatalf("generated value %q is invalid: %v", value, err)
+		}
+	}
+
+	// Policies that cannot be satisfied fail rather than loop forever
+	dictionary, err = NewDictionaryRule([]string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, err = NewStringGenerator(10, Rules{lower, dictionary})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gen.Generate(context.Background(), nil); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := gen.Generate(ctx, nil); err != context.Canceled {
+		t.Fatalf("expected the context error, got: %v", err)
+	}
+}
+
+func TestStringGenerator_Validate(t *testing.T) {
+	gen, err := ParsePolicy(`
+length = 8
+
+rule "charset" {
+  charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+  min-chars = 1
+}
+
+rule "charset" {
+  charset = "0123456789"
+  min-chars = 1
+}
+
+rule "dictionary" {
+  words = ["password"]
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]bool{
+		"Abcdefg1":    true,
+		"Abcdefg1!é":  true,
+		"Abcdef1":     false,
+		"abcdefg1":    false,
+		"Abcdefgh":    false,
+		"PassWord123": false,
+		"":            false,
+	}
+	for value, valid := range cases {
+		err := gen.Validate(value)
+		if valid && err != nil {
+			t.Fatalf("%q: unexpected error: %v", value, err)
+		}
+		if !valid && err == nil {
+			t.Fatalf("%q: expected an error", value)
+		}
+	}
+}
@@ -100,6 +100,29 @@ type Auth struct {
 
 	// Orphan is set if the token does not have a parent
 	Orphan bool `json:"orphan"`
+
+	// MFARequirement is set by core instead of a token when the login must
+	// be completed with multi-factor authentication at sys/mfa/validate
+	MFARequirement *MFARequirement `json:"mfa_requirement"`
+}
+
+// MFARequirement describes the MFA a login must be validated with before a
+// token is issued. Each constraint must be satisfied by one of its methods.
+type MFARequirement struct {
+	MFARequestID   string                       `json:"mfa_request_id"`
+	MFAConstraints map[string]*MFAConstraintAny `json:"mfa_constraints"`
+}
+
+// MFAConstraintAny is satisfied by any one of its methods
+type MFAConstraintAny struct {
+	Any []*MFAMethodID `json:"any"`
+}
+
+// MFAMethodID identifies an MFA method that can satisfy a constraint
+type MFAMethodID struct {
+	Type         string `json:"type"`
+	Name         string `json:"name"`
+	UsesPasscode bool   `json:"uses_passcode"`
 }
 
 func (a *Auth) GoString() string {
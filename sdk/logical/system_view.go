@@ -3,6 +3,8 @@ package logical
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"time"
 
 	"github.com/hashicorp/vault/sdk/helper/consts"
@@ -64,6 +66,24 @@ type SystemView interface {
 
 	// PluginEnv returns Vault environment information used by plugins
 	PluginEnv(context.Context) (*PluginEnvironment, error)
+
+	// GeneratePasswordFromPolicy generates a password using the named
+	// password policy
+	GeneratePasswordFromPolicy(ctx context.Context, policyName string) (string, error)
+
+	// ValidatePasswordWithPolicy returns an error if the password does not
+	// satisfy the named password policy
+	ValidatePasswordWithPolicy(ctx context.Context, policyName, password string) error
+}
+
+// PasswordPolicy generates passwords and validates them against its rules
+type PasswordPolicy interface {
+	// Generate returns a password satisfying the policy. Randomness is read
+	// from rng, or from a cryptographically secure source if it is nil.
+	Generate(ctx context.Context, rng io.Reader) (string, error)
+
+	// Validate returns an error if the password does not satisfy the policy
+	Validate(password string) error
 }
 
 type ExtendedSystemView interface {
@@ -85,6 +105,7 @@ type StaticSystemView struct {
 	Features            license.Features
 	VaultVersion        string
 	PluginEnvironment   *PluginEnvironment
+	PasswordPolicies    map[string]PasswordPolicy
 }
 
 type noopAuditor struct{}
@@ -156,3 +177,19 @@ func (d StaticSystemView) HasFeature(feature license.Features) bool {
 func (d StaticSystemView) PluginEnv(_ context.Context) (*PluginEnvironment, error) {
 	return d.PluginEnvironment, nil
 }
+
+func (d StaticSystemView) GeneratePasswordFromPolicy(ctx context.Context, policyName string) (string, error) {
+	policy, ok := d.PasswordPolicies[policyName]
+	if !ok {
+		return "", fmt.Errorf("password policy %q not found", policyName)
+	}
+	return policy.Generate(ctx, nil)
+}
+
+func (d StaticSystemView) ValidatePasswordWithPolicy(_ context.Context, policyName, password string) error {
+	policy, ok := d.PasswordPolicies[policyName]
+	if !ok {
+		return fmt.Errorf("password policy %q not found", policyName)
+	}
+	return policy.Validate(password)
+}
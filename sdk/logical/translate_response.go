@@ -39,6 +39,7 @@ func LogicalResponseToHTTPResponse(input *Response) *HTTPResponse {
 			EntityID:         input.Auth.EntityID,
 			TokenType:        input.Auth.TokenType.String(),
 			Orphan:           input.Auth.Orphan,
+			MFARequirement:   input.Auth.MFARequirement,
 		}
 	}
 
@@ -70,6 +71,7 @@ func HTTPResponseToLogicalResponse(input *HTTPResponse) *Response {
 			Metadata:         input.Auth.Metadata,
 			EntityID:         input.Auth.EntityID,
 			Orphan:           input.Auth.Orphan,
+			MFARequirement:   input.Auth.MFARequirement,
 		}
 		logicalResp.Auth.Renewable = input.Auth.Renewable
 		logicalResp.Auth.TTL = time.Second * time.Duration(input.Auth.LeaseDuration)
@@ -108,6 +110,7 @@ type HTTPAuth struct {
 	EntityID         string            `json:"entity_id"`
 	TokenType        string            `json:"token_type"`
 	Orphan           bool              `json:"orphan"`
+	MFARequirement   *MFARequirement   `json:"mfa_requirement,omitempty"`
 }
 
 type HTTPWrapInfo struct {
@@ -101,6 +101,14 @@ func (s *gRPCSystemViewClient) LookupPlugin(_ context.Context, _ string, _ const
 	return nil, fmt.Errorf("cannot call LookupPlugin from a plugin backend")
 }
 
+func (s *gRPCSystemViewClient) GeneratePasswordFromPolicy(_ context.Context, _ string) (string, error) {
+	return "", fmt.Errorf("cannot call GeneratePasswordFromPolicy from a plugin backend")
+}
+
+func (s *gRPCSystemViewClient) ValidatePasswordWithPolicy(_ context.Context, _, _ string) error {
+	return fmt.Errorf("cannot call ValidatePasswordWithPolicy from a plugin backend")
+}
+
 func (s *gRPCSystemViewClient) MlockEnabled() bool {
 	reply, err := s.client.MlockEnabled(context.Background(), &pb.Empty{})
 	if err != nil {
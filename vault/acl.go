@@ -691,6 +691,23 @@ func (c *Core) performPolicyChecks(ctx context.Context, acl *ACL, te *logical.To
 		if !ret.RootPrivs && opts.RootPrivsRequired {
 			return ret
 		}
+		// Requests on paths with a control group are only allowed once they
+		// have been approved
+		if ret.ACLResults.ControlGroup != nil && (req.ControlGroup == nil || !req.ControlGroup.Approved) {
+			ret.Error = multierror.Append(ret.Error, &controlGroupRequiredError{
+				ControlGroup: ret.ACLResults.ControlGroup,
+			})
+			return ret
+		}
+		// Requests on paths whose policy lists MFA methods are only allowed
+		// with valid credentials for each of them
+		if len(ret.ACLResults.MFAMethods) > 0 {
+			if err := c.validateMFAMethods(ctx, ret.ACLResults.MFAMethods, req, inEntity); err != nil {
+				ret.Error = multierror.Append(ret.Error, err)
+				ret.DeniedError = true
+				return ret
+			}
+		}
 	}
 
 	c.performEntPolicyChecks(ctx, acl, te, req, inEntity, opts, ret)
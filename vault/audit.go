@@ -32,6 +32,10 @@ const (
 	// auditTableType is the value we expect to find for the audit table and
 	// corresponding entries
 	auditTableType = "audit"
+
+	// auditFilterOption is the audit entry option holding the expression
+	// that selects the entries the backend logs
+	auditFilterOption = "filter"
 )
 
 var (
@@ -51,6 +55,11 @@ func (c *Core) enableAudit(ctx context.Context, entry *MountEntry, updateStorage
 		return fmt.Errorf("backend path must be specified")
 	}
 
+	filter, err := auditFilter(entry)
+	if err != nil {
+		return err
+	}
+
 	// Update the audit table
 	c.auditLock.Lock()
 	defer c.auditLock.Unlock()
@@ -114,6 +123,7 @@ func (c *Core) enableAudit(ctx context.Context, entry *MountEntry, updateStorage
 
 	if updateStorage {
 		if err := c.persistAudit(ctx, newTable, entry.Local); err != nil {
+			closeAuditBackend(backend)
 			return errors.New("failed to update audit table")
 		}
 	}
@@ -121,7 +131,7 @@ func (c *Core) enableAudit(ctx context.Context, entry *MountEntry, updateStorage
 	c.audit = newTable
 
 	// Register the backend
-	c.auditBroker.Register(entry.Path, backend, view, entry.Local)
+	c.auditBroker.Register(entry.Path, backend, view, entry.Local, filter)
 	if c.logger.IsInfo() {
 		c.logger.Info("enabled audit backend", "path", entry.Path, "type", entry.Type)
 	}
@@ -351,6 +361,7 @@ func (c *Core) setupAudits(ctx context.Context) error {
 	brokerLogger := c.baseLogger.Named("audit")
 	c.AddLogger(brokerLogger)
 	broker := NewAuditBroker(brokerLogger)
+	broker.mountEntry = c.router.MatchingMountEntry
 
 	c.auditLock.Lock()
 	defer c.auditLock.Unlock()
@@ -372,6 +383,12 @@ func (c *Core) setupAudits(ctx context.Context) error {
 			view.setReadOnlyErr(origViewReadOnlyErr)
 		})
 
+		filter, err := auditFilter(entry)
+		if err != nil {
+			c.logger.Error("failed to parse audit entry filter", "path", entry.Path, "error", err)
+			continue
+		}
+
 		// Initialize the backend
 		backend, err := c.newAuditBackend(ctx, entry, view, entry.Options)
 		if err != nil {
@@ -384,7 +401,7 @@ func (c *Core) setupAudits(ctx context.Context) error {
 		}
 
 		// Mount the backend
-		broker.Register(entry.Path, backend, view, entry.Local)
+		broker.Register(entry.Path, backend, view, entry.Local, filter)
 
 		successCount++
 	}
@@ -407,6 +424,9 @@ func (c *Core) teardownAudits() error {
 		for _, entry := range c.audit.Entries {
 			c.removeAuditReloadFunc(entry)
 			removeAuditPathChecker(c, entry)
+			if c.auditBroker != nil {
+				c.auditBroker.Deregister(entry.Path)
+			}
 		}
 	}
 
@@ -445,10 +465,14 @@ func (c *Core) newAuditBackend(ctx context.Context, entry *MountEntry, view logi
 		Location: salt.DefaultLocation,
 	}
 
+	auditLogger := c.baseLogger.Named("audit")
+	c.AddLogger(auditLogger)
+
 	be, err := f(ctx, &audit.BackendConfig{
 		SaltView:   view,
 		SaltConfig: saltConfig,
 		Config:     conf,
+		Logger:     auditLogger.With("path", entry.Path),
 	})
 	if err != nil {
 		return nil, err
@@ -457,9 +481,6 @@ func (c *Core) newAuditBackend(ctx context.Context, entry *MountEntry, view logi
 		return nil, fmt.Errorf("nil backend returned from %q factory function", entry.Type)
 	}
 
-	auditLogger := c.baseLogger.Named("audit")
-	c.AddLogger(auditLogger)
-
 	switch entry.Type {
 	case "file":
 		key := "audit_file|" + entry.Path
@@ -493,11 +514,27 @@ func (c *Core) newAuditBackend(ctx context.Context, entry *MountEntry, view logi
 				auditLogger.Debug("syslog backend options", "path", entry.Path, "facility", entry.Options["facility"], "tag", entry.Options["tag"])
 			}
 		}
+	case "http":
+		if auditLogger.IsDebug() {
+			if entry.Options != nil {
+				auditLogger.Debug("http backend options", "path", entry.Path, "url", entry.Options["url"], "spool_path", entry.Options["spool_path"])
+			}
+		}
 	}
 
 	return be, err
 }
 
+// auditFilter parses the filter expression in the options of the audit
+// entry, returning nil if it has none
+func auditFilter(entry *MountEntry) (*audit.Filter, error) {
+	expr := entry.Options[auditFilterOption]
+	if expr == "" {
+		return nil, nil
+	}
+	return audit.NewFilter(expr)
+}
+
 // defaultAuditTable creates a default audit table
 func defaultAuditTable() *MountTable {
 	table := &MountTable{
@@ -10,6 +10,7 @@ import (
 	log "github.com/hashicorp/go-hclog"
 	multierror "github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/namespace"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
@@ -17,6 +18,7 @@ type backendEntry struct {
 	backend audit.Backend
 	view    *BarrierView
 	local   bool
+	filter  *audit.Filter
 }
 
 // AuditBroker is used to provide a single ingest interface to auditable
@@ -25,6 +27,10 @@ type AuditBroker struct {
 	sync.RWMutex
 	backends map[string]backendEntry
 	logger   log.Logger
+
+	// mountEntry resolves the mount of a request path, which is used by
+	// backend filters since requests are logged before they are routed
+	mountEntry func(context.Context, string) *MountEntry
 }
 
 // NewAuditBroker creates a new audit broker
@@ -36,14 +42,16 @@ func NewAuditBroker(log log.Logger) *AuditBroker {
 	return b
 }
 
-// Register is used to add new audit backend to the broker
-func (a *AuditBroker) Register(name string, b audit.Backend, v *BarrierView, local bool) {
+// Register is used to add new audit backend to the broker. If filter is not
+// nil the backend only logs the entries that match it.
+func (a *AuditBroker) Register(name string, b audit.Backend, v *BarrierView, local bool, filter *audit.Filter) {
 	a.Lock()
 	defer a.Unlock()
 	a.backends[name] = backendEntry{
 		backend: b,
 		view:    v,
 		local:   local,
+		filter:  filter,
 	}
 }
 
@@ -51,9 +59,20 @@ func (a *AuditBroker) Register(name string, b audit.Backend, v *BarrierView, loc
 func (a *AuditBroker) Deregister(name string) {
 	a.Lock()
 	defer a.Unlock()
+	if be, ok := a.backends[name]; ok {
+		closeAuditBackend(be.backend)
+	}
 	delete(a.backends, name)
 }
 
+// closeAuditBackend releases the resources held by backends that implement
+// audit.Closer
+func closeAuditBackend(b audit.Backend) {
+	if closer, ok := b.(audit.Closer); ok {
+		closer.Close()
+	}
+}
+
 // IsRegistered is used to check if a given audit backend is registered
 func (a *AuditBroker) IsRegistered(name string) bool {
 	a.RLock()
@@ -122,7 +141,19 @@ func (a *AuditBroker) LogRequest(ctx context.Context, in *logical.LogInput, head
 
 	// Ensure at least one backend logs
 	anyLogged := false
+	filtered := 0
+	var fields map[string]string
 	for name, be := range a.backends {
+		if be.filter != nil {
+			if fields == nil {
+				fields = a.filterFields(ctx, "request", in)
+			}
+			if !be.filter.Evaluate(fields) {
+				filtered++
+				continue
+			}
+		}
+
 		in.Request.Headers = nil
 		transHeaders, thErr := headersConfig.ApplyConfig(ctx, headers, be.backend.GetHash)
 		if thErr != nil {
@@ -140,7 +171,8 @@ func (a *AuditBroker) LogRequest(ctx context.Context, in *logical.LogInput, head
 			anyLogged = true
 		}
 	}
-	if !anyLogged && len(a.backends) > 0 {
+	// Entries that every backend filtered out do not need to be logged
+	if !anyLogged && len(a.backends) > filtered {
 		retErr = multierror.Append(retErr, fmt.Errorf("no audit backend succeeded in logging the request"))
 	}
 
@@ -178,7 +210,19 @@ func (a *AuditBroker) LogResponse(ctx context.Context, in *logical.LogInput, hea
 
 	// Ensure at least one backend logs
 	anyLogged := false
+	filtered := 0
+	var fields map[string]string
 	for name, be := range a.backends {
+		if be.filter != nil {
+			if fields == nil {
+				fields = a.filterFields(ctx, "response", in)
+			}
+			if !be.filter.Evaluate(fields) {
+				filtered++
+				continue
+			}
+		}
+
 		in.Request.Headers = nil
 		transHeaders, thErr := headersConfig.ApplyConfig(ctx, headers, be.backend.GetHash)
 		if thErr != nil {
@@ -196,7 +240,8 @@ func (a *AuditBroker) LogResponse(ctx context.Context, in *logical.LogInput, hea
 			anyLogged = true
 		}
 	}
-	if !anyLogged && len(a.backends) > 0 {
+	// Entries that every backend filtered out do not need to be logged
+	if !anyLogged && len(a.backends) > filtered {
 		retErr = multierror.Append(retErr, fmt.Errorf("no audit backend succeeded in logging the response"))
 	}
 
@@ -212,3 +257,39 @@ func (a *AuditBroker) Invalidate(ctx context.Context, key string) {
 		be.backend.Invalidate(ctx)
 	}
 }
+
+// filterFields returns the values of the filter selectors for the entry.
+// Whether a request succeeds is only known once it has been handled, so the
+// error selector is left unset for request entries that have not failed yet.
+func (a *AuditBroker) filterFields(ctx context.Context, entryType string, in *logical.LogInput) map[string]string {
+	fields := map[string]string{
+		audit.FilterSelectorType:      entryType,
+		audit.FilterSelectorOperation: string(in.Request.Operation),
+		audit.FilterSelectorPath:      in.Request.Path,
+		audit.FilterSelectorMountType: in.Request.MountType,
+	}
+	if entryType == "response" {
+		fields[audit.FilterSelectorError] = "false"
+	}
+
+	if ns, err := namespace.FromContext(ctx); err == nil {
+		fields[audit.FilterSelectorNamespace] = ns.Path
+	}
+
+	if a.mountEntry != nil {
+		if me := a.mountEntry(ctx, in.Request.Path); me != nil {
+			mountPath := me.Path
+			if me.Table == credentialTableType {
+				mountPath = credentialRoutePrefix + mountPath
+			}
+			fields[audit.FilterSelectorMountType] = me.Type
+			fields[audit.FilterSelectorMountPath] = mountPath
+		}
+	}
+
+	if in.OuterErr != nil || (in.Response != nil && in.Response.IsError()) {
+		fields[audit.FilterSelectorError] = "true"
+	}
+
+	return fields
+}
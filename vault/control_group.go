@@ -0,0 +1,403 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/helper/jsonutil"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/helper/wrapping"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// controlGroupSubPath is the sub-path of the system barrier view where the
+	// state of control group requests is stored, keyed by the accessor of
+	// their control group token. Unlike the cubbyhole of the token, it cannot
+	// be reached by any token.
+	controlGroupSubPath = "control-group/"
+
+	// defaultControlGroupTTL is the TTL of control group tokens whose
+	// control_group stanza does not set one
+	defaultControlGroupTTL = 24 * time.Hour
+)
+
+var (
+	// errControlGroupNeedsApproval is returned when unwrapping a control
+	// group token whose request has not been approved yet
+	errControlGroupNeedsApproval = errors.New("request needs further approval")
+
+	// errControlGroupNotRequester is returned when a token other than the
+	// one of the requester unwraps a control group token on its behalf
+	errControlGroupNotRequester = errors.New("control group requests can only be unwrapped by the requester")
+)
+
+// controlGroupRequiredError is returned by the policy checks when a request
+// is allowed, but only once it has been approved by the given control group
+type controlGroupRequiredError struct {
+	ControlGroup *ControlGroup
+}
+
+func (e *controlGroupRequiredError) Error() string {
+	return "request requires control group approval"
+}
+
+// controlGroupEntry is the state of a control group request. It holds the
+// original request, which is replayed once the request has been approved.
+type controlGroupEntry struct {
+	RequestID      string                 `json:"request_id"`
+	Operation      logical.Operation      `json:"operation"`
+	Path           string                 `json:"path"`
+	Data           map[string]interface{} `json:"data"`
+	ClientToken    string                 `json:"client_token"`
+	EntityID       string                 `json:"entity_id"`
+	NamespaceID    string                 `json:"namespace_id"`
+	RequestTime    time.Time              `json:"request_time"`
+	Factors        []*ControlGroupFactor  `json:"factors"`
+	Authorizations []*controlGroupAuthz   `json:"authorizations"`
+}
+
+// controlGroupAuthz is an approval of a control group request
+type controlGroupAuthz struct {
+	EntityID          string    `json:"entity_id"`
+	Factors           []string  `json:"factors"`
+	AuthorizationTime time.Time `json:"authorization_time"`
+}
+
+// approved returns whether every factor has received the number of
+// approvals it requires from the recorded authorizations
+func (e *controlGroupEntry) approved() bool {
+	if len(e.Factors) == 0 {
+		return false
+	}
+
+	for _, factor := range e.Factors {
+		if factor.Identity == nil {
+			return false
+		}
+
+		required := factor.Identity.ApprovalsRequired
+		if required < 1 {
+			required = 1
+		}
+
+		approvers := make(map[string]struct{})
+		for _, authz := range e.Authorizations {
+			if authz.EntityID == "" || authz.EntityID == e.EntityID {
+				continue
+			}
+			if strutil.StrListContains(authz.Factors, factor.Name) {
+				approvers[authz.EntityID] = struct{}{}
+			}
+		}
+		if len(approvers) < required {
+			return false
+		}
+	}
+	return true
+}
+
+// checkErrControlGroupTokenNeedsCreated returns whether the error returned by
+// the policy checks means a control group request has to be created
+func checkErrControlGroupTokenNeedsCreated(err error) bool {
+	return errwrap.ContainsType(err, new(controlGroupRequiredError))
+}
+
+// checkNeedsCG creates a control group request if the token check failed
+// only because the request requires control group approval. The caller gets
+// back a wrapping response holding the control group token, which it can
+// unwrap once the request has been approved.
+func checkNeedsCG(ctx context.Context, c *Core, req *logical.Request, auth *logical.Auth, ctErr error, nonHMACReqDataKeys []string) (error, *logical.Response, *logical.Auth, error) {
+	cgErr, ok := errwrap.GetType(ctErr, new(controlGroupRequiredError)).(*controlGroupRequiredError)
+	if !ok || cgErr == nil {
+		return nil, nil, nil, nil
+	}
+
+	logInput := &logical.LogInput{
+		Auth:               auth,
+		Request:            req,
+		NonHMACReqDataKeys: nonHMACReqDataKeys,
+	}
+	if err := c.auditBroker.LogRequest(ctx, logInput, c.auditedHeaders); err != nil {
+		c.logger.Error("failed to audit request", "path", req.Path, "error", err)
+		return ErrInternalError, nil, nil, nil
+	}
+
+	resp, err := c.createControlGroupRequest(ctx, req, auth, cgErr.ControlGroup)
+	if err != nil {
+		c.logger.Error("failed to create control group request", "path", req.Path, "error", err)
+		return ErrInternalError, nil, nil, nil
+	}
+
+	return nil, resp, auth, nil
+}
+
+// createControlGroupRequest stores the request in the cubbyhole of a new
+// control group token and returns the wrapping response for it
+func (c *Core) createControlGroupRequest(ctx context.Context, req *logical.Request, auth *logical.Auth, cg *ControlGroup) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := cg.TTL
+	if ttl == 0 {
+		ttl = defaultControlGroupTTL
+	}
+
+	creationTime := time.Now()
+	te := logical.TokenEntry{
+		Path:           req.Path,
+		Policies:       []string{controlGroupPolicyName},
+		CreationTime:   creationTime.Unix(),
+		TTL:            ttl,
+		ExplicitMaxTTL: ttl,
+		NamespaceID:    ns.ID,
+	}
+	if err := c.tokenStore.create(ctx, &te); err != nil {
+		return nil, errwrap.Wrapf("failed to create control group token: {{err}}", err)
+	}
+
+	entry := &controlGroupEntry{
+		RequestID:   req.ID,
+		Operation:   req.Operation,
+		Path:        req.Path,
+		Data:        req.Data,
+		ClientToken: req.ClientToken,
+		NamespaceID: ns.ID,
+		RequestTime: creationTime,
+		Factors:     cg.Factors,
+	}
+	if auth != nil {
+		entry.EntityID = auth.EntityID
+	}
+
+	if err := c.storeControlGroupEntry(ctx, te.Accessor, entry); err != nil {
+		c.tokenStore.revokeOrphan(ctx, te.ID)
+		return nil, err
+	}
+
+	cubbyReq := &logical.Request{
+		Operation:   logical.CreateOperation,
+		Path:        "cubbyhole/wrapinfo",
+		ClientToken: te.ID,
+		Data: map[string]interface{}{
+			"creation_ttl":  ttl,
+			"creation_time": creationTime,
+			"creation_path": req.Path,
+		},
+	}
+	cubbyReq.SetTokenEntry(&te)
+	cubbyResp, err := c.router.Route(ctx, cubbyReq)
+	if err == nil && cubbyResp != nil && cubbyResp.IsError() {
+		err = cubbyResp.Error()
+	}
+	if err != nil {
+		c.tokenStore.revokeOrphan(ctx, te.ID)
+		return nil, errwrap.Wrapf("failed to store wrapping information: {{err}}", err)
+	}
+
+	cgAuth := &logical.Auth{
+		ClientToken: te.ID,
+		Policies:    []string{controlGroupPolicyName},
+		LeaseOptions: logical.LeaseOptions{
+			TTL:       ttl,
+			Renewable: false,
+		},
+	}
+	if err := c.expiration.RegisterAuth(ctx, &te, cgAuth); err != nil {
+		c.tokenStore.revokeOrphan(ctx, te.ID)
+		return nil, errwrap.Wrapf("failed to register control group token lease: {{err}}", err)
+	}
+
+	return &logical.Response{
+		WrapInfo: &wrapping.ResponseWrapInfo{
+			TTL:             ttl,
+			Token:           te.ID,
+			Accessor:        te.Accessor,
+			CreationTime:    creationTime,
+			CreationPath:    req.Path,
+			WrappedEntityID: entry.EntityID,
+		},
+	}, nil
+}
+
+// controlGroupToken looks up the control group token with the given
+// accessor, returning a nil entry if it does not exist
+func (c *Core) controlGroupToken(ctx context.Context, accessor string) (*logical.TokenEntry, error) {
+	aEntry, err := c.tokenStore.lookupByAccessor(ctx, accessor, false, false)
+	if err != nil {
+		return nil, err
+	}
+	if aEntry.TokenID == "" {
+		return nil, nil
+	}
+
+	te, err := c.tokenStore.Lookup(ctx, aEntry.TokenID)
+	if err != nil {
+		return nil, err
+	}
+	if te == nil {
+		return nil, nil
+	}
+	if len(te.Policies) != 1 || te.Policies[0] != controlGroupPolicyName {
+		return nil, &logical.StatusBadRequest{Err: "accessor does not belong to a control group token"}
+	}
+
+	return te, nil
+}
+
+// loadControlGroupEntry reads the state of the control group request of the
+// token with the given accessor
+func (c *Core) loadControlGroupEntry(ctx context.Context, accessor string) (*controlGroupEntry, error) {
+	if accessor == "" {
+		return nil, nil
+	}
+
+	view := c.systemBarrierView.SubView(controlGroupSubPath)
+	raw, err := view.Get(ctx, accessor)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to read control group request: {{err}}", err)
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	var entry controlGroupEntry
+	if err := jsonutil.DecodeJSON(raw.Value, &entry); err != nil {
+		return nil, errwrap.Wrapf("failed to decode control group request: {{err}}", err)
+	}
+	return &entry, nil
+}
+
+// storeControlGroupEntry writes the state of the control group request of
+// the token with the given accessor
+func (c *Core) storeControlGroupEntry(ctx context.Context, accessor string, entry *controlGroupEntry) error {
+	if accessor == "" {
+		return errors.New("missing control group token accessor")
+	}
+
+	raw, err := logical.StorageEntryJSON(accessor, entry)
+	if err != nil {
+		return errwrap.Wrapf("failed to encode control group request: {{err}}", err)
+	}
+
+	view := c.systemBarrierView.SubView(controlGroupSubPath)
+	if err := view.Put(ctx, raw); err != nil {
+		return errwrap.Wrapf("failed to store control group request: {{err}}", err)
+	}
+	return nil
+}
+
+// deleteControlGroupEntry removes the state of the control group request of
+// the token with the given accessor, once the token has been revoked
+func (c *Core) deleteControlGroupEntry(ctx context.Context, accessor string) error {
+	if accessor == "" {
+		return nil
+	}
+
+	view := c.systemBarrierView.SubView(controlGroupSubPath)
+	if err := view.Delete(ctx, accessor); err != nil {
+		return errwrap.Wrapf("failed to delete control group request: {{err}}", err)
+	}
+	return nil
+}
+
+// controlGroupUnwrap replays the request of an approved control group
+// request and returns its response, marshaled like a wrapped response. The
+// control group token is revoked once it has been unwrapped. When a third
+// party unwraps the token, it must be the requester.
+func controlGroupUnwrap(ctx context.Context, b *SystemBackend, req *logical.Request, token string, thirdParty bool) (string, error) {
+	b.controlGroupLock.Lock()
+	defer b.controlGroupLock.Unlock()
+
+	te, err := b.Core.tokenStore.Lookup(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	if te == nil {
+		return "", logical.ErrPermissionDenied
+	}
+
+	entry, err := b.Core.loadControlGroupEntry(ctx, te.Accessor)
+	if err != nil {
+		return "", err
+	}
+	if entry == nil {
+		return "no control group request found", ErrInternalError
+	}
+	if thirdParty {
+		var isRequester bool
+		switch {
+		case entry.EntityID != "":
+			isRequester = req.EntityID == entry.EntityID
+		default:
+			isRequester = req.ClientToken == entry.ClientToken
+		}
+		if !isRequester {
+			return errControlGroupNotRequester.Error(), logical.ErrPermissionDenied
+		}
+	}
+	if !entry.approved() {
+		return errControlGroupNeedsApproval.Error(), logical.ErrInvalidRequest
+	}
+
+	ns, err := NamespaceByID(ctx, entry.NamespaceID, b.Core)
+	if err != nil {
+		return "", err
+	}
+	if ns == nil {
+		return "", namespace.ErrNoNamespace
+	}
+
+	cg := &logical.ControlGroup{
+		RequestTime: entry.RequestTime,
+		Approved:    true,
+		NamespaceID: entry.NamespaceID,
+	}
+	for _, authz := range entry.Authorizations {
+		cg.Authorizations = append(cg.Authorizations, &logical.Authz{
+			AuthorizationTime: authz.AuthorizationTime,
+		})
+	}
+
+	replayReq := &logical.Request{
+		ID:           entry.RequestID,
+		Operation:    entry.Operation,
+		Path:         entry.Path,
+		Data:         entry.Data,
+		ClientToken:  entry.ClientToken,
+		ControlGroup: cg,
+	}
+
+	resp, err := b.Core.handleCancelableRequest(namespace.ContextWithNamespace(ctx, ns), ns, replayReq)
+	if err != nil {
+		if resp != nil && resp.IsError() {
+			return resp.Error().Error(), err
+		}
+		return "", err
+	}
+
+	// The request has been served, so the token can't be unwrapped again
+	if err := b.Core.tokenStore.revokeOrphan(ctx, te.ID); err != nil {
+		return "", errwrap.Wrapf("failed to revoke control group token: {{err}}", err)
+	}
+
+	if resp == nil {
+		return "", nil
+	}
+
+	httpResponse := logical.LogicalResponseToHTTPResponse(resp)
+	httpResponse.RequestID = entry.RequestID
+	marshaledResponse, err := json.Marshal(httpResponse)
+	if err != nil {
+		return "", errwrap.Wrapf(fmt.Sprintf("failed to marshal response of control group request for %q: {{err}}", entry.Path), err)
+	}
+
+	return string(marshaledResponse), nil
+}
@@ -43,6 +43,7 @@ import (
 	"github.com/hashicorp/vault/sdk/physical"
 	"github.com/hashicorp/vault/shamir"
 	"github.com/hashicorp/vault/vault/cluster"
+	"github.com/hashicorp/vault/vault/quotas"
 	"github.com/hashicorp/vault/vault/seal"
 	shamirseal "github.com/hashicorp/vault/vault/seal/shamir"
 )
@@ -382,6 +383,9 @@ type Core struct {
 	// CORS Information
 	corsConfig *CORSConfig
 
+	// quotaManager enforces request quotas such as rate limits
+	quotaManager *quotas.Manager
+
 	// The active set of upstream cluster addresses; stored via the Echo
 	// mechanism, loaded by the balancer
 	atomicPrimaryClusterAddrs *atomic.Value
@@ -450,6 +454,10 @@ type Core struct {
 	// Telemetry objects
 	metricsHelper *metricsutil.MetricsHelper
 
+	// usageGaugePeriod is the interval at which inventory gauges are
+	// collected, or negative if they are not collected
+	usageGaugePeriod time.Duration
+
 	// Stores request counters
 	counters counters
 
@@ -535,6 +543,11 @@ type CoreConfig struct {
 	// Telemetry objects
 	MetricsHelper *metricsutil.MetricsHelper
 
+	// UsageGaugePeriod is the interval at which inventory gauges are
+	// collected. Zero uses the default of 10 minutes and a negative value
+	// disables their collection.
+	UsageGaugePeriod time.Duration
+
 	CounterSyncInterval time.Duration
 }
 
@@ -570,6 +583,7 @@ func (c *CoreConfig) Clone() *CoreConfig {
 		DisableIndexing:           c.DisableIndexing,
 		AllLoggers:                c.AllLoggers,
 		CounterSyncInterval:       c.CounterSyncInterval,
+		UsageGaugePeriod:          c.UsageGaugePeriod,
 	}
 }
 
@@ -590,6 +604,9 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 	if conf.DefaultLeaseTTL > conf.MaxLeaseTTL {
 		return nil, fmt.Errorf("cannot have DefaultLeaseTTL larger than MaxLeaseTTL")
 	}
+	if conf.UsageGaugePeriod == 0 {
+		conf.UsageGaugePeriod = defaultUsageGaugePeriod
+	}
 
 	// Validate the advertise addr if its given to us
 	if conf.RedirectAddr != "" {
@@ -652,6 +669,7 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 		neverBecomeActive:            new(uint32),
 		clusterLeaderParams:          new(atomic.Value),
 		metricsHelper:                conf.MetricsHelper,
+		usageGaugePeriod:             conf.UsageGaugePeriod,
 		counters: counters{
 			requests:     new(uint64),
 			syncInterval: syncInterval,
@@ -659,6 +677,7 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 	}
 
 	atomic.StoreUint32(c.sealed, 1)
+	metrics.SetGauge([]string{"core", "unsealed"}, 0)
 	c.allLoggers = append(c.allLoggers, c.logger)
 
 	c.router.logger = c.logger.Named("router")
@@ -687,6 +706,10 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 		Enabled: new(uint32),
 	}
 
+	quotasLogger := c.baseLogger.Named("quotas")
+	c.allLoggers = append(c.allLoggers, quotasLogger)
+	c.quotaManager = quotas.NewManager(quotasLogger)
+
 	if c.seal == nil {
 		c.seal = NewDefaultSeal(shamirseal.NewSeal(c.logger.Named("shamir")))
 	}
@@ -1232,6 +1255,7 @@ func (c *Core) unsealInternal(ctx context.Context, masterKey []byte) (bool, erro
 
 	// Success!
 	atomic.StoreUint32(c.sealed, 0)
+	metrics.SetGauge([]string{"core", "unsealed"}, 1)
 
 	if c.logger.IsInfo() {
 		c.logger.Info("vault is unsealed")
@@ -1448,6 +1472,7 @@ func (c *Core) sealInternalWithOptions(grabStateLock, keepHALock, shutdownRaft b
 	if swapped := atomic.CompareAndSwapUint32(c.sealed, 0, 1); !swapped {
 		return nil
 	}
+	metrics.SetGauge([]string{"core", "unsealed"}, 0)
 
 	c.logger.Info("marked as sealed")
 
@@ -1599,6 +1624,9 @@ func (s standardUnsealStrategy) unseal(ctx context.Context, logger log.Logger, c
 	if err := c.loadCORSConfig(ctx); err != nil {
 		return err
 	}
+	if err := c.setupQuotas(ctx); err != nil {
+		return err
+	}
 	if err := c.loadCurrentRequestCounters(ctx, time.Now()); err != nil {
 		return err
 	}
@@ -1706,6 +1734,9 @@ func (c *Core) postUnseal(ctx context.Context, ctxCancelFunc context.CancelFunc,
 
 	c.metricsCh = make(chan struct{})
 	go c.emitMetrics(c.metricsCh)
+	if c.usageGaugePeriod > 0 {
+		go c.emitUsageGauges(c.metricsCh)
+	}
 
 	// This is intentionally the last block in this function. We want to allow
 	// writes just before allowing client requests, to ensure everything has
@@ -1762,6 +1793,7 @@ func (c *Core) preSeal() error {
 	if err := c.stopRollback(); err != nil {
 		result = multierror.Append(result, errwrap.Wrapf("error stopping rollback: {{err}}", err))
 	}
+	c.teardownQuotas()
 	if err := c.unloadMounts(context.Background()); err != nil {
 		result = multierror.Append(result, errwrap.Wrapf("error unloading mounts: {{err}}", err))
 	}
@@ -0,0 +1,201 @@
+package vault
+
+import (
+	"context"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/metricsutil"
+	"github.com/hashicorp/vault/helper/namespace"
+)
+
+const (
+	// defaultUsageGaugePeriod is the default interval at which inventory
+	// gauges are collected
+	defaultUsageGaugePeriod = 10 * time.Minute
+)
+
+// usageGaugeSnapshot holds what collecting the inventory gauges needs from
+// the core, so that storage can be scanned without holding the state lock
+type usageGaugeSnapshot struct {
+	// ctx is the active context, which is canceled on seal and step-down
+	ctx context.Context
+
+	namespaces    []*namespace.Namespace
+	mounts        []*MountEntry
+	tokenStore    *TokenStore
+	identityStore *IdentityStore
+	policyStore   *PolicyStore
+	expiration    *ExpirationManager
+}
+
+// emitUsageGauges periodically collects and emits gauges describing the
+// inventory of the active node, such as the number of tokens, leases,
+// entities and policies, until stopCh is closed. Unlike the metrics emitted
+// by emitMetrics, collecting these gauges requires scanning storage, so it
+// happens much less frequently.
+func (c *Core) emitUsageGauges(stopCh chan struct{}) {
+	ticker := time.NewTicker(c.usageGaugePeriod)
+	defer ticker.Stop()
+
+	for {
+		if stopped := grabLockOrStop(c.stateLock.RLock, c.stateLock.RUnlock, stopCh); stopped {
+			return
+		}
+		snapshot := c.usageGaugeSnapshot()
+		c.stateLock.RUnlock()
+
+		// Storage is scanned outside of the state lock so that sealing and
+		// stepping down are not blocked, and the scan stops once the active
+		// context is canceled
+		if snapshot != nil {
+			c.collectUsageGauges(snapshot)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// usageGaugeSnapshot returns what collecting the inventory gauges needs, or
+// nil if this node is not the active node. The state lock must be held.
+func (c *Core) usageGaugeSnapshot() *usageGaugeSnapshot {
+	if c.standby || c.perfStandby || c.activeContext == nil {
+		return nil
+	}
+
+	snapshot := &usageGaugeSnapshot{
+		ctx:           c.activeContext,
+		namespaces:    c.collectNamespaces(),
+		tokenStore:    c.tokenStore,
+		identityStore: c.identityStore,
+		policyStore:   c.policyStore,
+		expiration:    c.expiration,
+	}
+
+	c.mountsLock.RLock()
+	if c.mounts != nil {
+		snapshot.mounts = make([]*MountEntry, len(c.mounts.Entries))
+		copy(snapshot.mounts, c.mounts.Entries)
+	}
+	c.mountsLock.RUnlock()
+
+	return snapshot
+}
+
+// collectUsageGauges emits the inventory gauges of every namespace. Errors are
+// logged so that a failure to collect one gauge does not prevent the others
+// from being emitted.
+func (c *Core) collectUsageGauges(s *usageGaugeSnapshot) {
+	defer metrics.MeasureSince([]string{"core", "usage_gauges"}, time.Now())
+
+	metrics.SetGauge([]string{"core", "unsealed"}, 1)
+
+	for _, ns := range s.namespaces {
+		if s.ctx.Err() != nil {
+			return
+		}
+
+		nsCtx := namespace.ContextWithNamespace(s.ctx, ns)
+		labels := []metrics.Label{metricsutil.NamespaceLabel(ns)}
+
+		if count, err := countTokens(nsCtx, s.tokenStore, ns); err != nil {
+			c.logger.Error("failed to count tokens", "namespace", ns.Path, "error", err)
+		} else {
+			metrics.SetGaugeWithLabels([]string{"token", "count"}, float32(count), labels)
+		}
+
+		if count, err := countEntities(s.identityStore, ns); err != nil {
+			c.logger.Error("failed to count entities", "namespace", ns.Path, "error", err)
+		} else {
+			metrics.SetGaugeWithLabels([]string{"identity", "entity", "count"}, float32(count), labels)
+		}
+
+		if count, err := countPolicies(nsCtx, s.policyStore); err != nil {
+			c.logger.Error("failed to count policies", "namespace", ns.Path, "error", err)
+		} else {
+			metrics.SetGaugeWithLabels([]string{"policy", "count"}, float32(count), labels)
+		}
+	}
+
+	emitLeaseCountGauges(s.expiration, s.mounts)
+}
+
+// countTokens returns the number of service tokens stored in the namespace.
+// Batch tokens are not stored and so are not counted.
+func countTokens(ctx context.Context, ts *TokenStore, ns *namespace.Namespace) (int, error) {
+	if ts == nil {
+		return 0, nil
+	}
+
+	keys, err := ts.idView(ns).List(ctx, "")
+	if err != nil {
+		return 0, errwrap.Wrapf("failed to list tokens: {{err}}", err)
+	}
+	return len(keys), nil
+}
+
+// countEntities returns the number of identity entities in the namespace
+func countEntities(is *IdentityStore, ns *namespace.Namespace) (int, error) {
+	if is == nil {
+		return 0, nil
+	}
+
+	txn := is.db.Txn(false)
+	iter, err := txn.Get(entitiesTable, "namespace_id", ns.ID)
+	if err != nil {
+		return 0, errwrap.Wrapf("failed to fetch iterator for entities in memdb: {{err}}", err)
+	}
+
+	var count int
+	for raw := iter.Next(); raw != nil; raw = iter.Next() {
+		count++
+	}
+	return count, nil
+}
+
+// countPolicies returns the number of ACL policies in the namespace of the
+// context
+func countPolicies(ctx context.Context, ps *PolicyStore) (int, error) {
+	if ps == nil {
+		return 0, nil
+	}
+
+	policies, err := ps.ListPolicies(ctx, PolicyTypeACL)
+	if err != nil {
+		return 0, err
+	}
+	return len(policies), nil
+}
+
+// emitLeaseCountGauges emits the number of secret leases of each secrets
+// engine, including engines without any leases so that the gauges of mounts
+// whose leases were revoked drop to zero
+func emitLeaseCountGauges(m *ExpirationManager, mounts []*MountEntry) {
+	if m == nil {
+		return
+	}
+
+	counts := m.LeaseCounts("")
+	for _, entry := range mounts {
+		// These mounts never issue leases
+		switch entry.Type {
+		case systemMountType, identityMountType, cubbyholeMountType:
+			continue
+		}
+
+		ns := entry.Namespace()
+		if ns == nil {
+			ns = namespace.RootNamespace
+		}
+		metrics.SetGaugeWithLabels([]string{"expire", "leases", "count"}, float32(counts[ns.Path+entry.Path]), []metrics.Label{
+			metricsutil.NamespaceLabel(ns),
+			{Name: "mount_point", Value: entry.Path},
+			{Name: "mount_type", Value: entry.Type},
+		})
+	}
+}
@@ -116,3 +116,9 @@ func (c *Core) removeAllPerfStandbySecondaries() {}
 func (c *Core) perfStandbyClusterHandler() (*replication.Cluster, *cache.Cache, chan struct{}, error) {
 	return nil, cache.New(2*cluster.HeartbeatInterval, 1*time.Second), make(chan struct{}), nil
 }
+
+// collectNamespaces returns the namespaces for which inventory gauges are
+// collected
+func (c *Core) collectNamespaces() []*namespace.Namespace {
+	return []*namespace.Namespace{namespace.RootNamespace}
+}
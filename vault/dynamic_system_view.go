@@ -223,6 +223,38 @@ func (d dynamicSystemView) LookupPlugin(ctx context.Context, name string, plugin
 	return r, nil
 }
 
+// GeneratePasswordFromPolicy generates a password using the named password
+// policy.
+func (d dynamicSystemView) GeneratePasswordFromPolicy(ctx context.Context, policyName string) (string, error) {
+	if d.core == nil {
+		return "", fmt.Errorf("system view core is nil")
+	}
+	policy, err := d.core.passwordPolicy(ctx, policyName)
+	if err != nil {
+		return "", err
+	}
+	if policy == nil {
+		return "", fmt.Errorf("password policy %q not found", policyName)
+	}
+	return policy.Generate(ctx, nil)
+}
+
+// ValidatePasswordWithPolicy returns an error if the password does not satisfy
+// the named password policy.
+func (d dynamicSystemView) ValidatePasswordWithPolicy(ctx context.Context, policyName, password string) error {
+	if d.core == nil {
+		return fmt.Errorf("system view core is nil")
+	}
+	policy, err := d.core.passwordPolicy(ctx, policyName)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		return fmt.Errorf("password policy %q not found", policyName)
+	}
+	return policy.Validate(password)
+}
+
 // MlockEnabled returns the configuration setting for enabling mlock on plugins.
 func (d dynamicSystemView) MlockEnabled() bool {
 	return d.core.enableMlock
@@ -55,6 +55,10 @@ const (
 type pendingInfo struct {
 	exportLeaseTimes *leaseEntry
 	timer            *time.Timer
+
+	// mountPath is the full path of the mount a secret lease was issued by,
+	// under which it is counted in leaseCounts
+	mountPath string
 }
 
 // ExpirationManager is used by the Core to manage leases. Secrets
@@ -72,6 +76,17 @@ type ExpirationManager struct {
 	pending     map[string]pendingInfo
 	pendingLock sync.RWMutex
 
+	// leaseCounts holds the number of pending secret leases per mount,
+	// keyed by the full mount path, and leaseReservations the number of
+	// secret leases being registered that were already allowed by the lease
+	// count quotas. Both are protected by pendingLock.
+	leaseCounts       map[string]int
+	leaseReservations map[string]int
+
+	// leaseQuotaLock makes checking the lease count quotas and reserving a
+	// slot for the lease being registered a single step
+	leaseQuotaLock sync.Mutex
+
 	tidyLock *int32
 
 	restoreMode        *int32
@@ -136,14 +151,16 @@ func expireLeaseStrategyRevoke(ctx context.Context, m *ExpirationManager, le *le
 // using a given view, and uses the provided router for revocation.
 func NewExpirationManager(c *Core, view *BarrierView, e ExpireLeaseStrategy, logger log.Logger) *ExpirationManager {
 	exp := &ExpirationManager{
-		core:       c,
-		router:     c.router,
-		idView:     view.SubView(leaseViewPrefix),
-		tokenView:  view.SubView(tokenViewPrefix),
-		tokenStore: c.tokenStore,
-		logger:     logger,
-		pending:    make(map[string]pendingInfo),
-		tidyLock:   new(int32),
+		core:              c,
+		router:            c.router,
+		idView:            view.SubView(leaseViewPrefix),
+		tokenView:         view.SubView(tokenViewPrefix),
+		tokenStore:        c.tokenStore,
+		logger:            logger,
+		pending:           make(map[string]pendingInfo),
+		leaseCounts:       make(map[string]int),
+		leaseReservations: make(map[string]int),
+		tidyLock:          new(int32),
 
 		// new instances of the expiration manager will go immediately into
 		// restore mode
@@ -234,10 +251,7 @@ func (m *ExpirationManager) invalidate(key string) {
 		// Clear from the pending expiration
 		leaseID := strings.TrimPrefix(key, leaseViewPrefix)
 		m.pendingLock.Lock()
-		if pending, ok := m.pending[leaseID]; ok {
-			pending.timer.Stop()
-			delete(m.pending, leaseID)
-		}
+		m.removePendingInternal(leaseID)
 		m.pendingLock.Unlock()
 	}
 }
@@ -552,6 +566,7 @@ func (m *ExpirationManager) Stop() error {
 		pending.timer.Stop()
 	}
 	m.pending = make(map[string]pendingInfo)
+	m.leaseCounts = make(map[string]int)
 	m.pendingLock.Unlock()
 
 	if m.inRestoreMode() {
@@ -648,10 +663,7 @@ func (m *ExpirationManager) revokeCommon(ctx context.Context, leaseID string, fo
 
 	// Clear the expiration handler
 	m.pendingLock.Lock()
-	if pending, ok := m.pending[leaseID]; ok {
-		pending.timer.Stop()
-		delete(m.pending, leaseID)
-	}
+	m.removePendingInternal(leaseID)
 	m.pendingLock.Unlock()
 
 	if m.logger.IsInfo() && !skipToken && m.logLeaseExpirations {
@@ -1103,6 +1115,15 @@ func (m *ExpirationManager) Register(ctx context.Context, req *logical.Request,
 		}
 	}()
 
+	// Enforce lease count quotas; if the quota has been reached, the secret
+	// the backend generated is revoked above. The reserved slot is released
+	// once the lease is counted as pending or registering it failed.
+	release, err := m.reserveLease(ctx, req.Path)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
 	// If the token is a batch token, we want to constrain the maximum lifetime
 	// by the token's lifetime
 	if te.Type == logical.TokenTypeBatch {
@@ -1309,8 +1330,7 @@ func (m *ExpirationManager) updatePendingInternal(le *leaseEntry, leaseTotal tim
 		// if the timer happened to exist, stop the time and delete it from the
 		// pending timers.
 		if ok {
-			pending.timer.Stop()
-			delete(m.pending, le.LeaseID)
+			m.removePendingInternal(le.LeaseID)
 		}
 		return
 	}
@@ -1325,6 +1345,13 @@ func (m *ExpirationManager) updatePendingInternal(le *leaseEntry, leaseTotal tim
 		pending = pendingInfo{
 			timer: timer,
 		}
+
+		if le.Secret != nil {
+			pending.mountPath = m.router.MatchingMount(m.leaseContext(le), le.Path)
+			if pending.mountPath != "" {
+				m.leaseCounts[pending.mountPath]++
+			}
+		}
 	}
 
 	// Extend the timer by the lease total
@@ -1333,6 +1360,103 @@ func (m *ExpirationManager) updatePendingInternal(le *leaseEntry, leaseTotal tim
 	m.pending[le.LeaseID] = pending
 }
 
+// removePendingInternal stops the timer of a pending lease and forgets it; do
+// not call this without a write lock on m.pending
+func (m *ExpirationManager) removePendingInternal(leaseID string) {
+	pending, ok := m.pending[leaseID]
+	if !ok {
+		return
+	}
+
+	pending.timer.Stop()
+	delete(m.pending, leaseID)
+
+	if pending.mountPath != "" {
+		m.leaseCounts[pending.mountPath]--
+		if m.leaseCounts[pending.mountPath] <= 0 {
+			delete(m.leaseCounts, pending.mountPath)
+		}
+	}
+}
+
+// reserveLease applies the lease count quotas to a secret lease being
+// registered for the given request path and, if they allow it, reserves a
+// slot for the lease that counts against the quotas until the returned
+// function is called
+func (m *ExpirationManager) reserveLease(ctx context.Context, reqPath string) (func(), error) {
+	m.leaseQuotaLock.Lock()
+	defer m.leaseQuotaLock.Unlock()
+
+	if err := m.core.applyLeaseCountQuota(ctx, reqPath); err != nil {
+		return nil, err
+	}
+
+	mountPath := m.router.MatchingMount(ctx, reqPath)
+	if mountPath == "" {
+		return func() {}, nil
+	}
+
+	m.pendingLock.Lock()
+	m.leaseReservations[mountPath]++
+	m.pendingLock.Unlock()
+
+	return func() {
+		m.pendingLock.Lock()
+		defer m.pendingLock.Unlock()
+
+		m.leaseReservations[mountPath]--
+		if m.leaseReservations[mountPath] <= 0 {
+			delete(m.leaseReservations, mountPath)
+		}
+	}, nil
+}
+
+// leaseContext returns a context carrying the namespace of the lease, for
+// looking up the mount it belongs to
+func (m *ExpirationManager) leaseContext(le *leaseEntry) context.Context {
+	if le.namespace == nil {
+		return namespace.RootContext(nil)
+	}
+	return namespace.ContextWithNamespace(context.Background(), le.namespace)
+}
+
+// LeaseCounts returns the number of secret leases per mount, keyed by the
+// full path of the mount, for the mounts under the given prefix
+func (m *ExpirationManager) LeaseCounts(prefix string) map[string]int {
+	m.pendingLock.RLock()
+	defer m.pendingLock.RUnlock()
+
+	counts := make(map[string]int, len(m.leaseCounts))
+	for mountPath, count := range m.leaseCounts {
+		if strings.HasPrefix(mountPath, prefix) {
+			counts[mountPath] = count
+		}
+	}
+	return counts
+}
+
+// leaseCount returns the number of secret leases, including the ones being
+// registered, under the given namespace or, if mountPath is set, under the
+// given mount of that namespace
+func (m *ExpirationManager) leaseCount(nsPath, mountPath string) int {
+	m.pendingLock.RLock()
+	defer m.pendingLock.RUnlock()
+
+	if mountPath != "" {
+		return m.leaseCounts[nsPath+mountPath] + m.leaseReservations[nsPath+mountPath]
+	}
+
+	var total int
+	for _, counts := range []map[string]int{m.leaseCounts, m.leaseReservations} {
+		for path, count := range counts {
+			if strings.HasPrefix(path, nsPath) {
+				total += count
+			}
+		}
+	}
+	return total
+}
+
 // revokeEntry is used to attempt revocation of an internal entry
 func (m *ExpirationManager) revokeEntry(ctx context.Context, le *leaseEntry) error {
 	// Revocation of login tokens is special since we can by-pass the
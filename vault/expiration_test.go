@@ -13,6 +13,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/hashicorp/errwrap"
 	log "github.com/hashicorp/go-hclog"
 	uuid "github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/helper/namespace"
@@ -21,6 +22,7 @@ import (
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/hashicorp/vault/sdk/physical"
 	"github.com/hashicorp/vault/sdk/physical/inmem"
+	"github.com/hashicorp/vault/vault/quotas"
 )
 
 var (
@@ -481,6 +483,89 @@ func TestExpiration_Register(t *testing.T) {
 	}
 }
 
+func TestExpiration_Register_LeaseCountQuota(t *testing.T) {
+	exp := mockExpiration(t)
+	noop := &NoopBackend{}
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "logical/")
+	meUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = exp.router.Mount(noop, "prod/aws/", &MountEntry{Path: "prod/aws/", Type: "noop", UUID: meUUID, Accessor: "noop-accessor", namespace: namespace.RootNamespace}, view)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := namespace.RootContext(nil)
+	if err := exp.core.quotaManager.SetLeaseCountQuota(ctx, quotas.NewLeaseCountQuota("aws", "", "prod/aws/", 5)); err != nil {
+		t.Fatal(err)
+	}
+
+	register := func() error {
+		req := &logical.Request{
+			Operation:   logical.ReadOperation,
+			Path:        "prod/aws/foo",
+			ClientToken: "foobar",
+		}
+		req.SetTokenEntry(&logical.TokenEntry{ID: "foobar", NamespaceID: "root"})
+		resp := &logical.Response{
+			Secret: &logical.Secret{
+				LeaseOptions: logical.LeaseOptions{
+					TTL: time.Hour,
+				},
+			},
+		}
+		_, err := exp.Register(ctx, req, resp)
+		return err
+	}
+
+	for exp.inRestoreMode() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Leases registered concurrently must not exceed the quota
+	var wg sync.WaitGroup
+	var registered int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch err := register(); {
+			case err == nil:
+				atomic.AddInt32(&registered, 1)
+			case !errwrap.Contains(err, quotas.ErrLeaseCountQuotaExceeded.Error()):
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if registered != 5 {
+		t.Fatalf("expected 5 leases to be registered, got %d", registered)
+	}
+	if count := exp.leaseCount("", "prod/aws/"); count != 5 {
+		t.Fatalf("expected a lease count of 5, got %d", count)
+	}
+	if len(exp.leaseReservations) != 0 {
+		t.Fatalf("expected no lease reservations to be left, got %v", exp.leaseReservations)
+	}
+
+	// While leases are being restored, the quota cannot be enforced
+	if err := exp.core.quotaManager.SetLeaseCountQuota(ctx, quotas.NewLeaseCountQuota("aws", "", "prod/aws/", 10)); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(exp.restoreMode, 1)
+	err = register()
+	atomic.StoreInt32(exp.restoreMode, 0)
+	if err == nil || !errwrap.Contains(err, quotas.ErrLeaseCountQuotaExceeded.Error()) {
+		t.Fatalf("expected the lease to be rejected while restoring, got %v", err)
+	}
+	if err := register(); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestExpiration_RegisterAuth(t *testing.T) {
 	exp := mockExpiration(t)
 	root, err := exp.tokenStore.rootToken(context.Background())
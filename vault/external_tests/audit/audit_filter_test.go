@@ -0,0 +1,158 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/audit"
+	auditFile "github.com/hashicorp/vault/builtin/audit/file"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/vault"
+)
+
+// auditPaths returns the request paths of the entries of the given type in
+// the audit file
+func auditPaths(t *testing.T, path, entryType string) map[string]bool {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	paths := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var entry struct {
+			Type    string `json:"type"`
+			Request struct {
+				Path string `json:"path"`
+			} `json:"request"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Type == entryType {
+			paths[entry.Request.Path] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestAudit_Filter(t *testing.T) {
+	coreConfig := &vault.CoreConfig{
+		AuditBackends: map[string]audit.Factory{
+			"file": auditFile.Factory,
+		},
+	}
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	core := cluster.Cores[0].Core
+	vault.TestWaitActive(t, core)
+	client := cluster.Cores[0].Client
+
+	dir, err := ioutil.TempDir("", "vault-test_audit_filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	allPath := filepath.Join(dir, "all.log")
+	filteredPath := filepath.Join(dir, "filtered.log")
+
+	// Invalid filters are rejected
+	err = client.Sys().EnableAuditWithOptions("invalid", &api.EnableAuditOptions{
+		Type: "file",
+		Options: map[string]string{
+			"file_path": filepath.Join(dir, "invalid.log"),
+			"filter":    `mount_type == `,
+		},
+	})
+	if err == nil {
+		t.Fatal("expected an error enabling an audit device with an invalid filter")
+	}
+
+	if err := client.Sys().EnableAuditWithOptions("all", &api.EnableAuditOptions{
+		Type: "file",
+		Options: map[string]string{
+			"file_path": allPath,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Sys().EnableAuditWithOptions("filtered", &api.EnableAuditOptions{
+		Type: "file",
+		Options: map[string]string{
+			"file_path": filteredPath,
+			"filter":    `mount_type != "kv" or error == true`,
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Logical().Write("secret/foo", map[string]interface{}{
+		"value": "bar",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failed requests match the filter even on kv mounts
+	badClient, err := client.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	badClient.SetToken("invalid")
+	if _, err := badClient.Logical().Read("secret/denied"); err == nil {
+		t.Fatal("expected an error reading with an invalid token")
+	}
+
+	if _, err := client.Sys().ListMounts(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entryType := range []string{"request", "response"} {
+		all := auditPaths(t, allPath, entryType)
+		if !all["secret/foo"] || !all["sys/mounts"] || !all["secret/denied"] {
+			t.Fatalf("expected all %s entries to be logged, got %v", entryType, all)
+		}
+
+		filtered := auditPaths(t, filteredPath, entryType)
+		if !filtered["sys/mounts"] || !filtered["secret/denied"] {
+			t.Fatalf("expected sys and failed %s entries to be logged, got %v", entryType, filtered)
+		}
+	}
+
+	// Whether a request fails is not known when it is logged, so requests
+	// to kv mounts are logged in case they fail, but successful responses
+	// are filtered out
+	if !auditPaths(t, filteredPath, "request")["secret/foo"] {
+		t.Fatal("expected the kv request to be logged")
+	}
+	if auditPaths(t, filteredPath, "response")["secret/foo"] {
+		t.Fatal("expected the successful kv response to be filtered out")
+	}
+
+	// Requests succeed when every audit device filters out their entries
+	if err := client.Sys().DisableAudit("all"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Logical().Write("secret/foo", map[string]interface{}{
+		"value": "baz",
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
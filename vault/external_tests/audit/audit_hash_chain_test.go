@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/audit"
+	auditFile "github.com/hashicorp/vault/builtin/audit/file"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestAudit_HashChain(t *testing.T) {
+	coreConfig := &vault.CoreConfig{
+		AuditBackends: map[string]audit.Factory{
+			"file": auditFile.Factory,
+		},
+	}
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	core := cluster.Cores[0].Core
+	vault.TestWaitActive(t, core)
+	client := cluster.Cores[0].Client
+
+	dir, err := ioutil.TempDir("", "vault-test_audit_hash_chain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "audit.log")
+	if err := client.Sys().EnableAuditWithOptions("chained", &api.EnableAuditOptions{
+		Type: "file",
+		Options: map[string]string{
+			"file_path":  logPath,
+			"hash_chain": "true",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.Logical().Write("secret/foo", map[string]interface{}{
+			"value": i,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Read the log before verifying it, since the requests made to verify
+	// entries are themselves audited
+	data, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := audit.NewChainVerifier(func(data string) (string, error) {
+		return client.Sys().AuditHash("chained", data)
+	})
+
+	var entries int
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		entries++
+		issue, err := verifier.Verify(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if issue != nil {
+			t.Fatalf("entry %d: %s", entries, issue.Message)
+		}
+	}
+	if entries < 6 {
+		t.Fatalf("expected at least 6 entries, got %d", entries)
+	}
+}
@@ -0,0 +1,216 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	credUserpass "github.com/hashicorp/vault/builtin/credential/userpass"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestPolicy_ControlGroup(t *testing.T) {
+	requesterPolicy := `
+path "secret/prod/*" {
+	capabilities = ["read"]
+	control_group = {
+		factor "approvers" {
+			identity {
+				group_names = ["approvers"]
+				approvals = 2
+			}
+		}
+	}
+}
+`
+
+	approverPolicy := `
+path "sys/control-group/authorize" {
+	capabilities = ["update"]
+}
+`
+
+	coreConfig := &vault.CoreConfig{
+		CredentialBackends: map[string]logical.Factory{
+			"userpass": credUserpass.Factory,
+		},
+	}
+	cluster := vault.NewTestCluster(t, coreConfig, &vault.TestClusterOptions{
+		HandlerFunc: vaulthttp.Handler,
+	})
+	cluster.Start()
+	defer cluster.Cleanup()
+
+	core := cluster.Cores[0].Core
+	vault.TestWaitActive(t, core)
+	client := cluster.Cores[0].Client
+
+	if err := client.Sys().PutPolicy("requester", requesterPolicy); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Sys().PutPolicy("approver", approverPolicy); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Sys().EnableAuthWithOptions("userpass", &api.EnableAuthOptions{
+		Type: "userpass",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Logical().Write("secret/prod/db", map[string]interface{}{
+		"password": "hunter2",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Log in each user to create their entity, returning a client for them
+	login := func(name, policies string) (*api.Client, string) {
+		t.Helper()
+
+		if _, err := client.Logical().Write("auth/userpass/users/"+name, map[string]interface{}{
+			"password": "password",
+			"policies": policies,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		userClient, err := client.Clone()
+		if err != nil {
+			t.Fatal(err)
+		}
+		secret, err := userClient.Logical().Write("auth/userpass/login/"+name, map[string]interface{}{
+			"password": "password",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		userClient.SetToken(secret.Auth.ClientToken)
+		return userClient, secret.Auth.EntityID
+	}
+
+	bob, _ := login("bob", "requester")
+	alice, aliceEntityID := login("alice", "")
+	carol, carolEntityID := login("carol", "")
+	dave, _ := login("dave", "approver")
+
+	if _, err := client.Logical().Write("identity/group", map[string]interface{}{
+		"name":              "approvers",
+		"policies":          "approver",
+		"member_entity_ids": []string{aliceEntityID, carolEntityID},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reading the secret returns a wrapping token rather than the secret
+	secret, err := bob.Logical().Read("secret/prod/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == nil || secret.WrapInfo == nil || secret.WrapInfo.Token == "" || secret.WrapInfo.Accessor == "" {
+		t.Fatalf("expected a wrapped response, got %#v", secret)
+	}
+	if secret.Data != nil {
+		t.Fatalf("expected no data in the wrapped response, got %#v", secret.Data)
+	}
+	wrapInfo := secret.WrapInfo
+
+	// The secret cannot be unwrapped until the request has been approved
+	_, err = bob.Logical().Unwrap(wrapInfo.Token)
+	if err == nil || !strings.Contains(err.Error(), "request needs further approval") {
+		t.Fatalf("expected an approval error, got %v", err)
+	}
+
+	authorize := func(c *api.Client) (bool, error) {
+		secret, err := c.Logical().Write("sys/control-group/authorize", map[string]interface{}{
+			"accessor": wrapInfo.Accessor,
+		})
+		if err != nil {
+			return false, err
+		}
+		return secret.Data["approved"].(bool), nil
+	}
+
+	// Members of other groups cannot authorize the request
+	if _, err := authorize(dave); err == nil {
+		t.Fatal("expected an error authorizing as a non-member")
+	}
+
+	// Authorizing twice counts as a single approval
+	for i := 0; i < 2; i++ {
+		approved, err := authorize(alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if approved {
+			t.Fatal("request should not be approved yet")
+		}
+	}
+
+	status, err := bob.Logical().Write("sys/control-group/request", map[string]interface{}{
+		"accessor": wrapInfo.Accessor,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Data["approved"].(bool) || status.Data["request_path"] != "secret/prod/db" {
+		t.Fatalf("bad status: %#v", status.Data)
+	}
+	authorizations := status.Data["authorizations"].([]interface{})
+	if len(authorizations) != 1 || authorizations[0].(map[string]interface{})["entity_id"] != aliceEntityID {
+		t.Fatalf("bad authorizations: %#v", authorizations)
+	}
+
+	if _, err := bob.Logical().Unwrap(wrapInfo.Token); err == nil {
+		t.Fatal("expected an error unwrapping before approval")
+	}
+
+	// The control group token cannot reach the state of its request
+	cgClient, err := client.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cgClient.SetToken(wrapInfo.Token)
+	if _, err := cgClient.Logical().Write("cubbyhole/control-group", map[string]interface{}{
+		"approved": true,
+	}); err == nil {
+		t.Fatal("expected an error writing to the cubbyhole of the control group token")
+	}
+	if _, err := cgClient.Logical().Unwrap(""); err == nil || !strings.Contains(err.Error(), "request needs further approval") {
+		t.Fatalf("expected an approval error, got %v", err)
+	}
+
+	approved, err := authorize(carol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !approved {
+		t.Fatal("request should have been approved")
+	}
+
+	// Only the requester can unwrap the token on its own behalf
+	if _, err := alice.Logical().Unwrap(wrapInfo.Token); err == nil || !strings.Contains(err.Error(), "can only be unwrapped by the requester") {
+		t.Fatalf("expected an error unwrapping as another entity, got %v", err)
+	}
+
+	secret, err = bob.Logical().Unwrap(wrapInfo.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == nil || secret.Data["password"] != "hunter2" {
+		t.Fatalf("bad unwrapped secret: %#v", secret)
+	}
+
+	// The control group token can only be unwrapped once
+	if _, err := bob.Logical().Unwrap(wrapInfo.Token); err == nil {
+		t.Fatal("expected an error unwrapping a second time")
+	}
+
+	// Root tokens are not subject to control groups
+	secret, err = client.Logical().Read("secret/prod/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == nil || secret.WrapInfo != nil || secret.Data["password"] != "hunter2" {
+		t.Fatalf("bad secret: %#v", secret)
+	}
+}
@@ -577,6 +577,22 @@ func (i *IdentityStore) pathOIDCDeleteKey(ctx context.Context, req *logical.Requ
 		return logical.ErrorResponse(errorMessage), logical.ErrInvalidRequest
 	}
 
+	// or by a client of the OIDC providers
+	clientsReferencingTargetKeyName, err := namesReferencing(ctx, req.Storage, clientPath,
+		func() interface{} { return new(client) },
+		func(obj interface{}) bool { return obj.(*client).Key == targetKeyName })
+	if err != nil {
+		i.oidcLock.Unlock()
+		return nil, err
+	}
+
+	if len(clientsReferencingTargetKeyName) > 0 {
+		errorMessage := fmt.Sprintf("unable to delete key %q because it is currently referenced by these clients: %s",
+			targetKeyName, strings.Join(clientsReferencingTargetKeyName, ", "))
+		i.oidcLock.Unlock()
+		return logical.ErrorResponse(errorMessage), logical.ErrInvalidRequest
+	}
+
 	// key can safely be deleted now
 	err = req.Storage.Delete(ctx, namedKeyConfigPath+targetKeyName)
 	if err != nil {
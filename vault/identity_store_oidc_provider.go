@@ -0,0 +1,1653 @@
+package vault
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/identity"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/base62"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/patrickmn/go-cache"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// assignment grants entities, directly or through their groups, access to
+// the clients that reference it
+type assignment struct {
+	EntityIDs []string `json:"entity_ids"`
+	GroupIDs  []string `json:"group_ids"`
+}
+
+// scope is a set of claims, populated from a template, that clients may
+// request from a provider
+type scope struct {
+	Template    string `json:"template"`
+	Description string `json:"description"`
+}
+
+// client is an OIDC relying party that may obtain tokens from the providers
+// that allow it
+type client struct {
+	name           string
+	RedirectURIs   []string      `json:"redirect_uris"`
+	Assignments    []string      `json:"assignments"`
+	Key            string        `json:"key"`
+	IDTokenTTL     time.Duration `json:"id_token_ttl"`
+	AccessTokenTTL time.Duration `json:"access_token_ttl"`
+	ClientType     string        `json:"client_type"`
+	ClientID       string        `json:"client_id"`
+	ClientSecret   string        `json:"client_secret"`
+}
+
+// provider is an OIDC identity provider with its own issuer
+type provider struct {
+	Issuer           string   `json:"issuer"`
+	AllowedClientIDs []string `json:"allowed_client_ids"`
+	ScopesSupported  []string `json:"scopes_supported"`
+
+	// effectiveIssuer is a calculated field and will be either Issuer (if
+	// that's set) or the Vault instance's api_addr, followed by the path of
+	// the provider.
+	effectiveIssuer string
+}
+
+// providerDiscovery contains the provider metadata needed by relying parties
+// to use the authorization code flow.
+//
+// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type providerDiscovery struct {
+	Issuer                string   `json:"issuer"`
+	Keys                  string   `json:"jwks_uri"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserinfoEndpoint      string   `json:"userinfo_endpoint"`
+	ResponseTypes         []string `json:"response_types_supported"`
+	Scopes                []string `json:"scopes_supported"`
+	Subjects              []string `json:"subject_types_supported"`
+	GrantTypes            []string `json:"grant_types_supported"`
+	IDTokenAlgs           []string `json:"id_token_signing_alg_values_supported"`
+	AuthMethods           []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+// authCode is the state of an authorization request, kept in memory until
+// the code is exchanged for tokens or expires
+type authCode struct {
+	provider            string
+	clientID            string
+	entityID            string
+	redirectURI         string
+	scopes              []string
+	nonce               string
+	codeChallenge       string
+	codeChallengeMethod string
+}
+
+const (
+	oidcProviderPrefix = "oidc_provider/"
+	assignmentPath     = oidcProviderPrefix + "assignments/"
+	scopePath          = oidcProviderPrefix + "scopes/"
+	clientPath         = oidcProviderPrefix + "clients/"
+	providerPath       = oidcProviderPrefix + "providers/"
+
+	openIDScope = "openid"
+
+	clientTypeConfidential = "confidential"
+	clientTypePublic       = "public"
+
+	codeChallengeMethodPlain = "plain"
+	codeChallengeMethodS256  = "S256"
+
+	// accessTokenType is the JWT type of access tokens, which keeps them
+	// from being confused with ID tokens signed by the same key
+	accessTokenType = "at+jwt"
+
+	// authCodeTTL is how long an authorization code may be exchanged for
+	// tokens
+	authCodeTTL = 5 * time.Minute
+)
+
+// reservedProviderClaims may not be set by scope templates
+var reservedProviderClaims = []string{
+	"iat", "aud", "exp", "iss", "sub", "namespace",
+	"nonce", "auth_time", "at_hash", "c_hash", "azp", "scope", "client_id",
+}
+
+func oidcProviderPaths(i *IdentityStore) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "oidc/assignment/" + framework.GenericNameRegex("name"),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the assignment",
+				},
+				"entity_ids": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Comma separated string or array of identity entity IDs",
+				},
+				"group_ids": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Comma separated string or array of identity group IDs",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: i.pathOIDCCreateUpdateAssignment,
+				logical.UpdateOperation: i.pathOIDCCreateUpdateAssignment,
+				logical.ReadOperation:   i.pathOIDCReadAssignment,
+				logical.DeleteOperation: i.pathOIDCDeleteAssignment,
+			},
+			ExistenceCheck:  i.pathOIDCProviderObjectExistenceCheck(assignmentPath),
+			HelpSynopsis:    "CRUD operations for OIDC assignments.",
+			HelpDescription: "Create, Read, Update, and Delete OIDC assignments. Assignments determine which entities and groups may obtain tokens for the clients that reference them.",
+		},
+		{
+			Pattern: "oidc/assignment/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: i.pathOIDCListProviderObject(assignmentPath),
+			},
+			HelpSynopsis:    "List OIDC assignments",
+			HelpDescription: "List all configured OIDC assignments in the identity backend.",
+		},
+		{
+			Pattern: "oidc/scope/" + framework.GenericNameRegex("name"),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the scope",
+				},
+				"template": {
+					Type:        framework.TypeString,
+					Description: "The template string to use for the claims of the scope. This may be in string-ified JSON or base64 format.",
+				},
+				"description": {
+					Type:        framework.TypeString,
+					Description: "The description of the scope",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: i.pathOIDCCreateUpdateScope,
+				logical.UpdateOperation: i.pathOIDCCreateUpdateScope,
+				logical.ReadOperation:   i.pathOIDCReadScope,
+				logical.DeleteOperation: i.pathOIDCDeleteScope,
+			},
+			ExistenceCheck:  i.pathOIDCProviderObjectExistenceCheck(scopePath),
+			HelpSynopsis:    "CRUD operations for OIDC scopes.",
+			HelpDescription: "Create, Read, Update, and Delete OIDC scopes. Scopes add templated claims to the ID tokens and userinfo responses of providers.",
+		},
+		{
+			Pattern: "oidc/scope/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: i.pathOIDCListProviderObject(scopePath),
+			},
+			HelpSynopsis:    "List OIDC scopes",
+			HelpDescription: "List all configured OIDC scopes in the identity backend.",
+		},
+		{
+			Pattern: "oidc/client/" + framework.GenericNameRegex("name"),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the client",
+				},
+				"key": {
+					Type:        framework.TypeString,
+					Description: "The OIDC key to use for signing the tokens of the client. The specified key must already exist.",
+				},
+				"redirect_uris": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Comma separated string or array of redirection URIs the client may use in authorization requests.",
+				},
+				"assignments": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Comma separated string or array of assignment names. Only the entities and groups of these assignments may obtain tokens for the client.",
+				},
+				"id_token_ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: "TTL of the ID tokens issued to the client.",
+					Default:     "24h",
+				},
+				"access_token_ttl": {
+					Type:        framework.TypeDurationSecond,
+					Description: "TTL of the access tokens issued to the client.",
+					Default:     "24h",
+				},
+				"client_type": {
+					Type:        framework.TypeString,
+					Description: `The type of the client, either "confidential" or "public". Public clients have no client secret and must use PKCE. This cannot be changed after creation.`,
+					Default:     clientTypeConfidential,
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: i.pathOIDCCreateUpdateClient,
+				logical.UpdateOperation: i.pathOIDCCreateUpdateClient,
+				logical.ReadOperation:   i.pathOIDCReadClient,
+				logical.DeleteOperation: i.pathOIDCDeleteClient,
+			},
+			ExistenceCheck:  i.pathOIDCProviderObjectExistenceCheck(clientPath),
+			HelpSynopsis:    "CRUD operations for OIDC clients.",
+			HelpDescription: "Create, Read, Update, and Delete OIDC clients. Clients are the applications which use a provider to authenticate Vault entities.",
+		},
+		{
+			Pattern: "oidc/client/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: i.pathOIDCListProviderObject(clientPath),
+			},
+			HelpSynopsis:    "List OIDC clients",
+			HelpDescription: "List all configured OIDC clients in the identity backend.",
+		},
+		{
+			Pattern: "oidc/provider/" + framework.GenericNameRegex("name"),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the provider",
+				},
+				"issuer": {
+					Type:        framework.TypeString,
+					Description: "Scheme, host and optional port of the issuer URL of the provider. If not set, Vault's api_addr will be used.",
+				},
+				"allowed_client_ids": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: `Comma separated string or array of the client IDs allowed to use the provider. If empty no clients are allowed. If "*" all clients are allowed.`,
+				},
+				"scopes_supported": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: `Comma separated string or array of the scopes available to the clients of the provider, in addition to the "openid" scope.`,
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: i.pathOIDCCreateUpdateProvider,
+				logical.UpdateOperation: i.pathOIDCCreateUpdateProvider,
+				logical.ReadOperation:   i.pathOIDCReadProvider,
+				logical.DeleteOperation: i.pathOIDCDeleteProvider,
+			},
+			ExistenceCheck:  i.pathOIDCProviderObjectExistenceCheck(providerPath),
+			HelpSynopsis:    "CRUD operations for OIDC providers.",
+			HelpDescription: "Create, Read, Update, and Delete OIDC providers. Providers issue ID and access tokens for Vault entities to their clients through the authorization code flow.",
+		},
+		{
+			Pattern: "oidc/provider/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: i.pathOIDCListProviderObject(providerPath),
+			},
+			HelpSynopsis:    "List OIDC providers",
+			HelpDescription: "List all configured OIDC providers in the identity backend.",
+		},
+		{
+			Pattern: "oidc/provider/" + framework.GenericNameRegex("name") + "/.well-known/openid-configuration/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the provider",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: i.pathOIDCProviderDiscovery,
+			},
+			HelpSynopsis:    "Query OIDC provider configuration",
+			HelpDescription: "Query this path to retrieve the issuer, endpoints, scopes and signing algorithms of the OIDC provider.",
+		},
+		{
+			Pattern: "oidc/provider/" + framework.GenericNameRegex("name") + "/.well-known/keys/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the provider",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: i.pathOIDCProviderReadPublicKeys,
+			},
+			HelpSynopsis:    "Retrieve public keys of an OIDC provider",
+			HelpDescription: "Query this path to retrieve the public portion of the keys used to sign the tokens issued by the OIDC provider.",
+		},
+		{
+			Pattern: "oidc/provider/" + framework.GenericNameRegex("name") + "/authorize/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the provider",
+				},
+				"client_id": {
+					Type:        framework.TypeString,
+					Description: "The ID of the client requesting authorization",
+				},
+				"scope": {
+					Type:        framework.TypeString,
+					Description: `Space separated list of the requested scopes, which must include "openid"`,
+				},
+				"redirect_uri": {
+					Type:        framework.TypeString,
+					Description: "The redirection URI to which the response will be sent. It must match one of the redirect URIs of the client.",
+				},
+				"response_type": {
+					Type:        framework.TypeString,
+					Description: `The OIDC authentication flow to use. Only "code" is supported.`,
+				},
+				"state": {
+					Type:        framework.TypeString,
+					Description: "Opaque value used to maintain state between the authentication request and the callback",
+				},
+				"nonce": {
+					Type:        framework.TypeString,
+					Description: "Value to associate the client session with the ID token",
+				},
+				"code_challenge": {
+					Type:        framework.TypeString,
+					Description: "PKCE code challenge derived from the code verifier. Required for public clients.",
+				},
+				"code_challenge_method": {
+					Type:        framework.TypeString,
+					Description: `The method used to derive the PKCE code challenge, either "plain" or "S256". Defaults to "plain".`,
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   i.pathOIDCAuthorize,
+				logical.UpdateOperation: i.pathOIDCAuthorize,
+			},
+			HelpSynopsis:    "Request an authorization code",
+			HelpDescription: "Issue an authorization code for the entity of the request's token, which the client can exchange for tokens at the token endpoint of the provider.",
+		},
+		{
+			Pattern: "oidc/provider/" + framework.GenericNameRegex("name") + "/token/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the provider",
+				},
+				"grant_type": {
+					Type:        framework.TypeString,
+					Description: `The grant type. Only "authorization_code" is supported.`,
+				},
+				"code": {
+					Type:        framework.TypeString,
+					Description: "The authorization code received from the authorization endpoint",
+				},
+				"redirect_uri": {
+					Type:        framework.TypeString,
+					Description: "The redirection URI used in the authorization request",
+				},
+				"code_verifier": {
+					Type:        framework.TypeString,
+					Description: "The PKCE code verifier, if a code challenge was sent in the authorization request",
+				},
+				"client_id": {
+					Type:        framework.TypeString,
+					Description: "The ID of the client, if not provided with HTTP Basic authentication",
+				},
+				"client_secret": {
+					Type:        framework.TypeString,
+					Description: "The secret of the client, if not provided with HTTP Basic authentication",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: i.pathOIDCToken,
+			},
+			HelpSynopsis:    "Exchange an authorization code for tokens",
+			HelpDescription: "Exchange an authorization code for an ID token and an access token.",
+		},
+		{
+			Pattern: "oidc/provider/" + framework.GenericNameRegex("name") + "/userinfo/?$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the provider",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   i.pathOIDCUserInfo,
+				logical.UpdateOperation: i.pathOIDCUserInfo,
+			},
+			HelpSynopsis:    "Retrieve the claims of an access token's entity",
+			HelpDescription: "Retrieve the claims of the entity that an access token issued by the provider was granted for. The access token must be provided as a bearer token.",
+		},
+	}
+}
+
+func (i *IdentityStore) pathOIDCProviderObjectExistenceCheck(prefix string) framework.ExistenceFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+		entry, err := req.Storage.Get(ctx, prefix+d.Get("name").(string))
+		if err != nil {
+			return false, err
+		}
+
+		return entry != nil, nil
+	}
+}
+
+func (i *IdentityStore) pathOIDCListProviderObject(prefix string) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		names, err := req.Storage.List(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		return logical.ListResponse(names), nil
+	}
+}
+
+// getProviderObject decodes the object stored at prefix+name into out and
+// returns whether it exists
+func getProviderObject(ctx context.Context, s logical.Storage, prefix, name string, out interface{}) (bool, error) {
+	entry, err := s.Get(ctx, prefix+name)
+	if err != nil {
+		return false, err
+	}
+	if entry == nil {
+		return false, nil
+	}
+
+	if err := entry.DecodeJSON(out); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func putProviderObject(ctx context.Context, s logical.Storage, prefix, name string, obj interface{}) error {
+	entry, err := logical.StorageEntryJSON(prefix+name, obj)
+	if err != nil {
+		return err
+	}
+
+	return s.Put(ctx, entry)
+}
+
+// namesReferencing returns the names of the objects stored under prefix for
+// which references returns true
+func namesReferencing(ctx context.Context, s logical.Storage, prefix string, newObj func() interface{}, references func(interface{}) bool) ([]string, error) {
+	names, err := s.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var referencing []string
+	for _, name := range names {
+		obj := newObj()
+		found, err := getProviderObject(ctx, s, prefix, name, obj)
+		if err != nil {
+			return nil, err
+		}
+		if found && references(obj) {
+			referencing = append(referencing, name)
+		}
+	}
+
+	return referencing, nil
+}
+
+func (i *IdentityStore) pathOIDCCreateUpdateAssignment(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	i.oidcLock.Lock()
+	defer i.oidcLock.Unlock()
+
+	var a assignment
+	if req.Operation == logical.UpdateOperation {
+		if _, err := getProviderObject(ctx, req.Storage, assignmentPath, name, &a); err != nil {
+			return nil, err
+		}
+	}
+
+	if entityIDs, ok := d.GetOk("entity_ids"); ok {
+		a.EntityIDs = entityIDs.([]string)
+	}
+	if groupIDs, ok := d.GetOk("group_ids"); ok {
+		a.GroupIDs = groupIDs.([]string)
+	}
+
+	for _, entityID := range a.EntityIDs {
+		entity, err := i.MemDBEntityByID(entityID, false)
+		if err != nil {
+			return nil, err
+		}
+		if entity == nil {
+			return logical.ErrorResponse("entity %q not found", entityID), nil
+		}
+	}
+	for _, groupID := range a.GroupIDs {
+		group, err := i.MemDBGroupByID(groupID, false)
+		if err != nil {
+			return nil, err
+		}
+		if group == nil {
+			return logical.ErrorResponse("group %q not found", groupID), nil
+		}
+	}
+
+	if err := putProviderObject(ctx, req.Storage, assignmentPath, name, a); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (i *IdentityStore) pathOIDCReadAssignment(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	var a assignment
+	found, err := getProviderObject(ctx, req.Storage, assignmentPath, d.Get("name").(string), &a)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"entity_ids": a.EntityIDs,
+			"group_ids":  a.GroupIDs,
+		},
+	}, nil
+}
+
+func (i *IdentityStore) pathOIDCDeleteAssignment(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	i.oidcLock.Lock()
+	defer i.oidcLock.Unlock()
+
+	// it is an error to delete an assignment that is referenced by a client
+	clientNames, err := namesReferencing(ctx, req.Storage, clientPath,
+		func() interface{} { return new(client) },
+		func(obj interface{}) bool { return strutil.StrListContains(obj.(*client).Assignments, name) })
+	if err != nil {
+		return nil, err
+	}
+	if len(clientNames) > 0 {
+		return logical.ErrorResponse("unable to delete assignment %q because it is currently referenced by these clients: %s",
+			name, strings.Join(clientNames, ", ")), logical.ErrInvalidRequest
+	}
+
+	return nil, req.Storage.Delete(ctx, assignmentPath+name)
+}
+
+func (i *IdentityStore) pathOIDCCreateUpdateScope(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == openIDScope {
+		return logical.ErrorResponse("the %q scope name is reserved", openIDScope), nil
+	}
+
+	i.oidcLock.Lock()
+	defer i.oidcLock.Unlock()
+
+	var sc scope
+	if req.Operation == logical.UpdateOperation {
+		if _, err := getProviderObject(ctx, req.Storage, scopePath, name, &sc); err != nil {
+			return nil, err
+		}
+	}
+
+	if template, ok := d.GetOk("template"); ok {
+		sc.Template = template.(string)
+	}
+	if description, ok := d.GetOk("description"); ok {
+		sc.Description = description.(string)
+	}
+
+	// Attempt to decode as base64 and use that if it works
+	if decoded, err := base64.StdEncoding.DecodeString(sc.Template); err == nil {
+		sc.Template = string(decoded)
+	}
+
+	// Validate that template can be parsed and results in valid JSON
+	if sc.Template != "" {
+		_, populatedTemplate, err := identity.PopulateString(identity.PopulateStringInput{
+			Mode:   identity.JSONTemplating,
+			String: sc.Template,
+			Entity: new(identity.Entity),
+			Groups: make([]*identity.Group, 0),
+		})
+		if err != nil {
+			return logical.ErrorResponse("error parsing template: %s", err.Error()), nil
+		}
+
+		var tmp map[string]interface{}
+		if err := json.Unmarshal([]byte(populatedTemplate), &tmp); err != nil {
+			return logical.ErrorResponse("error parsing template JSON: %s", err.Error()), nil
+		}
+
+		for key := range tmp {
+			if strutil.StrListContains(reservedProviderClaims, key) {
+				return logical.ErrorResponse(`top level key %q not allowed. Restricted keys: %s`,
+					key, strings.Join(reservedProviderClaims, ", ")), nil
+			}
+		}
+	}
+
+	if err := putProviderObject(ctx, req.Storage, scopePath, name, sc); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (i *IdentityStore) pathOIDCReadScope(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	var sc scope
+	found, err := getProviderObject(ctx, req.Storage, scopePath, d.Get("name").(string), &sc)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"template":    sc.Template,
+			"description": sc.Description,
+		},
+	}, nil
+}
+
+func (i *IdentityStore) pathOIDCDeleteScope(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	i.oidcLock.Lock()
+	defer i.oidcLock.Unlock()
+
+	// it is an error to delete a scope that is supported by a provider
+	providerNames, err := namesReferencing(ctx, req.Storage, providerPath,
+		func() interface{} { return new(provider) },
+		func(obj interface{}) bool { return strutil.StrListContains(obj.(*provider).ScopesSupported, name) })
+	if err != nil {
+		return nil, err
+	}
+	if len(providerNames) > 0 {
+		return logical.ErrorResponse("unable to delete scope %q because it is currently referenced by these providers: %s",
+			name, strings.Join(providerNames, ", ")), logical.ErrInvalidRequest
+	}
+
+	return nil, req.Storage.Delete(ctx, scopePath+name)
+}
+
+func (i *IdentityStore) pathOIDCCreateUpdateClient(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	i.oidcLock.Lock()
+	defer i.oidcLock.Unlock()
+
+	var c client
+	if req.Operation == logical.UpdateOperation {
+		if _, err := getProviderObject(ctx, req.Storage, clientPath, name, &c); err != nil {
+			return nil, err
+		}
+	}
+
+	if key, ok := d.GetOk("key"); ok {
+		c.Key = key.(string)
+	}
+	if c.Key == "" {
+		return logical.ErrorResponse("the key parameter is required"), nil
+	}
+	var key namedKey
+	found, err := getProviderObject(ctx, req.Storage, namedKeyConfigPath, c.Key, &key)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return logical.ErrorResponse("key %q does not exist", c.Key), nil
+	}
+
+	if redirectURIs, ok := d.GetOk("redirect_uris"); ok {
+		c.RedirectURIs = redirectURIs.([]string)
+	}
+	for _, redirectURI := range c.RedirectURIs {
+		if u, err := url.Parse(redirectURI); err != nil || !u.IsAbs() || u.Fragment != "" {
+			return logical.ErrorResponse("invalid redirect URI %q, which must be absolute and without a fragment", redirectURI), nil
+		}
+	}
+
+	if assignments, ok := d.GetOk("assignments"); ok {
+		c.Assignments = assignments.([]string)
+	}
+	for _, assignmentName := range c.Assignments {
+		found, err := getProviderObject(ctx, req.Storage, assignmentPath, assignmentName, new(assignment))
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return logical.ErrorResponse("assignment %q does not exist", assignmentName), nil
+		}
+	}
+
+	if ttl, ok := d.GetOk("id_token_ttl"); ok {
+		c.IDTokenTTL = time.Duration(ttl.(int)) * time.Second
+	} else if req.Operation == logical.CreateOperation {
+		c.IDTokenTTL = time.Duration(d.Get("id_token_ttl").(int)) * time.Second
+	}
+	if ttl, ok := d.GetOk("access_token_ttl"); ok {
+		c.AccessTokenTTL = time.Duration(ttl.(int)) * time.Second
+	} else if req.Operation == logical.CreateOperation {
+		c.AccessTokenTTL = time.Duration(d.Get("access_token_ttl").(int)) * time.Second
+	}
+
+	clientType := d.Get("client_type").(string)
+	switch {
+	case req.Operation == logical.CreateOperation:
+		if clientType != clientTypeConfidential && clientType != clientTypePublic {
+			return logical.ErrorResponse(`invalid client_type %q, which must be "confidential" or "public"`, clientType), nil
+		}
+		c.ClientType = clientType
+	case clientType != c.ClientType:
+		if _, ok := d.GetOk("client_type"); ok {
+			return logical.ErrorResponse("client_type cannot be changed"), nil
+		}
+	}
+
+	if c.ClientID == "" {
+		clientID, err := base62.Random(32)
+		if err != nil {
+			return nil, err
+		}
+		c.ClientID = clientID
+	}
+	if c.ClientType == clientTypeConfidential && c.ClientSecret == "" {
+		clientSecret, err := base62.Random(64)
+		if err != nil {
+			return nil, err
+		}
+		c.ClientSecret = clientSecret
+	}
+
+	if err := putProviderObject(ctx, req.Storage, clientPath, name, c); err != nil {
+		return nil, err
+	}
+
+	// As with roles, the key must list the client ID for tokens to be signed
+	var resp *logical.Response
+	if !strutil.StrListContains(key.AllowedClientIDs, "*") && !strutil.StrListContains(key.AllowedClientIDs, c.ClientID) {
+		resp = &logical.Response{}
+		resp.AddWarning(fmt.Sprintf("The key %q does not list the client ID %q as an allowed client ID; "+
+			"tokens cannot be issued to the client until it does.", c.Key, c.ClientID))
+	}
+
+	return resp, nil
+}
+
+func (i *IdentityStore) pathOIDCReadClient(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	var c client
+	found, err := getProviderObject(ctx, req.Storage, clientPath, d.Get("name").(string), &c)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"key":              c.Key,
+			"redirect_uris":    c.RedirectURIs,
+			"assignments":      c.Assignments,
+			"id_token_ttl":     int64(c.IDTokenTTL.Seconds()),
+			"access_token_ttl": int64(c.AccessTokenTTL.Seconds()),
+			"client_type":      c.ClientType,
+			"client_id":        c.ClientID,
+		},
+	}
+	if c.ClientType == clientTypeConfidential {
+		resp.Data["client_secret"] = c.ClientSecret
+	}
+
+	return resp, nil
+}
+
+func (i *IdentityStore) pathOIDCDeleteClient(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	i.oidcLock.Lock()
+	defer i.oidcLock.Unlock()
+
+	return nil, req.Storage.Delete(ctx, clientPath+d.Get("name").(string))
+}
+
+// clientByID returns the client with the given client ID, or nil if there is
+// none
+func clientByID(ctx context.Context, s logical.Storage, clientID string) (*client, error) {
+	if clientID == "" {
+		return nil, nil
+	}
+
+	names, err := s.List(ctx, clientPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		var c client
+		found, err := getProviderObject(ctx, s, clientPath, name, &c)
+		if err != nil {
+			return nil, err
+		}
+		if found && subtle.ConstantTimeCompare([]byte(c.ClientID), []byte(clientID)) == 1 {
+			c.name = name
+			return &c, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (i *IdentityStore) pathOIDCCreateUpdateProvider(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	i.oidcLock.Lock()
+	defer i.oidcLock.Unlock()
+
+	var p provider
+	if req.Operation == logical.UpdateOperation {
+		if _, err := getProviderObject(ctx, req.Storage, providerPath, name, &p); err != nil {
+			return nil, err
+		}
+	}
+
+	if issuer, ok := d.GetOk("issuer"); ok {
+		p.Issuer = issuer.(string)
+	}
+	if p.Issuer != "" {
+		// verify that issuer is the correct format:
+		//   - http or https
+		//   - host name
+		//   - optional port
+		//   - nothing more
+		valid := false
+		if u, err := url.Parse(p.Issuer); err == nil {
+			u2 := url.URL{
+				Scheme: u.Scheme,
+				Host:   u.Host,
+			}
+			valid = (*u == u2) &&
+				(u.Scheme == "http" || u.Scheme == "https") &&
+				u.Host != ""
+		}
+
+		if !valid {
+			return logical.ErrorResponse(
+				"invalid issuer, which must include only a scheme, host, " +
+					"and optional port (e.g. https://example.com:8200)"), nil
+		}
+	}
+
+	if allowedClientIDs, ok := d.GetOk("allowed_client_ids"); ok {
+		p.AllowedClientIDs = allowedClientIDs.([]string)
+	}
+
+	if scopesSupported, ok := d.GetOk("scopes_supported"); ok {
+		p.ScopesSupported = scopesSupported.([]string)
+	}
+	for _, scopeName := range p.ScopesSupported {
+		if scopeName == openIDScope {
+			return logical.ErrorResponse("the %q scope is always supported and must not be listed", openIDScope), nil
+		}
+		found, err := getProviderObject(ctx, req.Storage, scopePath, scopeName, new(scope))
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return logical.ErrorResponse("scope %q does not exist", scopeName), nil
+		}
+	}
+
+	if err := putProviderObject(ctx, req.Storage, providerPath, name, p); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (i *IdentityStore) pathOIDCReadProvider(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	p, err := i.getOIDCProvider(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"issuer":             p.Issuer,
+			"effective_issuer":   p.effectiveIssuer,
+			"allowed_client_ids": p.AllowedClientIDs,
+			"scopes_supported":   p.ScopesSupported,
+		},
+	}, nil
+}
+
+func (i *IdentityStore) pathOIDCDeleteProvider(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	i.oidcLock.Lock()
+	defer i.oidcLock.Unlock()
+
+	return nil, req.Storage.Delete(ctx, providerPath+d.Get("name").(string))
+}
+
+func (i *IdentityStore) getOIDCProvider(ctx context.Context, s logical.Storage, name string) (*provider, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var p provider
+	found, err := getProviderObject(ctx, s, providerPath, name, &p)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+
+	p.effectiveIssuer = p.Issuer
+	if p.effectiveIssuer == "" {
+		p.effectiveIssuer = i.core.redirectAddr
+	}
+
+	p.effectiveIssuer += "/v1/" + ns.Path + issuerPath + "/provider/" + name
+
+	return &p, nil
+}
+
+// allowsClient returns whether the provider may issue tokens to the client
+func (p *provider) allowsClient(c *client) bool {
+	return strutil.StrListContains(p.AllowedClientIDs, "*") || strutil.StrListContains(p.AllowedClientIDs, c.ClientID)
+}
+
+// supportsScope returns whether the scope may be requested from the provider
+func (p *provider) supportsScope(name string) bool {
+	return name == openIDScope || strutil.StrListContains(p.ScopesSupported, name)
+}
+
+func (i *IdentityStore) pathOIDCProviderDiscovery(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	p, err := i.getOIDCProvider(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, nil
+	}
+
+	disc := providerDiscovery{
+		Issuer:                p.effectiveIssuer,
+		Keys:                  p.effectiveIssuer + "/.well-known/keys",
+		AuthorizationEndpoint: p.effectiveIssuer + "/authorize",
+		TokenEndpoint:         p.effectiveIssuer + "/token",
+		UserinfoEndpoint:      p.effectiveIssuer + "/userinfo",
+		ResponseTypes:         []string{"code"},
+		Scopes:                append([]string{openIDScope}, p.ScopesSupported...),
+		Subjects:              []string{"public"},
+		GrantTypes:            []string{"authorization_code"},
+		IDTokenAlgs:           supportedAlgs,
+		AuthMethods:           []string{"none", "client_secret_basic", "client_secret_post"},
+		CodeChallengeMethods:  []string{codeChallengeMethodPlain, codeChallengeMethodS256},
+	}
+
+	data, err := json.Marshal(disc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode:      200,
+			logical.HTTPRawBody:         data,
+			logical.HTTPContentType:     "application/json",
+			logical.HTTPRawCacheControl: "max-age=3600",
+		},
+	}, nil
+}
+
+func (i *IdentityStore) pathOIDCProviderReadPublicKeys(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	p, err := i.getOIDCProvider(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, nil
+	}
+
+	jwks, err := i.providerPublicJWKS(ctx, req.Storage, p)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(jwks)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode:  200,
+			logical.HTTPRawBody:     data,
+			logical.HTTPContentType: "application/json",
+		},
+	}, nil
+}
+
+// providerPublicJWKS returns the public keys of the named keys used by the
+// clients the provider allows
+func (i *IdentityStore) providerPublicJWKS(ctx context.Context, s logical.Storage, p *provider) (*jose.JSONWebKeySet, error) {
+	clientNames, err := namesReferencing(ctx, s, clientPath,
+		func() interface{} { return new(client) },
+		func(obj interface{}) bool { return p.allowsClient(obj.(*client)) })
+	if err != nil {
+		return nil, err
+	}
+
+	publicKeyIDs, err := listOIDCPublicKeys(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	jwks := &jose.JSONWebKeySet{
+		Keys: make([]jose.JSONWebKey, 0),
+	}
+
+	seen := make(map[string]bool)
+	for _, clientName := range clientNames {
+		var c client
+		if _, err := getProviderObject(ctx, s, clientPath, clientName, &c); err != nil {
+			return nil, err
+		}
+		if seen[c.Key] {
+			continue
+		}
+		seen[c.Key] = true
+
+		var key namedKey
+		found, err := getProviderObject(ctx, s, namedKeyConfigPath, c.Key, &key)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+
+		for _, ringKey := range key.KeyRing {
+			if !strutil.StrListContains(publicKeyIDs, ringKey.KeyID) {
+				continue
+			}
+			publicKey, err := loadOIDCPublicKey(ctx, s, ringKey.KeyID)
+			if err != nil {
+				return nil, err
+			}
+			jwks.Keys = append(jwks.Keys, *publicKey)
+		}
+	}
+
+	return jwks, nil
+}
+
+// oauthErrorResponse returns an OAuth 2.0 error response with the given HTTP
+// status code. The state, if any, is returned to the client of an
+// authorization request.
+//
+// https://tools.ietf.org/html/rfc6749#section-4.1.2.1
+// https://tools.ietf.org/html/rfc6749#section-5.2
+func oauthErrorResponse(statusCode int, errorCode, state, description string) (*logical.Response, error) {
+	body := map[string]interface{}{
+		"error":             errorCode,
+		"error_description": description,
+	}
+	if state != "" {
+		body["state"] = state
+	}
+
+	return oauthJSONResponse(statusCode, body)
+}
+
+func oauthJSONResponse(statusCode int, body map[string]interface{}) (*logical.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode:      statusCode,
+			logical.HTTPRawBody:         data,
+			logical.HTTPContentType:     "application/json",
+			logical.HTTPRawCacheControl: "no-store",
+		},
+	}, nil
+}
+
+// pathOIDCAuthorize issues an authorization code for the entity of the
+// request's token. Errors about the client or redirect URI are returned as
+// Vault errors since they must not be sent to the redirect URI; all other
+// errors are OAuth 2.0 error responses to be passed on to the client.
+func (i *IdentityStore) pathOIDCAuthorize(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := d.Get("name").(string)
+	p, err := i.getOIDCProvider(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("provider %q not found", name), nil
+	}
+
+	clientID := d.Get("client_id").(string)
+	c, err := clientByID(ctx, req.Storage, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil || !p.allowsClient(c) {
+		return logical.ErrorResponse("client with client_id %q not found", clientID), nil
+	}
+
+	redirectURI := d.Get("redirect_uri").(string)
+	if !strutil.StrListContains(c.RedirectURIs, redirectURI) {
+		return logical.ErrorResponse("redirect_uri %q is not registered for the client", redirectURI), nil
+	}
+
+	state := d.Get("state").(string)
+
+	if responseType := d.Get("response_type").(string); responseType != "code" {
+		return oauthErrorResponse(400, "unsupported_response_type", state, `the only supported response_type is "code"`)
+	}
+
+	var scopes []string
+	for _, s := range strings.Fields(d.Get("scope").(string)) {
+		// unsupported scopes are ignored
+		if p.supportsScope(s) && !strutil.StrListContains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	if !strutil.StrListContains(scopes, openIDScope) {
+		return oauthErrorResponse(400, "invalid_scope", state, `the scope parameter must include "openid"`)
+	}
+
+	codeChallenge := d.Get("code_challenge").(string)
+	codeChallengeMethod := d.Get("code_challenge_method").(string)
+	if codeChallenge == "" {
+		if c.ClientType == clientTypePublic {
+			return oauthErrorResponse(400, "invalid_request", state, "public clients must provide a code_challenge")
+		}
+		if codeChallengeMethod != "" {
+			return oauthErrorResponse(400, "invalid_request", state, "code_challenge_method requires a code_challenge")
+		}
+	} else {
+		if codeChallengeMethod == "" {
+			codeChallengeMethod = codeChallengeMethodPlain
+		}
+		if codeChallengeMethod != codeChallengeMethodPlain && codeChallengeMethod != codeChallengeMethodS256 {
+			return oauthErrorResponse(400, "invalid_request", state, `code_challenge_method must be "plain" or "S256"`)
+		}
+		if len(codeChallenge) < 43 || len(codeChallenge) > 128 {
+			return oauthErrorResponse(400, "invalid_request", state, "code_challenge must be between 43 and 128 characters long")
+		}
+	}
+
+	if req.EntityID == "" {
+		return logical.ErrorResponse("no entity associated with the request's token"), nil
+	}
+
+	entity, err := i.MemDBEntityByID(req.EntityID, false)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil {
+		return nil, fmt.Errorf("error loading entity ID %q", req.EntityID)
+	}
+
+	assigned, err := i.entityAssignedToClient(ctx, req.Storage, c, entity)
+	if err != nil {
+		return nil, err
+	}
+	if !assigned {
+		return oauthErrorResponse(403, "access_denied", state, "the entity is not assigned to the client")
+	}
+
+	code, err := base62.Random(32)
+	if err != nil {
+		return nil, err
+	}
+
+	i.oidcAuthCodeCache.SetDefault(ns, code, &authCode{
+		provider:            name,
+		clientID:            c.ClientID,
+		entityID:            entity.ID,
+		redirectURI:         redirectURI,
+		scopes:              scopes,
+		nonce:               d.Get("nonce").(string),
+		codeChallenge:       codeChallenge,
+		codeChallengeMethod: codeChallengeMethod,
+	})
+
+	body := map[string]interface{}{
+		"code": code,
+	}
+	if state != "" {
+		body["state"] = state
+	}
+
+	return oauthJSONResponse(200, body)
+}
+
+// entityAssignedToClient returns whether the entity, or one of the groups
+// it belongs to, is part of one of the client's assignments
+func (i *IdentityStore) entityAssignedToClient(ctx context.Context, s logical.Storage, c *client, entity *identity.Entity) (bool, error) {
+	groups, inheritedGroups, err := i.groupsByEntityID(entity.ID)
+	if err != nil {
+		return false, err
+	}
+	groups = append(groups, inheritedGroups...)
+
+	for _, name := range c.Assignments {
+		var a assignment
+		found, err := getProviderObject(ctx, s, assignmentPath, name, &a)
+		if err != nil {
+			return false, err
+		}
+		if !found {
+			continue
+		}
+
+		if strutil.StrListContains(a.EntityIDs, entity.ID) {
+			return true, nil
+		}
+		for _, group := range groups {
+			if strutil.StrListContains(a.GroupIDs, group.ID) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// takeAuthCode returns the authorization code's state and removes it so that
+// each code can be exchanged only once
+func (i *IdentityStore) takeAuthCode(ns *namespace.Namespace, code string) *authCode {
+	i.oidcLock.Lock()
+	defer i.oidcLock.Unlock()
+
+	raw, ok := i.oidcAuthCodeCache.Get(ns, code)
+	if !ok {
+		return nil
+	}
+	i.oidcAuthCodeCache.c.Delete(i.oidcAuthCodeCache.nskey(ns, code))
+
+	return raw.(*authCode)
+}
+
+// clientCredentials returns the client ID and secret of a token request,
+// which may be sent with HTTP Basic authentication or in the request body
+//
+// https://tools.ietf.org/html/rfc6749#section-2.3.1
+func clientCredentials(req *logical.Request, d *framework.FieldData) (string, string, error) {
+	for _, header := range req.Headers["Authorization"] {
+		if !strings.HasPrefix(header, "Basic ") {
+			continue
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header[6:]))
+		if err != nil {
+			return "", "", err
+		}
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) != 2 {
+			return "", "", fmt.Errorf("malformed basic credentials")
+		}
+		clientID, err := url.QueryUnescape(parts[0])
+		if err != nil {
+			return "", "", err
+		}
+		clientSecret, err := url.QueryUnescape(parts[1])
+		if err != nil {
+			return "", "", err
+		}
+		return clientID, clientSecret, nil
+	}
+
+	return d.Get("client_id").(string), d.Get("client_secret").(string), nil
+}
+
+// verifyCodeChallenge checks the PKCE code verifier against the challenge of
+// the authorization request
+//
+// https://tools.ietf.org/html/rfc7636#section-4.6
+func verifyCodeChallenge(code *authCode, verifier string) bool {
+	challenge := verifier
+	if code.codeChallengeMethod == codeChallengeMethodS256 {
+		sum := sha256.Sum256([]byte(verifier))
+		challenge = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(code.codeChallenge)) == 1
+}
+
+func (i *IdentityStore) pathOIDCToken(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := d.Get("name").(string)
+	p, err := i.getOIDCProvider(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return oauthErrorResponse(400, "invalid_request", "", fmt.Sprintf("provider %q not found", name))
+	}
+
+	// authenticate the client
+	clientID, clientSecret, err := clientCredentials(req, d)
+	if err != nil {
+		return oauthErrorResponse(401, "invalid_client", "", fmt.Sprintf("error parsing client credentials: %s", err))
+	}
+	c, err := clientByID(ctx, req.Storage, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil || !p.allowsClient(c) {
+		return oauthErrorResponse(401, "invalid_client", "", "client failed to authenticate")
+	}
+	if c.ClientType == clientTypeConfidential &&
+		subtle.ConstantTimeCompare([]byte(c.ClientSecret), []byte(clientSecret)) != 1 {
+		return oauthErrorResponse(401, "invalid_client", "", "client failed to authenticate")
+	}
+
+	if grantType := d.Get("grant_type").(string); grantType != "authorization_code" {
+		return oauthErrorResponse(400, "unsupported_grant_type", "", `the only supported grant_type is "authorization_code"`)
+	}
+
+	codeValue := d.Get("code").(string)
+	if codeValue == "" {
+		return oauthErrorResponse(400, "invalid_request", "", "the code parameter is required")
+	}
+	code := i.takeAuthCode(ns, codeValue)
+	if code == nil || code.provider != name || code.clientID != c.ClientID {
+		return oauthErrorResponse(400, "invalid_grant", "", "authorization code is invalid or expired")
+	}
+	if d.Get("redirect_uri").(string) != code.redirectURI {
+		return oauthErrorResponse(400, "invalid_grant", "", "redirect_uri does not match the authorization request")
+	}
+
+	codeVerifier := d.Get("code_verifier").(string)
+	switch {
+	case code.codeChallenge == "" && codeVerifier != "":
+		return oauthErrorResponse(400, "invalid_request", "", "code_verifier provided without a code_challenge in the authorization request")
+	case code.codeChallenge != "" && !verifyCodeChallenge(code, codeVerifier):
+		return oauthErrorResponse(400, "invalid_grant", "", "code_verifier does not match the code_challenge")
+	}
+
+	// the entity may have been disabled or unassigned since authorization
+	entity, err := i.MemDBEntityByID(code.entityID, true)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil || entity.Disabled {
+		return oauthErrorResponse(400, "invalid_grant", "", "the entity of the authorization code is not active")
+	}
+	assigned, err := i.entityAssignedToClient(ctx, req.Storage, c, entity)
+	if err != nil {
+		return nil, err
+	}
+	if !assigned {
+		return oauthErrorResponse(400, "invalid_grant", "", "the entity is not assigned to the client")
+	}
+
+	var key namedKey
+	found, err := getProviderObject(ctx, req.Storage, namedKeyConfigPath, c.Key, &key)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("key %q not found", c.Key)
+	}
+	if !strutil.StrListContains(key.AllowedClientIDs, "*") && !strutil.StrListContains(key.AllowedClientIDs, c.ClientID) {
+		return oauthErrorResponse(400, "unauthorized_client", "", fmt.Sprintf("the key %q does not list the client ID as an allowed client ID", c.Key))
+	}
+
+	now := time.Now()
+
+	accessTokenPayload, err := json.Marshal(map[string]interface{}{
+		"iss":       p.effectiveIssuer,
+		"sub":       entity.ID,
+		"aud":       c.ClientID,
+		"client_id": c.ClientID,
+		"scope":     strings.Join(code.scopes, " "),
+		"exp":       now.Add(c.AccessTokenTTL).Unix(),
+		"iat":       now.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := key.signPayloadWithType(accessTokenPayload, accessTokenType)
+	if err != nil {
+		return nil, errwrap.Wrapf("error signing access token: {{err}}", err)
+	}
+
+	claims, err := i.scopeClaims(ctx, req.Storage, code.scopes, entity)
+	if err != nil {
+		return nil, err
+	}
+	claims["iss"] = p.effectiveIssuer
+	claims["sub"] = entity.ID
+	claims["aud"] = c.ClientID
+	claims["exp"] = now.Add(c.IDTokenTTL).Unix()
+	claims["iat"] = now.Unix()
+	if code.nonce != "" {
+		claims["nonce"] = code.nonce
+	}
+	atHash, err := tokenHash(key.Algorithm, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	claims["at_hash"] = atHash
+
+	idTokenPayload, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := key.signPayload(idTokenPayload)
+	if err != nil {
+		return nil, errwrap.Wrapf("error signing ID token: {{err}}", err)
+	}
+
+	return oauthJSONResponse(200, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int64(c.AccessTokenTTL.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+// scopeClaims returns the claims of the requested scopes, populated for the
+// entity. Structural errors with the templates are caught during scope
+// configuration; errors found at runtime are logged and the scope skipped.
+func (i *IdentityStore) scopeClaims(ctx context.Context, s logical.Storage, scopes []string, entity *identity.Entity) (map[string]interface{}, error) {
+	claims := make(map[string]interface{})
+
+	groups, inheritedGroups, err := i.groupsByEntityID(entity.ID)
+	if err != nil {
+		return nil, err
+	}
+	groups = append(groups, inheritedGroups...)
+
+	for _, name := range scopes {
+		if name == openIDScope {
+			continue
+		}
+
+		var sc scope
+		found, err := getProviderObject(ctx, s, scopePath, name, &sc)
+		if err != nil {
+			return nil, err
+		}
+		if !found || sc.Template == "" {
+			continue
+		}
+
+		_, populatedTemplate, err := identity.PopulateString(identity.PopulateStringInput{
+			Mode:   identity.JSONTemplating,
+			String: sc.Template,
+			Entity: entity,
+			Groups: groups,
+		})
+		if err != nil {
+			i.Logger().Warn("error populating OIDC scope template", "scope", name, "error", err)
+			continue
+		}
+
+		var parsed map[string]interface{}
+		if err := json.Unmarshal([]byte(populatedTemplate), &parsed); err != nil {
+			i.Logger().Warn("error parsing OIDC scope template", "scope", name, "error", err)
+			continue
+		}
+
+		for k, v := range parsed {
+			if !strutil.StrListContains(reservedProviderClaims, k) {
+				claims[k] = v
+			}
+		}
+	}
+
+	return claims, nil
+}
+
+// tokenHash returns the base64url encoded left half of the hash of the
+// token, using the hash function of the signing algorithm, for use in the
+// at_hash claim.
+//
+// https://openid.net/specs/openid-connect-core-1_0.html#CodeIDToken
+func tokenHash(algorithm, token string) (string, error) {
+	var h hash.Hash
+	switch jose.SignatureAlgorithm(algorithm) {
+	case jose.RS256, jose.ES256:
+		h = sha256.New()
+	case jose.RS384, jose.ES384:
+		h = sha512.New384()
+	case jose.RS512, jose.ES512, jose.EdDSA:
+		h = sha512.New()
+	default:
+		return "", fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+
+	h.Write([]byte(token))
+	sum := h.Sum(nil)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
+}
+
+func (k *namedKey) signPayloadWithType(payload []byte, typ string) (string, error) {
+	signingKey := jose.SigningKey{Key: k.SigningKey, Algorithm: jose.SignatureAlgorithm(k.Algorithm)}
+	signer, err := jose.NewSigner(signingKey, (&jose.SignerOptions{}).WithType(jose.ContentType(typ)))
+	if err != nil {
+		return "", err
+	}
+
+	signature, err := signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+
+	return signature.CompactSerialize()
+}
+
+// pathOIDCUserInfo returns the claims of the entity an access token was
+// issued for. The router passes the bearer token of these requests through
+// as is, rather than as a salted Vault token.
+func (i *IdentityStore) pathOIDCUserInfo(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	p, err := i.getOIDCProvider(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return oauthErrorResponse(400, "invalid_request", "", fmt.Sprintf("provider %q not found", name))
+	}
+
+	if req.ClientToken == "" {
+		return oauthErrorResponse(401, "invalid_token", "", "an access token must be provided as a bearer token")
+	}
+
+	parsedJWT, err := jwt.ParseSigned(req.ClientToken)
+	if err != nil || len(parsedJWT.Headers) != 1 || parsedJWT.Headers[0].ExtraHeaders[jose.HeaderType] != accessTokenType {
+		return oauthErrorResponse(401, "invalid_token", "", "the access token is malformed")
+	}
+
+	jwks, err := i.providerPublicJWKS(ctx, req.Storage, p)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims struct {
+		jwt.Claims
+		ClientID string `json:"client_id"`
+		Scope    string `json:"scope"`
+	}
+	var valid bool
+	for _, key := range jwks.Keys {
+		if err := parsedJWT.Claims(key, &claims); err == nil {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return oauthErrorResponse(401, "invalid_token", "", "unable to validate the access token signature")
+	}
+
+	if err := claims.Validate(jwt.Expected{
+		Issuer:   p.effectiveIssuer,
+		Audience: []string{claims.ClientID},
+		Time:     time.Now(),
+	}); err != nil {
+		return oauthErrorResponse(401, "invalid_token", "", fmt.Sprintf("error validating claims: %s", err))
+	}
+
+	c, err := clientByID(ctx, req.Storage, claims.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil || !p.allowsClient(c) {
+		return oauthErrorResponse(401, "invalid_token", "", "the client of the access token is no longer allowed")
+	}
+
+	entity, err := i.MemDBEntityByID(claims.Subject, true)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil || entity.Disabled {
+		return oauthErrorResponse(401, "invalid_token", "", "the entity of the access token is not active")
+	}
+
+	var scopes []string
+	for _, s := range strings.Fields(claims.Scope) {
+		if p.supportsScope(s) {
+			scopes = append(scopes, s)
+		}
+	}
+
+	userInfo, err := i.scopeClaims(ctx, req.Storage, scopes, entity)
+	if err != nil {
+		return nil, err
+	}
+	userInfo["sub"] = entity.ID
+
+	return oauthJSONResponse(200, userInfo)
+}
+
+func newOIDCAuthCodeCache() *oidcCache {
+	return &oidcCache{
+		c: cache.New(authCodeTTL, authCodeTTL),
+	}
+}
@@ -0,0 +1,650 @@
+package vault
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/hashicorp/vault/helper/identity"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// testProviderSetup creates an entity, a key, a scope, an assignment, a
+// client and a provider allowing that client
+func testProviderSetup(t *testing.T, c *Core, ctx context.Context, storage logical.Storage, clientType string) (clientID, clientSecret string) {
+	t.Helper()
+
+	testEntity := &identity.Entity{
+		Name:      "test-entity-name",
+		ID:        "test-entity-id",
+		BucketKey: "test-entity-bucket-key",
+		Metadata: map[string]string{
+			"email": "test@example.com",
+		},
+	}
+
+	txn := c.identityStore.db.Txn(true)
+	defer txn.Abort()
+	err := c.identityStore.upsertEntityInTxn(ctx, txn, testEntity, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn.Commit()
+
+	requests := []*logical.Request{
+		{
+			Path:      "oidc/key/test-key",
+			Operation: logical.CreateOperation,
+			Data: map[string]interface{}{
+				"allowed_client_ids": "*",
+			},
+		},
+		{
+			Path:      "oidc/scope/email",
+			Operation: logical.CreateOperation,
+			Data: map[string]interface{}{
+				"template": `{"email": {{identity.entity.metadata.email}}}`,
+			},
+		},
+		{
+			Path:      "oidc/assignment/test-assignment",
+			Operation: logical.CreateOperation,
+			Data: map[string]interface{}{
+				"entity_ids": "test-entity-id",
+			},
+		},
+		{
+			Path:      "oidc/client/test-client",
+			Operation: logical.CreateOperation,
+			Data: map[string]interface{}{
+				"key":           "test-key",
+				"redirect_uris": "https://app.example.com/callback",
+				"assignments":   "test-assignment",
+				"client_type":   clientType,
+			},
+		},
+		{
+			Path:      "oidc/provider/test-provider",
+			Operation: logical.CreateOperation,
+			Data: map[string]interface{}{
+				"issuer":             "https://vault.example.com:8200",
+				"allowed_client_ids": "*",
+				"scopes_supported":   "email",
+			},
+		},
+	}
+	for _, req := range requests {
+		req.Storage = storage
+		resp, err := c.identityStore.HandleRequest(ctx, req)
+		expectSuccess(t, resp, err)
+	}
+
+	resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/client/test-client",
+		Operation: logical.ReadOperation,
+		Storage:   storage,
+	})
+	expectSuccess(t, resp, err)
+	clientID = resp.Data["client_id"].(string)
+	if secret, ok := resp.Data["client_secret"]; ok {
+		clientSecret = secret.(string)
+	}
+
+	return clientID, clientSecret
+}
+
+func decodeRawBody(t *testing.T, resp *logical.Response) (int, map[string]interface{}) {
+	t.Helper()
+
+	if resp == nil || resp.Data[logical.HTTPRawBody] == nil {
+		t.Fatalf("expected a raw response but got: %#v", resp)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &body); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Data[logical.HTTPStatusCode].(int), body
+}
+
+// TestOIDC_Path_OIDCProviderObjects tests CRUD operations and references
+// between assignments, scopes, clients and providers
+func TestOIDC_Path_OIDCProviderObjects(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+	storage := &logical.InmemStorage{}
+
+	clientID, clientSecret := testProviderSetup(t, c, ctx, storage, "confidential")
+	if clientID == "" || clientSecret == "" {
+		t.Fatalf("expected a client ID and secret, got %q and %q", clientID, clientSecret)
+	}
+
+	// Read "test-client" and validate
+	resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/client/test-client",
+		Operation: logical.ReadOperation,
+		Storage:   storage,
+	})
+	expectSuccess(t, resp, err)
+	expected := map[string]interface{}{
+		"key":              "test-key",
+		"redirect_uris":    []string{"https://app.example.com/callback"},
+		"assignments":      []string{"test-assignment"},
+		"id_token_ttl":     int64(86400),
+		"access_token_ttl": int64(86400),
+		"client_type":      "confidential",
+		"client_id":        clientID,
+		"client_secret":    clientSecret,
+	}
+	if diff := deep.Equal(expected, resp.Data); diff != nil {
+		t.Fatal(diff)
+	}
+
+	// Read "test-provider" and validate
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/provider/test-provider",
+		Operation: logical.ReadOperation,
+		Storage:   storage,
+	})
+	expectSuccess(t, resp, err)
+	expected = map[string]interface{}{
+		"issuer":             "https://vault.example.com:8200",
+		"effective_issuer":   "https://vault.example.com:8200/v1/identity/oidc/provider/test-provider",
+		"allowed_client_ids": []string{"*"},
+		"scopes_supported":   []string{"email"},
+	}
+	if diff := deep.Equal(expected, resp.Data); diff != nil {
+		t.Fatal(diff)
+	}
+
+	// Invalid objects -- should fail
+	for _, req := range []*logical.Request{
+		{
+			Path:      "oidc/scope/openid",
+			Operation: logical.CreateOperation,
+		},
+		{
+			Path:      "oidc/scope/bad",
+			Operation: logical.CreateOperation,
+			Data: map[string]interface{}{
+				"template": `{"sub": "overridden"}`,
+			},
+		},
+		{
+			Path:      "oidc/assignment/bad",
+			Operation: logical.CreateOperation,
+			Data: map[string]interface{}{
+				"entity_ids": "missing-entity-id",
+			},
+		},
+		{
+			Path:      "oidc/client/bad",
+			Operation: logical.CreateOperation,
+			Data: map[string]interface{}{
+				"key": "missing-key",
+			},
+		},
+		{
+			Path:      "oidc/client/bad",
+			Operation: logical.CreateOperation,
+			Data: map[string]interface{}{
+				"key":           "test-key",
+				"redirect_uris": "/relative",
+			},
+		},
+		{
+			Path:      "oidc/client/bad",
+			Operation: logical.CreateOperation,
+			Data: map[string]interface{}{
+				"key":         "test-key",
+				"client_type": "bad",
+			},
+		},
+		{
+			Path:      "oidc/client/test-client",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"client_type": "public",
+			},
+		},
+		{
+			Path:      "oidc/provider/bad",
+			Operation: logical.CreateOperation,
+			Data: map[string]interface{}{
+				"issuer": "https://vault.example.com/path",
+			},
+		},
+		{
+			Path:      "oidc/provider/bad",
+			Operation: logical.CreateOperation,
+			Data: map[string]interface{}{
+				"scopes_supported": "missing-scope",
+			},
+		},
+	} {
+		req.Storage = storage
+		resp, err := c.identityStore.HandleRequest(ctx, req)
+		expectError(t, resp, err)
+	}
+
+	// Deleting referenced objects -- should fail
+	for _, path := range []string{"oidc/key/test-key", "oidc/scope/email", "oidc/assignment/test-assignment"} {
+		resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+			Path:      path,
+			Operation: logical.DeleteOperation,
+			Storage:   storage,
+		})
+		expectError(t, resp, err)
+	}
+
+	// List and delete the objects in order of their references
+	for _, prefix := range []string{"oidc/provider/", "oidc/client/", "oidc/assignment/", "oidc/scope/"} {
+		resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+			Path:      prefix,
+			Operation: logical.ListOperation,
+			Storage:   storage,
+		})
+		expectSuccess(t, resp, err)
+		keys := resp.Data["keys"].([]string)
+		if len(keys) != 1 {
+			t.Fatalf("expected one object under %q, got %v", prefix, keys)
+		}
+
+		resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+			Path:      prefix + keys[0],
+			Operation: logical.DeleteOperation,
+			Storage:   storage,
+		})
+		expectSuccess(t, resp, err)
+	}
+}
+
+// TestOIDC_Provider_AuthorizationCodeFlow tests the discovery, authorize,
+// token and userinfo endpoints of a provider
+func TestOIDC_Provider_AuthorizationCodeFlow(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+	storage := &logical.InmemStorage{}
+
+	clientID, _ := testProviderSetup(t, c, ctx, storage, "public")
+	issuer := "https://vault.example.com:8200/v1/identity/oidc/provider/test-provider"
+
+	// Discovery
+	resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/provider/test-provider/.well-known/openid-configuration",
+		Operation: logical.ReadOperation,
+		Storage:   storage,
+	})
+	expectSuccess(t, resp, err)
+	var disc providerDiscovery
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &disc); err != nil {
+		t.Fatal(err)
+	}
+	if disc.Issuer != issuer || disc.TokenEndpoint != issuer+"/token" {
+		t.Fatalf("bad discovery document: %#v", disc)
+	}
+	if diff := deep.Equal(disc.Scopes, []string{"openid", "email"}); diff != nil {
+		t.Fatal(diff)
+	}
+
+	verifier := strings.Repeat("v", 50)
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	authorize := func(data map[string]interface{}) (int, map[string]interface{}) {
+		t.Helper()
+		resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+			Path:      "oidc/provider/test-provider/authorize",
+			Operation: logical.UpdateOperation,
+			Storage:   storage,
+			EntityID:  "test-entity-id",
+			Data:      data,
+		})
+		expectSuccess(t, resp, err)
+		return decodeRawBody(t, resp)
+	}
+	authorizeData := func() map[string]interface{} {
+		return map[string]interface{}{
+			"client_id":             clientID,
+			"scope":                 "openid email",
+			"redirect_uri":          "https://app.example.com/callback",
+			"response_type":         "code",
+			"state":                 "test-state",
+			"nonce":                 "test-nonce",
+			"code_challenge":        challenge,
+			"code_challenge_method": "S256",
+		}
+	}
+
+	// Unregistered redirect URI -- should fail without a redirectable error
+	data := authorizeData()
+	data["redirect_uri"] = "https://evil.example.com/callback"
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/provider/test-provider/authorize",
+		Operation: logical.UpdateOperation,
+		Storage:   storage,
+		EntityID:  "test-entity-id",
+		Data:      data,
+	})
+	expectError(t, resp, err)
+
+	// Public clients must use PKCE
+	data = authorizeData()
+	delete(data, "code_challenge")
+	delete(data, "code_challenge_method")
+	status, body := authorize(data)
+	if status != 400 || body["error"] != "invalid_request" || body["state"] != "test-state" {
+		t.Fatalf("bad response: %d %#v", status, body)
+	}
+
+	// The openid scope is required
+	data = authorizeData()
+	data["scope"] = "email"
+	status, body = authorize(data)
+	if status != 400 || body["error"] != "invalid_scope" {
+		t.Fatalf("bad response: %d %#v", status, body)
+	}
+
+	status, body = authorize(authorizeData())
+	if status != 200 || body["state"] != "test-state" || body["code"] == "" {
+		t.Fatalf("bad response: %d %#v", status, body)
+	}
+	code := body["code"].(string)
+
+	exchange := func(code, verifier string) (int, map[string]interface{}) {
+		t.Helper()
+		resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+			Path:      "oidc/provider/test-provider/token",
+			Operation: logical.UpdateOperation,
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"grant_type":    "authorization_code",
+				"code":          code,
+				"redirect_uri":  "https://app.example.com/callback",
+				"client_id":     clientID,
+				"code_verifier": verifier,
+			},
+		})
+		expectSuccess(t, resp, err)
+		return decodeRawBody(t, resp)
+	}
+
+	// A wrong code verifier -- should fail and consume the code
+	status, body = exchange(code, strings.Repeat("x", 50))
+	if status != 400 || body["error"] != "invalid_grant" {
+		t.Fatalf("bad response: %d %#v", status, body)
+	}
+	status, body = exchange(code, verifier)
+	if status != 400 || body["error"] != "invalid_grant" {
+		t.Fatalf("expected the code to be single use, got: %d %#v", status, body)
+	}
+
+	_, body = authorize(authorizeData())
+	status, body = exchange(body["code"].(string), verifier)
+	if status != 200 || body["token_type"] != "Bearer" {
+		t.Fatalf("bad response: %d %#v", status, body)
+	}
+
+	// Validate the ID token against the keys of the provider
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/provider/test-provider/.well-known/keys",
+		Operation: logical.ReadOperation,
+		Storage:   storage,
+	})
+	expectSuccess(t, resp, err)
+	jwks := &jose.JSONWebKeySet{}
+	if err := json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), jwks); err != nil {
+		t.Fatal(err)
+	}
+	if len(jwks.Keys) != 1 {
+		t.Fatalf("expected one key, got %d", len(jwks.Keys))
+	}
+
+	rawIDToken := body["id_token"].(string)
+	idToken, err := jwt.ParseSigned(rawIDToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := map[string]interface{}{}
+	if err := idToken.Claims(jwks.Keys[0], &claims); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]interface{}{
+		"iss":   issuer,
+		"sub":   "test-entity-id",
+		"aud":   clientID,
+		"nonce": "test-nonce",
+		"email": "test@example.com",
+	} {
+		if claims[k] != v {
+			t.Fatalf("bad %q claim: %v", k, claims[k])
+		}
+	}
+	expectedAtHash, err := tokenHash("RS256", body["access_token"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["at_hash"] != expectedAtHash {
+		t.Fatalf("bad at_hash claim: %v", claims["at_hash"])
+	}
+
+	userInfo := func(token string) (int, map[string]interface{}) {
+		t.Helper()
+		resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+			Path:        "oidc/provider/test-provider/userinfo",
+			Operation:   logical.ReadOperation,
+			Storage:     storage,
+			ClientToken: token,
+		})
+		expectSuccess(t, resp, err)
+		return decodeRawBody(t, resp)
+	}
+
+	status, body = userInfo(body["access_token"].(string))
+	if status != 200 {
+		t.Fatalf("bad response: %d %#v", status, body)
+	}
+	expectedUserInfo := map[string]interface{}{
+		"sub":   "test-entity-id",
+		"email": "test@example.com",
+	}
+	if diff := deep.Equal(expectedUserInfo, body); diff != nil {
+		t.Fatal(diff)
+	}
+
+	// ID tokens are not access tokens
+	status, body = userInfo(rawIDToken)
+	if status != 401 || body["error"] != "invalid_token" {
+		t.Fatalf("bad response: %d %#v", status, body)
+	}
+}
+
+func TestOIDC_Provider_ConfidentialClient(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+	storage := &logical.InmemStorage{}
+
+	clientID, clientSecret := testProviderSetup(t, c, ctx, storage, "confidential")
+
+	authorize := func() string {
+		t.Helper()
+		resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+			Path:      "oidc/provider/test-provider/authorize",
+			Operation: logical.ReadOperation,
+			Storage:   storage,
+			EntityID:  "test-entity-id",
+			Data: map[string]interface{}{
+				"client_id":     clientID,
+				"scope":         "openid",
+				"redirect_uri":  "https://app.example.com/callback",
+				"response_type": "code",
+			},
+		})
+		expectSuccess(t, resp, err)
+		_, body := decodeRawBody(t, resp)
+		return body["code"].(string)
+	}
+
+	exchange := func(code string, headers map[string][]string, data map[string]interface{}) (int, map[string]interface{}) {
+		t.Helper()
+		data["grant_type"] = "authorization_code"
+		data["code"] = code
+		data["redirect_uri"] = "https://app.example.com/callback"
+		resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+			Path:      "oidc/provider/test-provider/token",
+			Operation: logical.UpdateOperation,
+			Storage:   storage,
+			Headers:   headers,
+			Data:      data,
+		})
+		expectSuccess(t, resp, err)
+		return decodeRawBody(t, resp)
+	}
+
+	// Wrong client secret -- should fail
+	status, body := exchange(authorize(), nil, map[string]interface{}{
+		"client_id":     clientID,
+		"client_secret": "wrong",
+	})
+	if status != 401 || body["error"] != "invalid_client" {
+		t.Fatalf("bad response: %d %#v", status, body)
+	}
+
+	// client_secret_post
+	status, body = exchange(authorize(), nil, map[string]interface{}{
+		"client_id":     clientID,
+		"client_secret": clientSecret,
+	})
+	if status != 200 || body["id_token"] == nil {
+		t.Fatalf("bad response: %d %#v", status, body)
+	}
+
+	// client_secret_basic
+	basic := base64.StdEncoding.EncodeToString([]byte(clientID + ":" + clientSecret))
+	status, body = exchange(authorize(), map[string][]string{
+		"Authorization": {"Basic " + basic},
+	}, map[string]interface{}{})
+	if status != 200 || body["id_token"] == nil {
+		t.Fatalf("bad response: %d %#v", status, body)
+	}
+
+	// Entities outside the client's assignments are denied
+	resp, err := c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/assignment/test-assignment",
+		Operation: logical.UpdateOperation,
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"entity_ids": []string{},
+		},
+	})
+	expectSuccess(t, resp, err)
+	resp, err = c.identityStore.HandleRequest(ctx, &logical.Request{
+		Path:      "oidc/provider/test-provider/authorize",
+		Operation: logical.ReadOperation,
+		Storage:   storage,
+		EntityID:  "test-entity-id",
+		Data: map[string]interface{}{
+			"client_id":     clientID,
+			"scope":         "openid",
+			"redirect_uri":  "https://app.example.com/callback",
+			"response_type": "code",
+		},
+	})
+	expectSuccess(t, resp, err)
+	status, body = decodeRawBody(t, resp)
+	if status != 403 || body["error"] != "access_denied" {
+		t.Fatalf("bad response: %d %#v", status, body)
+	}
+}
+
+// TestOIDC_Provider_UserinfoThroughCore tests that access tokens issued by a
+// provider reach its userinfo endpoint through the router, which would
+// otherwise salt them as Vault tokens
+func TestOIDC_Provider_UserinfoThroughCore(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+
+	clientID, _ := testProviderSetup(t, c, ctx, c.identityStore.view, "public")
+
+	te := &logical.TokenEntry{
+		Path:     "test",
+		Policies: []string{"root"},
+		EntityID: "test-entity-id",
+		TTL:      time.Hour,
+	}
+	testMakeTokenDirectly(t, c.tokenStore, te)
+
+	verifier := strings.Repeat("v", 50)
+	sum := sha256.Sum256([]byte(verifier))
+	resp, err := c.HandleRequest(ctx, &logical.Request{
+		Path:        "identity/oidc/provider/test-provider/authorize",
+		Operation:   logical.UpdateOperation,
+		ClientToken: te.ID,
+		Data: map[string]interface{}{
+			"client_id":             clientID,
+			"scope":                 "openid email",
+			"redirect_uri":          "https://app.example.com/callback",
+			"response_type":         "code",
+			"code_challenge":        base64.RawURLEncoding.EncodeToString(sum[:]),
+			"code_challenge_method": "S256",
+		},
+	})
+	expectSuccess(t, resp, err)
+	status, body := decodeRawBody(t, resp)
+	if status != 200 || body["code"] == "" {
+		t.Fatalf("bad response: %d %#v", status, body)
+	}
+
+	resp, err = c.HandleRequest(ctx, &logical.Request{
+		Path:      "identity/oidc/provider/test-provider/token",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"grant_type":    "authorization_code",
+			"code":          body["code"],
+			"redirect_uri":  "https://app.example.com/callback",
+			"client_id":     clientID,
+			"code_verifier": verifier,
+		},
+	})
+	expectSuccess(t, resp, err)
+	status, body = decodeRawBody(t, resp)
+	if status != 200 || body["access_token"] == nil {
+		t.Fatalf("bad response: %d %#v", status, body)
+	}
+
+	userInfo := func(token string) (int, map[string]interface{}) {
+		t.Helper()
+		resp, err := c.HandleRequest(ctx, &logical.Request{
+			Path:        "identity/oidc/provider/test-provider/userinfo",
+			Operation:   logical.ReadOperation,
+			ClientToken: token,
+		})
+		expectSuccess(t, resp, err)
+		return decodeRawBody(t, resp)
+	}
+
+	status, body = userInfo(body["access_token"].(string))
+	if status != 200 {
+		t.Fatalf("bad response: %d %#v", status, body)
+	}
+	expectedUserInfo := map[string]interface{}{
+		"sub":   "test-entity-id",
+		"email": "test@example.com",
+	}
+	if diff := deep.Equal(expectedUserInfo, body); diff != nil {
+		t.Fatal(diff)
+	}
+
+	// Vault tokens are not access tokens
+	status, body = userInfo(te.ID)
+	if status != 401 || body["error"] != "invalid_token" {
+		t.Fatalf("bad response: %d %#v", status, body)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/hashicorp/vault/helper/storagepacker"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
+	cache "github.com/patrickmn/go-cache"
 )
 
 const (
@@ -63,6 +64,21 @@ type IdentityStore struct {
 	// will invalidate the cache.
 	oidcCache *oidcCache
 
+	// oidcAuthCodeCache holds the authorization codes issued by OIDC
+	// providers until they are exchanged for tokens or expire
+	oidcAuthCodeCache *oidcCache
+
+	// mfaLock protects the MFA configuration and the logins waiting for MFA
+	mfaLock sync.Mutex
+
+	// loginMFACache holds the logins waiting for their MFA requirement to be
+	// satisfied at sys/mfa/validate, indexed by MFA request ID
+	loginMFACache *cache.Cache
+
+	// mfaUsedCodes holds the recently used TOTP codes so that each code can
+	// only be used once
+	mfaUsedCodes *cache.Cache
+
 	// logger is the server logger copied over from core
 	logger log.Logger
 
@@ -142,6 +142,7 @@ func NewSystemBackend(core *Core, logger log.Logger) *SystemBackend {
 				"rekey-recovery-key/init",
 				"rekey-recovery-key/update",
 				"rekey-recovery-key/verify",
+				"mfa/validate",
 			},
 
 			LocalStorage: []string{
@@ -162,6 +163,7 @@ func NewSystemBackend(core *Core, logger log.Logger) *SystemBackend {
 	b.Backend.Paths = append(b.Backend.Paths, b.authPaths()...)
 	b.Backend.Paths = append(b.Backend.Paths, b.leasePaths()...)
 	b.Backend.Paths = append(b.Backend.Paths, b.policyPaths()...)
+	b.Backend.Paths = append(b.Backend.Paths, b.passwordPolicyPaths()...)
 	b.Backend.Paths = append(b.Backend.Paths, b.wrappingPaths()...)
 	b.Backend.Paths = append(b.Backend.Paths, b.toolsPaths()...)
 	b.Backend.Paths = append(b.Backend.Paths, b.capabilitiesPaths()...)
@@ -170,6 +172,9 @@ func NewSystemBackend(core *Core, logger log.Logger) *SystemBackend {
 	b.Backend.Paths = append(b.Backend.Paths, b.remountPath())
 	b.Backend.Paths = append(b.Backend.Paths, b.metricsPath())
 	b.Backend.Paths = append(b.Backend.Paths, b.hostInfoPath())
+	b.Backend.Paths = append(b.Backend.Paths, b.quotasPaths()...)
+	b.Backend.Paths = append(b.Backend.Paths, b.controlGroupPaths()...)
+	b.Backend.Paths = append(b.Backend.Paths, b.mfaPaths()...)
 
 	if core.rawEnabled {
 		b.Backend.Paths = append(b.Backend.Paths, &framework.Path{
@@ -226,6 +231,9 @@ type SystemBackend struct {
 	mfaLock   *sync.RWMutex
 	mfaLogger log.Logger
 	logger    log.Logger
+
+	// controlGroupLock serializes updates to control group requests
+	controlGroupLock sync.Mutex
 }
 
 // handleCORSRead returns the current CORS configuration
@@ -285,6 +293,30 @@ func (b *SystemBackend) handleTidyLeases(ctx context.Context, req *logical.Reque
 	return logical.RespondWithStatusCode(resp, req, http.StatusAccepted)
 }
 
+// handleLeasesCount returns the number of secret leases per mount
+func (b *SystemBackend) handleLeasesCount(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.TrimPrefix(d.Get("prefix").(string), "/")
+
+	var total int
+	counts := make(map[string]interface{})
+	for mountPath, count := range b.Core.expiration.LeaseCounts(ns.Path + prefix) {
+		counts[strings.TrimPrefix(mountPath, ns.Path)] = count
+		total += count
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"lease_count": total,
+			"counts":      counts,
+		},
+	}, nil
+}
+
 func (b *SystemBackend) handlePluginCatalogTypedList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	pluginType, err := consts.ParsePluginType(d.Get("type").(string))
 	if err != nil {
@@ -2486,7 +2518,7 @@ func (b *SystemBackend) handleWrappingUnwrap(ctx context.Context, req *logical.R
 	var response string
 	switch te.Policies[0] {
 	case controlGroupPolicyName:
-		response, err = controlGroupUnwrap(unwrapCtx, b, token, thirdParty)
+		response, err = controlGroupUnwrap(unwrapCtx, b, req, token, thirdParty)
 	case responseWrappingPolicyName:
 		response, err = b.responseWrappingUnwrap(unwrapCtx, te, thirdParty)
 	}
@@ -3927,6 +3959,14 @@ necessary, and is only required if upgrade notes or support personnel suggest
 it.`,
 	},
 
+	"leases-count": {
+		"Returns the number of secret leases per mount.",
+		`This endpoint returns the number of secret leases currently tracked by the
+expiration manager for each mount, optionally limited to the mounts under a
+given prefix, along with their total. These are the counts that lease count
+quotas are enforced against.`,
+	},
+
 	"wrap": {
 		"Response-wraps an arbitrary JSON object.",
 		`Round trips the given input data into a response-wrapped token.`,
@@ -0,0 +1,226 @@
+package vault
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// controlGroupPaths returns paths to authorize and inspect control group
+// requests
+func (b *SystemBackend) controlGroupPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "control-group/authorize$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"accessor": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The accessor of the control group token.",
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleControlGroupAuthorize,
+					Summary:  "Authorizes a control group request.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysControlGroupHelp["authorize"][0]),
+			HelpDescription: strings.TrimSpace(sysControlGroupHelp["authorize"][1]),
+		},
+		{
+			Pattern: "control-group/request$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"accessor": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The accessor of the control group token.",
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleControlGroupRequest,
+					Summary:  "Checks the status of a control group request.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysControlGroupHelp["request"][0]),
+			HelpDescription: strings.TrimSpace(sysControlGroupHelp["request"][1]),
+		},
+	}
+}
+
+// controlGroupRequest loads the control group token and request with the
+// accessor given in the request data
+func (b *SystemBackend) controlGroupRequest(ctx context.Context, d *framework.FieldData) (*logical.TokenEntry, *controlGroupEntry, *logical.Response, error) {
+	accessor := d.Get("accessor").(string)
+	if accessor == "" {
+		return nil, nil, logical.ErrorResponse("missing accessor"), logical.ErrInvalidRequest
+	}
+
+	te, err := b.Core.controlGroupToken(ctx, accessor)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if te == nil {
+		return nil, nil, logical.ErrorResponse("control group request not found"), logical.ErrInvalidRequest
+	}
+
+	entry, err := b.Core.loadControlGroupEntry(ctx, te.Accessor)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if entry == nil {
+		return nil, nil, logical.ErrorResponse("control group request not found"), logical.ErrInvalidRequest
+	}
+
+	return te, entry, nil, nil
+}
+
+func (b *SystemBackend) handleControlGroupAuthorize(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.controlGroupLock.Lock()
+	defer b.controlGroupLock.Unlock()
+
+	te, entry, resp, err := b.controlGroupRequest(ctx, d)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	if req.EntityID == "" {
+		return logical.ErrorResponse("control group requests can only be authorized by tokens with an entity"), logical.ErrPermissionDenied
+	}
+	if req.EntityID == entry.EntityID {
+		return logical.ErrorResponse("control group requests cannot be authorized by the requester"), logical.ErrPermissionDenied
+	}
+
+	for _, authz := range entry.Authorizations {
+		if authz.EntityID == req.EntityID {
+			return &logical.Response{
+				Data: map[string]interface{}{
+					"approved": entry.approved(),
+				},
+			}, nil
+		}
+	}
+
+	factors, err := b.controlGroupFactorsForEntity(entry, req.EntityID)
+	if err != nil {
+		return nil, err
+	}
+	if len(factors) == 0 {
+		return logical.ErrorResponse("not a member of any of the groups that can authorize this request"), logical.ErrPermissionDenied
+	}
+
+	entry.Authorizations = append(entry.Authorizations, &controlGroupAuthz{
+		EntityID:          req.EntityID,
+		Factors:           factors,
+		AuthorizationTime: time.Now(),
+	})
+	if err := b.Core.storeControlGroupEntry(ctx, te.Accessor, entry); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"approved": entry.approved(),
+		},
+	}, nil
+}
+
+// controlGroupFactorsForEntity returns the names of the factors of the
+// request that the entity's group memberships allow it to authorize
+func (b *SystemBackend) controlGroupFactorsForEntity(entry *controlGroupEntry, entityID string) ([]string, error) {
+	direct, inherited, err := b.Core.identityStore.groupsByEntityID(entityID)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := append(direct, inherited...)
+
+	var factors []string
+	for _, factor := range entry.Factors {
+		for _, group := range groups {
+			if strutil.StrListContains(factor.Identity.GroupIDs, group.ID) ||
+				(group.NamespaceID == entry.NamespaceID && strutil.StrListContains(factor.Identity.GroupNames, group.Name)) {
+				factors = append(factors, factor.Name)
+				break
+			}
+		}
+	}
+
+	return factors, nil
+}
+
+func (b *SystemBackend) handleControlGroupRequest(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	_, entry, resp, err := b.controlGroupRequest(ctx, d)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+
+	authorizations := make([]map[string]interface{}, 0, len(entry.Authorizations))
+	for _, authz := range entry.Authorizations {
+		authorizations = append(authorizations, map[string]interface{}{
+			"entity_id":   authz.EntityID,
+			"entity_name": b.controlGroupEntityName(authz.EntityID),
+		})
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"approved":     entry.approved(),
+			"request_path": entry.Path,
+			"request_entity": map[string]interface{}{
+				"id":   entry.EntityID,
+				"name": b.controlGroupEntityName(entry.EntityID),
+			},
+			"authorizations": authorizations,
+		},
+	}, nil
+}
+
+// controlGroupEntityName returns the name of the entity, or an empty string
+// if it no longer exists
+func (b *SystemBackend) controlGroupEntityName(entityID string) string {
+	if entityID == "" {
+		return ""
+	}
+
+	entity, err := b.Core.identityStore.MemDBEntityByID(entityID, false)
+	if err != nil {
+		b.logger.Warn("failed to look up entity of control group request", "entity_id", entityID, "error", err)
+		return ""
+	}
+	if entity == nil {
+		return ""
+	}
+	return entity.Name
+}
+
+var sysControlGroupHelp = map[string][2]string{
+	"authorize": {
+		"Authorizes a control group request.",
+		`
+Requests on paths whose policy has a control_group stanza return a wrapping
+token instead of a response. The request is only served, when the token is
+unwrapped, once each factor of the control group has been authorized by the
+required number of members of its identity groups. Members authorize a
+request using the accessor of its wrapping token. Requesters cannot authorize
+their own requests.
+		`,
+	},
+	"request": {
+		"Checks the status of a control group request.",
+		`
+Returns the path and requesting entity of the control group request with the
+given wrapping token accessor, the entities that have authorized it so far,
+and whether it has been approved.
+		`,
+	},
+}
@@ -2,7 +2,6 @@ package vault
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -26,10 +25,6 @@ var (
 	addSentinelPolicyData     = func(map[string]interface{}, *Policy) {}
 	inputSentinelPolicyData   = func(*framework.FieldData, *Policy) *logical.Response { return nil }
 
-	controlGroupUnwrap = func(context.Context, *SystemBackend, string, bool) (string, error) {
-		return "", errors.New("control groups unavailable")
-	}
-
 	pathInternalUINamespacesRead = func(b *SystemBackend) framework.OperationFunc {
 		return func(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
 			// Short-circuit here if there's no client token provided
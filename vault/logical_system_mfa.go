@@ -0,0 +1,98 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// mfaValidatePath is where logins waiting for MFA are completed
+const mfaValidatePath = "sys/mfa/validate"
+
+// mfaPaths returns the path used to complete logins requiring MFA
+func (b *SystemBackend) mfaPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "mfa/validate$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"mfa_request_id": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The MFA request ID returned by the login.",
+				},
+				"mfa_payload": &framework.FieldSchema{
+					Type:        framework.TypeMap,
+					Description: "A map from MFA method names to a list of their credentials, such as a passcode. Methods without passcodes take an empty list.",
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleMFAValidate,
+					Summary:  "Validates the MFA credentials of a login and returns its token.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysMFAHelp["validate"][0]),
+			HelpDescription: strings.TrimSpace(sysMFAHelp["validate"][1]),
+		},
+	}
+}
+
+func (b *SystemBackend) handleMFAValidate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	requestID := d.Get("mfa_request_id").(string)
+	if requestID == "" {
+		return logical.ErrorResponse("missing mfa_request_id"), logical.ErrInvalidRequest
+	}
+
+	creds, err := parseMFAPayload(d.Get("mfa_payload").(map[string]interface{}))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	return b.Core.validateLoginMFA(ctx, req, requestID, creds)
+}
+
+// parseMFAPayload converts the payload of a validation request, whose
+// values may be a single credential or a list of them, to MFA credentials
+func parseMFAPayload(payload map[string]interface{}) (logical.MFACreds, error) {
+	creds := make(logical.MFACreds, len(payload))
+	for name, raw := range payload {
+		switch v := raw.(type) {
+		case nil:
+			creds[name] = []string{}
+		case string:
+			creds[name] = []string{v}
+		case []interface{}:
+			values := make([]string, 0, len(v))
+			for _, item := range v {
+				value, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("invalid credentials for MFA method %q", name)
+				}
+				values = append(values, value)
+			}
+			creds[name] = values
+		default:
+			return nil, fmt.Errorf("invalid credentials for MFA method %q", name)
+		}
+	}
+	return creds, nil
+}
+
+var sysMFAHelp = map[string][2]string{
+	"validate": {
+		"Validates the MFA credentials of a login and returns its token.",
+		`
+Logins that an MFA login enforcement applies to return an MFA requirement
+instead of a token. The requirement has a request ID and a set of
+constraints, each of which must be satisfied by the credentials of one of its
+methods. Once the credentials given here satisfy every constraint, the token
+of the login is returned. Logins expire after five minutes and are discarded
+after five failed validations.
+		`,
+	},
+}
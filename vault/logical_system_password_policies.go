@@ -0,0 +1,266 @@
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/random"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// passwordPolicySubPath is the sub-path of the system barrier view where
+// password policies are stored
+const passwordPolicySubPath = "password_policy/"
+
+// passwordPolicyConfig is the stored form of a password policy
+type passwordPolicyConfig struct {
+	HCLPolicy string `json:"policy"`
+}
+
+// passwordPolicyPaths returns the paths used to manage password policies and
+// to generate passwords from them
+func (b *SystemBackend) passwordPolicyPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "policies/password/?$",
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.handlePasswordPoliciesList,
+					Summary:  "List the names of the password policies.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysPasswordPolicyHelp["password-policy-list"][0]),
+			HelpDescription: strings.TrimSpace(sysPasswordPolicyHelp["password-policy-list"][1]),
+		},
+
+		{
+			Pattern: "policies/password/" + framework.GenericNameRegex("name") + "/generate$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The name of the password policy.",
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handlePasswordPoliciesGenerate,
+					Summary:  "Generate a password from the named password policy.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysPasswordPolicyHelp["password-policy-generate"][0]),
+			HelpDescription: strings.TrimSpace(sysPasswordPolicyHelp["password-policy-generate"][1]),
+		},
+
+		{
+			Pattern: "policies/password/" + framework.GenericNameRegex("name") + "$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The name of the password policy.",
+				},
+				"policy": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The password policy, in HCL. This can be base64-encoded to avoid string escaping.",
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handlePasswordPoliciesRead,
+					Summary:  "Retrieve the named password policy.",
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handlePasswordPoliciesSet,
+					Summary:  "Add a new or update an existing password policy.",
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.handlePasswordPoliciesDelete,
+					Summary:  "Delete the named password policy.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysPasswordPolicyHelp["password-policy"][0]),
+			HelpDescription: strings.TrimSpace(sysPasswordPolicyHelp["password-policy"][1]),
+		},
+	}
+}
+
+func (b *SystemBackend) handlePasswordPoliciesList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	view := b.Core.systemBarrierView.SubView(passwordPolicySubPath)
+	names, err := view.List(ctx, "")
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to list password policies: {{err}}", err)
+	}
+	return logical.ListResponse(names), nil
+}
+
+func (b *SystemBackend) handlePasswordPoliciesRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Core.passwordPolicyConfig(ctx, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"policy": config.HCLPolicy,
+		},
+	}, nil
+}
+
+func (b *SystemBackend) handlePasswordPoliciesSet(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	rawPolicy := d.Get("policy").(string)
+	if rawPolicy == "" {
+		return logical.ErrorResponse("missing policy"), logical.ErrInvalidRequest
+	}
+	if polBytes, err := base64.StdEncoding.DecodeString(rawPolicy); err == nil {
+		rawPolicy = string(polBytes)
+	}
+
+	policy, err := random.ParsePolicy(rawPolicy)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	// Reject policies whose rules cannot be satisfied by generated passwords
+	// now rather than when a password is first needed
+	if _, err := policy.Generate(ctx, nil); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("unable to generate a password from the policy: %s", err)), logical.ErrInvalidRequest
+	}
+
+	entry, err := logical.StorageEntryJSON(name, &passwordPolicyConfig{
+		HCLPolicy: rawPolicy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	view := b.Core.systemBarrierView.SubView(passwordPolicySubPath)
+	if err := view.Put(ctx, entry); err != nil {
+		return nil, errwrap.Wrapf("failed to save password policy: {{err}}", err)
+	}
+
+	return nil, nil
+}
+
+func (b *SystemBackend) handlePasswordPoliciesDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	view := b.Core.systemBarrierView.SubView(passwordPolicySubPath)
+	if err := view.Delete(ctx, d.Get("name").(string)); err != nil {
+		return nil, errwrap.Wrapf("failed to delete password policy: {{err}}", err)
+	}
+	return nil, nil
+}
+
+func (b *SystemBackend) handlePasswordPoliciesGenerate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	policy, err := b.Core.passwordPolicy(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return logical.ErrorResponse(fmt.Sprintf("password policy %q not found", name)), logical.ErrInvalidRequest
+	}
+
+	password, err := policy.Generate(ctx, nil)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to generate password: {{err}}", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"password": password,
+		},
+	}, nil
+}
+
+// passwordPolicyConfig returns the stored form of the named password policy,
+// or nil if it does not exist
+func (c *Core) passwordPolicyConfig(ctx context.Context, name string) (*passwordPolicyConfig, error) {
+	view := c.systemBarrierView.SubView(passwordPolicySubPath)
+	entry, err := view.Get(ctx, name)
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to read password policy: {{err}}", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var config passwordPolicyConfig
+	if err := entry.DecodeJSON(&config); err != nil {
+		return nil, errwrap.Wrapf("failed to decode password policy: {{err}}", err)
+	}
+	return &config, nil
+}
+
+// passwordPolicy returns the named password policy, or nil if it does not
+// exist
+func (c *Core) passwordPolicy(ctx context.Context, name string) (*random.StringGenerator, error) {
+	config, err := c.passwordPolicyConfig(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	policy, err := random.ParsePolicy(config.HCLPolicy)
+	if err != nil {
+		return nil, errwrap.Wrapf(fmt.Sprintf("stored password policy %q is invalid: {{err}}", name), err)
+	}
+	return policy, nil
+}
+
+var sysPasswordPolicyHelp = map[string][2]string{
+	"password-policy-list": {
+		"List the names of the password policies.",
+		"",
+	},
+	"password-policy": {
+		"Read, write and delete password policies.",
+		`
+Password policies set the length of the passwords generated from them and the
+rules those passwords must satisfy. Charset rules set the characters passwords
+are made of and the minimum number of characters from each charset, and
+dictionary rules reject passwords containing any of their words, ignoring
+case. For example:
+
+	length = 20
+
+	rule "charset" {
+	  charset = "abcdefghijklmnopqrstuvwxyz"
+	  min-chars = 1
+	}
+
+	rule "charset" {
+	  charset = "0123456789"
+	  min-chars = 1
+	}
+
+	rule "dictionary" {
+	  words = ["password", "vault"]
+	}
+
+Backends may generate passwords from policies, such as database roles, or
+validate passwords against them, such as the userpass auth method. Passwords
+validated against a policy must be at least as long as its length, and may
+contain characters outside of its charsets.
+		`,
+	},
+	"password-policy-generate": {
+		"Generate a password from the named password policy.",
+		"",
+	},
+}
@@ -0,0 +1,114 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+	"unicode"
+
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const testPasswordPolicy = `
+length = 16
+
+rule "charset" {
+  charset = "abcdefghijklmnopqrstuvwxyz"
+  min-chars = 1
+}
+
+rule "charset" {
+  charset = "0123456789"
+  min-chars = 4
+}
+
+rule "dictionary" {
+  words = ["vault"]
+}
+`
+
+func TestSystemBackend_PasswordPolicies(t *testing.T) {
+	c, b, _ := testCoreSystemBackend(t)
+	ctx := namespace.RootContext(nil)
+
+	// Policies are validated on write, including whether passwords can be
+	// generated from them
+	invalid := []string{
+		"",
+		"length = 8",
+		`length = 4 rule "charset" { charset = "abc" min-chars = 8 }`,
+		`length = 4 rule "charset" { charset = "ab" } rule "dictionary" { words = ["a", "b"] }`,
+	}
+	for _, policy := range invalid {
+		req := logical.TestRequest(t, logical.UpdateOperation, "policies/password/test")
+		req.Data["policy"] = policy
+		resp, err := b.HandleRequest(ctx, req)
+		if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+			t.Fatalf("expected an error for policy %q, got: resp: %#v\nerr: %v", policy, resp, err)
+		}
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "policies/password/test")
+	req.Data["policy"] = testPasswordPolicy
+	resp, err := b.HandleRequest(ctx, req)
+	if err != nil || resp != nil {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "policies/password/test")
+	resp, err = b.HandleRequest(ctx, req)
+	if err != nil || resp == nil || resp.Data["policy"] != testPasswordPolicy {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+
+	req = logical.TestRequest(t, logical.ListOperation, "policies/password/")
+	resp, err = b.HandleRequest(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"test"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "policies/password/test/generate")
+	resp, err = b.HandleRequest(ctx, req)
+	if err != nil || resp == nil {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	password := resp.Data["password"].(string)
+	digits := 0
+	for _, r := range password {
+		if unicode.IsDigit(r) {
+			digits++
+		}
+	}
+	if len(password) != 16 || digits < 4 {
+		t.Fatalf("bad: password: %q", password)
+	}
+
+	// The system view generates and validates passwords for backends
+	sysView := TestDynamicSystemView(c)
+	if _, err := sysView.GeneratePasswordFromPolicy(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sysView.ValidatePasswordWithPolicy(ctx, "test", "abcdefghijkl1234"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sysView.ValidatePasswordWithPolicy(ctx, "test", "abcdvaultijkl1234"); err == nil {
+		t.Fatal("expected an error for a password containing a dictionary word")
+	}
+	if err := sysView.ValidatePasswordWithPolicy(ctx, "missing", "abcdefghijkl1234"); err == nil {
+		t.Fatal("expected an error for a missing policy")
+	}
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "policies/password/test")
+	if _, err := b.HandleRequest(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "policies/password/test/generate")
+	resp, err = b.HandleRequest(ctx, req)
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error generating from a deleted policy, got: resp: %#v\nerr: %v", resp, err)
+	}
+}
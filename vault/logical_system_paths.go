@@ -1120,6 +1120,28 @@ func (b *SystemBackend) leasePaths() []*framework.Path {
 			HelpSynopsis:    strings.TrimSpace(sysHelp["tidy_leases"][0]),
 			HelpDescription: strings.TrimSpace(sysHelp["tidy_leases"][1]),
 		},
+
+		{
+			Pattern: "leases/count$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"prefix": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Only count the leases of mounts under this path prefix.",
+					Query:       true,
+				},
+			},
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleLeasesCount,
+					Summary:  "Returns the number of secret leases per mount.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["leases-count"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["leases-count"][1]),
+		},
 	}
 }
 
@@ -0,0 +1,426 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault/quotas"
+)
+
+// quotasPaths returns paths to manage rate limit and lease count quotas
+func (b *SystemBackend) quotasPaths() []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "quotas/rate-limit/?$",
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.handleRateLimitQuotasList(),
+					Summary:  "Lists the names of the rate limit quotas of the namespace.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysQuotasHelp["rate-limit-list"][0]),
+			HelpDescription: strings.TrimSpace(sysQuotasHelp["rate-limit-list"][1]),
+		},
+		{
+			Pattern: "quotas/rate-limit/" + framework.GenericNameRegex("name"),
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The name of the quota.",
+				},
+				"path": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The mount the quota applies to, e.g. 'secret/'. If not set, the quota applies to the whole namespace it is created in, which for the root namespace means every request.",
+				},
+				"rate": &framework.FieldSchema{
+					Type:        framework.TypeInt,
+					Description: "The number of requests allowed per interval. Must be positive.",
+				},
+				"interval": &framework.FieldSchema{
+					Type:        framework.TypeDurationSecond,
+					Description: "The interval over which the rate is measured. Defaults to 1s.",
+				},
+				"burst": &framework.FieldSchema{
+					Type:        framework.TypeInt,
+					Description: "The maximum number of requests allowed at once. Defaults to the rate.",
+				},
+				"per_client_address": &framework.FieldSchema{
+					Type:        framework.TypeBool,
+					Description: "If set, the rate is enforced separately for each client IP address instead of across all clients.",
+				},
+			},
+
+			ExistenceCheck: b.handleRateLimitQuotasExistenceCheck(),
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.handleRateLimitQuotasUpdate(),
+					Summary:  "Creates a rate limit quota.",
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleRateLimitQuotasUpdate(),
+					Summary:  "Updates a rate limit quota.",
+				},
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleRateLimitQuotasRead(),
+					Summary:  "Returns the configuration of a rate limit quota.",
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.handleRateLimitQuotasDelete(),
+					Summary:  "Deletes a rate limit quota.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysQuotasHelp["rate-limit"][0]),
+			HelpDescription: strings.TrimSpace(sysQuotasHelp["rate-limit"][1]),
+		},
+		{
+			Pattern: "quotas/lease-count/?$",
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.handleLeaseCountQuotasList(),
+					Summary:  "Lists the names of the lease count quotas of the namespace.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysQuotasHelp["lease-count-list"][0]),
+			HelpDescription: strings.TrimSpace(sysQuotasHelp["lease-count-list"][1]),
+		},
+		{
+			Pattern: "quotas/lease-count/" + framework.GenericNameRegex("name"),
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The name of the quota.",
+				},
+				"path": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The mount the quota applies to, e.g. 'database/'. If not set, the quota applies to the whole namespace it is created in, including its child namespaces.",
+				},
+				"max_leases": &framework.FieldSchema{
+					Type:        framework.TypeInt,
+					Description: "The maximum number of leases allowed. Must be positive.",
+				},
+			},
+
+			ExistenceCheck: b.handleLeaseCountQuotasExistenceCheck(),
+
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.CreateOperation: &framework.PathOperation{
+					Callback: b.handleLeaseCountQuotasUpdate(),
+					Summary:  "Creates a lease count quota.",
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.handleLeaseCountQuotasUpdate(),
+					Summary:  "Updates a lease count quota.",
+				},
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.handleLeaseCountQuotasRead(),
+					Summary:  "Returns the configuration of a lease count quota.",
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.handleLeaseCountQuotasDelete(),
+					Summary:  "Deletes a lease count quota.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysQuotasHelp["lease-count"][0]),
+			HelpDescription: strings.TrimSpace(sysQuotasHelp["lease-count"][1]),
+		},
+	}
+}
+
+// quotaMountPath normalizes the mount path of a quota, returning an error
+// response if no such mount exists in the namespace
+func (b *SystemBackend) quotaMountPath(ctx context.Context, ns *namespace.Namespace, path string) (string, *logical.Response) {
+	mountPath := strings.TrimPrefix(path, "/")
+	if mountPath == "" {
+		return "", nil
+	}
+	if !strings.HasSuffix(mountPath, "/") {
+		mountPath += "/"
+	}
+	if b.Core.router.MatchingMount(ctx, mountPath) != ns.Path+mountPath {
+		return "", logical.ErrorResponse(fmt.Sprintf("no mount exists at %q", mountPath))
+	}
+	return mountPath, nil
+}
+
+func (b *SystemBackend) handleRateLimitQuotasList() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		ns, err := namespace.FromContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return logical.ListResponse(b.Core.quotaManager.RateLimitQuotaNames(ns.Path)), nil
+	}
+}
+
+func (b *SystemBackend) handleRateLimitQuotasExistenceCheck() framework.ExistenceFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+		return b.Core.quotaManager.RateLimitQuota(d.Get("name").(string)) != nil, nil
+	}
+}
+
+func (b *SystemBackend) handleRateLimitQuotasUpdate() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		ns, err := namespace.FromContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		name := d.Get("name").(string)
+		q := b.Core.quotaManager.RateLimitQuota(name)
+		if q == nil {
+			q = quotas.NewRateLimitQuota(name, ns.Path, "", 0, 0, 0, false)
+		}
+
+		if q.NamespacePath != ns.Path {
+			return logical.ErrorResponse(fmt.Sprintf("quota %q belongs to a different namespace", name)), logical.ErrInvalidRequest
+		}
+
+		if pathRaw, ok := d.GetOk("path"); ok {
+			mountPath, errResp := b.quotaMountPath(ctx, ns, pathRaw.(string))
+			if errResp != nil {
+				return errResp, logical.ErrInvalidRequest
+			}
+			q.MountPath = mountPath
+		}
+		if rateRaw, ok := d.GetOk("rate"); ok {
+			q.Rate = rateRaw.(int)
+		}
+		if intervalRaw, ok := d.GetOk("interval"); ok {
+			q.Interval = time.Duration(intervalRaw.(int)) * time.Second
+		}
+		if burstRaw, ok := d.GetOk("burst"); ok {
+			q.Burst = burstRaw.(int)
+		}
+		if perClientRaw, ok := d.GetOk("per_client_address"); ok {
+			q.PerClientAddress = perClientRaw.(bool)
+		}
+
+		if q.Rate <= 0 {
+			return logical.ErrorResponse("rate must be positive"), logical.ErrInvalidRequest
+		}
+		if q.Interval < 0 {
+			return logical.ErrorResponse("interval must not be negative"), logical.ErrInvalidRequest
+		}
+		if q.Burst < 0 {
+			return logical.ErrorResponse("burst must not be negative"), logical.ErrInvalidRequest
+		}
+
+		switch err := b.Core.quotaManager.SetRateLimitQuota(ctx, q); err {
+		case nil:
+		case quotas.ErrQuotaPathConflict:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+func (b *SystemBackend) handleRateLimitQuotasRead() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		ns, err := namespace.FromContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		name := d.Get("name").(string)
+		q := b.Core.quotaManager.RateLimitQuota(name)
+		if q == nil {
+			return nil, nil
+		}
+
+		if q.NamespacePath != ns.Path {
+			return logical.ErrorResponse(fmt.Sprintf("quota %q belongs to a different namespace", name)), logical.ErrInvalidRequest
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"name":               q.Name,
+				"type":               quotas.TypeRateLimit,
+				"path":               q.MountPath,
+				"rate":               q.Rate,
+				"interval":           int64(q.Interval.Seconds()),
+				"burst":              q.Burst,
+				"per_client_address": q.PerClientAddress,
+			},
+		}, nil
+	}
+}
+
+func (b *SystemBackend) handleRateLimitQuotasDelete() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		ns, err := namespace.FromContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		name := d.Get("name").(string)
+		q := b.Core.quotaManager.RateLimitQuota(name)
+		if q == nil {
+			return nil, nil
+		}
+
+		if q.NamespacePath != ns.Path {
+			return logical.ErrorResponse(fmt.Sprintf("quota %q belongs to a different namespace", name)), logical.ErrInvalidRequest
+		}
+
+		return nil, b.Core.quotaManager.DeleteRateLimitQuota(ctx, name)
+	}
+}
+
+func (b *SystemBackend) handleLeaseCountQuotasList() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		ns, err := namespace.FromContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return logical.ListResponse(b.Core.quotaManager.LeaseCountQuotaNames(ns.Path)), nil
+	}
+}
+
+func (b *SystemBackend) handleLeaseCountQuotasExistenceCheck() framework.ExistenceFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+		return b.Core.quotaManager.LeaseCountQuota(d.Get("name").(string)) != nil, nil
+	}
+}
+
+func (b *SystemBackend) handleLeaseCountQuotasUpdate() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		ns, err := namespace.FromContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		name := d.Get("name").(string)
+		q := b.Core.quotaManager.LeaseCountQuota(name)
+		if q == nil {
+			q = quotas.NewLeaseCountQuota(name, ns.Path, "", 0)
+		}
+
+		if q.NamespacePath != ns.Path {
+			return logical.ErrorResponse(fmt.Sprintf("quota %q belongs to a different namespace", name)), logical.ErrInvalidRequest
+		}
+
+		if pathRaw, ok := d.GetOk("path"); ok {
+			mountPath, errResp := b.quotaMountPath(ctx, ns, pathRaw.(string))
+			if errResp != nil {
+				return errResp, logical.ErrInvalidRequest
+			}
+			q.MountPath = mountPath
+		}
+		if maxLeasesRaw, ok := d.GetOk("max_leases"); ok {
+			q.MaxLeases = maxLeasesRaw.(int)
+		}
+
+		if q.MaxLeases <= 0 {
+			return logical.ErrorResponse("max_leases must be positive"), logical.ErrInvalidRequest
+		}
+
+		switch err := b.Core.quotaManager.SetLeaseCountQuota(ctx, q); err {
+		case nil:
+		case quotas.ErrQuotaPathConflict:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+func (b *SystemBackend) handleLeaseCountQuotasRead() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		ns, err := namespace.FromContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		name := d.Get("name").(string)
+		q := b.Core.quotaManager.LeaseCountQuota(name)
+		if q == nil {
+			return nil, nil
+		}
+
+		if q.NamespacePath != ns.Path {
+			return logical.ErrorResponse(fmt.Sprintf("quota %q belongs to a different namespace", name)), logical.ErrInvalidRequest
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"name":        q.Name,
+				"type":        quotas.TypeLeaseCount,
+				"path":        q.MountPath,
+				"max_leases":  q.MaxLeases,
+				"lease_count": b.Core.leaseCount(q.NamespacePath, q.MountPath),
+			},
+		}, nil
+	}
+}
+
+func (b *SystemBackend) handleLeaseCountQuotasDelete() framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		ns, err := namespace.FromContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		name := d.Get("name").(string)
+		q := b.Core.quotaManager.LeaseCountQuota(name)
+		if q == nil {
+			return nil, nil
+		}
+
+		if q.NamespacePath != ns.Path {
+			return logical.ErrorResponse(fmt.Sprintf("quota %q belongs to a different namespace", name)), logical.ErrInvalidRequest
+		}
+
+		return nil, b.Core.quotaManager.DeleteLeaseCountQuota(ctx, name)
+	}
+}
+
+var sysQuotasHelp = map[string][2]string{
+	"rate-limit-list": {
+		"Lists the names of the rate limit quotas of the namespace.",
+		"",
+	},
+	"rate-limit": {
+		"Create, update, read and delete rate limit quotas.",
+		`
+Rate limit quotas limit the rate at which requests are accepted, using a token
+bucket that allows up to 'rate' requests per 'interval' with bursts of up to
+'burst' requests. A quota applies to a single mount if 'path' is set, and
+otherwise to the namespace it was created in. When several quotas apply to a
+request, the most specific one is used. Requests exceeding a quota are
+rejected with a 429 status code and a Retry-After header.
+		`,
+	},
+	"lease-count-list": {
+		"Lists the names of the lease count quotas of the namespace.",
+		"",
+	},
+	"lease-count": {
+		"Create, update, read and delete lease count quotas.",
+		`
+Lease count quotas limit the number of secret leases that may exist at once,
+either for a single mount if 'path' is set, or otherwise for the namespace the
+quota was created in. When several quotas apply to a mount, the most specific
+one is used. Requests that would create a lease beyond the quota's
+'max_leases' are rejected and the secret the backend generated is revoked.
+		`,
+	},
+}
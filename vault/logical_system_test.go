@@ -2665,3 +2665,113 @@ func TestSystemBackend_PathWildcardPreflight(t *testing.T) {
 		t.Fatalf("err: %v", err)
 	}
 }
+
+func TestSystemBackend_RateLimitQuotas_Namespace(t *testing.T) {
+	_, b, _ := testCoreSystemBackend(t)
+
+	nsCtx := namespace.ContextWithNamespace(context.Background(), &namespace.Namespace{
+		ID:   "foo",
+		Path: "foo/",
+	})
+	req := logical.TestRequest(t, logical.UpdateOperation, "quotas/rate-limit/foo")
+	req.Data["rate"] = 10
+	if resp, err := b.HandleRequest(nsCtx, req); err != nil || resp != nil {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	rootCtx := namespace.RootContext(nil)
+	req = logical.TestRequest(t, logical.UpdateOperation, "quotas/rate-limit/root")
+	req.Data["rate"] = 10
+	if resp, err := b.HandleRequest(rootCtx, req); err != nil || resp != nil {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+
+	// Quotas are only listed in their own namespace
+	for ctx, expected := range map[context.Context][]string{
+		nsCtx:   {"foo"},
+		rootCtx: {"root"},
+	} {
+		req = logical.TestRequest(t, logical.ListOperation, "quotas/rate-limit")
+		resp, err := b.HandleRequest(ctx, req)
+		if err != nil || resp == nil {
+			t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+		}
+		if !reflect.DeepEqual(resp.Data["keys"], expected) {
+			t.Fatalf("expected %v, got %#v", expected, resp.Data["keys"])
+		}
+	}
+
+	// Quotas of other namespaces can neither be read nor deleted
+	for _, op := range []logical.Operation{logical.ReadOperation, logical.DeleteOperation} {
+		req = logical.TestRequest(t, op, "quotas/rate-limit/foo")
+		resp, err := b.HandleRequest(rootCtx, req)
+		if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+			t.Fatalf("%s: expected an error, got: resp: %#v\nerr: %v", op, resp, err)
+		}
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "quotas/rate-limit/foo")
+	resp, err := b.HandleRequest(nsCtx, req)
+	if err != nil || resp == nil || resp.Data["rate"] != 10 {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "quotas/rate-limit/foo")
+	if resp, err := b.HandleRequest(nsCtx, req); err != nil || resp != nil {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+}
+
+func TestSystemBackend_LeaseCountQuotas_Namespace(t *testing.T) {
+	_, b, _ := testCoreSystemBackend(t)
+
+	nsCtx := namespace.ContextWithNamespace(context.Background(), &namespace.Namespace{
+		ID:   "foo",
+		Path: "foo/",
+	})
+	req := logical.TestRequest(t, logical.UpdateOperation, "quotas/lease-count/foo")
+	req.Data["max_leases"] = 10
+	if resp, err := b.HandleRequest(nsCtx, req); err != nil || resp != nil {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	rootCtx := namespace.RootContext(nil)
+	req = logical.TestRequest(t, logical.UpdateOperation, "quotas/lease-count/root")
+	req.Data["max_leases"] = 10
+	if resp, err := b.HandleRequest(rootCtx, req); err != nil || resp != nil {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+
+	// Quotas are only listed in their own namespace
+	for ctx, expected := range map[context.Context][]string{
+		nsCtx:   {"foo"},
+		rootCtx: {"root"},
+	} {
+		req = logical.TestRequest(t, logical.ListOperation, "quotas/lease-count")
+		resp, err := b.HandleRequest(ctx, req)
+		if err != nil || resp == nil {
+			t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+		}
+		if !reflect.DeepEqual(resp.Data["keys"], expected) {
+			t.Fatalf("expected %v, got %#v", expected, resp.Data["keys"])
+		}
+	}
+
+	// Quotas of other namespaces can neither be read nor deleted
+	for _, op := range []logical.Operation{logical.ReadOperation, logical.DeleteOperation} {
+		req = logical.TestRequest(t, op, "quotas/lease-count/foo")
+		resp, err := b.HandleRequest(rootCtx, req)
+		if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+			t.Fatalf("%s: expected an error, got: resp: %#v\nerr: %v", op, resp, err)
+		}
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "quotas/lease-count/foo")
+	resp, err := b.HandleRequest(nsCtx, req)
+	if err != nil || resp == nil || resp.Data["max_leases"] != 10 {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "quotas/lease-count/foo")
+	if resp, err := b.HandleRequest(nsCtx, req); err != nil || resp != nil {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+}
@@ -0,0 +1,1308 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	duoapi "github.com/duosecurity/duo_api_golang"
+	"github.com/duosecurity/duo_api_golang/authapi"
+	"github.com/hashicorp/errwrap"
+	cleanhttp "github.com/hashicorp/go-cleanhttp"
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/identity"
+	"github.com/hashicorp/vault/helper/identity/mfa"
+	"github.com/hashicorp/vault/helper/mfa/duo"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/jsonutil"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	otplib "github.com/pquerna/otp"
+	totplib "github.com/pquerna/otp/totp"
+)
+
+const (
+	mfaMethodPrefix           = "mfa/method/"
+	mfaLoginEnforcementPrefix = "mfa/login-enforcement/"
+
+	mfaMethodTypeTOTP = "totp"
+	mfaMethodTypeDuo  = "duo"
+	mfaMethodTypePush = "push"
+
+	// loginMFATTL is how long a login may wait for its MFA requirement to be
+	// satisfied at sys/mfa/validate
+	loginMFATTL = 5 * time.Minute
+
+	// loginMFAMaxFailures is the number of failed validations after which a
+	// login waiting for MFA is discarded
+	loginMFAMaxFailures = 5
+
+	// mfaPushSignatureHeader carries the HMAC-SHA256 of the body of push
+	// requests, keyed with the secret of the method
+	mfaPushSignatureHeader = "X-Vault-Signature"
+
+	// mfaPushMaxResponseSize bounds the size of push webhook responses
+	mfaPushMaxResponseSize = 64 * 1024
+)
+
+var errLoginMFANoEntity = errors.New("login requires MFA, which is only available to logins with an entity")
+
+// mfaMethod is an MFA method, referred to by name from login enforcements
+// and from the mfa_methods of policies
+type mfaMethod struct {
+	Type           string `json:"type"`
+	Name           string `json:"name"`
+	UsernameFormat string `json:"username_format"`
+
+	TOTP *mfa.TOTPConfig `json:"totp,omitempty"`
+	Duo  *mfa.DuoConfig  `json:"duo,omitempty"`
+	Push *pushMFAConfig  `json:"push,omitempty"`
+
+	// UsePasscode makes Duo methods require a passcode instead of sending
+	// a push
+	UsePasscode bool `json:"use_passcode"`
+}
+
+// pushMFAConfig configures a webhook which is asked to approve each use of
+// the method, for example by sending a notification to the user's device
+type pushMFAConfig struct {
+	URL     string        `json:"url"`
+	Secret  string        `json:"secret"`
+	Timeout time.Duration `json:"timeout"`
+}
+
+// usesPasscode returns whether the credentials of the method are a passcode
+func (m *mfaMethod) usesPasscode() bool {
+	switch m.Type {
+	case mfaMethodTypeTOTP:
+		return true
+	case mfaMethodTypeDuo:
+		return m.UsePasscode
+	default:
+		return false
+	}
+}
+
+// loginEnforcement requires the logins it applies to to be validated with
+// one of its MFA methods before a token is issued
+type loginEnforcement struct {
+	MFAMethodNames      []string `json:"mfa_method_names"`
+	AuthMethodAccessors []string `json:"auth_method_accessors"`
+	AuthMethodTypes     []string `json:"auth_method_types"`
+	IdentityGroupIDs    []string `json:"identity_group_ids"`
+	IdentityEntityIDs   []string `json:"identity_entity_ids"`
+}
+
+// appliesTo returns whether the enforcement applies to a login on the mount
+// by the entity with the given ID, directly or through its groups
+func (e *loginEnforcement) appliesTo(entry *MountEntry, entityID string, groupIDs []string) bool {
+	if strutil.StrListContains(e.AuthMethodAccessors, entry.Accessor) ||
+		strutil.StrListContains(e.AuthMethodTypes, entry.Type) {
+		return true
+	}
+	if entityID == "" {
+		return false
+	}
+	if strutil.StrListContains(e.IdentityEntityIDs, entityID) {
+		return true
+	}
+	for _, groupID := range groupIDs {
+		if strutil.StrListContains(e.IdentityGroupIDs, groupID) {
+			return true
+		}
+	}
+	return false
+}
+
+// pendingMFALogin is a login waiting for its MFA requirement to be
+// satisfied, kept in memory until it is validated or expires. Pending logins
+// are not replicated or persisted, so a login can only be validated on the
+// node it was made on.
+type pendingMFALogin struct {
+	namespaceID string
+	path        string
+	resp        *logical.Response
+	requirement *logical.MFARequirement
+
+	// attempts counts the validations started for the login. It is
+	// protected by mfaLock.
+	attempts int
+}
+
+// mfaRequestInfo describes the request MFA is validated for, which is sent
+// to Duo and push webhooks
+type mfaRequestInfo struct {
+	requestID  string
+	path       string
+	remoteAddr string
+}
+
+func newMFARequestInfo(req *logical.Request, requestID, path string) *mfaRequestInfo {
+	info := &mfaRequestInfo{
+		requestID: requestID,
+		path:      path,
+	}
+	if req.Connection != nil {
+		info.remoteAddr = req.Connection.RemoteAddr
+	}
+	return info
+}
+
+func loginMFAPaths(i *IdentityStore) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "mfa/method/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: i.pathMFAMethodList(""),
+			},
+			HelpSynopsis:    "List MFA methods",
+			HelpDescription: "List all configured MFA methods of every type.",
+		},
+		{
+			Pattern: "mfa/method/totp/" + framework.GenericNameRegex("name"),
+			Fields: mfaMethodFields(map[string]*framework.FieldSchema{
+				"issuer": {
+					Type:        framework.TypeString,
+					Description: "The name of the key's issuing organization.",
+				},
+				"period": {
+					Type:        framework.TypeDurationSecond,
+					Default:     30,
+					Description: "The length of time used to generate a counter for the TOTP code calculation.",
+				},
+				"key_size": {
+					Type:        framework.TypeInt,
+					Default:     20,
+					Description: "Determines the size in bytes of the generated key.",
+				},
+				"qr_size": {
+					Type:        framework.TypeInt,
+					Default:     200,
+					Description: "The pixel size of the generated square QR code. If 0, a QR code is not returned.",
+				},
+				"algorithm": {
+					Type:        framework.TypeString,
+					Default:     "SHA1",
+					Description: "The hashing algorithm used to generate the TOTP code. Options include SHA1, SHA256 and SHA512.",
+				},
+				"digits": {
+					Type:        framework.TypeInt,
+					Default:     6,
+					Description: "The number of digits in the generated TOTP code. This value can either be 6 or 8.",
+				},
+				"skew": {
+					Type:        framework.TypeInt,
+					Default:     1,
+					Description: "The number of delay periods that are allowed when validating a TOTP code. This value can either be 0 or 1.",
+				},
+			}),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: i.pathMFAMethodWrite(mfaMethodTypeTOTP),
+				logical.UpdateOperation: i.pathMFAMethodWrite(mfaMethodTypeTOTP),
+				logical.ReadOperation:   i.pathMFAMethodRead(mfaMethodTypeTOTP),
+				logical.DeleteOperation: i.pathMFAMethodDelete(mfaMethodTypeTOTP),
+			},
+			ExistenceCheck:  i.pathMFAMethodExistenceCheck(mfaMethodTypeTOTP),
+			HelpSynopsis:    "CRUD operations for TOTP MFA methods.",
+			HelpDescription: "Create, Read, Update, and Delete TOTP MFA methods. Entities must generate a secret for the method before using it.",
+		},
+		{
+			Pattern: "mfa/method/totp/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: i.pathMFAMethodList(mfaMethodTypeTOTP),
+			},
+			HelpSynopsis:    "List TOTP MFA methods",
+			HelpDescription: "List all configured TOTP MFA methods.",
+		},
+		{
+			Pattern: "mfa/method/totp/" + framework.GenericNameRegex("name") + "/generate$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the TOTP method",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: i.pathMFATOTPGenerate,
+			},
+			HelpSynopsis:    "Generate a TOTP secret for the entity of the token.",
+			HelpDescription: "Generates a TOTP secret for the entity of the calling token and returns its otpauth URL and QR code. An entity may only have one secret per method.",
+		},
+		{
+			Pattern: "mfa/method/totp/" + framework.GenericNameRegex("name") + "/admin-generate$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the TOTP method",
+				},
+				"entity_id": {
+					Type:        framework.TypeString,
+					Description: "ID of the entity to generate the secret for",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: i.pathMFATOTPAdminGenerate,
+			},
+			HelpSynopsis:    "Generate a TOTP secret for an entity.",
+			HelpDescription: "Generates a TOTP secret for the given entity and returns its otpauth URL and QR code.",
+		},
+		{
+			Pattern: "mfa/method/totp/" + framework.GenericNameRegex("name") + "/admin-destroy$",
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the TOTP method",
+				},
+				"entity_id": {
+					Type:        framework.TypeString,
+					Description: "ID of the entity to destroy the secret of",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: i.pathMFATOTPAdminDestroy,
+			},
+			HelpSynopsis:    "Destroy the TOTP secret of an entity.",
+			HelpDescription: "Destroys the TOTP secret of the given entity, allowing a new one to be generated.",
+		},
+		{
+			Pattern: "mfa/method/duo/" + framework.GenericNameRegex("name"),
+			Fields: mfaMethodFields(map[string]*framework.FieldSchema{
+				"integration_key": {
+					Type:        framework.TypeString,
+					Description: "Integration key of the Duo Auth API application.",
+				},
+				"secret_key": {
+					Type:        framework.TypeString,
+					Description: "Secret key of the Duo Auth API application.",
+				},
+				"api_hostname": {
+					Type:        framework.TypeString,
+					Description: "API hostname of the Duo Auth API application.",
+				},
+				"push_info": {
+					Type:        framework.TypeString,
+					Description: "URL-encoded key/value pairs shown in Duo push notifications.",
+				},
+				"use_passcode": {
+					Type:        framework.TypeBool,
+					Description: "If true, a passcode is required instead of sending a push to the user.",
+				},
+			}),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: i.pathMFAMethodWrite(mfaMethodTypeDuo),
+				logical.UpdateOperation: i.pathMFAMethodWrite(mfaMethodTypeDuo),
+				logical.ReadOperation:   i.pathMFAMethodRead(mfaMethodTypeDuo),
+				logical.DeleteOperation: i.pathMFAMethodDelete(mfaMethodTypeDuo),
+			},
+			ExistenceCheck:  i.pathMFAMethodExistenceCheck(mfaMethodTypeDuo),
+			HelpSynopsis:    "CRUD operations for Duo MFA methods.",
+			HelpDescription: "Create, Read, Update, and Delete Duo MFA methods.",
+		},
+		{
+			Pattern: "mfa/method/duo/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: i.pathMFAMethodList(mfaMethodTypeDuo),
+			},
+			HelpSynopsis:    "List Duo MFA methods",
+			HelpDescription: "List all configured Duo MFA methods.",
+		},
+		{
+			Pattern: "mfa/method/push/" + framework.GenericNameRegex("name"),
+			Fields: mfaMethodFields(map[string]*framework.FieldSchema{
+				"url": {
+					Type:        framework.TypeString,
+					Description: "URL of the webhook asked to approve each use of the method.",
+				},
+				"secret": {
+					Type:        framework.TypeString,
+					Description: "Secret used to sign the requests sent to the webhook with HMAC-SHA256.",
+				},
+				"timeout": {
+					Type:        framework.TypeDurationSecond,
+					Default:     30,
+					Description: "How long to wait for the webhook to approve or deny a request.",
+				},
+			}),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: i.pathMFAMethodWrite(mfaMethodTypePush),
+				logical.UpdateOperation: i.pathMFAMethodWrite(mfaMethodTypePush),
+				logical.ReadOperation:   i.pathMFAMethodRead(mfaMethodTypePush),
+				logical.DeleteOperation: i.pathMFAMethodDelete(mfaMethodTypePush),
+			},
+			ExistenceCheck:  i.pathMFAMethodExistenceCheck(mfaMethodTypePush),
+			HelpSynopsis:    "CRUD operations for push MFA methods.",
+			HelpDescription: "Create, Read, Update, and Delete push MFA methods, which ask a webhook to approve each use of the method.",
+		},
+		{
+			Pattern: "mfa/method/push/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: i.pathMFAMethodList(mfaMethodTypePush),
+			},
+			HelpSynopsis:    "List push MFA methods",
+			HelpDescription: "List all configured push MFA methods.",
+		},
+		{
+			Pattern: "mfa/login-enforcement/" + framework.GenericNameRegex("name"),
+			Fields: map[string]*framework.FieldSchema{
+				"name": {
+					Type:        framework.TypeString,
+					Description: "Name of the login enforcement",
+				},
+				"mfa_method_names": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Comma separated string or array of MFA method names. Logins must be validated with one of them.",
+				},
+				"auth_method_accessors": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Comma separated string or array of the accessors of the auth methods the enforcement applies to",
+				},
+				"auth_method_types": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Comma separated string or array of the types of the auth methods the enforcement applies to",
+				},
+				"identity_group_ids": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Comma separated string or array of the IDs of the identity groups whose members the enforcement applies to",
+				},
+				"identity_entity_ids": {
+					Type:        framework.TypeCommaStringSlice,
+					Description: "Comma separated string or array of the IDs of the identity entities the enforcement applies to",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.CreateOperation: i.pathMFALoginEnforcementWrite,
+				logical.UpdateOperation: i.pathMFALoginEnforcementWrite,
+				logical.ReadOperation:   i.pathMFALoginEnforcementRead,
+				logical.DeleteOperation: i.pathMFALoginEnforcementDelete,
+			},
+			ExistenceCheck:  i.pathOIDCProviderObjectExistenceCheck(mfaLoginEnforcementPrefix),
+			HelpSynopsis:    "CRUD operations for MFA login enforcements.",
+			HelpDescription: "Create, Read, Update, and Delete MFA login enforcements. Logins on the auth methods, or by the entities and group members, of an enforcement must be validated with one of its MFA methods.",
+		},
+		{
+			Pattern: "mfa/login-enforcement/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: i.pathOIDCListProviderObject(mfaLoginEnforcementPrefix),
+			},
+			HelpSynopsis:    "List MFA login enforcements",
+			HelpDescription: "List all configured MFA login enforcements.",
+		},
+	}
+}
+
+// mfaMethodFields adds the fields common to all MFA methods to fields
+func mfaMethodFields(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["name"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "Name of the MFA method",
+	}
+	fields["username_format"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "Template for the username sent to Duo or the push webhook, such as \"{{identity.entity.metadata.email}}\". Defaults to the name of the entity.",
+	}
+	return fields
+}
+
+// getMFAMethod returns the method with the given name if it is of the given
+// type, or of any type if methodType is empty
+func getMFAMethod(ctx context.Context, s logical.Storage, name, methodType string) (*mfaMethod, error) {
+	var m mfaMethod
+	found, err := getProviderObject(ctx, s, mfaMethodPrefix, name, &m)
+	if err != nil {
+		return nil, err
+	}
+	if !found || (methodType != "" && m.Type != methodType) {
+		return nil, nil
+	}
+	return &m, nil
+}
+
+func (i *IdentityStore) pathMFAMethodExistenceCheck(methodType string) framework.ExistenceFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+		m, err := getMFAMethod(ctx, req.Storage, d.Get("name").(string), methodType)
+		if err != nil {
+			return false, err
+		}
+		return m != nil, nil
+	}
+}
+
+func (i *IdentityStore) pathMFAMethodList(methodType string) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		names, err := req.Storage.List(ctx, mfaMethodPrefix)
+		if err != nil {
+			return nil, err
+		}
+
+		keys := []string{}
+		keyInfo := make(map[string]interface{})
+		for _, name := range names {
+			m, err := getMFAMethod(ctx, req.Storage, name, methodType)
+			if err != nil {
+				return nil, err
+			}
+			if m == nil {
+				continue
+			}
+			keys = append(keys, name)
+			keyInfo[name] = map[string]interface{}{
+				"type": m.Type,
+			}
+		}
+
+		return logical.ListResponseWithInfo(keys, keyInfo), nil
+	}
+}
+
+func (i *IdentityStore) pathMFAMethodWrite(methodType string) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+
+		i.mfaLock.Lock()
+		defer i.mfaLock.Unlock()
+
+		var m mfaMethod
+		found, err := getProviderObject(ctx, req.Storage, mfaMethodPrefix, name, &m)
+		if err != nil {
+			return nil, err
+		}
+		if found && m.Type != methodType {
+			return logical.ErrorResponse("an MFA method named %q of type %q already exists", name, m.Type), nil
+		}
+		m.Type = methodType
+		m.Name = name
+
+		// set returns whether a field should be written, which is when it
+		// was supplied or the method is being created and gets its default
+		set := func(field string) bool {
+			_, ok := d.GetOk(field)
+			return ok || req.Operation == logical.CreateOperation
+		}
+
+		if set("username_format") {
+			m.UsernameFormat = d.Get("username_format").(string)
+		}
+		if m.UsernameFormat != "" && methodType != mfaMethodTypeTOTP {
+			if _, _, err := identity.PopulateString(identity.PopulateStringInput{
+				Mode:              identity.ACLTemplating,
+				ValidityCheckOnly: true,
+				String:            m.UsernameFormat,
+			}); err != nil {
+				return logical.ErrorResponse("invalid username_format: %s", err.Error()), nil
+			}
+		}
+
+		switch methodType {
+		case mfaMethodTypeTOTP:
+			if resp := updateTOTPConfig(&m, d, set); resp != nil {
+				return resp, nil
+			}
+		case mfaMethodTypeDuo:
+			if m.Duo == nil {
+				m.Duo = new(mfa.DuoConfig)
+			}
+			if set("integration_key") {
+				m.Duo.IntegrationKey = d.Get("integration_key").(string)
+			}
+			if set("secret_key") {
+				m.Duo.SecretKey = d.Get("secret_key").(string)
+			}
+			if set("api_hostname") {
+				m.Duo.APIHostname = d.Get("api_hostname").(string)
+			}
+			if set("push_info") {
+				m.Duo.PushInfo = d.Get("push_info").(string)
+			}
+			if set("use_passcode") {
+				m.UsePasscode = d.Get("use_passcode").(bool)
+			}
+			if m.Duo.IntegrationKey == "" || m.Duo.SecretKey == "" || m.Duo.APIHostname == "" {
+				return logical.ErrorResponse("integration_key, secret_key and api_hostname are required"), nil
+			}
+		case mfaMethodTypePush:
+			if m.Push == nil {
+				m.Push = new(pushMFAConfig)
+			}
+			if set("url") {
+				m.Push.URL = d.Get("url").(string)
+			}
+			if set("secret") {
+				m.Push.Secret = d.Get("secret").(string)
+			}
+			if set("timeout") {
+				m.Push.Timeout = time.Duration(d.Get("timeout").(int)) * time.Second
+			}
+			u, err := url.Parse(m.Push.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return logical.ErrorResponse("url must be an http or https URL"), nil
+			}
+			if m.Push.Timeout <= 0 {
+				return logical.ErrorResponse("timeout must be greater than zero"), nil
+			}
+		}
+
+		if err := putProviderObject(ctx, req.Storage, mfaMethodPrefix, name, &m); err != nil {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+}
+
+// updateTOTPConfig updates the TOTP configuration of the method from the
+// request, returning an error response if it is invalid
+func updateTOTPConfig(m *mfaMethod, d *framework.FieldData, set func(string) bool) *logical.Response {
+	if m.TOTP == nil {
+		m.TOTP = new(mfa.TOTPConfig)
+	}
+
+	if set("issuer") {
+		m.TOTP.Issuer = d.Get("issuer").(string)
+	}
+	if m.TOTP.Issuer == "" {
+		return logical.ErrorResponse("issuer is required")
+	}
+
+	if set("period") {
+		period := d.Get("period").(int)
+		if period <= 0 {
+			return logical.ErrorResponse("the period value must be greater than zero")
+		}
+		m.TOTP.Period = uint32(period)
+	}
+
+	if set("key_size") {
+		keySize := d.Get("key_size").(int)
+		if keySize <= 0 {
+			return logical.ErrorResponse("the key_size value must be greater than zero")
+		}
+		m.TOTP.KeySize = uint32(keySize)
+	}
+
+	if set("qr_size") {
+		qrSize := d.Get("qr_size").(int)
+		if qrSize < 0 {
+			return logical.ErrorResponse("the qr_size value must be greater than or equal to zero")
+		}
+		m.TOTP.QRSize = int32(qrSize)
+	}
+
+	// Translate digits and algorithm to the values the totp library
+	// understands, as the TOTP secrets engine does
+	if set("algorithm") {
+		switch d.Get("algorithm").(string) {
+		case "SHA1":
+			m.TOTP.Algorithm = int32(otplib.AlgorithmSHA1)
+		case "SHA256":
+			m.TOTP.Algorithm = int32(otplib.AlgorithmSHA256)
+		case "SHA512":
+			m.TOTP.Algorithm = int32(otplib.AlgorithmSHA512)
+		default:
+			return logical.ErrorResponse("the algorithm value is not valid")
+		}
+	}
+
+	if set("digits") {
+		switch d.Get("digits").(int) {
+		case 6:
+			m.TOTP.Digits = int32(otplib.DigitsSix)
+		case 8:
+			m.TOTP.Digits = int32(otplib.DigitsEight)
+		default:
+			return logical.ErrorResponse("the digits value can only be 6 or 8")
+		}
+	}
+
+	if set("skew") {
+		skew := d.Get("skew").(int)
+		if skew != 0 && skew != 1 {
+			return logical.ErrorResponse("the skew value must be 0 or 1")
+		}
+		m.TOTP.Skew = uint32(skew)
+	}
+
+	return nil
+}
+
+func (i *IdentityStore) pathMFAMethodRead(methodType string) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		m, err := getMFAMethod(ctx, req.Storage, d.Get("name").(string), methodType)
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			return nil, nil
+		}
+
+		data := map[string]interface{}{
+			"type":            m.Type,
+			"username_format": m.UsernameFormat,
+		}
+		switch m.Type {
+		case mfaMethodTypeTOTP:
+			data["issuer"] = m.TOTP.Issuer
+			data["period"] = m.TOTP.Period
+			data["key_size"] = m.TOTP.KeySize
+			data["qr_size"] = m.TOTP.QRSize
+			data["algorithm"] = otplib.Algorithm(m.TOTP.Algorithm).String()
+			data["digits"] = otplib.Digits(m.TOTP.Digits).Length()
+			data["skew"] = m.TOTP.Skew
+		case mfaMethodTypeDuo:
+			data["integration_key"] = m.Duo.IntegrationKey
+			data["api_hostname"] = m.Duo.APIHostname
+			data["push_info"] = m.Duo.PushInfo
+			data["use_passcode"] = m.UsePasscode
+		case mfaMethodTypePush:
+			data["url"] = m.Push.URL
+			data["timeout"] = int64(m.Push.Timeout.Seconds())
+		}
+
+		return &logical.Response{
+			Data: data,
+		}, nil
+	}
+}
+
+func (i *IdentityStore) pathMFAMethodDelete(methodType string) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+
+		i.mfaLock.Lock()
+		defer i.mfaLock.Unlock()
+
+		m, err := getMFAMethod(ctx, req.Storage, name, methodType)
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			return nil, nil
+		}
+
+		// it is an error to delete a method that is referenced by a login
+		// enforcement
+		enforcementNames, err := namesReferencing(ctx, req.Storage, mfaLoginEnforcementPrefix,
+			func() interface{} { return new(loginEnforcement) },
+			func(obj interface{}) bool {
+				return strutil.StrListContains(obj.(*loginEnforcement).MFAMethodNames, name)
+			})
+		if err != nil {
+			return nil, err
+		}
+		if len(enforcementNames) > 0 {
+			return logical.ErrorResponse("unable to delete MFA method %q because it is currently referenced by these login enforcements: %s",
+				name, strings.Join(enforcementNames, ", ")), logical.ErrInvalidRequest
+		}
+
+		return nil, req.Storage.Delete(ctx, mfaMethodPrefix+name)
+	}
+}
+
+func (i *IdentityStore) pathMFATOTPGenerate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if req.EntityID == "" {
+		return logical.ErrorResponse("TOTP secrets can only be generated for tokens with an entity"), logical.ErrInvalidRequest
+	}
+
+	return i.generateTOTPSecret(ctx, req.Storage, d.Get("name").(string), req.EntityID)
+}
+
+func (i *IdentityStore) pathMFATOTPAdminGenerate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entityID := d.Get("entity_id").(string)
+	if entityID == "" {
+		return logical.ErrorResponse("missing entity_id"), nil
+	}
+
+	return i.generateTOTPSecret(ctx, req.Storage, d.Get("name").(string), entityID)
+}
+
+// generateTOTPSecret generates a secret for the TOTP method and stores it in
+// the entity, returning its otpauth URL and QR code
+func (i *IdentityStore) generateTOTPSecret(ctx context.Context, s logical.Storage, name, entityID string) (*logical.Response, error) {
+	m, err := getMFAMethod(ctx, s, name, mfaMethodTypeTOTP)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return logical.ErrorResponse("unknown TOTP method %q", name), nil
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	entity, err := i.MemDBEntityByID(entityID, true)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil {
+		return logical.ErrorResponse("entity %q not found", entityID), nil
+	}
+	if _, ok := entity.MFASecrets[name]; ok {
+		return logical.ErrorResponse("entity already has a secret for MFA method %q", name), nil
+	}
+
+	key, err := totplib.Generate(totplib.GenerateOpts{
+		Issuer:      m.TOTP.Issuer,
+		AccountName: entity.Name,
+		Period:      uint(m.TOTP.Period),
+		Digits:      otplib.Digits(m.TOTP.Digits),
+		Algorithm:   otplib.Algorithm(m.TOTP.Algorithm),
+		SecretSize:  uint(m.TOTP.KeySize),
+	})
+	if err != nil {
+		return nil, errwrap.Wrapf("failed to generate TOTP key: {{err}}", err)
+	}
+
+	if entity.MFASecrets == nil {
+		entity.MFASecrets = make(map[string]*mfa.Secret)
+	}
+	entity.MFASecrets[name] = &mfa.Secret{
+		MethodName: name,
+		Value: &mfa.Secret_TOTPSecret{
+			TOTPSecret: &mfa.TOTPSecret{
+				Issuer:      m.TOTP.Issuer,
+				Period:      m.TOTP.Period,
+				Algorithm:   m.TOTP.Algorithm,
+				Digits:      m.TOTP.Digits,
+				Skew:        m.TOTP.Skew,
+				KeySize:     m.TOTP.KeySize,
+				AccountName: entity.Name,
+				Key:         key.Secret(),
+			},
+		},
+	}
+
+	if err := i.upsertEntity(ctx, entity, nil, true); err != nil {
+		return nil, err
+	}
+
+	data := map[string]interface{}{
+		"url": key.String(),
+	}
+	if m.TOTP.QRSize > 0 {
+		barcode, err := key.Image(int(m.TOTP.QRSize), int(m.TOTP.QRSize))
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to generate QR code image: {{err}}", err)
+		}
+
+		var buff bytes.Buffer
+		if err := png.Encode(&buff, barcode); err != nil {
+			return nil, errwrap.Wrapf("failed to encode QR code image: {{err}}", err)
+		}
+		data["barcode"] = base64.StdEncoding.EncodeToString(buff.Bytes())
+	}
+
+	return &logical.Response{
+		Data: data,
+	}, nil
+}
+
+func (i *IdentityStore) pathMFATOTPAdminDestroy(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	entityID := d.Get("entity_id").(string)
+	if entityID == "" {
+		return logical.ErrorResponse("missing entity_id"), nil
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	entity, err := i.MemDBEntityByID(entityID, true)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil {
+		return logical.ErrorResponse("entity %q not found", entityID), nil
+	}
+	if _, ok := entity.MFASecrets[name]; !ok {
+		return nil, nil
+	}
+
+	delete(entity.MFASecrets, name)
+
+	return nil, i.upsertEntity(ctx, entity, nil, true)
+}
+
+func (i *IdentityStore) pathMFALoginEnforcementWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	i.mfaLock.Lock()
+	defer i.mfaLock.Unlock()
+
+	var e loginEnforcement
+	if req.Operation == logical.UpdateOperation {
+		if _, err := getProviderObject(ctx, req.Storage, mfaLoginEnforcementPrefix, name, &e); err != nil {
+			return nil, err
+		}
+	}
+
+	if methodNamesRaw, ok := d.GetOk("mfa_method_names"); ok {
+		e.MFAMethodNames = methodNamesRaw.([]string)
+	}
+	if accessorsRaw, ok := d.GetOk("auth_method_accessors"); ok {
+		e.AuthMethodAccessors = accessorsRaw.([]string)
+	}
+	if typesRaw, ok := d.GetOk("auth_method_types"); ok {
+		e.AuthMethodTypes = typesRaw.([]string)
+	}
+	if groupIDsRaw, ok := d.GetOk("identity_group_ids"); ok {
+		e.IdentityGroupIDs = groupIDsRaw.([]string)
+	}
+	if entityIDsRaw, ok := d.GetOk("identity_entity_ids"); ok {
+		e.IdentityEntityIDs = entityIDsRaw.([]string)
+	}
+
+	if len(e.MFAMethodNames) == 0 {
+		return logical.ErrorResponse("at least one MFA method is required"), nil
+	}
+	for _, methodName := range e.MFAMethodNames {
+		m, err := getMFAMethod(ctx, req.Storage, methodName, "")
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			return logical.ErrorResponse("MFA method %q does not exist", methodName), nil
+		}
+	}
+
+	if len(e.AuthMethodAccessors) == 0 && len(e.AuthMethodTypes) == 0 &&
+		len(e.IdentityGroupIDs) == 0 && len(e.IdentityEntityIDs) == 0 {
+		return logical.ErrorResponse("at least one of auth_method_accessors, auth_method_types, identity_group_ids or identity_entity_ids is required"), nil
+	}
+	for _, accessor := range e.AuthMethodAccessors {
+		if i.core.router.MatchingMountByAccessor(accessor) == nil {
+			return logical.ErrorResponse("no auth method with accessor %q", accessor), nil
+		}
+	}
+
+	if err := putProviderObject(ctx, req.Storage, mfaLoginEnforcementPrefix, name, &e); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (i *IdentityStore) pathMFALoginEnforcementRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	var e loginEnforcement
+	found, err := getProviderObject(ctx, req.Storage, mfaLoginEnforcementPrefix, d.Get("name").(string), &e)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"mfa_method_names":      e.MFAMethodNames,
+			"auth_method_accessors": e.AuthMethodAccessors,
+			"auth_method_types":     e.AuthMethodTypes,
+			"identity_group_ids":    e.IdentityGroupIDs,
+			"identity_entity_ids":   e.IdentityEntityIDs,
+		},
+	}, nil
+}
+
+func (i *IdentityStore) pathMFALoginEnforcementDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	i.mfaLock.Lock()
+	defer i.mfaLock.Unlock()
+
+	return nil, req.Storage.Delete(ctx, mfaLoginEnforcementPrefix+d.Get("name").(string))
+}
+
+// loginMFARequirement returns the MFA requirement of a login on the mount by
+// the entity, or nil if no login enforcement applies to the login. Each
+// enforcement that applies is a constraint of the requirement. The entity is
+// nil for logins on local mounts, which cannot satisfy any requirement.
+func (i *IdentityStore) loginMFARequirement(ctx context.Context, entry *MountEntry, entity *identity.Entity) (*logical.MFARequirement, error) {
+	names, err := i.view.List(ctx, mfaLoginEnforcementPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	var entityID string
+	var groupIDs []string
+	if entity != nil {
+		entityID = entity.ID
+		groups, inheritedGroups, err := i.groupsByEntityID(entity.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range append(groups, inheritedGroups...) {
+			groupIDs = append(groupIDs, group.ID)
+		}
+	}
+
+	constraints := make(map[string]*logical.MFAConstraintAny)
+	for _, name := range names {
+		var e loginEnforcement
+		found, err := getProviderObject(ctx, i.view, mfaLoginEnforcementPrefix, name, &e)
+		if err != nil {
+			return nil, err
+		}
+		if !found || !e.appliesTo(entry, entityID, groupIDs) {
+			continue
+		}
+		if entity == nil {
+			return nil, errLoginMFANoEntity
+		}
+
+		constraint := new(logical.MFAConstraintAny)
+		for _, methodName := range e.MFAMethodNames {
+			m, err := getMFAMethod(ctx, i.view, methodName, "")
+			if err != nil {
+				return nil, err
+			}
+			if m == nil {
+				continue
+			}
+			constraint.Any = append(constraint.Any, &logical.MFAMethodID{
+				Type:         m.Type,
+				Name:         m.Name,
+				UsesPasscode: m.usesPasscode(),
+			})
+		}
+		if len(constraint.Any) == 0 {
+			return nil, fmt.Errorf("none of the MFA methods of login enforcement %q exist", name)
+		}
+		constraints[name] = constraint
+	}
+
+	if len(constraints) == 0 {
+		return nil, nil
+	}
+
+	requestID, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.MFARequirement{
+		MFARequestID:   requestID,
+		MFAConstraints: constraints,
+	}, nil
+}
+
+// storePendingMFALogin keeps the response of a login on path until its MFA
+// requirement is satisfied or it expires
+func (i *IdentityStore) storePendingMFALogin(ns *namespace.Namespace, path string, resp *logical.Response, requirement *logical.MFARequirement) {
+	i.loginMFACache.SetDefault(requirement.MFARequestID, &pendingMFALogin{
+		namespaceID: ns.ID,
+		path:        path,
+		resp:        resp,
+		requirement: requirement,
+	})
+}
+
+// validateMFARequirement checks that each constraint of the requirement is
+// satisfied by the credentials of one of its methods
+func (i *IdentityStore) validateMFARequirement(ctx context.Context, requirement *logical.MFARequirement, creds logical.MFACreds, entity *identity.Entity, info *mfaRequestInfo) error {
+	names := make([]string, 0, len(requirement.MFAConstraints))
+	for name := range requirement.MFAConstraints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		satisfied := false
+		for _, methodID := range requirement.MFAConstraints[name].Any {
+			methodCreds, ok := creds[methodID.Name]
+			if !ok {
+				continue
+			}
+			if err := i.validateMFAMethod(ctx, methodID.Name, methodCreds, entity, info); err != nil {
+				return err
+			}
+			satisfied = true
+			break
+		}
+		if !satisfied {
+			return fmt.Errorf("login enforcement %q requires credentials for one of its MFA methods", name)
+		}
+	}
+
+	return nil
+}
+
+// validateMFAMethod checks the credentials supplied for the method on behalf
+// of the entity
+func (i *IdentityStore) validateMFAMethod(ctx context.Context, name string, creds []string, entity *identity.Entity, info *mfaRequestInfo) error {
+	m, err := getMFAMethod(ctx, i.view, name, "")
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return fmt.Errorf("unknown MFA method %q", name)
+	}
+
+	var passcode string
+	switch {
+	case len(creds) > 1:
+		return fmt.Errorf("too many credentials supplied for MFA method %q", name)
+	case len(creds) == 1:
+		passcode = creds[0]
+	}
+	if m.usesPasscode() && passcode == "" {
+		return fmt.Errorf("MFA method %q requires a passcode", name)
+	}
+
+	switch m.Type {
+	case mfaMethodTypeTOTP:
+		err = i.validateTOTP(m, entity, passcode)
+	case mfaMethodTypeDuo:
+		err = i.validateDuo(m, entity, passcode, info)
+	case mfaMethodTypePush:
+		err = i.validatePush(ctx, m, entity, info)
+	default:
+		err = fmt.Errorf("unsupported MFA method type %q", m.Type)
+	}
+	if err != nil {
+		return errwrap.Wrapf(fmt.Sprintf("MFA method %q failed: {{err}}", name), err)
+	}
+
+	return nil
+}
+
+func (i *IdentityStore) validateTOTP(m *mfaMethod, entity *identity.Entity, passcode string) error {
+	secret := entity.MFASecrets[m.Name].GetTOTPSecret()
+	if secret == nil {
+		return errors.New("entity has no TOTP secret for the method")
+	}
+
+	valid, err := totplib.ValidateCustom(passcode, secret.Key, time.Now(), totplib.ValidateOpts{
+		Period:    uint(secret.Period),
+		Skew:      uint(secret.Skew),
+		Digits:    otplib.Digits(secret.Digits),
+		Algorithm: otplib.Algorithm(secret.Algorithm),
+	})
+	if err != nil && err != otplib.ErrValidateInputInvalidLength {
+		return errwrap.Wrapf("error validating passcode: {{err}}", err)
+	}
+	if !valid {
+		return errors.New("invalid passcode")
+	}
+
+	// Take the key skew, add two for behind and in front, and multiply that
+	// by the period to cover the full possibility of the validity of the
+	// code
+	usedName := fmt.Sprintf("%s_%s_%s", m.Name, entity.ID, passcode)
+	err = i.mfaUsedCodes.Add(usedName, nil, time.Duration(
+		int64(time.Second)*
+			int64(secret.Period)*
+			int64(2+secret.Skew)))
+	if err != nil {
+		return errors.New("code already used; wait until the next time period")
+	}
+
+	return nil
+}
+
+func (i *IdentityStore) validateDuo(m *mfaMethod, entity *identity.Entity, passcode string, info *mfaRequestInfo) error {
+	username, err := i.mfaUsername(m, entity)
+	if err != nil {
+		return err
+	}
+
+	duoClient := duoapi.NewDuoApi(m.Duo.IntegrationKey, m.Duo.SecretKey, m.Duo.APIHostname, "vault")
+	duoConfig := &duo.DuoConfig{
+		UsernameFormat: "%s",
+		PushInfo:       m.Duo.PushInfo,
+	}
+
+	return duo.Authenticate(duoConfig, authapi.NewAuthApi(*duoClient), username, "", passcode, info.remoteAddr)
+}
+
+// validatePush asks the webhook of the method to approve the request. The
+// webhook must respond with a 200 status code and a JSON object whose
+// "approved" field is true.
+func (i *IdentityStore) validatePush(ctx context.Context, m *mfaMethod, entity *identity.Entity, info *mfaRequestInfo) error {
+	username, err := i.mfaUsername(m, entity)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"request_id":  info.requestID,
+		"method_name": m.Name,
+		"entity_id":   entity.ID,
+		"username":    username,
+		"path":        info.path,
+		"remote_addr": info.remoteAddr,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Push.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodPost, m.Push.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if m.Push.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(m.Push.Secret))
+		mac.Write(body)
+		req.Header.Set(mfaPushSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := cleanhttp.DefaultClient().Do(req)
+	if err != nil {
+		return errwrap.Wrapf("error sending push request: {{err}}", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("push request was not approved: unexpected status code %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Approved bool `json:"approved"`
+	}
+	if err := jsonutil.DecodeJSONFromReader(io.LimitReader(resp.Body, mfaPushMaxResponseSize), &result); err != nil {
+		return errwrap.Wrapf("error decoding push response: {{err}}", err)
+	}
+	if !result.Approved {
+		return errors.New("push request was denied")
+	}
+
+	return nil
+}
+
+// mfaUsername returns the username of the entity for the method, which is
+// the entity's name unless the method has a username format
+func (i *IdentityStore) mfaUsername(m *mfaMethod, entity *identity.Entity) (string, error) {
+	if m.UsernameFormat == "" {
+		return entity.Name, nil
+	}
+
+	groups, inheritedGroups, err := i.groupsByEntityID(entity.ID)
+	if err != nil {
+		return "", err
+	}
+
+	_, username, err := identity.PopulateString(identity.PopulateStringInput{
+		Mode:   identity.ACLTemplating,
+		String: m.UsernameFormat,
+		Entity: entity,
+		Groups: append(groups, inheritedGroups...),
+	})
+	if err != nil {
+		return "", errwrap.Wrapf("error populating username format: {{err}}", err)
+	}
+
+	return username, nil
+}
+
+// validateLoginMFA completes a login that is waiting for MFA once the
+// credentials of the payload satisfy its requirement, creating its token.
+// Logins are discarded after too many failed validations. Since pending
+// logins only live in the loginMFACache of the node the login was made on,
+// validating them on any other node fails.
+func (c *Core) validateLoginMFA(ctx context.Context, req *logical.Request, requestID string, creds logical.MFACreds) (*logical.Response, error) {
+	if c.identityStore == nil {
+		return nil, errors.New("identity store is not available")
+	}
+	i := c.identityStore
+
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Count the attempt before validating it, so that concurrent attempts
+	// cannot exceed loginMFAMaxFailures
+	i.mfaLock.Lock()
+	var pending *pendingMFALogin
+	if raw, ok := i.loginMFACache.Get(requestID); ok {
+		pending = raw.(*pendingMFALogin)
+	}
+	if pending != nil && pending.namespaceID == ns.ID {
+		if pending.attempts < loginMFAMaxFailures {
+			pending.attempts++
+		} else {
+			i.loginMFACache.Delete(requestID)
+			pending = nil
+		}
+	}
+	i.mfaLock.Unlock()
+	if pending == nil || pending.namespaceID != ns.ID {
+		return logical.ErrorResponse("invalid or expired MFA request ID"), logical.ErrPermissionDenied
+	}
+
+	entity, err := i.MemDBEntityByID(pending.resp.Auth.EntityID, false)
+	if err != nil {
+		return nil, err
+	}
+	if entity == nil || entity.Disabled {
+		return logical.ErrorResponse("entity of the login not found or disabled"), logical.ErrPermissionDenied
+	}
+
+	info := newMFARequestInfo(req, requestID, pending.path)
+	if err := i.validateMFARequirement(ctx, pending.requirement, creds, entity, info); err != nil {
+		i.mfaLock.Lock()
+		if pending.attempts >= loginMFAMaxFailures {
+			i.loginMFACache.Delete(requestID)
+		}
+		i.mfaLock.Unlock()
+		return logical.ErrorResponse(err.Error()), logical.ErrPermissionDenied
+	}
+
+	// Each login may only be completed once
+	i.mfaLock.Lock()
+	_, ok := i.loginMFACache.Get(requestID)
+	i.loginMFACache.Delete(requestID)
+	i.mfaLock.Unlock()
+	if !ok {
+		return logical.ErrorResponse("invalid or expired MFA request ID"), logical.ErrPermissionDenied
+	}
+
+	resp := pending.resp
+	if errResp, err := c.loginCreateToken(ctx, pending.path, resp); err != nil {
+		return errResp, err
+	}
+
+	return resp, nil
+}
+
+// validateMFAMethods checks the MFA credentials of a request on a path whose
+// policy requires each of the methods, which are supplied in the
+// X-Vault-MFA header
+func (c *Core) validateMFAMethods(ctx context.Context, methods []string, req *logical.Request, entity *identity.Entity) error {
+	if c.identityStore == nil {
+		return errors.New("identity store is not available")
+	}
+	if entity == nil {
+		return errors.New("MFA is required on this path, which is only available to tokens with an entity")
+	}
+
+	info := newMFARequestInfo(req, req.ID, req.Path)
+	for _, name := range methods {
+		creds, ok := req.MFACreds[name]
+		if !ok {
+			return fmt.Errorf("MFA credentials for method %q are required on this path", name)
+		}
+		if err := c.identityStore.validateMFAMethod(ctx, name, creds, entity, info); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
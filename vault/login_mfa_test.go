@@ -0,0 +1,468 @@
+package vault
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	credUserpass "github.com/hashicorp/vault/builtin/credential/userpass"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/sdk/logical"
+	totplib "github.com/pquerna/otp/totp"
+)
+
+// testLoginMFASetup mounts userpass with a user having the given policies,
+// logs in once to create its entity, and generates a secret for the entity
+// on a TOTP method. It returns the entity ID, the accessor of the mount and
+// the TOTP secret.
+func testLoginMFASetup(t *testing.T, c *Core, ctx context.Context, root string, policies string) (entityID, accessor, secret string) {
+	t.Helper()
+
+	c.credentialBackends["userpass"] = credUserpass.Factory
+
+	requests := []*logical.Request{
+		{
+			Path:      "sys/auth/userpass",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"type": "userpass",
+			},
+		},
+		{
+			Path:      "auth/userpass/users/test",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"password": "foo",
+				"policies": policies,
+			},
+		},
+		{
+			Path:      "identity/mfa/method/totp/my_totp",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"issuer": "Vault",
+			},
+		},
+	}
+	for _, req := range requests {
+		req.ClientToken = root
+		req.Connection = &logical.Connection{}
+		resp, err := c.HandleRequest(ctx, req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+		}
+	}
+
+	resp := testLoginMFALogin(t, c, ctx)
+	if resp.Auth.ClientToken == "" || resp.Auth.EntityID == "" {
+		t.Fatalf("expected a token with an entity, got: %#v", resp.Auth)
+	}
+	entityID = resp.Auth.EntityID
+
+	mount := c.router.MatchingMountEntry(ctx, "auth/userpass/")
+	if mount == nil {
+		t.Fatal("userpass mount not found")
+	}
+
+	resp, err := c.HandleRequest(ctx, &logical.Request{
+		Path:        "identity/mfa/method/totp/my_totp/admin-generate",
+		Operation:   logical.UpdateOperation,
+		ClientToken: root,
+		Data: map[string]interface{}{
+			"entity_id": entityID,
+		},
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	u, err := url.Parse(resp.Data["url"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return entityID, mount.Accessor, u.Query().Get("secret")
+}
+
+func testLoginMFALogin(t *testing.T, c *Core, ctx context.Context) *logical.Response {
+	t.Helper()
+
+	resp, err := c.HandleRequest(ctx, &logical.Request{
+		Path:      "auth/userpass/login/test",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"password": "foo",
+		},
+		Connection: &logical.Connection{},
+	})
+	if err != nil || resp == nil || resp.Auth == nil {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	return resp
+}
+
+func TestLoginMFA_TOTP(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+
+	_, accessor, secret := testLoginMFASetup(t, c, ctx, root, "default")
+
+	resp, err := c.HandleRequest(ctx, &logical.Request{
+		Path:        "identity/mfa/login-enforcement/userpass",
+		Operation:   logical.UpdateOperation,
+		ClientToken: root,
+		Data: map[string]interface{}{
+			"mfa_method_names":      "my_totp",
+			"auth_method_accessors": accessor,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+
+	// Methods referenced by an enforcement cannot be deleted
+	resp, err = c.HandleRequest(ctx, &logical.Request{
+		Path:        "identity/mfa/method/totp/my_totp",
+		Operation:   logical.DeleteOperation,
+		ClientToken: root,
+	})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected an error deleting a referenced method, got: %#v", resp)
+	}
+
+	// The login now returns an MFA requirement instead of a token
+	resp = testLoginMFALogin(t, c, ctx)
+	if resp.Auth.ClientToken != "" {
+		t.Fatalf("expected no token before MFA, got: %#v", resp.Auth)
+	}
+	requirement := resp.Auth.MFARequirement
+	if requirement == nil || requirement.MFARequestID == "" {
+		t.Fatalf("expected an MFA requirement, got: %#v", resp.Auth)
+	}
+	constraint := requirement.MFAConstraints["userpass"]
+	if constraint == nil || len(constraint.Any) != 1 || constraint.Any[0].Name != "my_totp" || !constraint.Any[0].UsesPasscode {
+		t.Fatalf("bad: constraints: %#v", requirement.MFAConstraints)
+	}
+
+	validate := func(passcode string) (*logical.Response, error) {
+		return c.HandleRequest(ctx, &logical.Request{
+			Path:      "sys/mfa/validate",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"mfa_request_id": requirement.MFARequestID,
+				"mfa_payload": map[string]interface{}{
+					"my_totp": []interface{}{passcode},
+				},
+			},
+			Connection: &logical.Connection{},
+		})
+	}
+
+	resp, err = validate("000000")
+	if err != logical.ErrPermissionDenied {
+		t.Fatalf("expected permission denied for a wrong passcode, got: resp: %#v\nerr: %v", resp, err)
+	}
+
+	code, err := totplib.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = validate(code)
+	if err != nil || resp == nil || resp.Auth == nil || resp.Auth.ClientToken == "" {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+
+	te, err := c.tokenStore.Lookup(ctx, resp.Auth.ClientToken)
+	if err != nil || te == nil {
+		t.Fatalf("expected the token to exist, err: %v", err)
+	}
+
+	// Each login may only be completed once
+	resp, err = validate(code)
+	if err != logical.ErrPermissionDenied {
+		t.Fatalf("expected permission denied, got: resp: %#v\nerr: %v", resp, err)
+	}
+}
+
+func TestLoginMFA_PolicyMFAMethods(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+
+	resp, err := c.HandleRequest(ctx, &logical.Request{
+		Path:        "sys/policy/mfa",
+		Operation:   logical.UpdateOperation,
+		ClientToken: root,
+		Data: map[string]interface{}{
+			"policy": `
+path "secret/*" {
+	capabilities = ["create", "update", "read"]
+	mfa_methods  = ["my_totp"]
+}
+`,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+
+	_, _, secret := testLoginMFASetup(t, c, ctx, root, "mfa")
+	token := testLoginMFALogin(t, c, ctx).Auth.ClientToken
+
+	write := func(creds logical.MFACreds) (*logical.Response, error) {
+		return c.HandleRequest(ctx, &logical.Request{
+			Path:        "secret/foo",
+			Operation:   logical.UpdateOperation,
+			ClientToken: token,
+			MFACreds:    creds,
+			Data: map[string]interface{}{
+				"bar": "baz",
+			},
+		})
+	}
+
+	resp, err = write(nil)
+	if err == nil || !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied without MFA, got: resp: %#v\nerr: %v", resp, err)
+	}
+
+	code, err := totplib.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = write(logical.MFACreds{"my_totp": []string{code}})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+
+	// Passcodes cannot be reused
+	resp, err = write(logical.MFACreds{"my_totp": []string{code}})
+	if err == nil || !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied for a reused passcode, got: resp: %#v\nerr: %v", resp, err)
+	}
+}
+
+// testLoginMFAValidate validates the login waiting for MFA with the given
+// request ID using the given payload
+func testLoginMFAValidate(c *Core, ctx context.Context, requestID string, payload map[string]interface{}) (*logical.Response, error) {
+	return c.HandleRequest(ctx, &logical.Request{
+		Path:      "sys/mfa/validate",
+		Operation: logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"mfa_request_id": requestID,
+			"mfa_payload":    payload,
+		},
+		Connection: &logical.Connection{},
+	})
+}
+
+func TestLoginMFA_Push(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+
+	entityID, accessor, _ := testLoginMFASetup(t, c, ctx, root, "default")
+
+	// The webhook approves requests while approve is set, and only if they
+	// are signed with the secret of the method
+	var approve, pushes int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&pushes, 1)
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mac := hmac.New(sha256.New, []byte("webhook-secret"))
+		mac.Write(body)
+		if sig := r.Header.Get(mfaPushSignatureHeader); sig != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("bad signature: %q", sig)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var data map[string]interface{}
+		if err := json.Unmarshal(body, &data); err != nil {
+			t.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if data["method_name"] != "my_push" || data["entity_id"] != entityID || data["username"] == "" || data["path"] != "auth/userpass/login/test" {
+			t.Errorf("bad push request: %#v", data)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"approved": atomic.LoadInt32(&approve) == 1,
+		})
+	}))
+	defer ts.Close()
+
+	requests := []*logical.Request{
+		{
+			Path:      "identity/mfa/method/push/my_push",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"url":     ts.URL,
+				"secret":  "webhook-secret",
+				"timeout": 5,
+			},
+		},
+		{
+			Path:      "identity/mfa/login-enforcement/userpass",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"mfa_method_names":      "my_push",
+				"auth_method_accessors": accessor,
+			},
+		},
+	}
+	for _, req := range requests {
+		req.ClientToken = root
+		resp, err := c.HandleRequest(ctx, req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+		}
+	}
+
+	resp := testLoginMFALogin(t, c, ctx)
+	requirement := resp.Auth.MFARequirement
+	if requirement == nil || resp.Auth.ClientToken != "" {
+		t.Fatalf("expected an MFA requirement, got: %#v", resp.Auth)
+	}
+	constraint := requirement.MFAConstraints["userpass"]
+	if constraint == nil || len(constraint.Any) != 1 || constraint.Any[0].Name != "my_push" || constraint.Any[0].UsesPasscode {
+		t.Fatalf("bad: constraints: %#v", requirement.MFAConstraints)
+	}
+
+	payload := map[string]interface{}{
+		"my_push": []interface{}{},
+	}
+
+	// Denied pushes fail the validation
+	resp, err := testLoginMFAValidate(c, ctx, requirement.MFARequestID, payload)
+	if err != logical.ErrPermissionDenied || resp == nil || !strings.Contains(resp.Error().Error(), "push request was denied") {
+		t.Fatalf("expected the push to be denied, got: resp: %#v\nerr: %v", resp, err)
+	}
+
+	// Approved pushes complete the login
+	atomic.StoreInt32(&approve, 1)
+	resp, err = testLoginMFAValidate(c, ctx, requirement.MFARequestID, payload)
+	if err != nil || resp == nil || resp.Auth == nil || resp.Auth.ClientToken == "" {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+
+	if n := atomic.LoadInt32(&pushes); n != 2 {
+		t.Fatalf("expected 2 push requests, got %d", n)
+	}
+}
+
+func TestLoginMFA_MaxFailures(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	ctx := namespace.RootContext(nil)
+
+	_, accessor, secret := testLoginMFASetup(t, c, ctx, root, "default")
+
+	// The webhook denies requests once they are released, so that attempts
+	// can be held in flight
+	var pushes int32
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&pushes, 1)
+		<-release
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"approved": false,
+		})
+	}))
+	defer ts.Close()
+
+	requests := []*logical.Request{
+		{
+			Path:      "identity/mfa/method/push/my_push",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"url": ts.URL,
+			},
+		},
+		{
+			Path:      "identity/mfa/login-enforcement/userpass",
+			Operation: logical.UpdateOperation,
+			Data: map[string]interface{}{
+				"mfa_method_names":      "my_totp,my_push",
+				"auth_method_accessors": accessor,
+			},
+		},
+	}
+	for _, req := range requests {
+		req.ClientToken = root
+		resp, err := c.HandleRequest(ctx, req)
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+		}
+	}
+
+	// The login is discarded after too many failed validations, after which
+	// even a valid passcode is rejected
+	requestID := testLoginMFALogin(t, c, ctx).Auth.MFARequirement.MFARequestID
+	for i := 0; i < loginMFAMaxFailures; i++ {
+		resp, err := testLoginMFAValidate(c, ctx, requestID, map[string]interface{}{
+			"my_totp": []interface{}{"000000"},
+		})
+		if err != logical.ErrPermissionDenied || !strings.Contains(resp.Error().Error(), "invalid passcode") {
+			t.Fatalf("expected an invalid passcode, got: resp: %#v\nerr: %v", resp, err)
+		}
+	}
+	code, err := totplib.GenerateCode(secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := testLoginMFAValidate(c, ctx, requestID, map[string]interface{}{
+		"my_totp": []interface{}{code},
+	})
+	if err != logical.ErrPermissionDenied || !strings.Contains(resp.Error().Error(), "invalid or expired MFA request ID") {
+		t.Fatalf("expected the login to be discarded, got: resp: %#v\nerr: %v", resp, err)
+	}
+
+	// Concurrent validations cannot exceed the limit either: the attempts
+	// beyond it are rejected while the others are still waiting for the
+	// webhook
+	requestID = testLoginMFALogin(t, c, ctx).Auth.MFARequirement.MFARequestID
+	errs := make(chan error, 2*loginMFAMaxFailures)
+	for i := 0; i < 2*loginMFAMaxFailures; i++ {
+		go func() {
+			_, err := testLoginMFAValidate(c, ctx, requestID, map[string]interface{}{
+				"my_push": []interface{}{},
+			})
+			errs <- err
+		}()
+	}
+	for i := 0; i < loginMFAMaxFailures; i++ {
+		select {
+		case err := <-errs:
+			if err != logical.ErrPermissionDenied {
+				t.Fatalf("expected permission denied, got: %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			close(release)
+			t.Fatalf("more than %d validations were attempted", loginMFAMaxFailures)
+		}
+	}
+	close(release)
+	for i := 0; i < loginMFAMaxFailures; i++ {
+		if err := <-errs; err != logical.ErrPermissionDenied {
+			t.Fatalf("expected permission denied, got: %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&pushes); n != loginMFAMaxFailures {
+		t.Fatalf("expected %d push requests, got %d", loginMFAMaxFailures, n)
+	}
+}
@@ -321,6 +321,17 @@ func (e *MountEntry) SyncCache() {
 	}
 }
 
+// MatchingMountType returns the path, relative to its namespace, and the type
+// of the mount that the given request path would be routed to, or empty
+// strings if there is no such mount
+func (c *Core) MatchingMountType(ctx context.Context, reqPath string) (string, string) {
+	entry := c.router.MatchingMountEntry(ctx, reqPath)
+	if entry == nil {
+		return "", ""
+	}
+	return entry.Path, entry.Type
+}
+
 func (c *Core) decodeMountTable(ctx context.Context, raw []byte) (*MountTable, error) {
 	// Decode into mount table
 	mountTable := new(MountTable)
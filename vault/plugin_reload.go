@@ -190,6 +190,7 @@ func (c *Core) reloadBackendCommon(ctx context.Context, entry *MountEntry, isAut
 		if paths != nil {
 			re.rootPaths.Store(pathsToRadix(paths.Root))
 			re.loginPaths.Store(pathsToRadix(paths.Unauthenticated))
+			re.loginWildcardPaths.Store(parseWildcardPaths(paths.Unauthenticated))
 		}
 	}
 
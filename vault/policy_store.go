@@ -51,13 +51,9 @@ path "sys/wrapping/unwrap" {
     capabilities = ["update"]
 }
 `
-	// controlGroupPolicy is the policy that ensures control group requests can
-	// commit themselves
+	// controlGroupPolicy is the policy of control group tokens, which can only
+	// be unwrapped once their request has been approved
 	controlGroupPolicy = `
-path "cubbyhole/control-group" {
-    capabilities = ["update", "create", "read"]
-}
-
 path "sys/wrapping/unwrap" {
     capabilities = ["update"]
 }
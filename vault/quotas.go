@@ -0,0 +1,79 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/namespace"
+	"github.com/hashicorp/vault/vault/quotas"
+)
+
+// setupQuotas loads the configured quotas and starts enforcing them
+func (c *Core) setupQuotas(ctx context.Context) error {
+	if err := c.quotaManager.Setup(ctx, c.systemBarrierView.SubView(quotas.StoragePrefix), c.leaseCount); err != nil {
+		return errwrap.Wrapf("failed to setup quotas: {{err}}", err)
+	}
+	return nil
+}
+
+// teardownQuotas stops enforcing quotas
+func (c *Core) teardownQuotas() {
+	c.quotaManager.Reset()
+}
+
+// ApplyRateLimitQuota checks whether the request is allowed by the rate limit
+// quotas that apply to it
+func (c *Core) ApplyRateLimitQuota(req *quotas.Request) (quotas.Response, error) {
+	req.Type = quotas.TypeRateLimit
+	return c.quotaManager.ApplyQuota(req)
+}
+
+// applyLeaseCountQuota returns an error wrapping
+// quotas.ErrLeaseCountQuotaExceeded if the lease count quotas do not allow
+// another lease to be created for the request path
+func (c *Core) applyLeaseCountQuota(ctx context.Context, reqPath string) error {
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	mountPath := strings.TrimPrefix(c.router.MatchingMount(ctx, reqPath), ns.Path)
+	resp, err := c.quotaManager.ApplyQuota(&quotas.Request{
+		Type:          quotas.TypeLeaseCount,
+		Path:          reqPath,
+		NamespacePath: ns.Path,
+		MountPath:     mountPath,
+	})
+	if err != nil {
+		return err
+	}
+	if !resp.Allowed {
+		return errwrap.Wrapf(fmt.Sprintf("cannot create a lease for %q as quota %q has been reached: {{err}}", ns.Path+reqPath, resp.Quota), quotas.ErrLeaseCountQuotaExceeded)
+	}
+
+	// Leases are only counted as they are loaded, so a quota cannot be
+	// enforced until the expiration manager has restored all of them
+	if resp.Quota != "" && c.expiration != nil && c.expiration.inRestoreMode() {
+		return errwrap.Wrapf(fmt.Sprintf("cannot create a lease for %q as quota %q cannot be enforced until leases have been restored: {{err}}", ns.Path+reqPath, resp.Quota), quotas.ErrLeaseCountQuotaExceeded)
+	}
+
+	return nil
+}
+
+// leaseCount returns the number of leases under the given namespace or mount.
+// Lease count quotas are only applied when registering leases, so the
+// expiration manager is always set up when this is called.
+func (c *Core) leaseCount(nsPath, mountPath string) int {
+	if c.expiration == nil {
+		return 0
+	}
+	return c.expiration.leaseCount(nsPath, mountPath)
+}
+
+// MatchingMount returns the path of the mount that the given request path
+// would be routed to, including the namespace path
+func (c *Core) MatchingMount(ctx context.Context, reqPath string) string {
+	return c.router.MatchingMount(ctx, reqPath)
+}
@@ -0,0 +1,67 @@
+package quotas
+
+import (
+	"errors"
+)
+
+// LeaseCountFunc returns the number of leases under the given namespace or,
+// if mountPath is set, under the given mount of that namespace
+type LeaseCountFunc func(nsPath, mountPath string) int
+
+// LeaseCountQuota limits the number of leases that may exist under a
+// namespace or mount
+type LeaseCountQuota struct {
+	// Name is the unique name of the quota
+	Name string `json:"name"`
+
+	// NamespacePath is the namespace the quota applies to. It is empty for
+	// the root namespace.
+	NamespacePath string `json:"namespace_path"`
+
+	// MountPath is the mount, relative to the namespace, that the quota
+	// applies to. If empty, the quota applies to the whole namespace.
+	MountPath string `json:"mount_path"`
+
+	// MaxLeases is the maximum number of leases allowed
+	MaxLeases int `json:"max_leases"`
+}
+
+// NewLeaseCountQuota returns a new lease count quota. The quota is validated
+// when it is set on the Manager.
+func NewLeaseCountQuota(name, nsPath, mountPath string, maxLeases int) *LeaseCountQuota {
+	return &LeaseCountQuota{
+		Name:          name,
+		NamespacePath: nsPath,
+		MountPath:     mountPath,
+		MaxLeases:     maxLeases,
+	}
+}
+
+// initialize validates the quota
+func (q *LeaseCountQuota) initialize() error {
+	switch {
+	case q.Name == "":
+		return errors.New("quota name must be provided")
+	case q.MaxLeases <= 0:
+		return errors.New("max_leases must be positive")
+	}
+	return nil
+}
+
+// clone returns a copy of the quota's configuration
+func (q *LeaseCountQuota) clone() *LeaseCountQuota {
+	return NewLeaseCountQuota(q.Name, q.NamespacePath, q.MountPath, q.MaxLeases)
+}
+
+// allow checks whether another lease may be created given the current
+// number of leases the quota applies to
+func (q *LeaseCountQuota) allow(count LeaseCountFunc) Response {
+	if count != nil && count(q.NamespacePath, q.MountPath) >= q.MaxLeases {
+		return Response{Quota: q.Name}
+	}
+
+	return Response{
+		Allowed: true,
+		Quota:   q.Name,
+	}
+}
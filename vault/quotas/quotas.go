@@ -0,0 +1,430 @@
+package quotas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// Type represents the type of a quota
+type Type string
+
+const (
+	// TypeRateLimit represents a quota that limits the rate of requests
+	TypeRateLimit Type = "rate-limit"
+
+	// TypeLeaseCount represents a quota that limits the number of leases
+	TypeLeaseCount Type = "lease-count"
+)
+
+const (
+	// StoragePrefix is the prefix, within the system view, under which quota
+	// configurations are stored
+	StoragePrefix = "quotas/"
+)
+
+var (
+	// ErrRateLimitQuotaExceeded is returned when a request is rejected by a
+	// rate limit quota
+	ErrRateLimitQuotaExceeded = errors.New("rate limit quota exceeded")
+
+	// ErrLeaseCountQuotaExceeded is returned when a lease cannot be created
+	// because of a lease count quota
+	ErrLeaseCountQuotaExceeded = errors.New("lease count quota exceeded")
+
+	// ErrQuotaPathConflict is returned when a quota is created on a path that
+	// another quota already applies to
+	ErrQuotaPathConflict = errors.New("a quota already exists for the given namespace and path")
+)
+
+// Request contains the information about a request that quotas are applied
+// against
+type Request struct {
+	// Type is the type of quota to apply
+	Type Type
+
+	// Path is the full request path, relative to the namespace
+	Path string
+
+	// NamespacePath is the path of the namespace the request is made in. It is
+	// empty for the root namespace.
+	NamespacePath string
+
+	// MountPath is the path of the mount the request is routed to, relative
+	// to the namespace
+	MountPath string
+
+	// ClientAddress is the IP address of the client making the request
+	ClientAddress string
+}
+
+// Response is the result of applying quotas to a request
+type Response struct {
+	// Allowed indicates whether the request may proceed
+	Allowed bool
+
+	// RetryAfter is how long the client should wait before retrying a
+	// request rejected by a rate limit quota
+	RetryAfter time.Duration
+
+	// Quota is the name of the quota that was applied, if any
+	Quota string
+}
+
+// Manager holds the configured quotas and applies them to requests. Quotas
+// are persisted to the storage provided in Setup and are only enforced while
+// the manager is set up.
+type Manager struct {
+	logger log.Logger
+
+	l                sync.RWMutex
+	storage          logical.Storage
+	leaseCount       LeaseCountFunc
+	rateLimitQuotas  map[string]*RateLimitQuota
+	leaseCountQuotas map[string]*LeaseCountQuota
+}
+
+// NewManager creates a new quota manager
+func NewManager(logger log.Logger) *Manager {
+	return &Manager{
+		logger:           logger,
+		rateLimitQuotas:  make(map[string]*RateLimitQuota),
+		leaseCountQuotas: make(map[string]*LeaseCountQuota),
+	}
+}
+
+// Setup loads the quotas persisted in the given storage and starts enforcing
+// them. Lease count quotas are checked against the counts returned by
+// leaseCount.
+func (m *Manager) Setup(ctx context.Context, storage logical.Storage, leaseCount LeaseCountFunc) error {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	m.storage = storage
+	m.leaseCount = leaseCount
+	m.rateLimitQuotas = make(map[string]*RateLimitQuota)
+	m.leaseCountQuotas = make(map[string]*LeaseCountQuota)
+
+	err := loadQuotas(ctx, storage, TypeRateLimit, func(entry *logical.StorageEntry) error {
+		var q RateLimitQuota
+		if err := entry.DecodeJSON(&q); err != nil {
+			return err
+		}
+		if err := q.initialize(); err != nil {
+			return err
+		}
+		m.rateLimitQuotas[q.Name] = &q
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = loadQuotas(ctx, storage, TypeLeaseCount, func(entry *logical.StorageEntry) error {
+		var q LeaseCountQuota
+		if err := entry.DecodeJSON(&q); err != nil {
+			return err
+		}
+		if err := q.initialize(); err != nil {
+			return err
+		}
+		m.leaseCountQuotas[q.Name] = &q
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(m.rateLimitQuotas) > 0 || len(m.leaseCountQuotas) > 0 {
+		m.logger.Info("loaded quotas", "rate_limit", len(m.rateLimitQuotas), "lease_count", len(m.leaseCountQuotas))
+	}
+
+	return nil
+}
+
+// loadQuotas calls load for each persisted quota of the given type
+func loadQuotas(ctx context.Context, storage logical.Storage, qType Type, load func(*logical.StorageEntry) error) error {
+	prefix := string(qType) + "/"
+	names, err := storage.List(ctx, prefix)
+	if err != nil {
+		return errwrap.Wrapf(fmt.Sprintf("failed to list %s quotas: {{err}}", qType), err)
+	}
+
+	for _, name := range names {
+		entry, err := storage.Get(ctx, prefix+name)
+		if err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("failed to read %s quota %q: {{err}}", qType, name), err)
+		}
+		if entry == nil {
+			continue
+		}
+		if err := load(entry); err != nil {
+			return errwrap.Wrapf(fmt.Sprintf("failed to load %s quota %q: {{err}}", qType, name), err)
+		}
+	}
+
+	return nil
+}
+
+// Reset stops enforcing quotas and drops them from memory. This is called
+// when the node is sealed or steps down.
+func (m *Manager) Reset() {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	m.storage = nil
+	m.leaseCount = nil
+	m.rateLimitQuotas = make(map[string]*RateLimitQuota)
+	m.leaseCountQuotas = make(map[string]*LeaseCountQuota)
+}
+
+// ApplyQuota applies the most specific matching quota of the requested type
+// to the request. A quota on the request's mount takes precedence over a
+// quota on its namespace, which in turn takes precedence over quotas on
+// parent namespaces.
+func (m *Manager) ApplyQuota(req *Request) (Response, error) {
+	switch req.Type {
+	case TypeRateLimit:
+		return m.applyRateLimitQuota(req), nil
+	case TypeLeaseCount:
+		return m.applyLeaseCountQuota(req), nil
+	default:
+		return Response{}, fmt.Errorf("unsupported quota type %q", req.Type)
+	}
+}
+
+func (m *Manager) applyRateLimitQuota(req *Request) Response {
+	m.l.RLock()
+	var match *RateLimitQuota
+	best := -1
+	for _, q := range m.rateLimitQuotas {
+		if rank := specificity(req, q.NamespacePath, q.MountPath); rank > best {
+			match, best = q, rank
+		}
+	}
+	m.l.RUnlock()
+
+	if match == nil {
+		return Response{Allowed: true}
+	}
+
+	resp := match.allow(req.ClientAddress, time.Now())
+	if !resp.Allowed {
+		metrics.IncrCounterWithLabels([]string{"quota", "rate_limit", "violation"}, 1, []metrics.Label{
+			{Name: "name", Value: match.Name},
+		})
+	}
+
+	return resp
+}
+
+func (m *Manager) applyLeaseCountQuota(req *Request) Response {
+	m.l.RLock()
+	defer m.l.RUnlock()
+
+	var match *LeaseCountQuota
+	best := -1
+	for _, q := range m.leaseCountQuotas {
+		if rank := specificity(req, q.NamespacePath, q.MountPath); rank > best {
+			match, best = q, rank
+		}
+	}
+
+	if match == nil {
+		return Response{Allowed: true}
+	}
+
+	resp := match.allow(m.leaseCount)
+	if !resp.Allowed {
+		metrics.IncrCounterWithLabels([]string{"quota", "lease_count", "violation"}, 1, []metrics.Label{
+			{Name: "name", Value: match.Name},
+		})
+	}
+
+	return resp
+}
+
+// specificity ranks how specifically a quota on the given namespace and mount
+// applies to the request. It returns -1 if the quota does not apply at all.
+func specificity(req *Request, nsPath, mountPath string) int {
+	switch {
+	case mountPath != "":
+		if nsPath == req.NamespacePath && mountPath == req.MountPath {
+			// Nothing is more specific than a mount quota
+			return math.MaxInt32
+		}
+	case strings.HasPrefix(req.NamespacePath, nsPath):
+		return len(nsPath)
+	}
+	return -1
+}
+
+// SetRateLimitQuota creates or replaces the rate limit quota with the given
+// name, persisting it to storage. The quota's limits start out full.
+func (m *Manager) SetRateLimitQuota(ctx context.Context, q *RateLimitQuota) error {
+	if err := q.initialize(); err != nil {
+		return err
+	}
+
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	if m.storage == nil {
+		return errors.New("quotas are not available")
+	}
+
+	for _, existing := range m.rateLimitQuotas {
+		if existing.Name != q.Name && existing.NamespacePath == q.NamespacePath && existing.MountPath == q.MountPath {
+			return ErrQuotaPathConflict
+		}
+	}
+
+	if err := m.persist(ctx, TypeRateLimit, q.Name, q); err != nil {
+		return err
+	}
+
+	m.rateLimitQuotas[q.Name] = q
+	return nil
+}
+
+// RateLimitQuota returns a copy of the configuration of the rate limit quota
+// with the given name, or nil if it does not exist
+func (m *Manager) RateLimitQuota(name string) *RateLimitQuota {
+	m.l.RLock()
+	defer m.l.RUnlock()
+
+	q, ok := m.rateLimitQuotas[name]
+	if !ok {
+		return nil
+	}
+	return q.clone()
+}
+
+// RateLimitQuotaNames returns the sorted names of the rate limit quotas of
+// the namespace with the given path
+func (m *Manager) RateLimitQuotaNames(nsPath string) []string {
+	m.l.RLock()
+	defer m.l.RUnlock()
+
+	names := make([]string, 0, len(m.rateLimitQuotas))
+	for name, q := range m.rateLimitQuotas {
+		if q.NamespacePath == nsPath {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DeleteRateLimitQuota removes the rate limit quota with the given name
+func (m *Manager) DeleteRateLimitQuota(ctx context.Context, name string) error {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	if m.storage == nil {
+		return errors.New("quotas are not available")
+	}
+
+	if err := m.storage.Delete(ctx, string(TypeRateLimit)+"/"+name); err != nil {
+		return errwrap.Wrapf("failed to delete rate limit quota: {{err}}", err)
+	}
+
+	delete(m.rateLimitQuotas, name)
+	return nil
+}
+
+// SetLeaseCountQuota creates or replaces the lease count quota with the given
+// name, persisting it to storage
+func (m *Manager) SetLeaseCountQuota(ctx context.Context, q *LeaseCountQuota) error {
+	if err := q.initialize(); err != nil {
+		return err
+	}
+
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	if m.storage == nil {
+		return errors.New("quotas are not available")
+	}
+
+	for _, existing := range m.leaseCountQuotas {
+		if existing.Name != q.Name && existing.NamespacePath == q.NamespacePath && existing.MountPath == q.MountPath {
+			return ErrQuotaPathConflict
+		}
+	}
+
+	if err := m.persist(ctx, TypeLeaseCount, q.Name, q); err != nil {
+		return err
+	}
+
+	m.leaseCountQuotas[q.Name] = q
+	return nil
+}
+
+// LeaseCountQuota returns a copy of the configuration of the lease count
+// quota with the given name, or nil if it does not exist
+func (m *Manager) LeaseCountQuota(name string) *LeaseCountQuota {
+	m.l.RLock()
+	defer m.l.RUnlock()
+
+	q, ok := m.leaseCountQuotas[name]
+	if !ok {
+		return nil
+	}
+	return q.clone()
+}
+
+// LeaseCountQuotaNames returns the sorted names of the lease count quotas of
+// the namespace with the given path
+func (m *Manager) LeaseCountQuotaNames(nsPath string) []string {
+	m.l.RLock()
+	defer m.l.RUnlock()
+
+	names := make([]string, 0, len(m.leaseCountQuotas))
+	for name, q := range m.leaseCountQuotas {
+		if q.NamespacePath == nsPath {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DeleteLeaseCountQuota removes the lease count quota with the given name
+func (m *Manager) DeleteLeaseCountQuota(ctx context.Context, name string) error {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	if m.storage == nil {
+		return errors.New("quotas are not available")
+	}
+
+	if err := m.storage.Delete(ctx, string(TypeLeaseCount)+"/"+name); err != nil {
+		return errwrap.Wrapf("failed to delete lease count quota: {{err}}", err)
+	}
+
+	delete(m.leaseCountQuotas, name)
+	return nil
+}
+
+// persist writes the quota to storage. It must be called with the lock held.
+func (m *Manager) persist(ctx context.Context, qType Type, name string, q interface{}) error {
+	entry, err := logical.StorageEntryJSON(string(qType)+"/"+name, q)
+	if err != nil {
+		return errwrap.Wrapf(fmt.Sprintf("failed to encode %s quota: {{err}}", qType), err)
+	}
+	if err := m.storage.Put(ctx, entry); err != nil {
+		return errwrap.Wrapf(fmt.Sprintf("failed to persist %s quota: {{err}}", qType), err)
+	}
+	return nil
+}
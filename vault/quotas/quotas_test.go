@@ -0,0 +1,223 @@
+package quotas
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	log "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/helper/logging"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func testManager(t *testing.T) (*Manager, logical.Storage) {
+	t.Helper()
+
+	storage := &logical.InmemStorage{}
+	m := NewManager(logging.NewVaultLogger(log.Trace))
+	if err := m.Setup(context.Background(), storage, nil); err != nil {
+		t.Fatal(err)
+	}
+	return m, storage
+}
+
+func TestRateLimitQuota_Allow(t *testing.T) {
+	q := NewRateLimitQuota("test", "", "", 2, 0, time.Minute, false)
+	if err := q.initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if q.Burst != 2 {
+		t.Fatalf("expected burst to default to the rate, got %d", q.Burst)
+	}
+
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if resp := q.allow("127.0.0.1", now); !resp.Allowed {
+			t.Fatalf("request %d should have been allowed", i)
+		}
+	}
+
+	resp := q.allow("127.0.0.2", now)
+	if resp.Allowed {
+		t.Fatal("request should have been rejected")
+	}
+	if resp.RetryAfter <= 0 || resp.RetryAfter > 30*time.Second {
+		t.Fatalf("bad retry after: %v", resp.RetryAfter)
+	}
+
+	// Rejected requests do not consume tokens, so a token is available once
+	// the retry period has passed
+	if resp := q.allow("127.0.0.1", now.Add(resp.RetryAfter)); !resp.Allowed {
+		t.Fatal("request should have been allowed after waiting")
+	}
+}
+
+func TestRateLimitQuota_PerClientAddress(t *testing.T) {
+	q := NewRateLimitQuota("test", "", "", 1, 1, time.Minute, true)
+	if err := q.initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if resp := q.allow("127.0.0.1", now); !resp.Allowed {
+		t.Fatal("request should have been allowed")
+	}
+	if resp := q.allow("127.0.0.1", now); resp.Allowed {
+		t.Fatal("request should have been rejected")
+	}
+	if resp := q.allow("127.0.0.2", now); !resp.Allowed {
+		t.Fatal("request from another client should have been allowed")
+	}
+
+	// Limiters of clients that have gone quiet are purged
+	if resp := q.allow("127.0.0.3", now.Add(10*time.Minute)); !resp.Allowed {
+		t.Fatal("request should have been allowed")
+	}
+	if len(q.clientLimiters) != 1 {
+		t.Fatalf("expected stale client limiters to be purged, have %d", len(q.clientLimiters))
+	}
+}
+
+func TestManager_ApplyQuota_Precedence(t *testing.T) {
+	m, _ := testManager(t)
+	ctx := context.Background()
+
+	for _, q := range []*RateLimitQuota{
+		NewRateLimitQuota("global", "", "", 1, 1, time.Hour, false),
+		NewRateLimitQuota("namespace", "ns1/", "", 1, 1, time.Hour, false),
+		NewRateLimitQuota("mount", "ns1/", "secret/", 1, 1, time.Hour, false),
+	} {
+		if err := m.SetRateLimitQuota(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		req      *Request
+		expected string
+	}{
+		{&Request{Type: TypeRateLimit, MountPath: "secret/"}, "global"},
+		{&Request{Type: TypeRateLimit, NamespacePath: "ns1/", MountPath: "kv/"}, "namespace"},
+		{&Request{Type: TypeRateLimit, NamespacePath: "ns1/ns2/", MountPath: "secret/"}, "namespace"},
+		{&Request{Type: TypeRateLimit, NamespacePath: "ns1/", MountPath: "secret/"}, "mount"},
+	}
+	for _, tc := range cases {
+		resp, err := m.ApplyQuota(tc.req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Quota != tc.expected {
+			t.Fatalf("expected quota %q to apply to %#v, got %q", tc.expected, tc.req, resp.Quota)
+		}
+	}
+
+	if err := m.SetRateLimitQuota(ctx, NewRateLimitQuota("conflict", "ns1/", "secret/", 1, 1, 0, false)); err != ErrQuotaPathConflict {
+		t.Fatalf("expected path conflict error, got %v", err)
+	}
+}
+
+func TestManager_Persistence(t *testing.T) {
+	m, storage := testManager(t)
+	ctx := context.Background()
+
+	if err := m.SetRateLimitQuota(ctx, NewRateLimitQuota("test", "", "secret/", 5, 10, time.Minute, true)); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Reset()
+	if resp, err := m.ApplyQuota(&Request{Type: TypeRateLimit, MountPath: "secret/"}); err != nil || resp.Quota != "" {
+		t.Fatalf("expected no quotas to apply after reset, got %#v, %v", resp, err)
+	}
+
+	if err := m.Setup(ctx, storage, nil); err != nil {
+		t.Fatal(err)
+	}
+	q := m.RateLimitQuota("test")
+	if q == nil {
+		t.Fatal("expected quota to be loaded")
+	}
+	if q.MountPath != "secret/" || q.Rate != 5 || q.Burst != 10 || q.Interval != time.Minute || !q.PerClientAddress {
+		t.Fatalf("bad quota: %#v", q)
+	}
+
+	if err := m.DeleteRateLimitQuota(ctx, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if names := m.RateLimitQuotaNames(""); len(names) != 0 {
+		t.Fatalf("expected no quotas, got %v", names)
+	}
+}
+
+func TestManager_LeaseCountQuota(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	m := NewManager(logging.NewVaultLogger(log.Trace))
+	ctx := context.Background()
+
+	counts := map[string]int{
+		"secret/": 2,
+		"kv/":     1,
+	}
+	leaseCount := func(nsPath, mountPath string) int {
+		if mountPath != "" {
+			return counts[nsPath+mountPath]
+		}
+		var total int
+		for _, count := range counts {
+			total += count
+		}
+		return total
+	}
+	if err := m.Setup(ctx, storage, leaseCount); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.SetLeaseCountQuota(ctx, NewLeaseCountQuota("global", "", "", 4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetLeaseCountQuota(ctx, NewLeaseCountQuota("secret", "", "secret/", 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetLeaseCountQuota(ctx, NewLeaseCountQuota("invalid", "", "", 0)); err == nil {
+		t.Fatal("expected an error for a non-positive max_leases")
+	}
+
+	apply := func(mountPath string) Response {
+		t.Helper()
+		resp, err := m.ApplyQuota(&Request{Type: TypeLeaseCount, MountPath: mountPath})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := apply("secret/"); resp.Allowed || resp.Quota != "secret" {
+		t.Fatalf("expected the mount quota to reject the lease, got %#v", resp)
+	}
+	if resp := apply("kv/"); !resp.Allowed || resp.Quota != "global" {
+		t.Fatalf("expected the global quota to allow the lease, got %#v", resp)
+	}
+
+	counts["kv/"] = 2
+	if resp := apply("kv/"); resp.Allowed {
+		t.Fatalf("expected the global quota to reject the lease, got %#v", resp)
+	}
+
+	// Lease count quotas are persisted alongside rate limit quotas
+	m.Reset()
+	if err := m.Setup(ctx, storage, leaseCount); err != nil {
+		t.Fatal(err)
+	}
+	if names := m.LeaseCountQuotaNames(""); len(names) != 2 {
+		t.Fatalf("expected 2 lease count quotas, got %v", names)
+	}
+	if q := m.LeaseCountQuota("secret"); q == nil || q.MountPath != "secret/" || q.MaxLeases != 2 {
+		t.Fatalf("bad quota: %#v", q)
+	}
+
+	if err := m.DeleteLeaseCountQuota(ctx, "global"); err != nil {
+		t.Fatal(err)
+	}
+	if resp := apply("kv/"); !resp.Allowed || resp.Quota != "" {
+		t.Fatalf("expected no quota to apply, got %#v", resp)
+	}
+}
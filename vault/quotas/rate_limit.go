@@ -0,0 +1,170 @@
+package quotas
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// DefaultRateLimitInterval is the interval over which the rate of a rate
+	// limit quota is measured if none is given
+	DefaultRateLimitInterval = time.Second
+
+	// clientPurgeInterval is how often limiters of clients that have stopped
+	// making requests are purged
+	clientPurgeInterval = time.Minute
+)
+
+// RateLimitQuota limits the rate of requests using a token bucket. Either
+// all the requests it applies to share a single bucket, or each client
+// address gets a bucket of its own.
+type RateLimitQuota struct {
+	// Name is the unique name of the quota
+	Name string `json:"name"`
+
+	// NamespacePath is the namespace the quota applies to. It is empty for
+	// the root namespace.
+	NamespacePath string `json:"namespace_path"`
+
+	// MountPath is the mount, relative to the namespace, that the quota
+	// applies to. If empty, the quota applies to the whole namespace.
+	MountPath string `json:"mount_path"`
+
+	// Rate is the number of requests allowed per Interval
+	Rate int `json:"rate"`
+
+	// Interval is the period over which Rate is measured
+	Interval time.Duration `json:"interval"`
+
+	// Burst is the maximum number of requests allowed at once
+	Burst int `json:"burst"`
+
+	// PerClientAddress gives each client address its own bucket
+	PerClientAddress bool `json:"per_client_address"`
+
+	l              sync.Mutex
+	limiter        *rate.Limiter
+	clientLimiters map[string]*clientLimiter
+	lastPurge      time.Time
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewRateLimitQuota returns a new rate limit quota. The quota is validated
+// when it is set on the Manager.
+func NewRateLimitQuota(name, nsPath, mountPath string, limit, burst int, interval time.Duration, perClientAddress bool) *RateLimitQuota {
+	return &RateLimitQuota{
+		Name:             name,
+		NamespacePath:    nsPath,
+		MountPath:        mountPath,
+		Rate:             limit,
+		Interval:         interval,
+		Burst:            burst,
+		PerClientAddress: perClientAddress,
+	}
+}
+
+// initialize validates the quota, applies defaults and creates its limiters
+func (q *RateLimitQuota) initialize() error {
+	switch {
+	case q.Name == "":
+		return errors.New("quota name must be provided")
+	case q.Rate <= 0:
+		return errors.New("rate must be positive")
+	case q.Interval < 0:
+		return errors.New("interval must not be negative")
+	case q.Burst < 0:
+		return errors.New("burst must not be negative")
+	}
+
+	if q.Interval == 0 {
+		q.Interval = DefaultRateLimitInterval
+	}
+	if q.Burst == 0 {
+		q.Burst = q.Rate
+	}
+
+	q.limiter = q.newLimiter()
+	q.clientLimiters = make(map[string]*clientLimiter)
+	q.lastPurge = time.Now()
+
+	return nil
+}
+
+func (q *RateLimitQuota) newLimiter() *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(float64(q.Rate)/q.Interval.Seconds()), q.Burst)
+}
+
+// clone returns a copy of the quota's configuration
+func (q *RateLimitQuota) clone() *RateLimitQuota {
+	return NewRateLimitQuota(q.Name, q.NamespacePath, q.MountPath, q.Rate, q.Burst, q.Interval, q.PerClientAddress)
+}
+
+// allow consumes a token from the bucket for the client, reporting how long
+// to wait if none is available
+func (q *RateLimitQuota) allow(clientAddress string, now time.Time) Response {
+	limiter := q.limiter
+	if q.PerClientAddress {
+		limiter = q.clientLimiter(clientAddress, now)
+	}
+
+	r := limiter.ReserveN(now, 1)
+	if !r.OK() {
+		return Response{Quota: q.Name}
+	}
+
+	delay := r.DelayFrom(now)
+	if delay > 0 {
+		// Rejected requests do not consume tokens
+		r.CancelAt(now)
+		return Response{
+			Quota:      q.Name,
+			RetryAfter: delay,
+		}
+	}
+
+	return Response{
+		Allowed: true,
+		Quota:   q.Name,
+	}
+}
+
+// clientLimiter returns the limiter for the client address, creating it if
+// needed and purging those of clients that have gone quiet
+func (q *RateLimitQuota) clientLimiter(clientAddress string, now time.Time) *rate.Limiter {
+	q.l.Lock()
+	defer q.l.Unlock()
+
+	if now.Sub(q.lastPurge) > clientPurgeInterval {
+		// A bucket that has not been used for the time it takes to refill
+		// is indistinguishable from a new one
+		staleAfter := time.Duration(math.Ceil(float64(q.Burst)/float64(q.Rate))) * q.Interval
+		if staleAfter < clientPurgeInterval {
+			staleAfter = clientPurgeInterval
+		}
+		for addr, cl := range q.clientLimiters {
+			if now.Sub(cl.lastSeen) > staleAfter {
+				delete(q.clientLimiters, addr)
+			}
+		}
+		q.lastPurge = now
+	}
+
+	cl, ok := q.clientLimiters[clientAddress]
+	if !ok {
+		cl = &clientLimiter{
+			limiter: q.newLimiter(),
+		}
+		q.clientLimiters[clientAddress] = cl
+	}
+	cl.lastSeen = now
+
+	return cl.limiter
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/hashicorp/vault/sdk/helper/strutil"
 	"github.com/hashicorp/vault/sdk/helper/wrapping"
 	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/vault/quotas"
 )
 
 const (
@@ -810,7 +811,11 @@ func (c *Core) handleRequest(ctx context.Context, req *logical.Request) (retResp
 			}
 
 			leaseID, err := registerFunc(ctx, req, resp)
-			if err != nil {
+			switch {
+			case err == nil:
+			case errwrap.Contains(err, quotas.ErrLeaseCountQuotaExceeded.Error()):
+				return logical.ErrorResponse(err.Error()), auth, logical.ErrInvalidRequest
+			default:
 				c.logger.Error("failed to register lease", "request_path", req.Path, "error", err)
 				retErr = multierror.Append(retErr, ErrInternalError)
 				return nil, auth, retErr
@@ -1023,6 +1028,13 @@ func (c *Core) handleLoginRequest(ctx context.Context, req *logical.Request) (re
 		return nil, nil, ErrInternalError
 	}
 
+	// Logins completed at sys/mfa/validate already had their token created
+	// when their MFA requirement was satisfied
+	if req.Path == mfaValidatePath && resp != nil && resp.Auth != nil {
+		req.DisplayName = resp.Auth.DisplayName
+		return resp, resp.Auth, routeErr
+	}
+
 	// If the response generated an authentication, then generate the token
 	if resp != nil && resp.Auth != nil {
 
@@ -1073,85 +1085,122 @@ func (c *Core) handleLoginRequest(ctx context.Context, req *logical.Request) (re
 			}
 		}
 
-		// Determine the source of the login
-		source := c.router.MatchingMount(ctx, req.Path)
-		source = strings.TrimPrefix(source, credentialRoutePrefix)
-		source = strings.Replace(source, "/", "-", -1)
-
-		// Prepend the source to the display name
-		auth.DisplayName = strings.TrimSuffix(source+auth.DisplayName, "-")
+		// Logins that a login enforcement applies to get no token until
+		// their MFA requirement is satisfied at sys/mfa/validate
+		if mEntry != nil && c.identityStore != nil {
+			requirement, err := c.identityStore.loginMFARequirement(ctx, mEntry, entity)
+			switch {
+			case err == errLoginMFANoEntity:
+				return logical.ErrorResponse(err.Error()), nil, logical.ErrPermissionDenied
+			case err != nil:
+				return nil, nil, err
+			case requirement != nil:
+				ns, err := namespace.FromContext(ctx)
+				if err != nil {
+					return nil, nil, err
+				}
+				c.identityStore.storePendingMFALogin(ns, req.Path, resp, requirement)
 
-		sysView := c.router.MatchingSystemView(ctx, req.Path)
-		if sysView == nil {
-			c.logger.Error("unable to look up sys view for login path", "request_path", req.Path)
-			return nil, nil, ErrInternalError
+				mfaAuth := &logical.Auth{
+					MFARequirement: requirement,
+				}
+				return &logical.Response{
+					Auth: mfaAuth,
+				}, mfaAuth, nil
+			}
 		}
 
-		tokenTTL, warnings, err := framework.CalculateTTL(sysView, 0, auth.TTL, auth.Period, auth.MaxTTL, auth.ExplicitMaxTTL, time.Time{})
-		if err != nil {
-			return nil, nil, err
-		}
-		for _, warning := range warnings {
-			resp.AddWarning(warning)
+		if errResp, err := c.loginCreateToken(ctx, req.Path, resp); err != nil {
+			return errResp, auth, err
 		}
 
-		ns, err := namespace.FromContext(ctx)
-		if err != nil {
-			return nil, nil, err
-		}
-		_, identityPolicies, err := c.fetchEntityAndDerivedPolicies(ctx, ns, auth.EntityID)
-		if err != nil {
-			return nil, nil, ErrInternalError
-		}
+		// Attach the display name, might be used by audit backends
+		req.DisplayName = auth.DisplayName
 
-		auth.TokenPolicies = policyutil.SanitizePolicies(auth.Policies, !auth.NoDefaultPolicy)
-		allPolicies := policyutil.SanitizePolicies(append(auth.TokenPolicies, identityPolicies[ns.ID]...), policyutil.DoNotAddDefaultPolicy)
+	}
 
-		// Prevent internal policies from being assigned to tokens. We check
-		// this on auth.Policies including derived ones from Identity before
-		// actually making the token.
-		for _, policy := range allPolicies {
-			if policy == "root" {
-				return logical.ErrorResponse("auth methods cannot create root tokens"), nil, logical.ErrInvalidRequest
-			}
-			if strutil.StrListContains(nonAssignablePolicies, policy) {
-				return logical.ErrorResponse(fmt.Sprintf("cannot assign policy %q", policy)), nil, logical.ErrInvalidRequest
-			}
-		}
+	return resp, auth, routeErr
+}
 
-		var registerFunc RegisterAuthFunc
-		var funcGetErr error
-		// Batch tokens should not be forwarded to perf standby
-		if auth.TokenType == logical.TokenTypeBatch {
-			registerFunc = c.RegisterAuth
-		} else {
-			registerFunc, funcGetErr = getAuthRegisterFunc(c)
-		}
-		if funcGetErr != nil {
-			retErr = multierror.Append(retErr, funcGetErr)
-			return nil, auth, retErr
-		}
+// loginCreateToken creates the token of a successful login on path and adds
+// it to the auth of the response. An error response may be returned along
+// with the error.
+func (c *Core) loginCreateToken(ctx context.Context, path string, resp *logical.Response) (*logical.Response, error) {
+	auth := resp.Auth
 
-		err = registerFunc(ctx, tokenTTL, req.Path, auth)
-		switch {
-		case err == nil:
-		case err == ErrInternalError:
-			return nil, auth, err
-		default:
-			return logical.ErrorResponse(err.Error()), auth, logical.ErrInvalidRequest
-		}
+	// Determine the source of the login
+	source := c.router.MatchingMount(ctx, path)
+	source = strings.TrimPrefix(source, credentialRoutePrefix)
+	source = strings.Replace(source, "/", "-", -1)
 
-		auth.IdentityPolicies = policyutil.SanitizePolicies(identityPolicies[ns.ID], policyutil.DoNotAddDefaultPolicy)
-		delete(identityPolicies, ns.ID)
-		auth.ExternalNamespacePolicies = identityPolicies
-		auth.Policies = allPolicies
+	// Prepend the source to the display name
+	auth.DisplayName = strings.TrimSuffix(source+auth.DisplayName, "-")
 
-		// Attach the display name, might be used by audit backends
-		req.DisplayName = auth.DisplayName
+	sysView := c.router.MatchingSystemView(ctx, path)
+	if sysView == nil {
+		c.logger.Error("unable to look up sys view for login path", "request_path", path)
+		return nil, ErrInternalError
+	}
 
+	tokenTTL, warnings, err := framework.CalculateTTL(sysView, 0, auth.TTL, auth.Period, auth.MaxTTL, auth.ExplicitMaxTTL, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range warnings {
+		resp.AddWarning(warning)
 	}
 
-	return resp, auth, routeErr
+	ns, err := namespace.FromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, identityPolicies, err := c.fetchEntityAndDerivedPolicies(ctx, ns, auth.EntityID)
+	if err != nil {
+		return nil, ErrInternalError
+	}
+
+	auth.TokenPolicies = policyutil.SanitizePolicies(auth.Policies, !auth.NoDefaultPolicy)
+	allPolicies := policyutil.SanitizePolicies(append(auth.TokenPolicies, identityPolicies[ns.ID]...), policyutil.DoNotAddDefaultPolicy)
+
+	// Prevent internal policies from being assigned to tokens. We check
+	// this on auth.Policies including derived ones from Identity before
+	// actually making the token.
+	for _, policy := range allPolicies {
+		if policy == "root" {
+			return logical.ErrorResponse("auth methods cannot create root tokens"), logical.ErrInvalidRequest
+		}
+		if strutil.StrListContains(nonAssignablePolicies, policy) {
+			return logical.ErrorResponse(fmt.Sprintf("cannot assign policy %q", policy)), logical.ErrInvalidRequest
+		}
+	}
+
+	var registerFunc RegisterAuthFunc
+	var funcGetErr error
+	// Batch tokens should not be forwarded to perf standby
+	if auth.TokenType == logical.TokenTypeBatch {
+		registerFunc = c.RegisterAuth
+	} else {
+		registerFunc, funcGetErr = getAuthRegisterFunc(c)
+	}
+	if funcGetErr != nil {
+		return nil, multierror.Append(nil, funcGetErr)
+	}
+
+	err = registerFunc(ctx, tokenTTL, path, auth)
+	switch {
+	case err == nil:
+	case err == ErrInternalError:
+		return nil, err
+	default:
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	auth.IdentityPolicies = policyutil.SanitizePolicies(identityPolicies[ns.ID], policyutil.DoNotAddDefaultPolicy)
+	delete(identityPolicies, ns.ID)
+	auth.ExternalNamespacePolicies = identityPolicies
+	auth.Policies = allPolicies
+
+	return nil, nil
 }
 
 func (c *Core) RegisterAuth(ctx context.Context, tokenTTL time.Duration, path string, auth *logical.Auth) error {
@@ -59,6 +59,10 @@ type routeEntry struct {
 	rootPaths     atomic.Value
 	loginPaths    atomic.Value
 	l             sync.RWMutex
+
+	// loginWildcardPaths holds the unauthenticated paths containing "+"
+	// segments, which cannot be matched through the radix tree
+	loginWildcardPaths atomic.Value
 }
 
 type validateMountResponse struct {
@@ -140,6 +144,7 @@ func (r *Router) Mount(backend logical.Backend, prefix string, mountEntry *Mount
 	}
 	re.rootPaths.Store(pathsToRadix(paths.Root))
 	re.loginPaths.Store(pathsToRadix(paths.Unauthenticated))
+	re.loginWildcardPaths.Store(parseWildcardPaths(paths.Unauthenticated))
 
 	switch {
 	case prefix == "":
@@ -587,6 +592,9 @@ func (r *Router) routeCommon(ctx context.Context, req *logical.Request, existenc
 			req.ClientToken = te.CubbyholeID
 		}
 
+	case identityOIDCProviderEndpoint(originalPath) == "userinfo":
+		// The userinfo endpoint of identity OIDC providers is called with
+		// the access tokens issued by the provider, which it verifies itself
 	default:
 		req.ClientToken = re.SaltID(req.ClientToken)
 	}
@@ -625,6 +633,17 @@ func (r *Router) routeCommon(ctx context.Context, req *logical.Request, existenc
 		req.Headers = filteredHeaders(headers, passthroughRequestHeaders, deniedPassthroughRequestHeaders)
 	}
 
+	// The token endpoint of identity OIDC providers authenticates clients
+	// with HTTP Basic credentials
+	if identityOIDCProviderEndpoint(originalPath) == "token" {
+		if req.Headers == nil {
+			req.Headers = make(map[string][]string)
+		}
+		for k, v := range filteredHeaders(headers, []string{"Authorization"}, nil) {
+			req.Headers[k] = v
+		}
+	}
+
 	// Cache the wrap info of the request
 	var wrapInfo *logical.RequestWrapInfo
 	if req.WrapInfo != nil {
@@ -793,24 +812,39 @@ func (r *Router) LoginPath(ctx context.Context, path string) bool {
 	// Check the loginPaths of this backend
 	loginPaths := re.loginPaths.Load().(*radix.Tree)
 	match, raw, ok := loginPaths.LongestPrefix(remain)
-	if !ok {
-		return false
+	if ok {
+		prefixMatch := raw.(bool)
+
+		// Handle the prefix match case
+		if prefixMatch && strings.HasPrefix(remain, match) {
+			return true
+		}
+
+		// Handle the exact match case
+		if match == remain {
+			return true
+		}
 	}
-	prefixMatch := raw.(bool)
 
-	// Handle the prefix match case
-	if prefixMatch {
-		return strings.HasPrefix(remain, match)
+	// Check the login paths containing wildcard segments
+	for _, wp := range re.loginWildcardPaths.Load().([]wildcardPath) {
+		if wp.matches(remain) {
+			return true
+		}
 	}
 
-	// Handle the exact match case
-	return match == remain
+	return false
 }
 
-// pathsToRadix converts a list of special paths to a radix tree.
+// pathsToRadix converts a list of special paths to a radix tree. Paths
+// containing wildcard segments are left out; see parseWildcardPaths.
 func pathsToRadix(paths []string) *radix.Tree {
 	tree := radix.New()
 	for _, path := range paths {
+		if isWildcardPath(path) {
+			continue
+		}
+
 		// Check if this is a prefix or exact match
 		prefixMatch := len(path) >= 1 && path[len(path)-1] == '*'
 		if prefixMatch {
@@ -823,6 +857,85 @@ func pathsToRadix(paths []string) *radix.Tree {
 	return tree
 }
 
+// identityOIDCProviderEndpoint returns the endpoint of an identity OIDC
+// provider that path refers to, e.g. "token" for
+// "identity/oidc/provider/default/token", or "" for any other path.
+func identityOIDCProviderEndpoint(path string) string {
+	if !strings.HasPrefix(path, "identity/oidc/provider/") {
+		return ""
+	}
+
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(path, "identity/oidc/provider/"), "/"), "/")
+	if len(parts) != 2 {
+		return ""
+	}
+
+	return parts[1]
+}
+
+// wildcardPath is a special path in which "+" segments match any single,
+// non-empty path segment, e.g. "oidc/provider/+/token". Like other special
+// paths, it may end in "*" to match by prefix.
+type wildcardPath struct {
+	segments []string
+	isPrefix bool
+}
+
+func isWildcardPath(path string) bool {
+	for _, segment := range strings.Split(strings.TrimSuffix(path, "*"), "/") {
+		if segment == "+" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseWildcardPaths returns the special paths containing wildcard segments
+func parseWildcardPaths(paths []string) []wildcardPath {
+	var wildcardPaths []wildcardPath
+	for _, path := range paths {
+		if !isWildcardPath(path) {
+			continue
+		}
+
+		isPrefix := strings.HasSuffix(path, "*")
+		wildcardPaths = append(wildcardPaths, wildcardPath{
+			segments: strings.Split(strings.TrimSuffix(path, "*"), "/"),
+			isPrefix: isPrefix,
+		})
+	}
+
+	return wildcardPaths
+}
+
+// matches checks whether path matches the wildcard path segment by segment.
+// For prefix paths, the last segment only needs to be a prefix of the
+// corresponding path segment and any further segments are ignored.
+func (wp wildcardPath) matches(path string) bool {
+	segments := strings.Split(path, "/")
+	if len(segments) < len(wp.segments) || (!wp.isPrefix && len(segments) != len(wp.segments)) {
+		return false
+	}
+
+	last := len(wp.segments) - 1
+	for i, segment := range wp.segments {
+		switch {
+		case segment == "+":
+			if segments[i] == "" {
+				return false
+			}
+		case i == last && wp.isPrefix:
+			if !strings.HasPrefix(segments[i], segment) {
+				return false
+			}
+		case segments[i] != segment:
+			return false
+		}
+	}
+
+	return true
+}
+
 // filteredHeaders returns a headers map[string][]string that
 // contains the filtered values contained in candidateHeaders. Filtering of
 // candidateHeaders from the origHeaders is done is a case-insensitive manner.
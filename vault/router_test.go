@@ -348,6 +348,8 @@ func TestRouter_LoginPath(t *testing.T) {
 		Login: []string{
 			"login",
 			"oauth/*",
+			"+/wildcard/glob*",
+			"end/+",
 		},
 	}
 	err = r.Mount(n, "auth/foo/", &MountEntry{UUID: meUUID, Accessor: "authfooaccessor", NamespaceID: namespace.RootNamespaceID, namespace: namespace.RootNamespace}, view)
@@ -365,6 +367,13 @@ func TestRouter_LoginPath(t *testing.T) {
 		{"auth/foo/login", true},
 		{"auth/foo/oauth", false},
 		{"auth/foo/oauth/redirect", true},
+		{"auth/foo/bar/wildcard/glob", true},
+		{"auth/foo/bar/wildcard/glob2/baz", true},
+		{"auth/foo/bar/baz/wildcard/glob", false},
+		{"auth/foo/wildcard/glob", false},
+		{"auth/foo/end/bar", true},
+		{"auth/foo/end/bar/baz", false},
+		{"auth/foo/end/", false},
 	}
 
 	for _, tc := range tcases {
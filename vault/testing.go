@@ -157,6 +157,7 @@ func TestCoreWithSealAndUI(t testing.T, opts *CoreConfig) *Core {
 	conf.LicensingConfig = opts.LicensingConfig
 	conf.DisableKeyEncodingChecks = opts.DisableKeyEncodingChecks
 	conf.MetricsHelper = opts.MetricsHelper
+	conf.UsageGaugePeriod = opts.UsageGaugePeriod
 
 	if opts.Logger != nil {
 		conf.Logger = opts.Logger
@@ -1415,6 +1416,7 @@ func NewTestCluster(t testing.T, base *CoreConfig, opts *TestClusterOptions) *Te
 
 		coreConfig.DevToken = base.DevToken
 		coreConfig.CounterSyncInterval = base.CounterSyncInterval
+		coreConfig.UsageGaugePeriod = base.UsageGaugePeriod
 
 	}
 
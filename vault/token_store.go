@@ -1376,6 +1376,13 @@ func (ts *TokenStore) revokeInternal(ctx context.Context, saltedID string, skipO
 		return err
 	}
 
+	// Destroy the state of the control group request of the token, if any
+	if len(entry.Policies) == 1 && entry.Policies[0] == controlGroupPolicyName {
+		if err := ts.core.deleteControlGroupEntry(ctx, entry.Accessor); err != nil {
+			return err
+		}
+	}
+
 	revokeCtx := namespace.ContextWithNamespace(ts.quitContext, tokenNS)
 	if err := ts.expiration.RevokeByToken(revokeCtx, entry); err != nil {
 		return err